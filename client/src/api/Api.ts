@@ -589,6 +589,8 @@ class Api {
 
     QUERY_LOG_CLEAR = { path: 'querylog_clear', method: 'POST' };
 
+    QUERY_LOG_EXPORT = { path: 'querylog/export', method: 'GET' };
+
     getQueryLog(params: any) {
         const { path, method } = this.GET_QUERY_LOG;
         // eslint-disable-next-line no-param-reassign
@@ -618,6 +620,12 @@ class Api {
         return this.makeRequest(path, method);
     }
 
+    getQueryLogExportUrl(params: any) {
+        const { path } = this.QUERY_LOG_EXPORT;
+
+        return `${this.baseUrl}/${getPathWithQueryString(path, params)}`;
+    }
+
     // Login
     LOGIN = { path: 'login', method: 'POST' };
 
@@ -34,10 +34,11 @@ interface ClientCellProps {
         disallowed_rule: string;
     };
     domain: string;
+    registrableDomain?: string;
     reason: string;
 }
 
-const ClientCell = ({ client, client_id, client_info, domain, reason }: ClientCellProps) => {
+const ClientCell = ({ client, client_id, client_info, domain, registrableDomain, reason }: ClientCellProps) => {
     const { t } = useTranslation();
     const dispatch = useDispatch();
     const history = useHistory();
@@ -142,6 +143,17 @@ const ClientCell = ({ client, client_id, client_info, domain, reason }: ClientCe
             },
         ];
 
+        if (!isFiltered && registrableDomain && registrableDomain !== domain) {
+            BUTTON_OPTIONS.splice(1, 0, {
+                name: 'block_entire_domain',
+                onClick: async () => {
+                    await dispatch(toggleBlocking(BLOCK_ACTIONS.BLOCK, registrableDomain));
+                    await dispatch(getStats());
+                    setOptionsOpened(false);
+                },
+            });
+        }
+
         if (!clientIds.includes(client)) {
             BUTTON_OPTIONS.push({
                 name: 'add_persistent_client',
@@ -5,9 +5,15 @@ import { useDispatch } from 'react-redux';
 import Form from './Form';
 import { refreshFilteredLogs } from '../../../actions/queryLogs';
 import { addSuccessToast } from '../../../actions/toasts';
+import apiClient from '../../../api/Api';
+
+const EXPORT_FORMATS = ['csv', 'jsonl'];
 
 interface FiltersProps {
-    filter: object;
+    filter: {
+        search?: string;
+        response_status?: string;
+    };
     processingGetLogs: boolean;
     setIsLoading: (...args: unknown[]) => unknown;
 }
@@ -37,6 +43,17 @@ const Filters = ({ filter, setIsLoading }: FiltersProps) => {
                         <use xlinkHref="#update" />
                     </svg>
                 </button>
+
+                {EXPORT_FORMATS.map((format) => (
+                    <a
+                        key={format}
+                        className="btn btn-outline-secondary btn-sm ml-2"
+                        title={t('query_log_export')}
+                        href={apiClient.getQueryLogExportUrl({ ...filter, format })}
+                        download>
+                        {format.toUpperCase()}
+                    </a>
+                ))}
             </h1>
 
             <Form
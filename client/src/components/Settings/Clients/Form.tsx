@@ -46,6 +46,17 @@ const settingsCheckboxes = [
     },
 ];
 
+const overrideCheckboxes = [
+    {
+        name: 'use_own_safebrowsing',
+        placeholder: 'client_own_safebrowsing',
+    },
+    {
+        name: 'use_own_parental',
+        placeholder: 'client_own_parental',
+    },
+];
+
 const logAndStatsCheckboxes = [
     {
         name: 'ignore_querylog',
@@ -153,6 +164,8 @@ interface FormProps {
     submitting: boolean;
     handleClose: (...args: unknown[]) => unknown;
     useGlobalSettings?: boolean;
+    useOwnSafeBrowsing?: boolean;
+    useOwnParental?: boolean;
     useGlobalServices?: boolean;
     blockedServicesSchedule?: {
         time_zone: string;
@@ -175,6 +188,8 @@ let Form = (props: FormProps) => {
         change,
         submitting,
         useGlobalSettings,
+        useOwnSafeBrowsing,
+        useOwnParental,
         useGlobalServices,
         blockedServicesSchedule,
         handleClose,
@@ -192,6 +207,19 @@ let Form = (props: FormProps) => {
 
     const [activeTabLabel, setActiveTabLabel] = useState('settings');
 
+    const isSettingDisabled = (name: string) => {
+        switch (name) {
+            case 'use_global_settings':
+                return false;
+            case 'safebrowsing_enabled':
+                return useGlobalSettings && !useOwnSafeBrowsing;
+            case 'parental_enabled':
+                return useGlobalSettings && !useOwnParental;
+            default:
+                return useGlobalSettings;
+        }
+    };
+
     const handleScheduleSubmit = (values: any) => {
         change('blocked_services_schedule', { ...values });
     };
@@ -210,7 +238,18 @@ let Form = (props: FormProps) => {
                                 type="checkbox"
                                 component={CheckboxField}
                                 placeholder={t(setting.placeholder)}
-                                disabled={setting.name !== 'use_global_settings' ? useGlobalSettings : false}
+                                disabled={isSettingDisabled(setting.name)}
+                            />
+                        </div>
+                    ))}
+
+                    {overrideCheckboxes.map((setting) => (
+                        <div className="form__group" key={setting.name}>
+                            <Field
+                                name={setting.name}
+                                type="checkbox"
+                                component={CheckboxField}
+                                placeholder={t(setting.placeholder)}
                             />
                         </div>
                     ))}
@@ -495,10 +534,14 @@ const selector = formValueSelector(FORM_NAME.CLIENT);
 
 Form = connect((state) => {
     const useGlobalSettings = selector(state, 'use_global_settings');
+    const useOwnSafeBrowsing = selector(state, 'use_own_safebrowsing');
+    const useOwnParental = selector(state, 'use_own_parental');
     const useGlobalServices = selector(state, 'use_global_blocked_services');
     const blockedServicesSchedule = selector(state, 'blocked_services_schedule');
     return {
         useGlobalSettings,
+        useOwnSafeBrowsing,
+        useOwnParental,
         useGlobalServices,
         blockedServicesSchedule,
     };
@@ -372,6 +372,7 @@ export const SPECIAL_FILTER_ID = {
     PARENTAL: -3,
     SAFE_BROWSING: -4,
     SAFE_SEARCH: -5,
+    NEW_DOMAIN: -6,
 };
 
 export const BLOCK_ACTIONS = {
@@ -81,7 +81,12 @@ export const normalizeLogs = (logs: any) =>
             ecs,
         } = log;
 
-        const { name: domain, unicode_name: unicodeName, type } = question;
+        const {
+            name: domain,
+            unicode_name: unicodeName,
+            registrable_domain: registrableDomain,
+            type,
+        } = question;
 
         const processResponse = (data: any) =>
             data
@@ -104,6 +109,7 @@ export const normalizeLogs = (logs: any) =>
             time,
             domain,
             unicodeName,
+            registrableDomain,
             type,
             response: processResponse(answer),
             reason,
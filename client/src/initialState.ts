@@ -104,6 +104,8 @@ export type Client = {
     upstreams_cache_size: number;
     use_global_blocked_services: boolean;
     use_global_settings: boolean;
+    use_own_safebrowsing: boolean;
+    use_own_parental: boolean;
 }
 
 export type AutoClient = {
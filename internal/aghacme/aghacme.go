@@ -0,0 +1,601 @@
+// Package aghacme obtains and renews the TLS certificates from the certificate
+// authorities supporting the ACME protocol, such as Let's Encrypt and ZeroSSL.
+//
+// See RFC 8555.
+package aghacme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/google/renameio/v2/maybe"
+	"golang.org/x/crypto/acme"
+)
+
+// Directory URLs of the well-known certificate authorities.
+const (
+	DirectoryLetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+	DirectoryZeroSSL     = "https://acme.zerossl.com/v2/DV90"
+)
+
+// ChallengeType is the type of the challenge used to prove the control over
+// the domain names.
+type ChallengeType string
+
+// Supported challenge types.
+const (
+	// ChallengeHTTP01 is the challenge served by the HTTP server on port 80.
+	// See [Manager.ServeHTTP].
+	ChallengeHTTP01 ChallengeType = "http-01"
+
+	// ChallengeDNS01 is the challenge published as a TXT record by a
+	// [DNSProvider].  It's required for the wildcard domain names.
+	ChallengeDNS01 ChallengeType = "dns-01"
+)
+
+// HTTP01Path is the path prefix of the HTTP-01 challenge responses.
+const HTTP01Path = "/.well-known/acme-challenge/"
+
+// Names of the files within [Config.Dir].
+const (
+	AccountKeyFileName = "account.pem"
+	CertFileName       = "cert.pem"
+	KeyFileName        = "key.pem"
+)
+
+// Default values of the configuration.
+const (
+	DefaultRenewBefore   = 30 * 24 * time.Hour
+	DefaultCheckInterval = 12 * time.Hour
+)
+
+// obtainTimeout is the timeout for obtaining a single certificate.
+const obtainTimeout = 10 * time.Minute
+
+// Config is the configuration of a [Manager].
+type Config struct {
+	// OnCertificate is called after a new certificate and its private key are
+	// written to the files.  It must not be nil.
+	OnCertificate func(certPath, keyPath string)
+
+	// HTTPClient is used to communicate with the certificate authority.  It
+	// must not be nil.
+	HTTPClient *http.Client
+
+	// DNSProvider publishes the DNS-01 challenge records.  It must not be nil
+	// if Challenge is [ChallengeDNS01].
+	DNSProvider DNSProvider
+
+	// DirectoryURL is the URL of the ACME directory of the certificate
+	// authority.  If it's empty, [DirectoryLetsEncrypt] is used.
+	DirectoryURL string
+
+	// Email is the contact address of the account, if any.
+	Email string
+
+	// EABKeyID is the key identifier of the external account binding, which is
+	// required by some certificate authorities, like ZeroSSL.
+	EABKeyID string
+
+	// EABHMACKey is the base64url-encoded MAC key of the external account
+	// binding.
+	EABHMACKey string
+
+	// Dir is the directory the account key, the certificate, and its private
+	// key are stored in.  It must not be empty.
+	Dir string
+
+	// Domains are the domain names the certificate is issued for.  It must not
+	// be empty.
+	Domains []string
+
+	// Challenge is the type of the challenge.
+	Challenge ChallengeType
+
+	// DNSPropagationDelay is the time to wait after the DNS-01 challenge
+	// records are published before the certificate authority checks them.
+	DNSPropagationDelay time.Duration
+
+	// RenewBefore is the time before the expiration of the certificate it's
+	// renewed at.  If it's zero, [DefaultRenewBefore] is used.
+	RenewBefore time.Duration
+
+	// CheckInterval is the interval between the checks of the certificate.  If
+	// it's zero, [DefaultCheckInterval] is used.
+	CheckInterval time.Duration
+}
+
+// Manager obtains the certificate and renews it before it expires.
+type Manager struct {
+	conf *Config
+
+	// mu protects tokens.
+	mu *sync.Mutex
+
+	// tokens are the key authorizations of the pending HTTP-01 challenges by
+	// their tokens.
+	tokens map[string]string
+
+	// renewMu prevents obtaining several certificates at once.
+	renewMu *sync.Mutex
+
+	// done is closed when the manager is closed.
+	done chan struct{}
+}
+
+// NewManager returns a new properly initialized *Manager.  conf must not be
+// nil.
+func NewManager(conf *Config) (m *Manager, err error) {
+	if conf.Dir == "" {
+		return nil, errors.Error("dir: empty value")
+	} else if len(conf.Domains) == 0 {
+		return nil, errors.Error("domains: empty value")
+	}
+
+	for i, d := range conf.Domains {
+		if strings.HasPrefix(d, "*.") && conf.Challenge != ChallengeDNS01 {
+			return nil, fmt.Errorf("domains: at index %d: wildcard requires %s", i, ChallengeDNS01)
+		}
+	}
+
+	switch conf.Challenge {
+	case ChallengeHTTP01:
+		// Go on.
+	case ChallengeDNS01:
+		if conf.DNSProvider == nil {
+			return nil, errors.Error("dns provider: no value")
+		}
+	default:
+		return nil, fmt.Errorf("challenge: unsupported value %q", conf.Challenge)
+	}
+
+	if conf.EABHMACKey != "" {
+		_, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(conf.EABHMACKey, "="))
+		if err != nil {
+			return nil, fmt.Errorf("eab hmac key: %w", err)
+		}
+	}
+
+	c := *conf
+	if c.DirectoryURL == "" {
+		c.DirectoryURL = DirectoryLetsEncrypt
+	}
+
+	if c.RenewBefore == 0 {
+		c.RenewBefore = DefaultRenewBefore
+	}
+
+	if c.CheckInterval == 0 {
+		c.CheckInterval = DefaultCheckInterval
+	}
+
+	return &Manager{
+		conf:    &c,
+		mu:      &sync.Mutex{},
+		tokens:  map[string]string{},
+		renewMu: &sync.Mutex{},
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// CertPath returns the path to the certificate file.
+func (m *Manager) CertPath() (p string) {
+	return filepath.Join(m.conf.Dir, CertFileName)
+}
+
+// KeyPath returns the path to the private key file.
+func (m *Manager) KeyPath() (p string) {
+	return filepath.Join(m.conf.Dir, KeyFileName)
+}
+
+// Start starts checking the certificate and renewing it in a separate
+// goroutine.
+func (m *Manager) Start() {
+	go m.loop()
+}
+
+// Close stops renewing the certificate.  It must only be called once.
+func (m *Manager) Close() {
+	close(m.done)
+}
+
+// loop checks the certificate right away and then each check interval until m
+// is closed.
+func (m *Manager) loop() {
+	defer log.OnPanic("aghacme: manager")
+
+	m.check(time.Now())
+
+	t := time.NewTicker(m.conf.CheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-t.C:
+			m.check(now)
+		}
+	}
+}
+
+// check obtains a new certificate if the current one needs renewal at now.
+func (m *Manager) check(now time.Time) {
+	ok, err := m.needsRenewal(now)
+	if err != nil {
+		log.Info("aghacme: checking certificate: %s", err)
+	} else if !ok {
+		log.Debug("aghacme: certificate doesn't need renewal")
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), obtainTimeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-m.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = m.Renew(ctx)
+	if err != nil {
+		log.Error("aghacme: renewing certificate: %s", err)
+	}
+}
+
+// needsRenewal returns true if the certificate doesn't exist, doesn't cover
+// all the domain names, or expires within the renewal period after now.  err
+// is returned if the certificate can't be read, in which case it also needs
+// renewal.
+func (m *Manager) needsRenewal(now time.Time) (ok bool, err error) {
+	data, err := os.ReadFile(m.CertPath())
+	if err != nil {
+		return true, fmt.Errorf("reading: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return true, errors.Error("no certificate found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true, fmt.Errorf("parsing: %w", err)
+	}
+
+	for _, d := range m.conf.Domains {
+		if !slices.Contains(cert.DNSNames, d) {
+			return true, nil
+		}
+	}
+
+	return cert.NotAfter.Sub(now) < m.conf.RenewBefore, nil
+}
+
+// Renew obtains a new certificate, writes it with its private key to the
+// files, and calls [Config.OnCertificate].
+func (m *Manager) Renew(ctx context.Context) (err error) {
+	m.renewMu.Lock()
+	defer m.renewMu.Unlock()
+
+	log.Info("aghacme: obtaining certificate for %q", m.conf.Domains)
+
+	certPEM, keyPEM, err := m.obtain(ctx)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	err = maybe.WriteFile(m.KeyPath(), keyPEM, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing key: %w", err)
+	}
+
+	err = maybe.WriteFile(m.CertPath(), certPEM, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing certificate: %w", err)
+	}
+
+	log.Info("aghacme: obtained certificate for %q", m.conf.Domains)
+
+	m.conf.OnCertificate(m.CertPath(), m.KeyPath())
+
+	return nil
+}
+
+// obtain orders the certificate, fulfills the challenges, and returns the
+// PEM-encoded certificate chain and its private key.
+func (m *Manager) obtain(ctx context.Context) (certPEM, keyPEM []byte, err error) {
+	cl, err := m.client(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	order, err := cl.AuthorizeOrder(ctx, acme.DomainIDs(m.conf.Domains...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ordering: %w", err)
+	}
+
+	for _, u := range order.AuthzURLs {
+		err = m.authorize(ctx, cl, u)
+		if err != nil {
+			return nil, nil, fmt.Errorf("authorizing: %w", err)
+		}
+	}
+
+	order, err = cl.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("waiting for order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.conf.Domains[0]},
+		DNSNames: m.conf.Domains,
+	}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating csr: %w", err)
+	}
+
+	der, _, err := cl.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finalizing order: %w", err)
+	}
+
+	for _, b := range der {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// client returns the ACME client with the registered account.
+func (m *Manager) client(ctx context.Context) (cl *acme.Client, err error) {
+	key, err := m.accountKey()
+	if err != nil {
+		return nil, fmt.Errorf("account key: %w", err)
+	}
+
+	cl = &acme.Client{
+		Key:          key,
+		HTTPClient:   m.conf.HTTPClient,
+		DirectoryURL: m.conf.DirectoryURL,
+	}
+
+	acct := &acme.Account{}
+	if m.conf.Email != "" {
+		acct.Contact = []string{"mailto:" + m.conf.Email}
+	}
+
+	if m.conf.EABKeyID != "" {
+		// The key has been validated in NewManager.
+		hmacKey, _ := base64.RawURLEncoding.DecodeString(strings.TrimRight(m.conf.EABHMACKey, "="))
+		acct.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: m.conf.EABKeyID,
+			Key: hmacKey,
+		}
+	}
+
+	_, err = cl.Register(ctx, acct, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("registering account: %w", err)
+	}
+
+	return cl, nil
+}
+
+// accountKey returns the account key from the file, generating and writing it
+// if there is none.
+func (m *Manager) accountKey() (key crypto.Signer, err error) {
+	p := filepath.Join(m.conf.Dir, AccountKeyFileName)
+	data, err := os.ReadFile(p)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no pem data in %q", p)
+		}
+
+		// Don't wrap the error since it's informative enough as is.
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating: %w", err)
+	}
+
+	data, err = encodeKey(ecKey)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	err = os.MkdirAll(m.conf.Dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("creating dir: %w", err)
+	}
+
+	err = maybe.WriteFile(p, data, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("writing: %w", err)
+	}
+
+	return ecKey, nil
+}
+
+// encodeKey returns the PEM-encoded key.
+func encodeKey(key *ecdsa.PrivateKey) (data []byte, err error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encoding key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// authorize fulfills the challenge of the authorization with URL u, unless
+// it's already valid.
+func (m *Manager) authorize(ctx context.Context, cl *acme.Client, u string) (err error) {
+	authz, err := cl.GetAuthorization(ctx, u)
+	if err != nil {
+		return fmt.Errorf("getting authorization: %w", err)
+	} else if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	domain := authz.Identifier.Value
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == string(m.conf.Challenge) {
+			chal = c
+
+			break
+		}
+	}
+
+	if chal == nil {
+		return fmt.Errorf("no %s challenge for %q", m.conf.Challenge, domain)
+	}
+
+	cleanup, err := m.prepare(ctx, cl, domain, chal)
+	if err != nil {
+		return fmt.Errorf("preparing %s challenge for %q: %w", chal.Type, domain, err)
+	}
+	defer cleanup()
+
+	_, err = cl.Accept(ctx, chal)
+	if err != nil {
+		return fmt.Errorf("accepting challenge for %q: %w", domain, err)
+	}
+
+	_, err = cl.WaitAuthorization(ctx, authz.URI)
+
+	return errors.Annotate(err, "waiting for authorization of %q: %w", domain)
+}
+
+// prepare makes the response to chal for domain available to the certificate
+// authority.  cleanup removes it.
+func (m *Manager) prepare(
+	ctx context.Context,
+	cl *acme.Client,
+	domain string,
+	chal *acme.Challenge,
+) (cleanup func(), err error) {
+	if m.conf.Challenge == ChallengeHTTP01 {
+		var resp string
+		resp, err = cl.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.tokens[chal.Token] = resp
+
+		return func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			delete(m.tokens, chal.Token)
+		}, nil
+	}
+
+	val, err := cl.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	fqdn := "_acme-challenge." + domain + "."
+	err = m.conf.DNSProvider.Present(ctx, fqdn, val)
+	if err != nil {
+		return nil, fmt.Errorf("presenting record: %w", err)
+	}
+
+	cleanup = func() {
+		cleanupErr := m.conf.DNSProvider.CleanUp(context.Background(), fqdn, val)
+		if cleanupErr != nil {
+			log.Error("aghacme: cleaning up record %q: %s", fqdn, cleanupErr)
+		}
+	}
+
+	if d := m.conf.DNSPropagationDelay; d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+			cleanup()
+
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	return cleanup, nil
+}
+
+// type check
+var _ http.Handler = (*Manager)(nil)
+
+// ServeHTTP implements the [http.Handler] interface for *Manager.  It serves
+// the responses to the pending HTTP-01 challenges under [HTTP01Path].
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, HTTP01Path)
+
+	m.mu.Lock()
+	resp, ok := m.tokens[token]
+	m.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	w.Header().Set(httphdr.ContentType, "text/plain")
+
+	_, err := io.WriteString(w, resp)
+	if err != nil {
+		log.Debug("aghacme: writing challenge response: %s", err)
+	}
+}
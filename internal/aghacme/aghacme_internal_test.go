@@ -0,0 +1,124 @@
+package aghacme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for domains expiring at notAfter
+// to the certificate file within dir.
+func writeCert(t *testing.T, dir string, notAfter time.Time, domains ...string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	err = os.WriteFile(filepath.Join(dir, CertFileName), data, 0o644)
+	require.NoError(t, err)
+}
+
+func TestManager_needsRenewal(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		notAfter  time.Time
+		name      string
+		domains   []string
+		wantRenew bool
+	}{{
+		notAfter:  now.Add(60 * 24 * time.Hour),
+		name:      "valid",
+		domains:   []string{"example.org"},
+		wantRenew: false,
+	}, {
+		notAfter:  now.Add(10 * 24 * time.Hour),
+		name:      "expiring",
+		domains:   []string{"example.org"},
+		wantRenew: true,
+	}, {
+		notAfter:  now.Add(60 * 24 * time.Hour),
+		name:      "new_domain",
+		domains:   []string{"other.example"},
+		wantRenew: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeCert(t, dir, tc.notAfter, tc.domains...)
+
+			m, err := NewManager(&Config{
+				Dir:       dir,
+				Domains:   []string{"example.org"},
+				Challenge: ChallengeHTTP01,
+			})
+			require.NoError(t, err)
+
+			ok, err := m.needsRenewal(now)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantRenew, ok)
+		})
+	}
+
+	t.Run("no_cert", func(t *testing.T) {
+		m, err := NewManager(&Config{
+			Dir:       t.TempDir(),
+			Domains:   []string{"example.org"},
+			Challenge: ChallengeHTTP01,
+		})
+		require.NoError(t, err)
+
+		ok, err := m.needsRenewal(now)
+		assert.Error(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestManager_ServeHTTP(t *testing.T) {
+	m, err := NewManager(&Config{
+		Dir:       t.TempDir(),
+		Domains:   []string{"example.org"},
+		Challenge: ChallengeHTTP01,
+	})
+	require.NoError(t, err)
+
+	m.tokens["token"] = "token.thumbprint"
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, HTTP01Path+"token", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "token.thumbprint", w.Body.String())
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, HTTP01Path+"other", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
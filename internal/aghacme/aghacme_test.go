@@ -0,0 +1,131 @@
+package aghacme_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManager(t *testing.T) {
+	provider, err := aghacme.NewDNSProvider(
+		aghacme.DNSProviderExec,
+		map[string]string{"path": "/bin/true"},
+		nil,
+	)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		conf       *aghacme.Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &aghacme.Config{
+			Dir:       "acme",
+			Domains:   []string{"example.org"},
+			Challenge: aghacme.ChallengeHTTP01,
+		},
+		name:       "http",
+		wantErrMsg: "",
+	}, {
+		conf: &aghacme.Config{
+			DNSProvider: provider,
+			Dir:         "acme",
+			Domains:     []string{"example.org", "*.example.org"},
+			Challenge:   aghacme.ChallengeDNS01,
+		},
+		name:       "dns_wildcard",
+		wantErrMsg: "",
+	}, {
+		conf: &aghacme.Config{
+			Dir:       "acme",
+			Domains:   []string{"*.example.org"},
+			Challenge: aghacme.ChallengeHTTP01,
+		},
+		name:       "http_wildcard",
+		wantErrMsg: "domains: at index 0: wildcard requires dns-01",
+	}, {
+		conf: &aghacme.Config{
+			Dir:       "acme",
+			Domains:   []string{"example.org"},
+			Challenge: aghacme.ChallengeDNS01,
+		},
+		name:       "no_provider",
+		wantErrMsg: "dns provider: no value",
+	}, {
+		conf: &aghacme.Config{
+			Dir:       "acme",
+			Challenge: aghacme.ChallengeHTTP01,
+		},
+		name:       "no_domains",
+		wantErrMsg: "domains: empty value",
+	}, {
+		conf: &aghacme.Config{
+			Dir:       "acme",
+			Domains:   []string{"example.org"},
+			Challenge: "tls-alpn-01",
+		},
+		name:       "bad_challenge",
+		wantErrMsg: `challenge: unsupported value "tls-alpn-01"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err = aghacme.NewManager(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestHTTPReqProvider(t *testing.T) {
+	type record struct {
+		FQDN  string `json:"fqdn"`
+		Value string `json:"value"`
+	}
+
+	var gotPaths []string
+	var gotRecs []record
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		rec := record{}
+		err := json.NewDecoder(r.Body).Decode(&rec)
+		require.NoError(t, err)
+
+		gotPaths, gotRecs = append(gotPaths, r.URL.Path), append(gotRecs, rec)
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := aghacme.NewDNSProvider(aghacme.DNSProviderHTTPReq, map[string]string{
+		"endpoint": srv.URL + "/acme",
+		"username": "user",
+		"password": "pass",
+	}, srv.Client())
+	require.NoError(t, err)
+
+	const fqdn = "_acme-challenge.example.org."
+
+	ctx := context.Background()
+	require.NoError(t, p.Present(ctx, fqdn, "value"))
+	require.NoError(t, p.CleanUp(ctx, fqdn, "value"))
+
+	assert.Equal(t, []string{"/acme/present", "/acme/cleanup"}, gotPaths)
+	assert.Equal(t, []record{{
+		FQDN:  fqdn,
+		Value: "value",
+	}, {
+		FQDN:  fqdn,
+		Value: "value",
+	}}, gotRecs)
+}
@@ -0,0 +1,167 @@
+package aghacme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+)
+
+// DNSProvider publishes the TXT records of the DNS-01 challenges.
+type DNSProvider interface {
+	// Present publishes the TXT record with value for fqdn.
+	Present(ctx context.Context, fqdn, value string) (err error)
+
+	// CleanUp removes the TXT record with value for fqdn.
+	CleanUp(ctx context.Context, fqdn, value string) (err error)
+}
+
+// Names of the built-in DNS providers.
+const (
+	DNSProviderExec    = "exec"
+	DNSProviderHTTPReq = "httpreq"
+)
+
+// NewDNSProvider returns the built-in DNS provider with name configured with
+// params.  cli is used by the providers sending HTTP requests.
+func NewDNSProvider(
+	name string,
+	params map[string]string,
+	cli *http.Client,
+) (p DNSProvider, err error) {
+	switch name {
+	case DNSProviderExec:
+		if params["path"] == "" {
+			return nil, errors.Error("path: empty value")
+		}
+
+		return &ExecProvider{
+			Path: params["path"],
+		}, nil
+	case DNSProviderHTTPReq:
+		var u *url.URL
+		u, err = url.Parse(params["endpoint"])
+		if err != nil {
+			return nil, fmt.Errorf("endpoint: %w", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("endpoint: bad scheme %q", u.Scheme)
+		}
+
+		return &HTTPReqProvider{
+			Client:   cli,
+			Endpoint: u,
+			Username: params["username"],
+			Password: params["password"],
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dns provider %q", name)
+	}
+}
+
+// ExecProvider is a [DNSProvider] running an external program with the
+// arguments "present" or "cleanup", the FQDN, and the value of the record.
+type ExecProvider struct {
+	// Path is the path to the program.
+	Path string
+}
+
+// type check
+var _ DNSProvider = (*ExecProvider)(nil)
+
+// Present implements the [DNSProvider] interface for *ExecProvider.
+func (p *ExecProvider) Present(_ context.Context, fqdn, value string) (err error) {
+	return p.run("present", fqdn, value)
+}
+
+// CleanUp implements the [DNSProvider] interface for *ExecProvider.
+func (p *ExecProvider) CleanUp(_ context.Context, fqdn, value string) (err error) {
+	return p.run("cleanup", fqdn, value)
+}
+
+// run runs the program with the arguments.
+func (p *ExecProvider) run(args ...string) (err error) {
+	code, out, err := aghos.RunCommand(p.Path, args...)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	} else if code != 0 {
+		return fmt.Errorf("%q exited with code %d: %s", p.Path, code, out)
+	}
+
+	return nil
+}
+
+// HTTPReqProvider is a [DNSProvider] sending the JSON objects with the fqdn and
+// value properties to the /present and /cleanup paths of an HTTP endpoint.
+type HTTPReqProvider struct {
+	// Client is used to send the requests.
+	Client *http.Client
+
+	// Endpoint is the base URL of the endpoint.
+	Endpoint *url.URL
+
+	// Username is the username of the basic authentication, if any.
+	Username string
+
+	// Password is the password of the basic authentication.
+	Password string
+}
+
+// type check
+var _ DNSProvider = (*HTTPReqProvider)(nil)
+
+// Present implements the [DNSProvider] interface for *HTTPReqProvider.
+func (p *HTTPReqProvider) Present(ctx context.Context, fqdn, value string) (err error) {
+	return p.send(ctx, "present", fqdn, value)
+}
+
+// CleanUp implements the [DNSProvider] interface for *HTTPReqProvider.
+func (p *HTTPReqProvider) CleanUp(ctx context.Context, fqdn, value string) (err error) {
+	return p.send(ctx, "cleanup", fqdn, value)
+}
+
+// httpReqBody is the body of the requests of [HTTPReqProvider].
+type httpReqBody struct {
+	FQDN  string `json:"fqdn"`
+	Value string `json:"value"`
+}
+
+// send sends the record to the path of the endpoint.
+func (p *HTTPReqProvider) send(ctx context.Context, path, fqdn, value string) (err error) {
+	body, err := json.Marshal(&httpReqBody{
+		FQDN:  fqdn,
+		Value: value,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding body: %w", err)
+	}
+
+	u := p.Endpoint.JoinPath(path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set(httphdr.ContentType, "application/json")
+	if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
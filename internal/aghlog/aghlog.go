@@ -0,0 +1,353 @@
+// Package aghlog contains the structured output of the AdGuard Home logs and
+// the per-module log levels.
+//
+// The log entries are still written with package
+// github.com/AdguardTeam/golibs/log.  The module of an entry is the prefix of
+// its message before the first colon, e.g. "dnsforward" for
+// "dnsforward: started processing upstream".
+package aghlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Format is the format of the log entries.
+type Format string
+
+// Valid formats.
+const (
+	// FormatText is the default plain-text format of package log.
+	FormatText Format = "text"
+
+	// FormatJSON writes each entry as a JSON object.
+	FormatJSON Format = "json"
+
+	// FormatLogfmt writes each entry as a line of key=value pairs.
+	FormatLogfmt Format = "logfmt"
+)
+
+// Validate returns an error if f isn't a valid format.  An empty format is
+// valid and means [FormatText].
+func (f Format) Validate() (err error) {
+	switch f {
+	case "", FormatText, FormatJSON, FormatLogfmt:
+		return nil
+	default:
+		return fmt.Errorf("format: bad value %q", f)
+	}
+}
+
+// Level is the name of a log level.
+type Level string
+
+// Valid levels.
+const (
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelError Level = "error"
+)
+
+// toLog returns the level of package log corresponding to l.
+func (l Level) toLog() (lvl log.Level, err error) {
+	switch l {
+	case LevelDebug:
+		return log.DEBUG, nil
+	case LevelInfo:
+		return log.INFO, nil
+	case LevelError:
+		return log.ERROR, nil
+	default:
+		return 0, fmt.Errorf("level: bad value %q", l)
+	}
+}
+
+// Common field keys.
+const (
+	KeyClient   = "client"
+	KeyModule   = "module"
+	KeyQName    = "qname"
+	KeyUpstream = "upstream"
+)
+
+// Field is a key-value pair attached to a log entry.
+type Field struct {
+	// Value is the value of the field.  It's formatted with the %v verb.
+	Value any
+
+	// Key is the key of the field, such as [KeyClient].
+	Key string
+}
+
+// Config is the configuration of a [Handler].
+type Config struct {
+	// Output is the writer of the log entries.  It must not be nil.
+	Output io.Writer
+
+	// Levels are the levels of the modules overriding the default one.
+	Levels map[string]Level
+
+	// Format is the format of the log entries.
+	Format Format
+
+	// Verbose defines if the default level is debug instead of info.
+	Verbose bool
+}
+
+// Handler is an [io.Writer] for package log, which filters the entries by the
+// levels of their modules and writes them in the configured format.
+type Handler struct {
+	// out is the writer of the entries in [FormatText].
+	out io.Writer
+
+	// structured writes the entries in [FormatJSON] and [FormatLogfmt].  It's
+	// nil in [FormatText].
+	structured slog.Handler
+
+	// levels are the levels of the modules.
+	levels map[string]log.Level
+
+	// level is the default level.
+	level log.Level
+}
+
+// NewHandler returns a new properly initialized *Handler.
+func NewHandler(c *Config) (h *Handler, err error) {
+	err = c.Format.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	h = &Handler{
+		out:    c.Output,
+		levels: make(map[string]log.Level, len(c.Levels)),
+		level:  log.INFO,
+	}
+
+	if c.Verbose {
+		h.level = log.DEBUG
+	}
+
+	for module, l := range c.Levels {
+		h.levels[module], err = l.toLog()
+		if err != nil {
+			return nil, fmt.Errorf("module %q: %w", module, err)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	switch c.Format {
+	case FormatJSON:
+		h.structured = slog.NewJSONHandler(c.Output, opts)
+	case FormatLogfmt:
+		h.structured = slog.NewTextHandler(c.Output, opts)
+	default:
+		// Keep the plain text.
+	}
+
+	return h, nil
+}
+
+// maxLevel returns the most verbose level of h.
+func (h *Handler) maxLevel() (lvl log.Level) {
+	lvl = h.level
+	for _, l := range h.levels {
+		lvl = max(lvl, l)
+	}
+
+	return lvl
+}
+
+// enabled returns true if the entries of module with lvl should be written.
+func (h *Handler) enabled(module string, lvl log.Level) (ok bool) {
+	modLvl, ok := h.levels[module]
+	if !ok {
+		modLvl = h.level
+	}
+
+	return lvl <= modLvl
+}
+
+// timeLayout is the layout of the timestamps in [FormatText].  It matches the
+// one of package log with microseconds.
+const timeLayout = "2006/01/02 15:04:05.000000"
+
+// type check
+var _ io.Writer = (*Handler)(nil)
+
+// Write implements the [io.Writer] interface for *Handler.  p is expected to be
+// a single line written by package log without any flags.
+func (h *Handler) Write(p []byte) (n int, err error) {
+	n = len(p)
+
+	line := strings.TrimSuffix(string(p), "\n")
+	lvl, module, msg := parseLine(line)
+	if !h.enabled(module, lvl) {
+		return n, nil
+	}
+
+	if h.structured == nil {
+		b := &bytes.Buffer{}
+		b.WriteString(time.Now().Format(timeLayout))
+		b.WriteByte(' ')
+		b.WriteString(line)
+		b.WriteByte('\n')
+
+		_, err = h.out.Write(b.Bytes())
+
+		return n, err
+	}
+
+	return n, h.handle(lvl, module, msg, nil)
+}
+
+// handle writes the structured entry.
+func (h *Handler) handle(lvl log.Level, module, msg string, fields []Field) (err error) {
+	r := slog.NewRecord(time.Now(), slogLevel(lvl), msg, 0)
+	if module != "" {
+		r.AddAttrs(slog.String(KeyModule, module))
+	}
+
+	for _, f := range fields {
+		r.AddAttrs(slog.String(f.Key, fmt.Sprint(f.Value)))
+	}
+
+	return h.structured.Handle(context.Background(), r)
+}
+
+// slogLevel returns the slog level corresponding to lvl.
+func slogLevel(lvl log.Level) (sl slog.Level) {
+	switch lvl {
+	case log.DEBUG:
+		return slog.LevelDebug
+	case log.INFO:
+		return slog.LevelInfo
+	default:
+		return slog.LevelError
+	}
+}
+
+// parseLine returns the level, the module, and the message of the line written
+// by package log.
+func parseLine(line string) (lvl log.Level, module, msg string) {
+	// Remove the process and goroutine IDs written in the debug mode.
+	if first, rest, ok := strings.Cut(line, " "); ok && isIDs(first) {
+		line = rest
+	}
+
+	lvl = log.INFO
+	if lvlStr, rest, ok := strings.Cut(line, "] "); ok && strings.HasPrefix(lvlStr, "[") {
+		switch lvlStr[1:] {
+		case "debug":
+			lvl = log.DEBUG
+		case "info":
+			// Go on.
+		default:
+			lvl = log.ERROR
+		}
+
+		line = rest
+	}
+
+	module, msg, ok := strings.Cut(line, ": ")
+	if !ok || !isModule(module) {
+		return lvl, "", line
+	}
+
+	return lvl, module, msg
+}
+
+// isIDs returns true if s looks like the "pid#goroutine" prefix of package log.
+func isIDs(s string) (ok bool) {
+	pid, gid, ok := strings.Cut(s, "#")
+
+	return ok && isDigits(pid) && isDigits(gid)
+}
+
+// isDigits returns true if s is a non-empty string of ASCII digits.
+func isDigits(s string) (ok bool) {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// isModule returns true if s looks like a module name, which consists of
+// lowercase ASCII letters, digits, and underscores.
+func isModule(s string) (ok bool) {
+	return s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyz0123456789_") == ""
+}
+
+// handler is the installed handler, if any.
+var handler atomic.Pointer[Handler]
+
+// Install makes h the output of package log and sets its level to the most
+// verbose one of h, so that the entries of every module could be filtered.
+func Install(h *Handler) {
+	log.SetFlags(0)
+	log.SetOutput(h)
+	log.SetLevel(h.maxLevel())
+
+	handler.Store(h)
+}
+
+// Debug writes a debug entry of module with fields.
+func Debug(module, msg string, fields ...Field) {
+	write(log.DEBUG, module, msg, fields)
+}
+
+// Info writes an informational entry of module with fields.
+func Info(module, msg string, fields ...Field) {
+	write(log.INFO, module, msg, fields)
+}
+
+// Error writes an error entry of module with fields.
+func Error(module, msg string, fields ...Field) {
+	write(log.ERROR, module, msg, fields)
+}
+
+// write writes the entry either with the installed handler, if it's in one of
+// the structured formats, or with package log, appending the fields in the
+// key=value form to the message.
+func write(lvl log.Level, module, msg string, fields []Field) {
+	if log.GetLevel() < lvl {
+		return
+	}
+
+	h := handler.Load()
+	if h != nil && h.structured != nil {
+		if h.enabled(module, lvl) {
+			err := h.handle(lvl, module, msg, fields)
+			if err != nil {
+				// Don't use package log to avoid recursion.
+				_, _ = fmt.Fprintf(h.out, "aghlog: writing entry: %s\n", err)
+			}
+		}
+
+		return
+	}
+
+	b := &strings.Builder{}
+	b.WriteString(msg)
+	for _, f := range fields {
+		_, _ = fmt.Fprintf(b, " %s=%q", f.Key, fmt.Sprint(f.Value))
+	}
+
+	logFunc := log.Info
+	switch lvl {
+	case log.DEBUG:
+		logFunc = log.Debug
+	case log.ERROR:
+		logFunc = log.Error
+	default:
+		// Go on.
+	}
+
+	logFunc("%s: %s", module, b)
+}
@@ -0,0 +1,125 @@
+package aghlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHandler is a helper that returns a new handler writing to a buffer.
+func newHandler(t *testing.T, f aghlog.Format) (h *aghlog.Handler, buf *bytes.Buffer) {
+	t.Helper()
+
+	buf = &bytes.Buffer{}
+	h, err := aghlog.NewHandler(&aghlog.Config{
+		Output: buf,
+		Levels: map[string]aghlog.Level{
+			"dnsforward": aghlog.LevelDebug,
+			"querylog":   aghlog.LevelError,
+		},
+		Format:  f,
+		Verbose: false,
+	})
+	require.NoError(t, err)
+
+	return h, buf
+}
+
+func TestHandler_Write(t *testing.T) {
+	lines := []string{
+		"123#45 [debug] dnsforward: started processing upstream\n",
+		"123#45 [debug] filtering: initialized filtering engine\n",
+		"[info] querylog: flushing\n",
+		"[error] querylog: writing file: disk is full\n",
+		"[info] AdGuard Home is available at the following addresses:\n",
+	}
+
+	t.Run("json", func(t *testing.T) {
+		h, buf := newHandler(t, aghlog.FormatJSON)
+		for _, l := range lines {
+			_, err := h.Write([]byte(l))
+			require.NoError(t, err)
+		}
+
+		var entries []map[string]any
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			e := map[string]any{}
+			require.NoError(t, dec.Decode(&e))
+
+			entries = append(entries, e)
+		}
+
+		require.Len(t, entries, 3)
+
+		assert.Equal(t, "DEBUG", entries[0]["level"])
+		assert.Equal(t, "dnsforward", entries[0]["module"])
+		assert.Equal(t, "started processing upstream", entries[0]["msg"])
+
+		assert.Equal(t, "ERROR", entries[1]["level"])
+		assert.Equal(t, "querylog", entries[1]["module"])
+		assert.Equal(t, "writing file: disk is full", entries[1]["msg"])
+
+		assert.NotContains(t, entries[2], "module")
+		assert.Equal(t, "AdGuard Home is available at the following addresses:", entries[2]["msg"])
+	})
+
+	t.Run("text", func(t *testing.T) {
+		h, buf := newHandler(t, aghlog.FormatText)
+		for _, l := range lines {
+			_, err := h.Write([]byte(l))
+			require.NoError(t, err)
+		}
+
+		out := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		require.Len(t, out, 3)
+
+		assert.True(t, strings.HasSuffix(out[0], " 123#45 [debug] dnsforward: started processing upstream"))
+		assert.True(t, strings.HasSuffix(out[1], " [error] querylog: writing file: disk is full"))
+	})
+}
+
+func TestDebug(t *testing.T) {
+	prevLevel := log.GetLevel()
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetLevel(prevLevel)
+		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	})
+
+	h, buf := newHandler(t, aghlog.FormatLogfmt)
+	aghlog.Install(h)
+
+	aghlog.Debug(
+		"dnsforward",
+		"resolved",
+		aghlog.Field{Key: aghlog.KeyClient, Value: "192.0.2.1"},
+		aghlog.Field{Key: aghlog.KeyQName, Value: "example.org."},
+	)
+	aghlog.Debug("filtering", "not written")
+
+	out := buf.String()
+	assert.Contains(t, out, "level=DEBUG msg=resolved module=dnsforward client=192.0.2.1 qname=example.org.")
+	assert.NotContains(t, out, "not written")
+}
+
+func TestNewHandler_bad(t *testing.T) {
+	_, err := aghlog.NewHandler(&aghlog.Config{
+		Output: &bytes.Buffer{},
+		Format: "xml",
+	})
+	assert.Error(t, err)
+
+	_, err = aghlog.NewHandler(&aghlog.Config{
+		Output: &bytes.Buffer{},
+		Levels: map[string]aghlog.Level{"dnsforward": "trace"},
+	})
+	assert.Error(t, err)
+}
@@ -2,6 +2,8 @@ package aghnet
 
 import (
 	"strings"
+
+	"golang.org/x/net/publicsuffix"
 )
 
 // NormalizeDomain returns a lowercased version of host without the final dot,
@@ -16,3 +18,16 @@ func NormalizeDomain(host string) (norm string) {
 
 	return strings.ToLower(strings.TrimSuffix(host, "."))
 }
+
+// RegistrableDomain returns the registrable part of host, also known as eTLD+1,
+// according to the Public Suffix List.  For example, it returns "example.co.uk"
+// for "www.example.co.uk".  host is returned unchanged if it has no registrable
+// part, e.g. if it's a public suffix itself.
+func RegistrableDomain(host string) (domain string) {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+
+	return domain
+}
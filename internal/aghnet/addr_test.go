@@ -0,0 +1,46 @@
+package aghnet_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	testCases := []struct {
+		name string
+		host string
+		want string
+	}{{
+		name: "simple",
+		host: "www.example.com",
+		want: "example.com",
+	}, {
+		name: "multi_label_suffix",
+		host: "www.example.co.uk",
+		want: "example.co.uk",
+	}, {
+		name: "registrable",
+		host: "example.co.uk",
+		want: "example.co.uk",
+	}, {
+		name: "public_suffix",
+		host: "co.uk",
+		want: "co.uk",
+	}, {
+		name: "private_suffix",
+		host: "user.github.io",
+		want: "user.github.io",
+	}, {
+		name: "empty",
+		host: "",
+		want: "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, aghnet.RegistrableDomain(tc.host))
+		})
+	}
+}
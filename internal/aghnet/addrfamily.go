@@ -0,0 +1,136 @@
+package aghnet
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// AddrFamilyPref is the address family preferred for the outgoing connections.
+type AddrFamilyPref string
+
+// Valid address family preferences.
+const (
+	// AddrFamilyPrefAuto prefers IPv6 if the host has no IPv4 addresses to
+	// connect from, and keeps the order of the resolved addresses otherwise.
+	AddrFamilyPrefAuto AddrFamilyPref = ""
+
+	// AddrFamilyPrefIPv4 prefers IPv4.
+	AddrFamilyPrefIPv4 AddrFamilyPref = "ipv4"
+
+	// AddrFamilyPrefIPv6 prefers IPv6.
+	AddrFamilyPrefIPv6 AddrFamilyPref = "ipv6"
+)
+
+// Validate returns an error if p isn't a valid address family preference.
+func (p AddrFamilyPref) Validate() (err error) {
+	switch p {
+	case AddrFamilyPrefAuto, AddrFamilyPrefIPv4, AddrFamilyPrefIPv6:
+		return nil
+	default:
+		return fmt.Errorf("address family: bad value %q", p)
+	}
+}
+
+// PreferIPv6 returns true if the IPv6 addresses should be tried first.
+func (p AddrFamilyPref) PreferIPv6() (ok bool) {
+	switch p {
+	case AddrFamilyPrefIPv4:
+		return false
+	case AddrFamilyPrefIPv6:
+		return true
+	default:
+		return !HasIPv4()
+	}
+}
+
+// SortAddrs stably sorts addrs so that the addresses of the preferred family go
+// first.
+func SortAddrs(addrs []netip.Addr, preferIPv6 bool) {
+	slices.SortStableFunc(addrs, func(a, b netip.Addr) (res int) {
+		aPref, bPref := a.Unmap().Is6() == preferIPv6, b.Unmap().Is6() == preferIPv6
+		switch {
+		case aPref == bPref:
+			return 0
+		case aPref:
+			return -1
+		default:
+			return 1
+		}
+	})
+}
+
+// hasIPv4CacheTTL is the time the result of [HasIPv4] is cached for, so that
+// the network interfaces aren't listed on every outgoing connection.
+const hasIPv4CacheTTL = 1 * time.Minute
+
+// hasIPv4Cache is the cached result of [HasIPv4].
+var hasIPv4Cache struct {
+	// checked is the time of the last check.
+	checked time.Time
+
+	// mu protects checked and ok.
+	mu sync.Mutex
+
+	// ok is the result of the last check.
+	ok bool
+}
+
+// HasIPv4 returns true if any of the network interfaces of the host has an IPv4
+// address other than a loopback or a link-local one, so that the IPv4
+// addresses could be connected to.  The result is cached for
+// [hasIPv4CacheTTL], so it's cheap to call on every connection.
+func HasIPv4() (ok bool) {
+	c := &hasIPv4Cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := time.Now(); now.Sub(c.checked) >= hasIPv4CacheTTL {
+		c.ok, c.checked = hasIPv4(), now
+	}
+
+	return c.ok
+}
+
+// hasIPv4 is the uncached version of [HasIPv4].
+func hasIPv4() (ok bool) {
+	addrs, err := CollectAllIfacesAddrs()
+	if err != nil {
+		log.Debug("aghnet: checking ipv4 addresses: %s", err)
+
+		// Assume the host is dual-stack and keep the default behavior.
+		return true
+	}
+
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if addr.Is4() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseAddr is like [netip.ParseAddr], but also accepts the IPv6 addresses
+// enclosed in square brackets, such as "[::1]".
+func ParseAddr(s string) (ip netip.Addr, err error) {
+	l := len(s)
+	if l < 2 || s[0] != '[' || s[l-1] != ']' {
+		return netip.ParseAddr(s)
+	}
+
+	ip, err = netip.ParseAddr(s[1 : l-1])
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return netip.Addr{}, err
+	} else if !ip.Is6() {
+		return netip.Addr{}, fmt.Errorf("ParseAddr(%q): brackets around non-ipv6 address", s)
+	}
+
+	return ip, nil
+}
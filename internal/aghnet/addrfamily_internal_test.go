@@ -0,0 +1,145 @@
+package aghnet
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrFamilyPref_Validate(t *testing.T) {
+	assert.NoError(t, AddrFamilyPrefAuto.Validate())
+	assert.NoError(t, AddrFamilyPrefIPv4.Validate())
+	assert.NoError(t, AddrFamilyPrefIPv6.Validate())
+
+	testutil.AssertErrorMsg(t, `address family: bad value "ipv5"`, AddrFamilyPref("ipv5").Validate())
+}
+
+func TestHasIPv4(t *testing.T) {
+	ipNet := func(ip net.IP, bits int) (n *net.IPNet) {
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, len(ip)*8)}
+	}
+
+	testCases := []struct {
+		name  string
+		addrs []net.Addr
+		want  bool
+	}{{
+		name: "dual_stack",
+		addrs: []net.Addr{
+			ipNet(net.IP{127, 0, 0, 1}, 8),
+			ipNet(net.IP{192, 168, 0, 2}, 24),
+			ipNet(net.ParseIP("2001:db8::2"), netutil.IPv6BitLen),
+		},
+		want: true,
+	}, {
+		name: "ipv6_only",
+		addrs: []net.Addr{
+			ipNet(net.IP{127, 0, 0, 1}, 8),
+			ipNet(net.IP{169, 254, 0, 2}, 16),
+			ipNet(net.ParseIP("::1"), netutil.IPv6BitLen),
+			ipNet(net.ParseIP("2001:db8::2"), netutil.IPv6BitLen),
+		},
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			substNetInterfaceAddrs(t, func() ([]net.Addr, error) { return tc.addrs, nil })
+
+			// Drop the result cached by the previous cases.
+			hasIPv4Cache.checked = time.Time{}
+			t.Cleanup(func() { hasIPv4Cache.checked = time.Time{} })
+
+			assert.Equal(t, tc.want, HasIPv4())
+			assert.Equal(t, !tc.want, AddrFamilyPrefAuto.PreferIPv6())
+			assert.False(t, AddrFamilyPrefIPv4.PreferIPv6())
+			assert.True(t, AddrFamilyPrefIPv6.PreferIPv6())
+		})
+	}
+}
+
+func TestHasIPv4_cache(t *testing.T) {
+	hasIPv4Cache.checked = time.Time{}
+	t.Cleanup(func() { hasIPv4Cache.checked = time.Time{} })
+
+	calls := 0
+	substNetInterfaceAddrs(t, func() (addrs []net.Addr, err error) {
+		calls++
+
+		return []net.Addr{&net.IPNet{
+			IP:   net.IP{192, 168, 0, 2},
+			Mask: net.CIDRMask(24, netutil.IPv4BitLen),
+		}}, nil
+	})
+
+	assert.True(t, HasIPv4())
+
+	wantCalls := calls
+	assert.True(t, HasIPv4())
+	assert.Equal(t, wantCalls, calls)
+}
+
+func TestSortAddrs(t *testing.T) {
+	var (
+		v4First  = netip.MustParseAddr("192.0.2.1")
+		v6First  = netip.MustParseAddr("2001:db8::1")
+		v4Second = netip.MustParseAddr("192.0.2.2")
+		v6Second = netip.MustParseAddr("2001:db8::2")
+	)
+
+	addrs := []netip.Addr{v4First, v6First, v4Second, v6Second}
+
+	SortAddrs(addrs, true)
+	assert.Equal(t, []netip.Addr{v6First, v6Second, v4First, v4Second}, addrs)
+
+	SortAddrs(addrs, false)
+	assert.Equal(t, []netip.Addr{v4First, v4Second, v6First, v6Second}, addrs)
+}
+
+func TestParseAddr(t *testing.T) {
+	testCases := []struct {
+		want       netip.Addr
+		name       string
+		in         string
+		wantErrMsg string
+	}{{
+		want:       netip.MustParseAddr("2001:db8::1"),
+		name:       "ipv6",
+		in:         "2001:db8::1",
+		wantErrMsg: "",
+	}, {
+		want:       netip.MustParseAddr("2001:db8::1"),
+		name:       "ipv6_brackets",
+		in:         "[2001:db8::1]",
+		wantErrMsg: "",
+	}, {
+		want:       netip.MustParseAddr("192.0.2.1"),
+		name:       "ipv4",
+		in:         "192.0.2.1",
+		wantErrMsg: "",
+	}, {
+		want:       netip.Addr{},
+		name:       "ipv4_brackets",
+		in:         "[192.0.2.1]",
+		wantErrMsg: `ParseAddr("[192.0.2.1]"): brackets around non-ipv6 address`,
+	}, {
+		want:       netip.Addr{},
+		name:       "empty_brackets",
+		in:         "[]",
+		wantErrMsg: `ParseAddr(""): unable to parse IP`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ip, err := ParseAddr(tc.in)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, ip)
+		})
+	}
+}
@@ -198,6 +198,12 @@ func (hc *HostsContainer) sendUpd(recs *hostsfile.DefaultStorage) {
 	}
 }
 
+// Refresh rereads the hosts files and propagates the updates if needed.  It's
+// safe for concurrent use.
+func (hc *HostsContainer) Refresh() (err error) {
+	return hc.refresh()
+}
+
 // refresh gets the data from specified files and propagates the updates if
 // needed.
 //
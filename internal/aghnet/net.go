@@ -289,8 +289,8 @@ func CollectAllIfacesAddrs() (addrs []netip.Addr, err error) {
 }
 
 // ParseAddrPort parses an [netip.AddrPort] from s, which should be either a
-// valid IP, optionally with port, or a valid URL with plain IP address.  The
-// defaultPort is used if s doesn't contain port number.
+// valid IP, optionally with port or in square brackets, or a valid URL with
+// plain IP address.  The defaultPort is used if s doesn't contain port number.
 func ParseAddrPort(s string, defaultPort uint16) (ipp netip.AddrPort, err error) {
 	u, err := url.Parse(s)
 	if err == nil && u.Host != "" {
@@ -299,7 +299,7 @@ func ParseAddrPort(s string, defaultPort uint16) (ipp netip.AddrPort, err error)
 
 	ipp, err = netip.ParseAddrPort(s)
 	if err != nil {
-		ip, parseErr := netip.ParseAddr(s)
+		ip, parseErr := ParseAddr(s)
 		if parseErr != nil {
 			return ipp, errors.Join(err, parseErr)
 		}
@@ -311,7 +311,8 @@ func ParseAddrPort(s string, defaultPort uint16) (ipp netip.AddrPort, err error)
 }
 
 // ParseSubnet parses s either as a CIDR prefix itself, or as an IP address,
-// returning the corresponding single-IP CIDR prefix.
+// possibly in square brackets, returning the corresponding single-IP CIDR
+// prefix.
 //
 // TODO(e.burkov):  Taken from dnsproxy, move to golibs.
 func ParseSubnet(s string) (p netip.Prefix, err error) {
@@ -322,7 +323,7 @@ func ParseSubnet(s string) (p netip.Prefix, err error) {
 		}
 	} else {
 		var ip netip.Addr
-		ip, err = netip.ParseAddr(s)
+		ip, err = ParseAddr(s)
 		if err != nil {
 			return netip.Prefix{}, err
 		}
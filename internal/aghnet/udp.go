@@ -0,0 +1,19 @@
+package aghnet
+
+// UDPStats are the counters of the UDP datagrams dropped by the system.
+type UDPStats struct {
+	// InErrors is the number of the received datagrams that couldn't be
+	// delivered for reasons other than the lack of an application at the
+	// destination port.
+	InErrors uint64
+
+	// RcvbufErrors is the number of the received datagrams dropped because
+	// the socket receive buffer was full.
+	RcvbufErrors uint64
+}
+
+// ReadUDPStats returns the system-wide counters of the dropped UDP datagrams.
+// It returns an error on the operating systems which don't provide them.
+func ReadUDPStats() (s *UDPStats, err error) {
+	return readUDPStats()
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package aghnet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// snmpFilename is the name of the file with the counters of the network stack
+// in the root filesystem.
+const snmpFilename = "proc/net/snmp"
+
+func readUDPStats() (s *UDPStats, err error) {
+	f, err := rootDirFS.Open(snmpFilename)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	return parseUDPStats(f)
+}
+
+// parseUDPStats parses the UDP counters from r which should have the format of
+// /proc/net/snmp, where the line with the names of the counters precedes the
+// line with their values.
+func parseUDPStats(r io.Reader) (s *UDPStats, err error) {
+	const prefix = "Udp:"
+
+	var names []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] != prefix {
+			continue
+		}
+
+		if names == nil {
+			names = fields[1:]
+
+			continue
+		}
+
+		return newUDPStats(names, fields[1:])
+	}
+
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
+
+	return nil, errors.Error("no udp counters")
+}
+
+// newUDPStats returns the counters from the values of the counters with names.
+func newUDPStats(names, vals []string) (s *UDPStats, err error) {
+	if len(names) != len(vals) {
+		return nil, fmt.Errorf("got %d udp values for %d names", len(vals), len(names))
+	}
+
+	s = &UDPStats{}
+	for i, name := range names {
+		var dst *uint64
+		switch name {
+		case "InErrors":
+			dst = &s.InErrors
+		case "RcvbufErrors":
+			dst = &s.RcvbufErrors
+		default:
+			continue
+		}
+
+		*dst, err = strconv.ParseUint(vals[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("udp counter %q: %w", name, err)
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package aghnet
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadUDPStats(t *testing.T) {
+	testCases := []struct {
+		want       *UDPStats
+		name       string
+		data       string
+		wantErrMsg string
+	}{{
+		want: &UDPStats{InErrors: 3, RcvbufErrors: 2},
+		name: "success",
+		data: "Ip: Forwarding DefaultTTL\n" +
+			"Ip: 1 64\n" +
+			"Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors\n" +
+			"Udp: 100 1 3 99 2\n" +
+			"UdpLite: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors\n" +
+			"UdpLite: 0 0 0 0 0\n",
+		wantErrMsg: "",
+	}, {
+		want:       nil,
+		name:       "no_udp",
+		data:       "Ip: Forwarding DefaultTTL\nIp: 1 64\n",
+		wantErrMsg: "no udp counters",
+	}, {
+		want:       nil,
+		name:       "mismatch",
+		data:       "Udp: InErrors RcvbufErrors\nUdp: 1\n",
+		wantErrMsg: "got 1 udp values for 2 names",
+	}, {
+		want: nil,
+		name: "bad_value",
+		data: "Udp: InErrors\nUdp: x\n",
+		wantErrMsg: `udp counter "InErrors": strconv.ParseUint: ` +
+			`parsing "x": invalid syntax`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			substRootDirFS(t, fstest.MapFS{
+				snmpFilename: &fstest.MapFile{Data: []byte(tc.data)},
+			})
+
+			s, err := ReadUDPStats()
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			assert.Equal(t, tc.want, s)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package aghnet
+
+import "github.com/AdguardTeam/AdGuardHome/internal/aghos"
+
+func readUDPStats() (s *UDPStats, err error) {
+	return nil, aghos.Unsupported("udp stats")
+}
@@ -54,7 +54,7 @@ type osWatcher struct {
 const osWatcherPref = "os watcher"
 
 // NewOSWritesWatcher creates FSWatcher that tracks the real file system of the
-// OS and notifies only about writing events.
+// OS and notifies only about writing and creating events.
 func NewOSWritesWatcher() (w FSWatcher, err error) {
 	defer func() { err = errors.Annotate(err, "%s: %w", osWatcherPref) }()
 
@@ -127,7 +127,9 @@ func (w *osWatcher) handleEvents() {
 
 	ch := w.watcher.Events
 	for e := range ch {
-		if e.Op&fsnotify.Write == 0 || !w.files.Has(e.Name) {
+		// Creating the file is considered a write as well, since the files are
+		// often replaced atomically by renaming a temporary one.
+		if e.Op&(fsnotify.Write|fsnotify.Create) == 0 || !w.files.Has(e.Name) {
 			continue
 		}
 
@@ -168,3 +168,19 @@ func IsReconfigureSignal(sig os.Signal) (ok bool) {
 func SendShutdownSignal(c chan<- os.Signal) {
 	sendShutdownSignal(c)
 }
+
+// MapFile maps the contents of the file at path into memory for reading.  The
+// pages are loaded by the kernel on access and may be evicted under memory
+// pressure, so they aren't accounted as the heap of the process.  data must not
+// be used after unmap is called.  The file must be replaced by renaming, not
+// truncated, while it's mapped.  It returns an [UnsupportedError] on the
+// platforms not supporting memory mapping.
+func MapFile(path string) (data []byte, unmap func() (err error), err error) {
+	return mapFile(path)
+}
+
+// DiskSpace returns the number of bytes available to the unprivileged users
+// and the total size of the file system containing path.
+func DiskSpace(path string) (avail, total uint64, err error) {
+	return diskSpace(path)
+}
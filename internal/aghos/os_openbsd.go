@@ -0,0 +1,20 @@
+//go:build openbsd
+
+package aghos
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func diskSpace(path string) (avail, total uint64, err error) {
+	st := &unix.Statfs_t{}
+	err = unix.Statfs(path, st)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return 0, 0, err
+	}
+
+	bsize := uint64(st.F_bsize)
+
+	return uint64(st.F_bavail) * bsize, st.F_blocks * bsize, nil
+}
@@ -0,0 +1,21 @@
+//go:build darwin || freebsd || linux
+
+package aghos
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func diskSpace(path string) (avail, total uint64, err error) {
+	st := &unix.Statfs_t{}
+	err = unix.Statfs(path, st)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return 0, 0, err
+	}
+
+	// The types of the fields differ between the platforms and architectures.
+	bsize := uint64(st.Bsize)
+
+	return uint64(st.Bavail) * bsize, st.Blocks * bsize, nil
+}
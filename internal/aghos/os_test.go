@@ -2,8 +2,11 @@ package aghos
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/ioutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -95,3 +98,40 @@ func TestLargestLabeled(t *testing.T) {
 		assert.Equal(t, 1, instances)
 	})
 }
+
+func TestDiskSpace(t *testing.T) {
+	avail, total, err := DiskSpace(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Positive(t, total)
+	assert.LessOrEqual(t, avail, total)
+}
+
+func TestMapFile(t *testing.T) {
+	const content = "||example.org^\n||example.com^\n"
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	data, unmap, err := MapFile(path)
+	if errors.As(err, new(*UnsupportedError)) {
+		t.Skipf("skipping: %s", err)
+	}
+	require.NoError(t, err)
+
+	assert.Equal(t, content, string(data))
+	require.NoError(t, unmap())
+
+	emptyPath := filepath.Join(dir, "empty.txt")
+	require.NoError(t, os.WriteFile(emptyPath, nil, 0o644))
+
+	data, unmap, err = MapFile(emptyPath)
+	require.NoError(t, err)
+
+	assert.Empty(t, data)
+	require.NoError(t, unmap())
+
+	_, _, err = MapFile(filepath.Join(dir, "absent.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -3,9 +3,11 @@
 package aghos
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 
+	"github.com/AdguardTeam/golibs/errors"
 	"golang.org/x/sys/unix"
 )
 
@@ -20,3 +22,35 @@ func isReconfigureSignal(sig os.Signal) (ok bool) {
 func sendShutdownSignal(_ chan<- os.Signal) {
 	// On Unix we are already notified by the system.
 }
+
+func mapFile(path string) (data []byte, unmap func() (err error), err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	// The mapping stays valid after the file is closed.
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, nil, err
+	}
+
+	size := fi.Size()
+	if size == 0 {
+		// Empty files can't be mapped.
+		return []byte{}, func() (err error) { return nil }, nil
+	} else if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("file size %d is too large", size)
+	}
+
+	data, err = unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapping: %w", err)
+	}
+
+	return data, func() (err error) { return unix.Munmap(data) }, nil
+}
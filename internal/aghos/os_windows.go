@@ -49,3 +49,25 @@ func isReconfigureSignal(sig os.Signal) (ok bool) {
 func sendShutdownSignal(c chan<- os.Signal) {
 	c <- os.Interrupt
 }
+
+func diskSpace(path string) (avail, total uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return 0, 0, err
+	}
+
+	err = windows.GetDiskFreeSpaceEx(p, &avail, &total, nil)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return 0, 0, err
+	}
+
+	return avail, total, nil
+}
+
+func mapFile(_ string) (data []byte, unmap func() (err error), err error) {
+	// Mapped files can't be replaced on Windows, which is how the filter lists
+	// are updated.
+	return nil, nil, Unsupported("mapping files")
+}
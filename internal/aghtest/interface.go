@@ -125,6 +125,8 @@ type ClientsContainer struct {
 		id string,
 		boot upstream.Resolver,
 	) (conf *proxy.CustomUpstreamConfig, err error)
+
+	OnClientIDByListener func(cliAddr, laddr netip.Addr, listenerID string) (id string)
 }
 
 // UpstreamConfigByID implements the [dnsforward.ClientsContainer] interface
@@ -136,6 +138,16 @@ func (c *ClientsContainer) UpstreamConfigByID(
 	return c.OnUpstreamConfigByID(id, boot)
 }
 
+// ClientIDByListener implements the [dnsforward.ClientsContainer] interface
+// for *ClientsContainer.
+func (c *ClientsContainer) ClientIDByListener(
+	cliAddr netip.Addr,
+	laddr netip.Addr,
+	listenerID string,
+) (id string) {
+	return c.OnClientIDByListener(cliAddr, laddr, listenerID)
+}
+
 // Package filtering
 
 // Resolver is a fake [filtering.Resolver] implementation for tests.
@@ -82,6 +82,10 @@ type Runtime struct {
 	// there is no information from the source.  Empty non-nil slice indicates
 	// that the data from the source is present, but empty.
 	hostsFile []string
+
+	// tags are the client tags guessed from the DHCP fingerprint of the
+	// client.  They are sorted.
+	tags []string
 }
 
 // NewRuntime constructs a new runtime client.  ip must be valid IP address.
@@ -93,29 +97,66 @@ func NewRuntime(ip netip.Addr) (r *Runtime) {
 	}
 }
 
+// DefaultPriority is the default order of the sources of the runtime clients'
+// hostnames, from the highest priority to the lowest.
+var DefaultPriority = []Source{
+	SourceHostsFile,
+	SourceDHCP,
+	SourceRDNS,
+	SourceARP,
+}
+
 // Info returns a client information from the highest-priority source.
 func (r *Runtime) Info() (cs Source, host string) {
-	info := []string{}
-
-	switch {
-	case r.hostsFile != nil:
-		cs, info = SourceHostsFile, r.hostsFile
-	case r.dhcp != nil:
-		cs, info = SourceDHCP, r.dhcp
-	case r.rdns != nil:
-		cs, info = SourceRDNS, r.rdns
-	case r.arp != nil:
-		cs, info = SourceARP, r.arp
-	case r.whois != nil:
-		cs = SourceWHOIS
+	return r.InfoByPriority(DefaultPriority)
+}
+
+// InfoByPriority returns a client information from the first source in prio
+// which has the information about the client.  The sources missing from prio
+// are checked after it in the order of [DefaultPriority].  prio must not be
+// modified.
+func (r *Runtime) InfoByPriority(prio []Source) (cs Source, host string) {
+	for _, srcs := range [2][]Source{prio, DefaultPriority} {
+		for _, src := range srcs {
+			if hosts := r.Hosts(src); hosts != nil {
+				return src, firstHost(hosts)
+			}
+		}
+	}
+
+	if r.whois != nil {
+		return SourceWHOIS, ""
 	}
 
-	if len(info) == 0 {
-		return cs, ""
+	return cs, ""
+}
+
+// firstHost returns the first of hosts or an empty string if there are none.
+//
+// TODO(s.chzhen):  Return the full information.
+func firstHost(hosts []string) (host string) {
+	if len(hosts) == 0 {
+		return ""
 	}
 
-	// TODO(s.chzhen):  Return the full information.
-	return cs, info[0]
+	return hosts[0]
+}
+
+// Hosts returns the hostnames of the client from cs.  hosts is nil if there is
+// no information from cs, and it must not be modified.
+func (r *Runtime) Hosts(cs Source) (hosts []string) {
+	switch cs {
+	case SourceARP:
+		return r.arp
+	case SourceRDNS:
+		return r.rdns
+	case SourceDHCP:
+		return r.dhcp
+	case SourceHostsFile:
+		return r.hostsFile
+	default:
+		return nil
+	}
 }
 
 // SetInfo sets a host as a client information from the cs.
@@ -146,6 +187,18 @@ func (r *Runtime) SetWHOIS(info *whois.Info) {
 	r.whois = info
 }
 
+// Tags returns the client tags guessed from the DHCP fingerprint of the client.
+// tags are sorted and must not be modified.
+func (r *Runtime) Tags() (tags []string) {
+	return r.tags
+}
+
+// SetTags sets the client tags guessed from the DHCP fingerprint of the
+// client.  tags must be sorted.
+func (r *Runtime) SetTags(tags []string) {
+	r.tags = tags
+}
+
 // unset clears a cs information.
 func (r *Runtime) unset(cs Source) {
 	switch cs {
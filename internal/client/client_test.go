@@ -5,7 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMain(m *testing.M) {
@@ -23,3 +26,53 @@ const testWHOISCity = "Brussels"
 
 // testIP is the common IP address for tests.
 var testIP = netip.MustParseAddr("1.2.3.4")
+
+func TestRuntime_InfoByPriority(t *testing.T) {
+	const (
+		arpHost  = "arp.example"
+		dhcpHost = "dhcp.example"
+	)
+
+	rc := client.NewRuntime(testIP)
+	rc.SetInfo(client.SourceARP, []string{arpHost})
+	rc.SetInfo(client.SourceDHCP, []string{dhcpHost})
+
+	testCases := []struct {
+		name     string
+		wantHost string
+		prio     []client.Source
+		wantSrc  client.Source
+	}{{
+		name:     "default",
+		wantHost: dhcpHost,
+		prio:     nil,
+		wantSrc:  client.SourceDHCP,
+	}, {
+		name:     "arp_first",
+		wantHost: arpHost,
+		prio:     []client.Source{client.SourceARP},
+		wantSrc:  client.SourceARP,
+	}, {
+		name:     "missing_source",
+		wantHost: dhcpHost,
+		prio:     []client.Source{client.SourceRDNS},
+		wantSrc:  client.SourceDHCP,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, host := rc.InfoByPriority(tc.prio)
+			assert.Equal(t, tc.wantSrc, src)
+			assert.Equal(t, tc.wantHost, host)
+		})
+	}
+
+	t.Run("whois", func(t *testing.T) {
+		wrc := client.NewRuntime(testIP)
+		wrc.SetWHOIS(&whois.Info{City: testWHOISCity})
+
+		src, host := wrc.InfoByPriority([]client.Source{client.SourceARP})
+		assert.Equal(t, client.SourceWHOIS, src)
+		assert.Empty(t, host)
+	})
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+)
+
+// fingerprintRule is a rule for guessing the device type and operating system
+// of a DHCP client by its fingerprint.
+type fingerprintRule struct {
+	// vendorClass, if not empty, is the lowercase prefix of the Vendor Class
+	// Identifier of the matching clients.
+	vendorClass string
+
+	// paramList, if not empty, is the Parameter Request List of the matching
+	// clients.
+	paramList string
+
+	// tags are the client tags of the matching clients.
+	tags []string
+}
+
+// fingerprintRules are the rules for guessing the device types and operating
+// systems of the DHCP clients.  The vendor class rules go first, since they are
+// more reliable.
+var fingerprintRules = []*fingerprintRule{{
+	vendorClass: "android-dhcp-",
+	tags:        []string{"os_android"},
+}, {
+	vendorClass: "msft ",
+	tags:        []string{"os_windows"},
+}, {
+	vendorClass: "dhcpcd-",
+	tags:        []string{"os_linux"},
+}, {
+	vendorClass: "udhcp",
+	tags:        []string{"os_linux"},
+}, {
+	vendorClass: "cisco systems, inc. ip phone",
+	tags:        []string{"device_phone"},
+}, {
+	vendorClass: "polycom",
+	tags:        []string{"device_phone"},
+}, {
+	vendorClass: "hewlett-packard jetdirect",
+	tags:        []string{"device_printer"},
+}, {
+	paramList: "1,121,3,6,15,119,252",
+	tags:      []string{"os_ios"},
+}, {
+	paramList: "1,121,3,6,15,119,252,95,44,46",
+	tags:      []string{"device_pc", "os_macos"},
+}, {
+	paramList: "1,121,3,6,15,108,114,119,162,252,95,44,46",
+	tags:      []string{"device_pc", "os_macos"},
+}, {
+	paramList: "1,3,6,15,31,33,43,44,46,47,119,121,249,252",
+	tags:      []string{"device_pc", "os_windows"},
+}, {
+	paramList: "1,3,6,15,26,28,51,58,59,43",
+	tags:      []string{"os_android"},
+}, {
+	paramList: "1,28,2,3,15,6,119,12,44,47,26,121,42",
+	tags:      []string{"os_linux"},
+}}
+
+// match returns true if fp matches the rule.
+func (r *fingerprintRule) match(fp dhcpsvc.Fingerprint) (ok bool) {
+	if r.vendorClass != "" {
+		return strings.HasPrefix(strings.ToLower(fp.VendorClass), r.vendorClass)
+	}
+
+	return fp.ParamList == r.paramList
+}
+
+// GuessTags returns the client tags for the device type and the operating
+// system guessed from the DHCP fingerprint.  Each kind of tag is taken from the
+// first matching rule.  tags are sorted and nil if nothing is guessed.
+func GuessTags(fp dhcpsvc.Fingerprint) (tags []string) {
+	if fp == (dhcpsvc.Fingerprint{}) {
+		return nil
+	}
+
+	for _, r := range fingerprintRules {
+		if !r.match(fp) {
+			continue
+		}
+
+		for _, t := range r.tags {
+			kind, _, _ := strings.Cut(t, "_")
+			if !slices.ContainsFunc(tags, func(s string) (found bool) {
+				return strings.HasPrefix(s, kind+"_")
+			}) {
+				tags = append(tags, t)
+			}
+		}
+	}
+
+	slices.Sort(tags)
+
+	return tags
+}
@@ -0,0 +1,60 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuessTags(t *testing.T) {
+	testCases := []struct {
+		name string
+		fp   dhcpsvc.Fingerprint
+		want []string
+	}{{
+		name: "empty",
+		fp:   dhcpsvc.Fingerprint{},
+		want: nil,
+	}, {
+		name: "unknown",
+		fp: dhcpsvc.Fingerprint{
+			ParamList:   "1,3,6",
+			VendorClass: "unknown",
+		},
+		want: nil,
+	}, {
+		name: "android_vendor_class",
+		fp: dhcpsvc.Fingerprint{
+			VendorClass: "android-dhcp-14",
+		},
+		want: []string{"os_android"},
+	}, {
+		name: "windows",
+		fp: dhcpsvc.Fingerprint{
+			ParamList:   "1,3,6,15,31,33,43,44,46,47,119,121,249,252",
+			VendorClass: "MSFT 5.0",
+		},
+		want: []string{"device_pc", "os_windows"},
+	}, {
+		name: "vendor_class_first",
+		fp: dhcpsvc.Fingerprint{
+			ParamList:   "1,121,3,6,15,119,252",
+			VendorClass: "dhcpcd-9.4.1:Linux-6.1.0:x86_64:GenuineIntel",
+		},
+		want: []string{"os_linux"},
+	}, {
+		name: "ip_phone",
+		fp: dhcpsvc.Fingerprint{
+			VendorClass: "Cisco Systems, Inc. IP Phone CP-7945G",
+		},
+		want: []string{"device_phone"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, client.GuessTags(tc.fp))
+		})
+	}
+}
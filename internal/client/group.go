@@ -0,0 +1,105 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+)
+
+// Group contains the settings shared by the persistent clients which reference
+// it.  The clients may override any of them with their own.
+type Group struct {
+	SafeSearch filtering.SafeSearch
+
+	// BlockedServices is the configuration of blocked services of the group,
+	// including the schedule.  If it's nil, the clients of the group use the
+	// global blocked services unless they have their own.
+	BlockedServices *filtering.BlockedServices
+
+	// Name is the unique name of the group.
+	Name string
+
+	// ThreatCategories are the threat-feed categories enabled for the group.
+	ThreatCategories []filtering.ThreatCategory
+
+	// Upstreams are the upstream servers of the clients of the group which
+	// don't have their own.
+	Upstreams []string
+
+	SafeSearchConf filtering.SafeSearchConfig
+
+	FilteringEnabled    bool
+	SafeBrowsingEnabled bool
+	ParentalEnabled     bool
+	NewDomainsEnabled   bool
+}
+
+// SetSafeSearch initializes and sets the safe search filter for this group.
+func (g *Group) SetSafeSearch(
+	conf filtering.SafeSearchConfig,
+	cacheSize uint,
+	cacheTTL time.Duration,
+) (err error) {
+	ss, err := safesearch.NewDefault(conf, fmt.Sprintf("group %q", g.Name), cacheSize, cacheTTL)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
+	g.SafeSearch = ss
+
+	return nil
+}
+
+// ShallowClone returns a deep copy of the group, except SafeSearch field,
+// because it's difficult to copy it.
+func (g *Group) ShallowClone() (clone *Group) {
+	clone = &Group{}
+	*clone = *g
+
+	clone.BlockedServices = g.BlockedServices.Clone()
+	clone.ThreatCategories = slices.Clone(g.ThreatCategories)
+	clone.Upstreams = slices.Clone(g.Upstreams)
+
+	return clone
+}
+
+// Inherit returns a shallow clone of c with the settings c doesn't override
+// taken from g.  g may be nil, in which case the clone is returned as is.
+func (c *Persistent) Inherit(g *Group) (eff *Persistent) {
+	eff = c.ShallowClone()
+	if g == nil {
+		return eff
+	}
+
+	if !c.UseOwnSettings {
+		eff.UseOwnSettings = true
+		eff.FilteringEnabled = g.FilteringEnabled
+		eff.NewDomainsEnabled = g.NewDomainsEnabled
+		eff.SafeSearchConf = g.SafeSearchConf
+		eff.SafeSearch = g.SafeSearch
+		eff.ThreatCategories = slices.Clone(g.ThreatCategories)
+
+		if !c.UseOwnSafeBrowsing {
+			eff.SafeBrowsingEnabled = g.SafeBrowsingEnabled
+		}
+
+		if !c.UseOwnParental {
+			eff.ParentalEnabled = g.ParentalEnabled
+		}
+	}
+
+	if !c.UseOwnBlockedServices && g.BlockedServices != nil {
+		eff.UseOwnBlockedServices = true
+		eff.BlockedServices = g.BlockedServices.Clone()
+	}
+
+	if len(c.Upstreams) == 0 {
+		eff.Upstreams = slices.Clone(g.Upstreams)
+	}
+
+	return eff
+}
@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistent_Inherit(t *testing.T) {
+	grp := &client.Group{
+		BlockedServices: &filtering.BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+			IDs:      []string{"youtube"},
+		},
+		Name:                "kids",
+		Upstreams:           []string{"1.1.1.3"},
+		FilteringEnabled:    true,
+		SafeBrowsingEnabled: true,
+		ParentalEnabled:     true,
+	}
+
+	t.Run("no_group", func(t *testing.T) {
+		c := &client.Persistent{
+			Name: "client",
+		}
+
+		eff := c.Inherit(nil)
+		assert.Equal(t, c, eff)
+		assert.NotSame(t, c, eff)
+	})
+
+	t.Run("inherit_all", func(t *testing.T) {
+		c := &client.Persistent{
+			Name:  "client",
+			Group: grp.Name,
+		}
+
+		eff := c.Inherit(grp)
+		assert.True(t, eff.UseOwnSettings)
+		assert.True(t, eff.FilteringEnabled)
+		assert.True(t, eff.SafeBrowsingEnabled)
+		assert.True(t, eff.ParentalEnabled)
+		assert.True(t, eff.UseOwnBlockedServices)
+		assert.Equal(t, grp.BlockedServices, eff.BlockedServices)
+		assert.Equal(t, grp.Upstreams, eff.Upstreams)
+
+		assert.False(t, c.UseOwnSettings)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		svcs := &filtering.BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+			IDs:      []string{"tiktok"},
+		}
+
+		c := &client.Persistent{
+			BlockedServices:       svcs,
+			Name:                  "client",
+			Group:                 grp.Name,
+			Upstreams:             []string{"9.9.9.9"},
+			UseOwnBlockedServices: true,
+			UseOwnParental:        true,
+			ParentalEnabled:       false,
+		}
+
+		eff := c.Inherit(grp)
+		assert.True(t, eff.UseOwnSettings)
+		assert.True(t, eff.FilteringEnabled)
+		assert.False(t, eff.ParentalEnabled)
+		assert.Equal(t, svcs, eff.BlockedServices)
+		assert.Equal(t, []string{"9.9.9.9"}, eff.Upstreams)
+	})
+}
@@ -49,6 +49,12 @@ type Index struct {
 
 	// subnetToUID maps subnet to UID.
 	subnetToUID aghalg.SortedMap[netip.Prefix, UID]
+
+	// listenerToUID maps local address of the listener to UID.
+	listenerToUID map[netip.Addr]UID
+
+	// ifaceToUID maps network interface name to UID.
+	ifaceToUID map[string]UID
 }
 
 // NewIndex initializes the new instance of client index.
@@ -60,6 +66,8 @@ func NewIndex() (ci *Index) {
 		subnetToUID:   aghalg.NewSortedMap[netip.Prefix, UID](subnetCompare),
 		macToUID:      map[macKey]UID{},
 		uidToClient:   map[UID]*Persistent{},
+		listenerToUID: map[netip.Addr]UID{},
+		ifaceToUID:    map[string]UID{},
 	}
 }
 
@@ -89,6 +97,14 @@ func (ci *Index) Add(c *Persistent) {
 		ci.macToUID[k] = c.UID
 	}
 
+	for _, ip := range c.Listeners {
+		ci.listenerToUID[ip] = c.UID
+	}
+
+	for _, name := range c.Interfaces {
+		ci.ifaceToUID[name] = c.UID
+	}
+
 	ci.uidToClient[c.UID] = c
 }
 
@@ -134,6 +150,24 @@ func (ci *Index) Clashes(c *Persistent) (err error) {
 		return fmt.Errorf("another client %q uses the same MAC %q", p.Name, mac)
 	}
 
+	for _, ip := range c.Listeners {
+		existing, ok := ci.listenerToUID[ip]
+		if ok && existing != c.UID {
+			p = ci.uidToClient[existing]
+
+			return fmt.Errorf("another client %q uses the same listener %q", p.Name, ip)
+		}
+	}
+
+	for _, name := range c.Interfaces {
+		existing, ok := ci.ifaceToUID[name]
+		if ok && existing != c.UID {
+			p = ci.uidToClient[existing]
+
+			return fmt.Errorf("another client %q uses the same interface %q", p.Name, name)
+		}
+	}
+
 	return nil
 }
 
@@ -206,13 +240,31 @@ func (ci *Index) clashesMAC(c *Persistent) (p *Persistent, mac net.HardwareAddr)
 }
 
 // Find finds persistent client by string representation of the client ID, IP
-// address, or MAC.
+// address, MAC, or the prefixed listener address or network interface name.
 func (ci *Index) Find(id string) (c *Persistent, ok bool) {
 	uid, found := ci.clientIDToUID[id]
 	if found {
 		return ci.uidToClient[uid], true
 	}
 
+	if addr, isListener := strings.CutPrefix(id, ListenerIDPrefix); isListener {
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return nil, false
+		}
+
+		return ci.FindByListener(ip)
+	}
+
+	if name, isIface := strings.CutPrefix(id, InterfaceIDPrefix); isIface {
+		uid, found = ci.ifaceToUID[name]
+		if found {
+			return ci.uidToClient[uid], true
+		}
+
+		return nil, false
+	}
+
 	ip, err := netip.ParseAddr(id)
 	if err == nil {
 		// MAC addresses can be successfully parsed as IP addresses.
@@ -230,6 +282,16 @@ func (ci *Index) Find(id string) (c *Persistent, ok bool) {
 	return nil, false
 }
 
+// FindByListener finds persistent client by the local address of the listener.
+func (ci *Index) FindByListener(ip netip.Addr) (c *Persistent, found bool) {
+	uid, found := ci.listenerToUID[ip.Unmap()]
+	if found {
+		return ci.uidToClient[uid], true
+	}
+
+	return nil, false
+}
+
 // FindByName finds persistent client by name.
 func (ci *Index) FindByName(name string) (c *Persistent, found bool) {
 	uid, found := ci.nameToUID[name]
@@ -319,6 +381,14 @@ func (ci *Index) Delete(c *Persistent) {
 		delete(ci.macToUID, k)
 	}
 
+	for _, ip := range c.Listeners {
+		delete(ci.listenerToUID, ip)
+	}
+
+	for _, name := range c.Interfaces {
+		delete(ci.ifaceToUID, name)
+	}
+
 	delete(ci.uidToClient, c.UID)
 }
 
@@ -38,6 +38,12 @@ func TestClientIndex_Find(t *testing.T) {
 
 		linkLocalIP     = "fe80::abcd:abcd:abcd:ab%eth0"
 		linkLocalSubnet = "fe80::/16"
+
+		cliWideSubnet   = "2.0.0.0/8"
+		cliWideSubnetIP = "2.3.3.3"
+
+		cliListener = "192.168.20.1"
+		cliIface    = "br-guest"
 	)
 
 	var (
@@ -69,14 +75,32 @@ func TestClientIndex_Find(t *testing.T) {
 			Name:    "client_link_local",
 			Subnets: []netip.Prefix{netip.MustParsePrefix(linkLocalSubnet)},
 		}
+
+		clientWithWideSubnet = &Persistent{
+			Name:    "client_with_wide_subnet",
+			Subnets: []netip.Prefix{netip.MustParsePrefix(cliWideSubnet)},
+		}
+
+		clientWithListener = &Persistent{
+			Name:      "client_with_listener",
+			Listeners: []netip.Addr{netip.MustParseAddr(cliListener)},
+		}
+
+		clientWithIface = &Persistent{
+			Name:       "client_with_iface",
+			Interfaces: []string{cliIface},
+		}
 	)
 
 	clients := []*Persistent{
 		clientWithBothFams,
+		clientWithWideSubnet,
 		clientWithSubnet,
 		clientWithMAC,
 		clientWithID,
 		clientLinkLocal,
+		clientWithListener,
+		clientWithIface,
 	}
 	ci := newIDIndex(clients)
 
@@ -104,6 +128,18 @@ func TestClientIndex_Find(t *testing.T) {
 		name: "client_link_local_subnet",
 		ids:  []string{linkLocalIP},
 		want: clientLinkLocal,
+	}, {
+		name: "wide_subnet",
+		ids:  []string{cliWideSubnetIP},
+		want: clientWithWideSubnet,
+	}, {
+		name: "listener",
+		ids:  []string{ListenerIDPrefix + cliListener},
+		want: clientWithListener,
+	}, {
+		name: "iface",
+		ids:  []string{InterfaceIDPrefix + cliIface},
+		want: clientWithIface,
 	}}
 
 	for _, tc := range testCases {
@@ -120,6 +156,9 @@ func TestClientIndex_Find(t *testing.T) {
 	t.Run("not_found", func(t *testing.T) {
 		_, ok := ci.Find(cliIPNone)
 		assert.False(t, ok)
+
+		_, ok = ci.Find(cliListener)
+		assert.False(t, ok)
 	})
 }
 
@@ -144,6 +183,12 @@ func TestClientIndex_Clashes(t *testing.T) {
 	}, {
 		Name:      "client_with_id",
 		ClientIDs: []string{cliID},
+	}, {
+		Name:      "client_with_listener",
+		Listeners: []netip.Addr{netip.MustParseAddr(cliIP1)},
+	}, {
+		Name:       "client_with_iface",
+		Interfaces: []string{"eth0"},
 	}}
 
 	ci := newIDIndex(clients)
@@ -163,6 +208,12 @@ func TestClientIndex_Clashes(t *testing.T) {
 	}, {
 		name:   "client_id",
 		client: clients[3],
+	}, {
+		name:   "listener",
+		client: clients[4],
+	}, {
+		name:   "iface",
+		client: clients[5],
 	}}
 
 	for _, tc := range testCases {
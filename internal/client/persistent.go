@@ -69,8 +69,19 @@ type Persistent struct {
 	// BlockedServices is the configuration of blocked services of a client.
 	BlockedServices *filtering.BlockedServices
 
+	// ThreatCategories are the threat-feed categories enabled for the client.
+	// They are only used when UseOwnSettings is true.
+	ThreatCategories []filtering.ThreatCategory
+
+	// QueryQuotas are the limits of the numbers of queries of the client.
+	QueryQuotas []*filtering.QueryQuota
+
 	Name string
 
+	// Group is the name of the group the client takes the settings it doesn't
+	// override from.  It's empty if the client isn't in any group.
+	Group string
+
 	Tags      []string
 	Upstreams []string
 
@@ -80,6 +91,16 @@ type Persistent struct {
 	MACs      []net.HardwareAddr
 	ClientIDs []string
 
+	// Listeners are the local addresses of the listeners the queries of the
+	// client arrive on.  They are only used when the client can't be found by
+	// its more specific identifiers.
+	Listeners []netip.Addr
+
+	// Interfaces are the names of the network interfaces the queries of the
+	// client arrive on.  They are only used when the client can't be found by
+	// its more specific identifiers, including Listeners.
+	Interfaces []string
+
 	// UID is the unique identifier of the persistent client.
 	UID UID
 
@@ -90,10 +111,19 @@ type Persistent struct {
 	FilteringEnabled      bool
 	SafeBrowsingEnabled   bool
 	ParentalEnabled       bool
+	NewDomainsEnabled     bool
 	UseOwnBlockedServices bool
 	IgnoreQueryLog        bool
 	IgnoreStatistics      bool
 
+	// UseOwnSafeBrowsing defines if SafeBrowsingEnabled overrides the global
+	// setting even if UseOwnSettings is false.
+	UseOwnSafeBrowsing bool
+
+	// UseOwnParental defines if ParentalEnabled overrides the global setting
+	// even if UseOwnSettings is false.
+	UseOwnParental bool
+
 	// TODO(d.kolyshev): Make SafeSearchConf a pointer.
 	SafeSearchConf filtering.SafeSearchConfig
 }
@@ -129,10 +159,24 @@ func (c *Persistent) SetIDs(ids []string) (err error) {
 	slices.SortFunc(c.Subnets, subnetCompare)
 	slices.SortFunc(c.MACs, slices.Compare[net.HardwareAddr])
 	slices.Sort(c.ClientIDs)
+	slices.SortFunc(c.Listeners, netip.Addr.Compare)
+	slices.Sort(c.Interfaces)
 
 	return nil
 }
 
+// Prefixes of the identifiers of the persistent clients defined by the inbound
+// listeners and network interfaces.
+const (
+	// ListenerIDPrefix is the prefix of the identifier containing the local
+	// IP address of the listener, e.g. "listener:192.168.20.1".
+	ListenerIDPrefix = "listener:"
+
+	// InterfaceIDPrefix is the prefix of the identifier containing the name of
+	// the network interface, e.g. "iface:br-guest".
+	InterfaceIDPrefix = "iface:"
+)
+
 // subnetCompare is a comparison function for the two subnets.  It returns -1 if
 // x sorts before y, 1 if x sorts after y, and 0 if their relative sorting
 // position is the same.
@@ -160,6 +204,28 @@ func (c *Persistent) setID(id string) (err error) {
 		return errors.Error("clientid is empty")
 	}
 
+	if addr, ok := strings.CutPrefix(id, ListenerIDPrefix); ok {
+		var ip netip.Addr
+		ip, err = netip.ParseAddr(addr)
+		if err != nil {
+			return fmt.Errorf("bad listener: %w", err)
+		}
+
+		c.Listeners = append(c.Listeners, ip.Unmap())
+
+		return nil
+	}
+
+	if name, ok := strings.CutPrefix(id, InterfaceIDPrefix); ok {
+		if name == "" {
+			return errors.Error("bad interface: empty name")
+		}
+
+		c.Interfaces = append(c.Interfaces, name)
+
+		return nil
+	}
+
 	var ip netip.Addr
 	if ip, err = netip.ParseAddr(id); err == nil {
 		c.IPs = append(c.IPs, ip)
@@ -222,12 +288,24 @@ func (c *Persistent) IDs() (ids []string) {
 		ids = append(ids, mac.String())
 	}
 
-	return append(ids, c.ClientIDs...)
+	ids = append(ids, c.ClientIDs...)
+
+	for _, ip := range c.Listeners {
+		ids = append(ids, ListenerIDPrefix+ip.String())
+	}
+
+	for _, name := range c.Interfaces {
+		ids = append(ids, InterfaceIDPrefix+name)
+	}
+
+	return ids
 }
 
 // IDsLen returns a length of client ids.
 func (c *Persistent) IDsLen() (n int) {
-	return len(c.IPs) + len(c.Subnets) + len(c.MACs) + len(c.ClientIDs)
+	n = len(c.IPs) + len(c.Subnets) + len(c.MACs) + len(c.ClientIDs)
+
+	return n + len(c.Listeners) + len(c.Interfaces)
 }
 
 // EqualIDs returns true if the ids of the current and previous clients are the
@@ -236,7 +314,9 @@ func (c *Persistent) EqualIDs(prev *Persistent) (equal bool) {
 	return slices.Equal(c.IPs, prev.IPs) &&
 		slices.Equal(c.Subnets, prev.Subnets) &&
 		slices.EqualFunc(c.MACs, prev.MACs, slices.Equal[net.HardwareAddr]) &&
-		slices.Equal(c.ClientIDs, prev.ClientIDs)
+		slices.Equal(c.ClientIDs, prev.ClientIDs) &&
+		slices.Equal(c.Listeners, prev.Listeners) &&
+		slices.Equal(c.Interfaces, prev.Interfaces)
 }
 
 // ShallowClone returns a deep copy of the client, except upstreamConfig,
@@ -248,11 +328,15 @@ func (c *Persistent) ShallowClone() (clone *Persistent) {
 	clone.BlockedServices = c.BlockedServices.Clone()
 	clone.Tags = slices.Clone(c.Tags)
 	clone.Upstreams = slices.Clone(c.Upstreams)
+	clone.ThreatCategories = slices.Clone(c.ThreatCategories)
+	clone.QueryQuotas = filtering.CloneQueryQuotas(c.QueryQuotas)
 
 	clone.IPs = slices.Clone(c.IPs)
 	clone.Subnets = slices.Clone(c.Subnets)
 	clone.MACs = slices.Clone(c.MACs)
 	clone.ClientIDs = slices.Clone(c.ClientIDs)
+	clone.Listeners = slices.Clone(c.Listeners)
+	clone.Interfaces = slices.Clone(c.Interfaces)
 
 	return clone
 }
@@ -1,9 +1,11 @@
 package dhcpd
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -35,6 +37,10 @@ type ServerConfig struct {
 	Conf4 V4ServerConf `yaml:"dhcpv4"`
 	Conf6 V6ServerConf `yaml:"dhcpv6"`
 
+	// Webhook is the configuration of the notifications about the lease
+	// lifecycle events.
+	Webhook WebhookConfig `yaml:"webhook"`
+
 	// WorkDir is used to store DHCP leases.
 	//
 	// Deprecated:  Remove it when migration of DHCP leases will not be needed.
@@ -73,6 +79,14 @@ type DHCPServer interface {
 	// one.
 	IPByHost(host string) (ip netip.Addr)
 
+	// FingerprintByIP returns the DHCP fingerprint of the client by the IP
+	// address of its lease, if there is one.
+	FingerprintByIP(ip netip.Addr) (fp dhcpsvc.Fingerprint)
+
+	// Conflicts returns the addresses which are currently not leased, since
+	// they are used by other devices or have been declined by the clients.
+	Conflicts() (conflicts []*AddrConflict)
+
 	// WriteDiskConfig4 - copy disk configuration
 	WriteDiskConfig4(c *V4ServerConf)
 	// WriteDiskConfig6 - copy disk configuration
@@ -103,10 +117,19 @@ type V4ServerConf struct {
 
 	LeaseDuration uint32 `yaml:"lease_duration" json:"lease_duration"` // in seconds
 
+	// LeaseDurations are the lease durations of certain clients which
+	// override LeaseDuration.
+	LeaseDurations []*V4LeaseDuration `yaml:"lease_durations" json:"lease_durations,omitempty"`
+
 	// IP conflict detector: time (ms) to wait for ICMP reply
 	// 0: disable
 	ICMPTimeout uint32 `yaml:"icmp_timeout_msec" json:"-"`
 
+	// ConflictHoldDuration is the time in seconds during which an address
+	// used by another device or declined by a client isn't leased.  The lease
+	// duration is used if it's zero.
+	ConflictHoldDuration uint32 `yaml:"conflict_hold_duration" json:"-"`
+
 	// Custom Options.
 	//
 	// Option with arbitrary hexadecimal data:
@@ -117,11 +140,29 @@ type V4ServerConf struct {
 	//     DEC_CODE ip IP_ADDR
 	Options []string `yaml:"options" json:"-"`
 
+	// RelayScopes are the scopes of the clients behind the DHCP relay agents.
+	RelayScopes []*V4RelayScope `yaml:"relay_scopes" json:"-"`
+
+	// InterfaceScopes are the scopes served on the network interfaces other
+	// than the one of the server, for example VLAN subinterfaces.
+	InterfaceScopes []*V4InterfaceScope `yaml:"interface_scopes" json:"interface_scopes,omitempty"`
+
+	// OptionSets are the options sent only to the clients of certain vendor
+	// or user classes.
+	OptionSets []*V4OptionSet `yaml:"option_sets" json:"-"`
+
+	// PXE is the configuration of the network boot, if any.
+	PXE *V4PXEConf `yaml:"pxe" json:"-"`
+
 	ipRange *ipRange
 
 	leaseTime  time.Duration // the time during which a dynamic lease is considered valid
 	dnsIPAddrs []netip.Addr  // IPv4 addresses to return to DHCP clients as DNS server addresses
 
+	// conflictHoldTime is the time during which a conflicting address isn't
+	// leased.
+	conflictHoldTime time.Duration
+
 	// subnet contains the DHCP server's subnet.  The IP is the IP of the
 	// gateway.
 	subnet netip.Prefix
@@ -135,6 +176,130 @@ type V4ServerConf struct {
 	notify func(uint32)
 }
 
+// V4RelayScope is the configuration of the addresses leased to the clients
+// behind a DHCP relay agent.  The requests relayed by an agent are served by the
+// scope which network contains the address of the agent, unless the scope is
+// selected by the Relay Agent Information option.
+type V4RelayScope struct {
+	GatewayIP  netip.Addr `yaml:"gateway_ip"`
+	SubnetMask netip.Addr `yaml:"subnet_mask"`
+	RangeStart netip.Addr `yaml:"range_start"`
+	RangeEnd   netip.Addr `yaml:"range_end"`
+
+	// CircuitID, if not empty, selects the scope for the requests with the
+	// same Agent Circuit ID regardless of the address of the relay agent.
+	// It's the ID itself if it's printable or its hex encoding otherwise.
+	CircuitID string `yaml:"circuit_id"`
+
+	// RemoteID is like CircuitID but for the Agent Remote ID.
+	RemoteID string `yaml:"remote_id"`
+
+	// Options are the custom options of the scope in the same format as
+	// [V4ServerConf.Options].  They override the options of the server.
+	Options []string `yaml:"options"`
+}
+
+// V4LeaseDuration is the duration of the dynamic leases of the clients with a
+// certain MAC address or vendor class.  Exactly one of MAC and VendorClass must
+// be set.
+type V4LeaseDuration struct {
+	// MAC, if not empty, matches the client with this hardware address.
+	MAC string `yaml:"mac" json:"mac,omitempty"`
+
+	// VendorClass, if not empty, matches the clients which Vendor Class
+	// Identifier, the option 60, starts with it.
+	VendorClass string `yaml:"vendor_class" json:"vendor_class,omitempty"`
+
+	// Duration is the lease duration in seconds.
+	Duration uint32 `yaml:"duration" json:"duration"`
+}
+
+// V4InterfaceScope is the configuration of a DHCPv4 scope served on its own
+// network interface.  The leases of each scope are stored along with the ones
+// of the server and are told apart by their addresses.
+type V4InterfaceScope struct {
+	InterfaceName string     `yaml:"interface_name" json:"interface_name"`
+	GatewayIP     netip.Addr `yaml:"gateway_ip" json:"gateway_ip"`
+	SubnetMask    netip.Addr `yaml:"subnet_mask" json:"subnet_mask"`
+	RangeStart    netip.Addr `yaml:"range_start" json:"range_start"`
+	RangeEnd      netip.Addr `yaml:"range_end" json:"range_end"`
+
+	// LeaseDuration is the duration of the dynamic leases of the scope in
+	// seconds.  The one of the server is used if it's zero.
+	LeaseDuration uint32 `yaml:"lease_duration" json:"lease_duration"`
+
+	// Options are the custom options of the scope in the same format as
+	// [V4ServerConf.Options].  They override the options of the server.
+	Options []string `yaml:"options" json:"options,omitempty"`
+}
+
+// V4OptionSet is the set of options sent to the clients of a certain class,
+// for example IP phones or PXE clients.  A set with both VendorClass and
+// UserClass only matches the clients of both classes.
+type V4OptionSet struct {
+	// VendorClass, if not empty, matches the clients which Vendor Class
+	// Identifier, the option 60, starts with it.
+	VendorClass string `yaml:"vendor_class"`
+
+	// UserClass, if not empty, matches the clients which User Class, the
+	// option 77, contains it.
+	UserClass string `yaml:"user_class"`
+
+	// Options are the options of the set in the same format as
+	// [V4ServerConf.Options].  They override the options of the server and
+	// the ones of the previous matching sets.
+	Options []string `yaml:"options"`
+}
+
+// V4PXEConf is the configuration of the network boot of the PXE clients.
+type V4PXEConf struct {
+	// NextServer is the address of the TFTP server sent in the siaddr field.
+	// It's also sent in the option 66 unless TFTPServerName is set.
+	NextServer netip.Addr `yaml:"next_server"`
+
+	// TFTPServerName, if not empty, is the name of the TFTP server sent in the
+	// option 66.
+	TFTPServerName string `yaml:"tftp_server_name"`
+
+	// BootFile is the boot file sent in the file field and the option 67 to
+	// the legacy BIOS clients, as well as to the UEFI ones, unless
+	// BootFileUEFI is set.
+	BootFile string `yaml:"boot_file"`
+
+	// BootFileUEFI, if not empty, is the boot file for the clients which
+	// Client System Architecture, the option 93, is not the legacy BIOS.
+	BootFileUEFI string `yaml:"boot_file_uefi"`
+
+	// Enabled defines if the network boot is enabled.
+	Enabled bool `yaml:"enabled"`
+
+	// ProxyDHCP, if true, makes the server only answer the PXE clients with
+	// the network boot parameters without leasing any addresses, so that it
+	// can coexist with another DHCP server in the same network.
+	ProxyDHCP bool `yaml:"proxy_dhcp"`
+}
+
+// validate returns an error if c is not a valid network boot configuration.
+func (c *V4PXEConf) validate() (err error) {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+
+	defer func() { err = errors.Annotate(err, "pxe: %w") }()
+
+	if c.BootFile == "" {
+		return errors.Error("no boot_file")
+	}
+
+	if c.NextServer.IsValid() {
+		_, err = ensureV4(c.NextServer, "address")
+	} else if c.TFTPServerName == "" {
+		return errors.Error("no next_server or tftp_server_name")
+	}
+
+	return err
+}
+
 // errNilConfig is an error returned by validation method if the config is nil.
 const errNilConfig errors.Error = "nil config"
 
@@ -221,7 +386,9 @@ func (c *V4ServerConf) Validate() (err error) {
 		)
 	}
 
-	return nil
+	// Don't wrap the error since it's informative enough as is and there is an
+	// annotation deferred already.
+	return c.PXE.validate()
 }
 
 // V6ServerConf - server configuration
@@ -238,6 +405,19 @@ type V6ServerConf struct {
 	RASLAACOnly  bool `yaml:"ra_slaac_only" json:"-"`  // send ICMPv6.RA packets without MO flags
 	RAAllowSLAAC bool `yaml:"ra_allow_slaac" json:"-"` // send ICMPv6.RA packets with MO flags
 
+	// PDPrefix is the pool of the prefixes delegated to the requesting
+	// routers.  Prefix delegation is disabled if it's invalid.
+	PDPrefix netip.Prefix `yaml:"pd_prefix" json:"pd_prefix"`
+
+	// PDPrefixLen is the length of the delegated prefixes.  It must be
+	// greater than the length of PDPrefix and not greater than 64.  Zero means
+	// 64.
+	PDPrefixLen int `yaml:"pd_prefix_len" json:"pd_prefix_len"`
+
+	// Reservations are the addresses and the prefixes reserved for the
+	// clients identified by their DUIDs.
+	Reservations []*V6Reservation `yaml:"reservations" json:"reservations"`
+
 	ipStart    net.IP        // starting IP address for dynamic leases
 	leaseTime  time.Duration // the time during which a dynamic lease is considered valid
 	dnsIPAddrs []net.IP      // IPv6 addresses to return to DHCP clients as DNS server addresses
@@ -245,3 +425,62 @@ type V6ServerConf struct {
 	// Server calls this function when leases data changes
 	notify func(uint32)
 }
+
+// V6Reservation is an address and a delegated prefix reserved for a DHCPv6
+// client.
+type V6Reservation struct {
+	// DUID is the hex-encoded DUID of the client.  The bytes may be separated
+	// with colons.
+	DUID string `yaml:"duid" json:"duid"`
+
+	// Hostname is the hostname of the client, if any.
+	Hostname string `yaml:"hostname" json:"hostname"`
+
+	// IP is the reserved address, if any.
+	IP netip.Addr `yaml:"ip" json:"ip"`
+
+	// Prefix is the reserved delegated prefix, if any.
+	Prefix netip.Prefix `yaml:"prefix" json:"prefix"`
+}
+
+// parseDUID returns the DUID decoded from s, which is hex-encoded with optional
+// colons between the bytes.
+func parseDUID(s string) (duid []byte, err error) {
+	duid, err = hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil {
+		return nil, fmt.Errorf("bad duid %q: %w", s, err)
+	}
+
+	if len(duid) == 0 {
+		return nil, errors.Error("empty duid")
+	}
+
+	return duid, nil
+}
+
+// validate returns an error if r isn't valid.  duid is the decoded DUID.
+func (r *V6Reservation) validate() (duid []byte, err error) {
+	if r == nil {
+		return nil, errors.Error("nil reservation")
+	}
+
+	duid, err = parseDUID(r.DUID)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if r.IP.IsValid() && !r.IP.Is6() {
+		return nil, fmt.Errorf("ip %s is not an ipv6 address", r.IP)
+	}
+
+	if r.Prefix.IsValid() && !r.Prefix.Addr().Is6() {
+		return nil, fmt.Errorf("prefix %s is not an ipv6 prefix", r.Prefix)
+	}
+
+	if !r.IP.IsValid() && !r.Prefix.IsValid() {
+		return nil, errors.Error("no ip or prefix")
+	}
+
+	return duid, nil
+}
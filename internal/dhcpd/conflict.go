@@ -0,0 +1,43 @@
+package dhcpd
+
+import (
+	"net"
+	"net/netip"
+	"time"
+)
+
+// ConflictSource is the way an address conflict has been detected.
+type ConflictSource string
+
+// ConflictSource values.
+const (
+	// ConflictSourceICMP means that the address has responded to an ICMP echo
+	// request.
+	ConflictSourceICMP ConflictSource = "icmp"
+
+	// ConflictSourceARP means that the address has been resolved by ARP while
+	// probing it, although it hasn't responded to an ICMP echo request.
+	ConflictSourceARP ConflictSource = "arp"
+
+	// ConflictSourceDecline means that the client has declined the address.
+	ConflictSourceDecline ConflictSource = "decline"
+)
+
+// AddrConflict is an address which isn't leased for some time, since it's used
+// by another device.
+type AddrConflict struct {
+	// Time is the time when the conflict has been detected.
+	Time time.Time
+
+	// Until is the time until which the address isn't leased.
+	Until time.Time
+
+	// IP is the conflicting address.
+	IP netip.Addr
+
+	// MAC is the hardware address of the device using the address, if known.
+	MAC net.HardwareAddr
+
+	// Source is the way the conflict has been detected.
+	Source ConflictSource
+}
@@ -253,6 +253,9 @@ func (s *v4Server) send(peer net.Addr, conn net.PacketConn, req, resp *dhcpv4.DH
 			IP:   ciaddr,
 			Port: dhcpv4.ClientPort,
 		}
+	case resp.YourIPAddr == nil || resp.YourIPAddr.IsUnspecified():
+		// Broadcast the ProxyDHCP offers, since they don't contain any address
+		// to unicast them to.
 	case !req.IsBroadcast() && req.ClientHWAddr != nil:
 		// Unicast DHCPOFFER and DHCPACK messages to the client's hardware
 		// address and yiaddr.
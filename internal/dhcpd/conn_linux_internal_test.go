@@ -166,6 +166,11 @@ func TestV4Server_Send(t *testing.T) {
 			Addr:   packet.Addr{HardwareAddr: knownMAC},
 			yiaddr: knownIP,
 		},
+	}, {
+		name: "no_yiaddr",
+		req:  &dhcpv4.DHCPv4{ClientHWAddr: knownMAC},
+		resp: &dhcpv4.DHCPv4{},
+		want: defaultPeer,
 	}, {
 		name: "who_are_you",
 		req:  &dhcpv4.DHCPv4{},
@@ -37,11 +37,17 @@ type dataLeases struct {
 
 // dbLease is the structure of stored lease.
 type dbLease struct {
-	Expiry   string     `json:"expires"`
-	IP       netip.Addr `json:"ip"`
-	Hostname string     `json:"hostname"`
-	HWAddr   string     `json:"mac"`
-	IsStatic bool       `json:"static"`
+	Expiry      string       `json:"expires"`
+	IP          netip.Addr   `json:"ip"`
+	Hostname    string       `json:"hostname"`
+	HWAddr      string       `json:"mac"`
+	Routes      []*routeJSON `json:"routes,omitempty"`
+	Options     []string     `json:"options,omitempty"`
+	CircuitID   string       `json:"circuit_id,omitempty"`
+	RemoteID    string       `json:"remote_id,omitempty"`
+	ParamList   string       `json:"param_list,omitempty"`
+	VendorClass string       `json:"vendor_class,omitempty"`
+	IsStatic    bool         `json:"static"`
 }
 
 // fromLease converts *dhcpsvc.Lease to *dbLease.
@@ -56,11 +62,17 @@ func fromLease(l *dhcpsvc.Lease) (dl *dbLease) {
 	}
 
 	return &dbLease{
-		Expiry:   expiryStr,
-		Hostname: l.Hostname,
-		HWAddr:   l.HWAddr.String(),
-		IP:       l.IP,
-		IsStatic: l.IsStatic,
+		Expiry:      expiryStr,
+		Hostname:    l.Hostname,
+		HWAddr:      l.HWAddr.String(),
+		IP:          l.IP,
+		Routes:      routesToJSON(l.Routes),
+		Options:     l.Options,
+		CircuitID:   l.CircuitID,
+		RemoteID:    l.RemoteID,
+		ParamList:   l.Fingerprint.ParamList,
+		VendorClass: l.Fingerprint.VendorClass,
+		IsStatic:    l.IsStatic,
 	}
 }
 
@@ -79,11 +91,24 @@ func (dl *dbLease) toLease() (l *dhcpsvc.Lease, err error) {
 		}
 	}
 
+	routes, err := routesFromJSON(dl.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing routes: %w", err)
+	}
+
 	return &dhcpsvc.Lease{
-		Expiry:   expiry,
-		IP:       dl.IP,
-		Hostname: dl.Hostname,
-		HWAddr:   mac,
+		Expiry:    expiry,
+		IP:        dl.IP,
+		Hostname:  dl.Hostname,
+		HWAddr:    mac,
+		Routes:    routes,
+		Options:   dl.Options,
+		CircuitID: dl.CircuitID,
+		RemoteID:  dl.RemoteID,
+		Fingerprint: dhcpsvc.Fingerprint{
+			ParamList:   dl.ParamList,
+			VendorClass: dl.VendorClass,
+		},
 		IsStatic: dl.IsStatic,
 	}, nil
 }
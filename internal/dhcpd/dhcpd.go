@@ -83,6 +83,11 @@ type Interface interface {
 	// due to an assumption that a DHCP client must always have an IP address.
 	IPByHost(host string) (ip netip.Addr)
 
+	// FingerprintByIP returns the DHCP fingerprint of the client with the
+	// given IP address.  fp is empty if there is no such client or its
+	// fingerprint is unknown.
+	FingerprintByIP(ip netip.Addr) (fp dhcpsvc.Fingerprint)
+
 	WriteDiskConfig(c *ServerConfig)
 }
 
@@ -97,6 +102,10 @@ type server struct {
 
 	// Called when the leases DB is modified
 	onLeaseChanged []OnLeaseChangedT
+
+	// events sends the notifications about the lease lifecycle events.  It's
+	// nil if the notifications are disabled.
+	events *leaseEvents
 }
 
 // type check
@@ -116,10 +125,18 @@ func Create(conf *ServerConfig) (s *server, err error) {
 
 			LocalDomainName: conf.LocalDomainName,
 
+			Webhook: conf.Webhook,
+
 			dbFilePath: filepath.Join(conf.DataDir, dataFilename),
 		},
 	}
 
+	s.events, err = newLeaseEvents(&conf.Webhook)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return nil, err
+	}
+
 	// TODO(e.burkov):  Don't register handlers, see TODO on
 	// [aghhttp.RegisterFunc].
 	s.registerHandlers()
@@ -151,6 +168,8 @@ func Create(conf *ServerConfig) (s *server, err error) {
 		return nil, fmt.Errorf("loading db: %w", err)
 	}
 
+	s.events.check(s.Leases())
+
 	return s, nil
 }
 
@@ -215,6 +234,8 @@ func (s *server) onNotify(flags uint32) {
 			log.Error("updating db: %s", err)
 		}
 
+		s.events.check(s.Leases())
+
 		return
 	}
 
@@ -232,6 +253,7 @@ func (s *server) WriteDiskConfig(c *ServerConfig) {
 	c.Enabled = s.conf.Enabled
 	c.InterfaceName = s.conf.InterfaceName
 	c.LocalDomainName = s.conf.LocalDomainName
+	c.Webhook = s.conf.Webhook
 
 	s.srv4.WriteDiskConfig4(&c.Conf4)
 	s.srv6.WriteDiskConfig6(&c.Conf6)
@@ -249,11 +271,15 @@ func (s *server) Start() (err error) {
 		return err
 	}
 
+	s.events.start(s.Leases)
+
 	return nil
 }
 
 // Stop closes the listening UDP socket
 func (s *server) Stop() (err error) {
+	s.events.stop()
+
 	err = s.srv4.Stop()
 	if err != nil {
 		return err
@@ -293,6 +319,15 @@ func (s *server) HostByIP(ip netip.Addr) (host string) {
 	return ""
 }
 
+// FingerprintByIP implements the [Interface] interface for *server.
+func (s *server) FingerprintByIP(ip netip.Addr) (fp dhcpsvc.Fingerprint) {
+	if ip.Is4() {
+		return s.srv4.FingerprintByIP(ip)
+	}
+
+	return dhcpsvc.Fingerprint{}
+}
+
 // IPByHost implements the [Interface] interface for *server.
 //
 // TODO(e.burkov):  Implement this method for DHCPv6.
@@ -0,0 +1,313 @@
+package dhcpd
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// EventType is the type of a lease lifecycle event.
+type EventType string
+
+// EventType values.
+const (
+	// EventLeaseAdded means that a dynamic lease has been granted to a client
+	// which had no lease for this address.
+	EventLeaseAdded EventType = "lease_added"
+
+	// EventLeaseRenewed means that a dynamic lease has been extended.
+	EventLeaseRenewed EventType = "lease_renewed"
+
+	// EventLeaseExpired means that a dynamic lease has expired or has been
+	// released.
+	EventLeaseExpired EventType = "lease_expired"
+
+	// EventUnknownDevice means that a dynamic lease has been granted to a
+	// client which MAC address hasn't been seen before.
+	EventUnknownDevice EventType = "unknown_device"
+)
+
+// WebhookConfig is the configuration of the notifications about the lease
+// lifecycle events.
+type WebhookConfig struct {
+	// URL is the HTTP(S) URL the events are sent to with the POST requests.
+	// The notifications are disabled if it's empty.
+	URL string `yaml:"url"`
+
+	// Events are the types of the sent events.  All the events are sent if
+	// it's empty.
+	Events []EventType `yaml:"events"`
+}
+
+// validate returns an error if c isn't valid.
+func (c *WebhookConfig) validate() (err error) {
+	defer func() { err = errors.Annotate(err, "webhook: %w") }()
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is and there
+		// is an annotation deferred already.
+		return err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("bad url scheme %q", u.Scheme)
+	}
+
+	for i, t := range c.Events {
+		switch t {
+		case EventLeaseAdded, EventLeaseRenewed, EventLeaseExpired, EventUnknownDevice:
+			// Go on.
+		default:
+			return fmt.Errorf("event at index %d: bad type %q", i, t)
+		}
+	}
+
+	return nil
+}
+
+// Event is a lease lifecycle event.  It's sent to the webhook as a JSON
+// object.
+type Event struct {
+	Type     EventType  `json:"type"`
+	Time     string     `json:"time"`
+	MAC      string     `json:"mac"`
+	IP       netip.Addr `json:"ip"`
+	Hostname string     `json:"hostname"`
+	Expires  string     `json:"expires"`
+}
+
+// newEvent returns a new event of type t for l.
+func newEvent(t EventType, l *dhcpsvc.Lease, now time.Time) (e *Event) {
+	return &Event{
+		Type:     t,
+		Time:     now.Format(time.RFC3339),
+		MAC:      l.HWAddr.String(),
+		IP:       l.IP,
+		Hostname: l.Hostname,
+		Expires:  l.Expiry.Format(time.RFC3339),
+	}
+}
+
+const (
+	// eventsCheckIvl is the interval of checking the leases for expiration.
+	eventsCheckIvl = 1 * time.Minute
+
+	// webhookTimeout is the timeout for sending an event to the webhook.
+	webhookTimeout = 10 * time.Second
+)
+
+// leaseEvents tracks the changes of the leases and sends the corresponding
+// events to the webhook.  A nil *leaseEvents is a valid disabled instance.
+type leaseEvents struct {
+	// send sends e to the webhook.  It's replaced in tests.
+	send func(e *Event)
+
+	// done stops the expiration checks.
+	done chan struct{}
+
+	// mu protects leases, known, and done.
+	mu *sync.Mutex
+
+	// leases are the dynamic leases of the last check by MAC address.  It's
+	// nil before the first check.
+	leases map[string]*dhcpsvc.Lease
+
+	// known is the set of the MAC addresses seen so far.
+	known map[string]struct{}
+
+	// types are the types of the events to send.  All the events are sent if
+	// it's empty.
+	types []EventType
+}
+
+// newLeaseEvents returns the events tracker for conf.  It returns nil if the
+// notifications are disabled.
+func newLeaseEvents(conf *WebhookConfig) (e *leaseEvents, err error) {
+	if conf.URL == "" {
+		return nil, nil
+	}
+
+	err = conf.validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	cli := &http.Client{
+		Timeout: webhookTimeout,
+	}
+
+	return &leaseEvents{
+		send: func(ev *Event) {
+			sendEvent(cli, conf.URL, ev)
+		},
+		mu:    &sync.Mutex{},
+		known: map[string]struct{}{},
+		types: conf.Events,
+	}, nil
+}
+
+// sendEvent sends ev to the webhook at u using cli and logs the error, if
+// any.
+func sendEvent(cli *http.Client, u string, ev *Event) {
+	err := postEvent(cli, u, ev)
+	if err != nil {
+		log.Error("dhcpd: sending %s event: %s", ev.Type, err)
+	}
+}
+
+// postEvent sends ev to the webhook at u using cli.
+func postEvent(cli *http.Client, u string, ev *Event) (err error) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set(httphdr.ContentType, "application/json")
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// check compares leases with the ones of the previous check and sends the
+// events about the changes.  The first check only remembers leases.
+func (e *leaseEvents) check(leases []*dhcpsvc.Lease) {
+	if e == nil {
+		return
+	}
+
+	for _, ev := range e.update(leases, time.Now()) {
+		if len(e.types) == 0 || slices.Contains(e.types, ev.Type) {
+			go e.send(ev)
+		}
+	}
+}
+
+// update compares leases with the ones of the previous check at now and
+// returns the events about the changes.
+func (e *leaseEvents) update(leases []*dhcpsvc.Lease, now time.Time) (evs []*Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	first := e.leases == nil
+	cur := make(map[string]*dhcpsvc.Lease, len(leases))
+	for _, l := range leases {
+		mac := l.HWAddr.String()
+		if l.IsStatic {
+			e.known[mac] = struct{}{}
+		} else if l.Expiry.After(now) {
+			cur[mac] = l.Clone()
+		}
+	}
+
+	defer func() { e.leases = cur }()
+
+	if first {
+		for mac := range cur {
+			e.known[mac] = struct{}{}
+		}
+
+		return nil
+	}
+
+	for mac, l := range cur {
+		prev, ok := e.leases[mac]
+		switch {
+		case !ok || prev.IP != l.IP:
+			evs = append(evs, newEvent(EventLeaseAdded, l, now))
+		case l.Expiry.After(prev.Expiry):
+			evs = append(evs, newEvent(EventLeaseRenewed, l, now))
+		}
+
+		if _, ok = e.known[mac]; !ok {
+			e.known[mac] = struct{}{}
+			evs = append(evs, newEvent(EventUnknownDevice, l, now))
+		}
+	}
+
+	for mac, prev := range e.leases {
+		if l, ok := cur[mac]; !ok || l.IP != prev.IP {
+			evs = append(evs, newEvent(EventLeaseExpired, prev, now))
+		}
+	}
+
+	slices.SortFunc(evs, func(a, b *Event) (res int) {
+		return cmp.Or(strings.Compare(a.MAC, b.MAC), strings.Compare(string(a.Type), string(b.Type)))
+	})
+
+	return evs
+}
+
+// start starts checking the leases returned by getLeases for expiration.
+func (e *leaseEvents) start(getLeases func() (leases []*dhcpsvc.Lease)) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.done != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	e.done = done
+
+	go func() {
+		defer log.OnPanic("dhcpd: checking lease events")
+
+		t := time.NewTicker(eventsCheckIvl)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				e.check(getLeases())
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops checking the leases for expiration.
+func (e *leaseEvents) stop() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.done != nil {
+		close(e.done)
+		e.done = nil
+	}
+}
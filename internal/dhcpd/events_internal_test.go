@@ -0,0 +1,149 @@
+package dhcpd
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseEvents_update(t *testing.T) {
+	e, err := newLeaseEvents(&WebhookConfig{URL: "http://127.0.0.1:8080/hook"})
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	macKnown := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	macStatic := net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+	macNew := net.HardwareAddr{0xCC, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC}
+
+	known := &dhcpsvc.Lease{
+		Expiry: now.Add(time.Hour),
+		IP:     netip.MustParseAddr("192.168.10.100"),
+		HWAddr: macKnown,
+	}
+	static := &dhcpsvc.Lease{
+		IP:       netip.MustParseAddr("192.168.10.10"),
+		HWAddr:   macStatic,
+		IsStatic: true,
+	}
+
+	evs := e.update([]*dhcpsvc.Lease{known, static}, now)
+	assert.Empty(t, evs)
+
+	renewed := known.Clone()
+	renewed.Expiry = now.Add(2 * time.Hour)
+
+	newLease := &dhcpsvc.Lease{
+		Expiry: now.Add(time.Hour),
+		IP:     netip.MustParseAddr("192.168.10.101"),
+		HWAddr: macNew,
+	}
+	staticDyn := &dhcpsvc.Lease{
+		Expiry: now.Add(time.Hour),
+		IP:     netip.MustParseAddr("192.168.10.102"),
+		HWAddr: macStatic,
+	}
+
+	evs = e.update([]*dhcpsvc.Lease{renewed, newLease, staticDyn}, now)
+	require.Len(t, evs, 4)
+
+	assert.Equal(t, EventLeaseRenewed, evs[0].Type)
+	assert.Equal(t, macKnown.String(), evs[0].MAC)
+	assert.Equal(t, EventLeaseAdded, evs[1].Type)
+	assert.Equal(t, macStatic.String(), evs[1].MAC)
+	assert.Equal(t, EventLeaseAdded, evs[2].Type)
+	assert.Equal(t, macNew.String(), evs[2].MAC)
+	assert.Equal(t, EventUnknownDevice, evs[3].Type)
+	assert.Equal(t, macNew.String(), evs[3].MAC)
+
+	evs = e.update([]*dhcpsvc.Lease{renewed, newLease}, now.Add(90*time.Minute))
+	require.Len(t, evs, 2)
+
+	assert.Equal(t, EventLeaseExpired, evs[0].Type)
+	assert.Equal(t, macStatic.String(), evs[0].MAC)
+	assert.Equal(t, EventLeaseExpired, evs[1].Type)
+	assert.Equal(t, macNew.String(), evs[1].MAC)
+}
+
+func TestNewLeaseEvents(t *testing.T) {
+	testCases := []struct {
+		name       string
+		conf       *WebhookConfig
+		wantErrMsg string
+		wantNil    bool
+	}{{
+		name:       "disabled",
+		conf:       &WebhookConfig{},
+		wantErrMsg: "",
+		wantNil:    true,
+	}, {
+		name: "valid",
+		conf: &WebhookConfig{
+			URL:    "https://example.com/hook",
+			Events: []EventType{EventUnknownDevice},
+		},
+		wantErrMsg: "",
+		wantNil:    false,
+	}, {
+		name:       "bad_scheme",
+		conf:       &WebhookConfig{URL: "mqtt://example.com/topic"},
+		wantErrMsg: `webhook: bad url scheme "mqtt"`,
+		wantNil:    true,
+	}, {
+		name: "bad_event",
+		conf: &WebhookConfig{
+			URL:    "https://example.com/hook",
+			Events: []EventType{"lease_stolen"},
+		},
+		wantErrMsg: `webhook: event at index 0: bad type "lease_stolen"`,
+		wantNil:    true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := newLeaseEvents(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.wantNil, e == nil)
+		})
+	}
+}
+
+func TestPostEvent(t *testing.T) {
+	evCh := make(chan *Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get(httphdr.ContentType))
+
+		ev := &Event{}
+		err := json.NewDecoder(r.Body).Decode(ev)
+		assert.NoError(t, err)
+
+		evCh <- ev
+	}))
+	t.Cleanup(srv.Close)
+
+	l := &dhcpsvc.Lease{
+		Expiry:   time.Now().Add(time.Hour),
+		IP:       netip.MustParseAddr("192.168.10.100"),
+		Hostname: "phone",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+	}
+
+	want := newEvent(EventLeaseAdded, l, time.Now())
+	err := postEvent(srv.Client(), srv.URL, want)
+	require.NoError(t, err)
+
+	got, _ := testutil.RequireReceive(t, evCh, time.Second)
+	assert.Equal(t, want, got)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 )
@@ -28,6 +29,13 @@ type v4ServerConfJSON struct {
 	RangeStart    netip.Addr `json:"range_start"`
 	RangeEnd      netip.Addr `json:"range_end"`
 	LeaseDuration uint32     `json:"lease_duration"`
+
+	// InterfaceScopes, if not nil, replace the interface scopes of the server.
+	InterfaceScopes []*V4InterfaceScope `json:"interface_scopes"`
+
+	// LeaseDurations, if not nil, replace the lease durations of certain
+	// clients.
+	LeaseDurations []*V4LeaseDuration `json:"lease_durations"`
 }
 
 func (j *v4ServerConfJSON) toServerConf() *V4ServerConf {
@@ -36,17 +44,22 @@ func (j *v4ServerConfJSON) toServerConf() *V4ServerConf {
 	}
 
 	return &V4ServerConf{
-		GatewayIP:     j.GatewayIP,
-		SubnetMask:    j.SubnetMask,
-		RangeStart:    j.RangeStart,
-		RangeEnd:      j.RangeEnd,
-		LeaseDuration: j.LeaseDuration,
+		GatewayIP:       j.GatewayIP,
+		SubnetMask:      j.SubnetMask,
+		RangeStart:      j.RangeStart,
+		RangeEnd:        j.RangeEnd,
+		LeaseDuration:   j.LeaseDuration,
+		InterfaceScopes: j.InterfaceScopes,
+		LeaseDurations:  j.LeaseDurations,
 	}
 }
 
 type v6ServerConfJSON struct {
-	RangeStart    netip.Addr `json:"range_start"`
-	LeaseDuration uint32     `json:"lease_duration"`
+	RangeStart    netip.Addr       `json:"range_start"`
+	PDPrefix      netip.Prefix     `json:"pd_prefix"`
+	Reservations  []*V6Reservation `json:"reservations"`
+	LeaseDuration uint32           `json:"lease_duration"`
+	PDPrefixLen   int              `json:"pd_prefix_len"`
 }
 
 func v6JSONToServerConf(j *v6ServerConfJSON) V6ServerConf {
@@ -57,6 +70,9 @@ func v6JSONToServerConf(j *v6ServerConfJSON) V6ServerConf {
 	return V6ServerConf{
 		RangeStart:    j.RangeStart.AsSlice(),
 		LeaseDuration: j.LeaseDuration,
+		PDPrefix:      j.PDPrefix,
+		PDPrefixLen:   j.PDPrefixLen,
+		Reservations:  j.Reservations,
 	}
 }
 
@@ -72,9 +88,11 @@ type dhcpStatusResponse struct {
 
 // leaseStatic is the JSON form of static DHCP lease.
 type leaseStatic struct {
-	HWAddr   string     `json:"mac"`
-	IP       netip.Addr `json:"ip"`
-	Hostname string     `json:"hostname"`
+	HWAddr   string       `json:"mac"`
+	IP       netip.Addr   `json:"ip"`
+	Hostname string       `json:"hostname"`
+	Routes   []*routeJSON `json:"routes,omitempty"`
+	Options  []string     `json:"options,omitempty"`
 }
 
 // leasesToStatic converts list of leases to their JSON form.
@@ -86,6 +104,8 @@ func leasesToStatic(leases []*dhcpsvc.Lease) (static []*leaseStatic) {
 			HWAddr:   l.HWAddr.String(),
 			IP:       l.IP,
 			Hostname: l.Hostname,
+			Routes:   routesToJSON(l.Routes),
+			Options:  l.Options,
 		}
 	}
 
@@ -99,20 +119,40 @@ func (l *leaseStatic) toLease() (lease *dhcpsvc.Lease, err error) {
 		return nil, fmt.Errorf("couldn't parse MAC address: %w", err)
 	}
 
+	if (len(l.Routes) > 0 || len(l.Options) > 0) && !l.IP.Is4() {
+		return nil, errors.Error("routes and options are only supported for ipv4 leases")
+	}
+
+	routes, err := routesFromJSON(l.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing routes: %w", err)
+	}
+
+	for i, o := range l.Options {
+		_, _, err = parseDHCPOption(o)
+		if err != nil {
+			return nil, fmt.Errorf("option at index %d: %w", i, err)
+		}
+	}
+
 	return &dhcpsvc.Lease{
 		HWAddr:   addr,
 		IP:       l.IP,
 		Hostname: l.Hostname,
+		Routes:   routes,
+		Options:  l.Options,
 		IsStatic: true,
 	}, nil
 }
 
 // leaseDynamic is the JSON form of dynamic DHCP lease.
 type leaseDynamic struct {
-	HWAddr   string     `json:"mac"`
-	IP       netip.Addr `json:"ip"`
-	Hostname string     `json:"hostname"`
-	Expiry   string     `json:"expires"`
+	HWAddr    string     `json:"mac"`
+	IP        netip.Addr `json:"ip"`
+	Hostname  string     `json:"hostname"`
+	Expiry    string     `json:"expires"`
+	CircuitID string     `json:"circuit_id,omitempty"`
+	RemoteID  string     `json:"remote_id,omitempty"`
 }
 
 // leasesToDynamic converts list of leases to their JSON form.
@@ -128,7 +168,9 @@ func leasesToDynamic(leases []*dhcpsvc.Lease) (dynamic []*leaseDynamic) {
 			// value.
 			//
 			// See https://github.com/AdguardTeam/AdGuardHome/issues/2692.
-			Expiry: l.Expiry.Format(time.RFC3339),
+			Expiry:    l.Expiry.Format(time.RFC3339),
+			CircuitID: l.CircuitID,
+			RemoteID:  l.RemoteID,
 		}
 	}
 
@@ -242,15 +284,28 @@ func (s *server) handleDHCPSetConfigV4(
 
 	// Set the default values for the fields not configurable via web API.
 	c4 := &V4ServerConf{
-		notify:      s.onNotify,
-		ICMPTimeout: s.conf.Conf4.ICMPTimeout,
-		Options:     s.conf.Conf4.Options,
+		notify:               s.onNotify,
+		ICMPTimeout:          s.conf.Conf4.ICMPTimeout,
+		ConflictHoldDuration: s.conf.Conf4.ConflictHoldDuration,
+		Options:              s.conf.Conf4.Options,
 	}
 
 	s.srv4.WriteDiskConfig4(c4)
 	v4Conf.notify = c4.notify
 	v4Conf.ICMPTimeout = c4.ICMPTimeout
+	v4Conf.ConflictHoldDuration = c4.ConflictHoldDuration
 	v4Conf.Options = c4.Options
+	v4Conf.RelayScopes = c4.RelayScopes
+	v4Conf.OptionSets = c4.OptionSets
+	v4Conf.PXE = c4.PXE
+
+	if v4Conf.InterfaceScopes == nil {
+		v4Conf.InterfaceScopes = c4.InterfaceScopes
+	}
+
+	if v4Conf.LeaseDurations == nil {
+		v4Conf.LeaseDurations = c4.LeaseDurations
+	}
 
 	srv4, err := v4Create(v4Conf)
 
@@ -600,6 +655,12 @@ func (s *server) parseLease(r io.Reader) (srv DHCPServer, lease *dhcpsvc.Lease,
 		return nil, nil, fmt.Errorf("decoding json: %w", err)
 	}
 
+	return s.leaseFromJSON(l)
+}
+
+// leaseFromJSON converts l into a lease and returns the server of its address
+// family.  l must not be nil.
+func (s *server) leaseFromJSON(l *leaseStatic) (srv DHCPServer, lease *dhcpsvc.Lease, err error) {
 	if !l.IP.IsValid() {
 		return nil, nil, errors.Error("invalid ip")
 	}
@@ -611,13 +672,16 @@ func (s *server) parseLease(r io.Reader) (srv DHCPServer, lease *dhcpsvc.Lease,
 		return nil, nil, fmt.Errorf("parsing: %w", err)
 	}
 
-	if lease.IP.Is4() {
-		srv = s.srv4
-	} else {
-		srv = s.srv6
+	return s.serverFor(lease.IP), lease, nil
+}
+
+// serverFor returns the server of the address family of ip.
+func (s *server) serverFor(ip netip.Addr) (srv DHCPServer) {
+	if ip.Is4() {
+		return s.srv4
 	}
 
-	return srv, lease, nil
+	return s.srv6
 }
 
 // handleDHCPAddStaticLease is the handler for the POST
@@ -665,6 +729,182 @@ func (s *server) handleDHCPUpdateStaticLease(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// Static leases bulk actions.
+const (
+	bulkActionAdd    = "add"
+	bulkActionUpdate = "update"
+	bulkActionRemove = "remove"
+)
+
+// bulkActions are the operations on the static leases by the bulk actions.
+var bulkActions = map[string]func(srv DHCPServer, l *dhcpsvc.Lease) (err error){
+	bulkActionAdd:    DHCPServer.AddStaticLease,
+	bulkActionUpdate: DHCPServer.UpdateStaticLease,
+	bulkActionRemove: DHCPServer.RemoveStaticLease,
+}
+
+// staticLeasesBulkReq is the request for the POST
+// /control/dhcp/static_leases/bulk HTTP API.
+type staticLeasesBulkReq struct {
+	Action string         `json:"action"`
+	Leases []*leaseStatic `json:"leases"`
+}
+
+// staticLeaseResult is the result of the bulk action on a single static lease.
+type staticLeaseResult struct {
+	HWAddr string     `json:"mac"`
+	IP     netip.Addr `json:"ip"`
+
+	// Error is the error message, if the action has failed for the lease.
+	Error string `json:"error,omitempty"`
+}
+
+// staticLeasesBulkResp is the response for the POST
+// /control/dhcp/static_leases/bulk HTTP API.
+type staticLeasesBulkResp struct {
+	// Results are the results for the leases in the same order as in the
+	// request.
+	Results []*staticLeaseResult `json:"results"`
+}
+
+// handleDHCPStaticLeasesBulk is the handler for the POST
+// /control/dhcp/static_leases/bulk HTTP API.
+func (s *server) handleDHCPStaticLeasesBulk(w http.ResponseWriter, r *http.Request) {
+	req := &staticLeasesBulkReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding json: %s", err)
+
+		return
+	}
+
+	action, ok := bulkActions[req.Action]
+	if !ok {
+		aghhttp.Error(r, w, http.StatusBadRequest, "bad action %q", req.Action)
+
+		return
+	}
+
+	resp := &staticLeasesBulkResp{
+		Results: make([]*staticLeaseResult, 0, len(req.Leases)),
+	}
+
+	for i, l := range req.Leases {
+		if l == nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "lease at index %d: no value", i)
+
+			return
+		}
+
+		res := &staticLeaseResult{
+			HWAddr: l.HWAddr,
+			IP:     l.IP,
+		}
+
+		var srv DHCPServer
+		var lease *dhcpsvc.Lease
+		srv, lease, err = s.leaseFromJSON(l)
+		if err == nil {
+			err = action(srv, lease)
+		}
+
+		if err != nil {
+			res.Error = err.Error()
+		}
+
+		resp.Results = append(resp.Results, res)
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// makeStaticLeaseReq is the request for the POST
+// /control/dhcp/make_static_lease HTTP API.
+type makeStaticLeaseReq struct {
+	IP netip.Addr `json:"ip"`
+}
+
+// handleDHCPMakeStaticLease is the handler for the POST
+// /control/dhcp/make_static_lease HTTP API.  It replaces the dynamic lease for
+// the address with the static one and responds with it.
+func (s *server) handleDHCPMakeStaticLease(w http.ResponseWriter, r *http.Request) {
+	req := &makeStaticLeaseReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding json: %s", err)
+
+		return
+	}
+
+	ip := req.IP.Unmap()
+	leases := s.Leases()
+	idx := slices.IndexFunc(leases, func(l *dhcpsvc.Lease) (ok bool) {
+		return !l.IsStatic && l.IP == ip
+	})
+	if idx == -1 {
+		aghhttp.Error(r, w, http.StatusNotFound, "no dynamic lease for %s", ip)
+
+		return
+	}
+
+	dyn := leases[idx]
+	lease := &dhcpsvc.Lease{
+		HWAddr:   dyn.HWAddr,
+		IP:       dyn.IP,
+		Hostname: dyn.Hostname,
+		IsStatic: true,
+	}
+
+	err = s.serverFor(ip).AddStaticLease(lease)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, leasesToStatic([]*dhcpsvc.Lease{lease})[0])
+}
+
+// addrConflictJSON is the JSON form of an address conflict.
+type addrConflictJSON struct {
+	IP     netip.Addr     `json:"ip"`
+	HWAddr string         `json:"mac,omitempty"`
+	Source ConflictSource `json:"source"`
+	Time   string         `json:"time"`
+	Until  string         `json:"until"`
+}
+
+// conflictsResp is the response for the GET /control/dhcp/conflicts HTTP API.
+type conflictsResp struct {
+	Conflicts []*addrConflictJSON `json:"conflicts"`
+}
+
+// handleDHCPConflicts is the handler for the GET /control/dhcp/conflicts HTTP
+// API.
+func (s *server) handleDHCPConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts := s.srv4.Conflicts()
+	resp := &conflictsResp{
+		Conflicts: make([]*addrConflictJSON, 0, len(conflicts)),
+	}
+
+	for _, c := range conflicts {
+		cj := &addrConflictJSON{
+			IP:     c.IP,
+			Source: c.Source,
+			Time:   c.Time.Format(time.RFC3339),
+			Until:  c.Until.Format(time.RFC3339),
+		}
+
+		if c.MAC != nil {
+			cj.HWAddr = c.MAC.String()
+		}
+
+		resp.Conflicts = append(resp.Conflicts, cj)
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
 func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
 	err := s.Stop()
 	if err != nil {
@@ -715,6 +955,57 @@ func (s *server) handleResetLeases(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleDHCPLeasesExport is the handler for the GET /control/dhcp/leases/export
+// HTTP API.  It writes the IPv4 leases in the format from the format query
+// parameter.
+func (s *server) handleDHCPLeasesExport(w http.ResponseWriter, r *http.Request) {
+	f := leasesFormat(r.URL.Query().Get("format"))
+	err := f.validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, aghhttp.HdrValTextPlain)
+	h.Set(httphdr.ContentDisposition, fmt.Sprintf("attachment; filename=%q", f.filename()))
+
+	err = f.writeLeases(w, s.srv4.GetLeases(LeasesAll))
+	if err != nil {
+		log.Debug("dhcp: exporting leases: %s", err)
+	}
+}
+
+// handleDHCPLeasesImport is the handler for the POST
+// /control/dhcp/leases/import HTTP API.  It adds the IPv4 leases from the file
+// in the request body, which format is set by the format query parameter.
+func (s *server) handleDHCPLeasesImport(w http.ResponseWriter, r *http.Request) {
+	f := leasesFormat(r.URL.Query().Get("format"))
+	err := f.validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: %s", err)
+
+		return
+	}
+
+	leases, err := f.parseLeases(r.Body)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing leases: %s", err)
+
+		return
+	}
+
+	resp, err := s.importLeases(leases)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "importing leases: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
 func (s *server) registerHandlers() {
 	if s.conf.HTTPRegister == nil {
 		return
@@ -727,6 +1018,11 @@ func (s *server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/add_static_lease", s.handleDHCPAddStaticLease)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/remove_static_lease", s.handleDHCPRemoveStaticLease)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/update_static_lease", s.handleDHCPUpdateStaticLease)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/static_leases/bulk", s.handleDHCPStaticLeasesBulk)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/make_static_lease", s.handleDHCPMakeStaticLease)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/conflicts", s.handleDHCPConflicts)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset", s.handleReset)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset_leases", s.handleResetLeases)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/leases/export", s.handleDHCPLeasesExport)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/leases/import", s.handleDHCPLeasesImport)
 }
@@ -5,11 +5,14 @@ package dhcpd
 import (
 	"bytes"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
 	"testing"
+	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -317,3 +320,150 @@ func TestServer_HandleUpdateStaticLease_validation(t *testing.T) {
 		})
 	}
 }
+
+// postJSON is a helper that calls handler with v encoded as the request body
+// and returns the response recorder.
+func postJSON(t *testing.T, v any, handler http.HandlerFunc) (w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	b := &bytes.Buffer{}
+	err := json.NewEncoder(b).Encode(v)
+	require.NoError(t, err)
+
+	r, err := http.NewRequest(http.MethodPost, "", b)
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
+
+func TestServer_handleDHCPStaticLeasesBulk(t *testing.T) {
+	s, err := Create(&ServerConfig{
+		Enabled:        true,
+		Conf4:          *defaultV4ServerConf(),
+		Conf6:          V6ServerConf{},
+		DataDir:        t.TempDir(),
+		ConfigModified: func() {},
+	})
+	require.NoError(t, err)
+
+	leases := []*leaseStatic{{
+		HWAddr:   "44:44:44:44:44:44",
+		IP:       netip.MustParseAddr("192.168.10.10"),
+		Hostname: "client-1",
+	}, {
+		HWAddr:   "55:55:55:55:55:55",
+		IP:       netip.MustParseAddr("192.168.10.20"),
+		Hostname: "client-2",
+	}, {
+		HWAddr:   "66:66:66:66:66:66",
+		IP:       netip.MustParseAddr("192.168.10.10"),
+		Hostname: "client-3",
+	}}
+
+	testCases := []struct {
+		req       *staticLeasesBulkReq
+		name      string
+		wantErrs  []bool
+		wantCode  int
+		wantTotal int
+	}{{
+		req: &staticLeasesBulkReq{
+			Action: bulkActionAdd,
+			Leases: leases,
+		},
+		name:      "add",
+		wantErrs:  []bool{false, false, true},
+		wantCode:  http.StatusOK,
+		wantTotal: 2,
+	}, {
+		req: &staticLeasesBulkReq{
+			Action: bulkActionRemove,
+			Leases: leases[:1],
+		},
+		name:      "remove",
+		wantErrs:  []bool{false},
+		wantCode:  http.StatusOK,
+		wantTotal: 1,
+	}, {
+		req: &staticLeasesBulkReq{
+			Action: "replace",
+			Leases: leases,
+		},
+		name:      "bad_action",
+		wantErrs:  nil,
+		wantCode:  http.StatusBadRequest,
+		wantTotal: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := postJSON(t, tc.req, s.handleDHCPStaticLeasesBulk)
+			require.Equal(t, tc.wantCode, w.Code)
+
+			assert.Len(t, s.srv4.GetLeases(LeasesStatic), tc.wantTotal)
+
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+
+			resp := &staticLeasesBulkResp{}
+			err = json.NewDecoder(w.Body).Decode(resp)
+			require.NoError(t, err)
+			require.Len(t, resp.Results, len(tc.wantErrs))
+
+			for i, res := range resp.Results {
+				assert.Equal(t, tc.req.Leases[i].HWAddr, res.HWAddr)
+				assert.Equal(t, tc.wantErrs[i], res.Error != "")
+			}
+		})
+	}
+}
+
+func TestServer_handleDHCPMakeStaticLease(t *testing.T) {
+	s, err := Create(&ServerConfig{
+		Enabled:        true,
+		Conf4:          *defaultV4ServerConf(),
+		Conf6:          V6ServerConf{},
+		DataDir:        t.TempDir(),
+		ConfigModified: func() {},
+	})
+	require.NoError(t, err)
+
+	ip := netip.MustParseAddr("192.168.10.150")
+	err = s.srv4.ResetLeases([]*dhcpsvc.Lease{{
+		Expiry:   time.Now().Add(time.Hour),
+		Hostname: "dynamic-client",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		IP:       ip,
+	}})
+	require.NoError(t, err)
+
+	t.Run("not_found", func(t *testing.T) {
+		w := postJSON(t, &makeStaticLeaseReq{
+			IP: netip.MustParseAddr("192.168.10.151"),
+		}, s.handleDHCPMakeStaticLease)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		w := postJSON(t, &makeStaticLeaseReq{IP: ip}, s.handleDHCPMakeStaticLease)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		want := &leaseStatic{
+			HWAddr:   "aa:aa:aa:aa:aa:aa",
+			IP:       ip,
+			Hostname: "dynamic-client",
+		}
+
+		got := &leaseStatic{}
+		err = json.NewDecoder(w.Body).Decode(got)
+		require.NoError(t, err)
+
+		assert.Equal(t, want, got)
+		assert.Empty(t, s.srv4.GetLeases(LeasesDynamic))
+		assert.Len(t, s.srv4.GetLeases(LeasesStatic), 1)
+	})
+}
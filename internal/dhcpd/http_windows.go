@@ -44,6 +44,11 @@ func (s *server) registerHandlers() {
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/add_static_lease", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/remove_static_lease", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/update_static_lease", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/static_leases/bulk", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/make_static_lease", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/conflicts", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset", s.notImplemented)
 	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/reset_leases", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dhcp/leases/export", s.notImplemented)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dhcp/leases/import", s.notImplemented)
 }
@@ -0,0 +1,598 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// leasesFormat is the format of the lease files of other DHCP servers.
+type leasesFormat string
+
+// Supported leasesFormat values.
+const (
+	// leasesFormatDnsmasq is the format of the dnsmasq.leases file.  The
+	// static leases are the dhcp-host lines of the dnsmasq.conf file.
+	leasesFormatDnsmasq leasesFormat = "dnsmasq"
+
+	// leasesFormatISC is the format of the dhcpd.leases file of the ISC DHCP
+	// server.  The static leases are the host declarations of the dhcpd.conf
+	// file.
+	leasesFormatISC leasesFormat = "isc"
+)
+
+// validate returns an error if f is not a supported format.
+func (f leasesFormat) validate() (err error) {
+	switch f {
+	case leasesFormatDnsmasq, leasesFormatISC:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q", f)
+	}
+}
+
+// filename returns the conventional name of the lease file in the format f.
+func (f leasesFormat) filename() (name string) {
+	if f == leasesFormatISC {
+		return "dhcpd.leases"
+	}
+
+	return "dnsmasq.leases"
+}
+
+// parseLeases parses the leases in the format f from r.  Only the IPv4 leases
+// are parsed, since the IPv6 ones of these servers aren't bound to the hardware
+// addresses.
+func (f leasesFormat) parseLeases(r io.Reader) (leases []*dhcpsvc.Lease, err error) {
+	if f == leasesFormatISC {
+		return parseISCLeases(r)
+	}
+
+	return parseDnsmasqLeases(r)
+}
+
+// writeLeases writes leases to w in the format f.
+func (f leasesFormat) writeLeases(w io.Writer, leases []*dhcpsvc.Lease) (err error) {
+	if f == leasesFormatISC {
+		return writeISCLeases(w, leases)
+	}
+
+	return writeDnsmasqLeases(w, leases)
+}
+
+// dnsmasqHostPrefix is the prefix of the dnsmasq.conf lines with the static
+// leases.
+const dnsmasqHostPrefix = "dhcp-host="
+
+// parseDnsmasqLeases parses the lines of the dnsmasq.leases file and the
+// dhcp-host lines of the dnsmasq.conf file from r.  The leases that never
+// expire are considered static.
+func parseDnsmasqLeases(r io.Reader) (leases []*dhcpsvc.Lease, err error) {
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || strings.HasPrefix(line, "duid ") {
+			continue
+		}
+
+		var l *dhcpsvc.Lease
+		if hostLine, ok := strings.CutPrefix(line, dnsmasqHostPrefix); ok {
+			l, err = parseDnsmasqHost(hostLine)
+		} else {
+			l, err = parseDnsmasqLease(line)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		} else if l != nil {
+			leases = append(leases, l)
+		}
+	}
+
+	return leases, s.Err()
+}
+
+// parseDnsmasqLease parses a line of the dnsmasq.leases file.  l is nil if the
+// line describes an IPv6 lease.
+func parseDnsmasqLease(line string) (l *dhcpsvc.Lease, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("want at least 4 fields, got %d", len(fields))
+	}
+
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("ip: %w", err)
+	} else if !ip.Is4() {
+		return nil, nil
+	}
+
+	expiry, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expiry: %w", err)
+	}
+
+	mac, err := net.ParseMAC(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("mac: %w", err)
+	}
+
+	l = &dhcpsvc.Lease{
+		IP:     ip,
+		HWAddr: mac,
+	}
+
+	if host := fields[3]; host != "*" {
+		l.Hostname = host
+	}
+
+	if expiry == 0 {
+		l.IsStatic = true
+	} else {
+		l.Expiry = time.Unix(expiry, 0)
+	}
+
+	return l, nil
+}
+
+// parseDnsmasqHost parses the value of a dhcp-host line of the dnsmasq.conf
+// file, for example:
+//
+//	aa:bb:cc:dd:ee:ff,192.168.1.10,printer,infinite
+//
+// l is nil if the line describes no IPv4 lease bound to a hardware address.
+func parseDnsmasqHost(val string) (l *dhcpsvc.Lease, err error) {
+	l = &dhcpsvc.Lease{
+		IsStatic: true,
+	}
+
+	for _, f := range strings.Split(val, ",") {
+		f = strings.TrimSpace(f)
+
+		if mac, macErr := net.ParseMAC(f); macErr == nil {
+			l.HWAddr = mac
+		} else if ip, ipErr := netip.ParseAddr(f); ipErr == nil {
+			l.IP = ip
+		} else if isDnsmasqHostHostname(f) {
+			l.Hostname = f
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.Is4() {
+		return nil, nil
+	}
+
+	return l, nil
+}
+
+// isDnsmasqHostHostname returns true if f is the hostname field of a dhcp-host
+// line, as opposed to a tag, a client ID, or a lease time.
+func isDnsmasqHostHostname(f string) (ok bool) {
+	if f == "" || f == "infinite" || f == "ignore" || strings.ContainsRune(f, ':') {
+		return false
+	}
+
+	// Lease times are numbers optionally followed by a unit, like "45m".
+	num := strings.TrimRight(f, "mhdw")
+	if len(f)-len(num) > 1 {
+		return true
+	}
+
+	_, err := strconv.ParseUint(num, 10, 32)
+
+	return err != nil
+}
+
+// writeDnsmasqLeases writes the dynamic leases as the lines of the
+// dnsmasq.leases file and the static ones as the dhcp-host lines of the
+// dnsmasq.conf file.
+func writeDnsmasqLeases(w io.Writer, leases []*dhcpsvc.Lease) (err error) {
+	bw := bufio.NewWriter(w)
+	for _, l := range leases {
+		if l.IsStatic {
+			_, _ = fmt.Fprintf(bw, "%s%s,%s", dnsmasqHostPrefix, l.HWAddr, l.IP)
+			if l.Hostname != "" {
+				_, _ = fmt.Fprintf(bw, ",%s", l.Hostname)
+			}
+
+			_, _ = bw.WriteString("\n")
+
+			continue
+		}
+
+		host := l.Hostname
+		if host == "" {
+			host = "*"
+		}
+
+		_, _ = fmt.Fprintf(bw, "%d %s %s %s *\n", l.Expiry.Unix(), l.HWAddr, l.IP, host)
+	}
+
+	return bw.Flush()
+}
+
+// iscTimeLayout is the layout of the times in the dhcpd.leases file, which are
+// always in UTC.  The day of the week is written before it.
+const iscTimeLayout = "2006/01/02 15:04:05"
+
+// iscDecl is a declaration of the ISC DHCP server configuration or lease
+// file, for example a lease or a host.
+type iscDecl struct {
+	// kind is the kind of the declaration, for example "lease".
+	kind string
+
+	// name is the argument of the declaration, for example the leased address.
+	name string
+
+	// stmts are the statements of the declaration body as lists of tokens.
+	stmts [][]string
+}
+
+// parseISCLeases parses the lease declarations of the dhcpd.leases file and
+// the host declarations of the dhcpd.conf file from r.  Only the active leases
+// are parsed and the later declarations for the same address override the
+// earlier ones, as the ISC DHCP server does.
+func parseISCLeases(r io.Reader) (leases []*dhcpsvc.Lease, err error) {
+	decls, err := parseISCDecls(r)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	byIP := map[netip.Addr]int{}
+	for _, d := range decls {
+		var l *dhcpsvc.Lease
+		switch d.kind {
+		case "lease":
+			l, err = d.toLease()
+		case "host":
+			l, err = d.toStaticLease()
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", d.kind, d.name, err)
+		} else if l == nil {
+			if d.kind == "lease" {
+				// Forget the address that is no longer leased.  The name is
+				// already validated by the conversion.
+				if i, ok := byIP[netip.MustParseAddr(d.name)]; ok {
+					leases[i] = nil
+				}
+			}
+
+			continue
+		}
+
+		if i, ok := byIP[l.IP]; ok {
+			leases[i] = l
+		} else {
+			byIP[l.IP] = len(leases)
+			leases = append(leases, l)
+		}
+	}
+
+	return slices.DeleteFunc(leases, func(l *dhcpsvc.Lease) (ok bool) { return l == nil }), nil
+}
+
+// toLease converts the lease declaration d into a dynamic lease.  l is nil if
+// the lease isn't active.
+func (d *iscDecl) toLease() (l *dhcpsvc.Lease, err error) {
+	ip, err := netip.ParseAddr(d.name)
+	if err != nil {
+		return nil, fmt.Errorf("ip: %w", err)
+	}
+
+	l = &dhcpsvc.Lease{
+		IP: ip,
+	}
+
+	for _, st := range d.stmts {
+		switch {
+		case len(st) == 3 && st[0] == "binding" && st[1] == "state":
+			if st[2] != "active" {
+				return nil, nil
+			}
+		case len(st) == 3 && st[0] == "hardware":
+			l.HWAddr, err = net.ParseMAC(st[2])
+		case len(st) == 2 && st[0] == "client-hostname":
+			l.Hostname = st[1]
+		case len(st) > 1 && st[0] == "ends":
+			l.Expiry, err = parseISCTime(st[1:])
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", st[0], err)
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.Is4() {
+		return nil, nil
+	}
+
+	return l, nil
+}
+
+// parseISCTime parses the time from the arguments of an ISC lease statement,
+// for example:
+//
+//	4 2024/01/04 15:04:05
+//	epoch 1704380645
+//	never
+func parseISCTime(args []string) (t time.Time, err error) {
+	switch {
+	case len(args) == 1 && args[0] == "never":
+		// Import the leases that never expire as the ones lasting for a year.
+		return time.Now().AddDate(1, 0, 0), nil
+	case len(args) == 2 && args[0] == "epoch":
+		var sec int64
+		sec, err = strconv.ParseInt(args[1], 10, 64)
+
+		return time.Unix(sec, 0), err
+	case len(args) == 3:
+		return time.Parse(iscTimeLayout, args[1]+" "+args[2])
+	default:
+		return time.Time{}, fmt.Errorf("bad time %q", strings.Join(args, " "))
+	}
+}
+
+// toStaticLease converts the host declaration d into a static lease.  l is nil
+// if the host has no hardware or fixed IPv4 address.
+func (d *iscDecl) toStaticLease() (l *dhcpsvc.Lease, err error) {
+	l = &dhcpsvc.Lease{
+		Hostname: d.name,
+		IsStatic: true,
+	}
+
+	for _, st := range d.stmts {
+		switch {
+		case len(st) == 3 && st[0] == "hardware":
+			l.HWAddr, err = net.ParseMAC(st[2])
+		case len(st) == 2 && st[0] == "fixed-address":
+			// Ignore the errors, since the fixed address may also be a
+			// hostname or a list of addresses.
+			l.IP, _ = netip.ParseAddr(st[1])
+		case len(st) == 3 && st[0] == "option" && st[1] == "host-name":
+			l.Hostname = st[2]
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", st[0], err)
+		}
+	}
+
+	if l.HWAddr == nil || !l.IP.Is4() {
+		return nil, nil
+	}
+
+	return l, nil
+}
+
+// parseISCDecls parses the top-level declarations from r.  The statements of
+// the nested declarations are added to the enclosing top-level one.
+func parseISCDecls(r io.Reader) (decls []*iscDecl, err error) {
+	tokens, err := tokenizeISC(r)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	var (
+		cur   *iscDecl
+		stmt  []string
+		depth int
+	)
+
+	for _, tok := range tokens {
+		switch tok {
+		case "{":
+			if depth == 0 {
+				cur = &iscDecl{}
+				if len(stmt) > 0 {
+					cur.kind = stmt[0]
+				}
+
+				if len(stmt) > 1 {
+					cur.name = stmt[1]
+				}
+
+				decls = append(decls, cur)
+			}
+
+			depth++
+			stmt = nil
+		case "}":
+			if depth == 0 {
+				return nil, errors.Error("unexpected closing brace")
+			}
+
+			depth--
+			stmt = nil
+		case ";":
+			if cur != nil && depth > 0 && len(stmt) > 0 {
+				cur.stmts = append(cur.stmts, stmt)
+			}
+
+			stmt = nil
+		default:
+			stmt = append(stmt, tok)
+		}
+	}
+
+	if depth != 0 {
+		return nil, errors.Error("unclosed declaration")
+	}
+
+	return decls, nil
+}
+
+// tokenizeISC splits the contents of an ISC DHCP server file into tokens.  The
+// braces and semicolons are separate tokens, the quoted strings are unquoted,
+// and the comments are skipped.
+func tokenizeISC(r io.Reader) (tokens []string, err error) {
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := s.Text()
+		for line != "" {
+			switch c := line[0]; {
+			case c == '#':
+				line = ""
+			case c == '{' || c == '}' || c == ';':
+				tokens = append(tokens, line[:1])
+				line = line[1:]
+			case c == '"':
+				end := strings.IndexByte(line[1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("line %d: unterminated string", lineNum)
+				}
+
+				tokens = append(tokens, line[1:end+1])
+				line = line[end+2:]
+			case unicode.IsSpace(rune(c)):
+				line = line[1:]
+			default:
+				end := strings.IndexFunc(line, func(r rune) (ok bool) {
+					return unicode.IsSpace(r) || strings.ContainsRune(`{};"#`, r)
+				})
+				if end < 0 {
+					end = len(line)
+				}
+
+				tokens = append(tokens, line[:end])
+				line = line[end:]
+			}
+		}
+	}
+
+	return tokens, s.Err()
+}
+
+// writeISCLeases writes the dynamic leases as the lease declarations of the
+// dhcpd.leases file and the static ones as the host declarations of the
+// dhcpd.conf file.
+func writeISCLeases(w io.Writer, leases []*dhcpsvc.Lease) (err error) {
+	bw := bufio.NewWriter(w)
+	for _, l := range leases {
+		if l.IsStatic {
+			name := l.Hostname
+			if name == "" {
+				name = strings.ReplaceAll(l.HWAddr.String(), ":", "-")
+			}
+
+			_, _ = fmt.Fprintf(
+				bw,
+				"host %s {\n  hardware ethernet %s;\n  fixed-address %s;\n}\n",
+				name,
+				l.HWAddr,
+				l.IP,
+			)
+
+			continue
+		}
+
+		ends := l.Expiry.UTC()
+		_, _ = fmt.Fprintf(
+			bw,
+			"lease %s {\n  ends %d %s;\n  binding state active;\n  hardware ethernet %s;\n",
+			l.IP,
+			ends.Weekday(),
+			ends.Format(iscTimeLayout),
+			l.HWAddr,
+		)
+
+		if l.Hostname != "" {
+			_, _ = fmt.Fprintf(bw, "  client-hostname %q;\n", l.Hostname)
+		}
+
+		_, _ = bw.WriteString("}\n")
+	}
+
+	return bw.Flush()
+}
+
+// leasesImportResp is the response to the POST /control/dhcp/leases/import
+// HTTP API.
+type leasesImportResp struct {
+	// Skipped are the descriptions of the leases which haven't been imported
+	// and the reasons why.
+	Skipped []string `json:"skipped"`
+
+	// Static is the number of the imported static leases.
+	Static int `json:"static"`
+
+	// Dynamic is the number of the imported dynamic leases.
+	Dynamic int `json:"dynamic"`
+}
+
+// importLeases adds the IPv4 leases which hardware and IP addresses aren't
+// leased yet.  The expired dynamic leases are skipped.
+func (s *server) importLeases(leases []*dhcpsvc.Lease) (resp *leasesImportResp, err error) {
+	resp = &leasesImportResp{
+		Skipped: []string{},
+	}
+
+	macs := map[string]struct{}{}
+	ips := map[netip.Addr]struct{}{}
+	for _, l := range s.srv4.GetLeases(LeasesAll) {
+		macs[l.HWAddr.String()] = struct{}{}
+		ips[l.IP] = struct{}{}
+	}
+
+	var dynamic []*dhcpsvc.Lease
+	now := time.Now()
+	for _, l := range leases {
+		var reason string
+		if _, ok := macs[l.HWAddr.String()]; ok {
+			reason = "hardware address is already leased"
+		} else if _, ok = ips[l.IP]; ok {
+			reason = "ip is already leased"
+		} else if !l.IsStatic && l.Expiry.Before(now) {
+			reason = "lease is expired"
+		} else if !l.IsStatic {
+			dynamic = append(dynamic, l)
+		} else if addErr := s.srv4.AddStaticLease(l); addErr != nil {
+			reason = addErr.Error()
+		} else {
+			resp.Static++
+		}
+
+		if reason != "" {
+			resp.Skipped = append(resp.Skipped, fmt.Sprintf("%s (%s): %s", l.IP, l.HWAddr, reason))
+
+			continue
+		}
+
+		macs[l.HWAddr.String()] = struct{}{}
+		ips[l.IP] = struct{}{}
+	}
+
+	if len(dynamic) == 0 {
+		return resp, nil
+	}
+
+	before := len(s.srv4.GetLeases(LeasesDynamic))
+	err = s.srv4.ResetLeases(append(s.srv4.GetLeases(LeasesAll), dynamic...))
+	if err != nil {
+		return nil, fmt.Errorf("adding dynamic leases: %w", err)
+	}
+
+	resp.Dynamic = len(s.srv4.GetLeases(LeasesDynamic)) - before
+	if n := len(dynamic) - resp.Dynamic; n > 0 {
+		resp.Skipped = append(resp.Skipped, fmt.Sprintf("%d dynamic leases: rejected by server", n))
+	}
+
+	return resp, s.dbStore()
+}
@@ -0,0 +1,179 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeasesFormat_parseLeases(t *testing.T) {
+	mac1 := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	mac2 := net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+
+	wantLeases := []*dhcpsvc.Lease{{
+		Expiry:   time.Unix(1_704_380_645, 0),
+		IP:       netip.MustParseAddr("192.168.1.10"),
+		Hostname: "laptop",
+		HWAddr:   mac1,
+	}, {
+		IP:       netip.MustParseAddr("192.168.1.20"),
+		Hostname: "printer",
+		HWAddr:   mac2,
+		IsStatic: true,
+	}}
+
+	testCases := []struct {
+		name       string
+		in         string
+		wantErrMsg string
+		format     leasesFormat
+	}{{
+		name: "dnsmasq",
+		in: "# comment\n" +
+			"1704380645 aa:aa:aa:aa:aa:aa 192.168.1.10 laptop 01:aa:aa:aa:aa:aa:aa\n" +
+			"duid 00:01:00:01:2b:2c:2d:2e:aa:aa:aa:aa:aa:aa\n" +
+			"1704380645 12345678 2001:db8::10 laptop6 00:01:00:01\n" +
+			"dhcp-host=bb:bb:bb:bb:bb:bb,set:lab,192.168.1.20,printer,infinite\n",
+		wantErrMsg: "",
+		format:     leasesFormatDnsmasq,
+	}, {
+		name:       "dnsmasq_bad",
+		in:         "1704380645 aa:aa:aa:aa:aa:aa 192.168.1.10\n",
+		wantErrMsg: "line 1: want at least 4 fields, got 3",
+		format:     leasesFormatDnsmasq,
+	}, {
+		name: "isc",
+		in: `# The format of this file is documented in the dhcpd.leases(5) manual page.
+authoring-byte-order little-endian;
+
+lease 192.168.1.10 {
+  starts 4 2024/01/04 14:04:05;
+  ends epoch 1704380645; # Thu Jan 04 15:04:05 2024
+  binding state active;
+  hardware ethernet aa:aa:aa:aa:aa:aa;
+  client-hostname "laptop";
+}
+lease 192.168.1.30 {
+  ends 4 2024/01/04 15:04:05;
+  binding state active;
+  hardware ethernet cc:cc:cc:cc:cc:cc;
+}
+lease 192.168.1.30 {
+  ends 4 2024/01/04 15:04:05;
+  binding state free;
+  hardware ethernet cc:cc:cc:cc:cc:cc;
+}
+subnet 192.168.1.0 netmask 255.255.255.0 {
+  host printer {
+    hardware ethernet bb:bb:bb:bb:bb:bb;
+    fixed-address 192.168.1.20;
+  }
+}
+host printer {
+  hardware ethernet bb:bb:bb:bb:bb:bb;
+  fixed-address 192.168.1.20;
+}
+`,
+		wantErrMsg: "",
+		format:     leasesFormatISC,
+	}, {
+		name:       "isc_bad",
+		in:         "lease 192.168.1.10 {\n  ends 4 2024/01/04;\n}\n",
+		wantErrMsg: `lease 192.168.1.10: ends: bad time "4 2024/01/04"`,
+		format:     leasesFormatISC,
+	}, {
+		name:       "isc_unclosed",
+		in:         "lease 192.168.1.10 {\n",
+		wantErrMsg: "unclosed declaration",
+		format:     leasesFormatISC,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			leases, err := tc.format.parseLeases(strings.NewReader(tc.in))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+			if tc.wantErrMsg != "" {
+				return
+			}
+
+			require.Len(t, leases, len(wantLeases))
+
+			for i, l := range leases {
+				want := wantLeases[i]
+				assert.Equal(t, want.IP, l.IP)
+				assert.Equal(t, want.Hostname, l.Hostname)
+				assert.Equal(t, want.HWAddr, l.HWAddr)
+				assert.Equal(t, want.IsStatic, l.IsStatic)
+				assert.True(t, want.Expiry.Equal(l.Expiry))
+			}
+		})
+	}
+}
+
+func TestLeasesFormat_writeLeases(t *testing.T) {
+	leases := []*dhcpsvc.Lease{{
+		Expiry:   time.Unix(1_704_380_645, 0),
+		IP:       netip.MustParseAddr("192.168.1.10"),
+		Hostname: "laptop",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+	}, {
+		IP:       netip.MustParseAddr("192.168.1.20"),
+		HWAddr:   net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		IsStatic: true,
+	}}
+
+	testCases := []struct {
+		name   string
+		want   string
+		format leasesFormat
+	}{{
+		name: "dnsmasq",
+		want: "1704380645 aa:aa:aa:aa:aa:aa 192.168.1.10 laptop *\n" +
+			"dhcp-host=bb:bb:bb:bb:bb:bb,192.168.1.20\n",
+		format: leasesFormatDnsmasq,
+	}, {
+		name: "isc",
+		want: `lease 192.168.1.10 {
+  ends 4 2024/01/04 15:04:05;
+  binding state active;
+  hardware ethernet aa:aa:aa:aa:aa:aa;
+  client-hostname "laptop";
+}
+host bb-bb-bb-bb-bb-bb {
+  hardware ethernet bb:bb:bb:bb:bb:bb;
+  fixed-address 192.168.1.20;
+}
+`,
+		format: leasesFormatISC,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := tc.format.writeLeases(buf, leases)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, buf.String())
+
+			parsed, err := tc.format.parseLeases(buf)
+			require.NoError(t, err)
+			require.Len(t, parsed, len(leases))
+
+			for i, l := range parsed {
+				assert.Equal(t, leases[i].IP, l.IP)
+				assert.Equal(t, leases[i].HWAddr, l.HWAddr)
+				assert.Equal(t, leases[i].IsStatic, l.IsStatic)
+			}
+		})
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -18,20 +21,23 @@ import (
 )
 
 // The aliases for DHCP option types available for explicit declaration.
-//
-// TODO(e.burkov):  Add an option for classless routes.
 const (
-	typDel  = "del"
-	typBool = "bool"
-	typDur  = "dur"
-	typHex  = "hex"
-	typIP   = "ip"
-	typIPs  = "ips"
-	typText = "text"
-	typU8   = "u8"
-	typU16  = "u16"
+	typDel    = "del"
+	typBool   = "bool"
+	typDur    = "dur"
+	typHex    = "hex"
+	typIP     = "ip"
+	typIPs    = "ips"
+	typRoutes = "routes"
+	typText   = "text"
+	typU8     = "u8"
+	typU16    = "u16"
 )
 
+// optionMSClasslessStaticRoute is the code of the Microsoft Classless Static
+// Route option, which has the same format as the Classless Static Route one.
+const optionMSClasslessStaticRoute = dhcpv4.GenericOptionCode(249)
+
 // parseDHCPOptionHex parses a DHCP option as a hex-encoded string.
 func parseDHCPOptionHex(s string) (val dhcpv4.OptionValue, err error) {
 	var data []byte
@@ -75,6 +81,60 @@ func parseDHCPOptionIPs(s string) (val dhcpv4.OptionValue, err error) {
 	return ips, nil
 }
 
+// parseDHCPOptionRoutes parses a DHCP option as a comma-separated list of
+// classless static routes, each being a destination network and a router
+// separated by a space.
+func parseDHCPOptionRoutes(s string) (val dhcpv4.OptionValue, err error) {
+	var routes dhcpv4.Routes
+	for i, routeStr := range strings.Split(s, ",") {
+		var r dhcpsvc.Route
+		r, err = parseDHCPRoute(routeStr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing route at index %d: %w", i, err)
+		}
+
+		routes = append(routes, toDHCPv4Route(r))
+	}
+
+	return routes, nil
+}
+
+// parseDHCPRoute parses a single classless static route from a destination
+// network and a router separated by a space.
+func parseDHCPRoute(s string) (r dhcpsvc.Route, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return r, fmt.Errorf("bad route %q", s)
+	}
+
+	r.Dest, err = netip.ParsePrefix(fields[0])
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return r, err
+	}
+
+	r.Router, err = netip.ParseAddr(fields[1])
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return r, err
+	}
+
+	r.Dest = r.Dest.Masked()
+
+	return r, validateRoute(r)
+}
+
+// toDHCPv4Route converts a valid classless static route to the DHCPv4 one.
+func toDHCPv4Route(r dhcpsvc.Route) (dr *dhcpv4.Route) {
+	return &dhcpv4.Route{
+		Dest: &net.IPNet{
+			IP:   r.Dest.Addr().AsSlice(),
+			Mask: net.CIDRMask(r.Dest.Bits(), netutil.IPv4BitLen),
+		},
+		Router: r.Router.AsSlice(),
+	}
+}
+
 // parseDHCPOptionDur parses a DHCP option as a duration in a human-readable
 // form.
 func parseDHCPOptionDur(s string) (val dhcpv4.OptionValue, err error) {
@@ -138,6 +198,8 @@ func parseDHCPOptionVal(typ, valStr string) (val dhcpv4.OptionValue, err error)
 		val, err = parseDHCPOptionIP(valStr)
 	case typIPs:
 		val, err = parseDHCPOptionIPs(valStr)
+	case typRoutes:
+		val, err = parseDHCPOptionRoutes(valStr)
 	case typText:
 		val = dhcpv4.String(valStr)
 	case typU8:
@@ -163,6 +225,7 @@ func parseDHCPOptionVal(typ, valStr string) (val dhcpv4.OptionValue, err error)
 //   - 7  text http://192.168.1.1/wpad.dat
 //   - 8  u8   255
 //   - 9  u16  65535
+//   - 121 routes 10.0.0.0/8 192.168.1.2,0.0.0.0/0 192.168.1.1
 func parseDHCPOption(s string) (code dhcpv4.OptionCode, val dhcpv4.OptionValue, err error) {
 	defer func() { err = errors.Annotate(err, "invalid option string %q: %w", s) }()
 
@@ -395,4 +458,67 @@ func (s *v4Server) prepareOptions() {
 	if len(s.explicitOpts) == 0 {
 		s.explicitOpts = nil
 	}
+
+	s.optionSets = newOptionSets(s.conf.OptionSets)
+}
+
+// v4OptionSet is a set of options sent to the clients of a certain class.
+type v4OptionSet struct {
+	// opts are the parsed options of the set.
+	opts dhcpv4.Options
+
+	// vendorClass is the prefix of the Vendor Class Identifier of the matching
+	// clients, if not empty.
+	vendorClass string
+
+	// userClass is the User Class of the matching clients, if not empty.
+	userClass string
+}
+
+// newOptionSets parses the option sets from the configuration.  The invalid
+// sets and options are logged and skipped, the same as the options of the
+// server.
+func newOptionSets(confSets []*V4OptionSet) (sets []*v4OptionSet) {
+	for i, cs := range confSets {
+		if cs == nil || (cs.VendorClass == "" && cs.UserClass == "") {
+			log.Error("dhcpv4: option set at index %d: no vendor or user class", i)
+
+			continue
+		}
+
+		set := &v4OptionSet{
+			opts:        dhcpv4.Options{},
+			vendorClass: cs.VendorClass,
+			userClass:   cs.UserClass,
+		}
+
+		for j, o := range cs.Options {
+			code, val, err := parseDHCPOption(o)
+			if err != nil {
+				log.Error(
+					"dhcpv4: option set at index %d: bad option string at index %d: %s",
+					i,
+					j,
+					err,
+				)
+
+				continue
+			}
+
+			set.opts.Update(dhcpv4.Option{Code: code, Value: val})
+		}
+
+		sets = append(sets, set)
+	}
+
+	return sets
+}
+
+// match returns true if the client of req belongs to the classes of set.
+func (set *v4OptionSet) match(req *dhcpv4.DHCPv4) (ok bool) {
+	if set.vendorClass != "" && !strings.HasPrefix(req.ClassIdentifier(), set.vendorClass) {
+		return false
+	}
+
+	return set.userClass == "" || slices.Contains(req.UserClass(), set.userClass)
 }
@@ -45,6 +45,24 @@ func TestParseOpt(t *testing.T) {
 			{0xC0, 0xA8, 0x01, 0x02},
 		}),
 		wantErrMsg: "",
+	}, {
+		name:     "routes_success",
+		in:       "121 routes 10.0.0.0/8 192.168.1.2,0.0.0.0/0 192.168.1.1",
+		wantCode: dhcpv4.GenericOptionCode(dhcpv4.OptionClasslessStaticRoute),
+		wantVal: dhcpv4.Routes{{
+			Dest: &net.IPNet{
+				IP:   net.IP{10, 0, 0, 0},
+				Mask: net.CIDRMask(8, netutil.IPv4BitLen),
+			},
+			Router: net.IP{192, 168, 1, 2},
+		}, {
+			Dest: &net.IPNet{
+				IP:   net.IP{0, 0, 0, 0},
+				Mask: net.CIDRMask(0, netutil.IPv4BitLen),
+			},
+			Router: net.IP{192, 168, 1, 1},
+		}},
+		wantErrMsg: "",
 	}, {
 		name:       "text_success",
 		in:         "252 text http://192.168.1.1/",
@@ -132,6 +150,21 @@ func TestParseOpt(t *testing.T) {
 		wantVal:  nil,
 		wantErrMsg: "invalid option string \"6 ips 192.168.1.1,192.168.1.x\": " +
 			"parsing ip at index 1: bad ipv4 address \"192.168.1.x\"",
+	}, {
+		name:     "routes_error",
+		in:       "121 routes 10.0.0.0/8",
+		wantCode: nil,
+		wantVal:  nil,
+		wantErrMsg: "invalid option string \"121 routes 10.0.0.0/8\": " +
+			"parsing route at index 0: bad route \"10.0.0.0/8\"",
+	}, {
+		name:     "routes_error_v6",
+		in:       "121 routes 2001:db8::/32 192.168.1.1",
+		wantCode: nil,
+		wantVal:  nil,
+		wantErrMsg: "invalid option string \"121 routes 2001:db8::/32 192.168.1.1\": " +
+			"parsing route at index 0: bad destination \"2001:db8::/32\": " +
+			"must be an ipv4 network",
 	}, {
 		name:     "bool_error",
 		in:       "19 bool yes",
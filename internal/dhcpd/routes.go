@@ -0,0 +1,66 @@
+package dhcpd
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+)
+
+// routeJSON is the JSON form of a classless static route used in the HTTP API
+// and in the leases database.
+type routeJSON struct {
+	Destination netip.Prefix `json:"destination"`
+	Router      netip.Addr   `json:"router"`
+}
+
+// validateRoute returns an error if r isn't a valid DHCPv4 classless static
+// route.
+func validateRoute(r dhcpsvc.Route) (err error) {
+	if !r.Dest.IsValid() || !r.Dest.Addr().Is4() {
+		return fmt.Errorf("bad destination %q: must be an ipv4 network", r.Dest)
+	}
+
+	if !r.Router.Is4() {
+		return fmt.Errorf("bad router %q: must be an ipv4 address", r.Router)
+	}
+
+	return nil
+}
+
+// routesToJSON converts routes to their JSON form.  It returns nil if there
+// are no routes.
+func routesToJSON(routes []dhcpsvc.Route) (rj []*routeJSON) {
+	for _, r := range routes {
+		rj = append(rj, &routeJSON{
+			Destination: r.Dest,
+			Router:      r.Router,
+		})
+	}
+
+	return rj
+}
+
+// routesFromJSON converts the JSON form of the routes to routes and validates
+// them.
+func routesFromJSON(rj []*routeJSON) (routes []dhcpsvc.Route, err error) {
+	for i, j := range rj {
+		if j == nil {
+			return nil, fmt.Errorf("route at index %d: no value", i)
+		}
+
+		r := dhcpsvc.Route{
+			Dest:   j.Destination.Masked(),
+			Router: j.Router,
+		}
+
+		err = validateRoute(r)
+		if err != nil {
+			return nil, fmt.Errorf("route at index %d: %w", i, err)
+		}
+
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
@@ -8,17 +8,18 @@ import (
 	"net"
 	"net/netip"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/timeutil"
-	"github.com/go-ping/ping"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
 )
@@ -39,7 +40,21 @@ type v4Server struct {
 	// have intersections with [implicitOpts].
 	explicitOpts dhcpv4.Options
 
-	// leasesLock protects leases, hostsIndex, ipIndex, and leasedOffsets.
+	// optionSets are the options for the vendor and user classes parsed from
+	// the configuration.
+	optionSets []*v4OptionSet
+
+	// leaseDurations are the lease durations of certain clients parsed from the
+	// configuration.
+	leaseDurations []*v4LeaseDuration
+
+	// arpDB is used to find the devices which don't respond to the ICMP echo
+	// requests while probing the addresses.  It's nil if the probing is
+	// disabled.
+	arpDB arpdb.Interface
+
+	// leasesLock protects leases, hostsIndex, ipIndex, leasedOffsets, and
+	// conflicts.
 	leasesLock sync.Mutex
 
 	// leasedOffsets contains offsets from conf.ipRange.start that have been
@@ -54,6 +69,18 @@ type v4Server struct {
 
 	// ipIndex is an index of leases by their IP addresses.
 	ipIndex map[netip.Addr]*dhcpsvc.Lease
+
+	// conflicts are the detected address conflicts by the addresses.
+	conflicts map[netip.Addr]*AddrConflict
+
+	// relays are the servers of the relay scopes in the same order as in the
+	// configuration.  They don't listen by themselves and only handle the
+	// requests relayed to s.
+	relays []*v4Server
+
+	// ifaces are the servers of the interface scopes in the same order as in
+	// the configuration.  Each of them listens on its own interface.
+	ifaces []*v4Server
 }
 
 func (s *v4Server) enabled() (ok bool) {
@@ -95,6 +122,20 @@ func normalizeHostname(hostname string) (norm string, err error) {
 	return norm, nil
 }
 
+// requestFingerprint returns the DHCP fingerprint of the client of req.
+func requestFingerprint(req *dhcpv4.DHCPv4) (fp dhcpsvc.Fingerprint) {
+	codes := req.ParameterRequestList()
+	params := make([]string, 0, len(codes))
+	for _, c := range codes {
+		params = append(params, strconv.Itoa(int(c.Code())))
+	}
+
+	return dhcpsvc.Fingerprint{
+		ParamList:   strings.Join(params, ","),
+		VendorClass: req.ClassIdentifier(),
+	}
+}
+
 // validHostnameForClient accepts the hostname sent by the client and its IP and
 // returns either a normalized version of that hostname, or a new hostname
 // generated from the IP address, or an empty string.
@@ -119,26 +160,66 @@ func (s *v4Server) validHostnameForClient(cliHostname string, ip netip.Addr) (ho
 
 // HostByIP implements the [Interface] interface for *v4Server.
 func (s *v4Server) HostByIP(ip netip.Addr) (host string) {
+	if srv := s.scopeFor(ip); srv != s {
+		return srv.HostByIP(ip)
+	}
+
+	now := time.Now()
+
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
-	if l, ok := s.ipIndex[ip]; ok {
+	if l, ok := s.ipIndex[ip]; ok && isActive(l, now) {
 		return l.Hostname
 	}
 
 	return ""
 }
 
-// IPByHost implements the [Interface] interface for *v4Server.
-func (s *v4Server) IPByHost(host string) (ip netip.Addr) {
+// isActive returns true if l is a static lease or a dynamic one which hasn't
+// expired yet at now.  Only such leases are served in the local DNS zone.
+func isActive(l *dhcpsvc.Lease, now time.Time) (ok bool) {
+	return l.IsStatic || l.Expiry.After(now)
+}
+
+// FingerprintByIP implements the [DHCPServer] interface for *v4Server.
+func (s *v4Server) FingerprintByIP(ip netip.Addr) (fp dhcpsvc.Fingerprint) {
+	if srv := s.scopeFor(ip); srv != s {
+		return srv.FingerprintByIP(ip)
+	}
+
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
-	if l, ok := s.hostsIndex[host]; ok {
-		return l.IP
+	if l, ok := s.ipIndex[ip]; ok {
+		return l.Fingerprint
+	}
+
+	return dhcpsvc.Fingerprint{}
+}
+
+// IPByHost implements the [Interface] interface for *v4Server.
+func (s *v4Server) IPByHost(host string) (ip netip.Addr) {
+	now := time.Now()
+
+	func() {
+		s.leasesLock.Lock()
+		defer s.leasesLock.Unlock()
+
+		if l, ok := s.hostsIndex[host]; ok && isActive(l, now) {
+			ip = l.IP
+		}
+	}()
+
+	for _, sc := range s.scopes() {
+		if ip.IsValid() {
+			break
+		}
+
+		ip = sc.IPByHost(host)
 	}
 
-	return netip.Addr{}
+	return ip
 }
 
 // ResetLeases resets leases.
@@ -149,6 +230,10 @@ func (s *v4Server) ResetLeases(leases []*dhcpsvc.Lease) (err error) {
 		return nil
 	}
 
+	if len(s.relays) > 0 || len(s.ifaces) > 0 {
+		leases = s.resetScopesLeases(leases)
+	}
+
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
@@ -175,7 +260,17 @@ func (s *v4Server) ResetLeases(leases []*dhcpsvc.Lease) (err error) {
 
 // getLeasesRef returns the actual leases slice.  For internal use only.
 func (s *v4Server) getLeasesRef() []*dhcpsvc.Lease {
-	return s.leases
+	scopes := s.scopes()
+	if len(scopes) == 0 {
+		return s.leases
+	}
+
+	leases := slices.Clone(s.leases)
+	for _, sc := range scopes {
+		leases = append(leases, sc.leases...)
+	}
+
+	return leases
 }
 
 // isBlocklisted returns true if this lease holds a blocklisted IP.
@@ -222,13 +317,15 @@ func (s *v4Server) GetLeases(flags GetLeasesFlags) (leases []*dhcpsvc.Lease) {
 		}
 	}
 
-	return leases
+	return append(leases, s.scopesLeases(flags)...)
 }
 
 // FindMACbyIP implements the [Interface] for *v4Server.
 func (s *v4Server) FindMACbyIP(ip netip.Addr) (mac net.HardwareAddr) {
 	if !ip.Is4() {
 		return nil
+	} else if srv := s.scopeFor(ip); srv != s {
+		return srv.FindMACbyIP(ip)
 	}
 
 	now := time.Now()
@@ -236,10 +333,8 @@ func (s *v4Server) FindMACbyIP(ip netip.Addr) (mac net.HardwareAddr) {
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
-	if l, ok := s.ipIndex[ip]; ok {
-		if l.IsStatic || l.Expiry.After(now) {
-			return l.HWAddr
-		}
+	if l, ok := s.ipIndex[ip]; ok && isActive(l, now) {
+		return l.HWAddr
 	}
 
 	return nil
@@ -248,11 +343,15 @@ func (s *v4Server) FindMACbyIP(ip netip.Addr) (mac net.HardwareAddr) {
 // defaultHwAddrLen is the default length of a hardware (MAC) address.
 const defaultHwAddrLen = 6
 
-// Add the specified IP to the black list for a time period
-func (s *v4Server) blocklistLease(l *dhcpsvc.Lease) {
+// blocklistLease makes l hold the conflicting address c.IP until the conflict
+// hold-down time passes and records c.  s.leasesLock is expected to be locked.
+func (s *v4Server) blocklistLease(l *dhcpsvc.Lease, c *AddrConflict) {
 	l.HWAddr = make(net.HardwareAddr, defaultHwAddrLen)
 	l.Hostname = ""
-	l.Expiry = time.Now().Add(s.conf.leaseTime)
+	l.Expiry = c.Time.Add(s.conf.conflictHoldTime)
+
+	c.Until = l.Expiry
+	s.conflicts[c.IP] = c
 }
 
 // rmLeaseByIndex removes a lease by its index in the leases slice.
@@ -380,6 +479,10 @@ const ErrUnconfigured errors.Error = "server is unconfigured"
 // AddStaticLease implements the DHCPServer interface for *v4Server.  It is
 // safe for concurrent use.
 func (s *v4Server) AddStaticLease(l *dhcpsvc.Lease) (err error) {
+	if srv := s.scopeFor(l.IP.Unmap()); srv != s {
+		return srv.AddStaticLease(l)
+	}
+
 	defer func() { err = errors.Annotate(err, "dhcpv4: adding static lease: %w") }()
 
 	if s.conf == nil {
@@ -437,6 +540,10 @@ func (s *v4Server) AddStaticLease(l *dhcpsvc.Lease) (err error) {
 
 // UpdateStaticLease updates IP, hostname of the static lease.
 func (s *v4Server) UpdateStaticLease(l *dhcpsvc.Lease) (err error) {
+	if srv := s.scopeFor(l.IP); srv != s {
+		return srv.UpdateStaticLease(l)
+	}
+
 	defer func() {
 		if err != nil {
 			err = errors.Annotate(err, "dhcpv4: updating static lease: %w")
@@ -531,6 +638,10 @@ func (s *v4Server) updateStaticLease(l *dhcpsvc.Lease) (err error) {
 
 // RemoveStaticLease removes a static lease.  It is safe for concurrent use.
 func (s *v4Server) RemoveStaticLease(l *dhcpsvc.Lease) (err error) {
+	if srv := s.scopeFor(l.IP); srv != s {
+		return srv.RemoveStaticLease(l)
+	}
+
 	defer func() { err = errors.Annotate(err, "dhcpv4: %w") }()
 
 	if s.conf == nil {
@@ -561,51 +672,6 @@ func (s *v4Server) RemoveStaticLease(l *dhcpsvc.Lease) (err error) {
 	return s.rmLease(l)
 }
 
-// addrAvailable sends an ICP request to the specified IP address.  It returns
-// true if the remote host doesn't reply, which probably means that the IP
-// address is available.
-//
-// TODO(a.garipov): I'm not sure that this is the best way to do this.
-func (s *v4Server) addrAvailable(target net.IP) (avail bool) {
-	if s.conf.ICMPTimeout == 0 {
-		return true
-	}
-
-	pinger, err := ping.NewPinger(target.String())
-	if err != nil {
-		log.Error("dhcpv4: ping.NewPinger(): %s", err)
-
-		return true
-	}
-
-	pinger.SetPrivileged(true)
-	pinger.Timeout = time.Duration(s.conf.ICMPTimeout) * time.Millisecond
-	pinger.Count = 1
-	reply := false
-	pinger.OnRecv = func(_ *ping.Packet) {
-		reply = true
-	}
-
-	log.Debug("dhcpv4: sending icmp echo to %s", target)
-
-	err = pinger.Run()
-	if err != nil {
-		log.Error("dhcpv4: pinger.Run(): %s", err)
-
-		return true
-	}
-
-	if reply {
-		log.Info("dhcpv4: ip conflict: %s is already used by another device", target)
-
-		return false
-	}
-
-	log.Debug("dhcpv4: icmp procedure is complete: %q", target)
-
-	return true
-}
-
 // findLease finds a lease by its MAC-address.
 func (s *v4Server) findLease(mac net.HardwareAddr) (l *dhcpsvc.Lease) {
 	for _, l = range s.leases {
@@ -680,7 +746,7 @@ func (s *v4Server) reserveLease(mac net.HardwareAddr) (l *dhcpsvc.Lease, err err
 // commitLease refreshes l's values.  It takes the desired hostname into account
 // when setting it into the lease, but generates a unique one if the provided
 // can't be used.
-func (s *v4Server) commitLease(l *dhcpsvc.Lease, hostname string) {
+func (s *v4Server) commitLease(l *dhcpsvc.Lease, hostname string, leaseTime time.Duration) {
 	prev := l.Hostname
 	hostname = s.validHostnameForClient(hostname, l.IP)
 
@@ -698,7 +764,7 @@ func (s *v4Server) commitLease(l *dhcpsvc.Lease, hostname string) {
 		l.Hostname = hostname
 	}
 
-	l.Expiry = time.Now().Add(s.conf.leaseTime)
+	l.Expiry = time.Now().Add(leaseTime)
 	if prev != "" && prev != l.Hostname {
 		delete(s.hostsIndex, prev)
 	}
@@ -719,12 +785,12 @@ func (s *v4Server) allocateLease(mac net.HardwareAddr) (l *dhcpsvc.Lease, err er
 			return nil, nil
 		}
 
-		leaseIP := l.IP.AsSlice()
-		if s.addrAvailable(leaseIP) {
+		c := s.probeAddr(l.IP, mac)
+		if c == nil {
 			return l, nil
 		}
 
-		s.blocklistLease(l)
+		s.blocklistLease(l, c)
 	}
 }
 
@@ -973,6 +1039,9 @@ func (s *v4Server) handleRequest(req, resp *dhcpv4.DHCPv4) (lease *dhcpsvc.Lease
 	s.leasesLock.Lock()
 	defer s.leasesLock.Unlock()
 
+	lease.CircuitID, lease.RemoteID = relayAgentIDs(req)
+	lease.Fingerprint = requestFingerprint(req)
+
 	if lease.IsStatic {
 		if lease.Hostname != "" {
 			// TODO(e.burkov):  This option is used to update the server's DNS
@@ -984,7 +1053,7 @@ func (s *v4Server) handleRequest(req, resp *dhcpv4.DHCPv4) (lease *dhcpsvc.Lease
 		return lease, needsReply
 	}
 
-	s.commitLease(lease, hostname)
+	s.commitLease(lease, hostname, s.leaseTimeFor(req))
 
 	if isRequested {
 		resp.UpdateOption(dhcpv4.OptHostName(lease.Hostname))
@@ -1018,6 +1087,18 @@ func (s *v4Server) handleDecline(req, resp *dhcpv4.DHCPv4) (err error) {
 		return fmt.Errorf("removing old lease for %s: %w", mac, err)
 	}
 
+	declined := &dhcpsvc.Lease{IP: oldLease.IP}
+	s.blocklistLease(declined, &AddrConflict{
+		Time:   time.Now(),
+		IP:     oldLease.IP,
+		Source: ConflictSourceDecline,
+	})
+
+	err = s.addLease(declined)
+	if err != nil {
+		log.Debug("dhcpv4: holding declined address %s: %s", oldLease.IP, err)
+	}
+
 	newLease, err := s.allocateLease(mac)
 	if err != nil {
 		return fmt.Errorf("allocating new lease for %s: %w", mac, err)
@@ -1031,7 +1112,7 @@ func (s *v4Server) handleDecline(req, resp *dhcpv4.DHCPv4) (err error) {
 	}
 
 	newLease.Hostname = oldLease.Hostname
-	newLease.Expiry = time.Now().Add(s.conf.leaseTime)
+	newLease.Expiry = time.Now().Add(s.leaseTimeFor(req))
 
 	err = s.addLease(newLease)
 	if err != nil {
@@ -1194,6 +1275,10 @@ func (s *v4Server) handle(req, resp *dhcpv4.DHCPv4) (rCode int) {
 	// See https://datatracker.ietf.org/doc/html/rfc2131#page-29.
 	resp.UpdateOption(dhcpv4.OptServerIdentifier(s.conf.dnsIPAddrs[0].AsSlice()))
 
+	if s.conf.PXE.isProxyDHCP() {
+		return s.handleProxy(req, resp)
+	}
+
 	handler := messageHandlers[req.MessageType()]
 	if handler == nil {
 		s.updateOptions(req, resp)
@@ -1217,6 +1302,9 @@ func (s *v4Server) handle(req, resp *dhcpv4.DHCPv4) (rCode int) {
 	}
 
 	s.updateOptions(req, resp)
+	if l != nil {
+		updateLeaseOptions(req, resp, l)
+	}
 
 	return 1
 }
@@ -1230,7 +1318,7 @@ func (s *v4Server) updateOptions(req, resp *dhcpv4.DHCPv4) {
 	// replied for DHCPREQUEST.
 	//
 	// TODO(e.burkov):  Inspect why this is always set to configured value.
-	resp.UpdateOption(dhcpv4.OptIPAddressLeaseTime(s.conf.leaseTime))
+	resp.UpdateOption(dhcpv4.OptIPAddressLeaseTime(s.leaseTimeFor(req)))
 
 	// If the server recognizes the parameter as a parameter defined in the Host
 	// Requirements Document, the server MUST include the default value for that
@@ -1244,7 +1332,21 @@ func (s *v4Server) updateOptions(req, resp *dhcpv4.DHCPv4) {
 	// If the server has been explicitly configured with a default value for the
 	// parameter or the parameter has a non-default value on the client's
 	// subnet, the server MUST include that value in an appropriate option.
-	for code, val := range s.explicitOpts {
+	updateExplicitOptions(resp, s.explicitOpts)
+
+	for _, set := range s.optionSets {
+		if set.match(req) {
+			updateExplicitOptions(resp, set.opts)
+		}
+	}
+
+	s.updatePXEOptions(req, resp)
+}
+
+// updateExplicitOptions sets the options of the response to opts.  The nil
+// values delete the corresponding options.
+func updateExplicitOptions(resp *dhcpv4.DHCPv4, opts dhcpv4.Options) {
+	for code, val := range opts {
 		if val != nil {
 			resp.Options[code] = val
 		} else {
@@ -1254,6 +1356,53 @@ func (s *v4Server) updateOptions(req, resp *dhcpv4.DHCPv4) {
 	}
 }
 
+// updateLeaseOptions updates the options of the response with the ones
+// configured for the lease l, which override the ones from the configuration.
+func updateLeaseOptions(req, resp *dhcpv4.DHCPv4, l *dhcpsvc.Lease) {
+	if len(l.Routes) > 0 {
+		updateLeaseRoutes(req, resp, l.Routes)
+	}
+
+	for i, o := range l.Options {
+		code, val, err := parseDHCPOption(o)
+		if err != nil {
+			// The options are validated when the lease is added, so it's only
+			// possible with a manually edited leases database.
+			log.Debug("dhcpv4: lease %s: bad option at index %d: %s", l.HWAddr, i, err)
+
+			continue
+		}
+
+		if data := val.ToBytes(); data != nil {
+			resp.Options[code.Code()] = data
+		} else {
+			// Delete options explicitly configured to be removed.
+			delete(resp.Options, code.Code())
+		}
+	}
+}
+
+// updateLeaseRoutes sets the classless static route options of the response to
+// routes, if requested.
+func updateLeaseRoutes(req, resp *dhcpv4.DHCPv4, leaseRoutes []dhcpsvc.Route) {
+	routes := make(dhcpv4.Routes, 0, len(leaseRoutes))
+	for _, r := range leaseRoutes {
+		routes = append(routes, toDHCPv4Route(r))
+	}
+
+	// Only send the routes to the clients which request them.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc3442#page-5.
+	for _, code := range []dhcpv4.OptionCode{
+		dhcpv4.OptionClasslessStaticRoute,
+		optionMSClasslessStaticRoute,
+	} {
+		if req.IsOptionRequested(code) {
+			resp.UpdateOption(dhcpv4.Option{Code: code, Value: routes})
+		}
+	}
+}
+
 // client(0.0.0.0:68) -> (Request:ClientMAC,Type=Discover,ClientID,ReqIP,HostName) -> server(255.255.255.255:67)
 // client(255.255.255.255:68) <- (Reply:YourIP,ClientMAC,Type=Offer,ServerID,SubnetMask,LeaseTime) <- server(<IP>:67)
 // client(0.0.0.0:68) -> (Request:ClientMAC,Type=Request,ClientID,ReqIP||ClientIP,HostName,ServerID,ParamReqList) -> server(255.255.255.255:67)
@@ -1288,13 +1437,25 @@ func (s *v4Server) packetHandler(conn net.PacketConn, peer net.Addr, req *dhcpv4
 		return
 	}
 
-	r := s.handle(req, resp)
+	srv := s
+	if isRelayed(req) {
+		srv = s.scopeForRelayed(req)
+		if srv == nil {
+			log.Debug("dhcpv4: no scope for relay agent %s", req.GatewayIPAddr)
+
+			return
+		}
+	}
+
+	r := srv.handle(req, resp)
 	if r < 0 {
 		return
 	} else if r == 0 {
 		resp.Options.Update(dhcpv4.OptMessageType(dhcpv4.MessageTypeNak))
 	}
 
+	echoRelayAgentInfo(req, resp)
+
 	s.send(peer, conn, req, resp)
 }
 
@@ -1306,6 +1467,12 @@ func (s *v4Server) Start() (err error) {
 		return nil
 	}
 
+	err = s.startIfaceScopes()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
 	ifaceName := s.conf.InterfaceName
 	iface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
@@ -1330,6 +1497,7 @@ func (s *v4Server) Start() (err error) {
 	}
 
 	s.configureDNSIPAddrs(dnsIPAddrs)
+	s.configureRelaysDNSIPAddrs(dnsIPAddrs)
 
 	var c net.PacketConn
 	if c, err = s.newDHCPConn(iface); err != nil {
@@ -1388,6 +1556,12 @@ func (s *v4Server) configureDNSIPAddrs(dnsIPAddrs []net.IP) {
 
 // Stop - stop server
 func (s *v4Server) Stop() (err error) {
+	err = s.stopIfaceScopes()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
 	if s.srv == nil {
 		return
 	}
@@ -1412,6 +1586,7 @@ func v4Create(conf *V4ServerConf) (srv *v4Server, err error) {
 	s := &v4Server{
 		hostsIndex: map[string]*dhcpsvc.Lease{},
 		ipIndex:    map[netip.Addr]*dhcpsvc.Lease{},
+		conflicts:  map[netip.Addr]*AddrConflict{},
 	}
 
 	err = conf.Validate()
@@ -1434,7 +1609,32 @@ func v4Create(conf *V4ServerConf) (srv *v4Server, err error) {
 		s.conf.leaseTime = time.Second * time.Duration(conf.LeaseDuration)
 	}
 
+	if conf.ConflictHoldDuration == 0 {
+		s.conf.conflictHoldTime = s.conf.leaseTime
+	} else {
+		s.conf.conflictHoldTime = time.Second * time.Duration(conf.ConflictHoldDuration)
+	}
+
+	if conf.ICMPTimeout != 0 {
+		s.arpDB = arpdb.New()
+	}
+
 	s.prepareOptions()
 
+	s.leaseDurations, err = newLeaseDurations(conf.LeaseDurations)
+	if err != nil {
+		return s, fmt.Errorf("dhcpv4: %w", err)
+	}
+
+	s.relays, err = newRelayScopes(s.conf)
+	if err != nil {
+		return s, fmt.Errorf("dhcpv4: %w", err)
+	}
+
+	s.ifaces, err = newIfaceScopes(s.conf, s.relays)
+	if err != nil {
+		return s, fmt.Errorf("dhcpv4: %w", err)
+	}
+
 	return s, nil
 }
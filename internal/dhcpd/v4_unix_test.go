@@ -11,11 +11,13 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/stringutil"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -832,6 +834,80 @@ func TestV4Server_FindMACbyIP(t *testing.T) {
 	}
 }
 
+func TestV4Server_localZone(t *testing.T) {
+	const (
+		activeName  = "active-client"
+		expiredName = "expired-client"
+		staticName  = "static-client"
+	)
+
+	activeIP := netip.MustParseAddr("192.168.10.100")
+	expiredIP := netip.MustParseAddr("192.168.10.101")
+	staticIP := netip.MustParseAddr("192.168.10.10")
+
+	s := &v4Server{
+		leases: []*dhcpsvc.Lease{{
+			Expiry:   time.Now().Add(time.Hour),
+			Hostname: activeName,
+			HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+			IP:       activeIP,
+		}, {
+			Expiry:   time.Unix(10, 0),
+			Hostname: expiredName,
+			HWAddr:   net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+			IP:       expiredIP,
+		}, {
+			Hostname: staticName,
+			HWAddr:   net.HardwareAddr{0xCC, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC},
+			IP:       staticIP,
+			IsStatic: true,
+		}},
+	}
+	s.ipIndex = map[netip.Addr]*dhcpsvc.Lease{
+		activeIP:  s.leases[0],
+		expiredIP: s.leases[1],
+		staticIP:  s.leases[2],
+	}
+	s.hostsIndex = map[string]*dhcpsvc.Lease{
+		activeName:  s.leases[0],
+		expiredName: s.leases[1],
+		staticName:  s.leases[2],
+	}
+
+	testCases := []struct {
+		ip       netip.Addr
+		name     string
+		host     string
+		wantHost string
+		wantIP   netip.Addr
+	}{{
+		ip:       activeIP,
+		name:     "active",
+		host:     activeName,
+		wantHost: activeName,
+		wantIP:   activeIP,
+	}, {
+		ip:       staticIP,
+		name:     "static",
+		host:     staticName,
+		wantHost: staticName,
+		wantIP:   staticIP,
+	}, {
+		ip:       expiredIP,
+		name:     "expired",
+		host:     expiredName,
+		wantHost: "",
+		wantIP:   netip.Addr{},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantIP, s.IPByHost(tc.host))
+			assert.Equal(t, tc.wantHost, s.HostByIP(tc.ip))
+		})
+	}
+}
+
 func TestV4Server_handleDecline(t *testing.T) {
 	const (
 		dynamicName = "dynamic-client"
@@ -872,6 +948,17 @@ func TestV4Server_handleDecline(t *testing.T) {
 	}
 
 	require.Equal(t, wantResp, resp)
+
+	conflicts := s4.Conflicts()
+	require.Len(t, conflicts, 1)
+
+	assert.Equal(t, dynamicIP, conflicts[0].IP)
+	assert.Equal(t, ConflictSourceDecline, conflicts[0].Source)
+
+	l, ok := s4.ipIndex[dynamicIP]
+	require.True(t, ok)
+
+	assert.True(t, s4.isBlocklisted(l))
 }
 
 func TestV4Server_handleRelease(t *testing.T) {
@@ -914,3 +1001,688 @@ func TestV4Server_handleRelease(t *testing.T) {
 
 	require.Equal(t, wantResp, resp)
 }
+
+func TestV4Server_handle_leaseRoutes(t *testing.T) {
+	sIface := defaultSrv(t)
+
+	s, ok := sIface.(*v4Server)
+	require.True(t, ok)
+
+	mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	err := s.AddStaticLease(&dhcpsvc.Lease{
+		Hostname: "static-1.local",
+		HWAddr:   mac,
+		IP:       netip.MustParseAddr("192.168.10.150"),
+		Routes: []dhcpsvc.Route{{
+			Dest:   netip.MustParsePrefix("10.8.0.0/24"),
+			Router: netip.MustParseAddr("192.168.10.3"),
+		}},
+	})
+	require.NoError(t, err)
+
+	wantRoutes := dhcpv4.Routes{{
+		Dest: &net.IPNet{
+			IP:   net.IP{10, 8, 0, 0},
+			Mask: net.CIDRMask(24, netutil.IPv4BitLen),
+		},
+		Router: net.IP{192, 168, 10, 3},
+	}}
+
+	testCases := []struct {
+		name      string
+		requested []dhcpv4.OptionCode
+		wantRFC   bool
+		wantMS    bool
+	}{{
+		name:      "none",
+		requested: nil,
+		wantRFC:   false,
+		wantMS:    false,
+	}, {
+		name:      "rfc",
+		requested: []dhcpv4.OptionCode{dhcpv4.OptionClasslessStaticRoute},
+		wantRFC:   true,
+		wantMS:    false,
+	}, {
+		name: "both",
+		requested: []dhcpv4.OptionCode{
+			dhcpv4.OptionClasslessStaticRoute,
+			optionMSClasslessStaticRoute,
+		},
+		wantRFC: true,
+		wantMS:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, rErr := dhcpv4.NewDiscovery(mac, dhcpv4.WithRequestedOptions(tc.requested...))
+			require.NoError(t, rErr)
+
+			resp, rErr := dhcpv4.NewReplyFromRequest(req)
+			require.NoError(t, rErr)
+
+			require.Equal(t, 1, s.handle(req, resp))
+
+			if tc.wantRFC {
+				assert.Equal(t, []*dhcpv4.Route(wantRoutes), resp.ClasslessStaticRoute())
+			} else {
+				assert.False(t, resp.Options.Has(dhcpv4.OptionClasslessStaticRoute))
+			}
+
+			if tc.wantMS {
+				assert.Equal(t, wantRoutes.ToBytes(), resp.Options.Get(optionMSClasslessStaticRoute))
+			} else {
+				assert.False(t, resp.Options.Has(optionMSClasslessStaticRoute))
+			}
+		})
+	}
+}
+
+func TestV4Server_handle_leaseOptions(t *testing.T) {
+	conf := defaultV4ServerConf()
+	conf.Options = []string{
+		"42 ips 192.168.10.4",
+		"66 text tftp.example",
+	}
+
+	s, err := v4Create(conf)
+	require.NoError(t, err)
+
+	mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	err = s.AddStaticLease(&dhcpsvc.Lease{
+		Hostname: "static-1.local",
+		HWAddr:   mac,
+		IP:       netip.MustParseAddr("192.168.10.150"),
+		Options: []string{
+			"42 ips 192.168.10.5",
+			"66 del",
+		},
+	})
+	require.NoError(t, err)
+
+	otherMAC := net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB}
+
+	testCases := []struct {
+		wantNTP  net.IP
+		mac      net.HardwareAddr
+		name     string
+		wantTFTP bool
+	}{{
+		wantNTP:  net.IP{192, 168, 10, 5},
+		mac:      mac,
+		name:     "static",
+		wantTFTP: false,
+	}, {
+		wantNTP:  net.IP{192, 168, 10, 4},
+		mac:      otherMAC,
+		name:     "dynamic",
+		wantTFTP: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, rErr := dhcpv4.NewDiscovery(tc.mac)
+			require.NoError(t, rErr)
+
+			resp, rErr := dhcpv4.NewReplyFromRequest(req)
+			require.NoError(t, rErr)
+
+			require.Equal(t, 1, s.handle(req, resp))
+
+			ntp := resp.NTPServers()
+			require.Len(t, ntp, 1)
+
+			assert.True(t, tc.wantNTP.Equal(ntp[0]))
+			assert.Equal(t, tc.wantTFTP, resp.Options.Has(dhcpv4.OptionTFTPServerName))
+		})
+	}
+}
+
+func TestV4Server_relay(t *testing.T) {
+	conf := defaultV4ServerConf()
+	conf.RelayScopes = []*V4RelayScope{{
+		GatewayIP:  netip.MustParseAddr("10.0.0.1"),
+		SubnetMask: netip.MustParseAddr("255.255.255.0"),
+		RangeStart: netip.MustParseAddr("10.0.0.100"),
+		RangeEnd:   netip.MustParseAddr("10.0.0.200"),
+	}, {
+		GatewayIP:  netip.MustParseAddr("10.0.1.1"),
+		SubnetMask: netip.MustParseAddr("255.255.255.0"),
+		RangeStart: netip.MustParseAddr("10.0.1.100"),
+		RangeEnd:   netip.MustParseAddr("10.0.1.200"),
+		CircuitID:  "port-1",
+	}}
+
+	s, err := v4Create(conf)
+	require.NoError(t, err)
+
+	s.configureRelaysDNSIPAddrs([]net.IP{DefaultSelfIP.AsSlice()})
+
+	circuitOpt := dhcpv4.OptRelayAgentInfo(
+		dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("port-1")),
+	)
+
+	testCases := []struct {
+		opt     *dhcpv4.Option
+		giaddr  net.IP
+		wantNet netip.Prefix
+		name    string
+	}{{
+		opt:     nil,
+		giaddr:  nil,
+		wantNet: netip.MustParsePrefix("192.168.10.0/24"),
+		name:    "direct",
+	}, {
+		opt:     nil,
+		giaddr:  net.IP{10, 0, 0, 2},
+		wantNet: netip.MustParsePrefix("10.0.0.0/24"),
+		name:    "giaddr",
+	}, {
+		opt:     &circuitOpt,
+		giaddr:  net.IP{10, 0, 0, 2},
+		wantNet: netip.MustParsePrefix("10.0.1.0/24"),
+		name:    "circuit_id",
+	}}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, byte(i)}
+			req, rErr := dhcpv4.NewDiscovery(mac)
+			require.NoError(t, rErr)
+
+			req.GatewayIPAddr = tc.giaddr
+			if tc.opt != nil {
+				req.UpdateOption(*tc.opt)
+			}
+
+			resp, rErr := dhcpv4.NewReplyFromRequest(req)
+			require.NoError(t, rErr)
+
+			srv := s
+			if isRelayed(req) {
+				srv = s.scopeForRelayed(req)
+				require.NotNil(t, srv)
+			}
+
+			require.Equal(t, 1, srv.handle(req, resp))
+			echoRelayAgentInfo(req, resp)
+
+			yiaddr, ok := netip.AddrFromSlice(resp.YourIPAddr.To4())
+			require.True(t, ok)
+
+			assert.True(t, tc.wantNet.Contains(yiaddr))
+			assert.Equal(t, tc.opt != nil, resp.Options.Has(dhcpv4.OptionRelayAgentInformation))
+		})
+	}
+
+	t.Run("unknown_relay", func(t *testing.T) {
+		req, rErr := dhcpv4.NewDiscovery(net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB})
+		require.NoError(t, rErr)
+
+		req.GatewayIPAddr = net.IP{172, 16, 0, 1}
+
+		assert.Nil(t, s.scopeForRelayed(req))
+	})
+
+	t.Run("agent_ids", func(t *testing.T) {
+		req, rErr := dhcpv4.NewDiscovery(net.HardwareAddr{0xCC, 0xCC, 0xCC, 0xCC, 0xCC, 0xCC})
+		require.NoError(t, rErr)
+
+		req.UpdateOption(dhcpv4.OptRelayAgentInfo(
+			dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("port-1")),
+			dhcpv4.OptGeneric(dhcpv4.AgentRemoteIDSubOption, []byte{0x00, 0x01}),
+		))
+
+		circuitID, remoteID := relayAgentIDs(req)
+		assert.Equal(t, "port-1", circuitID)
+		assert.Equal(t, "0001", remoteID)
+	})
+}
+
+func TestV4Create_relayOverlap(t *testing.T) {
+	conf := defaultV4ServerConf()
+	conf.RelayScopes = []*V4RelayScope{{
+		GatewayIP:  netip.MustParseAddr("192.168.10.129"),
+		SubnetMask: netip.MustParseAddr("255.255.255.128"),
+		RangeStart: netip.MustParseAddr("192.168.10.130"),
+		RangeEnd:   netip.MustParseAddr("192.168.10.140"),
+	}}
+
+	_, err := v4Create(conf)
+	testutil.AssertErrorMsg(
+		t,
+		"dhcpv4: relay scope at index 0: network 192.168.10.129/25 overlaps",
+		err,
+	)
+}
+
+func TestV4Server_handle_optionSets(t *testing.T) {
+	conf := defaultV4ServerConf()
+	conf.Options = []string{
+		"66 text tftp.example",
+	}
+	conf.OptionSets = []*V4OptionSet{{
+		VendorClass: "PXEClient",
+		Options:     []string{"67 text pxelinux.0"},
+	}, {
+		UserClass: "phone",
+		Options: []string{
+			"66 text phones.example",
+			"67 text phone.cfg",
+		},
+	}, {
+		VendorClass: "PXEClient",
+		UserClass:   "phone",
+		Options:     []string{"67 text both.cfg"},
+	}, {
+		Options: []string{"67 text never.cfg"},
+	}}
+
+	s, err := v4Create(conf)
+	require.NoError(t, err)
+
+	require.Len(t, s.optionSets, 3)
+
+	testCases := []struct {
+		modifiers    []dhcpv4.Modifier
+		name         string
+		wantTFTP     string
+		wantBootFile string
+	}{{
+		modifiers:    nil,
+		name:         "no_class",
+		wantTFTP:     "tftp.example",
+		wantBootFile: "",
+	}, {
+		modifiers: []dhcpv4.Modifier{
+			dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00000:UNDI:002001")),
+		},
+		name:         "vendor_class",
+		wantTFTP:     "tftp.example",
+		wantBootFile: "pxelinux.0",
+	}, {
+		modifiers:    []dhcpv4.Modifier{dhcpv4.WithUserClass("phone", true)},
+		name:         "user_class",
+		wantTFTP:     "phones.example",
+		wantBootFile: "phone.cfg",
+	}, {
+		modifiers: []dhcpv4.Modifier{
+			dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient")),
+			dhcpv4.WithUserClass("phone", false),
+		},
+		name:         "both",
+		wantTFTP:     "phones.example",
+		wantBootFile: "both.cfg",
+	}}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, byte(i)}
+			req, rErr := dhcpv4.NewDiscovery(mac, tc.modifiers...)
+			require.NoError(t, rErr)
+
+			resp, rErr := dhcpv4.NewReplyFromRequest(req)
+			require.NoError(t, rErr)
+
+			require.Equal(t, 1, s.handle(req, resp))
+
+			assert.Equal(t, tc.wantTFTP, resp.TFTPServerName())
+			assert.Equal(t, tc.wantBootFile, resp.BootFileNameOption())
+		})
+	}
+}
+
+func TestV4Server_handle_pxe(t *testing.T) {
+	pxeConf := &V4PXEConf{
+		NextServer:   netip.MustParseAddr("192.168.10.3"),
+		BootFile:     "pxelinux.0",
+		BootFileUEFI: "bootx64.efi",
+		Enabled:      true,
+	}
+
+	newReq := func(t *testing.T, mt dhcpv4.MessageType, mods ...dhcpv4.Modifier) (req *dhcpv4.DHCPv4) {
+		t.Helper()
+
+		mac := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+		req, err := dhcpv4.New(append([]dhcpv4.Modifier{
+			dhcpv4.WithHwAddr(mac),
+			dhcpv4.WithMessageType(mt),
+		}, mods...)...)
+		require.NoError(t, err)
+
+		return req
+	}
+
+	pxeClient := dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016"))
+	uefiArch := dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_BC))
+
+	t.Run("server", func(t *testing.T) {
+		conf := defaultV4ServerConf()
+		conf.PXE = pxeConf
+
+		s, err := v4Create(conf)
+		require.NoError(t, err)
+
+		testCases := []struct {
+			mods         []dhcpv4.Modifier
+			name         string
+			wantBootFile string
+		}{{
+			mods:         nil,
+			name:         "not_pxe",
+			wantBootFile: "",
+		}, {
+			mods:         []dhcpv4.Modifier{pxeClient},
+			name:         "bios",
+			wantBootFile: "pxelinux.0",
+		}, {
+			mods:         []dhcpv4.Modifier{pxeClient, uefiArch},
+			name:         "uefi",
+			wantBootFile: "bootx64.efi",
+		}}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req := newReq(t, dhcpv4.MessageTypeDiscover, tc.mods...)
+				resp, rErr := dhcpv4.NewReplyFromRequest(req)
+				require.NoError(t, rErr)
+
+				require.Equal(t, 1, s.handle(req, resp))
+
+				assert.Equal(t, tc.wantBootFile, resp.BootFileName)
+				assert.Equal(t, tc.wantBootFile, resp.BootFileNameOption())
+				assert.False(t, resp.YourIPAddr.IsUnspecified())
+
+				if tc.wantBootFile != "" {
+					assert.Equal(t, "192.168.10.3", resp.TFTPServerName())
+					assert.True(t, resp.ServerIPAddr.Equal(net.IP{192, 168, 10, 3}))
+				}
+			})
+		}
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		conf := defaultV4ServerConf()
+		conf.PXE = &V4PXEConf{}
+		*conf.PXE = *pxeConf
+		conf.PXE.ProxyDHCP = true
+
+		s, err := v4Create(conf)
+		require.NoError(t, err)
+
+		req := newReq(t, dhcpv4.MessageTypeDiscover, pxeClient)
+		resp, err := dhcpv4.NewReplyFromRequest(req)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, s.handle(req, resp))
+
+		assert.Equal(t, dhcpv4.MessageTypeOffer, resp.MessageType())
+		assert.True(t, resp.YourIPAddr.IsUnspecified())
+		assert.Equal(t, "pxelinux.0", resp.BootFileName)
+		assert.Equal(t, "PXEClient", resp.ClassIdentifier())
+		assert.False(t, resp.Options.Has(dhcpv4.OptionRouter))
+		assert.Empty(t, s.GetLeases(LeasesAll))
+
+		req = newReq(t, dhcpv4.MessageTypeDiscover)
+		resp, err = dhcpv4.NewReplyFromRequest(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, -1, s.handle(req, resp))
+
+		req = newReq(t, dhcpv4.MessageTypeRequest, pxeClient)
+		resp, err = dhcpv4.NewReplyFromRequest(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, -1, s.handle(req, resp))
+	})
+
+	t.Run("bad_conf", func(t *testing.T) {
+		conf := defaultV4ServerConf()
+		conf.PXE = &V4PXEConf{
+			NextServer: netip.MustParseAddr("192.168.10.3"),
+			Enabled:    true,
+		}
+
+		_, err := v4Create(conf)
+		testutil.AssertErrorMsg(t, "dhcpv4: pxe: no boot_file", err)
+	})
+}
+
+// newTestIfaceScope returns an interface scope for the network 10.0.x.0/24.
+func newTestIfaceScope(ifaceName string, x byte) (is *V4InterfaceScope) {
+	return &V4InterfaceScope{
+		InterfaceName: ifaceName,
+		GatewayIP:     netip.AddrFrom4([4]byte{10, 0, x, 1}),
+		SubnetMask:    netip.MustParseAddr("255.255.255.0"),
+		RangeStart:    netip.AddrFrom4([4]byte{10, 0, x, 100}),
+		RangeEnd:      netip.AddrFrom4([4]byte{10, 0, x, 200}),
+	}
+}
+
+func TestV4Create_ifaceScopes(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		scopes     []*V4InterfaceScope
+	}{{
+		name:       "success",
+		wantErrMsg: "",
+		scopes: []*V4InterfaceScope{
+			newTestIfaceScope("eth0.10", 10),
+			newTestIfaceScope("eth0.20", 20),
+		},
+	}, {
+		name:       "nil",
+		wantErrMsg: "dhcpv4: interface scope at index 0: no value",
+		scopes:     []*V4InterfaceScope{nil},
+	}, {
+		name:       "no_interface",
+		wantErrMsg: "dhcpv4: interface scope at index 0: no interface_name",
+		scopes:     []*V4InterfaceScope{newTestIfaceScope("", 10)},
+	}, {
+		name:       "server_interface",
+		wantErrMsg: `dhcpv4: interface scope at index 0: interface "eth0" is used by the server`,
+		scopes:     []*V4InterfaceScope{newTestIfaceScope("eth0", 10)},
+	}, {
+		name: "same_interface",
+		wantErrMsg: `dhcpv4: interface scope at index 1: ` +
+			`interface "eth0.10" is used by another scope`,
+		scopes: []*V4InterfaceScope{
+			newTestIfaceScope("eth0.10", 10),
+			newTestIfaceScope("eth0.10", 20),
+		},
+	}, {
+		name: "overlap",
+		wantErrMsg: "dhcpv4: interface scope at index 1: " +
+			"network 10.0.10.0/24 overlaps with 10.0.10.0/24",
+		scopes: []*V4InterfaceScope{
+			newTestIfaceScope("eth0.10", 10),
+			newTestIfaceScope("eth0.20", 10),
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := defaultV4ServerConf()
+			conf.InterfaceName = "eth0"
+			conf.InterfaceScopes = tc.scopes
+
+			_, err := v4Create(conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestV4Server_ifaceScopes(t *testing.T) {
+	conf := defaultV4ServerConf()
+	conf.InterfaceName = "eth0"
+	conf.InterfaceScopes = []*V4InterfaceScope{newTestIfaceScope("eth0.10", 10)}
+
+	s, err := v4Create(conf)
+	require.NoError(t, err)
+	require.Len(t, s.ifaces, 1)
+
+	sc := s.ifaces[0]
+	assert.Equal(t, "eth0.10", sc.conf.InterfaceName)
+
+	scopeIP := netip.MustParseAddr("10.0.10.150")
+	serverIP := netip.MustParseAddr("192.168.10.150")
+
+	err = s.ResetLeases([]*dhcpsvc.Lease{{
+		Expiry:   time.Now().Add(time.Hour),
+		Hostname: "scope-client",
+		HWAddr:   net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		IP:       scopeIP,
+	}, {
+		Expiry:   time.Now().Add(time.Hour),
+		Hostname: "server-client",
+		HWAddr:   net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		IP:       serverIP,
+	}})
+	require.NoError(t, err)
+
+	require.Len(t, s.leases, 1)
+	require.Len(t, sc.leases, 1)
+
+	assert.Equal(t, serverIP, s.leases[0].IP)
+	assert.Equal(t, scopeIP, sc.leases[0].IP)
+	assert.Len(t, s.GetLeases(LeasesAll), 2)
+	assert.Len(t, s.getLeasesRef(), 2)
+
+	assert.Equal(t, scopeIP, s.IPByHost("scope-client"))
+	assert.Equal(t, "scope-client", s.HostByIP(scopeIP))
+}
+
+// testARPDB is a fake [arpdb.Interface] implementation for tests.
+type testARPDB struct {
+	neighbors []arpdb.Neighbor
+}
+
+// type check
+var _ arpdb.Interface = (*testARPDB)(nil)
+
+// Refresh implements the [arpdb.Interface] interface for *testARPDB.
+func (db *testARPDB) Refresh() (err error) { return nil }
+
+// Neighbors implements the [arpdb.Interface] interface for *testARPDB.
+func (db *testARPDB) Neighbors() (ns []arpdb.Neighbor) { return db.neighbors }
+
+func TestV4Server_neighborMAC(t *testing.T) {
+	knownIP := netip.MustParseAddr("192.168.10.150")
+	knownMAC := net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+
+	incompleteIP := netip.MustParseAddr("192.168.10.151")
+
+	s := &v4Server{
+		arpDB: &testARPDB{
+			neighbors: []arpdb.Neighbor{{
+				IP:  knownIP,
+				MAC: knownMAC,
+			}, {
+				IP:  incompleteIP,
+				MAC: net.HardwareAddr{0, 0, 0, 0, 0, 0},
+			}},
+		},
+	}
+
+	testCases := []struct {
+		ip   netip.Addr
+		want net.HardwareAddr
+		name string
+	}{{
+		ip:   knownIP,
+		want: knownMAC,
+		name: "known",
+	}, {
+		ip:   incompleteIP,
+		want: nil,
+		name: "incomplete",
+	}, {
+		ip:   netip.MustParseAddr("192.168.10.152"),
+		want: nil,
+		name: "unknown",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, s.neighborMAC(tc.ip))
+		})
+	}
+}
+
+func TestV4Server_leaseTimeFor(t *testing.T) {
+	conf := defaultV4ServerConf()
+	conf.LeaseDuration = 3600
+	conf.LeaseDurations = []*V4LeaseDuration{{
+		VendorClass: "guest",
+		Duration:    600,
+	}, {
+		MAC:      "aa:aa:aa:aa:aa:aa",
+		Duration: 604800,
+	}}
+
+	s, err := v4Create(conf)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		vendorClass string
+		mac         net.HardwareAddr
+		want        time.Duration
+	}{{
+		name:        "default",
+		vendorClass: "",
+		mac:         net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		want:        time.Hour,
+	}, {
+		name:        "mac",
+		vendorClass: "",
+		mac:         net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		want:        7 * 24 * time.Hour,
+	}, {
+		name:        "vendor_class",
+		vendorClass: "guest-phone",
+		mac:         net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB},
+		want:        10 * time.Minute,
+	}, {
+		name:        "mac_first",
+		vendorClass: "guest-phone",
+		mac:         net.HardwareAddr{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA},
+		want:        7 * 24 * time.Hour,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, rErr := dhcpv4.NewDiscovery(tc.mac)
+			require.NoError(t, rErr)
+
+			if tc.vendorClass != "" {
+				req.UpdateOption(dhcpv4.OptClassIdentifier(tc.vendorClass))
+			}
+
+			assert.Equal(t, tc.want, s.leaseTimeFor(req))
+
+			resp, rErr := dhcpv4.NewReplyFromRequest(req)
+			require.NoError(t, rErr)
+
+			s.updateOptions(req, resp)
+			assert.Equal(t, tc.want, resp.IPAddressLeaseTime(0))
+		})
+	}
+
+	t.Run("bad", func(t *testing.T) {
+		conf = defaultV4ServerConf()
+		conf.LeaseDurations = []*V4LeaseDuration{{
+			MAC:         "aa:aa:aa:aa:aa:aa",
+			VendorClass: "guest",
+			Duration:    600,
+		}}
+
+		_, err = v4Create(conf)
+		testutil.AssertErrorMsg(
+			t,
+			"dhcpv4: lease duration at index 0: exactly one of mac and vendor_class must be set",
+			err,
+		)
+	})
+}
@@ -0,0 +1,137 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/go-ping/ping"
+)
+
+// probeAddr checks if ip is used by another device than the one with mac.  It
+// sends an ICMP echo request to ip and, if there is no reply, looks for ip in
+// the ARP table, since the kernel resolves it while sending the request.  c is
+// nil if the address is free or the probing is disabled.
+func (s *v4Server) probeAddr(ip netip.Addr, mac net.HardwareAddr) (c *AddrConflict) {
+	if s.conf.ICMPTimeout == 0 {
+		return nil
+	}
+
+	c = &AddrConflict{
+		Time: time.Now(),
+		IP:   ip,
+	}
+
+	if s.pingAddr(ip) {
+		c.Source = ConflictSourceICMP
+		c.MAC = s.neighborMAC(ip)
+	} else if nmac := s.neighborMAC(ip); nmac != nil && !bytes.Equal(nmac, mac) {
+		c.Source = ConflictSourceARP
+		c.MAC = nmac
+	} else {
+		log.Debug("dhcpv4: probing %s: address is free", ip)
+
+		return nil
+	}
+
+	log.Info("dhcpv4: ip conflict: %s is already used by another device (%s)", ip, c.Source)
+
+	return c
+}
+
+// pingAddr sends an ICMP echo request to ip and returns true if there is a
+// reply.  It also returns false on errors.
+func (s *v4Server) pingAddr(ip netip.Addr) (ok bool) {
+	pinger, err := ping.NewPinger(ip.String())
+	if err != nil {
+		log.Error("dhcpv4: ping.NewPinger(): %s", err)
+
+		return false
+	}
+
+	pinger.SetPrivileged(true)
+	pinger.Timeout = time.Duration(s.conf.ICMPTimeout) * time.Millisecond
+	pinger.Count = 1
+	reply := false
+	pinger.OnRecv = func(_ *ping.Packet) {
+		reply = true
+	}
+
+	log.Debug("dhcpv4: sending icmp echo to %s", ip)
+
+	err = pinger.Run()
+	if err != nil {
+		log.Error("dhcpv4: pinger.Run(): %s", err)
+
+		return false
+	}
+
+	return reply
+}
+
+// neighborMAC returns the hardware address of ip from the ARP table, if there
+// is one.
+func (s *v4Server) neighborMAC(ip netip.Addr) (mac net.HardwareAddr) {
+	if s.arpDB == nil {
+		return nil
+	}
+
+	err := s.arpDB.Refresh()
+	if err != nil {
+		log.Debug("dhcpv4: refreshing arp table: %s", err)
+
+		return nil
+	}
+
+	for _, n := range s.arpDB.Neighbors() {
+		if n.IP == ip && !isZeroMAC(n.MAC) {
+			return n.MAC
+		}
+	}
+
+	return nil
+}
+
+// isZeroMAC returns true if mac is empty or consists of zeroes, as it's for
+// the incomplete ARP entries.
+func isZeroMAC(mac net.HardwareAddr) (ok bool) {
+	return !slices.ContainsFunc(mac, func(b byte) (nonZero bool) { return b != 0 })
+}
+
+// Conflicts implements the [DHCPServer] interface for *v4Server.  conflicts
+// are sorted by their addresses.
+func (s *v4Server) Conflicts() (conflicts []*AddrConflict) {
+	now := time.Now()
+
+	func() {
+		s.leasesLock.Lock()
+		defer s.leasesLock.Unlock()
+
+		for ip, c := range s.conflicts {
+			if c.Until.Before(now) {
+				delete(s.conflicts, ip)
+
+				continue
+			}
+
+			clone := *c
+			clone.MAC = slices.Clone(c.MAC)
+			conflicts = append(conflicts, &clone)
+		}
+	}()
+
+	for _, sc := range s.scopes() {
+		conflicts = append(conflicts, sc.Conflicts()...)
+	}
+
+	slices.SortFunc(conflicts, func(a, b *AddrConflict) (res int) {
+		return a.IP.Compare(b.IP)
+	})
+
+	return conflicts
+}
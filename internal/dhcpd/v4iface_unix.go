@@ -0,0 +1,108 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// newIfaceScopes returns the servers of the interface scopes from conf.  conf
+// is expected to be validated.  The networks of the scopes must not overlap
+// with the one of conf nor with the ones of relays.
+func newIfaceScopes(conf *V4ServerConf, relays []*v4Server) (ifaces []*v4Server, err error) {
+	for i, is := range conf.InterfaceScopes {
+		var sc *v4Server
+		sc, err = newIfaceScope(conf, is, slices.Concat(relays, ifaces))
+		if err != nil {
+			return nil, fmt.Errorf("interface scope at index %d: %w", i, err)
+		}
+
+		ifaces = append(ifaces, sc)
+	}
+
+	return ifaces, nil
+}
+
+// newIfaceScope returns the server of the interface scope is.  taken are the
+// servers of the scopes created before.
+func newIfaceScope(
+	conf *V4ServerConf,
+	is *V4InterfaceScope,
+	taken []*v4Server,
+) (sc *v4Server, err error) {
+	if is == nil {
+		return nil, errors.Error("no value")
+	} else if is.InterfaceName == "" {
+		return nil, errors.Error("no interface_name")
+	} else if is.InterfaceName == conf.InterfaceName {
+		return nil, fmt.Errorf("interface %q is used by the server", is.InterfaceName)
+	}
+
+	leaseDur := is.LeaseDuration
+	if leaseDur == 0 {
+		leaseDur = conf.LeaseDuration
+	}
+
+	sc, err = v4Create(&V4ServerConf{
+		Enabled:              conf.Enabled,
+		InterfaceName:        is.InterfaceName,
+		GatewayIP:            is.GatewayIP,
+		SubnetMask:           is.SubnetMask,
+		RangeStart:           is.RangeStart,
+		RangeEnd:             is.RangeEnd,
+		LeaseDuration:        leaseDur,
+		ICMPTimeout:          conf.ICMPTimeout,
+		ConflictHoldDuration: conf.ConflictHoldDuration,
+		Options:              slices.Concat(conf.Options, is.Options),
+		LeaseDurations:       conf.LeaseDurations,
+		OptionSets:           conf.OptionSets,
+		PXE:                  conf.PXE,
+		notify:               conf.notify,
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if sn := sc.conf.subnet; sn.Overlaps(conf.subnet) {
+		return nil, fmt.Errorf("network %s overlaps", sn)
+	}
+
+	for _, prev := range taken {
+		if prev.conf.InterfaceName == is.InterfaceName {
+			return nil, fmt.Errorf("interface %q is used by another scope", is.InterfaceName)
+		} else if sn := sc.conf.subnet; sn.Overlaps(prev.conf.subnet) {
+			return nil, fmt.Errorf("network %s overlaps with %s", sn, prev.conf.subnet)
+		}
+	}
+
+	return sc, nil
+}
+
+// startIfaceScopes starts the servers of the interface scopes.
+func (s *v4Server) startIfaceScopes() (err error) {
+	for _, sc := range s.ifaces {
+		err = sc.Start()
+		if err != nil {
+			return fmt.Errorf("interface scope %s: %w", sc.conf.InterfaceName, err)
+		}
+	}
+
+	return nil
+}
+
+// stopIfaceScopes stops the servers of the interface scopes.
+func (s *v4Server) stopIfaceScopes() (err error) {
+	var errs []error
+	for _, sc := range s.ifaces {
+		err = sc.Stop()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("interface scope %s: %w", sc.conf.InterfaceName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// v4LeaseDuration is the parsed lease duration of certain clients.
+type v4LeaseDuration struct {
+	// mac, if not nil, is the hardware address of the matching client.
+	mac net.HardwareAddr
+
+	// vendorClass, if not empty, is the prefix of the Vendor Class Identifier
+	// of the matching clients.
+	vendorClass string
+
+	// dur is the lease duration.
+	dur time.Duration
+}
+
+// newLeaseDurations parses the lease durations from conf.  The ones for the
+// MAC addresses go first, since they are more specific.
+func newLeaseDurations(conf []*V4LeaseDuration) (durs []*v4LeaseDuration, err error) {
+	var byClass []*v4LeaseDuration
+	for i, c := range conf {
+		var d *v4LeaseDuration
+		d, err = newLeaseDuration(c)
+		if err != nil {
+			return nil, fmt.Errorf("lease duration at index %d: %w", i, err)
+		}
+
+		if d.mac != nil {
+			durs = append(durs, d)
+		} else {
+			byClass = append(byClass, d)
+		}
+	}
+
+	return append(durs, byClass...), nil
+}
+
+// newLeaseDuration parses a single lease duration from c.
+func newLeaseDuration(c *V4LeaseDuration) (d *v4LeaseDuration, err error) {
+	switch {
+	case c == nil:
+		return nil, errors.Error("no value")
+	case c.Duration == 0:
+		return nil, errors.Error("duration must be positive")
+	case (c.MAC == "") == (c.VendorClass == ""):
+		return nil, errors.Error("exactly one of mac and vendor_class must be set")
+	}
+
+	d = &v4LeaseDuration{
+		vendorClass: c.VendorClass,
+		dur:         time.Duration(c.Duration) * time.Second,
+	}
+
+	if c.MAC != "" {
+		d.mac, err = net.ParseMAC(c.MAC)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// leaseTimeFor returns the lease duration for the client sent req.
+func (s *v4Server) leaseTimeFor(req *dhcpv4.DHCPv4) (dur time.Duration) {
+	for _, d := range s.leaseDurations {
+		if d.mac != nil {
+			if bytes.Equal(d.mac, req.ClientHWAddr) {
+				return d.dur
+			}
+		} else if strings.HasPrefix(req.ClassIdentifier(), d.vendorClass) {
+			return d.dur
+		}
+	}
+
+	return s.conf.leaseTime
+}
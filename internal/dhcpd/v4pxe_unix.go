@@ -0,0 +1,95 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"strings"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// pxeVendorClass is the prefix of the Vendor Class Identifier of the PXE
+// clients.
+const pxeVendorClass = "PXEClient"
+
+// The PXE_DISCOVERY_CONTROL vendor sub-option and its value, which makes the
+// clients download the boot file from the ProxyDHCP offer right away instead of
+// discovering the boot servers.
+//
+// See section 2.4.5 of the PXE specification version 2.1.
+const (
+	pxeSubOptDiscoveryControl   byte = 6
+	pxeDiscoveryControlBootFile byte = 0x08
+)
+
+// isPXEClient returns true if req has been sent by a PXE client.
+func isPXEClient(req *dhcpv4.DHCPv4) (ok bool) {
+	return strings.HasPrefix(req.ClassIdentifier(), pxeVendorClass)
+}
+
+// isProxyDHCP returns true if the server should work in the ProxyDHCP mode.
+func (c *V4PXEConf) isProxyDHCP() (ok bool) {
+	return c != nil && c.Enabled && c.ProxyDHCP
+}
+
+// bootFile returns the boot file for the architecture of the client of req.
+func (c *V4PXEConf) bootFile(req *dhcpv4.DHCPv4) (file string) {
+	if c.BootFileUEFI == "" {
+		return c.BootFile
+	}
+
+	archs := req.ClientArch()
+	if len(archs) == 0 || archs[0] == iana.INTEL_X86PC {
+		return c.BootFile
+	}
+
+	return c.BootFileUEFI
+}
+
+// updatePXEOptions sets the network boot parameters of resp, if the client of
+// req is a PXE one.
+func (s *v4Server) updatePXEOptions(req, resp *dhcpv4.DHCPv4) {
+	c := s.conf.PXE
+	if c == nil || !c.Enabled || !isPXEClient(req) {
+		return
+	}
+
+	bootFile := c.bootFile(req)
+	resp.BootFileName = bootFile
+	resp.UpdateOption(dhcpv4.OptBootFileName(bootFile))
+
+	tftpServer := c.TFTPServerName
+	if c.NextServer.IsValid() {
+		resp.ServerIPAddr = c.NextServer.AsSlice()
+		if tftpServer == "" {
+			tftpServer = c.NextServer.String()
+		}
+	}
+
+	resp.UpdateOption(dhcpv4.OptTFTPServerName(tftpServer))
+}
+
+// handleProxy processes req in the ProxyDHCP mode.  It only answers the
+// DHCPDISCOVER messages of the PXE clients with the network boot parameters and
+// doesn't lease any addresses, leaving it to the other DHCP server.  The
+// returned values are the same as the ones of [v4Server.handle].
+func (s *v4Server) handleProxy(req, resp *dhcpv4.DHCPv4) (rCode int) {
+	if req.MessageType() != dhcpv4.MessageTypeDiscover || !isPXEClient(req) {
+		log.Debug("dhcpv4: proxy: ignoring %s from %s", req.MessageType(), req.ClientHWAddr)
+
+		return -1
+	}
+
+	resp.UpdateOption(dhcpv4.OptMessageType(dhcpv4.MessageTypeOffer))
+	resp.UpdateOption(dhcpv4.OptClassIdentifier(pxeVendorClass))
+	resp.UpdateOption(dhcpv4.OptGeneric(
+		dhcpv4.OptionVendorSpecificInformation,
+		[]byte{pxeSubOptDiscoveryControl, 1, pxeDiscoveryControlBootFile},
+	))
+
+	s.updatePXEOptions(req, resp)
+
+	return 1
+}
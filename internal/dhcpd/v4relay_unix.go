@@ -0,0 +1,192 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// newRelayScopes returns the servers of the relay scopes from conf.  conf is
+// expected to be validated.
+func newRelayScopes(conf *V4ServerConf) (relays []*v4Server, err error) {
+	for i, rs := range conf.RelayScopes {
+		if rs == nil {
+			return nil, fmt.Errorf("relay scope at index %d: no value", i)
+		}
+
+		var r *v4Server
+		r, err = v4Create(&V4ServerConf{
+			Enabled:              conf.Enabled,
+			InterfaceName:        conf.InterfaceName,
+			GatewayIP:            rs.GatewayIP,
+			SubnetMask:           rs.SubnetMask,
+			RangeStart:           rs.RangeStart,
+			RangeEnd:             rs.RangeEnd,
+			LeaseDuration:        conf.LeaseDuration,
+			ICMPTimeout:          conf.ICMPTimeout,
+			ConflictHoldDuration: conf.ConflictHoldDuration,
+			Options:              slices.Concat(conf.Options, rs.Options),
+			LeaseDurations:       conf.LeaseDurations,
+			OptionSets:           conf.OptionSets,
+			PXE:                  conf.PXE,
+			notify:               conf.notify,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("relay scope at index %d: %w", i, err)
+		}
+
+		if sn := r.conf.subnet; sn.Overlaps(conf.subnet) {
+			return nil, fmt.Errorf("relay scope at index %d: network %s overlaps", i, sn)
+		}
+
+		for j, prev := range relays {
+			if sn := r.conf.subnet; sn.Overlaps(prev.conf.subnet) {
+				return nil, fmt.Errorf(
+					"relay scope at index %d: network %s overlaps with the one at index %d",
+					i,
+					sn,
+					j,
+				)
+			}
+		}
+
+		relays = append(relays, r)
+	}
+
+	return relays, nil
+}
+
+// isRelayed returns true if req has been relayed by a relay agent.
+func isRelayed(req *dhcpv4.DHCPv4) (ok bool) {
+	return req.GatewayIPAddr != nil && !req.GatewayIPAddr.IsUnspecified()
+}
+
+// relayAgentIDs returns the Agent Circuit ID and the Agent Remote ID from the
+// Relay Agent Information option of req, if any.
+func relayAgentIDs(req *dhcpv4.DHCPv4) (circuitID, remoteID string) {
+	rai := req.RelayAgentInfo()
+	if rai == nil {
+		return "", ""
+	}
+
+	return relayAgentIDString(rai.Get(dhcpv4.AgentCircuitIDSubOption)),
+		relayAgentIDString(rai.Get(dhcpv4.AgentRemoteIDSubOption))
+}
+
+// relayAgentIDString returns id itself if it's printable or its hex encoding
+// otherwise.
+func relayAgentIDString(id []byte) (s string) {
+	for _, b := range id {
+		if b < ' ' || b > '~' {
+			return hex.EncodeToString(id)
+		}
+	}
+
+	return string(id)
+}
+
+// scopeForRelayed returns the server of the scope for the relayed request req.
+// The scope selected by the Relay Agent Information option is preferred over
+// the one containing the address of the relay agent.  srv is nil if there is
+// no such scope.
+func (s *v4Server) scopeForRelayed(req *dhcpv4.DHCPv4) (srv *v4Server) {
+	circuitID, remoteID := relayAgentIDs(req)
+	for i, rs := range s.conf.RelayScopes {
+		if (rs.CircuitID != "" && rs.CircuitID == circuitID) ||
+			(rs.RemoteID != "" && rs.RemoteID == remoteID) {
+			return s.relays[i]
+		}
+	}
+
+	giaddr, ok := netip.AddrFromSlice(req.GatewayIPAddr.To4())
+	if !ok {
+		return nil
+	}
+
+	for _, r := range s.relays {
+		if r.conf.subnet.Contains(giaddr) {
+			return r
+		}
+	}
+
+	if s.conf.subnet.Contains(giaddr) {
+		return s
+	}
+
+	return nil
+}
+
+// scopeFor returns the server of the scope which network contains ip.  It
+// returns s if none of the relay and interface scopes does.
+func (s *v4Server) scopeFor(ip netip.Addr) (srv *v4Server) {
+	for _, sc := range s.scopes() {
+		if sc.conf.subnet.Contains(ip) {
+			return sc
+		}
+	}
+
+	return s
+}
+
+// scopes returns the servers of both the relay and the interface scopes.
+func (s *v4Server) scopes() (scopes []*v4Server) {
+	return slices.Concat(s.relays, s.ifaces)
+}
+
+// echoRelayAgentInfo copies the Relay Agent Information option from req to
+// resp, as required for the relay agent to forward resp to the client.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3046#section-2.2.
+func echoRelayAgentInfo(req, resp *dhcpv4.DHCPv4) {
+	if rai := req.Options.Get(dhcpv4.OptionRelayAgentInformation); rai != nil {
+		resp.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionRelayAgentInformation, rai))
+	}
+}
+
+// scopesLeases returns the leases of the relay and interface scopes filtered
+// with flags.
+func (s *v4Server) scopesLeases(flags GetLeasesFlags) (leases []*dhcpsvc.Lease) {
+	for _, sc := range s.scopes() {
+		leases = append(leases, sc.GetLeases(flags)...)
+	}
+
+	return leases
+}
+
+// resetScopesLeases resets the leases of the relay and interface scopes to the
+// ones from leases within their networks and returns the rest.
+func (s *v4Server) resetScopesLeases(leases []*dhcpsvc.Lease) (rest []*dhcpsvc.Lease) {
+	scopes := s.scopes()
+	byScope := make(map[*v4Server][]*dhcpsvc.Lease, len(scopes))
+	for _, l := range leases {
+		srv := s.scopeFor(l.IP)
+		if srv == s {
+			rest = append(rest, l)
+		} else {
+			byScope[srv] = append(byScope[srv], l)
+		}
+	}
+
+	for _, sc := range scopes {
+		// Don't check the error, since it's always nil for a configured
+		// server.
+		_ = sc.ResetLeases(byScope[sc])
+	}
+
+	return rest
+}
+
+// configureRelaysDNSIPAddrs sets the addresses of the DNS server of the relay
+// scopes.
+func (s *v4Server) configureRelaysDNSIPAddrs(dnsIPAddrs []net.IP) {
+	for _, r := range s.relays {
+		r.configureDNSIPAddrs(dnsIPAddrs)
+	}
+}
@@ -35,6 +35,15 @@ type v6Server struct {
 	leases     []*dhcpsvc.Lease
 	leasesLock sync.Mutex
 	ipAddrs    [256]byte
+
+	// reservations are the reservations from the configuration by the DUIDs
+	// of the clients.  It must not be modified after the creation.
+	reservations map[string]*V6Reservation
+
+	// pdLeases are the delegated prefixes.  It's protected by leasesLock.
+	//
+	// TODO(e.burkov):  Store them in the leases database.
+	pdLeases []*v6PDLease
 }
 
 // WriteDiskConfig4 - write configuration
@@ -73,6 +82,18 @@ func (s *v6Server) HostByIP(ip netip.Addr) (host string) {
 	return ""
 }
 
+// FingerprintByIP implements the [DHCPServer] interface for *v6Server.  The
+// fingerprints aren't collected for the DHCPv6 clients, so fp is always empty.
+func (s *v6Server) FingerprintByIP(_ netip.Addr) (fp dhcpsvc.Fingerprint) {
+	return dhcpsvc.Fingerprint{}
+}
+
+// Conflicts implements the [DHCPServer] interface for *v6Server.  The address
+// conflicts aren't detected for DHCPv6, so conflicts is always nil.
+func (s *v6Server) Conflicts() (conflicts []*AddrConflict) {
+	return nil
+}
+
 // IPByHost implements the [Interface] interface for *v6Server.
 func (s *v6Server) IPByHost(host string) (ip netip.Addr) {
 	s.leasesLock.Lock()
@@ -349,7 +370,9 @@ func (s *v6Server) findFreeIP() net.IP {
 			ip := make([]byte, 16)
 			copy(ip, s.conf.ipStart)
 			ip[15] = i
-			return ip
+			if !s.isReservedIP(ip) {
+				return ip
+			}
 		}
 		if i == 0xff {
 			break
@@ -358,6 +381,18 @@ func (s *v6Server) findFreeIP() net.IP {
 	return nil
 }
 
+// isReservedIP returns true if ip is reserved for any client.
+func (s *v6Server) isReservedIP(ip net.IP) (ok bool) {
+	addr, _ := netip.AddrFromSlice(ip)
+	for _, r := range s.reservations {
+		if r.IP == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Reserve lease for MAC
 func (s *v6Server) reserveLease(mac net.HardwareAddr) *dhcpsvc.Lease {
 	l := dhcpsvc.Lease{
@@ -488,7 +523,7 @@ func (s *v6Server) commitLease(msg *dhcpv6.Message, lease *dhcpsvc.Lease) time.D
 	return lifetime
 }
 
-// Find a lease associated with MAC and prepare response
+// Find a lease associated with the client and prepare response
 func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 	switch msg.Type() {
 	case dhcpv6.MessageTypeSolicit,
@@ -502,14 +537,63 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 		return false
 	}
 
+	var duid string
+	if cid := msg.Options.ClientID(); cid != nil {
+		duid = string(cid.ToBytes())
+	}
+
+	// Routers may only request a prefix, so only assign an address if it's
+	// requested or if nothing else is.
+	reqPD := msg.Options.OneIAPD()
+	if reqPD == nil || msg.Options.OneIANA() != nil {
+		if !s.processIANA(msg, req, resp, duid) {
+			return false
+		}
+	}
+
+	if reqPD != nil {
+		s.processIAPD(msg, reqPD, resp, duid)
+	}
+
+	if msg.IsOptionRequested(dhcpv6.OptionDNSRecursiveNameServer) {
+		resp.UpdateOption(dhcpv6.OptDNS(s.conf.dnsIPAddrs...))
+	}
+
+	fqdn := msg.GetOneOption(dhcpv6.OptionFQDN)
+	if fqdn != nil {
+		resp.AddOption(fqdn)
+	}
+
+	resp.AddOption(&dhcpv6.OptStatusCode{
+		StatusCode:    iana.StatusSuccess,
+		StatusMessage: "success",
+	})
+	return true
+}
+
+// findIANALease returns the lease of the client with duid, reserving a new one
+// for a Solicit message if necessary.  It returns nil if there is no lease for
+// the client.
+func (s *v6Server) findIANALease(
+	msg *dhcpv6.Message,
+	req dhcpv6.DHCPv6,
+	duid string,
+) (lease *dhcpsvc.Lease) {
+	if r := s.reservations[duid]; r != nil && r.IP.IsValid() {
+		return &dhcpsvc.Lease{
+			Hostname: r.Hostname,
+			IP:       r.IP,
+			IsStatic: true,
+		}
+	}
+
 	mac, err := dhcpv6.ExtractMAC(req)
 	if err != nil {
 		log.Debug("dhcpv6: dhcpv6.ExtractMAC: %s", err)
 
-		return false
+		return nil
 	}
 
-	var lease *dhcpsvc.Lease
 	func() {
 		s.leasesLock.Lock()
 		defer s.leasesLock.Unlock()
@@ -520,20 +604,28 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 	if lease == nil {
 		log.Debug("dhcpv6: no lease for: %s", mac)
 
-		switch msg.Type() {
-
-		case dhcpv6.MessageTypeSolicit:
+		if msg.Type() == dhcpv6.MessageTypeSolicit {
 			lease = s.reserveLease(mac)
-			if lease == nil {
-				return false
-			}
-
-		default:
-			return false
 		}
 	}
 
-	err = s.checkIA(msg, lease)
+	return lease
+}
+
+// processIANA adds the IA_NA option with the address of the client with duid
+// to resp.  It returns false if there is no valid address for the client.
+func (s *v6Server) processIANA(
+	msg *dhcpv6.Message,
+	req dhcpv6.DHCPv6,
+	resp dhcpv6.DHCPv6,
+	duid string,
+) (ok bool) {
+	lease := s.findIANALease(msg, req, duid)
+	if lease == nil {
+		return false
+	}
+
+	err := s.checkIA(msg, lease)
 	if err != nil {
 		log.Debug("dhcpv6: %s", err)
 
@@ -562,19 +654,6 @@ func (s *v6Server) process(msg *dhcpv6.Message, req, resp dhcpv6.DHCPv6) bool {
 	}
 	resp.AddOption(oia)
 
-	if msg.IsOptionRequested(dhcpv6.OptionDNSRecursiveNameServer) {
-		resp.UpdateOption(dhcpv6.OptDNS(s.conf.dnsIPAddrs...))
-	}
-
-	fqdn := msg.GetOneOption(dhcpv6.OptionFQDN)
-	if fqdn != nil {
-		resp.AddOption(fqdn)
-	}
-
-	resp.AddOption(&dhcpv6.OptStatusCode{
-		StatusCode:    iana.StatusSuccess,
-		StatusMessage: "success",
-	})
 	return true
 }
 
@@ -807,5 +886,15 @@ func v6Create(conf V6ServerConf) (DHCPServer, error) {
 		s.conf.leaseTime = time.Second * time.Duration(conf.LeaseDuration)
 	}
 
+	err := s.conf.validatePD()
+	if err != nil {
+		return s, fmt.Errorf("dhcpv6: %w", err)
+	}
+
+	err = s.initReservations()
+	if err != nil {
+		return s, fmt.Errorf("dhcpv6: %w", err)
+	}
+
 	return s, nil
 }
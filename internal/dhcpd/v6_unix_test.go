@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/insomniacslk/dhcp/iana"
 	"github.com/stretchr/testify/assert"
@@ -380,3 +381,152 @@ func TestV6_FindMACbyIP(t *testing.T) {
 		})
 	}
 }
+
+func TestV6_prefixDelegation(t *testing.T) {
+	const reservedDUID = "00:03:00:01:bb:bb:bb:bb:bb:bb"
+
+	sIface, err := v6Create(V6ServerConf{
+		Enabled:     true,
+		RangeStart:  net.ParseIP("2001::1"),
+		PDPrefix:    netip.MustParsePrefix("2001:db8::/62"),
+		PDPrefixLen: 63,
+		Reservations: []*V6Reservation{{
+			DUID:   reservedDUID,
+			IP:     netip.MustParseAddr("2001::2"),
+			Prefix: netip.MustParsePrefix("2001:db8:ffff::/48"),
+		}},
+		notify: notify6,
+	})
+	require.NoError(t, err)
+
+	s, ok := sIface.(*v6Server)
+	require.True(t, ok)
+
+	// solicit sends a Solicit with an IA_PD option from the client with mac
+	// and returns the response.
+	solicit := func(t *testing.T, mac net.HardwareAddr) (resp *dhcpv6.Message) {
+		t.Helper()
+
+		duid := &dhcpv6.DUIDLL{
+			HWType:        iana.HWTypeEthernet,
+			LinkLayerAddr: mac,
+		}
+
+		req, sErr := dhcpv6.NewSolicit(
+			mac,
+			dhcpv6.WithClientID(duid),
+			dhcpv6.WithIAPD([4]byte{1, 2, 3, 4}),
+		)
+		require.NoError(t, sErr)
+
+		resp, sErr = dhcpv6.NewAdvertiseFromSolicit(req)
+		require.NoError(t, sErr)
+
+		require.True(t, s.process(req, req, resp))
+
+		return resp
+	}
+
+	// delegated returns the prefix from the IA_PD option of resp.
+	delegated := func(t *testing.T, resp *dhcpv6.Message) (p string) {
+		t.Helper()
+
+		opd := resp.Options.OneIAPD()
+		require.NotNil(t, opd)
+
+		prefixes := opd.Options.Prefixes()
+		if len(prefixes) == 0 {
+			return ""
+		}
+
+		return prefixes[0].Prefix.String()
+	}
+
+	t.Run("reserved", func(t *testing.T) {
+		resp := solicit(t, net.HardwareAddr{0xBB, 0xBB, 0xBB, 0xBB, 0xBB, 0xBB})
+
+		assert.Equal(t, "2001:db8:ffff::/48", delegated(t, resp))
+		assert.Equal(t, net.ParseIP("2001::2"), resp.Options.OneIANA().Options.OneAddress().IPv6Addr)
+	})
+
+	macs := []net.HardwareAddr{
+		{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0x01},
+		{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0x02},
+		{0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0x03},
+	}
+
+	t.Run("dynamic", func(t *testing.T) {
+		assert.Equal(t, "2001:db8::/63", delegated(t, solicit(t, macs[0])))
+		assert.Equal(t, "2001:db8:0:2::/63", delegated(t, solicit(t, macs[1])))
+		assert.Equal(t, "2001:db8::/63", delegated(t, solicit(t, macs[0])))
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		for _, l := range s.pdLeases {
+			l.expiry = time.Now().Add(time.Hour)
+		}
+
+		resp := solicit(t, macs[2])
+		assert.Empty(t, delegated(t, resp))
+
+		opd := resp.Options.OneIAPD()
+		require.NotNil(t, opd.Options.Status())
+
+		assert.Equal(t, iana.StatusNoPrefixAvail, opd.Options.Status().StatusCode)
+	})
+}
+
+func TestV6Create_badConf(t *testing.T) {
+	testCases := []struct {
+		conf       V6ServerConf
+		name       string
+		wantErrMsg string
+	}{{
+		conf: V6ServerConf{
+			PDPrefix:    netip.MustParsePrefix("2001:db8::/64"),
+			PDPrefixLen: 64,
+		},
+		name:       "bad_pd_len",
+		wantErrMsg: "dhcpv6: pd prefix length 64 must be within (64, 64]",
+	}, {
+		conf: V6ServerConf{
+			Reservations: []*V6Reservation{{
+				DUID: "00:zz",
+				IP:   netip.MustParseAddr("2001::2"),
+			}},
+		},
+		name: "bad_duid",
+		wantErrMsg: `dhcpv6: reservation at index 0: bad duid "00:zz": ` +
+			`encoding/hex: invalid byte: U+007A 'z'`,
+	}, {
+		conf: V6ServerConf{
+			Reservations: []*V6Reservation{{
+				DUID: "00:01",
+				IP:   netip.MustParseAddr("2001::2"),
+			}, {
+				DUID: "0001",
+				IP:   netip.MustParseAddr("2001::3"),
+			}},
+		},
+		name:       "duplicate",
+		wantErrMsg: `dhcpv6: reservation at index 1: duplicate duid "0001"`,
+	}, {
+		conf: V6ServerConf{
+			Reservations: []*V6Reservation{{
+				DUID: "00:01",
+			}},
+		},
+		name:       "empty",
+		wantErrMsg: "dhcpv6: reservation at index 0: no ip or prefix",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.conf.Enabled = true
+			tc.conf.RangeStart = net.ParseIP("2001::1")
+
+			_, err := v6Create(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+//go:build darwin || freebsd || linux || openbsd
+
+package dhcpd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+const (
+	// defaultPDPrefixLen is the default length of the delegated prefixes.
+	defaultPDPrefixLen = 64
+
+	// maxPDPoolSize is the maximum number of the prefixes in the delegation
+	// pool.
+	maxPDPoolSize = 1 << 16
+)
+
+// v6PDLease is a prefix delegated to a requesting router.
+type v6PDLease struct {
+	// expiry is the expiration time of the lease.
+	expiry time.Time
+
+	// duid is the DUID of the router.
+	duid string
+
+	// prefix is the delegated prefix.
+	prefix netip.Prefix
+
+	// isStatic is true if the prefix is reserved for the router.
+	isStatic bool
+}
+
+// initReservations validates the reservations from the configuration and
+// indexes them by the DUIDs.
+func (s *v6Server) initReservations() (err error) {
+	s.reservations = make(map[string]*V6Reservation, len(s.conf.Reservations))
+	for i, r := range s.conf.Reservations {
+		var duid []byte
+		duid, err = r.validate()
+		if err != nil {
+			return fmt.Errorf("reservation at index %d: %w", i, err)
+		}
+
+		if _, ok := s.reservations[string(duid)]; ok {
+			return fmt.Errorf("reservation at index %d: duplicate duid %q", i, r.DUID)
+		}
+
+		s.reservations[string(duid)] = r
+	}
+
+	return nil
+}
+
+// validatePD returns an error if the prefix delegation configuration is
+// invalid.  It also sets the default length of the delegated prefixes.
+func (c *V6ServerConf) validatePD() (err error) {
+	if !c.PDPrefix.IsValid() {
+		return nil
+	}
+
+	if !c.PDPrefix.Addr().Is6() {
+		return fmt.Errorf("pd prefix %s is not an ipv6 prefix", c.PDPrefix)
+	}
+
+	c.PDPrefix = c.PDPrefix.Masked()
+	if c.PDPrefixLen == 0 {
+		c.PDPrefixLen = defaultPDPrefixLen
+	}
+
+	if c.PDPrefixLen <= c.PDPrefix.Bits() || c.PDPrefixLen > defaultPDPrefixLen {
+		return fmt.Errorf(
+			"pd prefix length %d must be within (%d, %d]",
+			c.PDPrefixLen,
+			c.PDPrefix.Bits(),
+			defaultPDPrefixLen,
+		)
+	}
+
+	return nil
+}
+
+// pdPoolSize returns the number of the prefixes in the delegation pool.
+func (s *v6Server) pdPoolSize() (n int) {
+	if !s.conf.PDPrefix.IsValid() {
+		return 0
+	}
+
+	bits := s.conf.PDPrefixLen - s.conf.PDPrefix.Bits()
+	if bits >= 16 {
+		return maxPDPoolSize
+	}
+
+	return 1 << bits
+}
+
+// nthPDPrefix returns the delegated prefix with index i within the pool.
+func (s *v6Server) nthPDPrefix(i int) (p netip.Prefix) {
+	a := s.conf.PDPrefix.Addr().As16()
+	hi := binary.BigEndian.Uint64(a[:8]) + uint64(i)<<(64-s.conf.PDPrefixLen)
+	binary.BigEndian.PutUint64(a[:8], hi)
+
+	return netip.PrefixFrom(netip.AddrFrom16(a), s.conf.PDPrefixLen)
+}
+
+// isReservedPrefix returns true if p overlaps with any of the reserved
+// prefixes.
+func (s *v6Server) isReservedPrefix(p netip.Prefix) (ok bool) {
+	for _, r := range s.reservations {
+		if r.Prefix.IsValid() && r.Prefix.Overlaps(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findPDLease returns the prefix delegated to the router with duid, reserving
+// a free one if necessary.  It returns nil if there are no free prefixes.
+// s.leasesLock is expected to be locked.
+func (s *v6Server) findPDLease(duid string, now time.Time) (l *v6PDLease) {
+	if r := s.reservations[duid]; r != nil && r.Prefix.IsValid() {
+		return &v6PDLease{
+			duid:     duid,
+			prefix:   r.Prefix,
+			isStatic: true,
+		}
+	}
+
+	var expired *v6PDLease
+	used := make(map[netip.Prefix]struct{}, len(s.pdLeases))
+	for _, pl := range s.pdLeases {
+		if pl.duid == duid {
+			return pl
+		}
+
+		used[pl.prefix] = struct{}{}
+		if expired == nil && !pl.expiry.After(now) {
+			expired = pl
+		}
+	}
+
+	for i, n := 0, s.pdPoolSize(); i < n; i++ {
+		p := s.nthPDPrefix(i)
+		if _, ok := used[p]; ok || s.isReservedPrefix(p) {
+			continue
+		}
+
+		l = &v6PDLease{
+			duid:   duid,
+			prefix: p,
+		}
+		s.pdLeases = append(s.pdLeases, l)
+
+		return l
+	}
+
+	if expired != nil {
+		expired.duid = duid
+	}
+
+	return expired
+}
+
+// processIAPD adds the IA_PD option with the prefix delegated to the router
+// with duid to resp.  reqPD is the IA_PD option of the request msg.
+func (s *v6Server) processIAPD(
+	msg *dhcpv6.Message,
+	reqPD *dhcpv6.OptIAPD,
+	resp dhcpv6.DHCPv6,
+	duid string,
+) {
+	lifetime := s.conf.leaseTime
+	now := time.Now()
+
+	var l *v6PDLease
+	func() {
+		s.leasesLock.Lock()
+		defer s.leasesLock.Unlock()
+
+		l = s.findPDLease(duid, now)
+		if l == nil || l.isStatic {
+			return
+		}
+
+		switch msg.Type() {
+		case dhcpv6.MessageTypeRequest,
+			dhcpv6.MessageTypeRenew,
+			dhcpv6.MessageTypeRebind:
+			l.expiry = now.Add(lifetime)
+		}
+	}()
+
+	opd := &dhcpv6.OptIAPD{
+		IaId: reqPD.IaId,
+	}
+	defer resp.AddOption(opd)
+
+	if l == nil {
+		opd.Options.Add(&dhcpv6.OptStatusCode{
+			StatusCode:    iana.StatusNoPrefixAvail,
+			StatusMessage: "no prefixes available",
+		})
+
+		return
+	}
+
+	opd.T1 = lifetime / 2
+	opd.T2 = time.Duration(float32(lifetime) / 1.5)
+	opd.Options.Add(&dhcpv6.OptIAPrefix{
+		PreferredLifetime: lifetime,
+		ValidLifetime:     lifetime,
+		Prefix: &net.IPNet{
+			IP:   l.prefix.Addr().AsSlice(),
+			Mask: net.CIDRMask(l.prefix.Bits(), netutil.IPv6BitLen),
+		},
+	})
+}
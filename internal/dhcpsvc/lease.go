@@ -27,10 +27,56 @@ type Lease struct {
 	// HWAddr is the physical hardware address (MAC address).
 	HWAddr net.HardwareAddr
 
+	// Routes are the classless static routes sent to the client.  They are
+	// only supported for the static DHCPv4 leases.
+	Routes []Route
+
+	// Options are the DHCP options sent to the client in the format of the
+	// options of the DHCPv4 server, for example "42 ips 192.168.1.1".  They
+	// override the options of the server and are only supported for the
+	// static DHCPv4 leases.
+	Options []string
+
+	// CircuitID is the Agent Circuit ID of the relay agent which has relayed
+	// the last request of the client, if any.  It's the ID itself if it's
+	// printable or its hex encoding otherwise.
+	CircuitID string
+
+	// RemoteID is the Agent Remote ID of the relay agent which has relayed the
+	// last request of the client, if any.  It's encoded like CircuitID.
+	RemoteID string
+
+	// Fingerprint is the DHCP fingerprint from the last request of the
+	// client.  It's only collected by the DHCPv4 server.
+	Fingerprint Fingerprint
+
 	// IsStatic defines if the lease is static.
 	IsStatic bool
 }
 
+// Fingerprint is the DHCP fingerprint of a client, which may be used to guess
+// its device type and operating system.
+type Fingerprint struct {
+	// ParamList is the Parameter Request List, the option 55, as a
+	// comma-separated list of decimal option codes in the order requested by
+	// the client, for example "1,3,6,15".
+	ParamList string
+
+	// VendorClass is the Vendor Class Identifier, the option 60.
+	VendorClass string
+}
+
+// Route is a classless static route.
+//
+// See https://datatracker.ietf.org/doc/html/rfc3442.
+type Route struct {
+	// Dest is the destination network.
+	Dest netip.Prefix
+
+	// Router is the address of the router for Dest.
+	Router netip.Addr
+}
+
 // Clone returns a deep copy of l.
 func (l *Lease) Clone() (clone *Lease) {
 	if l == nil {
@@ -38,11 +84,16 @@ func (l *Lease) Clone() (clone *Lease) {
 	}
 
 	return &Lease{
-		Expiry:   l.Expiry,
-		Hostname: l.Hostname,
-		HWAddr:   slices.Clone(l.HWAddr),
-		IP:       l.IP,
-		IsStatic: l.IsStatic,
+		Expiry:      l.Expiry,
+		Hostname:    l.Hostname,
+		HWAddr:      slices.Clone(l.HWAddr),
+		IP:          l.IP,
+		Routes:      slices.Clone(l.Routes),
+		Options:     slices.Clone(l.Options),
+		CircuitID:   l.CircuitID,
+		RemoteID:    l.RemoteID,
+		Fingerprint: l.Fingerprint,
+		IsStatic:    l.IsStatic,
 	}
 }
 
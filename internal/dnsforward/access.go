@@ -1,6 +1,7 @@
 package dnsforward
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/golibs/container"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -46,7 +48,7 @@ func processAccessClients(
 	for i, s := range clientStrs {
 		var ip netip.Addr
 		var ipnet netip.Prefix
-		if ip, err = netip.ParseAddr(s); err == nil {
+		if ip, err = aghnet.ParseAddr(s); err == nil {
 			ips.Add(ip)
 		} else if ipnet, err = netip.ParsePrefix(s); err == nil {
 			*nets = append(*nets, ipnet)
@@ -127,6 +129,34 @@ func (a *accessManager) isBlockedClientID(id string) (ok bool) {
 	return a.blockedClientIDs.Has(id)
 }
 
+// isBlockedClient returns true if the client with ip or clientID is blocked by
+// a.
+func (a *accessManager) isBlockedClient(ip netip.Addr, clientID string) (blocked bool, rule string) {
+	blockedByIP := false
+	if ip != (netip.Addr{}) {
+		blockedByIP, rule = a.isBlockedIP(ip)
+	}
+
+	allowlistMode := a.allowlistMode()
+	blockedByClientID := a.isBlockedClientID(clientID)
+
+	// Allow if at least one of the checks allows in allowlist mode, but block
+	// if at least one of the checks blocks in blocklist mode.
+	if allowlistMode && blockedByIP && blockedByClientID {
+		log.Debug("dnsforward: client %v (id %q) is not in access allowlist", ip, clientID)
+
+		// Return now without substituting the empty rule for the
+		// clientID because the rule can't be empty here.
+		return true, rule
+	} else if !allowlistMode && (blockedByIP || blockedByClientID) {
+		log.Debug("dnsforward: client %v (id %q) is in access blocklist", ip, clientID)
+
+		blocked = true
+	}
+
+	return blocked, cmp.Or(rule, clientID)
+}
+
 // isBlockedHost returns true if host should be blocked.
 func (a *accessManager) isBlockedHost(host string, qt rules.RRType) (ok bool) {
 	_, ok = a.blockedHostsEng.MatchRequest(&urlfilter.DNSRequest{
@@ -237,19 +267,38 @@ func (s *Server) handleAccessSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = validateAccessSet(list)
+	err = s.setAccessList(list)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, err.Error())
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
 
 		return
 	}
 
-	var a *accessManager
-	a, err = newAccessCtx(list.AllowedClients, list.DisallowedClients, list.BlockedHosts)
+	s.conf.ConfigModified()
+}
+
+// SetAccessLists replaces the allowed clients, the disallowed clients, and the
+// blocked hosts of the running server.
+func (s *Server) SetAccessLists(allowed, disallowed, blockedHosts []string) (err error) {
+	// Don't wrap the error since it's informative enough as is.
+	return s.setAccessList(&accessListJSON{
+		AllowedClients:    allowed,
+		DisallowedClients: disallowed,
+		BlockedHosts:      blockedHosts,
+	})
+}
+
+// setAccessList validates list and replaces the access settings with it.
+func (s *Server) setAccessList(list *accessListJSON) (err error) {
+	err = validateAccessSet(list)
 	if err != nil {
-		aghhttp.Error(r, w, http.StatusBadRequest, "creating access ctx: %s", err)
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
 
-		return
+	a, err := newAccessCtx(list.AllowedClients, list.DisallowedClients, list.BlockedHosts)
+	if err != nil {
+		return fmt.Errorf("creating access ctx: %w", err)
 	}
 
 	defer log.Debug(
@@ -259,8 +308,6 @@ func (s *Server) handleAccessSet(w http.ResponseWriter, r *http.Request) {
 		len(list.BlockedHosts),
 	)
 
-	defer s.conf.ConfigModified()
-
 	s.serverLock.Lock()
 	defer s.serverLock.Unlock()
 
@@ -268,4 +315,6 @@ func (s *Server) handleAccessSet(w http.ResponseWriter, r *http.Request) {
 	s.conf.DisallowedClients = list.DisallowedClients
 	s.conf.BlockedHosts = list.BlockedHosts
 	s.access = a
+
+	return nil
 }
@@ -0,0 +1,242 @@
+package dnsforward
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+)
+
+const (
+	// activityMaxClients is the maximum number of the clients which activity
+	// is tracked.  The least recently seen client is evicted once the limit
+	// is reached.
+	activityMaxClients = 1000
+
+	// activityRecentSize is the number of the recent queries of a client the
+	// protocol mix and the top domains are calculated from.
+	activityRecentSize = 100
+
+	// activityWindow is the number of seconds the rolling QPS of a client is
+	// calculated over.
+	activityWindow = 60
+
+	// activityTopDomains is the maximum number of the top domains reported.
+	activityTopDomains = 10
+)
+
+// activityQuery is a recent query of a client.
+type activityQuery struct {
+	// host is the requested domain name.
+	host string
+
+	// proto is the protocol of the query.
+	proto querylog.ClientProto
+}
+
+// activityClient is the recent activity of a single client.
+type activityClient struct {
+	// lastSeen is the time of the last query.
+	lastSeen time.Time
+
+	// recent is the ring buffer of the recent queries.
+	recent []activityQuery
+
+	// secs are the Unix times of the seconds which numbers of queries are in
+	// counts.
+	secs [activityWindow]int64
+
+	// counts are the numbers of queries within the seconds from secs.
+	counts [activityWindow]uint64
+
+	// next is the index in recent the next query is written at.
+	next int
+}
+
+// add records the query with host and proto received at now.
+func (c *activityClient) add(host string, proto querylog.ClientProto, now time.Time) {
+	c.lastSeen = now
+
+	q := activityQuery{
+		host:  host,
+		proto: proto,
+	}
+	if len(c.recent) < activityRecentSize {
+		c.recent = append(c.recent, q)
+	} else {
+		c.recent[c.next] = q
+	}
+
+	c.next = (c.next + 1) % activityRecentSize
+
+	sec := now.Unix()
+	i := sec % activityWindow
+	if c.secs[i] != sec {
+		c.secs[i], c.counts[i] = sec, 0
+	}
+
+	c.counts[i]++
+}
+
+// qps returns the average number of queries per second within the window
+// before now.
+func (c *activityClient) qps(now time.Time) (qps float64) {
+	sec := now.Unix()
+
+	var n uint64
+	for i, s := range c.secs {
+		if s > sec-activityWindow && s <= sec {
+			n += c.counts[i]
+		}
+	}
+
+	return float64(n) / activityWindow
+}
+
+// clientActivity tracks the recent activity of the clients.  It's safe for
+// concurrent use.
+type clientActivity struct {
+	// mu protects clients.
+	mu *sync.Mutex
+
+	// clients is the activity of the clients by their ClientIDs or IP
+	// addresses.
+	clients map[string]*activityClient
+}
+
+// newClientActivity returns a new empty activity tracker.
+func newClientActivity() (a *clientActivity) {
+	return &clientActivity{
+		mu:      &sync.Mutex{},
+		clients: map[string]*activityClient{},
+	}
+}
+
+// add records the query for host received from the client with id using
+// proto at now.
+func (a *clientActivity) add(id, host string, proto querylog.ClientProto, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.clients[id]
+	if !ok {
+		if len(a.clients) >= activityMaxClients {
+			a.evictLocked()
+		}
+
+		c = &activityClient{}
+		a.clients[id] = c
+	}
+
+	c.add(host, proto, now)
+}
+
+// evictLocked removes the least recently seen client.  a.mu is expected to be
+// locked.
+func (a *clientActivity) evictLocked() {
+	var (
+		oldestID string
+		oldest   time.Time
+	)
+
+	for id, c := range a.clients {
+		if oldestID == "" || c.lastSeen.Before(oldest) {
+			oldestID, oldest = id, c.lastSeen
+		}
+	}
+
+	delete(a.clients, oldestID)
+}
+
+// activityDomainJSON is the number of the recent queries for a domain.
+type activityDomainJSON struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// activityResp is the response to the GET /control/clients/activity HTTP API.
+type activityResp struct {
+	// LastSeen is the time of the last query of the client.
+	LastSeen time.Time `json:"last_seen"`
+
+	// Protocols are the numbers of the recent queries by protocol.
+	Protocols map[string]uint64 `json:"protocols"`
+
+	// ID is the ClientID or the IP address of the client.
+	ID string `json:"id"`
+
+	// TopDomains are the most requested domains among the recent queries.
+	TopDomains []*activityDomainJSON `json:"top_domains"`
+
+	// QPS is the average number of queries per second within the last
+	// minute.
+	QPS float64 `json:"qps"`
+}
+
+// report returns the activity of the client with id at now.  ok is false if
+// there is no activity of the client.
+func (a *clientActivity) report(id string, now time.Time) (resp *activityResp, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.clients[id]
+	if !ok {
+		return nil, false
+	}
+
+	resp = &activityResp{
+		LastSeen:  c.lastSeen,
+		Protocols: map[string]uint64{},
+		ID:        id,
+		QPS:       c.qps(now),
+	}
+
+	hosts := map[string]uint64{}
+	for _, q := range c.recent {
+		resp.Protocols[cmp.Or(string(q.proto), "dns")]++
+		hosts[q.host]++
+	}
+
+	for host, n := range hosts {
+		resp.TopDomains = append(resp.TopDomains, &activityDomainJSON{
+			Name:  host,
+			Count: n,
+		})
+	}
+
+	slices.SortFunc(resp.TopDomains, func(a, b *activityDomainJSON) (res int) {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Name, b.Name))
+	})
+
+	if len(resp.TopDomains) > activityTopDomains {
+		resp.TopDomains = resp.TopDomains[:activityTopDomains]
+	}
+
+	return resp, true
+}
+
+// handleClientActivity is the handler for the GET /control/clients/activity
+// HTTP API.  The id query parameter is the ClientID or the IP address of the
+// client.
+func (s *Server) handleClientActivity(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "no id")
+
+		return
+	}
+
+	resp, ok := s.activity.report(id, time.Now())
+	if !ok {
+		aghhttp.Error(r, w, http.StatusNotFound, "no activity of client %q", id)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
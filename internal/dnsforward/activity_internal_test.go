@@ -0,0 +1,41 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientActivity(t *testing.T) {
+	a := newClientActivity()
+	now := time.Unix(1_700_000_000, 0)
+
+	a.add("cli", "a.example", "", now)
+	a.add("cli", "b.example", querylog.ClientProtoDoH, now)
+	a.add("cli", "b.example", querylog.ClientProtoDoT, now.Add(time.Second))
+
+	_, ok := a.report("other", now)
+	assert.False(t, ok)
+
+	resp, ok := a.report("cli", now.Add(time.Second))
+	require.True(t, ok)
+
+	assert.Equal(t, now.Add(time.Second), resp.LastSeen)
+	assert.Equal(t, map[string]uint64{"dns": 1, "doh": 1, "dot": 1}, resp.Protocols)
+	assert.Equal(t, []*activityDomainJSON{{
+		Name:  "b.example",
+		Count: 2,
+	}, {
+		Name:  "a.example",
+		Count: 1,
+	}}, resp.TopDomains)
+	assert.InDelta(t, 3.0/activityWindow, resp.QPS, 1e-9)
+
+	resp, ok = a.report("cli", now.Add(activityWindow*time.Second))
+	require.True(t, ok)
+
+	assert.InDelta(t, 1.0/activityWindow, resp.QPS, 1e-9)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/miekg/dns"
 )
 
@@ -31,8 +32,14 @@ func (s *Server) HandleBefore(
 		}
 	}
 
+	if isLocalHealthcheck(pctx) {
+		// Let the service manager check the health of the server regardless
+		// of the access settings.
+		return nil
+	}
+
 	blocked, _ := s.IsBlockedClient(pctx.Addr.Addr(), clientID)
-	if blocked {
+	if blocked || s.isBlockedOnListener(pctx, clientID) {
 		return s.preBlockedResponse(pctx)
 	}
 
@@ -56,6 +63,27 @@ func (s *Server) HandleBefore(
 	return nil
 }
 
+// isLocalHealthcheck returns true if pctx is the healthcheck request sent from
+// the host itself, i.e. from the loopback address or from the address the
+// request was received on.
+func isLocalHealthcheck(pctx *proxy.DNSContext) (ok bool) {
+	req := pctx.Req
+	if len(req.Question) != 1 || req.Question[0].Name != healthcheckFQDN {
+		return false
+	}
+
+	addr := pctx.Addr.Addr().Unmap()
+	if addr.IsLoopback() {
+		return true
+	} else if pctx.Conn == nil {
+		return false
+	}
+
+	laddr := netutil.NetAddrToAddrPort(pctx.Conn.LocalAddr()).Addr().Unmap()
+
+	return !laddr.IsUnspecified() && laddr == addr
+}
+
 // clientIDFromDNSContext extracts the client's ID from the server name of the
 // client's DoT or DoQ request or the path of the client's DoH.  If the protocol
 // is not one of these, clientID is an empty string and err is nil.
@@ -66,7 +94,7 @@ func (s *Server) clientIDFromDNSContext(pctx *proxy.DNSContext) (clientID string
 		if err != nil {
 			return "", fmt.Errorf("checking url: %w", err)
 		} else if clientID != "" {
-			return clientID, nil
+			return s.matchClientIDPattern(clientID)
 		}
 
 		// Go on and check the domain name as well.
@@ -93,7 +121,7 @@ func (s *Server) clientIDFromDNSContext(pctx *proxy.DNSContext) (clientID string
 		return "", fmt.Errorf("clientid check: %w", err)
 	}
 
-	return clientID, nil
+	return s.matchClientIDPattern(clientID)
 }
 
 // errAccessBlocked is a sentinel error returned when a request is blocked by
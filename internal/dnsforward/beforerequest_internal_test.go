@@ -297,3 +297,75 @@ func TestServer_HandleBefore_udp(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_HandleBefore_healthcheck(t *testing.T) {
+	t.Parallel()
+
+	clientIPs := []string{"127.0.0.1", "::1"}
+
+	testCases := []struct {
+		name              string
+		allowedClients    []string
+		disallowedClients []string
+		blockedHosts      []string
+	}{{
+		name:              "allow_all",
+		allowedClients:    []string{},
+		disallowedClients: []string{},
+		blockedHosts:      []string{},
+	}, {
+		name:              "allowed_client_restricted",
+		allowedClients:    []string{"1:2:3::4"},
+		disallowedClients: []string{},
+		blockedHosts:      []string{},
+	}, {
+		name:              "disallowed_client_loopback",
+		allowedClients:    []string{},
+		disallowedClients: clientIPs,
+		blockedHosts:      []string{},
+	}, {
+		name:              "blocked_hosts",
+		allowedClients:    []string{},
+		disallowedClients: []string{},
+		blockedHosts:      []string{"healthcheck.adguardhome.test"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := createTestServer(t, &filtering.Config{
+				BlockingMode: filtering.BlockingModeDefault,
+			}, ServerConfig{
+				UDPListenAddrs: []*net.UDPAddr{{}},
+				TCPListenAddrs: []*net.TCPAddr{{}},
+				Config: Config{
+					AllowedClients:    tc.allowedClients,
+					DisallowedClients: tc.disallowedClients,
+					BlockedHosts:      tc.blockedHosts,
+					UpstreamDNS:       []string{"127.0.0.1:53"},
+					UpstreamMode:      UpstreamModeLoadBalance,
+					EDNSClientSubnet:  &EDNSClientSubnet{Enabled: false},
+				},
+				ServePlainDNS: true,
+			})
+
+			startDeferStop(t, s)
+
+			client := &dns.Client{
+				Net:     "udp",
+				Timeout: dnsClientTimeout,
+			}
+
+			req := createTestMessage(healthcheckFQDN)
+			addr := s.dnsProxy.Addr(proxy.ProtoUDP).String()
+
+			reply, _, err := client.Exchange(req, addr)
+			require.NoError(t, err)
+			require.NotNil(t, reply)
+
+			assert.Equal(t, dns.RcodeSuccess, reply.Rcode)
+			assert.Empty(t, reply.Answer)
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package dnsforward
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/google/renameio/v2/maybe"
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxWarmQuestions is the maximum number of the questions remembered to
+	// warm up the cache.
+	maxWarmQuestions = 1000
+
+	// warmConcurrency is the number of the questions resolved in parallel
+	// while warming up the cache.
+	warmConcurrency = 8
+
+	// warmSaveIvl is the interval between saving the questions to the file.
+	warmSaveIvl = 1 * time.Hour
+)
+
+// warmQuestion is a question resolved again to warm up the cache.
+type warmQuestion struct {
+	// Name is the FQDN of the question.
+	Name string `json:"name"`
+
+	// QType is the type of the question.
+	QType uint16 `json:"qtype"`
+}
+
+// cacheWarmer remembers the most recently answered questions, saves them to the
+// file, and resolves them again after the restart to fill the cache of the new
+// proxy.  The answers themselves aren't saved, so their TTLs are always
+// current.  A nil *cacheWarmer is a valid warmer, which does nothing.
+type cacheWarmer struct {
+	// mu protects recent and elems.
+	mu *sync.Mutex
+
+	// recent are the remembered questions, the most recent first.
+	recent *list.List
+
+	// elems are the elements of recent by their questions.
+	elems map[warmQuestion]*list.Element
+
+	// done is closed when the warmer is closed.
+	done chan struct{}
+
+	// closeOnce makes sure that done is only closed once.
+	closeOnce *sync.Once
+
+	// path is the path to the file with the questions.
+	path string
+}
+
+// newCacheWarmer returns a new cache warmer saving the questions to the file at
+// path.  w is nil if path is empty.
+func newCacheWarmer(path string) (w *cacheWarmer) {
+	if path == "" {
+		return nil
+	}
+
+	return &cacheWarmer{
+		mu:        &sync.Mutex{},
+		recent:    list.New(),
+		elems:     map[warmQuestion]*list.Element{},
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		path:      path,
+	}
+}
+
+// record remembers q as the most recent question, evicting the oldest one if
+// there are too many.
+func (w *cacheWarmer) record(q warmQuestion) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if e, ok := w.elems[q]; ok {
+		w.recent.MoveToFront(e)
+
+		return
+	}
+
+	w.elems[q] = w.recent.PushFront(q)
+	if w.recent.Len() > maxWarmQuestions {
+		oldest := w.recent.Back()
+		w.recent.Remove(oldest)
+		delete(w.elems, oldest.Value.(warmQuestion))
+	}
+}
+
+// questions returns the remembered questions, the most recent first.
+func (w *cacheWarmer) questions() (qs []warmQuestion) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	qs = make([]warmQuestion, 0, w.recent.Len())
+	for e := w.recent.Front(); e != nil; e = e.Next() {
+		qs = append(qs, e.Value.(warmQuestion))
+	}
+
+	return qs
+}
+
+// save writes the remembered questions to the file.
+func (w *cacheWarmer) save() (err error) {
+	qs := w.questions()
+	if len(qs) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(qs)
+	if err != nil {
+		return fmt.Errorf("encoding questions: %w", err)
+	}
+
+	err = maybe.WriteFile(w.path, b, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing questions: %w", err)
+	}
+
+	log.Debug("dnsforward: saved %d questions to warm up cache", len(qs))
+
+	return nil
+}
+
+// load reads the questions from the file and remembers them.  It isn't an
+// error if the file doesn't exist.
+func (w *cacheWarmer) load() (qs []warmQuestion, err error) {
+	b, err := os.ReadFile(w.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &qs)
+	if err != nil {
+		return nil, fmt.Errorf("decoding questions: %w", err)
+	}
+
+	// Remember the questions in the reverse order to keep the most recent
+	// first.
+	for i := len(qs) - 1; i >= 0; i-- {
+		w.record(qs[i])
+	}
+
+	return qs, nil
+}
+
+// run warms up the cache of prx and then saves the questions periodically
+// until the warmer is closed.  It is intended to be used as a goroutine.
+func (w *cacheWarmer) run(prx *proxy.Proxy) {
+	defer log.OnPanic("dnsforward: cache warmer")
+
+	qs, err := w.load()
+	if err != nil {
+		log.Error("dnsforward: loading questions to warm up cache: %s", err)
+	} else if len(qs) > 0 {
+		w.warm(prx, qs)
+	}
+
+	saves := time.NewTicker(warmSaveIvl)
+	defer saves.Stop()
+
+	for {
+		select {
+		case <-saves.C:
+			err = w.save()
+			if err != nil {
+				log.Error("dnsforward: cache warmer: %s", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// warm resolves qs with prx to fill its cache.  It stops early if the warmer
+// is closed.
+func (w *cacheWarmer) warm(prx *proxy.Proxy, qs []warmQuestion) {
+	start := time.Now()
+	log.Info("dnsforward: warming up cache with %d questions", len(qs))
+
+	sema := make(chan struct{}, warmConcurrency)
+	wg := &sync.WaitGroup{}
+
+loop:
+	for _, q := range qs {
+		select {
+		case sema <- struct{}{}:
+		case <-w.done:
+			break loop
+		}
+
+		wg.Add(1)
+		go func(q warmQuestion) {
+			defer log.OnPanic("dnsforward: warming up cache")
+			defer wg.Done()
+			defer func() { <-sema }()
+
+			req := (&dns.Msg{}).SetQuestion(q.Name, q.QType)
+			dctx := &proxy.DNSContext{
+				Proto: proxy.ProtoUDP,
+				Req:   req,
+				Addr:  netip.AddrPortFrom(netutil.IPv4Localhost(), 0),
+			}
+
+			resolveErr := prx.Resolve(dctx)
+			if resolveErr != nil {
+				log.Debug("dnsforward: warming up cache: %s %s: %s", q.Name, dns.Type(q.QType), resolveErr)
+			}
+		}(q)
+	}
+
+	wg.Wait()
+
+	log.Info("dnsforward: warmed up cache in %s", time.Since(start))
+}
+
+// close stops the warmer and saves the questions to the file.
+func (w *cacheWarmer) close() {
+	if w == nil {
+		return
+	}
+
+	w.closeOnce.Do(func() { close(w.done) })
+
+	err := w.save()
+	if err != nil {
+		log.Error("dnsforward: cache warmer: %s", err)
+	}
+}
+
+// processCacheWarmer remembers the question of the request answered by the
+// general upstream servers or the cache to warm up the cache after the
+// restart.  The questions which aren't written to the query log aren't
+// remembered either, since they would otherwise be disclosed by the file.
+func (s *Server) processCacheWarmer(dctx *dnsContext) (rc resultCode) {
+	w := s.warmer.Load()
+	pctx := dctx.proxyCtx
+	if w == nil ||
+		pctx.CustomUpstreamConfig != nil ||
+		pctx.Res == nil ||
+		pctx.Res.Rcode != dns.RcodeSuccess ||
+		(pctx.Upstream == nil && pctx.CachedUpstreamAddr == "") {
+		return resultCodeSuccess
+	}
+
+	q := pctx.Req.Question[0]
+	if q.Qclass == dns.ClassINET && s.shouldWarm(dctx) {
+		w.record(warmQuestion{
+			Name:  strings.ToLower(q.Name),
+			QType: q.Qtype,
+		})
+	}
+
+	return resultCodeSuccess
+}
+
+// shouldWarm returns true if the question of dctx may be remembered by the
+// cache warmer, i.e. if it's written to the query log.
+func (s *Server) shouldWarm(dctx *dnsContext) (ok bool) {
+	if l := dctx.listener; l != nil && l.conf.IgnoreQueryLog {
+		return false
+	}
+
+	q := dctx.proxyCtx.Req.Question[0]
+	_, ids := s.clientIDs(dctx)
+
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	return s.shouldLog(aghnet.NormalizeDomain(q.Name), q.Qtype, q.Qclass, ids)
+}
@@ -0,0 +1,108 @@
+package dnsforward
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheWarmer(t *testing.T) {
+	assert.Nil(t, newCacheWarmer(""))
+
+	path := filepath.Join(t.TempDir(), "dnscache.json")
+	w := newCacheWarmer(path)
+	require.NotNil(t, w)
+
+	for i := range maxWarmQuestions + 1 {
+		w.record(warmQuestion{Name: fmt.Sprintf("host%d.example.", i), QType: dns.TypeA})
+	}
+
+	// Move the oldest remaining question to the front.
+	w.record(warmQuestion{Name: "host1.example.", QType: dns.TypeA})
+
+	qs := w.questions()
+	require.Len(t, qs, maxWarmQuestions)
+
+	assert.Equal(t, "host1.example.", qs[0].Name)
+	assert.Equal(t, fmt.Sprintf("host%d.example.", maxWarmQuestions), qs[1].Name)
+	assert.Equal(t, "host2.example.", qs[len(qs)-1].Name)
+
+	w.close()
+
+	loaded := newCacheWarmer(path)
+	got, err := loaded.load()
+	require.NoError(t, err)
+
+	assert.Equal(t, qs, got)
+	assert.Equal(t, qs, loaded.questions())
+
+	absent := newCacheWarmer(filepath.Join(t.TempDir(), "absent.json"))
+	got, err = absent.load()
+	require.NoError(t, err)
+
+	assert.Empty(t, got)
+}
+
+// testIgnoringQueryLog is a [querylog.QueryLog] which doesn't log the requests
+// for a single host.
+type testIgnoringQueryLog struct {
+	// QueryLog is embedded here simply to make testIgnoringQueryLog a
+	// [querylog.QueryLog] without actually implementing all methods.
+	querylog.QueryLog
+
+	host string
+}
+
+// ShouldLog implements the [querylog.QueryLog] interface for
+// *testIgnoringQueryLog.
+func (l *testIgnoringQueryLog) ShouldLog(host string, _, _ uint16, _ []string) bool {
+	return host != l.host
+}
+
+func TestServer_processCacheWarmer(t *testing.T) {
+	ups, err := upstream.AddressToUpstream("1.1.1.1", nil)
+	require.NoError(t, err)
+
+	w := newCacheWarmer(filepath.Join(t.TempDir(), "dnscache.json"))
+	t.Cleanup(w.close)
+
+	srv := &Server{
+		queryLog:   &testIgnoringQueryLog{host: "ignored.example"},
+		anonymizer: aghnet.NewIPMut(nil),
+	}
+	srv.warmer.Store(w)
+
+	process := func(name string) {
+		req := (&dns.Msg{}).SetQuestion(name, dns.TypeA)
+		dctx := &dnsContext{
+			proxyCtx: &proxy.DNSContext{
+				Req:      req,
+				Res:      (&dns.Msg{}).SetReply(req),
+				Addr:     testClientAddrPort,
+				Upstream: ups,
+			},
+		}
+
+		assert.Equal(t, resultCodeSuccess, srv.processCacheWarmer(dctx))
+	}
+
+	process("logged.example.")
+	process("ignored.example.")
+
+	want := []warmQuestion{{Name: "logged.example.", QType: dns.TypeA}}
+	assert.Equal(t, want, w.questions())
+
+	// The questions aren't remembered without the query log.
+	srv.queryLog = nil
+	process("other.example.")
+
+	assert.Equal(t, want, w.questions())
+}
@@ -0,0 +1,542 @@
+package dnsforward
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultCaptureDuration is the default duration of a packet capture.
+	defaultCaptureDuration = 5 * time.Minute
+
+	// maxCaptureDuration is the maximum duration of a packet capture.
+	maxCaptureDuration = time.Hour
+
+	// defaultCaptureMaxPackets is the default maximum number of the captured
+	// messages.
+	defaultCaptureMaxPackets = 1000
+
+	// maxCaptureMaxPackets is the maximum allowed value of the maximum number
+	// of the captured messages.
+	maxCaptureMaxPackets = 10_000
+)
+
+// captureFilter describes the queries which messages are captured.
+type captureFilter struct {
+	// domain is the lowercased domain name without the trailing dot.  The
+	// queries for the domain and all of its subdomains are captured.  If it's
+	// empty, the queries for all the domains are captured.
+	domain string
+
+	// client is the IP address or the ClientID of the client.  If it's empty,
+	// the queries from all the clients are captured.
+	client string
+}
+
+// match returns true if the query for host from the client with the IP address
+// ip and the ClientID clientID must be captured.
+func (f *captureFilter) match(host string, ip netip.Addr, clientID string) (ok bool) {
+	if f.domain != "" && host != f.domain && !strings.HasSuffix(host, "."+f.domain) {
+		return false
+	}
+
+	return f.client == "" || f.client == clientID || f.client == ip.Unmap().String()
+}
+
+// capturedPacket is a single captured DNS message.
+type capturedPacket struct {
+	// time is the time when the message was received or sent.
+	time time.Time
+
+	// client is the address of the client.
+	client netip.AddrPort
+
+	// server is the address of the server, if known.
+	server netip.AddrPort
+
+	// data is the wire-format DNS message.
+	data []byte
+
+	// isResponse is true if the message is a response to the client.
+	isResponse bool
+}
+
+// packetCapture captures the raw DNS messages of the matching queries for a
+// limited period of time.  It's safe for concurrent use.
+type packetCapture struct {
+	// mu protects all the fields below.
+	mu *sync.Mutex
+
+	// filter describes the captured queries.  It's nil if no capture has
+	// been started yet.
+	filter *captureFilter
+
+	// until is the time at which the capture stops.
+	until time.Time
+
+	// packets are the captured messages.
+	packets []*capturedPacket
+
+	// maxPackets is the maximum number of the captured messages.
+	maxPackets int
+}
+
+// newPacketCapture returns a new inactive packet capture.
+func newPacketCapture() (c *packetCapture) {
+	return &packetCapture{
+		mu: &sync.Mutex{},
+	}
+}
+
+// start discards the previously captured messages and starts capturing the
+// messages of the queries matching f for dur or until maxPackets messages are
+// captured.
+func (c *packetCapture) start(f *captureFilter, dur time.Duration, maxPackets int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.filter = f
+	c.until = time.Now().Add(dur)
+	c.packets = nil
+	c.maxPackets = maxPackets
+
+	log.Info("dnsforward: capture: started for %s, domain %q, client %q", dur, f.domain, f.client)
+}
+
+// stop stops capturing the messages.  The captured messages are kept.
+func (c *packetCapture) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.until = time.Time{}
+
+	log.Info("dnsforward: capture: stopped")
+}
+
+// isActiveLocked returns true if the capture is active at now.  c.mu is
+// expected to be locked.
+func (c *packetCapture) isActiveLocked(now time.Time) (ok bool) {
+	return c.filter != nil && now.Before(c.until) && len(c.packets) < c.maxPackets
+}
+
+// add captures the query and the response from dctx, if the capture is active
+// and the query matches.
+func (c *packetCapture) add(dctx *dnsContext) {
+	now := time.Now()
+	pctx := dctx.proxyCtx
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isActiveLocked(now) {
+		return
+	}
+
+	host := aghnet.NormalizeDomain(pctx.Req.Question[0].Name)
+	if !c.filter.match(host, pctx.Addr.Addr(), dctx.clientID) {
+		return
+	}
+
+	var server netip.AddrPort
+	if pctx.Conn != nil {
+		server = netutil.NetAddrToAddrPort(pctx.Conn.LocalAddr())
+	}
+
+	for _, m := range []struct {
+		msg        *dns.Msg
+		time       time.Time
+		isResponse bool
+	}{{
+		msg:        pctx.Req,
+		time:       dctx.startTime,
+		isResponse: false,
+	}, {
+		msg:        pctx.Res,
+		time:       now,
+		isResponse: true,
+	}} {
+		if m.msg == nil || len(c.packets) >= c.maxPackets {
+			continue
+		}
+
+		data, err := m.msg.Pack()
+		if err != nil {
+			log.Debug("dnsforward: capture: packing message: %s", err)
+
+			continue
+		}
+
+		c.packets = append(c.packets, &capturedPacket{
+			time:       m.time,
+			client:     pctx.Addr,
+			server:     server,
+			data:       data,
+			isResponse: m.isResponse,
+		})
+	}
+}
+
+// processCapture captures the query and the response if the packet capture is
+// active.
+func (s *Server) processCapture(dctx *dnsContext) (rc resultCode) {
+	s.capture.add(dctx)
+
+	return resultCodeSuccess
+}
+
+// captureStartReq is the request for the POST /control/dns_capture/start HTTP
+// API.
+type captureStartReq struct {
+	// Domain is the domain name which queries, including the ones for its
+	// subdomains, are captured.
+	Domain string `json:"domain"`
+
+	// Client is the IP address or the ClientID of the client which queries
+	// are captured.
+	Client string `json:"client"`
+
+	// Duration is the duration of the capture in seconds.
+	Duration uint32 `json:"duration"`
+
+	// MaxPackets is the maximum number of the captured messages.
+	MaxPackets int `json:"max_packets"`
+}
+
+// toFilter validates req, sets the default values, and returns the filter and
+// the duration of the capture.
+func (req *captureStartReq) toFilter() (f *captureFilter, dur time.Duration, err error) {
+	f = &captureFilter{
+		domain: aghnet.NormalizeDomain(req.Domain),
+		client: req.Client,
+	}
+
+	if f.domain == "" && f.client == "" {
+		return nil, 0, errors.Error("domain or client must be set")
+	}
+
+	if f.domain != "" {
+		err = netutil.ValidateDomainName(f.domain)
+		if err != nil {
+			return nil, 0, fmt.Errorf("domain: %w", err)
+		}
+	}
+
+	if ip, pErr := netip.ParseAddr(f.client); pErr == nil {
+		f.client = ip.Unmap().String()
+	}
+
+	dur = time.Duration(req.Duration) * time.Second
+	if dur == 0 {
+		dur = defaultCaptureDuration
+	} else if dur > maxCaptureDuration {
+		return nil, 0, fmt.Errorf("duration: must be at most %d", maxCaptureDuration/time.Second)
+	}
+
+	if req.MaxPackets == 0 {
+		req.MaxPackets = defaultCaptureMaxPackets
+	} else if req.MaxPackets < 0 || req.MaxPackets > maxCaptureMaxPackets {
+		return nil, 0, fmt.Errorf("max_packets: must be from 1 to %d", maxCaptureMaxPackets)
+	}
+
+	return f, dur, nil
+}
+
+// handleCaptureStart is the handler for the POST /control/dns_capture/start
+// HTTP API.
+func (s *Server) handleCaptureStart(w http.ResponseWriter, r *http.Request) {
+	req := &captureStartReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	f, dur, err := req.toFilter()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	s.capture.start(f, dur, req.MaxPackets)
+}
+
+// handleCaptureStop is the handler for the POST /control/dns_capture/stop HTTP
+// API.
+func (s *Server) handleCaptureStop(_ http.ResponseWriter, _ *http.Request) {
+	s.capture.stop()
+}
+
+// capturedPacketJSON is the JSON representation of a captured message.
+type capturedPacketJSON struct {
+	// Time is the time of the message in RFC 3339 format.
+	Time string `json:"time"`
+
+	// Client is the address of the client.
+	Client string `json:"client"`
+
+	// Server is the address of the server, if known.
+	Server string `json:"server,omitempty"`
+
+	// Data is the hex-encoded wire-format message.
+	Data string `json:"data"`
+
+	// IsResponse is true if the message is a response to the client.
+	IsResponse bool `json:"is_response"`
+}
+
+// captureStatusResp is the response for the GET /control/dns_capture HTTP API.
+type captureStatusResp struct {
+	// Until is the time at which the capture stops in RFC 3339 format.  It's
+	// empty if the capture isn't active.
+	Until string `json:"until,omitempty"`
+
+	// Domain is the domain name of the captured queries.
+	Domain string `json:"domain,omitempty"`
+
+	// Client is the client of the captured queries.
+	Client string `json:"client,omitempty"`
+
+	// Packets are the captured messages.
+	Packets []*capturedPacketJSON `json:"packets"`
+
+	// Enabled is true if the capture is active.
+	Enabled bool `json:"enabled"`
+}
+
+// handleCaptureStatus is the handler for the GET /control/dns_capture HTTP
+// API.
+func (s *Server) handleCaptureStatus(w http.ResponseWriter, r *http.Request) {
+	c := s.capture
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp := &captureStatusResp{
+		Packets: make([]*capturedPacketJSON, 0, len(c.packets)),
+		Enabled: c.isActiveLocked(time.Now()),
+	}
+
+	if c.filter != nil {
+		resp.Domain, resp.Client = c.filter.domain, c.filter.client
+	}
+
+	if resp.Enabled {
+		resp.Until = c.until.Format(time.RFC3339)
+	}
+
+	for _, p := range c.packets {
+		pj := &capturedPacketJSON{
+			Time:       p.time.Format(time.RFC3339Nano),
+			Client:     p.client.String(),
+			Data:       hex.EncodeToString(p.data),
+			IsResponse: p.isResponse,
+		}
+
+		if p.server.IsValid() {
+			pj.Server = p.server.String()
+		}
+
+		resp.Packets = append(resp.Packets, pj)
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleCapturePcap is the handler for the GET /control/dns_capture/pcap HTTP
+// API.
+func (s *Server) handleCapturePcap(w http.ResponseWriter, r *http.Request) {
+	c := s.capture
+
+	c.mu.Lock()
+	packets := c.packets
+	c.mu.Unlock()
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, "application/vnd.tcpdump.pcap")
+	h.Set(httphdr.ContentDisposition, `attachment; filename="dns_capture.pcap"`)
+
+	err := writePcap(w, packets)
+	if err != nil {
+		log.Debug("dnsforward: capture: writing pcap: %s", err)
+	}
+}
+
+// Constants of the pcap file format.
+//
+// See https://datatracker.ietf.org/doc/draft-ietf-opsawg-pcap.
+const (
+	pcapMagic        = 0xa1b23c4d
+	pcapVersionMajor = 2
+	pcapVersionMinor = 4
+	pcapSnapLen      = 0xffff
+	pcapLinkTypeRaw  = 101
+)
+
+// Sizes of the synthesized packet headers.
+const (
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+)
+
+// writePcap writes packets to w in the pcap format.  The messages are wrapped
+// into the synthesized IP and UDP headers, so that the packet analyzers are
+// able to decode them.
+func writePcap(w io.Writer, packets []*capturedPacket) (err error) {
+	b := binary.LittleEndian.AppendUint32(nil, pcapMagic)
+	b = binary.LittleEndian.AppendUint16(b, pcapVersionMajor)
+	b = binary.LittleEndian.AppendUint16(b, pcapVersionMinor)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, pcapSnapLen)
+	b = binary.LittleEndian.AppendUint32(b, pcapLinkTypeRaw)
+
+	_, err = w.Write(b)
+	if err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	for i, p := range packets {
+		pkt := p.ipPacket()
+
+		b = binary.LittleEndian.AppendUint32(b[:0], uint32(p.time.Unix()))
+		b = binary.LittleEndian.AppendUint32(b, uint32(p.time.Nanosecond()))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(pkt)))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(pkt)))
+		b = append(b, pkt...)
+
+		_, err = w.Write(b)
+		if err != nil {
+			return fmt.Errorf("writing packet at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ipPacket returns the IP packet containing the UDP datagram with the message.
+// The message is truncated to fit into the datagram, if necessary.
+func (p *capturedPacket) ipPacket() (pkt []byte) {
+	src, dst := p.client, p.server
+	if p.isResponse {
+		src, dst = dst, src
+	}
+
+	srcIP, dstIP := src.Addr().Unmap(), dst.Addr().Unmap()
+	is4 := !p.client.Addr().Unmap().Is6()
+	if is4 {
+		srcIP, dstIP = as4(srcIP), as4(dstIP)
+	} else {
+		srcIP, dstIP = as6(srcIP), as6(dstIP)
+	}
+
+	ipHdrLen := ipv6HeaderLen
+	if is4 {
+		ipHdrLen = ipv4HeaderLen
+	}
+
+	data := p.data
+	if maxData := pcapSnapLen - ipHdrLen - udpHeaderLen; len(data) > maxData {
+		data = data[:maxData]
+	}
+
+	udpLen := uint16(udpHeaderLen + len(data))
+	pkt = make([]byte, 0, ipHdrLen+int(udpLen))
+	if is4 {
+		pkt = appendIPv4Header(pkt, srcIP, dstIP, udpLen)
+	} else {
+		pkt = appendIPv6Header(pkt, srcIP, dstIP, udpLen)
+	}
+
+	// The checksum is left zero, meaning that it's not computed.
+	pkt = binary.BigEndian.AppendUint16(pkt, src.Port())
+	pkt = binary.BigEndian.AppendUint16(pkt, dst.Port())
+	pkt = binary.BigEndian.AppendUint16(pkt, udpLen)
+	pkt = binary.BigEndian.AppendUint16(pkt, 0)
+
+	return append(pkt, data...)
+}
+
+// appendIPv4Header appends the IPv4 header of the packet carrying the UDP
+// datagram of length udpLen to b.
+func appendIPv4Header(b []byte, src, dst netip.Addr, udpLen uint16) (res []byte) {
+	const (
+		versionIHL = 4<<4 | ipv4HeaderLen/4
+		ttl        = 64
+		protoUDP   = 17
+	)
+
+	start := len(b)
+	b = append(b, versionIHL, 0)
+	b = binary.BigEndian.AppendUint16(b, ipv4HeaderLen+udpLen)
+	b = append(b, 0, 0, 0, 0, ttl, protoUDP, 0, 0)
+	b = append(b, src.AsSlice()...)
+	b = append(b, dst.AsSlice()...)
+
+	var sum uint32
+	for i := start; i < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	binary.BigEndian.PutUint16(b[start+10:], ^uint16(sum))
+
+	return b
+}
+
+// appendIPv6Header appends the IPv6 header of the packet carrying the UDP
+// datagram of length udpLen to b.
+func appendIPv6Header(b []byte, src, dst netip.Addr, udpLen uint16) (res []byte) {
+	const (
+		hopLimit = 64
+		protoUDP = 17
+	)
+
+	b = append(b, 6<<4, 0, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, udpLen)
+	b = append(b, protoUDP, hopLimit)
+	b = append(b, src.AsSlice()...)
+
+	return append(b, dst.AsSlice()...)
+}
+
+// as4 returns addr if it's an IPv4 address and the unspecified IPv4 address
+// otherwise.
+func as4(addr netip.Addr) (res netip.Addr) {
+	if addr.Is4() {
+		return addr
+	}
+
+	return netip.IPv4Unspecified()
+}
+
+// as6 returns addr as an IPv6 address and the unspecified IPv6 address if it's
+// invalid.
+func as6(addr netip.Addr) (res netip.Addr) {
+	if !addr.IsValid() {
+		return netip.IPv6Unspecified()
+	}
+
+	return netip.AddrFrom16(addr.As16())
+}
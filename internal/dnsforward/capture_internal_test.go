@@ -0,0 +1,161 @@
+package dnsforward
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureFilter_match(t *testing.T) {
+	cliIP := netip.MustParseAddr("192.0.2.1")
+
+	testCases := []struct {
+		filter   *captureFilter
+		name     string
+		host     string
+		clientID string
+		want     assert.BoolAssertionFunc
+	}{{
+		filter:   &captureFilter{domain: "example.org"},
+		name:     "domain",
+		host:     "example.org",
+		clientID: "",
+		want:     assert.True,
+	}, {
+		filter:   &captureFilter{domain: "example.org"},
+		name:     "subdomain",
+		host:     "www.example.org",
+		clientID: "",
+		want:     assert.True,
+	}, {
+		filter:   &captureFilter{domain: "example.org"},
+		name:     "other_domain",
+		host:     "badexample.org",
+		clientID: "",
+		want:     assert.False,
+	}, {
+		filter:   &captureFilter{client: cliIP.String()},
+		name:     "client_ip",
+		host:     "example.org",
+		clientID: "",
+		want:     assert.True,
+	}, {
+		filter:   &captureFilter{client: "cli"},
+		name:     "client_id",
+		host:     "example.org",
+		clientID: "cli",
+		want:     assert.True,
+	}, {
+		filter:   &captureFilter{domain: "example.org", client: "cli"},
+		name:     "other_client",
+		host:     "example.org",
+		clientID: "other",
+		want:     assert.False,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.want(t, tc.filter.match(tc.host, cliIP, tc.clientID))
+		})
+	}
+}
+
+func TestPacketCapture(t *testing.T) {
+	c := newPacketCapture()
+
+	req := (&dns.Msg{}).SetQuestion("www.example.org.", dns.TypeA)
+	dctx := &dnsContext{
+		proxyCtx: &proxy.DNSContext{
+			Req:  req,
+			Res:  (&dns.Msg{}).SetReply(req),
+			Addr: netip.MustParseAddrPort("192.0.2.1:12345"),
+		},
+		startTime: time.Now(),
+	}
+
+	// The capture isn't started yet.
+	c.add(dctx)
+	assert.Empty(t, c.packets)
+
+	c.start(&captureFilter{domain: "example.org"}, time.Minute, 3)
+
+	c.add(dctx)
+	c.add(dctx)
+	require.Len(t, c.packets, 3)
+
+	assert.False(t, c.packets[0].isResponse)
+	assert.True(t, c.packets[1].isResponse)
+	assert.False(t, c.packets[2].isResponse)
+
+	wantData, err := req.Pack()
+	require.NoError(t, err)
+
+	assert.Equal(t, wantData, c.packets[0].data)
+
+	c.stop()
+	c.start(&captureFilter{domain: "example.net"}, time.Minute, 3)
+
+	c.add(dctx)
+	assert.Empty(t, c.packets)
+}
+
+func TestWritePcap(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03}
+	packets := []*capturedPacket{{
+		time:       time.Unix(1_700_000_000, 1_000),
+		client:     netip.MustParseAddrPort("192.0.2.1:12345"),
+		server:     netip.MustParseAddrPort("192.0.2.2:53"),
+		data:       data,
+		isResponse: true,
+	}, {
+		time:       time.Unix(1_700_000_000, 2_000),
+		client:     netip.MustParseAddrPort("[2001:db8::1]:12345"),
+		data:       data,
+		isResponse: false,
+	}}
+
+	buf := &bytes.Buffer{}
+	err := writePcap(buf, packets)
+	require.NoError(t, err)
+
+	b := buf.Bytes()
+	require.Greater(t, len(b), 24)
+
+	assert.Equal(t, uint32(pcapMagic), binary.LittleEndian.Uint32(b))
+	assert.Equal(t, uint32(pcapLinkTypeRaw), binary.LittleEndian.Uint32(b[20:]))
+
+	b = b[24:]
+
+	// IPv4 response from the server to the client.
+	wantLen := ipv4HeaderLen + udpHeaderLen + len(data)
+	require.Equal(t, uint32(wantLen), binary.LittleEndian.Uint32(b[8:]))
+
+	pkt := b[16 : 16+wantLen]
+	assert.Equal(t, byte(0x45), pkt[0])
+	assert.Equal(t, []byte{192, 0, 2, 2}, pkt[12:16])
+	assert.Equal(t, []byte{192, 0, 2, 1}, pkt[16:20])
+	assert.Equal(t, uint16(53), binary.BigEndian.Uint16(pkt[20:]))
+	assert.Equal(t, uint16(12345), binary.BigEndian.Uint16(pkt[22:]))
+	assert.Equal(t, data, pkt[28:])
+
+	b = b[16+wantLen:]
+
+	// IPv6 query from the client to the unknown server address.
+	wantLen = ipv6HeaderLen + udpHeaderLen + len(data)
+	require.Equal(t, uint32(wantLen), binary.LittleEndian.Uint32(b[8:]))
+
+	pkt = b[16:]
+	require.Len(t, pkt, wantLen)
+
+	assert.Equal(t, byte(0x60), pkt[0])
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1").AsSlice(), pkt[8:24])
+	assert.Equal(t, netip.IPv6Unspecified().AsSlice(), pkt[24:40])
+	assert.Equal(t, data, pkt[48:])
+}
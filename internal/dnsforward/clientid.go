@@ -26,6 +26,17 @@ func ValidateClientID(id string) (err error) {
 	return nil
 }
 
+// matchClientIDPattern returns id if it's empty or matches the configured
+// ClientID pattern, if any.  Otherwise, it returns an error.
+func (s *Server) matchClientIDPattern(id string) (clientID string, err error) {
+	re := s.conf.clientIDRe
+	if id == "" || re == nil || re.MatchString(id) {
+		return id, nil
+	}
+
+	return "", fmt.Errorf("clientid check: clientid %q doesn't match pattern %q", id, re)
+}
+
 // clientIDFromClientServerName extracts and validates a ClientID.  hostSrvName
 // is the server name of the host.  cliSrvName is the server name as sent by the
 // client.  When strict is true, and client and host server name don't match,
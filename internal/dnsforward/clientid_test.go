@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"testing"
 
 	"github.com/AdguardTeam/dnsproxy/proxy"
@@ -254,6 +255,96 @@ func TestServer_clientIDFromDNSContext(t *testing.T) {
 	}
 }
 
+func TestServer_clientIDFromDNSContext_pattern(t *testing.T) {
+	re := regexp.MustCompile(`^dev-[0-9]+$`)
+	srv := &Server{
+		conf: ServerConfig{
+			TLSConfig: TLSConfig{
+				ServerName:     "example.com",
+				StrictSNICheck: true,
+				clientIDRe:     re,
+			},
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		proto        proxy.Proto
+		cliSrvName   string
+		path         string
+		wantClientID string
+		wantErrMsg   string
+	}{{
+		name:         "tls_match",
+		proto:        proxy.ProtoTLS,
+		cliSrvName:   "dev-1.example.com",
+		wantClientID: "dev-1",
+		wantErrMsg:   "",
+	}, {
+		name:         "tls_mismatch",
+		proto:        proxy.ProtoTLS,
+		cliSrvName:   "cli.example.com",
+		wantClientID: "",
+		wantErrMsg: `clientid check: clientid "cli" doesn't match pattern ` +
+			`"^dev-[0-9]+$"`,
+	}, {
+		name:         "tls_no_clientid",
+		proto:        proxy.ProtoTLS,
+		cliSrvName:   "example.com",
+		wantClientID: "",
+		wantErrMsg:   "",
+	}, {
+		name:         "quic_mismatch",
+		proto:        proxy.ProtoQUIC,
+		cliSrvName:   "cli.example.com",
+		wantClientID: "",
+		wantErrMsg: `clientid check: clientid "cli" doesn't match pattern ` +
+			`"^dev-[0-9]+$"`,
+	}, {
+		name:         "https_path_match",
+		proto:        proxy.ProtoHTTPS,
+		cliSrvName:   "example.com",
+		path:         "/dns-query/dev-2",
+		wantClientID: "dev-2",
+		wantErrMsg:   "",
+	}, {
+		name:         "https_path_mismatch",
+		proto:        proxy.ProtoHTTPS,
+		cliSrvName:   "example.com",
+		path:         "/dns-query/cli",
+		wantClientID: "",
+		wantErrMsg: `clientid check: clientid "cli" doesn't match pattern ` +
+			`"^dev-[0-9]+$"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Proto: tc.proto,
+			}
+
+			switch tc.proto {
+			case proxy.ProtoHTTPS:
+				pctx.HTTPRequest = newHTTPReq(tc.cliSrvName, true)
+				pctx.HTTPRequest.URL.Path = tc.path
+			case proxy.ProtoQUIC:
+				pctx.QUICConnection = testQUICConnection{
+					serverName: tc.cliSrvName,
+				}
+			case proxy.ProtoTLS:
+				pctx.Conn = testTLSConn{
+					serverName: tc.cliSrvName,
+				}
+			}
+
+			clientID, err := srv.clientIDFromDNSContext(pctx)
+			assert.Equal(t, tc.wantClientID, clientID)
+
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
 // newHTTPReq is a helper to create HTTP requests for tests.
 func newHTTPReq(cliSrvName string, inclTLS bool) (r *http.Request) {
 	u := &url.URL{
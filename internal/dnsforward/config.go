@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/netip"
 	"os"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
@@ -39,6 +40,14 @@ type ClientsContainer interface {
 		id string,
 		boot upstream.Resolver,
 	) (conf *proxy.CustomUpstreamConfig, err error)
+
+	// ClientIDByListener returns the identifier of the persistent client
+	// configured for the additional listener, listenerID, or the one defined by
+	// the listener address laddr or its network interface, unless the client
+	// with cliAddr is defined more specifically.  listenerID is empty if there
+	// is none, and laddr may be invalid or unspecified.  id is empty if there
+	// is no such client.
+	ClientIDByListener(cliAddr, laddr netip.Addr, listenerID string) (id string)
 }
 
 // Config represents the DNS filtering configuration of AdGuard Home.  The zero
@@ -97,6 +106,11 @@ type Config struct {
 	// when FastestAddr is true.
 	FastestTimeout timeutil.Duration `yaml:"fastest_timeout"`
 
+	// UpstreamKeepaliveIvl is the interval between the healthcheck requests
+	// sent to the DNS-over-HTTPS upstream servers to keep their connections
+	// alive.  Zero disables them.
+	UpstreamKeepaliveIvl timeutil.Duration `yaml:"upstream_keepalive_interval"`
+
 	// Access settings
 
 	// AllowedClients is the slice of IP addresses, CIDR networks, and
@@ -132,6 +146,11 @@ type Config struct {
 	// CacheOptimistic defines if optimistic cache mechanism should be used.
 	CacheOptimistic bool `yaml:"cache_optimistic"`
 
+	// CachePersistent defines if the recently answered questions are saved on
+	// shutdown and periodically, and resolved again on start to warm up the
+	// cache.
+	CachePersistent bool `yaml:"cache_persistent"`
+
 	// Other settings
 
 	// BogusNXDomain is the list of IP addresses, responses with them will be
@@ -148,10 +167,23 @@ type Config struct {
 	// EDNSClientSubnet is the settings list for EDNS Client Subnet.
 	EDNSClientSubnet *EDNSClientSubnet `yaml:"edns_client_subnet"`
 
+	// EDNSClientMAC is the settings of the client MAC addresses sent in the
+	// EDNS options by the downstream forwarders.
+	EDNSClientMAC *EDNSClientMAC `yaml:"edns_client_mac"`
+
 	// MaxGoroutines is the max number of parallel goroutines for processing
 	// incoming requests.
 	MaxGoroutines uint `yaml:"max_goroutines"`
 
+	// MaxQueuedRequests is the maximum number of incoming requests waiting for
+	// one of the MaxGoroutines workers.  The requests exceeding it are refused.
+	// If zero, or if MaxGoroutines is zero, the requests aren't queued.
+	MaxQueuedRequests uint `yaml:"max_queued_requests"`
+
+	// QueueTimeout is the maximum time a queued request waits for a worker
+	// before it's refused.  If zero, the default of one second is used.
+	QueueTimeout timeutil.Duration `yaml:"queue_timeout"`
+
 	// HandleDDR, if true, handle DDR requests
 	HandleDDR bool `yaml:"handle_ddr"`
 
@@ -170,6 +202,10 @@ type Config struct {
 	// BootstrapPreferIPv6, if true, instructs the bootstrapper to prefer IPv6
 	// addresses to IPv4 ones for DoH, DoQ, and DoT.
 	BootstrapPreferIPv6 bool `yaml:"bootstrap_prefer_ipv6"`
+
+	// RoutingRules are the rules overriding the processing of the matching
+	// requests after the filtering.
+	RoutingRules []*RoutingRule `yaml:"routing_rules"`
 }
 
 // EDNSClientSubnet is the settings list for EDNS Client Subnet.
@@ -184,6 +220,31 @@ type EDNSClientSubnet struct {
 	UseCustom bool `yaml:"use_custom"`
 }
 
+// EDNSClientMAC is the settings of the client MAC addresses sent in the EDNS
+// options by the downstream forwarders, such as dnsmasq with the add-mac
+// option.
+type EDNSClientMAC struct {
+	// TrustedForwarders are the networks of the forwarders which options are
+	// used.  The options from the other addresses are ignored.
+	TrustedForwarders []netutil.Prefix `yaml:"trusted_forwarders"`
+
+	// OptionCode is the code of the EDNS option carrying the MAC address.  If
+	// it's zero, [defaultEDNSClientMACCode] is used.
+	OptionCode uint16 `yaml:"option_code"`
+
+	// Enabled defines if the client MAC addresses from the EDNS options are
+	// used to identify the clients.
+	Enabled bool `yaml:"enabled"`
+}
+
+// BootstrapPrefersIPv6 returns true if the bootstrapper should prefer IPv6
+// addresses, either because it's configured to, see
+// [Config.BootstrapPreferIPv6], or because the host has no IPv4 addresses to
+// connect from.
+func (c *Config) BootstrapPrefersIPv6() (ok bool) {
+	return c.BootstrapPreferIPv6 || !aghnet.HasIPv4()
+}
+
 // TLSConfig is the TLS configuration for HTTPS, DNS-over-HTTPS, and DNS-over-TLS
 type TLSConfig struct {
 	cert tls.Certificate
@@ -207,6 +268,15 @@ type TLSConfig struct {
 	// used for ClientID checking and Discovery of Designated Resolvers (DDR).
 	ServerName string `yaml:"-" json:"-"`
 
+	// ClientIDPattern, if not empty, is the regular expression all ClientIDs
+	// from the DoT and DoQ server names and DoH paths must match.  Requests
+	// with the ClientIDs that don't match it are rejected.
+	ClientIDPattern string `yaml:"clientid_pattern" json:"clientid_pattern,omitempty"`
+
+	// clientIDRe is the compiled ClientIDPattern.  It's nil if the pattern is
+	// empty.
+	clientIDRe *regexp.Regexp
+
 	// DNS names from certificate (SAN) or CN value from Subject
 	dnsNames []string
 
@@ -241,6 +311,10 @@ type ServerConfig struct {
 	// TCPListenAddrs is the list of addresses to listen for DNS-over-TCP.
 	TCPListenAddrs []*net.TCPAddr
 
+	// Listeners are the additional plain-DNS listeners with their own
+	// settings.  They are only used if ServePlainDNS is true.
+	Listeners []*ListenerConfig
+
 	// UpstreamConfig is the general configuration of upstream DNS servers.
 	UpstreamConfig *proxy.UpstreamConfig
 
@@ -263,6 +337,10 @@ type ServerConfig struct {
 	// UpstreamTimeout is the timeout for querying upstream servers.
 	UpstreamTimeout time.Duration
 
+	// CacheFile is the path to the file with the questions to warm up the
+	// cache with, see [Config.CachePersistent].
+	CacheFile string
+
 	TLSv12Roots *x509.CertPool // list of root CAs for TLSv1.2
 
 	// TLSCiphers are the IDs of TLS cipher suites to use.
@@ -331,7 +409,7 @@ func (s *Server) newProxyConfig() (conf *proxy.Config, err error) {
 		RequestHandler:            s.handleDNSRequest,
 		HTTPSServerName:           aghhttp.UserAgent(),
 		EnableEDNSClientSubnet:    srvConf.EDNSClientSubnet.Enabled,
-		MaxGoroutines:             srvConf.MaxGoroutines,
+		MaxGoroutines:             proxyMaxGoroutines(srvConf.MaxGoroutines, srvConf.MaxQueuedRequests),
 		UseDNS64:                  srvConf.UseDNS64,
 		DNS64Prefs:                srvConf.DNS64Prefixes,
 		UsePrivateRDNS:            srvConf.UsePrivateRDNS,
@@ -354,6 +432,12 @@ func (s *Server) newProxyConfig() (conf *proxy.Config, err error) {
 		return nil, fmt.Errorf("bogus_nxdomain: %w", err)
 	}
 
+	s.conf.clientIDRe, err = compileClientIDPattern(s.conf.ClientIDPattern)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
 	err = s.prepareTLS(conf)
 	if err != nil {
 		return nil, fmt.Errorf("validating tls: %w", err)
@@ -675,6 +759,21 @@ func (s *Server) prepareTLS(proxyConfig *proxy.Config) (err error) {
 	return nil
 }
 
+// compileClientIDPattern compiles the ClientID pattern pat.  re is nil if pat
+// is empty.
+func compileClientIDPattern(pat string) (re *regexp.Regexp, err error) {
+	if pat == "" {
+		return nil, nil
+	}
+
+	re, err = regexp.Compile(pat)
+	if err != nil {
+		return nil, fmt.Errorf("clientid_pattern: %w", err)
+	}
+
+	return re, nil
+}
+
 // isWildcard returns true if host is a wildcard hostname.
 func isWildcard(host string) (ok bool) {
 	return strings.HasPrefix(host, "*.")
@@ -721,8 +820,13 @@ func (s *Server) onGetCertificate(ch *tls.ClientHelloInfo) (*tls.Certificate, er
 // preparePlain assumes that prepareTLS has already been called.
 func (s *Server) preparePlain(proxyConf *proxy.Config) (err error) {
 	if s.conf.ServePlainDNS {
-		proxyConf.UDPListenAddr = s.conf.UDPListenAddrs
-		proxyConf.TCPListenAddr = s.conf.TCPListenAddrs
+		proxyConf.UDPListenAddr = slices.Clone(s.conf.UDPListenAddrs)
+		proxyConf.TCPListenAddr = slices.Clone(s.conf.TCPListenAddrs)
+
+		for _, l := range s.conf.Listeners {
+			proxyConf.UDPListenAddr = append(proxyConf.UDPListenAddr, l.UDPListenAddrs...)
+			proxyConf.TCPListenAddr = append(proxyConf.TCPListenAddr, l.TCPListenAddrs...)
+		}
 
 		return nil
 	}
@@ -770,6 +874,19 @@ func (s *Server) UpdatedProtectionStatus() (enabled bool, disabledUntil *time.Ti
 	return true, nil
 }
 
+// SetProtectionEnabled enables or disables the protection indefinitely and
+// saves the configuration.
+func (s *Server) SetProtectionEnabled(enabled bool) {
+	func() {
+		s.serverLock.Lock()
+		defer s.serverLock.Unlock()
+
+		s.dnsFilter.SetProtectionStatus(enabled, nil)
+	}()
+
+	s.conf.ConfigModified()
+}
+
 // enableProtectionAfterPause sets the protection configuration to enabled
 // values.  It is intended to be used as a goroutine.
 func (s *Server) enableProtectionAfterPause() {
@@ -164,25 +164,13 @@ func insertListResults(ups []upstream.Upstream, results map[string]*upstreamResu
 // [upsConfValidator.close] method, since it makes no sense to check the closed
 // upstreams.
 func (cv *upstreamConfigValidator) check() {
-	const (
-		// testTLD is the special-use fully-qualified domain name for testing
-		// the DNS server reachability.
-		//
-		// See https://datatracker.ietf.org/doc/html/rfc6761#section-6.2.
-		testTLD = "test."
-
-		// inAddrARPATLD is the special-use fully-qualified domain name for PTR
-		// IP address resolution.
-		//
-		// See https://datatracker.ietf.org/doc/html/rfc1035#section-3.5.
-		inAddrARPATLD = "in-addr.arpa."
-	)
+	// inAddrARPATLD is the special-use fully-qualified domain name for PTR IP
+	// address resolution.
+	//
+	// See https://datatracker.ietf.org/doc/html/rfc1035#section-3.5.
+	const inAddrARPATLD = "in-addr.arpa."
 
-	commonChecker := &healthchecker{
-		hostname: testTLD,
-		qtype:    dns.TypeA,
-		ansEmpty: true,
-	}
+	commonChecker := newCommonHealthchecker()
 
 	arpaChecker := &healthchecker{
 		hostname: inAddrARPATLD,
@@ -371,6 +359,22 @@ func (err domainSpecificTestError) Unwrap() (wrapped error) {
 	return err.Err
 }
 
+// testTLD is the special-use fully-qualified domain name for testing the DNS
+// server reachability.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6761#section-6.2.
+const testTLD = "test."
+
+// newCommonHealthchecker returns a new healthchecker for the general and the
+// fallback upstreams.
+func newCommonHealthchecker() (hc *healthchecker) {
+	return &healthchecker{
+		hostname: testTLD,
+		qtype:    dns.TypeA,
+		ansEmpty: true,
+	}
+}
+
 // healthchecker checks the upstream's status by exchanging with it.
 type healthchecker struct {
 	// hostname is the name of the host to put into healthcheck DNS request.
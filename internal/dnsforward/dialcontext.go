@@ -8,14 +8,35 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 )
 
 // DialContext is an [aghnet.DialContextFunc] that uses s to resolve hostnames.
 // addr should be a valid host:port address, where host could be a domain name
-// or an IP address.
+// or an IP address.  The resolved addresses are tried in the order of
+// [aghnet.AddrFamilyPrefAuto].
 func (s *Server) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+	return s.dialContext(ctx, network, addr, aghnet.AddrFamilyPrefAuto)
+}
+
+// NewDialContext returns an [aghnet.DialContextFunc] like [Server.DialContext],
+// which tries the resolved addresses of the family preferred by pref first.
+func (s *Server) NewDialContext(pref aghnet.AddrFamilyPref) (dial aghnet.DialContextFunc) {
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		return s.dialContext(ctx, network, addr, pref)
+	}
+}
+
+// dialContext dials addr trying the resolved addresses of the family preferred
+// by pref first.
+func (s *Server) dialContext(
+	ctx context.Context,
+	network string,
+	addr string,
+	pref aghnet.AddrFamilyPref,
+) (conn net.Conn, err error) {
 	log.Debug("dnsforward: dialing %q for network %q", addr, network)
 
 	host, portStr, err := net.SplitHostPort(addr)
@@ -44,6 +65,8 @@ func (s *Server) DialContext(ctx context.Context, network, addr string) (conn ne
 		return nil, fmt.Errorf("no addresses for host %q", host)
 	}
 
+	aghnet.SortAddrs(ips, pref.PreferIPv6())
+
 	log.Debug("dnsforward: resolved %q: %v", host, ips)
 
 	var dialErrs []error
@@ -2,7 +2,6 @@
 package dnsforward
 
 import (
-	"cmp"
 	"context"
 	"fmt"
 	"io"
@@ -18,6 +17,7 @@ import (
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnstap"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/rdns"
@@ -121,6 +121,10 @@ type Server struct {
 	// access drops disallowed clients.
 	access *accessManager
 
+	// listeners are the additional plain-DNS listeners with their own
+	// settings.
+	listeners []*listener
+
 	// localDomainSuffix is the suffix used to detect internal hosts.  It
 	// must be a valid domain name plus dots on each side.
 	localDomainSuffix string
@@ -128,6 +132,18 @@ type Server struct {
 	// ipset processes DNS requests using ipset data.
 	ipset ipsetCtx
 
+	// routing are the compiled routing rules of the configuration.
+	routing []*routingRule
+
+	// upstreamOverride are the general upstream servers set by
+	// [Server.ReconfigureUpstreams] after the proxy has been started.  It's
+	// nil if they haven't been changed since the last start.
+	upstreamOverride atomic.Pointer[proxy.CustomUpstreamConfig]
+
+	// hooks are the compiled-in pipeline hooks registered with [RegisterHook]
+	// by the time the server has been created.
+	hooks []Hook
+
 	// privateNets is the configured set of IP networks considered private.
 	privateNets netutil.SubnetSet
 
@@ -160,6 +176,46 @@ type Server struct {
 	// anonymizer masks the client's IP addresses if needed.
 	anonymizer *aghnet.IPMut
 
+	// logPrivacy anonymizes the query log data.  It's nil if no additional
+	// anonymization is required.
+	logPrivacy *privacy
+
+	// statsPrivacy anonymizes the statistics data.  It's nil if no additional
+	// anonymization is required.
+	statsPrivacy *privacy
+
+	// dnstap sends the queries and the responses to a dnstap collector.  It's
+	// nil if the dnstap output is disabled.
+	dnstap *dnstap.Writer
+
+	// capture captures the raw DNS messages for troubleshooting.
+	capture *packetCapture
+
+	// metrics counts the queries for the metrics endpoint.
+	metrics *serverMetrics
+
+	// realtime counts the queries being processed right now.
+	realtime *realtimeCounters
+
+	// pool limits the number of the queries processed in parallel and queued.
+	// It's nil if the queries aren't queued, see [Config.MaxQueuedRequests].
+	pool atomic.Pointer[workerPool]
+
+	// warmer warms up the cache after the restart.  It's nil if the cache
+	// isn't persistent, see [Config.CachePersistent].
+	warmer atomic.Pointer[cacheWarmer]
+
+	// keepaliveDone stops the keepalive of the upstream servers when closed.
+	// It's nil if the keepalive isn't running, see
+	// [Config.UpstreamKeepaliveIvl].
+	keepaliveDone chan struct{}
+
+	// activity tracks the recent activity of the clients.
+	activity *clientActivity
+
+	// quotas counts the queries of the clients against their query quotas.
+	quotas *quotaTracker
+
 	// clientIDCache is a temporary storage for ClientIDs that were extracted
 	// during the BeforeRequestHandler stage.
 	clientIDCache cache.Cache
@@ -197,7 +253,24 @@ type DNSCreateParams struct {
 	PrivateNets netutil.SubnetSet
 	Anonymizer  *aghnet.IPMut
 	EtcHosts    *aghnet.HostsContainer
+
+	// Dnstap is the dnstap output of the queries and the responses.  It may be
+	// nil.
+	Dnstap *dnstap.Writer
+
+	// LogPrivacy is the anonymization configuration of the query log.  It may
+	// be nil.
+	LogPrivacy *PrivacyConfig
+
+	// StatsPrivacy is the anonymization configuration of the statistics.  It
+	// may be nil.
+	StatsPrivacy *PrivacyConfig
+
 	LocalDomain string
+
+	// PseudonymKey is the key of the clients' pseudonyms.  It must not be
+	// empty if the pseudonymization is enabled in LogPrivacy or StatsPrivacy.
+	PseudonymKey []byte
 }
 
 // NewServer creates a new instance of the dnsforward.Server
@@ -222,6 +295,16 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 		p.Anonymizer = aghnet.NewIPMut(nil)
 	}
 
+	logPrivacy, err := newPrivacy(p.LogPrivacy, p.PseudonymKey)
+	if err != nil {
+		return nil, fmt.Errorf("query log privacy: %w", err)
+	}
+
+	statsPrivacy, err := newPrivacy(p.StatsPrivacy, p.PseudonymKey)
+	if err != nil {
+		return nil, fmt.Errorf("statistics privacy: %w", err)
+	}
+
 	var etcHosts upstream.Resolver
 	if p.EtcHosts != nil {
 		etcHosts = upstream.NewHostsResolver(p.EtcHosts)
@@ -240,7 +323,16 @@ func NewServer(p DNSCreateParams) (s *Server, err error) {
 			EnableLRU: true,
 			MaxCount:  defaultClientIDCacheCount,
 		}),
-		anonymizer: p.Anonymizer,
+		anonymizer:   p.Anonymizer,
+		logPrivacy:   logPrivacy,
+		statsPrivacy: statsPrivacy,
+		dnstap:       p.Dnstap,
+		capture:      newPacketCapture(),
+		metrics:      newServerMetrics(),
+		realtime:     newRealtimeCounters(),
+		activity:     newClientActivity(),
+		quotas:       newQuotaTracker(),
+		hooks:        cloneHooks(),
 		conf: ServerConfig{
 			ServePlainDNS: true,
 		},
@@ -446,6 +538,15 @@ func (s *Server) startLocked() error {
 	err := s.dnsProxy.Start(context.Background())
 	if err == nil {
 		s.isRunning = true
+
+		if w := s.warmer.Load(); w != nil {
+			go w.run(s.dnsProxy)
+		}
+
+		if ivl := s.conf.UpstreamKeepaliveIvl.Duration; ivl > 0 {
+			s.keepaliveDone = make(chan struct{})
+			go s.runUpstreamKeepalive(ivl, s.keepaliveDone)
+		}
 	}
 
 	return err
@@ -478,6 +579,19 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 		return fmt.Errorf("preparing proxy: %w", err)
 	}
 
+	s.pool.Store(newWorkerPool(
+		s.conf.MaxGoroutines,
+		s.conf.MaxQueuedRequests,
+		s.conf.QueueTimeout.Duration,
+	))
+
+	var w *cacheWarmer
+	if s.conf.CachePersistent && s.conf.CacheSize > 0 {
+		w = newCacheWarmer(s.conf.CacheFile)
+	}
+
+	s.warmer.Store(w)
+
 	s.setupDNS64()
 
 	s.access, err = newAccessCtx(
@@ -489,6 +603,11 @@ func (s *Server) Prepare(conf *ServerConfig) (err error) {
 		return fmt.Errorf("preparing access: %w", err)
 	}
 
+	err = s.prepareListeners()
+	if err != nil {
+		return fmt.Errorf("preparing listeners: %w", err)
+	}
+
 	proxyConfig.Fallbacks, err = s.setupFallbackDNS()
 	if err != nil {
 		return fmt.Errorf("setting up fallback dns servers: %w", err)
@@ -521,7 +640,7 @@ func (s *Server) prepareUpstreamSettings(boot upstream.Resolver) (err error) {
 		Bootstrap:    boot,
 		Timeout:      s.conf.UpstreamTimeout,
 		HTTPVersions: UpstreamHTTPVersions(s.conf.UseHTTP3Upstreams),
-		PreferIPv6:   s.conf.BootstrapPreferIPv6,
+		PreferIPv6:   s.conf.BootstrapPrefersIPv6(),
 		// Use a customized set of RootCAs, because Go's default mechanism of
 		// loading TLS roots does not always work properly on some routers so we're
 		// loading roots manually and pass it here.
@@ -580,7 +699,7 @@ func (s *Server) prepareLocalResolvers() (uc *proxy.UpstreamConfig, err error) {
 		Bootstrap: s.bootstrap,
 		Timeout:   defaultLocalTimeout,
 		// TODO(e.burkov): Should we verify server's certificates?
-		PreferIPv6: s.conf.BootstrapPreferIPv6,
+		PreferIPv6: s.conf.BootstrapPrefersIPv6(),
 	}
 
 	addrs := s.conf.LocalPTRResolvers
@@ -618,6 +737,12 @@ func (s *Server) prepareInternalDNS() (err error) {
 		return err
 	}
 
+	err = s.prepareRoutingRules()
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
 	s.conf.PrivateRDNSUpstreamConfig, err = s.prepareLocalResolvers()
 	if err != nil {
 		return err
@@ -642,7 +767,7 @@ func (s *Server) setupFallbackDNS() (uc *proxy.UpstreamConfig, err error) {
 	uc, err = proxy.ParseUpstreamsConfig(fallbacks, &upstream.Options{
 		// TODO(s.chzhen):  Investigate if other options are needed.
 		Timeout:    s.conf.UpstreamTimeout,
-		PreferIPv6: s.conf.BootstrapPreferIPv6,
+		PreferIPv6: s.conf.BootstrapPrefersIPv6(),
 		// TODO(e.burkov):  Use bootstrap.
 	})
 	if err != nil {
@@ -758,6 +883,19 @@ func (s *Server) stopLocked() {
 		logCloserErr(b, "dnsforward: closing bootstrap %s: %s", b.Address())
 	}
 
+	closeRoutingRules(s.routing)
+
+	s.warmer.Load().close()
+
+	if s.keepaliveDone != nil {
+		close(s.keepaliveDone)
+		s.keepaliveDone = nil
+	}
+
+	if uc := s.upstreamOverride.Swap(nil); uc != nil {
+		logCloserErr(uc, "dnsforward: closing reconfigured upstreams: %s")
+	}
+
 	s.isRunning = false
 }
 
@@ -848,27 +986,5 @@ func (s *Server) IsBlockedClient(ip netip.Addr, clientID string) (blocked bool,
 	s.serverLock.RLock()
 	defer s.serverLock.RUnlock()
 
-	blockedByIP := false
-	if ip != (netip.Addr{}) {
-		blockedByIP, rule = s.access.isBlockedIP(ip)
-	}
-
-	allowlistMode := s.access.allowlistMode()
-	blockedByClientID := s.access.isBlockedClientID(clientID)
-
-	// Allow if at least one of the checks allows in allowlist mode, but block
-	// if at least one of the checks blocks in blocklist mode.
-	if allowlistMode && blockedByIP && blockedByClientID {
-		log.Debug("dnsforward: client %v (id %q) is not in access allowlist", ip, clientID)
-
-		// Return now without substituting the empty rule for the
-		// clientID because the rule can't be empty here.
-		return true, rule
-	} else if !allowlistMode && (blockedByIP || blockedByClientID) {
-		log.Debug("dnsforward: client %v (id %q) is in access blocklist", ip, clientID)
-
-		blocked = true
-	}
-
-	return blocked, cmp.Or(rule, clientID)
+	return s.access.isBlockedClient(ip, clientID)
 }
@@ -705,6 +705,9 @@ func TestServerCustomClientUpstream(t *testing.T) {
 		) (conf *proxy.CustomUpstreamConfig, err error) {
 			return customUpsConf, nil
 		},
+		OnClientIDByListener: func(_, _ netip.Addr, _ string) (id string) {
+			return ""
+		},
 	}
 
 	startDeferStop(t, s)
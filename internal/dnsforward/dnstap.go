@@ -0,0 +1,54 @@
+package dnsforward
+
+import (
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnstap"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// processDnstap sends the query and the response to the dnstap collector, if
+// the dnstap output is enabled.
+func (s *Server) processDnstap(dctx *dnsContext) (rc resultCode) {
+	if s.dnstap == nil {
+		return resultCodeSuccess
+	}
+
+	pctx := dctx.proxyCtx
+	m := &dnstap.Message{
+		QueryTime:    dctx.startTime,
+		ResponseTime: time.Now(),
+		Query:        pctx.Req,
+		Response:     pctx.Res,
+		ClientAddr:   pctx.Addr,
+		Protocol:     dnstapProtocol(pctx.Proto),
+	}
+
+	if pctx.Conn != nil {
+		m.ServerAddr = netutil.NetAddrToAddrPort(pctx.Conn.LocalAddr())
+	}
+
+	s.dnstap.Write(m)
+
+	return resultCodeSuccess
+}
+
+// dnstapProtocol returns the dnstap socket protocol for proto.
+func dnstapProtocol(proto proxy.Proto) (p dnstap.SocketProtocol) {
+	switch proto {
+	case proxy.ProtoUDP:
+		return dnstap.SocketProtocolUDP
+	case proxy.ProtoTCP:
+		return dnstap.SocketProtocolTCP
+	case proxy.ProtoTLS:
+		return dnstap.SocketProtocolDoT
+	case proxy.ProtoHTTPS:
+		return dnstap.SocketProtocolDoH
+	case proxy.ProtoQUIC:
+		return dnstap.SocketProtocolDoQ
+	default:
+		// The DNSCrypt transport can't be determined from the context.
+		return dnstap.SocketProtocolUnknown
+	}
+}
@@ -0,0 +1,126 @@
+package dnsforward
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// defaultEDNSClientMACCode is the default code of the EDNS option carrying the
+// client MAC address.  It's used by dnsmasq with the add-mac option.
+const defaultEDNSClientMACCode uint16 = 65001
+
+// Lengths of the MAC address in the EDNS option data in different formats.
+const (
+	// ednsMACLenRaw is the length of the raw MAC address.
+	ednsMACLenRaw = 6
+
+	// ednsMACLenBase64 is the length of the base64-encoded MAC address.
+	ednsMACLenBase64 = 8
+
+	// ednsMACLenText is the length of the MAC address in the colon-separated
+	// hexadecimal text form.
+	ednsMACLenText = 17
+)
+
+// clientMACFromEDNS returns the string representation of the client MAC
+// address from the EDNS option of the request in pctx, if it's enabled and the
+// request came from a trusted forwarder.  The option is removed from the
+// request so that it isn't sent upstream.  mac is empty if there is no such
+// option.
+func (s *Server) clientMACFromEDNS(pctx *proxy.DNSContext) (mac string) {
+	conf := s.conf.EDNSClientMAC
+	if conf == nil || !conf.Enabled {
+		return ""
+	}
+
+	addr := pctx.Addr.Addr().Unmap()
+	if !isTrustedForwarder(conf.TrustedForwarders, addr) {
+		return ""
+	}
+
+	code := conf.OptionCode
+	if code == 0 {
+		code = defaultEDNSClientMACCode
+	}
+
+	data, ok := popEDNSOption(pctx.Req, code)
+	if !ok {
+		return ""
+	}
+
+	hwAddr, err := macFromEDNSOption(data)
+	if err != nil {
+		log.Debug("dnsforward: client mac from %s: %s", addr, err)
+
+		return ""
+	}
+
+	return hwAddr.String()
+}
+
+// isTrustedForwarder returns true if addr is within one of the trusted
+// networks.
+func isTrustedForwarder(trusted []netutil.Prefix, addr netip.Addr) (ok bool) {
+	return slices.ContainsFunc(trusted, func(p netutil.Prefix) (contains bool) {
+		return p.Contains(addr)
+	})
+}
+
+// popEDNSOption removes the local EDNS option with code from req and returns
+// its data.  ok is false if there is no such option.
+func popEDNSOption(req *dns.Msg, code uint16) (data []byte, ok bool) {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return nil, false
+	}
+
+	i := slices.IndexFunc(opt.Option, func(o dns.EDNS0) (found bool) {
+		local, isLocal := o.(*dns.EDNS0_LOCAL)
+
+		return isLocal && local.Code == code
+	})
+	if i < 0 {
+		return nil, false
+	}
+
+	data = opt.Option[i].(*dns.EDNS0_LOCAL).Data
+	opt.Option = slices.Delete(opt.Option, i, i+1)
+
+	return data, true
+}
+
+// macFromEDNSOption parses the MAC address from the data of the EDNS option.
+// The raw, base64, and text formats of dnsmasq are supported.
+func macFromEDNSOption(data []byte) (mac net.HardwareAddr, err error) {
+	switch len(data) {
+	case ednsMACLenRaw:
+		return net.HardwareAddr(slices.Clone(data)), nil
+	case ednsMACLenBase64:
+		var raw []byte
+		raw, err = base64.RawURLEncoding.DecodeString(string(data))
+		if err != nil {
+			raw, err = base64.RawStdEncoding.DecodeString(string(data))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("decoding base64: %w", err)
+		} else if len(raw) != ednsMACLenRaw {
+			return nil, fmt.Errorf("bad decoded length %d", len(raw))
+		}
+
+		return raw, nil
+	case ednsMACLenText:
+		// Don't wrap the error since it's informative enough as is.
+		return net.ParseMAC(string(data))
+	default:
+		return nil, fmt.Errorf("bad option length %d", len(data))
+	}
+}
@@ -0,0 +1,123 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMACFromEDNSOption(t *testing.T) {
+	wantMAC := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		data       []byte
+		want       net.HardwareAddr
+	}{{
+		name:       "raw",
+		wantErrMsg: "",
+		data:       []byte(wantMAC),
+		want:       wantMAC,
+	}, {
+		name:       "base64",
+		wantErrMsg: "",
+		data:       []byte("ABEiM0RV"),
+		want:       wantMAC,
+	}, {
+		name:       "text",
+		wantErrMsg: "",
+		data:       []byte("00:11:22:33:44:55"),
+		want:       wantMAC,
+	}, {
+		name:       "bad_length",
+		wantErrMsg: "bad option length 3",
+		data:       []byte{1, 2, 3},
+		want:       nil,
+	}, {
+		name:       "bad_base64",
+		wantErrMsg: "decoding base64: illegal base64 data at input byte 0",
+		data:       []byte("!!!!!!!!"),
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mac, err := macFromEDNSOption(tc.data)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, mac)
+		})
+	}
+}
+
+func TestServer_clientMACFromEDNS(t *testing.T) {
+	const wantMAC = "00:11:22:33:44:55"
+
+	srv := &Server{
+		conf: ServerConfig{
+			Config: Config{
+				EDNSClientMAC: &EDNSClientMAC{
+					TrustedForwarders: []netutil.Prefix{{
+						Prefix: netip.MustParsePrefix("192.168.1.0/24"),
+					}},
+					Enabled: true,
+				},
+			},
+		},
+	}
+
+	newReq := func(t *testing.T) (req *dns.Msg) {
+		t.Helper()
+
+		req = (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+		req.SetEdns0(dns.DefaultMsgSize, false)
+		opt := req.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{
+			Code: defaultEDNSClientMACCode,
+			Data: []byte(wantMAC),
+		})
+
+		return req
+	}
+
+	testCases := []struct {
+		addr     netip.AddrPort
+		name     string
+		want     string
+		wantOpts int
+	}{{
+		addr:     netip.MustParseAddrPort("192.168.1.1:53"),
+		name:     "trusted",
+		want:     wantMAC,
+		wantOpts: 0,
+	}, {
+		addr:     netip.MustParseAddrPort("10.0.0.1:53"),
+		name:     "untrusted",
+		want:     "",
+		wantOpts: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Req:  newReq(t),
+				Addr: tc.addr,
+			}
+
+			assert.Equal(t, tc.want, srv.clientMACFromEDNS(pctx))
+
+			opt := pctx.Req.IsEdns0()
+			require.NotNil(t, opt)
+
+			assert.Len(t, opt.Option, tc.wantOpts)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// Hook is a compiled-in middleware of the DNS processing pipeline.  Besides
+// Name, it must implement at least one of [PreFilterHook], [PostFilterHook],
+// [PreUpstreamHook], and [PostAnswerHook].
+type Hook interface {
+	// Name returns the unique name of the hook used in the logs and the
+	// errors.
+	Name() (name string)
+}
+
+// PreFilterHook is called before the request is filtered.  It may modify the
+// request or set the response, in which case neither the filtering nor the
+// upstream servers are applied.
+type PreFilterHook interface {
+	Hook
+
+	PreFilter(hctx *HookContext) (err error)
+}
+
+// PostFilterHook is called after the request has been filtered.
+// [HookContext.Result] contains the filtering result.
+type PostFilterHook interface {
+	Hook
+
+	PostFilter(hctx *HookContext) (err error)
+}
+
+// PreUpstreamHook is called right before the request is sent to the upstream
+// servers.  It may route the request by setting [HookContext.Upstream] or
+// answer it by setting [HookContext.Res].
+type PreUpstreamHook interface {
+	Hook
+
+	PreUpstream(hctx *HookContext) (err error)
+}
+
+// PostAnswerHook is called after the response has been received and filtered,
+// before it's logged and sent to the client.  It may modify or replace the
+// response.
+type PostAnswerHook interface {
+	Hook
+
+	PostAnswer(hctx *HookContext) (err error)
+}
+
+// HookContext is the data of a request passed to the hooks.  The changes of
+// Req, Res, and Upstream are applied to the request after the hook returns.
+type HookContext struct {
+	// Req is the request.  It's never nil.
+	Req *dns.Msg
+
+	// Res is the response.  It's nil until the request is answered.
+	Res *dns.Msg
+
+	// Result is the filtering result.  It's empty before the filtering and
+	// must not be modified.  It's never nil.
+	Result *filtering.Result
+
+	// Upstream is the upstream configuration used for this request instead of
+	// the global one.  It's nil if the global one is used.
+	Upstream *proxy.CustomUpstreamConfig
+
+	// ClientID is the ClientID of the client, if any.
+	ClientID string
+
+	// Addr is the address of the client.
+	Addr netip.AddrPort
+
+	// Proto is the protocol the request has been received over.
+	Proto proxy.Proto
+}
+
+// hooksMu protects registeredHooks.
+var hooksMu = &sync.Mutex{}
+
+// registeredHooks are the hooks in the order of registration.
+var registeredHooks []Hook
+
+// RegisterHook adds h to the hooks applied by the DNS servers created after the
+// call.  It's intended to be called from the init functions of the compiled-in
+// modules.  It panics if the name of h isn't unique or if h doesn't implement
+// any of the hook points.
+func RegisterHook(h Hook) {
+	switch h.(type) {
+	case PreFilterHook, PostFilterHook, PreUpstreamHook, PostAnswerHook:
+		// Go on.
+	default:
+		panic(fmt.Errorf("dnsforward: hook %q implements no hook points", h.Name()))
+	}
+
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	name := h.Name()
+	if slices.ContainsFunc(registeredHooks, func(r Hook) (ok bool) { return r.Name() == name }) {
+		panic(fmt.Errorf("dnsforward: hook %q is already registered", name))
+	}
+
+	registeredHooks = append(registeredHooks, h)
+}
+
+// cloneHooks returns a copy of the registered hooks.
+func cloneHooks() (hooks []Hook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	return slices.Clone(registeredHooks)
+}
+
+// newHookContext returns the hook context for the request in dctx.
+func newHookContext(dctx *dnsContext) (hctx *HookContext) {
+	pctx := dctx.proxyCtx
+
+	return &HookContext{
+		Req:      pctx.Req,
+		Res:      pctx.Res,
+		Result:   dctx.result,
+		Upstream: pctx.CustomUpstreamConfig,
+		ClientID: dctx.clientID,
+		Addr:     pctx.Addr,
+		Proto:    pctx.Proto,
+	}
+}
+
+// runHooks calls call for each of hooks implementing the hook point and applies
+// the changes to dctx.  It stops at the first error.
+func runHooks[T Hook](
+	hooks []Hook,
+	dctx *dnsContext,
+	call func(h T, hctx *HookContext) (err error),
+) (rc resultCode) {
+	var hctx *HookContext
+	for _, h := range hooks {
+		ph, ok := h.(T)
+		if !ok {
+			continue
+		}
+
+		if hctx == nil {
+			hctx = newHookContext(dctx)
+		}
+
+		err := call(ph, hctx)
+		if err != nil {
+			dctx.err = fmt.Errorf("hook %q: %w", h.Name(), err)
+
+			return resultCodeError
+		}
+	}
+
+	if hctx != nil {
+		pctx := dctx.proxyCtx
+		pctx.Req = hctx.Req
+		pctx.Res = hctx.Res
+		pctx.CustomUpstreamConfig = hctx.Upstream
+	}
+
+	return resultCodeSuccess
+}
+
+// processPreFilterHooks calls the [PreFilterHook] hooks.
+func (s *Server) processPreFilterHooks(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing pre-filter hooks")
+	defer log.Debug("dnsforward: finished processing pre-filter hooks")
+
+	return runHooks(s.hooks, dctx, PreFilterHook.PreFilter)
+}
+
+// processPostFilterHooks calls the [PostFilterHook] hooks.
+func (s *Server) processPostFilterHooks(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing post-filter hooks")
+	defer log.Debug("dnsforward: finished processing post-filter hooks")
+
+	return runHooks(s.hooks, dctx, PostFilterHook.PostFilter)
+}
+
+// processPreUpstreamHooks calls the [PreUpstreamHook] hooks.  It's called from
+// [Server.processUpstream] once the client's upstream configuration is set.
+func (s *Server) processPreUpstreamHooks(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing pre-upstream hooks")
+	defer log.Debug("dnsforward: finished processing pre-upstream hooks")
+
+	return runHooks(s.hooks, dctx, PreUpstreamHook.PreUpstream)
+}
+
+// processPostAnswerHooks calls the [PostAnswerHook] hooks.
+func (s *Server) processPostAnswerHooks(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing post-answer hooks")
+	defer log.Debug("dnsforward: finished processing post-answer hooks")
+
+	return runHooks(s.hooks, dctx, PostAnswerHook.PostAnswer)
+}
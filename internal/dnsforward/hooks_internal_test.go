@@ -0,0 +1,128 @@
+package dnsforward
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHook is a [Hook] for tests, which answers the requests before the
+// filtering.
+type testHook struct {
+	err  error
+	name string
+}
+
+// type check
+var _ PreFilterHook = (*testHook)(nil)
+
+// Name implements the [Hook] interface for *testHook.
+func (h *testHook) Name() (name string) { return h.name }
+
+// PreFilter implements the [PreFilterHook] interface for *testHook.
+func (h *testHook) PreFilter(hctx *HookContext) (err error) {
+	if h.err != nil {
+		return h.err
+	}
+
+	hctx.Res = (&dns.Msg{}).SetReply(hctx.Req)
+
+	return nil
+}
+
+// noPointsHook is a [Hook] implementing none of the hook points.
+type noPointsHook struct{}
+
+// Name implements the [Hook] interface for noPointsHook.
+func (noPointsHook) Name() (name string) { return "no_points" }
+
+func TestRunHooks(t *testing.T) {
+	const testErr errors.Error = "test error"
+
+	testCases := []struct {
+		name       string
+		hooks      []Hook
+		wantRC     resultCode
+		wantRes    bool
+		wantErrMsg string
+	}{{
+		name:       "none",
+		hooks:      nil,
+		wantRC:     resultCodeSuccess,
+		wantRes:    false,
+		wantErrMsg: "",
+	}, {
+		name:       "other_point",
+		hooks:      []Hook{noPointsHook{}},
+		wantRC:     resultCodeSuccess,
+		wantRes:    false,
+		wantErrMsg: "",
+	}, {
+		name:       "answer",
+		hooks:      []Hook{&testHook{name: "answer"}},
+		wantRC:     resultCodeSuccess,
+		wantRes:    true,
+		wantErrMsg: "",
+	}, {
+		name:       "error",
+		hooks:      []Hook{&testHook{name: "fail", err: testErr}},
+		wantRC:     resultCodeError,
+		wantRes:    false,
+		wantErrMsg: `hook "fail": test error`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req: (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA),
+				},
+				result: &filtering.Result{},
+			}
+
+			rc := runHooks(tc.hooks, dctx, PreFilterHook.PreFilter)
+			assert.Equal(t, tc.wantRC, rc)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, dctx.err)
+
+			if tc.wantRes {
+				require.NotNil(t, dctx.proxyCtx.Res)
+
+				assert.Equal(t, dctx.proxyCtx.Req.Id, dctx.proxyCtx.Res.Id)
+			} else {
+				assert.Nil(t, dctx.proxyCtx.Res)
+			}
+		})
+	}
+}
+
+func TestRegisterHook(t *testing.T) {
+	hooksMu.Lock()
+	prev := registeredHooks
+	registeredHooks = nil
+	hooksMu.Unlock()
+
+	t.Cleanup(func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+
+		registeredHooks = prev
+	})
+
+	h := &testHook{name: "test"}
+	RegisterHook(h)
+	assert.Equal(t, []Hook{h}, cloneHooks())
+
+	assert.PanicsWithError(t, `dnsforward: hook "test" is already registered`, func() {
+		RegisterHook(&testHook{name: "test"})
+	})
+
+	assert.PanicsWithError(t, `dnsforward: hook "no_points" implements no hook points`, func() {
+		RegisterHook(noPointsHook{})
+	})
+}
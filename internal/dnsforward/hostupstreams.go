@@ -0,0 +1,165 @@
+package dnsforward
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/routescript"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+)
+
+// hostUpstreamsResp is the response to the GET /control/dns_upstreams HTTP
+// API.
+type hostUpstreamsResp struct {
+	// RoutingRule is the expression of the routing rule matching the request,
+	// if any.
+	RoutingRule string `json:"routing_rule,omitempty"`
+
+	// Upstreams are the addresses of the upstream servers the request is sent
+	// to.  It's empty if the request is blocked or rewritten by the routing
+	// rule.
+	Upstreams []string `json:"upstreams"`
+}
+
+// handleHostUpstreams is the handler for the GET /control/dns_upstreams HTTP
+// API.  It returns the upstream servers the request for the name query
+// parameter with the type query parameter, A by default, is sent to.  The
+// upstream servers of the clients aren't considered.
+func (s *Server) handleHostUpstreams(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := strings.ToLower(q.Get("name"))
+	if name == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "name: empty value")
+
+		return
+	}
+
+	qtype := dns.TypeA
+	if t := q.Get("type"); t != "" {
+		var ok bool
+		qtype, ok = dns.StringToType[strings.ToUpper(t)]
+		if !ok {
+			aghhttp.Error(r, w, http.StatusBadRequest, "type: bad value %q", t)
+
+			return
+		}
+	}
+
+	s.serverLock.RLock()
+	uc := s.conf.UpstreamConfig
+	rules := s.routing
+	s.serverLock.RUnlock()
+
+	fqdn := dns.Fqdn(name)
+	resp := &hostUpstreamsResp{
+		Upstreams: []string{},
+	}
+
+	rule, err := s.matchRoutingRule(rules, fqdn, qtype)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "checking %s: %s", name, err)
+
+		return
+	}
+
+	if rule != nil {
+		resp.RoutingRule = rule.expr.String()
+		uc = rule.upstreamConf
+	}
+
+	if uc != nil {
+		for _, u := range upstreamsForDomain(uc, fqdn) {
+			resp.Upstreams = append(resp.Upstreams, u.Address())
+		}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// matchRoutingRule returns the first of rules matching the request for fqdn
+// with qtype from an unknown client.  rule is nil if there is none.
+func (s *Server) matchRoutingRule(
+	rules []*routingRule,
+	fqdn string,
+	qtype uint16,
+) (rule *routingRule, err error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	setts := s.dnsFilter.Settings()
+	s.dnsFilter.ApplyBlockedServices(setts)
+
+	res, err := s.dnsFilter.CheckHost(strings.TrimSuffix(fqdn, "."), qtype, setts)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	env := &routescript.Env{
+		Name:     fqdn,
+		QType:    dns.Type(qtype).String(),
+		Decision: routingDecision(&res),
+	}
+
+	for _, rule = range rules {
+		if rule.expr.Match(env) {
+			return rule, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// upstreamsForDomain returns the upstreams of uc the request for fqdn is sent
+// to.  It follows the lookup of package proxy, which isn't exported.
+func upstreamsForDomain(uc *proxy.UpstreamConfig, fqdn string) (ups []upstream.Upstream) {
+	if len(uc.DomainReservedUpstreams) == 0 {
+		return uc.Upstreams
+	}
+
+	if uc.SubdomainExclusions.Has(fqdn) {
+		if ups = uc.SpecifiedDomainUpstreams[fqdn]; len(ups) > 0 {
+			return ups
+		}
+
+		_, parent, _ := strings.Cut(fqdn, ".")
+		if ups = uc.DomainReservedUpstreams[parent]; len(ups) > 0 {
+			return ups
+		}
+
+		return uc.Upstreams
+	}
+
+	if ups, ok := reservedUpstreams(uc, fqdn); ok {
+		return ups
+	}
+
+	_, fqdn, _ = strings.Cut(fqdn, ".")
+	if fqdn == "" {
+		fqdn = proxy.UnqualifiedNames
+	}
+
+	for ; fqdn != ""; _, fqdn, _ = strings.Cut(fqdn, ".") {
+		if ups, ok := reservedUpstreams(uc, fqdn); ok {
+			return ups
+		}
+	}
+
+	return uc.Upstreams
+}
+
+// reservedUpstreams returns the upstreams reserved for the domain name.  ok is
+// true if the name has a specification, and ups are the default upstreams if
+// the name is excluded from the reserved ones.
+func reservedUpstreams(uc *proxy.UpstreamConfig, name string) (ups []upstream.Upstream, ok bool) {
+	ups, ok = uc.DomainReservedUpstreams[name]
+	if ok && len(ups) == 0 {
+		ups = uc.Upstreams
+	}
+
+	return ups, ok
+}
@@ -617,27 +617,92 @@ func (s *Server) handleTestUpstreamDNS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.BootstrapDNS = stringutil.FilterOut(req.BootstrapDNS, IsCommentOrEmpty)
-
 	opts := &upstream.Options{
 		Timeout:    s.conf.UpstreamTimeout,
-		PreferIPv6: s.conf.BootstrapPreferIPv6,
+		PreferIPv6: s.conf.BootstrapPrefersIPv6(),
 	}
 
-	var boots []*upstream.UpstreamResolver
-	opts.Bootstrap, boots, err = newBootstrap(req.BootstrapDNS, s.etcHosts, opts)
+	status, err := checkUpstreamsStatus(req, s.etcHosts, opts)
 	if err != nil {
 		aghhttp.Error(r, w, http.StatusBadRequest, "Failed to parse bootstrap servers: %s", err)
 
 		return
 	}
+
+	aghhttp.WriteJSONResponseOK(w, r, status)
+}
+
+// checkUpstreamsStatus checks the upstream servers from req and returns the
+// status of each of them.  etcHosts may be nil.  opts must not be nil, and its
+// bootstrap is replaced with the one from req.
+func checkUpstreamsStatus(
+	req *upstreamJSON,
+	etcHosts upstream.Resolver,
+	opts *upstream.Options,
+) (status map[string]string, err error) {
+	bootstraps := stringutil.FilterOut(req.BootstrapDNS, IsCommentOrEmpty)
+
+	var boots []*upstream.UpstreamResolver
+	opts.Bootstrap, boots, err = newBootstrap(bootstraps, etcHosts, opts)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
 	defer closeBoots(boots)
 
 	cv := newUpstreamConfigValidator(req.Upstreams, req.FallbackDNS, req.PrivateUpstreams, opts)
 	cv.check()
 	cv.close()
 
-	aghhttp.WriteJSONResponseOK(w, r, cv.status())
+	return cv.status(), nil
+}
+
+// UpstreamsCheckConfig is the configuration of the upstream servers checked by
+// [CheckUpstreamsConfig].
+type UpstreamsCheckConfig struct {
+	// Upstreams are the general upstream servers.
+	Upstreams []string
+
+	// Bootstrap are the bootstrap servers.  If empty, the default ones are
+	// used.
+	Bootstrap []string
+
+	// Fallback are the fallback upstream servers.
+	Fallback []string
+
+	// Private are the upstream servers for the private reverse DNS.
+	Private []string
+
+	// Timeout is the timeout of a single check.
+	Timeout time.Duration
+
+	// PreferIPv6 makes the bootstrap prefer the IPv6 addresses.
+	PreferIPv6 bool
+}
+
+// CheckUpstreamsConfig checks the upstream servers from conf the same way the
+// POST /control/test_upstream_dns HTTP API does and returns the status of each
+// of them, which is "OK" for the working ones.  The system hosts files aren't
+// used.  conf must not be nil.
+func CheckUpstreamsConfig(conf *UpstreamsCheckConfig) (status map[string]string, err error) {
+	req := &upstreamJSON{
+		Upstreams:        conf.Upstreams,
+		BootstrapDNS:     conf.Bootstrap,
+		FallbackDNS:      conf.Fallback,
+		PrivateUpstreams: conf.Private,
+	}
+
+	opts := &upstream.Options{
+		Timeout:    conf.Timeout,
+		PreferIPv6: conf.PreferIPv6,
+	}
+
+	status, err = checkUpstreamsStatus(req, nil, opts)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bootstrap servers: %w", err)
+	}
+
+	return status, nil
 }
 
 // handleCacheClear is the handler for the POST /control/cache_clear HTTP API.
@@ -732,6 +797,15 @@ func (s *Server) registerHandlers() {
 
 	s.conf.HTTPRegister(http.MethodPost, "/control/cache_clear", s.handleCacheClear)
 
+	s.conf.HTTPRegister(http.MethodGet, "/control/dns_capture", s.handleCaptureStatus)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dns_capture/pcap", s.handleCapturePcap)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dns_capture/start", s.handleCaptureStart)
+	s.conf.HTTPRegister(http.MethodPost, "/control/dns_capture/stop", s.handleCaptureStop)
+
+	s.conf.HTTPRegister(http.MethodGet, "/control/dns_realtime", s.handleRealtime)
+	s.conf.HTTPRegister(http.MethodGet, "/control/dns_upstreams", s.handleHostUpstreams)
+	s.conf.HTTPRegister(http.MethodGet, "/control/clients/activity", s.handleClientActivity)
+
 	// Register both versions, with and without the trailing slash, to
 	// prevent a 301 Moved Permanently redirect when clients request the
 	// path without the trailing slash.  Those redirects break some clients.
@@ -0,0 +1,96 @@
+package dnsforward
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// runUpstreamKeepalive exchanges with each DNS-over-HTTPS upstream server every
+// ivl until done is closed.  It keeps the connections from being silently
+// dropped by NATs while idle, and, since the upstream recreates its client on
+// a failed exchange, replaces the half-dead connections before a real request
+// stalls on them.  It is intended to be used as a goroutine.
+func (s *Server) runUpstreamKeepalive(ivl time.Duration, done <-chan struct{}) {
+	defer log.OnPanic("dnsforward: upstream keepalive")
+
+	hc := newCommonHealthchecker()
+
+	ticker := time.NewTicker(ivl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.serverLock.RLock()
+			ups := dohUpstreams(s.conf.UpstreamConfig)
+			s.serverLock.RUnlock()
+
+			keepAlive(ups, hc)
+		case <-done:
+			return
+		}
+	}
+}
+
+// keepAlive runs hc on each of ups concurrently and waits for them to finish.
+// The errors are logged.
+func keepAlive(ups []upstream.Upstream, hc *healthchecker) {
+	wg := &sync.WaitGroup{}
+	for _, u := range ups {
+		wg.Add(1)
+		go func(u upstream.Upstream) {
+			defer wg.Done()
+			defer log.OnPanic(fmt.Sprintf("dnsforward: keeping alive upstream %s", u.Address()))
+
+			err := hc.check(u)
+			if err != nil {
+				log.Debug("dnsforward: keeping alive upstream %s: %s", u.Address(), err)
+			}
+		}(u)
+	}
+
+	wg.Wait()
+}
+
+// dohUpstreams returns the unique DNS-over-HTTPS upstream servers of uc,
+// including the domain-specific ones.  uc may be nil.
+func dohUpstreams(uc *proxy.UpstreamConfig) (ups []upstream.Upstream) {
+	if uc == nil {
+		return nil
+	}
+
+	seen := map[upstream.Upstream]struct{}{}
+	add := func(us []upstream.Upstream) {
+		for _, u := range us {
+			if _, ok := seen[u]; ok || !isDoH(u.Address()) {
+				continue
+			}
+
+			seen[u] = struct{}{}
+			ups = append(ups, u)
+		}
+	}
+
+	add(uc.Upstreams)
+	for _, us := range uc.DomainReservedUpstreams {
+		add(us)
+	}
+
+	for _, us := range uc.SpecifiedDomainUpstreams {
+		add(us)
+	}
+
+	return ups
+}
+
+// isDoH returns true if addr is the address of a DNS-over-HTTPS upstream
+// server, including the one over HTTP/3.
+func isDoH(addr string) (ok bool) {
+	return strings.HasPrefix(addr, "https://") || strings.HasPrefix(addr, "h3://")
+}
@@ -0,0 +1,50 @@
+package dnsforward
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoHUpstreams(t *testing.T) {
+	newUps := func(addr string) (u *aghtest.UpstreamMock) {
+		u = aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+			return new(dns.Msg).SetRcode(req, dns.RcodeNameError), nil
+		})
+		u.OnAddress = func() (a string) { return addr }
+
+		return u
+	}
+
+	doh := newUps("https://dns.example/dns-query")
+	doh3 := newUps("h3://dns.example/dns-query")
+	plain := newUps("1.1.1.1:53")
+
+	assert.Nil(t, dohUpstreams(nil))
+
+	uc := &proxy.UpstreamConfig{
+		Upstreams: []upstream.Upstream{doh, plain},
+		DomainReservedUpstreams: map[string][]upstream.Upstream{
+			"example.org.": {doh, doh3},
+		},
+	}
+
+	assert.ElementsMatch(t, []upstream.Upstream{doh, doh3}, dohUpstreams(uc))
+
+	var exchanged atomic.Int32
+	onExc := doh.OnExchange
+	doh.OnExchange = func(req *dns.Msg) (resp *dns.Msg, err error) {
+		exchanged.Add(1)
+
+		return onExc(req)
+	}
+
+	keepAlive(dohUpstreams(uc), newCommonHealthchecker())
+
+	assert.Equal(t, int32(1), exchanged.Load())
+}
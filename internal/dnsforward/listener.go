@@ -0,0 +1,149 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// ListenerConfig is the configuration of an additional plain-DNS listener with
+// its own settings.
+type ListenerConfig struct {
+	// Name is the name of the listener used in the logs.
+	Name string
+
+	// ClientID is the identifier of the persistent client, which settings are
+	// applied to the queries from the clients not defined more specifically.
+	// If empty, the usual client lookup is performed.
+	ClientID string
+
+	// AllowedClients is the list of IP addresses, CIDR networks, and
+	// ClientIDs of the clients allowed to use this listener, in addition to
+	// the global access settings.
+	AllowedClients []string
+
+	// DisallowedClients is the list of IP addresses, CIDR networks, and
+	// ClientIDs of the clients not allowed to use this listener, in addition
+	// to the global access settings.
+	DisallowedClients []string
+
+	// UDPListenAddrs is the list of addresses to listen for DNS-over-UDP.
+	UDPListenAddrs []*net.UDPAddr
+
+	// TCPListenAddrs is the list of addresses to listen for DNS-over-TCP.
+	TCPListenAddrs []*net.TCPAddr
+
+	// IgnoreQueryLog, if true, makes the queries received on this listener
+	// not to be written into the query log.
+	IgnoreQueryLog bool
+
+	// IgnoreStatistics, if true, makes the queries received on this listener
+	// not to be counted in the statistics.
+	IgnoreStatistics bool
+}
+
+// listener is an additional plain-DNS listener prepared for serving.
+type listener struct {
+	// conf is the configuration of the listener.
+	conf *ListenerConfig
+
+	// access drops the clients disallowed on this listener.
+	access *accessManager
+}
+
+// newListener returns a new listener prepared for serving from conf.
+func newListener(conf *ListenerConfig) (l *listener, err error) {
+	access, err := newAccessCtx(conf.AllowedClients, conf.DisallowedClients, nil)
+	if err != nil {
+		return nil, fmt.Errorf("listener %q: access: %w", conf.Name, err)
+	}
+
+	return &listener{
+		conf:   conf,
+		access: access,
+	}, nil
+}
+
+// has returns true if l is bound to laddr.  If exact is false, the
+// unspecified address of the listener matches any address with the same port.
+func (l *listener) has(laddr netip.AddrPort, exact bool) (ok bool) {
+	for _, a := range l.conf.UDPListenAddrs {
+		ap := netutil.NetAddrToAddrPort(a)
+		if ap.Port() != laddr.Port() {
+			continue
+		}
+
+		ip := ap.Addr().Unmap()
+		if ip == laddr.Addr() || !exact && ip.IsUnspecified() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prepareListeners prepares the additional listeners from s.conf.
+func (s *Server) prepareListeners() (err error) {
+	s.listeners = make([]*listener, 0, len(s.conf.Listeners))
+	for _, conf := range s.conf.Listeners {
+		var l *listener
+		l, err = newListener(conf)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		s.listeners = append(s.listeners, l)
+	}
+
+	return nil
+}
+
+// listenerFor returns the additional listener the plain-DNS request in pctx
+// arrived on.  l is nil if the request arrived on one of the main listeners.
+// The listeners bound to the specific addresses take precedence over the ones
+// bound to all addresses.  s.serverLock is expected to be locked.
+func (s *Server) listenerFor(pctx *proxy.DNSContext) (l *listener) {
+	if len(s.listeners) == 0 || pctx.Conn == nil {
+		return nil
+	} else if pctx.Proto != proxy.ProtoUDP && pctx.Proto != proxy.ProtoTCP {
+		return nil
+	}
+
+	laddr := netutil.NetAddrToAddrPort(pctx.Conn.LocalAddr())
+	laddr = netip.AddrPortFrom(laddr.Addr().Unmap(), laddr.Port())
+
+	for _, exact := range []bool{true, false} {
+		for _, cur := range s.listeners {
+			if cur.has(laddr, exact) {
+				return cur
+			}
+		}
+	}
+
+	return nil
+}
+
+// isBlockedOnListener returns true if the client with clientID, which sent the
+// request in pctx, isn't allowed to use the additional listener the request
+// arrived on.
+func (s *Server) isBlockedOnListener(pctx *proxy.DNSContext, clientID string) (blocked bool) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	l := s.listenerFor(pctx)
+	if l == nil {
+		return false
+	}
+
+	blocked, _ = l.access.isBlockedClient(pctx.Addr.Addr(), clientID)
+	if blocked {
+		log.Debug("dnsforward: client %s is blocked on listener %q", pctx.Addr.Addr(), l.conf.Name)
+	}
+
+	return blocked
+}
@@ -0,0 +1,147 @@
+package dnsforward
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocalConn is a net.Conn with a local address for tests.
+type testLocalConn struct {
+	// Conn is embedded here simply to make testLocalConn a net.Conn without
+	// actually implementing all methods.
+	net.Conn
+
+	laddr net.Addr
+}
+
+// LocalAddr implements the net.Conn interface for testLocalConn.
+func (c testLocalConn) LocalAddr() (addr net.Addr) {
+	return c.laddr
+}
+
+// newTestListener returns a new listener with name bound to addrs.
+func newTestListener(t *testing.T, name string, addrs ...string) (l *listener) {
+	t.Helper()
+
+	conf := &ListenerConfig{
+		Name:              name,
+		DisallowedClients: []string{"192.168.20.66"},
+	}
+
+	for _, a := range addrs {
+		conf.UDPListenAddrs = append(
+			conf.UDPListenAddrs,
+			net.UDPAddrFromAddrPort(netip.MustParseAddrPort(a)),
+		)
+	}
+
+	l, err := newListener(conf)
+	require.NoError(t, err)
+
+	return l
+}
+
+func TestServer_ListenerFor(t *testing.T) {
+	guest := newTestListener(t, "guest", "192.168.20.1:53")
+	iot := newTestListener(t, "iot", "0.0.0.0:5353")
+
+	s := &Server{
+		listeners: []*listener{iot, guest},
+	}
+
+	testCases := []struct {
+		want  *listener
+		laddr net.Addr
+		name  string
+		proto proxy.Proto
+	}{{
+		want:  guest,
+		laddr: net.UDPAddrFromAddrPort(netip.MustParseAddrPort("192.168.20.1:53")),
+		name:  "udp_exact",
+		proto: proxy.ProtoUDP,
+	}, {
+		want:  guest,
+		laddr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("[::ffff:192.168.20.1]:53")),
+		name:  "tcp_mapped",
+		proto: proxy.ProtoTCP,
+	}, {
+		want:  iot,
+		laddr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("192.168.30.1:5353")),
+		name:  "tcp_wildcard",
+		proto: proxy.ProtoTCP,
+	}, {
+		want:  iot,
+		laddr: net.UDPAddrFromAddrPort(netip.MustParseAddrPort("0.0.0.0:5353")),
+		name:  "udp_wildcard",
+		proto: proxy.ProtoUDP,
+	}, {
+		want:  nil,
+		laddr: net.UDPAddrFromAddrPort(netip.MustParseAddrPort("0.0.0.0:53")),
+		name:  "main",
+		proto: proxy.ProtoUDP,
+	}, {
+		want:  nil,
+		laddr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("192.168.20.1:53")),
+		name:  "not_plain",
+		proto: proxy.ProtoTLS,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Proto: tc.proto,
+				Conn:  testLocalConn{laddr: tc.laddr},
+			}
+
+			assert.Equal(t, tc.want, s.listenerFor(pctx))
+		})
+	}
+}
+
+func TestServer_IsBlockedOnListener(t *testing.T) {
+	s := &Server{
+		listeners: []*listener{newTestListener(t, "guest", "192.168.20.1:53")},
+	}
+
+	laddr := net.UDPAddrFromAddrPort(netip.MustParseAddrPort("192.168.20.1:53"))
+	mainAddr := net.UDPAddrFromAddrPort(netip.MustParseAddrPort("192.168.1.1:53"))
+
+	testCases := []struct {
+		laddr net.Addr
+		name  string
+		cli   string
+		want  bool
+	}{{
+		laddr: laddr,
+		name:  "allowed",
+		cli:   "192.168.20.5:1234",
+		want:  false,
+	}, {
+		laddr: laddr,
+		name:  "disallowed",
+		cli:   "192.168.20.66:1234",
+		want:  true,
+	}, {
+		laddr: mainAddr,
+		name:  "main_listener",
+		cli:   "192.168.20.66:1234",
+		want:  false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pctx := &proxy.DNSContext{
+				Proto: proxy.ProtoUDP,
+				Conn:  testLocalConn{laddr: tc.laddr},
+				Addr:  netip.MustParseAddrPort(tc.cli),
+			}
+
+			assert.Equal(t, tc.want, s.isBlockedOnListener(pctx, ""))
+		})
+	}
+}
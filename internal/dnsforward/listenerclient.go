@@ -0,0 +1,57 @@
+package dnsforward
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// clientIDByListener returns the identifier of the persistent client configured
+// for the additional listener l, if any, or defined by the listener or the
+// network interface the request in pctx arrived on.  id is empty if there is no
+// such client, the client is defined more specifically, or the local address
+// can't be determined.
+func (s *Server) clientIDByListener(pctx *proxy.DNSContext, l *listener) (id string) {
+	cc := s.conf.ClientsContainer
+	if cc == nil {
+		return ""
+	}
+
+	var listenerID string
+	if l != nil {
+		listenerID = l.conf.ClientID
+	}
+
+	laddr := localAddr(pctx)
+	if listenerID == "" && (!laddr.IsValid() || laddr.IsUnspecified()) {
+		return ""
+	}
+
+	return cc.ClientIDByListener(pctx.Addr.Addr(), laddr, listenerID)
+}
+
+// localAddr returns the local address the request in pctx arrived on.  It's
+// unspecified for the listeners bound to all addresses and invalid for the
+// DNSCrypt ones.
+func localAddr(pctx *proxy.DNSContext) (laddr netip.Addr) {
+	var addr net.Addr
+	switch {
+	case pctx.Conn != nil:
+		addr = pctx.Conn.LocalAddr()
+	case pctx.QUICConnection != nil:
+		addr = pctx.QUICConnection.LocalAddr()
+	case pctx.HTTPRequest != nil:
+		addr, _ = pctx.HTTPRequest.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	default:
+		// The local address of DNSCrypt connections isn't known.
+	}
+
+	if addr == nil {
+		return netip.Addr{}
+	}
+
+	return netutil.NetAddrToAddrPort(addr).Addr().Unmap()
+}
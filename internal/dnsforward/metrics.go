@@ -0,0 +1,177 @@
+package dnsforward
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// maxMetricsClients is the maximum number of clients with separate counters.
+const maxMetricsClients = 1000
+
+// maxMetricsUpstreams is the maximum number of upstreams with separate
+// counters.
+const maxMetricsUpstreams = 100
+
+// serverMetrics contains the counters of the DNS queries.
+type serverMetrics struct {
+	// queries counts the queries by the question type and the filtering
+	// reason.
+	queries *metrics.CounterVec
+
+	// upstreams counts the queries by the upstream which has responded.
+	upstreams *metrics.CounterVec
+
+	// cache counts the cache hits and misses of the queries that have been
+	// resolved.
+	cache *metrics.CounterVec
+
+	// clients counts the queries by the client.
+	clients *metrics.CounterVec
+
+	// shed counts the queries refused by the worker pool by the reason.
+	shed *metrics.CounterVec
+
+	// total is the number of the queries processed since the start.
+	total *atomic.Uint64
+
+	// blocked is the number of the queries blocked since the start.
+	blocked *atomic.Uint64
+}
+
+// newServerMetrics returns new empty counters.
+func newServerMetrics() (m *serverMetrics) {
+	return &serverMetrics{
+		queries: metrics.NewCounterVec(
+			"adguard_dns_queries_total",
+			"Number of the DNS queries by the question type and the filtering reason.",
+			0,
+			"qtype",
+			"reason",
+		),
+		upstreams: metrics.NewCounterVec(
+			"adguard_dns_upstream_responses_total",
+			"Number of the responses by the upstream server.",
+			maxMetricsUpstreams,
+			"upstream",
+		),
+		cache: metrics.NewCounterVec(
+			"adguard_dns_cache_lookups_total",
+			"Number of the cache lookups by the result, either hit or miss.",
+			0,
+			"result",
+		),
+		clients: metrics.NewCounterVec(
+			"adguard_dns_client_queries_total",
+			"Number of the DNS queries by the client.",
+			maxMetricsClients,
+			"client",
+		),
+		shed: metrics.NewCounterVec(
+			"adguard_dns_shed_queries_total",
+			"Number of the DNS queries refused due to the overload by the reason.",
+			0,
+			"reason",
+		),
+		total:   &atomic.Uint64{},
+		blocked: &atomic.Uint64{},
+	}
+}
+
+// processMetrics updates the counters of the queries.
+func (s *Server) processMetrics(dctx *dnsContext) (rc resultCode) {
+	pctx := dctx.proxyCtx
+	m := s.metrics
+
+	m.queries.Inc(dns.Type(pctx.Req.Question[0].Qtype).String(), dctx.result.Reason.String())
+	m.total.Add(1)
+	if dctx.result.IsFiltered {
+		m.blocked.Add(1)
+	}
+
+	if pctx.Upstream != nil {
+		m.upstreams.Inc(pctx.Upstream.Address())
+		m.cache.Inc("miss")
+	} else if pctx.CachedUpstreamAddr != "" {
+		m.cache.Inc("hit")
+	}
+
+	client := dctx.clientID
+	if client == "" {
+		ip := pctx.Addr.Addr().AsSlice()
+		s.anonymizer.Load()(ip)
+		client = net.IP(ip).String()
+	}
+
+	m.clients.Inc(client)
+
+	return resultCodeSuccess
+}
+
+// QueryCounts returns the numbers of the queries processed and blocked since
+// the server was created.
+func (s *Server) QueryCounts() (total, blocked uint64) {
+	return s.metrics.total.Load(), s.metrics.blocked.Load()
+}
+
+// Stats is a snapshot of the query counters of the server.
+type Stats struct {
+	// Upstreams are the numbers of the responses by the address of the
+	// upstream server.
+	Upstreams map[string]uint64
+
+	// Total is the number of the queries processed since the start.
+	Total uint64
+
+	// Blocked is the number of the queries blocked since the start.
+	Blocked uint64
+
+	// CacheHits is the number of the queries answered from the cache.
+	CacheHits uint64
+
+	// CacheMisses is the number of the queries resolved by the upstream
+	// servers.
+	CacheMisses uint64
+
+	// QPS is the number of the queries received within the last complete
+	// second.
+	QPS uint64
+}
+
+// Stats returns the current values of the query counters.
+func (s *Server) Stats() (st *Stats) {
+	m := s.metrics
+
+	return &Stats{
+		Upstreams:   m.upstreams.Values(),
+		Total:       m.total.Load(),
+		Blocked:     m.blocked.Load(),
+		CacheHits:   m.cache.Value("hit"),
+		CacheMisses: m.cache.Value("miss"),
+		QPS:         s.QPS(),
+	}
+}
+
+// WriteMetrics writes the DNS query metrics to w in the Prometheus text-based
+// exposition format.
+func (s *Server) WriteMetrics(w io.Writer) (err error) {
+	m := s.metrics
+	for _, c := range []*metrics.CounterVec{m.queries, m.upstreams, m.cache, m.clients, m.shed} {
+		err = c.Write(w)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return metrics.WriteGauge(
+		w,
+		"adguard_dns_queued_queries",
+		"Number of the DNS queries waiting for a worker.",
+		float64(s.pool.Load().queueLen()),
+	)
+}
@@ -0,0 +1,133 @@
+package dnsforward
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+)
+
+// PrivacyConfig is the configuration of the anonymization of the data written
+// to the query log or to the statistics.  It's applied in addition to the
+// anonymization of the clients' IP addresses.
+type PrivacyConfig struct {
+	// PseudonymizeClients, if true, replaces the clients' IP addresses and
+	// ClientIDs with keyed hashes, which are stable but can't be linked to the
+	// real ones without the key.  The IP addresses are replaced with addresses
+	// from the fd00::/8 range.
+	PseudonymizeClients bool `yaml:"pseudonymize_clients"`
+
+	// DropSubdomains, if true, replaces the queried domain names with their
+	// registrable domains.  The answers are omitted as well, since they
+	// contain the full domain names.
+	DropSubdomains bool `yaml:"drop_subdomains"`
+
+	// OmitAnswers, if true, disables writing the contents of the answers.  It
+	// has no effect on the statistics, which don't contain the answers.
+	OmitAnswers bool `yaml:"omit_answers"`
+}
+
+// privacy applies a [PrivacyConfig] to the query log and the statistics data.
+type privacy struct {
+	// key is the key of the pseudonyms.
+	key []byte
+
+	conf PrivacyConfig
+}
+
+// newPrivacy returns a new *privacy for conf or nil if conf is nil or has no
+// settings enabled.  key must not be empty if the pseudonymization is enabled.
+func newPrivacy(conf *PrivacyConfig, key []byte) (p *privacy, err error) {
+	if conf == nil || *conf == (PrivacyConfig{}) {
+		return nil, nil
+	}
+
+	if conf.PseudonymizeClients && len(key) == 0 {
+		return nil, errors.Error("no pseudonymization key")
+	}
+
+	return &privacy{
+		key:  key,
+		conf: *conf,
+	}, nil
+}
+
+// pseudonymIP returns the pseudonym of ip as an IPv6 address from the fd00::/8
+// unique local range.
+func (p *privacy) pseudonymIP(ip net.IP) (pseudo net.IP) {
+	sum := p.hash("ip", ip.To16())
+
+	pseudo = make(net.IP, net.IPv6len)
+	pseudo[0] = 0xfd
+	copy(pseudo[1:], sum)
+
+	return pseudo
+}
+
+// pseudonymClientIDLen is the length of the pseudonyms of the ClientIDs in
+// bytes before encoding.
+const pseudonymClientIDLen = 8
+
+// pseudonymClientID returns the pseudonym of the ClientID id.  It returns an
+// empty string if id is empty.
+func (p *privacy) pseudonymClientID(id string) (pseudo string) {
+	if id == "" {
+		return ""
+	}
+
+	return hex.EncodeToString(p.hash("clientid", []byte(id))[:pseudonymClientIDLen])
+}
+
+// hash returns the keyed hash of data.  kind separates the hashes of different
+// kinds of data.
+func (p *privacy) hash(kind string, data []byte) (sum []byte) {
+	mac := hmac.New(sha256.New, p.key)
+	_, _ = mac.Write([]byte(kind))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+// applyToLog modifies params according to the configuration.  params.Question
+// is replaced with a copy if it's modified.
+func (p *privacy) applyToLog(params *querylog.AddParams) {
+	if p.conf.PseudonymizeClients {
+		params.ClientIP = p.pseudonymIP(params.ClientIP)
+		params.ClientID = p.pseudonymClientID(params.ClientID)
+		// The client subnet reveals the network of the client.
+		params.ReqECS = nil
+	}
+
+	if p.conf.DropSubdomains {
+		q := params.Question.Copy()
+		host := aghnet.NormalizeDomain(q.Question[0].Name)
+		q.Question[0].Name = dns.Fqdn(aghnet.RegistrableDomain(host))
+		params.Question = q
+	}
+
+	if p.conf.DropSubdomains || p.conf.OmitAnswers {
+		params.Answer, params.OrigAnswer = nil, nil
+	}
+}
+
+// applyToStats modifies e according to the configuration.
+func (p *privacy) applyToStats(e *stats.Entry) {
+	if p.conf.PseudonymizeClients {
+		if ip := net.ParseIP(e.Client); ip != nil {
+			e.Client = p.pseudonymIP(ip).String()
+		} else {
+			e.Client = p.pseudonymClientID(e.Client)
+		}
+	}
+
+	if p.conf.DropSubdomains {
+		e.Domain = aghnet.RegistrableDomain(e.Domain)
+	}
+}
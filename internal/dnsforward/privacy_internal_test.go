@@ -0,0 +1,127 @@
+package dnsforward
+
+import (
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPrivacy(t *testing.T) {
+	p, err := newPrivacy(nil, nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, p)
+
+	p, err = newPrivacy(&PrivacyConfig{}, nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, p)
+
+	_, err = newPrivacy(&PrivacyConfig{PseudonymizeClients: true}, nil)
+	assert.EqualError(t, err, "no pseudonymization key")
+}
+
+func TestPrivacy_applyToLog(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	req := (&dns.Msg{}).SetQuestion("www.example.co.uk.", dns.TypeA)
+	resp := (&dns.Msg{}).SetReply(req)
+
+	newParams := func() (params *querylog.AddParams) {
+		return &querylog.AddParams{
+			Question:   req,
+			Answer:     resp,
+			OrigAnswer: resp,
+			ReqECS:     &net.IPNet{IP: net.IP{1, 2, 3, 0}, Mask: net.CIDRMask(24, 32)},
+			ClientID:   "laptop",
+			ClientIP:   net.IP{1, 2, 3, 4},
+		}
+	}
+
+	t.Run("pseudonymize", func(t *testing.T) {
+		p, err := newPrivacy(&PrivacyConfig{PseudonymizeClients: true}, key)
+		require.NoError(t, err)
+
+		params := newParams()
+		p.applyToLog(params)
+
+		assert.Len(t, params.ClientIP, net.IPv6len)
+		assert.Equal(t, byte(0xfd), params.ClientIP[0])
+		assert.Len(t, params.ClientID, 2*pseudonymClientIDLen)
+		assert.NotEqual(t, "laptop", params.ClientID)
+		assert.Nil(t, params.ReqECS)
+		assert.Same(t, resp, params.Answer)
+
+		// The pseudonyms must be stable.
+		other := newParams()
+		p.applyToLog(other)
+
+		assert.Equal(t, params.ClientIP, other.ClientIP)
+		assert.Equal(t, params.ClientID, other.ClientID)
+
+		// And depend on the key.
+		otherKey, err := newPrivacy(&PrivacyConfig{PseudonymizeClients: true}, []byte("key"))
+		require.NoError(t, err)
+
+		other = newParams()
+		otherKey.applyToLog(other)
+
+		assert.NotEqual(t, params.ClientIP, other.ClientIP)
+	})
+
+	t.Run("drop_subdomains", func(t *testing.T) {
+		p, err := newPrivacy(&PrivacyConfig{DropSubdomains: true}, nil)
+		require.NoError(t, err)
+
+		params := newParams()
+		p.applyToLog(params)
+
+		assert.Equal(t, "example.co.uk.", params.Question.Question[0].Name)
+		assert.Equal(t, "www.example.co.uk.", req.Question[0].Name)
+		assert.Nil(t, params.Answer)
+		assert.Nil(t, params.OrigAnswer)
+		assert.Equal(t, "laptop", params.ClientID)
+	})
+
+	t.Run("omit_answers", func(t *testing.T) {
+		p, err := newPrivacy(&PrivacyConfig{OmitAnswers: true}, nil)
+		require.NoError(t, err)
+
+		params := newParams()
+		p.applyToLog(params)
+
+		assert.Same(t, req, params.Question)
+		assert.Nil(t, params.Answer)
+		assert.Nil(t, params.OrigAnswer)
+	})
+}
+
+func TestPrivacy_applyToStats(t *testing.T) {
+	p, err := newPrivacy(&PrivacyConfig{
+		PseudonymizeClients: true,
+		DropSubdomains:      true,
+	}, []byte("key"))
+	require.NoError(t, err)
+
+	e := &stats.Entry{
+		Domain: "www.example.org",
+		Client: "1.2.3.4",
+	}
+	p.applyToStats(e)
+
+	assert.Equal(t, "example.org", e.Domain)
+	assert.Equal(t, p.pseudonymIP(net.IP{1, 2, 3, 4}).String(), e.Client)
+
+	e = &stats.Entry{
+		Domain: "example.org",
+		Client: "laptop",
+	}
+	p.applyToStats(e)
+
+	assert.Equal(t, p.pseudonymClientID("laptop"), e.Client)
+}
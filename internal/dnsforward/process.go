@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/golibs/log"
@@ -34,12 +35,26 @@ type dnsContext struct {
 	// err is the error returned from a processing function.
 	err error
 
-	// clientID is the ClientID from DoH, DoQ, or DoT, if provided.
+	// listener is the additional plain-DNS listener the request arrived on.
+	// It's nil if the request arrived on one of the main listeners.
+	listener *listener
+
+	// clientID is the ClientID from DoH, DoQ, or DoT, if provided.  If there
+	// is none, it's the client MAC address from the EDNS option of a trusted
+	// forwarder, if any.
 	clientID string
 
 	// startTime is the time at which the processing of the request has started.
 	startTime time.Time
 
+	// filteringElapsed is the time spent for filtering the request and the
+	// response.
+	filteringElapsed time.Duration
+
+	// resolveElapsed is the time spent for resolving the request by the proxy,
+	// including the cache lookup.
+	resolveElapsed time.Duration
+
 	// origQuestion is the question received from the client.  It is set
 	// when the request is modified by rewrites.
 	origQuestion dns.Question
@@ -58,6 +73,16 @@ type dnsContext struct {
 	// isDHCPHost is true if the request for a local domain name and the DHCP is
 	// available for this request.
 	isDHCPHost bool
+
+	// quotaExceeded is true if the request exceeds a query quota of the
+	// client.
+	quotaExceeded bool
+}
+
+// measureFiltering adds the time elapsed since start to the filtering time.  It
+// is intended to be deferred.
+func (dctx *dnsContext) measureFiltering(start time.Time) {
+	dctx.filteringElapsed += time.Since(start)
 }
 
 // resultCode is the result of a request processing function.
@@ -89,6 +114,26 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 		startTime: time.Now(),
 	}
 
+	s.realtime.start(dctx.startTime)
+	defer s.realtime.finish()
+
+	pool := s.pool.Load()
+	if ok, reason := pool.acquire(); !ok {
+		// Refuse the request instead of dropping it to make the client try
+		// another server.
+		aghlog.Debug(
+			"dnsforward",
+			"shedding request",
+			aghlog.Field{Key: aghlog.KeyClient, Value: pctx.Addr.Addr()},
+			aghlog.Field{Key: "reason", Value: reason},
+		)
+		s.metrics.shed.Inc(reason)
+		pctx.Res = s.makeResponseREFUSED(pctx.Req)
+
+		return nil
+	}
+	defer pool.release()
+
 	type modProcessFunc func(ctx *dnsContext) (rc resultCode)
 
 	// Since (*dnsforward.Server).handleDNSRequest(...) is used as
@@ -101,10 +146,19 @@ func (s *Server) handleDNSRequest(_ *proxy.Proxy, pctx *proxy.DNSContext) error
 		s.processDDRQuery,
 		s.processDHCPHosts,
 		s.processDHCPAddrs,
+		s.processQuotas,
+		s.processPreFilterHooks,
 		s.processFilteringBeforeRequest,
+		s.processPostFilterHooks,
+		s.processRoutingRules,
 		s.processUpstream,
+		s.processCacheWarmer,
 		s.processFilteringAfterResponse,
+		s.processPostAnswerHooks,
 		s.ipset.process,
+		s.processDnstap,
+		s.processCapture,
+		s.processMetrics,
 		s.processQueryLogsAndStats,
 	}
 	for _, process := range mods {
@@ -156,6 +210,13 @@ func (s *Server) processInitial(dctx *dnsContext) (rc resultCode) {
 	pctx := dctx.proxyCtx
 	s.processClientIP(pctx.Addr.Addr())
 
+	func() {
+		s.serverLock.RLock()
+		defer s.serverLock.RUnlock()
+
+		dctx.listener = s.listenerFor(pctx)
+	}()
+
 	q := pctx.Req.Question[0]
 	qt := q.Qtype
 	if s.conf.AAAADisabled && qt == dns.TypeAAAA {
@@ -182,6 +243,17 @@ func (s *Server) processInitial(dctx *dnsContext) (rc resultCode) {
 	var key [8]byte
 	binary.BigEndian.PutUint64(key[:], pctx.RequestID)
 	dctx.clientID = string(s.clientIDCache.Get(key[:]))
+	if dctx.clientID == "" {
+		// Identify the clients behind the downstream forwarders by their MAC
+		// addresses, since persistent clients can be found by them.
+		dctx.clientID = s.clientMACFromEDNS(pctx)
+	}
+
+	if dctx.clientID == "" {
+		// Consider the persistent clients defined by the listeners and network
+		// interfaces the least specific ones.
+		dctx.clientID = s.clientIDByListener(pctx, dctx.listener)
+	}
 
 	// Get the client-specific filtering settings.
 	dctx.protectionEnabled, _ = s.UpdatedProtectionStatus()
@@ -420,6 +492,8 @@ func (s *Server) processFilteringBeforeRequest(dctx *dnsContext) (rc resultCode)
 	log.Debug("dnsforward: started processing filtering before req")
 	defer log.Debug("dnsforward: finished processing filtering before req")
 
+	defer dctx.measureFiltering(time.Now())
+
 	if dctx.proxyCtx.RequestedPrivateRDNS != (netip.Prefix{}) {
 		// There is no need to filter request for locally served ARPA hostname
 		// so disable redundant filters.
@@ -482,6 +556,16 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 
 	s.setCustomUpstream(pctx, dctx.clientID)
 
+	rc = s.processPreUpstreamHooks(dctx)
+	if rc != resultCodeSuccess {
+		return rc
+	} else if pctx.Res != nil {
+		// A hook has answered the request.
+		return resultCodeSuccess
+	}
+
+	req = pctx.Req
+
 	reqWantsDNSSEC := s.setReqAD(req)
 
 	// Process the request further since it wasn't filtered.
@@ -492,13 +576,31 @@ func (s *Server) processUpstream(dctx *dnsContext) (rc resultCode) {
 		return resultCodeError
 	}
 
-	if dctx.err = prx.Resolve(pctx); dctx.err != nil {
+	start := time.Now()
+	dctx.err = prx.Resolve(pctx)
+	dctx.resolveElapsed = time.Since(start)
+	if dctx.err != nil {
+		s.countUpstreamError(pctx)
+
 		return resultCodeError
 	}
 
 	dctx.responseFromUpstream = true
 	dctx.responseAD = pctx.Res.AuthenticatedData
 
+	upsAddr := pctx.CachedUpstreamAddr
+	if pctx.Upstream != nil {
+		upsAddr = pctx.Upstream.Address()
+	}
+
+	aghlog.Debug(
+		"dnsforward",
+		"resolved request",
+		aghlog.Field{Key: aghlog.KeyClient, Value: pctx.Addr.Addr()},
+		aghlog.Field{Key: aghlog.KeyQName, Value: req.Question[0].Name},
+		aghlog.Field{Key: aghlog.KeyUpstream, Value: upsAddr},
+	)
+
 	s.setRespAD(pctx, reqWantsDNSSEC)
 
 	return resultCodeSuccess
@@ -571,6 +673,20 @@ func (s *Server) dhcpHostFromRequest(q *dns.Question) (reqHost string) {
 
 // setCustomUpstream sets custom upstream settings in pctx, if necessary.
 func (s *Server) setCustomUpstream(pctx *proxy.DNSContext, clientID string) {
+	if pctx.CustomUpstreamConfig != nil {
+		// The upstreams have already been chosen by a routing rule.
+		return
+	}
+
+	s.setClientUpstream(pctx, clientID)
+	if pctx.CustomUpstreamConfig == nil {
+		// Use the general upstreams reconfigured without a restart, if any.
+		pctx.CustomUpstreamConfig = s.upstreamOverride.Load()
+	}
+}
+
+// setClientUpstream sets the upstream settings of the client in pctx, if any.
+func (s *Server) setClientUpstream(pctx *proxy.DNSContext, clientID string) {
 	if !pctx.Addr.IsValid() || s.conf.ClientsContainer == nil {
 		return
 	}
@@ -596,6 +712,8 @@ func (s *Server) processFilteringAfterResponse(dctx *dnsContext) (rc resultCode)
 	log.Debug("dnsforward: started processing filtering after resp")
 	defer log.Debug("dnsforward: finished processing filtering after resp")
 
+	defer dctx.measureFiltering(time.Now())
+
 	switch res := dctx.result; res.Reason {
 	case filtering.NotFilteredAllowList:
 		return resultCodeSuccess
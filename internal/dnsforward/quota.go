@@ -0,0 +1,223 @@
+package dnsforward
+
+import (
+	"cmp"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// quotaMaxCounters is the number of the quota counters after which the ones of
+// the expired periods are removed.
+const quotaMaxCounters = 10_000
+
+// quotaKey identifies the counter of a quota of a client.  The quotas are
+// identified by their index and parameters, since the client settings are
+// cloned for each request.
+type quotaKey struct {
+	// id is the ClientID or the IP address of the client.
+	id string
+
+	// period is the period of the quota.
+	period filtering.QuotaPeriod
+
+	// idx is the index of the quota within the client settings.
+	idx int
+
+	// limit is the limit of the quota.
+	limit uint64
+}
+
+// quotaCounter is the number of queries of a client counted by a quota.
+type quotaCounter struct {
+	// start is the start of the current period.
+	start time.Time
+
+	// n is the number of queries within the current period.
+	n uint64
+
+	// lastAllowed is the Unix time of the second the last throttled query has
+	// been allowed within.
+	lastAllowed int64
+
+	// logged is true if exceeding the quota has been logged within the
+	// current period.
+	logged bool
+}
+
+// quotaTracker counts the queries of the clients against their quotas.  It's
+// safe for concurrent use.
+type quotaTracker struct {
+	// mu protects counters.
+	mu *sync.Mutex
+
+	// counters are the query counters of the clients' quotas.
+	counters map[quotaKey]*quotaCounter
+}
+
+// newQuotaTracker returns a new empty quota tracker.
+func newQuotaTracker() (t *quotaTracker) {
+	return &quotaTracker{
+		mu:       &sync.Mutex{},
+		counters: map[quotaKey]*quotaCounter{},
+	}
+}
+
+// count counts the query for host from the client with id at now against
+// quotas.  exceeded is the most restrictive quota exceeded, if any, and act is
+// the action to take on the query.  act is [filtering.QuotaActionLog] for the
+// throttled queries which are allowed.
+func (t *quotaTracker) count(
+	id string,
+	host string,
+	quotas []*filtering.QueryQuota,
+	now time.Time,
+) (exceeded *filtering.QueryQuota, act filtering.QuotaAction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, q := range quotas {
+		if !q.Matches(host) {
+			continue
+		}
+
+		k := quotaKey{
+			id:     id,
+			period: q.Period,
+			idx:    i,
+			limit:  q.Limit,
+		}
+
+		c := t.counterLocked(k, now)
+		c.n++
+		if c.n <= q.Limit {
+			continue
+		}
+
+		qAct := q.Action
+		switch qAct {
+		case filtering.QuotaActionLog:
+			if !c.logged {
+				c.logged = true
+				log.Info("dnsforward: client %q exceeded %s quota of %d queries", id, q.Period, q.Limit)
+			}
+		case filtering.QuotaActionThrottle:
+			if sec := now.Unix(); c.lastAllowed != sec {
+				c.lastAllowed = sec
+				qAct = filtering.QuotaActionLog
+			}
+		default:
+			// Go on.
+		}
+
+		if exceeded == nil || quotaActionSeverity(qAct) > quotaActionSeverity(act) {
+			exceeded, act = q, qAct
+		}
+	}
+
+	return exceeded, act
+}
+
+// counterLocked returns the counter for k, resetting it if its period has
+// expired at now.  t.mu is expected to be locked.
+func (t *quotaTracker) counterLocked(k quotaKey, now time.Time) (c *quotaCounter) {
+	start := k.period.Start(now)
+
+	c, ok := t.counters[k]
+	if !ok {
+		if len(t.counters) >= quotaMaxCounters {
+			t.removeExpiredLocked(now)
+		}
+
+		c = &quotaCounter{}
+		t.counters[k] = c
+	}
+
+	if !c.start.Equal(start) {
+		*c = quotaCounter{
+			start: start,
+		}
+	}
+
+	return c
+}
+
+// removeExpiredLocked removes the counters which periods have expired at now.
+// t.mu is expected to be locked.
+func (t *quotaTracker) removeExpiredLocked(now time.Time) {
+	for k, c := range t.counters {
+		if !c.start.Equal(k.period.Start(now)) {
+			delete(t.counters, k)
+		}
+	}
+}
+
+// quotaActionSeverity returns the severity of act for choosing between the
+// actions of several exceeded quotas.
+func quotaActionSeverity(act filtering.QuotaAction) (sev int) {
+	switch act {
+	case filtering.QuotaActionThrottle:
+		return 1
+	case filtering.QuotaActionBlock:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// processQuotas counts the request against the query quotas of the client and
+// responds to it if a quota is exceeded and the action requires so.
+func (s *Server) processQuotas(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing quotas")
+	defer log.Debug("dnsforward: finished processing quotas")
+
+	pctx := dctx.proxyCtx
+	quotas := dctx.setts.QueryQuotas
+	if len(quotas) == 0 || pctx.Res != nil {
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	id := cmp.Or(dctx.clientID, pctx.Addr.Addr().String())
+	host := aghnet.NormalizeDomain(req.Question[0].Name)
+
+	q, act := s.quotas.count(id, host, quotas, dctx.startTime)
+	if q == nil {
+		return resultCodeSuccess
+	}
+
+	dctx.quotaExceeded = true
+
+	switch act {
+	case filtering.QuotaActionThrottle:
+		pctx.Res = s.makeResponseREFUSED(req)
+	case filtering.QuotaActionBlock:
+		pctx.Res = s.genQuotaBlocked(req, q.BlockIP)
+	default:
+		// Only log and count the query.
+	}
+
+	return resultCodeSuccess
+}
+
+// genQuotaBlocked returns the response to req blocked by a quota.  blockIP is
+// used for the A and AAAA queries of the same protocol version, if it's valid.
+func (s *Server) genQuotaBlocked(req *dns.Msg, blockIP netip.Addr) (resp *dns.Msg) {
+	if !blockIP.IsValid() {
+		return s.genForBlockingMode(req, nil)
+	}
+
+	switch qt := req.Question[0].Qtype; {
+	case qt == dns.TypeA && blockIP.Is4():
+		return s.genARecord(req, blockIP)
+	case qt == dns.TypeAAAA && blockIP.Is6():
+		return s.genAAAARecord(req, blockIP)
+	default:
+		return s.newMsgNODATA(req)
+	}
+}
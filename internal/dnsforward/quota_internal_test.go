@@ -0,0 +1,88 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaTracker_Count(t *testing.T) {
+	const (
+		cliID = "cli"
+		host  = "example.org"
+	)
+
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		action  filtering.QuotaAction
+		wantAct []filtering.QuotaAction
+		offsets []time.Duration
+	}{{
+		name:    "log",
+		action:  filtering.QuotaActionLog,
+		wantAct: []filtering.QuotaAction{"", "", filtering.QuotaActionLog, filtering.QuotaActionLog},
+		offsets: []time.Duration{0, 0, 0, 0},
+	}, {
+		name:   "throttle",
+		action: filtering.QuotaActionThrottle,
+		wantAct: []filtering.QuotaAction{
+			"",
+			"",
+			filtering.QuotaActionLog,
+			filtering.QuotaActionThrottle,
+			filtering.QuotaActionLog,
+		},
+		offsets: []time.Duration{0, 0, 0, 0, time.Second},
+	}, {
+		name:    "block",
+		action:  filtering.QuotaActionBlock,
+		wantAct: []filtering.QuotaAction{"", "", filtering.QuotaActionBlock, ""},
+		offsets: []time.Duration{0, 0, 0, time.Hour},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			qt := newQuotaTracker()
+			quotas := []*filtering.QueryQuota{{
+				Period: filtering.QuotaPeriodHour,
+				Action: tc.action,
+				Limit:  2,
+			}}
+
+			for i, off := range tc.offsets {
+				q, act := qt.count(cliID, host, quotas, now.Add(off))
+				assert.Equal(t, tc.wantAct[i], act, "query at index %d", i)
+				assert.Equal(t, tc.wantAct[i] != "", q != nil, "query at index %d", i)
+			}
+		})
+	}
+}
+
+func TestQuotaTracker_Count_severity(t *testing.T) {
+	qt := newQuotaTracker()
+	quotas := []*filtering.QueryQuota{{
+		Period: filtering.QuotaPeriodDay,
+		Action: filtering.QuotaActionLog,
+		Limit:  1,
+	}, {
+		Period: filtering.QuotaPeriodHour,
+		Action: filtering.QuotaActionBlock,
+		Limit:  1,
+	}}
+
+	now := time.Now()
+
+	q, _ := qt.count("cli", "example.org", quotas, now)
+	assert.Nil(t, q)
+
+	q, act := qt.count("cli", "example.org", quotas, now)
+	assert.Same(t, quotas[1], q)
+	assert.Equal(t, filtering.QuotaActionBlock, act)
+
+	q, _ = qt.count("other", "example.org", quotas, now)
+	assert.Nil(t, q)
+}
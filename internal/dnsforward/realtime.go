@@ -0,0 +1,161 @@
+package dnsforward
+
+import (
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// realtimeCounters are the counters of the queries being processed right now.
+// It's safe for concurrent use.
+type realtimeCounters struct {
+	// mu protects sec, curr, and prev.
+	mu *sync.Mutex
+
+	// inFlight is the number of the queries being processed.
+	inFlight *atomic.Int64
+
+	// sec is the Unix time of the current second.
+	sec int64
+
+	// curr is the number of the queries received within sec.
+	curr uint64
+
+	// prev is the number of the queries received within the second preceding
+	// sec.
+	prev uint64
+}
+
+// newRealtimeCounters returns new empty counters.
+func newRealtimeCounters() (c *realtimeCounters) {
+	return &realtimeCounters{
+		mu:       &sync.Mutex{},
+		inFlight: &atomic.Int64{},
+	}
+}
+
+// start counts a query received at now.  finish must be called once the query
+// is processed.
+func (c *realtimeCounters) start(now time.Time) {
+	c.inFlight.Add(1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rotate(now.Unix())
+	c.curr++
+}
+
+// finish counts a processed query.
+func (c *realtimeCounters) finish() {
+	c.inFlight.Add(-1)
+}
+
+// qps returns the number of the queries received within the last complete
+// second before now.
+func (c *realtimeCounters) qps(now time.Time) (n uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rotate(now.Unix())
+
+	return c.prev
+}
+
+// rotate moves the counters to sec.  c.mu is expected to be locked.
+func (c *realtimeCounters) rotate(sec int64) {
+	switch d := sec - c.sec; {
+	case d <= 0:
+		return
+	case d == 1:
+		c.prev = c.curr
+	default:
+		c.prev = 0
+	}
+
+	c.sec, c.curr = sec, 0
+}
+
+// QPS returns the number of the queries received within the last complete
+// second.
+func (s *Server) QPS() (n uint64) {
+	return s.realtime.qps(time.Now())
+}
+
+// realtimeResp is the response to the GET /control/dns_realtime HTTP API.
+type realtimeResp struct {
+	// UDPInErrors is the system-wide number of the UDP datagrams which
+	// couldn't be received.  It's nil if the OS doesn't provide it.
+	UDPInErrors *uint64 `json:"udp_in_errors"`
+
+	// UDPRcvbufErrors is the system-wide number of the UDP datagrams dropped
+	// due to the full receive buffers.  It's nil if the OS doesn't provide it.
+	UDPRcvbufErrors *uint64 `json:"udp_rcvbuf_errors"`
+
+	// QPS is the number of the queries received within the last second.
+	QPS uint64 `json:"qps"`
+
+	// InFlight is the number of the queries being processed.
+	InFlight int64 `json:"in_flight"`
+
+	// Goroutines is the number of the goroutines of the whole process.
+	Goroutines int `json:"goroutines"`
+
+	// MaxGoroutines is the maximum number of the queries processed in
+	// parallel.  Zero means no limit.
+	MaxGoroutines uint `json:"max_goroutines"`
+
+	// Utilization is the ratio of InFlight to MaxGoroutines.  It's zero if
+	// there is no limit.
+	Utilization float64 `json:"utilization"`
+
+	// Queued is the number of the queries waiting for a worker.
+	Queued int64 `json:"queued"`
+
+	// Shed is the number of the queries refused due to the overload since the
+	// start.
+	Shed uint64 `json:"shed"`
+}
+
+// handleRealtime is the handler for the GET /control/dns_realtime HTTP API.
+// It's cheap enough to be polled every second.
+func (s *Server) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	c := s.realtime
+
+	resp := &realtimeResp{
+		QPS:        c.qps(time.Now()),
+		InFlight:   c.inFlight.Load(),
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	func() {
+		s.serverLock.RLock()
+		defer s.serverLock.RUnlock()
+
+		resp.MaxGoroutines = s.conf.MaxGoroutines
+	}()
+
+	if resp.MaxGoroutines > 0 {
+		resp.Utilization = float64(resp.InFlight) / float64(resp.MaxGoroutines)
+	}
+
+	resp.Queued = s.pool.Load().queueLen()
+	for _, n := range s.metrics.shed.Values() {
+		resp.Shed += n
+	}
+
+	udp, err := aghnet.ReadUDPStats()
+	if err != nil {
+		log.Debug("dnsforward: reading udp stats: %s", err)
+	} else {
+		resp.UDPInErrors, resp.UDPRcvbufErrors = &udp.InErrors, &udp.RcvbufErrors
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
@@ -0,0 +1,25 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealtimeCounters(t *testing.T) {
+	c := newRealtimeCounters()
+	now := time.Unix(1_700_000_000, 0)
+
+	c.start(now)
+	c.start(now.Add(100 * time.Millisecond))
+	c.finish()
+
+	assert.Equal(t, int64(1), c.inFlight.Load())
+	assert.Zero(t, c.qps(now.Add(500*time.Millisecond)))
+
+	c.start(now.Add(time.Second))
+	assert.Equal(t, uint64(2), c.qps(now.Add(time.Second)))
+	assert.Equal(t, uint64(1), c.qps(now.Add(2*time.Second)))
+	assert.Zero(t, c.qps(now.Add(4*time.Second)))
+}
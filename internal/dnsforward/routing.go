@@ -0,0 +1,274 @@
+package dnsforward
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/routescript"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
+)
+
+// RoutingRule overrides the processing of the requests matching an expression.
+// The rules are applied after the filtering, and only the first matching rule
+// is applied.  Exactly one of Upstreams, Rewrite, and Block must be set.
+type RoutingRule struct {
+	// When is the expression matching the requests, see package routescript.
+	When string `yaml:"when"`
+
+	// Upstreams are the upstream servers the matching requests are resolved
+	// with instead of the default or the client's ones.
+	Upstreams []string `yaml:"upstreams,omitempty"`
+
+	// Rewrite is the IP address the matching A and AAAA requests of the same
+	// protocol version are answered with.  The requests of the other types
+	// are answered with an empty response.
+	Rewrite string `yaml:"rewrite,omitempty"`
+
+	// Block, if true, makes the matching requests answered according to the
+	// blocking mode.
+	Block bool `yaml:"block,omitempty"`
+}
+
+// routingRule is a compiled [RoutingRule].
+type routingRule struct {
+	expr *routescript.Expr
+
+	// upstream is the configuration of the rule's upstreams.  It's nil unless
+	// the rule routes the requests.
+	upstream *proxy.CustomUpstreamConfig
+
+	// upstreamConf is the parsed configuration upstream is created from.  It's
+	// nil unless the rule routes the requests.
+	upstreamConf *proxy.UpstreamConfig
+
+	// rewrite is the address to answer with.  It's invalid unless the rule
+	// rewrites the requests.
+	rewrite netip.Addr
+
+	block bool
+}
+
+// newRoutingRules compiles confs.  opts, cacheSize, and ecsEnabled are used to
+// create the upstreams.  The cache of the upstreams is disabled if cacheSize is
+// zero.
+func newRoutingRules(
+	confs []*RoutingRule,
+	opts *upstream.Options,
+	cacheSize uint32,
+	ecsEnabled bool,
+) (rules []*routingRule, err error) {
+	defer func() {
+		if err != nil {
+			closeRoutingRules(rules)
+			rules = nil
+		}
+	}()
+
+	for i, c := range confs {
+		var r *routingRule
+		r, err = newRoutingRule(c, opts, cacheSize, ecsEnabled)
+		if err != nil {
+			return rules, fmt.Errorf("routing rule at index %d: %w", i, err)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// newRoutingRule compiles a single rule.
+func newRoutingRule(
+	c *RoutingRule,
+	opts *upstream.Options,
+	cacheSize uint32,
+	ecsEnabled bool,
+) (r *routingRule, err error) {
+	ups := stringutil.FilterOut(c.Upstreams, IsCommentOrEmpty)
+
+	actions := 0
+	for _, set := range []bool{len(ups) > 0, c.Rewrite != "", c.Block} {
+		if set {
+			actions++
+		}
+	}
+
+	if actions != 1 {
+		return nil, errors.Error("exactly one of upstreams, rewrite, and block must be set")
+	}
+
+	r = &routingRule{
+		block: c.Block,
+	}
+
+	r.expr, err = routescript.Compile(c.When)
+	if err != nil {
+		return nil, fmt.Errorf("when: %w", err)
+	}
+
+	if c.Rewrite != "" {
+		r.rewrite, err = netip.ParseAddr(c.Rewrite)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite: %w", err)
+		}
+	}
+
+	if len(ups) > 0 {
+		var uc *proxy.UpstreamConfig
+		uc, err = proxy.ParseUpstreamsConfig(ups, opts)
+		if err != nil {
+			return nil, fmt.Errorf("upstreams: %w", err)
+		}
+
+		r.upstreamConf = uc
+		r.upstream = proxy.NewCustomUpstreamConfig(uc, cacheSize > 0, int(cacheSize), ecsEnabled)
+	}
+
+	return r, nil
+}
+
+// closeRoutingRules closes the upstreams of rules.
+func closeRoutingRules(rules []*routingRule) {
+	for _, r := range rules {
+		if r.upstream != nil {
+			logCloserErr(r.upstream, "dnsforward: closing routing rule %q upstreams: %s", r.expr)
+		}
+	}
+}
+
+// prepareRoutingRules compiles the routing rules of the configuration.  It
+// assumes s.serverLock is locked or the Server not running.
+func (s *Server) prepareRoutingRules() (err error) {
+	if len(s.conf.RoutingRules) == 0 {
+		s.routing = nil
+
+		return nil
+	}
+
+	s.routing, err = newRoutingRules(
+		s.conf.RoutingRules,
+		&upstream.Options{
+			Bootstrap:    s.bootstrap,
+			Timeout:      s.conf.UpstreamTimeout,
+			HTTPVersions: UpstreamHTTPVersions(s.conf.UseHTTP3Upstreams),
+			PreferIPv6:   s.conf.BootstrapPrefersIPv6(),
+		},
+		s.conf.CacheSize,
+		s.conf.EDNSClientSubnet.Enabled,
+	)
+
+	// Don't wrap the error since it's informative enough as is.
+	return err
+}
+
+// routingDecision returns the routing decision corresponding to res.
+func routingDecision(res *filtering.Result) (d routescript.Decision) {
+	switch res.Reason {
+	case filtering.NotFilteredAllowList:
+		return routescript.DecisionAllowed
+	case
+		filtering.Rewritten,
+		filtering.RewrittenAutoHosts,
+		filtering.RewrittenRule,
+		filtering.FilteredSafeSearch:
+		return routescript.DecisionRewritten
+	default:
+		if res.IsFiltered {
+			return routescript.DecisionBlocked
+		}
+
+		return routescript.DecisionNone
+	}
+}
+
+// processRoutingRules applies the first routing rule matching the request.
+func (s *Server) processRoutingRules(dctx *dnsContext) (rc resultCode) {
+	log.Debug("dnsforward: started processing routing rules")
+	defer log.Debug("dnsforward: finished processing routing rules")
+
+	pctx := dctx.proxyCtx
+	if len(s.routing) == 0 || dctx.quotaExceeded {
+		return resultCodeSuccess
+	} else if pctx.Res != nil && dctx.result.Reason == filtering.NotFilteredNotFound {
+		// The request has been answered before the filtering, for example with
+		// a DHCP lease.
+		return resultCodeSuccess
+	}
+
+	req := pctx.Req
+	q := req.Question[0]
+	env := &routescript.Env{
+		Client:   pctx.Addr.Addr(),
+		Name:     q.Name,
+		QType:    dns.Type(q.Qtype).String(),
+		ClientID: dctx.clientID,
+		Decision: routingDecision(dctx.result),
+	}
+
+	for _, r := range s.routing {
+		if !r.expr.Match(env) {
+			continue
+		}
+
+		log.Debug("dnsforward: request %s %s matches routing rule %q", env.QType, q.Name, r.expr)
+
+		s.applyRoutingRule(dctx, r)
+
+		break
+	}
+
+	return resultCodeSuccess
+}
+
+// applyRoutingRule overrides the processing of the request in dctx according to
+// r.
+func (s *Server) applyRoutingRule(dctx *dnsContext, r *routingRule) {
+	pctx := dctx.proxyCtx
+	req := pctx.Req
+	text := "routing: " + r.expr.String()
+
+	// Undo the rewrites of the question, since the rule overrides them.
+	if dctx.origQuestion.Name != "" {
+		req.Question[0] = dctx.origQuestion
+		dctx.origQuestion = dns.Question{}
+	}
+
+	switch {
+	case r.upstream != nil:
+		// Undo the filtering, since the request is now routed.
+		pctx.Res = nil
+		dctx.result = &filtering.Result{}
+		pctx.CustomUpstreamConfig = r.upstream
+	case r.block:
+		pctx.Res = s.genForBlockingMode(req, nil)
+		dctx.result = &filtering.Result{
+			Rules:      []*filtering.ResultRule{{Text: text}},
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		}
+	default:
+		pctx.Res = s.genRoutingRewrite(req, r.rewrite)
+		dctx.result = &filtering.Result{
+			Rules:  []*filtering.ResultRule{{Text: text, IP: r.rewrite}},
+			Reason: filtering.RewrittenRule,
+		}
+	}
+}
+
+// genRoutingRewrite returns the response to req rewritten to ip.
+func (s *Server) genRoutingRewrite(req *dns.Msg, ip netip.Addr) (resp *dns.Msg) {
+	switch qt := req.Question[0].Qtype; {
+	case qt == dns.TypeA && ip.Is4():
+		return s.genARecord(req, ip)
+	case qt == dns.TypeAAAA && ip.Is6():
+		return s.genAAAARecord(req, ip)
+	default:
+		return s.newMsgNODATA(req)
+	}
+}
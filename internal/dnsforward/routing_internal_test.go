@@ -0,0 +1,199 @@
+package dnsforward
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/routescript"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRoutingRules(t *testing.T) {
+	testCases := []struct {
+		name       string
+		conf       *RoutingRule
+		wantErrMsg string
+	}{{
+		name: "upstreams",
+		conf: &RoutingRule{
+			When:      `name suffix "corp.example"`,
+			Upstreams: []string{"# comment", "10.0.0.1"},
+		},
+		wantErrMsg: "",
+	}, {
+		name: "no_action",
+		conf: &RoutingRule{
+			When:      `name suffix "corp.example"`,
+			Upstreams: []string{"# comment"},
+		},
+		wantErrMsg: "routing rule at index 0: " +
+			"exactly one of upstreams, rewrite, and block must be set",
+	}, {
+		name: "several_actions",
+		conf: &RoutingRule{
+			When:    `name suffix "corp.example"`,
+			Rewrite: "10.0.0.1",
+			Block:   true,
+		},
+		wantErrMsg: "routing rule at index 0: " +
+			"exactly one of upstreams, rewrite, and block must be set",
+	}, {
+		name: "bad_rewrite",
+		conf: &RoutingRule{
+			When:    `name suffix "corp.example"`,
+			Rewrite: "bad",
+		},
+		wantErrMsg: `routing rule at index 0: rewrite: ParseAddr("bad"): ` +
+			`unable to parse IP`,
+	}, {
+		name: "bad_when",
+		conf: &RoutingRule{
+			When:  `host == "a"`,
+			Block: true,
+		},
+		wantErrMsg: `routing rule at index 0: when: compiling "host == \"a\"": ` +
+			`at 0: unknown field "host"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := newRoutingRules([]*RoutingRule{tc.conf}, &upstream.Options{}, 0, false)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			closeRoutingRules(rules)
+		})
+	}
+}
+
+func TestRoutingDecision(t *testing.T) {
+	testCases := []struct {
+		res  *filtering.Result
+		name string
+		want routescript.Decision
+	}{{
+		res:  &filtering.Result{},
+		name: "none",
+		want: routescript.DecisionNone,
+	}, {
+		res:  &filtering.Result{Reason: filtering.NotFilteredAllowList},
+		name: "allowed",
+		want: routescript.DecisionAllowed,
+	}, {
+		res:  &filtering.Result{Reason: filtering.FilteredBlockList, IsFiltered: true},
+		name: "blocked",
+		want: routescript.DecisionBlocked,
+	}, {
+		res:  &filtering.Result{Reason: filtering.RewrittenAutoHosts},
+		name: "rewritten",
+		want: routescript.DecisionRewritten,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, routingDecision(tc.res))
+		})
+	}
+}
+
+func TestServer_ProcessRoutingRules(t *testing.T) {
+	rules, err := newRoutingRules([]*RoutingRule{{
+		When:  `decision == "none" && qtype == "AAAA"`,
+		Block: true,
+	}, {
+		When:    `name suffix "corp.example" && client in "192.0.2.0/24"`,
+		Rewrite: "192.0.2.10",
+	}, {
+		When:      `decision == "blocked" && client_id == "laptop"`,
+		Upstreams: []string{"192.0.2.53"},
+	}}, &upstream.Options{}, 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeRoutingRules(rules) })
+
+	s := &Server{
+		dnsFilter: createTestDNSFilter(t),
+		routing:   rules,
+	}
+
+	blocked := &filtering.Result{Reason: filtering.FilteredBlockList, IsFiltered: true}
+
+	testCases := []struct {
+		result       *filtering.Result
+		name         string
+		host         string
+		clientID     string
+		wantReason   filtering.Reason
+		qtype        uint16
+		wantRes      bool
+		wantUpstream bool
+	}{{
+		result:       &filtering.Result{},
+		name:         "no_match",
+		host:         "www.example.",
+		clientID:     "",
+		wantReason:   filtering.NotFilteredNotFound,
+		qtype:        dns.TypeA,
+		wantRes:      false,
+		wantUpstream: false,
+	}, {
+		result:       &filtering.Result{},
+		name:         "block",
+		host:         "www.example.",
+		clientID:     "",
+		wantReason:   filtering.FilteredBlockList,
+		qtype:        dns.TypeAAAA,
+		wantRes:      true,
+		wantUpstream: false,
+	}, {
+		result:       &filtering.Result{},
+		name:         "rewrite",
+		host:         "Host.Corp.Example.",
+		clientID:     "",
+		wantReason:   filtering.RewrittenRule,
+		qtype:        dns.TypeA,
+		wantRes:      true,
+		wantUpstream: false,
+	}, {
+		result:       blocked,
+		name:         "route_blocked",
+		host:         "www.example.",
+		clientID:     "laptop",
+		wantReason:   filtering.NotFilteredNotFound,
+		qtype:        dns.TypeA,
+		wantRes:      false,
+		wantUpstream: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestMessageWithType(tc.host, tc.qtype)
+
+			var res *dns.Msg
+			if tc.result.IsFiltered {
+				res = s.genForBlockingMode(req, nil)
+			}
+
+			dctx := &dnsContext{
+				proxyCtx: &proxy.DNSContext{
+					Req:  req,
+					Res:  res,
+					Addr: netip.MustParseAddrPort("192.0.2.1:53"),
+				},
+				result:   tc.result,
+				clientID: tc.clientID,
+			}
+
+			rc := s.processRoutingRules(dctx)
+			require.Equal(t, resultCodeSuccess, rc)
+
+			assert.Equal(t, tc.wantReason, dctx.result.Reason)
+			assert.Equal(t, tc.wantRes, dctx.proxyCtx.Res != nil)
+			assert.Equal(t, tc.wantUpstream, dctx.proxyCtx.CustomUpstreamConfig != nil)
+		})
+	}
+}
@@ -2,6 +2,9 @@ package dnsforward
 
 import (
 	"net"
+	"net/netip"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
@@ -9,6 +12,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/miekg/dns"
 )
@@ -23,19 +27,11 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 	host := aghnet.NormalizeDomain(q.Name)
 	processingTime := time.Since(dctx.startTime)
 
-	ip := pctx.Addr.Addr().AsSlice()
-	s.anonymizer.Load()(ip)
-	ipStr := net.IP(ip).String()
+	ip, ids := s.clientIDs(dctx)
+	ipStr := ids[len(ids)-1]
 
 	log.Debug("dnsforward: client ip for stats and querylog: %s", ipStr)
 
-	ids := []string{ipStr}
-	if dctx.clientID != "" {
-		// Use the ClientID first because it has a higher priority.  Filters
-		// have the same priority, see applyAdditionalFiltering.
-		ids = []string{dctx.clientID, ipStr}
-	}
-
 	qt, cl := q.Qtype, q.Qclass
 
 	// Synchronize access to s.queryLog and s.stats so they won't be suddenly
@@ -44,7 +40,16 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 	s.serverLock.RLock()
 	defer s.serverLock.RUnlock()
 
-	if s.shouldLog(host, qt, cl, ids) {
+	shouldLog, shouldCount := s.shouldLog(host, qt, cl, ids), s.shouldCountStat(host, qt, cl, ids)
+	if l := dctx.listener; l != nil {
+		shouldLog = shouldLog && !l.conf.IgnoreQueryLog
+		shouldCount = shouldCount && !l.conf.IgnoreStatistics
+	}
+	if shouldLog || shouldCount {
+		s.activity.add(ids[0], host, clientProto(pctx.Proto), dctx.startTime)
+	}
+
+	if shouldLog {
 		s.logQuery(dctx, ip, processingTime)
 	} else {
 		log.Debug(
@@ -56,7 +61,7 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 		)
 	}
 
-	if s.shouldCountStat(host, qt, cl, ids) {
+	if shouldCount {
 		s.updateStats(dctx, ipStr, processingTime)
 	} else {
 		log.Debug(
@@ -71,6 +76,22 @@ func (s *Server) processQueryLogsAndStats(dctx *dnsContext) (rc resultCode) {
 	return resultCodeSuccess
 }
 
+// clientIDs returns the anonymized IP address of the client of dctx and the IDs
+// to find the client by, the string form of ip being the last one.
+func (s *Server) clientIDs(dctx *dnsContext) (ip net.IP, ids []string) {
+	ip = dctx.proxyCtx.Addr.Addr().AsSlice()
+	s.anonymizer.Load()(ip)
+	ipStr := ip.String()
+
+	if dctx.clientID != "" {
+		// Use the ClientID first because it has a higher priority.  Filters
+		// have the same priority, see applyAdditionalFiltering.
+		return ip, []string{dctx.clientID, ipStr}
+	}
+
+	return ip, []string{ipStr}
+}
+
 // shouldLog returns true if the query with the given data should be logged in
 // the query log.  s.serverLock is expected to be locked.
 func (s *Server) shouldLog(host string, qt, cl uint16, ids []string) (ok bool) {
@@ -104,30 +125,166 @@ func (s *Server) logQuery(dctx *dnsContext, ip net.IP, processingTime time.Durat
 		ClientID:          dctx.clientID,
 		ClientIP:          ip,
 		Elapsed:           processingTime,
+		FilteringElapsed:  dctx.filteringElapsed,
 		AuthenticatedData: dctx.responseAD,
 	}
 
-	switch pctx.Proto {
+	p.ClientProto = clientProto(pctx.Proto)
+
+	if pctx.Upstream != nil {
+		p.Upstream = pctx.Upstream.Address()
+		p.UpstreamGroup = s.upstreamGroup(pctx)
+		p.UpstreamElapsed = pctx.QueryDuration
+	} else if cachedUps := pctx.CachedUpstreamAddr; cachedUps != "" {
+		p.Upstream = pctx.CachedUpstreamAddr
+		p.Cached = true
+		p.CacheElapsed = dctx.resolveElapsed
+	}
+
+	if s.logPrivacy != nil {
+		s.logPrivacy.applyToLog(p)
+	}
+
+	s.queryLog.Add(p)
+}
+
+// clientProto returns the query log client protocol for proto.  It's empty
+// for plain DNS-over-UDP and DNS-over-TCP.
+func clientProto(proto proxy.Proto) (cp querylog.ClientProto) {
+	switch proto {
 	case proxy.ProtoHTTPS:
-		p.ClientProto = querylog.ClientProtoDoH
+		return querylog.ClientProtoDoH
 	case proxy.ProtoQUIC:
-		p.ClientProto = querylog.ClientProtoDoQ
+		return querylog.ClientProtoDoQ
 	case proxy.ProtoTLS:
-		p.ClientProto = querylog.ClientProtoDoT
+		return querylog.ClientProtoDoT
 	case proxy.ProtoDNSCrypt:
-		p.ClientProto = querylog.ClientProtoDNSCrypt
+		return querylog.ClientProtoDNSCrypt
 	default:
 		// Consider this a plain DNS-over-UDP or DNS-over-TCP request.
+		return ""
 	}
+}
 
-	if pctx.Upstream != nil {
-		p.Upstream = pctx.Upstream.Address()
-	} else if cachedUps := pctx.CachedUpstreamAddr; cachedUps != "" {
-		p.Upstream = pctx.CachedUpstreamAddr
-		p.Cached = true
+// upstreamGroup returns the group of the upstream which has resolved the
+// request in pctx.  pctx.Upstream must not be nil.  s.serverLock is expected to
+// be locked.
+func (s *Server) upstreamGroup(pctx *proxy.DNSContext) (g querylog.UpstreamGroup) {
+	u := pctx.Upstream
+	prx := s.dnsProxy
+	switch {
+	case prx == nil:
+		return querylog.UpstreamGroupDefault
+	case pctx.RequestedPrivateRDNS != (netip.Prefix{}),
+		containsUpstream(prx.PrivateRDNSUpstreamConfig, u):
+		return querylog.UpstreamGroupPrivate
+	case containsUpstream(prx.Fallbacks, u):
+		return querylog.UpstreamGroupFallback
+	case pctx.CustomUpstreamConfig != nil &&
+		pctx.CustomUpstreamConfig != s.upstreamOverride.Load() &&
+		!containsUpstream(prx.UpstreamConfig, u):
+		return querylog.UpstreamGroupClient
+	default:
+		return querylog.UpstreamGroupDefault
 	}
+}
 
-	s.queryLog.Add(p)
+// optimisticCacheTTL is the TTL of the records of the expired responses served
+// by the optimistic cache of dnsproxy.
+const optimisticCacheTTL = 10
+
+// cacheResult returns the result of looking up the cache for the request in
+// pctx.  s.serverLock is expected to be locked.
+func (s *Server) cacheResult(pctx *proxy.DNSContext) (r stats.CacheResult) {
+	switch {
+	case s.conf.CacheSize == 0:
+		return stats.CacheResultNone
+	case pctx.Upstream != nil:
+		return stats.CacheResultMiss
+	case pctx.CachedUpstreamAddr == "":
+		return stats.CacheResultNone
+	case s.conf.CacheOptimistic && isStaleResp(pctx.Res):
+		return stats.CacheResultStale
+	default:
+		return stats.CacheResultHit
+	}
+}
+
+// isStaleResp returns true if resp looks like an expired response served by
+// the optimistic cache, that is all its records have [optimisticCacheTTL].
+// dnsproxy doesn't report it otherwise, so a fresh response with such TTLs is
+// counted as well.
+func isStaleResp(resp *dns.Msg) (ok bool) {
+	if resp == nil {
+		return false
+	}
+
+	var n int
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			if hdr.Ttl != optimisticCacheTTL {
+				return false
+			}
+
+			n++
+		}
+	}
+
+	return n > 0
+}
+
+// countUpstreamError counts the failed exchange with the upstreams for the
+// request in pctx in statistics.  The failed upstream itself is unknown, so
+// only the group selected for the request is counted.
+func (s *Server) countUpstreamError(pctx *proxy.DNSContext) {
+	s.serverLock.RLock()
+	defer s.serverLock.RUnlock()
+
+	if s.stats == nil {
+		return
+	}
+
+	var g querylog.UpstreamGroup
+	switch {
+	case pctx.RequestedPrivateRDNS != (netip.Prefix{}):
+		g = querylog.UpstreamGroupPrivate
+	case pctx.CustomUpstreamConfig != nil:
+		g = querylog.UpstreamGroupClient
+	default:
+		g = querylog.UpstreamGroupDefault
+	}
+
+	s.stats.UpdateUpstreamError("", string(g))
+}
+
+// containsUpstream returns true if u is one of the upstreams of uc.
+func containsUpstream(uc *proxy.UpstreamConfig, u upstream.Upstream) (ok bool) {
+	if uc == nil {
+		return false
+	}
+
+	if slices.Contains(uc.Upstreams, u) {
+		return true
+	}
+
+	for _, ups := range uc.DomainReservedUpstreams {
+		if slices.Contains(ups, u) {
+			return true
+		}
+	}
+
+	for _, ups := range uc.SpecifiedDomainUpstreams {
+		if slices.Contains(ups, u) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // updateStats writes the request data into statistics.
@@ -139,10 +296,19 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 		Result:         stats.RNotFiltered,
 		ProcessingTime: processingTime,
 		UpstreamTime:   pctx.QueryDuration,
+		CacheResult:    s.cacheResult(pctx),
+		QType:          pctx.Req.Question[0].Qtype,
+		QuotaExceeded:  dctx.quotaExceeded,
 	}
 
 	if pctx.Upstream != nil {
 		e.Upstream = pctx.Upstream.Address()
+		e.UpstreamGroup = string(s.upstreamGroup(pctx))
+		e.UpstreamFailed = pctx.Res != nil && pctx.Res.Rcode == dns.RcodeServerFailure
+	}
+
+	if pctx.Res != nil {
+		e.RCode = dns.RcodeToString[pctx.Res.Rcode]
 	}
 
 	if clientID := dctx.clientID; clientID != "" {
@@ -158,11 +324,22 @@ func (s *Server) updateStats(dctx *dnsContext, clientIP string, processingTime t
 		e.Result = stats.RParental
 	case filtering.FilteredSafeSearch:
 		e.Result = stats.RSafeSearch
+	case filtering.FilteredThreatFeed:
+		e.Result = stats.RThreatFeed
+		e.ThreatCategory = string(dctx.result.ThreatCategory)
 	case
 		filtering.FilteredBlockList,
 		filtering.FilteredInvalid,
-		filtering.FilteredBlockedService:
+		filtering.FilteredBlockedService,
+		filtering.FilteredNewDomain:
 		e.Result = stats.RFiltered
+		if rules := dctx.result.Rules; len(rules) > 0 {
+			e.FilterList = strconv.Itoa(rules[0].FilterListID)
+		}
+	}
+
+	if s.statsPrivacy != nil {
+		s.statsPrivacy.applyToStats(e)
 	}
 
 	s.stats.Update(e)
@@ -205,6 +205,7 @@ func TestServer_ProcessQueryLogsAndStats(t *testing.T) {
 			queryLog:   ql,
 			stats:      st,
 			anonymizer: aghnet.NewIPMut(nil),
+			activity:   newClientActivity(),
 		}
 		t.Run(tc.name, func(t *testing.T) {
 			req := &dns.Msg{
@@ -236,3 +237,44 @@ func TestServer_ProcessQueryLogsAndStats(t *testing.T) {
 		})
 	}
 }
+
+func TestIsStaleResp(t *testing.T) {
+	newA := func(ttl uint32) (rr dns.RR) {
+		return &dns.A{Hdr: dns.RR_Header{Rrtype: dns.TypeA, Ttl: ttl}}
+	}
+
+	opt := &dns.OPT{Hdr: dns.RR_Header{Rrtype: dns.TypeOPT}}
+
+	testCases := []struct {
+		resp *dns.Msg
+		name string
+		want bool
+	}{{
+		resp: nil,
+		name: "nil",
+		want: false,
+	}, {
+		resp: &dns.Msg{},
+		name: "empty",
+		want: false,
+	}, {
+		resp: &dns.Msg{
+			Answer: []dns.RR{newA(optimisticCacheTTL), newA(optimisticCacheTTL)},
+			Extra:  []dns.RR{opt},
+		},
+		name: "stale",
+		want: true,
+	}, {
+		resp: &dns.Msg{
+			Answer: []dns.RR{newA(optimisticCacheTTL), newA(300)},
+		},
+		name: "fresh",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isStaleResp(tc.resp))
+		})
+	}
+}
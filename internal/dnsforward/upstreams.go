@@ -3,11 +3,13 @@ package dnsforward
 import (
 	"fmt"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/stringutil"
@@ -169,3 +171,135 @@ func setProxyUpstreamMode(
 func IsCommentOrEmpty(s string) (ok bool) {
 	return len(s) == 0 || s[0] == '#'
 }
+
+// CheckUpstreams returns nil if at least one of the general upstream servers
+// answers the healthcheck query.  Otherwise, it returns the errors of all the
+// upstream servers.
+func (s *Server) CheckUpstreams() (err error) {
+	s.serverLock.RLock()
+	uc := s.conf.UpstreamConfig
+	s.serverLock.RUnlock()
+
+	if uc == nil || len(uc.Upstreams) == 0 {
+		return errors.Error("no upstream servers")
+	}
+
+	return checkAnyUpstream(uc.Upstreams, newCommonHealthchecker())
+}
+
+// ReconfigureUpstreams replaces the general upstream servers of the running
+// server with upstreams or, if upstreamsFile isn't empty, with the ones from
+// that file, see [Config.UpstreamDNS] and [Config.UpstreamDNSFileName].  Unlike
+// [Server.Reconfigure], it doesn't restart the listeners, so the new upstream
+// servers are only used for the requests without client-specific ones until the
+// next restart.
+func (s *Server) ReconfigureUpstreams(upstreams []string, upstreamsFile string) (err error) {
+	s.serverLock.Lock()
+	defer s.serverLock.Unlock()
+
+	if !s.isRunning {
+		return errors.Error("server is not running")
+	}
+
+	prevUpstreams, prevFile := s.conf.UpstreamDNS, s.conf.UpstreamDNSFileName
+	s.conf.UpstreamDNS, s.conf.UpstreamDNSFileName = upstreams, upstreamsFile
+
+	err = s.prepareUpstreamSettings(s.bootstrap)
+	if err != nil {
+		s.conf.UpstreamDNS, s.conf.UpstreamDNSFileName = prevUpstreams, prevFile
+
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	uc := proxy.NewCustomUpstreamConfig(
+		s.conf.UpstreamConfig,
+		s.conf.CacheSize > 0,
+		int(s.conf.CacheSize),
+		s.conf.EDNSClientSubnet.Enabled,
+	)
+
+	if prev := s.upstreamOverride.Swap(uc); prev != nil {
+		// The previous configuration isn't used by the proxy, so close it.
+		// The one from the start is closed by the proxy itself.
+		logCloserErr(prev, "dnsforward: closing reconfigured upstreams: %s")
+	}
+
+	log.Info("dnsforward: reconfigured %d upstreams", len(s.conf.UpstreamConfig.Upstreams))
+
+	return nil
+}
+
+// UpstreamHealth is the result of the healthcheck of a single upstream server.
+type UpstreamHealth struct {
+	// Err is the error returned by the healthcheck.  It's nil if the upstream
+	// server answers.
+	Err error
+
+	// Address is the address of the upstream server.
+	Address string
+}
+
+// CheckEachUpstream runs the healthcheck on each of the general upstream
+// servers concurrently and returns the results in the order of the
+// configuration.
+func (s *Server) CheckEachUpstream() (health []*UpstreamHealth) {
+	s.serverLock.RLock()
+	uc := s.conf.UpstreamConfig
+	s.serverLock.RUnlock()
+
+	if uc == nil {
+		return nil
+	}
+
+	hc := newCommonHealthchecker()
+	health = make([]*UpstreamHealth, len(uc.Upstreams))
+
+	wg := &sync.WaitGroup{}
+	for i, u := range uc.Upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer log.OnPanic(fmt.Sprintf("dnsforward: checking upstream %s", u.Address()))
+
+			health[i] = &UpstreamHealth{
+				Err:     hc.check(u),
+				Address: u.Address(),
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return health
+}
+
+// checkAnyUpstream runs hc on all ups concurrently and returns nil as soon as
+// one of them succeeds.  ups must not be empty.
+func checkAnyUpstream(ups []upstream.Upstream, hc *healthchecker) (err error) {
+	errCh := make(chan error, len(ups))
+	for _, u := range ups {
+		go func(u upstream.Upstream) {
+			defer log.OnPanic(fmt.Sprintf("dnsforward: checking upstream %s", u.Address()))
+
+			checkErr := hc.check(u)
+			if checkErr != nil {
+				checkErr = fmt.Errorf("%s: %w", u.Address(), checkErr)
+			}
+
+			errCh <- checkErr
+		}(u)
+	}
+
+	errs := make([]error, 0, len(ups))
+	for range ups {
+		err = <-errCh
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
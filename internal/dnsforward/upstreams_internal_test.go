@@ -7,7 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
@@ -214,3 +216,40 @@ func TestUpstreamConfigValidator_Check_once(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckAnyUpstream(t *testing.T) {
+	const errTest errors.Error = "test error"
+
+	good := aghtest.NewUpstreamMock(func(req *dns.Msg) (resp *dns.Msg, err error) {
+		return (&dns.Msg{}).SetReply(req), nil
+	})
+	bad := aghtest.NewUpstreamMock(func(_ *dns.Msg) (resp *dns.Msg, err error) {
+		return nil, errTest
+	})
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		ups        []upstream.Upstream
+	}{{
+		name:       "good",
+		wantErrMsg: "",
+		ups:        []upstream.Upstream{good},
+	}, {
+		name:       "good_and_bad",
+		wantErrMsg: "",
+		ups:        []upstream.Upstream{bad, good},
+	}, {
+		name: "bad",
+		wantErrMsg: "upstream.example: couldn't communicate with upstream: " +
+			"test error",
+		ups: []upstream.Upstream{bad},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkAnyUpstream(tc.ups, newCommonHealthchecker())
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
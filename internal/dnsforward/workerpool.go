@@ -0,0 +1,117 @@
+package dnsforward
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultQueueTimeout is the default maximum time a request waits in the queue
+// of the worker pool.  Most stub resolvers retry the request by this time.
+const defaultQueueTimeout = 1 * time.Second
+
+// Reasons for shedding the requests.
+const (
+	shedReasonQueueFull = "queue_full"
+	shedReasonTimeout   = "timeout"
+)
+
+// workerPool limits the number of the requests processed in parallel and the
+// number of the ones waiting for a free worker.  The requests exceeding the
+// queue or waiting longer than the timeout are shed.  It's safe for concurrent
+// use.
+type workerPool struct {
+	// workers is the semaphore of the workers.
+	workers chan struct{}
+
+	// queued is the number of the requests waiting for a free worker.
+	queued *atomic.Int64
+
+	// maxQueued is the maximum number of the requests waiting for a free
+	// worker.
+	maxQueued int64
+
+	// timeout is the maximum time a request waits for a free worker.
+	timeout time.Duration
+}
+
+// newWorkerPool returns a new worker pool with the given number of workers and
+// the maximum number of queued requests.  p is nil if any of them is zero,
+// which means that the requests aren't queued by AdGuard Home.
+func newWorkerPool(workers, maxQueued uint, timeout time.Duration) (p *workerPool) {
+	if workers == 0 || maxQueued == 0 {
+		return nil
+	}
+
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+
+	return &workerPool{
+		workers:   make(chan struct{}, workers),
+		queued:    &atomic.Int64{},
+		maxQueued: int64(maxQueued),
+		timeout:   timeout,
+	}
+}
+
+// acquire waits for a free worker.  If the request is shed instead, ok is false
+// and reason describes why.  release must be called once the request is
+// processed if ok is true.  A nil *workerPool always has a free worker.
+func (p *workerPool) acquire() (ok bool, reason string) {
+	if p == nil {
+		return true, ""
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+		return true, ""
+	default:
+		// Go on and wait in the queue.
+	}
+
+	if p.queued.Add(1) > p.maxQueued {
+		p.queued.Add(-1)
+
+		return false, shedReasonQueueFull
+	}
+
+	defer p.queued.Add(-1)
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case p.workers <- struct{}{}:
+		return true, ""
+	case <-timer.C:
+		return false, shedReasonTimeout
+	}
+}
+
+// release frees the worker acquired by acquire.
+func (p *workerPool) release() {
+	if p != nil {
+		<-p.workers
+	}
+}
+
+// queueLen returns the number of the requests waiting for a free worker.
+func (p *workerPool) queueLen() (n int64) {
+	if p == nil {
+		return 0
+	}
+
+	return p.queued.Load()
+}
+
+// proxyMaxGoroutines returns the limit of the goroutines of the proxy for the
+// given number of workers and the maximum number of queued requests.  The proxy
+// blocks reading the packets once the limit is reached, so the limit also
+// leaves room for the requests being shed, which finish immediately.
+func proxyMaxGoroutines(workers, maxQueued uint) (n uint) {
+	if workers == 0 || maxQueued == 0 {
+		return workers
+	}
+
+	return workers + 2*maxQueued
+}
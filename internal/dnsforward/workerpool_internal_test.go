@@ -0,0 +1,54 @@
+package dnsforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool(t *testing.T) {
+	assert.Nil(t, newWorkerPool(0, 10, 0))
+	assert.Nil(t, newWorkerPool(10, 0, 0))
+
+	var nilPool *workerPool
+	ok, _ := nilPool.acquire()
+	assert.True(t, ok)
+
+	nilPool.release()
+
+	p := newWorkerPool(1, 1, 10*time.Millisecond)
+	require.NotNil(t, p)
+
+	ok, _ = p.acquire()
+	require.True(t, ok)
+
+	ok, reason := p.acquire()
+	assert.False(t, ok)
+	assert.Equal(t, shedReasonTimeout, reason)
+	assert.Zero(t, p.queueLen())
+
+	// Occupy the only place in the queue.
+	p.timeout = time.Hour
+	acquired := make(chan struct{})
+	go func() {
+		if ok, _ := p.acquire(); ok {
+			close(acquired)
+		}
+	}()
+
+	require.Eventually(t, func() (ok bool) { return p.queueLen() == 1 }, time.Second, time.Millisecond)
+
+	ok, reason = p.acquire()
+	assert.False(t, ok)
+	assert.Equal(t, shedReasonQueueFull, reason)
+
+	p.release()
+	<-acquired
+
+	assert.Zero(t, p.queueLen())
+
+	assert.Equal(t, uint(300), proxyMaxGoroutines(300, 0))
+	assert.Equal(t, uint(500), proxyMaxGoroutines(300, 100))
+}
@@ -0,0 +1,287 @@
+// Package dnstap implements the dnstap output of the DNS queries and responses.
+//
+// See https://dnstap.info.
+package dnstap
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/miekg/dns"
+)
+
+// Config is the configuration of the dnstap output.
+type Config struct {
+	// Network is the network of the dnstap collector.  Supported values are
+	// "unix" and "tcp".
+	Network string `yaml:"network"`
+
+	// Address is the address of the dnstap collector, e.g.
+	// "/var/run/dnstap.sock" or "192.0.2.1:6000".
+	Address string `yaml:"address"`
+
+	// Identity is the identity of the server sent within the messages.  If
+	// empty, the hostname is used.
+	Identity string `yaml:"identity"`
+
+	// Enabled defines if the dnstap messages are sent.
+	Enabled bool `yaml:"enabled"`
+
+	// LogQueries defines if the client queries are sent.
+	LogQueries bool `yaml:"log_queries"`
+
+	// LogResponses defines if the responses to the clients are sent.
+	LogResponses bool `yaml:"log_responses"`
+}
+
+// Validate returns an error if c contains invalid values.
+func (c *Config) Validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch c.Network {
+	case "unix", "tcp":
+		// Go on.
+	default:
+		return fmt.Errorf("network: unsupported value %q", c.Network)
+	}
+
+	if c.Address == "" {
+		return errors.Error("address: empty value")
+	}
+
+	return nil
+}
+
+// SocketProtocol is the transport protocol of a DNS message.
+type SocketProtocol uint32
+
+// Socket protocols, see the SocketProtocol enumeration in dnstap.proto.
+const (
+	SocketProtocolUnknown     SocketProtocol = 0
+	SocketProtocolUDP         SocketProtocol = 1
+	SocketProtocolTCP         SocketProtocol = 2
+	SocketProtocolDoT         SocketProtocol = 3
+	SocketProtocolDoH         SocketProtocol = 4
+	SocketProtocolDNSCryptUDP SocketProtocol = 5
+	SocketProtocolDNSCryptTCP SocketProtocol = 6
+	SocketProtocolDoQ         SocketProtocol = 7
+)
+
+// Message is a single client query with the response to it.
+type Message struct {
+	// QueryTime is the time when the query has been received.
+	QueryTime time.Time
+
+	// ResponseTime is the time when the response has been sent.
+	ResponseTime time.Time
+
+	// Query is the query received from the client.  It must not be nil.
+	Query *dns.Msg
+
+	// Response is the response sent to the client.  It may be nil.
+	Response *dns.Msg
+
+	// ClientAddr is the address of the client.
+	ClientAddr netip.AddrPort
+
+	// ServerAddr is the address the query has been received on.  It may be
+	// invalid, if unknown.
+	ServerAddr netip.AddrPort
+
+	// Protocol is the transport protocol of the query.
+	Protocol SocketProtocol
+}
+
+// queueSize is the number of frames waiting to be sent.  New frames are dropped
+// when the queue is full.
+const queueSize = 4096
+
+// Writer sends the dnstap messages to a collector.
+type Writer struct {
+	queue chan []byte
+
+	// done is closed when the writer is stopped.
+	done chan struct{}
+
+	// stopped is closed when the sending goroutine has exited.
+	stopped chan struct{}
+
+	network  string
+	address  string
+	identity []byte
+	version  []byte
+
+	logQueries   bool
+	logResponses bool
+}
+
+// New returns a new properly initialized *Writer and starts sending the
+// messages.  It returns nil if conf is nil or disabled.  version is the version
+// of the server sent within the messages.
+func New(conf *Config, version string) (w *Writer, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	err = conf.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	identity := conf.Identity
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			log.Debug("dnstap: getting hostname: %s", err)
+		}
+	}
+
+	w = &Writer{
+		queue:        make(chan []byte, queueSize),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		network:      conf.Network,
+		address:      conf.Address,
+		identity:     []byte(identity),
+		version:      []byte(version),
+		logQueries:   conf.LogQueries,
+		logResponses: conf.LogResponses,
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Write queues m for sending according to the configuration.  It never blocks.
+// It's safe for concurrent use.
+func (w *Writer) Write(m *Message) {
+	if w.logQueries {
+		data, err := m.Query.Pack()
+		if err != nil {
+			log.Debug("dnstap: packing query: %s", err)
+		} else {
+			w.add(w.encode(m, messageTypeClientQuery, data))
+		}
+	}
+
+	if w.logResponses && m.Response != nil {
+		data, err := m.Response.Pack()
+		if err != nil {
+			log.Debug("dnstap: packing response: %s", err)
+		} else {
+			w.add(w.encode(m, messageTypeClientResponse, data))
+		}
+	}
+}
+
+// add queues frame for sending.  It never blocks.
+func (w *Writer) add(frame []byte) {
+	select {
+	case w.queue <- frame:
+		// Go on.
+	default:
+		log.Debug("dnstap: queue is full, dropping message")
+	}
+}
+
+// closeTimeout is the maximum duration of the graceful closing of the
+// connection to the collector.
+const closeTimeout = 5 * time.Second
+
+// Close stops sending the messages.  It must only be called once.
+func (w *Writer) Close() (err error) {
+	close(w.done)
+
+	select {
+	case <-w.stopped:
+		return nil
+	case <-time.After(closeTimeout):
+		return errors.Error("timeout waiting for the writer to stop")
+	}
+}
+
+// reconnectIvl is the minimum interval between the attempts to connect to the
+// collector.  The messages are dropped in between.
+const reconnectIvl = 10 * time.Second
+
+// run sends the queued frames until the writer is stopped.  It is intended to
+// be used as a goroutine.
+func (w *Writer) run() {
+	defer log.OnPanic("dnstap")
+	defer close(w.stopped)
+
+	var s *frameStream
+	var lastDial time.Time
+	for {
+		select {
+		case frame := <-w.queue:
+			if s == nil {
+				if time.Since(lastDial) < reconnectIvl {
+					continue
+				}
+
+				lastDial = time.Now()
+
+				var err error
+				s, err = w.connect()
+				if err != nil {
+					log.Debug("dnstap: %s", err)
+
+					continue
+				}
+			}
+
+			err := s.writeData(frame, len(w.queue) == 0)
+			if err != nil {
+				log.Debug("dnstap: writing: %s", err)
+
+				// Reconnect on the next message.
+				closeErr := s.conn.Close()
+				if closeErr != nil {
+					log.Debug("dnstap: closing connection: %s", closeErr)
+				}
+
+				s = nil
+			}
+		case <-w.done:
+			if s != nil {
+				err := s.close()
+				if err != nil {
+					log.Debug("dnstap: closing stream: %s", err)
+				}
+			}
+
+			return
+		}
+	}
+}
+
+// dialTimeout is the timeout for connecting to the collector.
+const dialTimeout = 5 * time.Second
+
+// connect connects to the collector and starts a Frame Streams session.
+func (w *Writer) connect() (s *frameStream, err error) {
+	conn, err := net.DialTimeout(w.network, w.address, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting: %w", err)
+	}
+
+	s = newFrameStream(conn)
+	err = s.start()
+	if err != nil {
+		err = fmt.Errorf("starting stream: %w", err)
+
+		return nil, errors.WithDeferred(err, conn.Close())
+	}
+
+	return s, nil
+}
@@ -0,0 +1,246 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	testutil.DiscardLogOutput(m)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &Config{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &Config{
+			Enabled: true,
+			Network: "unix",
+			Address: "/var/run/dnstap.sock",
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf: &Config{
+			Enabled: true,
+			Network: "udp",
+			Address: "127.0.0.1:6000",
+		},
+		name:       "bad_network",
+		wantErrMsg: `network: unsupported value "udp"`,
+	}, {
+		conf: &Config{
+			Enabled: true,
+			Network: "tcp",
+		},
+		name:       "no_address",
+		wantErrMsg: "address: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
+
+// readFrame reads a Frame Streams frame from r.  typ is the type of the
+// control frame, if it is one.
+func readFrame(t *testing.T, r io.Reader) (isControl bool, typ uint32, data []byte) {
+	t.Helper()
+
+	hdr := make([]byte, 4)
+	_, err := io.ReadFull(r, hdr)
+	require.NoError(t, err)
+
+	l := binary.BigEndian.Uint32(hdr)
+	if l == 0 {
+		isControl = true
+		_, err = io.ReadFull(r, hdr)
+		require.NoError(t, err)
+
+		l = binary.BigEndian.Uint32(hdr)
+	}
+
+	data = make([]byte, l)
+	_, err = io.ReadFull(r, data)
+	require.NoError(t, err)
+
+	if isControl {
+		return true, binary.BigEndian.Uint32(data), data[4:]
+	}
+
+	return false, 0, data
+}
+
+// writeControlFrame writes the control frame of type typ without fields to w.
+func writeControlFrame(t *testing.T, w io.Writer, typ uint32) {
+	t.Helper()
+
+	b := binary.BigEndian.AppendUint32(nil, 0)
+	b = binary.BigEndian.AppendUint32(b, 4)
+	b = binary.BigEndian.AppendUint32(b, typ)
+
+	_, err := w.Write(b)
+	require.NoError(t, err)
+}
+
+// decodeFields decodes the top-level fields of the protobuf message b.  The
+// varints and the fixed32 values are returned as uint64s, the length-delimited
+// ones as byte slices.
+func decodeFields(t *testing.T, b []byte) (fields map[uint64]any) {
+	t.Helper()
+
+	fields = map[uint64]any{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Positive(t, n)
+
+		b = b[n:]
+
+		switch field, wire := key>>3, key&7; wire {
+		case wireVarint:
+			v, vn := binary.Uvarint(b)
+			require.Positive(t, vn)
+
+			fields[field], b = v, b[vn:]
+		case wireFixed32:
+			require.GreaterOrEqual(t, len(b), 4)
+
+			fields[field], b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			l, ln := binary.Uvarint(b)
+			require.Positive(t, ln)
+
+			b = b[ln:]
+			require.GreaterOrEqual(t, uint64(len(b)), l)
+
+			fields[field], b = b[:l], b[l:]
+		default:
+			t.Fatalf("unexpected wire type %d", wire)
+		}
+	}
+
+	return fields
+}
+
+func TestWriter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	dataCh := make(chan []byte, 2)
+	go func() {
+		conn, aErr := l.Accept()
+		if aErr != nil {
+			return
+		}
+
+		defer func() { _ = conn.Close() }()
+
+		isControl, typ, _ := readFrame(t, conn)
+		assert.True(t, isControl)
+		assert.Equal(t, controlReady, typ)
+
+		writeControlFrame(t, conn, controlAccept)
+
+		isControl, typ, fields := readFrame(t, conn)
+		assert.True(t, isControl)
+		assert.Equal(t, controlStart, typ)
+		assert.Contains(t, string(fields), contentType)
+
+		for range 2 {
+			_, _, data := readFrame(t, conn)
+			dataCh <- data
+		}
+
+		isControl, typ, _ = readFrame(t, conn)
+		assert.True(t, isControl)
+		assert.Equal(t, controlStop, typ)
+
+		writeControlFrame(t, conn, controlFinish)
+	}()
+
+	w, err := New(&Config{
+		Network:      "tcp",
+		Address:      l.Addr().String(),
+		Identity:     "test",
+		Enabled:      true,
+		LogQueries:   true,
+		LogResponses: true,
+	}, "v0.0.0")
+	require.NoError(t, err)
+
+	req := (&dns.Msg{}).SetQuestion("example.org.", dns.TypeA)
+	resp := (&dns.Msg{}).SetReply(req)
+
+	queryTime := time.Unix(1_700_000_000, 123)
+	w.Write(&Message{
+		QueryTime:    queryTime,
+		ResponseTime: queryTime.Add(time.Millisecond),
+		Query:        req,
+		Response:     resp,
+		ClientAddr:   netip.MustParseAddrPort("192.0.2.1:12345"),
+		ServerAddr:   netip.MustParseAddrPort("192.0.2.2:53"),
+		Protocol:     SocketProtocolUDP,
+	})
+
+	wantQuery, err := req.Pack()
+	require.NoError(t, err)
+
+	wantResp, err := resp.Pack()
+	require.NoError(t, err)
+
+	for _, want := range []struct {
+		typ     messageType
+		msgFld  uint64
+		msgData []byte
+	}{{
+		typ:     messageTypeClientQuery,
+		msgFld:  fieldMsgQueryMessage,
+		msgData: wantQuery,
+	}, {
+		typ:     messageTypeClientResponse,
+		msgFld:  fieldMsgResponseMessage,
+		msgData: wantResp,
+	}} {
+		data, _ := testutil.RequireReceive(t, dataCh, time.Second)
+
+		top := decodeFields(t, data)
+		assert.Equal(t, []byte("test"), top[fieldDnstapIdentity])
+		assert.Equal(t, []byte("v0.0.0"), top[fieldDnstapVersion])
+		assert.Equal(t, uint64(dnstapTypeMessage), top[fieldDnstapType])
+
+		msgData, ok := top[fieldDnstapMessage].([]byte)
+		require.True(t, ok)
+
+		msg := decodeFields(t, msgData)
+		assert.Equal(t, uint64(want.typ), msg[fieldMsgType])
+		assert.Equal(t, uint64(socketFamilyINET), msg[fieldMsgSocketFamily])
+		assert.Equal(t, uint64(SocketProtocolUDP), msg[fieldMsgSocketProtocol])
+		assert.Equal(t, []byte{192, 0, 2, 1}, msg[fieldMsgQueryAddress])
+		assert.Equal(t, uint64(12345), msg[fieldMsgQueryPort])
+		assert.Equal(t, []byte{192, 0, 2, 2}, msg[fieldMsgResponseAddress])
+		assert.Equal(t, uint64(53), msg[fieldMsgResponsePort])
+		assert.Equal(t, uint64(1_700_000_000), msg[fieldMsgQueryTimeSec])
+		assert.Equal(t, uint64(123), msg[fieldMsgQueryTimeNsec])
+		assert.Equal(t, want.msgData, msg[want.msgFld])
+	}
+
+	require.NoError(t, w.Close())
+}
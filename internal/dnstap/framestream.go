@@ -0,0 +1,169 @@
+package dnstap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// contentType is the content type of the dnstap Frame Streams.
+const contentType = "protobuf:dnstap.Dnstap"
+
+// Frame Streams control frame types.
+const (
+	controlAccept uint32 = 0x01
+	controlStart  uint32 = 0x02
+	controlStop   uint32 = 0x03
+	controlReady  uint32 = 0x04
+	controlFinish uint32 = 0x05
+)
+
+// controlFieldContentType is the type of the content type field of a control
+// frame.
+const controlFieldContentType uint32 = 0x01
+
+// maxControlFrameSize is the maximum size of a control frame accepted from the
+// collector.
+const maxControlFrameSize = 512
+
+// ioTimeout is the timeout for the I/O operations with the collector.
+const ioTimeout = 5 * time.Second
+
+// frameStream is a bidirectional Frame Streams session.
+//
+// See https://farsightsec.github.io/fstrm/.
+type frameStream struct {
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+// newFrameStream returns a new *frameStream over conn.
+func newFrameStream(conn net.Conn) (s *frameStream) {
+	return &frameStream{
+		conn: conn,
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+// start performs the handshake: it sends the READY frame, waits for the ACCEPT
+// frame, and sends the START frame.
+func (s *frameStream) start() (err error) {
+	err = s.writeControl(controlReady, true)
+	if err != nil {
+		return fmt.Errorf("writing ready: %w", err)
+	}
+
+	err = s.readControl(controlAccept)
+	if err != nil {
+		return fmt.Errorf("reading accept: %w", err)
+	}
+
+	err = s.writeControl(controlStart, true)
+	if err != nil {
+		return fmt.Errorf("writing start: %w", err)
+	}
+
+	return nil
+}
+
+// writeData writes the data frame.  If flush is true, the buffered frames are
+// sent.
+func (s *frameStream) writeData(data []byte, flush bool) (err error) {
+	err = s.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	if err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+
+	_, err = s.w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	if err == nil {
+		_, err = s.w.Write(data)
+	}
+
+	if err == nil && flush {
+		err = s.w.Flush()
+	}
+
+	return err
+}
+
+// close sends the STOP frame, waits for the FINISH frame, and closes the
+// connection.
+func (s *frameStream) close() (err error) {
+	err = s.writeControl(controlStop, false)
+	if err == nil {
+		err = s.readControl(controlFinish)
+	}
+
+	return errors.WithDeferred(err, s.conn.Close())
+}
+
+// writeControl writes the control frame of type typ and flushes the buffer.  If
+// withContentType is true, the frame contains the content type field.
+func (s *frameStream) writeControl(typ uint32, withContentType bool) (err error) {
+	payload := binary.BigEndian.AppendUint32(nil, typ)
+	if withContentType {
+		payload = binary.BigEndian.AppendUint32(payload, controlFieldContentType)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(contentType)))
+		payload = append(payload, contentType...)
+	}
+
+	// The escape sequence, the length of the control frame, and the frame
+	// itself.
+	b := binary.BigEndian.AppendUint32(nil, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(payload)))
+	b = append(b, payload...)
+
+	err = s.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	if err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+
+	_, err = s.w.Write(b)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return s.w.Flush()
+}
+
+// readControl reads a control frame and returns an error if its type isn't
+// want.  The fields of the frame are ignored.
+func (s *frameStream) readControl(want uint32) (err error) {
+	err = s.conn.SetReadDeadline(time.Now().Add(ioTimeout))
+	if err != nil {
+		return fmt.Errorf("setting deadline: %w", err)
+	}
+
+	hdr := make([]byte, 8)
+	_, err = io.ReadFull(s.conn, hdr)
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	if escape := binary.BigEndian.Uint32(hdr); escape != 0 {
+		return fmt.Errorf("unexpected data frame of length %d", escape)
+	}
+
+	l := binary.BigEndian.Uint32(hdr[4:])
+	if l < 4 || l > maxControlFrameSize {
+		return fmt.Errorf("bad control frame length %d", l)
+	}
+
+	frame := make([]byte, l)
+	_, err = io.ReadFull(s.conn, frame)
+	if err != nil {
+		return fmt.Errorf("reading frame: %w", err)
+	}
+
+	if typ := binary.BigEndian.Uint32(frame); typ != want {
+		return fmt.Errorf("unexpected control frame type %#x, want %#x", typ, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+)
+
+// messageType is the type of a dnstap message.
+type messageType uint64
+
+// Message types, see the Message.Type enumeration in dnstap.proto.
+const (
+	messageTypeClientQuery    messageType = 5
+	messageTypeClientResponse messageType = 6
+)
+
+// Socket families, see the SocketFamily enumeration in dnstap.proto.
+const (
+	socketFamilyINET  = 1
+	socketFamilyINET6 = 2
+)
+
+// dnstapTypeMessage is the type of the Dnstap message containing a Message.
+const dnstapTypeMessage = 1
+
+// Field numbers of the Dnstap protobuf message.
+const (
+	fieldDnstapIdentity = 1
+	fieldDnstapVersion  = 2
+	fieldDnstapMessage  = 14
+	fieldDnstapType     = 15
+)
+
+// Field numbers of the Message protobuf message.
+const (
+	fieldMsgType             = 1
+	fieldMsgSocketFamily     = 2
+	fieldMsgSocketProtocol   = 3
+	fieldMsgQueryAddress     = 4
+	fieldMsgResponseAddress  = 5
+	fieldMsgQueryPort        = 6
+	fieldMsgResponsePort     = 7
+	fieldMsgQueryTimeSec     = 8
+	fieldMsgQueryTimeNsec    = 9
+	fieldMsgQueryMessage     = 10
+	fieldMsgResponseTimeSec  = 12
+	fieldMsgResponseTimeNsec = 13
+	fieldMsgResponseMessage  = 14
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encode returns the protobuf-encoded Dnstap message of type typ for m.  data
+// is the packed query or response, depending on typ.
+func (w *Writer) encode(m *Message, typ messageType, data []byte) (b []byte) {
+	msg := encodeMessage(m, typ, data)
+
+	b = make([]byte, 0, len(w.identity)+len(w.version)+len(msg)+16)
+	if len(w.identity) > 0 {
+		b = appendBytesField(b, fieldDnstapIdentity, w.identity)
+	}
+
+	if len(w.version) > 0 {
+		b = appendBytesField(b, fieldDnstapVersion, w.version)
+	}
+
+	b = appendBytesField(b, fieldDnstapMessage, msg)
+
+	return appendVarintField(b, fieldDnstapType, dnstapTypeMessage)
+}
+
+// encodeMessage returns the protobuf-encoded Message of type typ for m.
+func encodeMessage(m *Message, typ messageType, data []byte) (b []byte) {
+	b = make([]byte, 0, len(data)+64)
+	b = appendVarintField(b, fieldMsgType, uint64(typ))
+
+	client := m.ClientAddr.Addr().Unmap()
+	if client.Is4() {
+		b = appendVarintField(b, fieldMsgSocketFamily, socketFamilyINET)
+	} else if client.Is6() {
+		b = appendVarintField(b, fieldMsgSocketFamily, socketFamilyINET6)
+	}
+
+	if m.Protocol != SocketProtocolUnknown {
+		b = appendVarintField(b, fieldMsgSocketProtocol, uint64(m.Protocol))
+	}
+
+	b = appendAddr(b, fieldMsgQueryAddress, fieldMsgQueryPort, m.ClientAddr)
+	b = appendAddr(b, fieldMsgResponseAddress, fieldMsgResponsePort, m.ServerAddr)
+	b = appendTime(b, fieldMsgQueryTimeSec, fieldMsgQueryTimeNsec, m.QueryTime)
+
+	if typ == messageTypeClientQuery {
+		return appendBytesField(b, fieldMsgQueryMessage, data)
+	}
+
+	b = appendTime(b, fieldMsgResponseTimeSec, fieldMsgResponseTimeNsec, m.ResponseTime)
+
+	return appendBytesField(b, fieldMsgResponseMessage, data)
+}
+
+// appendAddr appends the address and the port fields for addrPort to b, if
+// it's valid.
+func appendAddr(b []byte, addrField, portField uint64, addrPort netip.AddrPort) (res []byte) {
+	if !addrPort.IsValid() {
+		return b
+	}
+
+	b = appendBytesField(b, addrField, addrPort.Addr().Unmap().AsSlice())
+
+	return appendVarintField(b, portField, uint64(addrPort.Port()))
+}
+
+// appendTime appends the seconds and the nanoseconds fields for t to b, if it's
+// not zero.
+func appendTime(b []byte, secField, nsecField uint64, t time.Time) (res []byte) {
+	if t.IsZero() {
+		return b
+	}
+
+	b = appendVarintField(b, secField, uint64(t.Unix()))
+	b = appendTag(b, nsecField, wireFixed32)
+
+	return binary.LittleEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendTag appends the key of the field with the number field and the wire
+// type wire to b.
+func appendTag(b []byte, field, wire uint64) (res []byte) {
+	return binary.AppendUvarint(b, field<<3|wire)
+}
+
+// appendVarintField appends the varint field to b.
+func appendVarintField(b []byte, field, v uint64) (res []byte) {
+	b = appendTag(b, field, wireVarint)
+
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField appends the length-delimited field to b.
+func appendBytesField(b []byte, field uint64, v []byte) (res []byte) {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+
+	return append(b, v...)
+}
@@ -27,13 +27,18 @@ const filterDir = "filters"
 // TODO(e.burkov):  Investigate if the field ordering is important.
 type FilterYAML struct {
 	Enabled     bool
-	URL         string    // URL or a file path
-	Name        string    `yaml:"name"`
-	RulesCount  int       `yaml:"-"`
-	LastUpdated time.Time `yaml:"-"`
-	checksum    uint32    // checksum of the file data
+	URL         string         // URL or a file path
+	Name        string         `yaml:"name"`
+	Category    ThreatCategory `yaml:"category,omitempty"`
+	RulesCount  int            `yaml:"-"`
+	LastUpdated time.Time      `yaml:"-"`
+	checksum    uint32         // checksum of the file data
 	white       bool
 
+	// expires is the update period from the "! Expires:" header of the list,
+	// if any.
+	expires time.Duration
+
 	Filter `yaml:",inline"`
 }
 
@@ -183,6 +188,12 @@ func (d *DNSFilter) filterExistsLocked(url string) (ok bool) {
 		}
 	}
 
+	for _, f := range d.conf.ThreatFeeds {
+		if f.URL == url {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -200,9 +211,12 @@ func (d *DNSFilter) filterAdd(flt FilterYAML) (err error) {
 		return errFilterExists
 	}
 
-	if flt.white {
+	switch {
+	case flt.white:
 		d.conf.WhitelistFilters = append(d.conf.WhitelistFilters, flt)
-	} else {
+	case flt.Category != "":
+		d.conf.ThreatFeeds = append(d.conf.ThreatFeeds, flt)
+	default:
 		d.conf.Filters = append(d.conf.Filters, flt)
 	}
 
@@ -279,7 +293,7 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 		}
 
 		if !force {
-			exp := flt.LastUpdated.Add(time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour)
+			exp := flt.LastUpdated.Add(d.updateIvl(flt))
 			if now.Before(exp) {
 				continue
 			}
@@ -292,12 +306,27 @@ func (d *DNSFilter) listsToUpdate(filters *[]FilterYAML, force bool) (toUpd []Fi
 			URL:      flt.URL,
 			Name:     flt.Name,
 			checksum: flt.checksum,
+			expires:  flt.expires,
 		})
 	}
 
 	return toUpd
 }
 
+// minListExpires is the minimum update period of a filtering-rule list set by
+// its "! Expires:" header.
+const minListExpires = 1 * time.Hour
+
+// updateIvl returns the update period of flt.  The period from the
+// "! Expires:" header of the list takes precedence over the global one.
+func (d *DNSFilter) updateIvl(flt *FilterYAML) (ivl time.Duration) {
+	if flt.expires > 0 {
+		return max(flt.expires, minListExpires)
+	}
+
+	return time.Duration(d.conf.FiltersUpdateIntervalHours) * time.Hour
+}
+
 func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int, []FilterYAML, []bool, bool) {
 	var updateFlags []bool // 'true' if filter data has changed
 
@@ -314,6 +343,9 @@ func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int,
 		if err != nil {
 			failNum++
 			log.Error("filtering: updating filter from url %q: %s\n", uf.URL, err)
+			if d.conf.FilterUpdateFailed != nil {
+				d.conf.FilterUpdateFailed(uf, err)
+			}
 
 			continue
 		}
@@ -339,6 +371,7 @@ func (d *DNSFilter) refreshFiltersArray(filters *[]FilterYAML, force bool) (int,
 			}
 
 			f.LastUpdated = uf.LastUpdated
+			f.expires = uf.expires
 			if !updated {
 				continue
 			}
@@ -389,6 +422,13 @@ func (d *DNSFilter) refreshFiltersIntl(block, allow, force bool) (int, bool) {
 
 	if block {
 		updNum, lists, toUpd, isNetErr = d.refreshFiltersArray(&d.conf.Filters, force)
+
+		updNumTh, listsTh, toUpdTh, isNetErrTh := d.refreshFiltersArray(&d.conf.ThreatFeeds, force)
+
+		updNum += updNumTh
+		lists = append(lists, listsTh...)
+		toUpd = append(toUpd, toUpdTh...)
+		isNetErr = isNetErr || isNetErrTh
 	}
 	if allow {
 		updNumAl, listsAl, toUpdAl, isNetErrAl := d.refreshFiltersArray(&d.conf.WhitelistFilters, force)
@@ -506,6 +546,7 @@ func (d *DNSFilter) finalizeUpdate(
 	flt.ensureName(res.Title)
 	flt.checksum = res.Checksum
 	flt.RulesCount = rulesCount
+	flt.expires = res.Expires
 
 	return nil
 }
@@ -579,6 +620,7 @@ func (d *DNSFilter) load(flt *FilterYAML) (err error) {
 
 	flt.ensureName(res.Title)
 	flt.RulesCount, flt.checksum, flt.LastUpdated = res.RulesCount, res.Checksum, st.ModTime()
+	flt.expires = res.Expires
 
 	return nil
 }
@@ -590,12 +632,58 @@ func (d *DNSFilter) EnableFilters(async bool) {
 	d.enableFiltersLocked(async)
 }
 
+// EnableFiltersLazily is like [DNSFilter.EnableFilters], but only the user
+// rules are applied at once, while the filter lists are compiled in the
+// background and swapped in when ready, see [Config.LazyLoading].  onReady, if
+// not nil, is called once they are or once compiling them fails, in which case
+// err is not nil and only the user rules are applied.  d must be started, see
+// [DNSFilter.Start].
+func (d *DNSFilter) EnableFiltersLazily(onReady func(err error)) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	err := d.initFiltering(nil, []Filter{d.userRulesFilter()}, nil)
+	if err != nil {
+		log.Error("filtering: enabling user rules: %s", err)
+	}
+
+	blockFilters, allowFilters := d.enabledFilters()
+	d.queueFilters(filtersInitializerParams{
+		allowFilters:  allowFilters,
+		blockFilters:  blockFilters,
+		threatFilters: d.threatFeedsFilters(),
+		onReady:       onReady,
+	})
+
+	d.SetEnabled(d.conf.FilteringEnabled)
+
+	log.Info("filtering: compiling filter lists in the background")
+}
+
 func (d *DNSFilter) enableFiltersLocked(async bool) {
-	filters := make([]Filter, 1, len(d.conf.Filters)+len(d.conf.WhitelistFilters)+1)
-	filters[0] = Filter{
+	blockFilters, allowFilters := d.enabledFilters()
+
+	err := d.setFilters(blockFilters, allowFilters, d.threatFeedsFilters(), async)
+	if err != nil {
+		log.Error("filtering: enabling filters: %s", err)
+	}
+
+	d.SetEnabled(d.conf.FilteringEnabled)
+}
+
+// userRulesFilter returns the filter with the active user rules.
+func (d *DNSFilter) userRulesFilter() (f Filter) {
+	return Filter{
 		ID:   rulelist.URLFilterIDCustom,
-		Data: []byte(strings.Join(d.conf.UserRules, "\n")),
+		Data: []byte(strings.Join(activeUserRules(d.conf.UserRules, time.Now()), "\n")),
 	}
+}
+
+// enabledFilters returns the enabled blocklists, including the user rules, and
+// the enabled allowlists.  d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) enabledFilters() (filters, allowFilters []Filter) {
+	filters = make([]Filter, 1, len(d.conf.Filters)+1)
+	filters[0] = d.userRulesFilter()
 
 	for _, filter := range d.conf.Filters {
 		if !filter.Enabled {
@@ -608,7 +696,6 @@ func (d *DNSFilter) enableFiltersLocked(async bool) {
 		})
 	}
 
-	var allowFilters []Filter
 	for _, filter := range d.conf.WhitelistFilters {
 		if !filter.Enabled {
 			continue
@@ -620,10 +707,5 @@ func (d *DNSFilter) enableFiltersLocked(async bool) {
 		})
 	}
 
-	err := d.setFilters(filters, allowFilters, async)
-	if err != nil {
-		log.Error("filtering: enabling filters: %s", err)
-	}
-
-	d.SetEnabled(d.conf.FilteringEnabled)
+	return filters, allowFilters
 }
@@ -38,6 +38,16 @@ type ServiceEntry struct {
 	Rules []*rules.NetworkRule
 }
 
+// SettingsLevel is the level of the settings which has produced a filtering
+// decision.
+type SettingsLevel string
+
+// Supported settings levels.
+const (
+	SettingsLevelGlobal SettingsLevel = "global"
+	SettingsLevelClient SettingsLevel = "client"
+)
+
 // Settings are custom filtering settings for a client.
 type Settings struct {
 	ClientName string
@@ -51,9 +61,24 @@ type Settings struct {
 	SafeSearchEnabled   bool
 	SafeBrowsingEnabled bool
 	ParentalEnabled     bool
+	NewDomainsEnabled   bool
 
 	// ClientSafeSearch is a client configured safe search.
 	ClientSafeSearch SafeSearch
+
+	// ThreatCategories are the threat-feed categories enabled for the client.
+	ThreatCategories []ThreatCategory
+
+	// QueryQuotas are the query quotas of the client.
+	QueryQuotas []*QueryQuota
+
+	// SafeBrowsingLevel is the level of the settings SafeBrowsingEnabled is
+	// taken from.
+	SafeBrowsingLevel SettingsLevel
+
+	// ParentalLevel is the level of the settings ParentalEnabled is taken
+	// from.
+	ParentalLevel SettingsLevel
 }
 
 // Resolver is the interface for net.Resolver to simplify testing.
@@ -75,6 +100,11 @@ type Config struct {
 	// ParentControl is the parental control hash-prefix checker.
 	ParentalControlChecker Checker `yaml:"-"`
 
+	// NewDomainSource is the registration data source for the newly-registered
+	// domains blocking.  If it's nil, the source is created from
+	// NewDomainsConf.
+	NewDomainSource DomainAgeSource `yaml:"-"`
+
 	SafeSearch SafeSearch `yaml:"-"`
 
 	// BlockedServices is the configuration of blocked services.
@@ -96,6 +126,10 @@ type Config struct {
 	// HTTPClient is the client to use for updating the remote filters.
 	HTTPClient *http.Client `yaml:"-"`
 
+	// FilterUpdateFailed, if not nil, is called when a remote filter list
+	// fails to update.
+	FilterUpdateFailed func(flt *FilterYAML, err error) `yaml:"-"`
+
 	// filtersMu protects filter lists.
 	filtersMu *sync.RWMutex
 
@@ -105,6 +139,10 @@ type Config struct {
 
 	SafeSearchConf SafeSearchConfig `yaml:"safe_search"`
 
+	// NewDomainsConf is the configuration of the newly-registered domains
+	// blocking.
+	NewDomainsConf NewDomainsConfig `yaml:"new_domains"`
+
 	// DataDir is used to store filters' contents.
 	DataDir string `yaml:"-"`
 
@@ -130,6 +168,13 @@ type Config struct {
 	// UserRules is the global list of custom rules.
 	UserRules []string `yaml:"-"`
 
+	// ThreatFeeds are the categorized threat-feed filter lists.
+	ThreatFeeds []FilterYAML `yaml:"threat_feeds"`
+
+	// ThreatCategories are the threat-feed categories enabled globally.
+	// Per-client settings can override this configuration.
+	ThreatCategories []ThreatCategory `yaml:"threat_categories"`
+
 	SafeBrowsingCacheSize uint `yaml:"safebrowsing_cache_size"` // (in bytes)
 	SafeSearchCacheSize   uint `yaml:"safesearch_cache_size"`   // (in bytes)
 	ParentalCacheSize     uint `yaml:"parental_cache_size"`     // (in bytes)
@@ -154,6 +199,17 @@ type Config struct {
 	// FilteringEnabled indicates whether or not use filter lists.
 	FilteringEnabled bool `yaml:"filtering_enabled"`
 
+	// MmapFilters defines whether the filter list files are mapped into memory
+	// instead of being read on each rule lookup.  The mapped pages are loaded on
+	// demand and may be evicted under memory pressure, which reduces the
+	// resident memory on low-RAM devices.  It's ignored on Windows.
+	MmapFilters bool `yaml:"mmap_filters"`
+
+	// LazyLoading defines whether the DNS server starts serving the requests
+	// before the filter lists are compiled.  Until they are, only the user
+	// rules and the other checks are applied.
+	LazyLoading bool `yaml:"lazy_loading"`
+
 	ParentalEnabled     bool `yaml:"parental_enabled"`
 	SafeBrowsingEnabled bool `yaml:"safebrowsing_enabled"`
 
@@ -202,8 +258,13 @@ type Stats struct {
 
 // Parameters to pass to filters-initializer goroutine
 type filtersInitializerParams struct {
-	allowFilters []Filter
-	blockFilters []Filter
+	allowFilters  []Filter
+	blockFilters  []Filter
+	threatFilters map[ThreatCategory][]Filter
+
+	// onReady, if not nil, is called once the filters are initialized with
+	// the error of the initialization, if any.
+	onReady func(err error)
 }
 
 type hostChecker struct {
@@ -231,6 +292,10 @@ type DNSFilter struct {
 	rulesStorageAllow    *filterlist.RuleStorage
 	filteringEngineAllow *urlfilter.DNSEngine
 
+	// threatEngines are the filtering engines of the threat feeds by their
+	// category.
+	threatEngines map[ThreatCategory]*threatEngine
+
 	safeSearch SafeSearch
 
 	// safeBrowsingChecker is the safe browsing hash-prefix checker.
@@ -239,6 +304,10 @@ type DNSFilter struct {
 	// parentalControl is the parental control hash-prefix checker.
 	parentalControlChecker Checker
 
+	// newDomainSource is the registration data source for the newly-registered
+	// domains blocking.
+	newDomainSource DomainAgeSource
+
 	engineLock sync.RWMutex
 
 	// confMu protects conf.
@@ -315,6 +384,19 @@ const (
 	//
 	// See https://github.com/AdguardTeam/AdGuardHome/issues/2499.
 	RewrittenRule
+
+	// FilteredThreatFeed is returned when the host is blocked by a threat feed
+	// of one of the enabled categories.
+	FilteredThreatFeed
+
+	// FilteredNewDomain is returned when the host belongs to a
+	// newly-registered domain and the blocking action is set.
+	FilteredNewDomain
+
+	// NotFilteredNewDomain is returned when the host belongs to a
+	// newly-registered domain and the flagging action is set.  The request
+	// isn't blocked.
+	NotFilteredNewDomain
 )
 
 // TODO(a.garipov): Resync with actual code names or replace completely
@@ -334,6 +416,11 @@ var reasonNames = []string{
 	Rewritten:          "Rewrite",
 	RewrittenAutoHosts: "RewriteEtcHosts",
 	RewrittenRule:      "RewriteRule",
+
+	FilteredThreatFeed: "FilteredThreatFeed",
+
+	FilteredNewDomain:    "FilteredNewDomain",
+	NotFilteredNewDomain: "NotFilteredNewDomain",
 }
 
 func (r Reason) String() string {
@@ -362,6 +449,10 @@ func (d *DNSFilter) Settings() (s *Settings) {
 		SafeSearchEnabled:   d.conf.SafeSearchConf.Enabled,
 		SafeBrowsingEnabled: d.conf.SafeBrowsingEnabled,
 		ParentalEnabled:     d.conf.ParentalEnabled,
+		NewDomainsEnabled:   d.conf.NewDomainsConf.Enabled,
+		ThreatCategories:    slices.Clone(d.conf.ThreatCategories),
+		SafeBrowsingLevel:   SettingsLevelGlobal,
+		ParentalLevel:       SettingsLevelGlobal,
 	}
 }
 
@@ -373,6 +464,8 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 
 		*c = *d.conf
 		c.Rewrites = cloneRewrites(c.Rewrites)
+		c.ThreatCategories = slices.Clone(c.ThreatCategories)
+		c.NewDomainsConf.Allowlist = slices.Clone(c.NewDomainsConf.Allowlist)
 	}()
 
 	d.conf.filtersMu.RLock()
@@ -381,6 +474,7 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 	c.Filters = slices.Clone(d.conf.Filters)
 	c.WhitelistFilters = slices.Clone(d.conf.WhitelistFilters)
 	c.UserRules = slices.Clone(d.conf.UserRules)
+	c.ThreatFeeds = slices.Clone(d.conf.ThreatFeeds)
 }
 
 // setFilters sets new filters, synchronously or asynchronously.  When filters
@@ -388,33 +482,45 @@ func (d *DNSFilter) WriteDiskConfig(c *Config) {
 // filters are ready.
 //
 // In this case the caller must ensure that the old filter files are intact.
-func (d *DNSFilter) setFilters(blockFilters, allowFilters []Filter, async bool) error {
+func (d *DNSFilter) setFilters(
+	blockFilters []Filter,
+	allowFilters []Filter,
+	threatFilters map[ThreatCategory][]Filter,
+	async bool,
+) error {
 	if async {
-		params := filtersInitializerParams{
-			allowFilters: allowFilters,
-			blockFilters: blockFilters,
-		}
+		d.queueFilters(filtersInitializerParams{
+			allowFilters:  allowFilters,
+			blockFilters:  blockFilters,
+			threatFilters: threatFilters,
+		})
 
-		d.filtersInitializerLock.Lock()
-		defer d.filtersInitializerLock.Unlock()
-
-		// Remove all pending tasks.
-	removeLoop:
-		for {
-			select {
-			case <-d.filtersInitializerChan:
-				// Continue removing.
-			default:
-				break removeLoop
-			}
-		}
+		return nil
+	}
+
+	return d.initFiltering(allowFilters, blockFilters, threatFilters)
+}
 
-		d.filtersInitializerChan <- params
+// queueFilters replaces the pending filters initialization task, if any, with
+// params.  The callback of the replaced task is kept if params has none.
+func (d *DNSFilter) queueFilters(params filtersInitializerParams) {
+	d.filtersInitializerLock.Lock()
+	defer d.filtersInitializerLock.Unlock()
 
-		return nil
+	// Remove all pending tasks.
+removeLoop:
+	for {
+		select {
+		case pending := <-d.filtersInitializerChan:
+			if params.onReady == nil {
+				params.onReady = pending.onReady
+			}
+		default:
+			break removeLoop
+		}
 	}
 
-	return d.initFiltering(allowFilters, blockFilters)
+	d.filtersInitializerChan <- params
 }
 
 // Close - close the object
@@ -441,6 +547,8 @@ func (d *DNSFilter) reset() {
 			log.Error("filtering: rulesStorageAllow.Close: %s", err)
 		}
 	}
+
+	closeThreatEngines(d.threatEngines)
 }
 
 // ProtectionStatus returns the status of protection and time until it's
@@ -548,6 +656,15 @@ type Result struct {
 	// Reason is set to FilteredBlockedService.
 	ServiceName string `json:",omitempty"`
 
+	// ThreatCategory is the category of the threat feed that blocked the
+	// request.  It is empty unless Reason is set to FilteredThreatFeed.
+	ThreatCategory ThreatCategory `json:",omitempty"`
+
+	// SettingsLevel is the level of the settings which has enabled the check
+	// that filtered the request.  It is empty unless Reason is set to
+	// FilteredSafeBrowsing or FilteredParental.
+	SettingsLevel SettingsLevel `json:",omitempty"`
+
 	// IPList is the lookup rewrite result.  It is empty unless Reason is set to
 	// Rewritten.
 	IPList []netip.Addr `json:",omitempty"`
@@ -718,7 +835,10 @@ func matchBlockedServicesRules(
 // Adding rule and matching against the rules
 //
 
-func newRuleStorage(filters []Filter) (rs *filterlist.RuleStorage, err error) {
+// newRuleStorage returns a new rule storage with the rules from filters.  If
+// mmap is true, the filter list files are mapped into memory, see
+// [Config.MmapFilters].
+func newRuleStorage(filters []Filter, mmap bool) (rs *filterlist.RuleStorage, err error) {
 	lists := make([]filterlist.RuleList, 0, len(filters))
 	for _, f := range filters {
 		switch id := int(f.ID); {
@@ -746,6 +866,16 @@ func newRuleStorage(filters []Filter) (rs *filterlist.RuleStorage, err error) {
 				RulesText:      string(data),
 				IgnoreCosmetic: true,
 			})
+		case mmap:
+			var list *mappedRuleList
+			list, err = newMappedRuleList(id, f.FilePath)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("mapping rule list %q: %w", f.FilePath, err)
+			}
+
+			lists = append(lists, list)
 		default:
 			var list *filterlist.FileRuleList
 			list, err = filterlist.NewFileRuleList(id, f.FilePath, true)
@@ -768,13 +898,24 @@ func newRuleStorage(filters []Filter) (rs *filterlist.RuleStorage, err error) {
 }
 
 // Initialize urlfilter objects.
-func (d *DNSFilter) initFiltering(allowFilters, blockFilters []Filter) (err error) {
-	rulesStorage, err := newRuleStorage(blockFilters)
+func (d *DNSFilter) initFiltering(
+	allowFilters []Filter,
+	blockFilters []Filter,
+	threatFilters map[ThreatCategory][]Filter,
+) (err error) {
+	mmap := d.conf.MmapFilters
+
+	rulesStorage, err := newRuleStorage(blockFilters, mmap)
+	if err != nil {
+		return err
+	}
+
+	rulesStorageAllow, err := newRuleStorage(allowFilters, mmap)
 	if err != nil {
 		return err
 	}
 
-	rulesStorageAllow, err := newRuleStorage(allowFilters)
+	threatEngines, err := newThreatEngines(threatFilters, mmap)
 	if err != nil {
 		return err
 	}
@@ -791,6 +932,7 @@ func (d *DNSFilter) initFiltering(allowFilters, blockFilters []Filter) (err erro
 		d.filteringEngine = filteringEngine
 		d.rulesStorageAllow = rulesStorageAllow
 		d.filteringEngineAllow = filteringEngineAllow
+		d.threatEngines = threatEngines
 	}()
 
 	// Make sure that the OS reclaims memory as soon as possible.
@@ -972,7 +1114,7 @@ func makeResult(matchedRules []rules.Rule, reason Reason) (res Result) {
 	return Result{
 		Rules:      resRules,
 		Reason:     reason,
-		IsFiltered: reason == FilteredBlockList,
+		IsFiltered: reason.In(FilteredBlockList, FilteredThreatFeed),
 	}
 }
 
@@ -990,6 +1132,7 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		refreshLock:            &sync.Mutex{},
 		safeBrowsingChecker:    c.SafeBrowsingChecker,
 		parentalControlChecker: c.ParentalControlChecker,
+		newDomainSource:        c.NewDomainSource,
 		confMu:                 &sync.RWMutex{},
 	}
 
@@ -1004,6 +1147,9 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 	}, {
 		check: matchBlockedServicesRules,
 		name:  "blocked services",
+	}, {
+		check: d.checkThreatFeeds,
+		name:  "threat feeds",
 	}, {
 		check: d.checkSafeBrowsing,
 		name:  "safe browsing",
@@ -1013,6 +1159,9 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 	}, {
 		check: d.checkSafeSearch,
 		name:  "safe search",
+	}, {
+		check: d.checkNewDomain,
+		name:  "new domains",
 	}}
 
 	defer func() { err = errors.Annotate(err, "filtering: %w") }()
@@ -1032,8 +1181,23 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 		}
 	}
 
+	err = d.validateThreatFeeds()
+	if err != nil {
+		return nil, fmt.Errorf("threat feeds: %w", err)
+	}
+
+	err = d.initNewDomains()
+	if err != nil {
+		return nil, fmt.Errorf("new domains: %w", err)
+	}
+
+	d.conf.UserRules, err = resolveUserRulesExpiry(d.conf.UserRules, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("user rules: %w", err)
+	}
+
 	if blockFilters != nil {
-		err = d.initFiltering(nil, blockFilters)
+		err = d.initFiltering(nil, blockFilters, nil)
 		if err != nil {
 			d.Close()
 
@@ -1045,12 +1209,15 @@ func New(c *Config, blockFilters []Filter) (d *DNSFilter, err error) {
 
 	d.loadFilters(d.conf.Filters)
 	d.loadFilters(d.conf.WhitelistFilters)
+	d.loadFilters(d.conf.ThreatFeeds)
 
 	d.conf.Filters = deduplicateFilters(d.conf.Filters)
 	d.conf.WhitelistFilters = deduplicateFilters(d.conf.WhitelistFilters)
+	d.conf.ThreatFeeds = deduplicateFilters(d.conf.ThreatFeeds)
 
 	d.idGen.fix(d.conf.Filters)
 	d.idGen.fix(d.conf.WhitelistFilters)
+	d.idGen.fix(d.conf.ThreatFeeds)
 
 	return d, nil
 }
@@ -1072,18 +1239,25 @@ func (d *DNSFilter) updatesLoop() {
 	ivl := time.Second * 5
 	t := time.NewTimer(ivl)
 
+	expT := time.NewTicker(userRulesExpiryIvl)
+	defer expT.Stop()
+
 	for {
 		select {
 		case params := <-d.filtersInitializerChan:
-			err := d.initFiltering(params.allowFilters, params.blockFilters)
+			err := d.initFiltering(params.allowFilters, params.blockFilters, params.threatFilters)
 			if err != nil {
 				log.Error("filtering: initializing: %s", err)
+			}
 
-				continue
+			if params.onReady != nil {
+				params.onReady(err)
 			}
 		case <-t.C:
 			ivl = d.periodicallyRefreshFilters(ivl)
 			t.Reset(ivl)
+		case <-expT.C:
+			d.removeExpiredUserRules()
 		case <-d.done:
 			t.Stop()
 
@@ -1136,8 +1310,9 @@ func (d *DNSFilter) checkSafeBrowsing(
 			Text:         "adguard-malware-shavar",
 			FilterListID: rulelist.URLFilterIDSafeBrowsing,
 		}},
-		Reason:     FilteredSafeBrowsing,
-		IsFiltered: true,
+		Reason:        FilteredSafeBrowsing,
+		IsFiltered:    true,
+		SettingsLevel: setts.SafeBrowsingLevel,
 	}
 
 	block, err := d.safeBrowsingChecker.Check(host)
@@ -1168,8 +1343,9 @@ func (d *DNSFilter) checkParental(
 			Text:         "parental CATEGORY_BLACKLISTED",
 			FilterListID: rulelist.URLFilterIDParentalControl,
 		}},
-		Reason:     FilteredParental,
-		IsFiltered: true,
+		Reason:        FilteredParental,
+		IsFiltered:    true,
+		SettingsLevel: setts.ParentalLevel,
 	}
 
 	block, err := d.parentalControlChecker.Check(host)
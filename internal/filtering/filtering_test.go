@@ -2,9 +2,11 @@ package filtering
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtest"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
@@ -548,7 +550,7 @@ func TestWhitelist(t *testing.T) {
 	}}
 	d, setts := newForTest(t, nil, filters)
 
-	err := d.setFilters(filters, whiteFilters, false)
+	err := d.setFilters(filters, whiteFilters, nil, false)
 	require.NoError(t, err)
 
 	t.Cleanup(d.Close)
@@ -576,6 +578,156 @@ func TestWhitelist(t *testing.T) {
 	assert.Equal(t, "||host2^", res.Rules[0].Text)
 }
 
+func TestThreatFeeds(t *testing.T) {
+	threatFilters := map[ThreatCategory][]Filter{
+		ThreatCategoryPhishing: {{
+			ID: 1, Data: []byte("||phishing.example^\n"),
+		}},
+		ThreatCategoryMalware: {{
+			ID: 2, Data: []byte("||malware.example^\n@@||allowed.malware.example^\n"),
+		}},
+	}
+
+	d, setts := newForTest(t, nil, nil)
+
+	err := d.setFilters(nil, nil, threatFilters, false)
+	require.NoError(t, err)
+
+	t.Cleanup(d.Close)
+
+	testCases := []struct {
+		name         string
+		host         string
+		categories   []ThreatCategory
+		wantCategory ThreatCategory
+		wantFiltered bool
+	}{{
+		name:         "phishing",
+		host:         "phishing.example",
+		categories:   []ThreatCategory{ThreatCategoryPhishing},
+		wantCategory: ThreatCategoryPhishing,
+		wantFiltered: true,
+	}, {
+		name:         "category_disabled",
+		host:         "phishing.example",
+		categories:   []ThreatCategory{ThreatCategoryMalware},
+		wantCategory: "",
+		wantFiltered: false,
+	}, {
+		name:         "no_categories",
+		host:         "malware.example",
+		categories:   nil,
+		wantCategory: "",
+		wantFiltered: false,
+	}, {
+		name:         "malware",
+		host:         "malware.example",
+		categories:   []ThreatCategory{ThreatCategoryPhishing, ThreatCategoryMalware},
+		wantCategory: ThreatCategoryMalware,
+		wantFiltered: true,
+	}, {
+		name:         "allowlisted",
+		host:         "allowed.malware.example",
+		categories:   []ThreatCategory{ThreatCategoryMalware},
+		wantCategory: "",
+		wantFiltered: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := *setts
+			s.ThreatCategories = tc.categories
+
+			res, cerr := d.CheckHost(tc.host, dns.TypeA, &s)
+			require.NoError(t, cerr)
+
+			assert.Equal(t, tc.wantFiltered, res.IsFiltered)
+			assert.Equal(t, tc.wantCategory, res.ThreatCategory)
+			if tc.wantFiltered {
+				assert.Equal(t, FilteredThreatFeed, res.Reason)
+			}
+		})
+	}
+}
+
+// testDomainAgeSource is a [DomainAgeSource] for tests.
+type testDomainAgeSource map[string]time.Time
+
+// RegisteredAt implements the [DomainAgeSource] interface for
+// testDomainAgeSource.
+func (s testDomainAgeSource) RegisteredAt(
+	_ context.Context,
+	domain string,
+) (t time.Time, ok bool, err error) {
+	t, ok = s[domain]
+
+	return t, ok, nil
+}
+
+func TestNewDomains(t *testing.T) {
+	src := testDomainAgeSource{
+		"new.example":     time.Now().Add(-24 * time.Hour),
+		"old.example":     time.Now().Add(-365 * 24 * time.Hour),
+		"allowed.example": time.Now(),
+	}
+
+	testCases := []struct {
+		name       string
+		host       string
+		action     NewDomainAction
+		wantReason Reason
+	}{{
+		name:       "block",
+		host:       "www.new.example",
+		action:     NewDomainActionBlock,
+		wantReason: FilteredNewDomain,
+	}, {
+		name:       "flag",
+		host:       "new.example",
+		action:     NewDomainActionFlag,
+		wantReason: NotFilteredNewDomain,
+	}, {
+		name:       "old",
+		host:       "old.example",
+		action:     NewDomainActionBlock,
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "unknown",
+		host:       "unknown.example",
+		action:     NewDomainActionBlock,
+		wantReason: NotFilteredNotFound,
+	}, {
+		name:       "allowlisted",
+		host:       "sub.allowed.example",
+		action:     NewDomainActionBlock,
+		wantReason: NotFilteredNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, setts := newForTest(t, &Config{
+				NewDomainSource: src,
+				NewDomainsConf: NewDomainsConfig{
+					Action:     tc.action,
+					Source:     NewDomainSourceRDAP,
+					Allowlist:  []string{"allowed.example"},
+					MaxAgeDays: 30,
+					Enabled:    true,
+				},
+			}, nil)
+			t.Cleanup(d.Close)
+
+			setts.NewDomainsEnabled = true
+
+			res, err := d.CheckHost(tc.host, dns.TypeA, setts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantReason, res.Reason)
+			assert.Equal(t, tc.wantReason == FilteredNewDomain, res.IsFiltered)
+		})
+	}
+}
+
 // Client Settings.
 
 func applyClientSettings(setts *Settings) {
@@ -269,7 +269,14 @@ func (d *DNSFilter) handleFilteringSetRules(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	d.conf.UserRules = req.Rules
+	userRules, err := resolveUserRulesExpiry(req.Rules, time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "rules: %s", err)
+
+		return
+	}
+
+	d.conf.UserRules = userRules
 	d.conf.ConfigModified()
 	d.EnableFilters(true)
 }
@@ -579,6 +586,14 @@ func (d *DNSFilter) RegisterFilteringHandlers() {
 	registerHTTP(http.MethodPost, "/control/filtering/refresh", d.handleFilteringRefresh)
 	registerHTTP(http.MethodPost, "/control/filtering/set_rules", d.handleFilteringSetRules)
 	registerHTTP(http.MethodGet, "/control/filtering/check_host", d.handleCheckHost)
+
+	registerHTTP(http.MethodGet, "/control/threat_feeds/status", d.handleThreatFeedsStatus)
+	registerHTTP(http.MethodPut, "/control/threat_feeds/config", d.handleThreatFeedsConfig)
+	registerHTTP(http.MethodPost, "/control/threat_feeds/add_url", d.handleThreatFeedsAddURL)
+	registerHTTP(http.MethodPost, "/control/threat_feeds/remove_url", d.handleThreatFeedsRemoveURL)
+
+	registerHTTP(http.MethodGet, "/control/new_domains/status", d.handleNewDomainsStatus)
+	registerHTTP(http.MethodPut, "/control/new_domains/config", d.handleNewDomainsConfig)
 }
 
 // ValidateUpdateIvl returns false if i is not a valid filters update interval.
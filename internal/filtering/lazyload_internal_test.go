@@ -0,0 +1,65 @@
+package filtering
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSFilter_EnableFiltersLazily(t *testing.T) {
+	flt := FilterYAML{
+		Enabled: true,
+		URL:     "https://filters.example/list.txt",
+		Filter:  Filter{ID: 1},
+	}
+
+	c := &Config{
+		DataDir:          t.TempDir(),
+		FilteringEnabled: true,
+		UserRules:        []string{"||user.example^"},
+		Filters:          []FilterYAML{flt},
+	}
+
+	path := flt.Path(c.DataDir)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("||list.example^\n"), 0o644))
+
+	d, setts := newForTest(t, c, nil)
+	t.Cleanup(d.Close)
+
+	d.filtersInitializerChan = make(chan filtersInitializerParams, 1)
+
+	ready := false
+	d.EnableFiltersLazily(func(err error) { ready = err == nil })
+
+	res, err := d.CheckHost("user.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+
+	res, err = d.CheckHost("list.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.False(t, res.IsFiltered)
+
+	// Replacing the pending task must keep its callback.
+	d.EnableFilters(true)
+
+	params := <-d.filtersInitializerChan
+	require.NotNil(t, params.onReady)
+
+	err = d.initFiltering(params.allowFilters, params.blockFilters, params.threatFilters)
+	require.NoError(t, err)
+
+	params.onReady(err)
+	assert.True(t, ready)
+
+	res, err = d.CheckHost("list.example", dns.TypeA, setts)
+	require.NoError(t, err)
+
+	assert.True(t, res.IsFiltered)
+}
@@ -0,0 +1,86 @@
+package filtering
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// mappedRuleList is a [filterlist.RuleList] reading the rules from the filter
+// list file mapped into memory.  Unlike [filterlist.StringRuleList], the rule
+// texts aren't kept in the heap, and unlike [filterlist.FileRuleList], the rules
+// are retrieved without system calls and locking.
+type mappedRuleList struct {
+	// unmap releases data.
+	unmap func() (err error)
+
+	// data is the contents of the file.  It must not be used after unmap is
+	// called.
+	data []byte
+
+	// id is the identifier of the rule list.
+	id int
+}
+
+// type check
+var _ filterlist.RuleList = (*mappedRuleList)(nil)
+
+// newMappedRuleList returns a new rule list with the rules from the file at
+// path mapped into memory.
+func newMappedRuleList(id int, path string) (l *mappedRuleList, err error) {
+	data, unmap, err := aghos.MapFile(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return &mappedRuleList{
+		unmap: unmap,
+		data:  data,
+		id:    id,
+	}, nil
+}
+
+// GetID implements the [filterlist.RuleList] interface for *mappedRuleList.
+func (l *mappedRuleList) GetID() (id int) {
+	return l.id
+}
+
+// NewScanner implements the [filterlist.RuleList] interface for
+// *mappedRuleList.
+func (l *mappedRuleList) NewScanner() (s *filterlist.RuleScanner) {
+	return filterlist.NewRuleScanner(bytes.NewReader(l.data), l.id, true)
+}
+
+// RetrieveRule implements the [filterlist.RuleList] interface for
+// *mappedRuleList.  Only the text of the rule is copied into the heap.
+func (l *mappedRuleList) RetrieveRule(ruleIdx int) (r rules.Rule, err error) {
+	if ruleIdx < 0 || ruleIdx >= len(l.data) {
+		return nil, filterlist.ErrRuleRetrieval
+	}
+
+	line := l.data[ruleIdx:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil, filterlist.ErrRuleRetrieval
+	}
+
+	return rules.NewRule(string(line), l.id)
+}
+
+// Close implements the [filterlist.RuleList] interface for *mappedRuleList.
+func (l *mappedRuleList) Close() (err error) {
+	err = l.unmap()
+	if err != nil {
+		return fmt.Errorf("unmapping rule list %d: %w", l.id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package filtering
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedRuleList(t *testing.T) {
+	t.Parallel()
+
+	const (
+		listID  = 1
+		content = "! comment\n||example.org^\r\n0.0.0.0 example.com\n"
+	)
+
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	l, err := newMappedRuleList(listID, path)
+	if errors.As(err, new(*aghos.UnsupportedError)) {
+		t.Skipf("skipping: %s", err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, l.Close()) })
+
+	var idxs []int
+	s := l.NewScanner()
+	for s.Scan() {
+		_, idx := s.Rule()
+		idxs = append(idxs, idx)
+	}
+
+	require.Len(t, idxs, 2)
+
+	r, err := l.RetrieveRule(idxs[0])
+	require.NoError(t, err)
+
+	assert.Equal(t, "||example.org^", r.Text())
+	assert.IsType(t, (*rules.NetworkRule)(nil), r)
+
+	r, err = l.RetrieveRule(idxs[1])
+	require.NoError(t, err)
+
+	assert.Equal(t, "0.0.0.0 example.com", r.Text())
+
+	_, err = l.RetrieveRule(len(content))
+	assert.ErrorIs(t, err, filterlist.ErrRuleRetrieval)
+
+	_, err = l.RetrieveRule(-1)
+	assert.ErrorIs(t, err, filterlist.ErrRuleRetrieval)
+}
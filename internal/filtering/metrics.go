@@ -0,0 +1,52 @@
+package filtering
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/metrics"
+)
+
+// WriteMetrics writes the sizes of the filter lists to w in the Prometheus
+// text-based exposition format.
+func (d *DNSFilter) WriteMetrics(w io.Writer) (err error) {
+	const name = "adguard_filter_list_rules"
+
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	err = metrics.WriteHeader(w, name, "Number of the rules in the filter list.", metrics.TypeGauge)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	labels := []string{"id", "name", "enabled", "allowlist"}
+	for _, list := range []struct {
+		filters   []FilterYAML
+		allowlist bool
+	}{{
+		filters:   d.conf.Filters,
+		allowlist: false,
+	}, {
+		filters:   d.conf.WhitelistFilters,
+		allowlist: true,
+	}} {
+		for _, f := range list.filters {
+			vals := []string{
+				strconv.FormatInt(int64(f.ID), 10),
+				f.Name,
+				strconv.FormatBool(f.Enabled),
+				strconv.FormatBool(list.allowlist),
+			}
+
+			err = metrics.WriteSample(w, name, labels, vals, float64(f.RulesCount))
+			if err != nil {
+				// Don't wrap the error since it's informative enough as is.
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package newdomain
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// feedDateLayout is the layout of the registration dates in feeds.
+const feedDateLayout = time.DateOnly
+
+// maxFeedSize is the maximum size of the feed data.
+const maxFeedSize = 64 * 1024 * 1024
+
+// FeedConfig is the configuration structure for a [FeedSource].
+type FeedConfig struct {
+	// HTTPClient is the client used to download the feed.  It must not be nil
+	// if URL is not a file path.
+	HTTPClient *http.Client
+
+	// URL is the URL or the absolute path of the feed.
+	URL string
+
+	// RefreshIvl is the interval between the feed updates.
+	RefreshIvl time.Duration
+}
+
+// FeedSource is a [Source] which uses a downloadable list of newly-registered
+// domains.  Each non-empty line of the list that doesn't start with "#" or "!"
+// contains a domain optionally followed by its registration date in the
+// "YYYY-MM-DD" format.  Domains without a date are considered registered at
+// the time of the feed update.
+type FeedSource struct {
+	// mu protects domains and updated.
+	mu *sync.RWMutex
+
+	// domains maps registrable domains to their registration times.
+	domains map[string]time.Time
+
+	// updated is the time of the last successful update.
+	updated time.Time
+
+	client *http.Client
+
+	url string
+
+	refreshIvl time.Duration
+
+	// refreshing is true if the feed is being updated.
+	refreshing *atomic.Bool
+}
+
+// NewFeedSource returns a new properly initialized *FeedSource.  The feed is
+// downloaded on the first lookup.
+func NewFeedSource(conf *FeedConfig) (s *FeedSource) {
+	return &FeedSource{
+		mu:         &sync.RWMutex{},
+		domains:    map[string]time.Time{},
+		client:     conf.HTTPClient,
+		url:        conf.URL,
+		refreshIvl: conf.RefreshIvl,
+		refreshing: &atomic.Bool{},
+	}
+}
+
+// type check
+var _ Source = (*FeedSource)(nil)
+
+// RegisteredAt implements the [Source] interface for *FeedSource.  It starts
+// updating the feed in background if it's stale, err is always nil.
+func (s *FeedSource) RegisteredAt(
+	_ context.Context,
+	domain string,
+) (t time.Time, ok bool, err error) {
+	s.refreshIfStale()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok = s.domains[domain]
+
+	return t, ok, nil
+}
+
+// refreshIfStale starts updating the feed in a separate goroutine if it's
+// stale and isn't being updated already.
+func (s *FeedSource) refreshIfStale() {
+	s.mu.RLock()
+	updated := s.updated
+	s.mu.RUnlock()
+
+	if time.Since(updated) < s.refreshIvl || !s.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer log.OnPanic("newdomain: refreshing feed")
+		defer s.refreshing.Store(false)
+
+		err := s.Refresh(context.Background())
+		if err != nil {
+			log.Error("newdomain: refreshing feed %q: %s", s.url, err)
+		}
+	}()
+}
+
+// Refresh downloads and parses the feed.
+func (s *FeedSource) Refresh(ctx context.Context) (err error) {
+	defer func() { err = errors.Annotate(err, "refreshing %q: %w", s.url) }()
+
+	rc, err := s.open(ctx)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, rc.Close()) }()
+
+	now := time.Now()
+	domains, err := parseFeed(ioutil.LimitReader(rc, maxFeedSize), now)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.domains, s.updated = domains, now
+
+	log.Debug("newdomain: loaded %d domains from %q", len(domains), s.url)
+
+	return nil
+}
+
+// open returns the reader of the feed contents.
+func (s *FeedSource) open(ctx context.Context) (rc io.ReadCloser, err error) {
+	if filepath.IsAbs(s.url) {
+		// Don't wrap the error since it's informative enough as is.
+		return os.Open(s.url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+
+		return nil, fmt.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	return resp.Body, nil
+}
+
+// parseFeed parses the feed data from r.  now is used as the registration time
+// of domains without one.
+func parseFeed(r io.Reader, now time.Time) (domains map[string]time.Time, err error) {
+	domains = map[string]time.Time{}
+
+	s := bufio.NewScanner(r)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) (ok bool) {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+
+		regAt := now
+		if len(fields) > 1 {
+			regAt, err = time.Parse(feedDateLayout, fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: parsing date: %w", lineNum, err)
+			}
+		}
+
+		domain := strings.ToLower(strings.TrimSuffix(fields[0], "."))
+		domains[aghnet.RegistrableDomain(domain)] = regAt
+	}
+
+	err = s.Err()
+	if err != nil {
+		return nil, fmt.Errorf("reading feed: %w", err)
+	}
+
+	return domains, nil
+}
@@ -0,0 +1,63 @@
+package newdomain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		want       map[string]time.Time
+		name       string
+		in         string
+		wantErrMsg string
+	}{{
+		want:       map[string]time.Time{},
+		name:       "empty",
+		in:         "",
+		wantErrMsg: "",
+	}, {
+		want: map[string]time.Time{
+			"example.com":   now,
+			"example.co.uk": time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC),
+			"example.org":   time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+		},
+		name: "success",
+		in: "# comment\n" +
+			"! another comment\n" +
+			"\n" +
+			"Example.COM.\n" +
+			"www.example.co.uk 2024-05-30\n" +
+			"example.org,2024-05-31\n",
+		wantErrMsg: "",
+	}, {
+		want: nil,
+		name: "bad_date",
+		in:   "example.com 31.05.2024\n",
+		wantErrMsg: `line 1: parsing date: parsing time "31.05.2024" as "2006-01-02": ` +
+			`cannot parse "31.05.2024" as "2006"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseFeed(strings.NewReader(tc.in), now)
+			if tc.wantErrMsg != "" {
+				require.Error(t, err)
+
+				assert.Equal(t, tc.wantErrMsg, err.Error())
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+// Package newdomain contains the data sources used to find out when domains
+// have been registered, which is used to block or flag newly-registered
+// domains.
+package newdomain
+
+import (
+	"context"
+	"time"
+)
+
+// Source returns the registration time of domains.
+type Source interface {
+	// RegisteredAt returns the registration time of the registrable domain.
+	// ok is false if the registration time is unknown.  It must not block
+	// for long, so the sources requesting remote services should look the
+	// domains up in background.
+	RegisteredAt(ctx context.Context, domain string) (t time.Time, ok bool, err error)
+}
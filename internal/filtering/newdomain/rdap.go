@@ -0,0 +1,254 @@
+package newdomain
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/cache"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// DefaultRDAPURL is the default base URL of the RDAP service.  The bootstrap
+// service at rdap.org redirects requests to the authoritative RDAP servers.
+const DefaultRDAPURL = "https://rdap.org/domain/"
+
+// maxRDAPRespSize is the maximum size of the RDAP response body.
+const maxRDAPRespSize = 256 * 1024
+
+// rdapLookupTimeout is the timeout for a single RDAP lookup.
+const rdapLookupTimeout = 10 * time.Second
+
+// failureCacheTTL is the time to store the failed lookups, so that the
+// unavailable or rate-limiting RDAP services aren't requested for every query.
+const failureCacheTTL = 1 * time.Minute
+
+// maxPendingLookups is the maximum number of RDAP lookups performed at the
+// same time.
+const maxPendingLookups = 64
+
+// rdapEventRegistration is the RDAP event action of the domain registration.
+const rdapEventRegistration = "registration"
+
+// RDAPConfig is the configuration structure for an [RDAPSource].
+type RDAPConfig struct {
+	// HTTPClient is the client used to make RDAP requests.  It must not be
+	// nil.
+	HTTPClient *http.Client
+
+	// BaseURL is the base URL of the RDAP service.  The domain name is appended
+	// to it.  It must not be nil.
+	BaseURL *url.URL
+
+	// CacheTTL is the time to store the lookup results.
+	CacheTTL time.Duration
+
+	// CacheSize is the maximum size of the cache in bytes.  If it's zero, the
+	// cache size is unlimited.
+	CacheSize uint
+}
+
+// RDAPSource is a [Source] which looks up the registration time using the
+// Registration Data Access Protocol, see RFC 9083.  The lookups are performed
+// in background, so the registration time of a domain is only known after the
+// lookup started by the first request for it is finished.
+type RDAPSource struct {
+	client  *http.Client
+	baseURL *url.URL
+	cache   cache.Cache
+
+	// pendingMu protects pending.
+	pendingMu *sync.Mutex
+
+	// pending is the set of domains being looked up.
+	pending map[string]struct{}
+
+	cacheTTL time.Duration
+}
+
+// NewRDAPSource returns a new properly initialized *RDAPSource.
+func NewRDAPSource(conf *RDAPConfig) (s *RDAPSource) {
+	return &RDAPSource{
+		client:  conf.HTTPClient,
+		baseURL: conf.BaseURL,
+		cache: cache.New(cache.Config{
+			EnableLRU: true,
+			MaxSize:   conf.CacheSize,
+		}),
+		pendingMu: &sync.Mutex{},
+		pending:   map[string]struct{}{},
+		cacheTTL:  conf.CacheTTL,
+	}
+}
+
+// type check
+var _ Source = (*RDAPSource)(nil)
+
+// RegisteredAt implements the [Source] interface for *RDAPSource.  If the
+// registration time of domain isn't cached, it starts looking it up in
+// background and returns false.  err is always nil.
+func (s *RDAPSource) RegisteredAt(
+	_ context.Context,
+	domain string,
+) (t time.Time, ok bool, err error) {
+	t, ok, found := s.findInCache(domain)
+	if found {
+		log.Debug("newdomain: found %q in cache", domain)
+
+		return t, ok, nil
+	}
+
+	s.lookupAsync(domain)
+
+	return time.Time{}, false, nil
+}
+
+// lookupAsync starts looking up the registration time of domain in a separate
+// goroutine, unless it's already being looked up or there are too many pending
+// lookups.
+func (s *RDAPSource) lookupAsync(domain string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if _, ok := s.pending[domain]; ok {
+		return
+	} else if len(s.pending) >= maxPendingLookups {
+		log.Debug("newdomain: too many pending lookups, skipping %q", domain)
+
+		return
+	}
+
+	s.pending[domain] = struct{}{}
+
+	go s.lookupAndCache(domain)
+}
+
+// lookupAndCache looks up the registration time of domain and caches the
+// result.  Failed lookups are cached for a shorter time.
+func (s *RDAPSource) lookupAndCache(domain string) {
+	defer log.OnPanic("newdomain: rdap lookup")
+
+	defer func() {
+		s.pendingMu.Lock()
+		defer s.pendingMu.Unlock()
+
+		delete(s.pending, domain)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), rdapLookupTimeout)
+	defer cancel()
+
+	t, ok, err := s.lookup(ctx, domain)
+	if err != nil {
+		log.Debug("newdomain: rdap lookup for %q: %s", domain, err)
+
+		s.storeInCache(domain, time.Time{}, false, failureCacheTTL)
+
+		return
+	}
+
+	s.storeInCache(domain, t, ok, s.cacheTTL)
+}
+
+// rdapResp is the part of the RDAP domain response used to find the
+// registration time.
+type rdapResp struct {
+	Events []rdapEvent `json:"events"`
+}
+
+// rdapEvent is an event of an RDAP object.
+type rdapEvent struct {
+	Date   time.Time `json:"eventDate"`
+	Action string    `json:"eventAction"`
+}
+
+// lookup requests the registration time of domain from the RDAP service.
+func (s *RDAPSource) lookup(ctx context.Context, domain string) (t time.Time, ok bool, err error) {
+	u := s.baseURL.JoinPath(domain)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/rdap+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return time.Time{}, false, err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Go on.
+	case http.StatusNotFound:
+		return time.Time{}, false, nil
+	default:
+		return time.Time{}, false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	r := &rdapResp{}
+	err = json.NewDecoder(ioutil.LimitReader(resp.Body, maxRDAPRespSize)).Decode(r)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("decoding response: %w", err)
+	}
+
+	for _, e := range r.Events {
+		if e.Action == rdapEventRegistration {
+			return e.Date, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+// cacheItemSize is the size of an encoded cache item: the expiry time and the
+// registration time, both as Unix seconds.
+const cacheItemSize = 16
+
+// findInCache returns the cached registration time of domain.  found is false
+// if there is no valid cache item.
+func (s *RDAPSource) findInCache(domain string) (t time.Time, ok, found bool) {
+	data := s.cache.Get([]byte(domain))
+	if len(data) != cacheItemSize {
+		return time.Time{}, false, false
+	}
+
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(data)), 0)
+	if time.Now().After(expiry) {
+		s.cache.Del([]byte(domain))
+
+		return time.Time{}, false, false
+	}
+
+	regAt := int64(binary.BigEndian.Uint64(data[8:]))
+	if regAt == 0 {
+		return time.Time{}, false, true
+	}
+
+	return time.Unix(regAt, 0), true, true
+}
+
+// storeInCache stores the registration time of domain for ttl.  A zero value
+// is stored if ok is false.
+func (s *RDAPSource) storeInCache(domain string, t time.Time, ok bool, ttl time.Duration) {
+	data := make([]byte, 0, cacheItemSize)
+	data = binary.BigEndian.AppendUint64(data, uint64(time.Now().Add(ttl).Unix()))
+
+	var regAt int64
+	if ok {
+		regAt = t.Unix()
+	}
+
+	data = binary.BigEndian.AppendUint64(data, uint64(regAt))
+
+	s.cache.Set([]byte(domain), data)
+}
@@ -0,0 +1,107 @@
+package newdomain_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/newdomain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRDAPSource_RegisteredAt(t *testing.T) {
+	var reqNum atomic.Uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqNum.Add(1)
+
+		switch r.URL.Path {
+		case "/domain/new.example":
+			_, _ = w.Write([]byte(`{"events":[` +
+				`{"eventAction":"last changed","eventDate":"2024-06-02T00:00:00Z"},` +
+				`{"eventAction":"registration","eventDate":"2024-06-01T00:00:00Z"}` +
+				`]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/domain/")
+	require.NoError(t, err)
+
+	src := newdomain.NewRDAPSource(&newdomain.RDAPConfig{
+		HTTPClient: srv.Client(),
+		BaseURL:    u,
+		CacheTTL:   time.Hour,
+		CacheSize:  1024,
+	})
+
+	ctx := context.Background()
+	wantTime := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// The first lookup is performed in background.
+	_, ok, err := src.RegisteredAt(ctx, "new.example")
+	require.NoError(t, err)
+
+	assert.False(t, ok)
+
+	var regAt time.Time
+	require.Eventually(t, func() (found bool) {
+		regAt, found, err = src.RegisteredAt(ctx, "new.example")
+
+		return found
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, err)
+
+	assert.True(t, wantTime.Equal(regAt))
+	assert.Equal(t, uint32(1), reqNum.Load())
+
+	_, ok, err = src.RegisteredAt(ctx, "unknown.example")
+	require.NoError(t, err)
+
+	assert.False(t, ok)
+}
+
+func TestRDAPSource_RegisteredAt_failure(t *testing.T) {
+	var reqNum atomic.Uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		reqNum.Add(1)
+
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + "/domain/")
+	require.NoError(t, err)
+
+	src := newdomain.NewRDAPSource(&newdomain.RDAPConfig{
+		HTTPClient: srv.Client(),
+		BaseURL:    u,
+		CacheTTL:   time.Hour,
+		CacheSize:  1024,
+	})
+
+	ctx := context.Background()
+
+	_, ok, err := src.RegisteredAt(ctx, "new.example")
+	require.NoError(t, err)
+
+	assert.False(t, ok)
+
+	require.Eventually(t, func() (done bool) {
+		return reqNum.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The failure is cached, so the service isn't requested again.
+	assert.Never(t, func() (requested bool) {
+		_, ok, err = src.RegisteredAt(ctx, "new.example")
+
+		return err != nil || ok || reqNum.Load() > 1
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
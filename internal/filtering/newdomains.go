@@ -0,0 +1,239 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/newdomain"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// DomainAgeSource returns the registration time of domains.
+type DomainAgeSource interface {
+	// RegisteredAt returns the registration time of the registrable domain.
+	// ok is false if the registration time is unknown.  It must not block
+	// for long, since it's called for every DNS request.
+	RegisteredAt(ctx context.Context, domain string) (t time.Time, ok bool, err error)
+}
+
+// NewDomainAction is the action applied to newly-registered domains.
+type NewDomainAction string
+
+// Supported new domain actions.
+const (
+	// NewDomainActionBlock blocks the requests for newly-registered domains.
+	NewDomainActionBlock NewDomainAction = "block"
+
+	// NewDomainActionFlag only marks the requests for newly-registered domains
+	// in the query log.
+	NewDomainActionFlag NewDomainAction = "flag"
+)
+
+// NewDomainSourceType is the type of the registration data source.
+type NewDomainSourceType string
+
+// Supported registration data source types.
+const (
+	NewDomainSourceFeed NewDomainSourceType = "feed"
+	NewDomainSourceRDAP NewDomainSourceType = "rdap"
+)
+
+// NewDomainsConfig is the configuration of the newly-registered domains
+// blocking.
+type NewDomainsConfig struct {
+	// Action is the action applied to newly-registered domains.
+	Action NewDomainAction `yaml:"action" json:"action"`
+
+	// Source is the type of the registration data source.
+	Source NewDomainSourceType `yaml:"source" json:"-"`
+
+	// FeedURL is the URL or the absolute path of the feed of newly-registered
+	// domains.  It's only used when Source is [NewDomainSourceFeed].
+	FeedURL string `yaml:"feed_url" json:"-"`
+
+	// RDAPURL is the base URL of the RDAP service.  It's only used when Source
+	// is [NewDomainSourceRDAP].
+	RDAPURL string `yaml:"rdap_url" json:"-"`
+
+	// Allowlist are the domains which are never considered newly-registered.
+	// Their subdomains are allowed as well.
+	Allowlist []string `yaml:"allowlist" json:"allowlist"`
+
+	// CacheTTL is the time to store the lookup results.
+	CacheTTL timeutil.Duration `yaml:"cache_ttl" json:"-"`
+
+	// CacheSize is the maximum size of the lookup cache in bytes.
+	CacheSize uint `yaml:"cache_size" json:"-"`
+
+	// MaxAgeDays is the maximum age of a domain in days to be considered
+	// newly-registered.
+	MaxAgeDays uint32 `yaml:"max_age_days" json:"max_age_days"`
+
+	// Enabled defines if the newly-registered domains are checked globally.
+	// Per-client settings can override it.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+// Validate returns an error if c contains invalid values of the settings
+// changeable through the HTTP API.
+func (c *NewDomainsConfig) Validate() (err error) {
+	switch c.Action {
+	case NewDomainActionBlock, NewDomainActionFlag:
+		// Go on.
+	default:
+		return fmt.Errorf("action: unsupported value %q", c.Action)
+	}
+
+	if c.MaxAgeDays == 0 {
+		return fmt.Errorf("max_age_days: must be positive")
+	}
+
+	for i, d := range c.Allowlist {
+		err = netutil.ValidateDomainName(d)
+		if err != nil {
+			return fmt.Errorf("allowlist: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// newSource returns the registration data source described by c.
+func (c *NewDomainsConfig) newSource(conf *Config) (src DomainAgeSource, err error) {
+	switch c.Source {
+	case NewDomainSourceFeed:
+		if c.FeedURL == "" {
+			return nil, fmt.Errorf("feed_url: empty value")
+		}
+
+		return newdomain.NewFeedSource(&newdomain.FeedConfig{
+			HTTPClient: conf.HTTPClient,
+			URL:        c.FeedURL,
+			RefreshIvl: time.Duration(conf.FiltersUpdateIntervalHours) * time.Hour,
+		}), nil
+	case NewDomainSourceRDAP:
+		rdapURL := c.RDAPURL
+		if rdapURL == "" {
+			rdapURL = newdomain.DefaultRDAPURL
+		}
+
+		u, pErr := url.Parse(rdapURL)
+		if pErr != nil {
+			return nil, fmt.Errorf("rdap_url: %w", pErr)
+		}
+
+		return newdomain.NewRDAPSource(&newdomain.RDAPConfig{
+			HTTPClient: conf.HTTPClient,
+			BaseURL:    u,
+			CacheTTL:   c.CacheTTL.Duration,
+			CacheSize:  c.CacheSize,
+		}), nil
+	default:
+		return nil, fmt.Errorf("source: unsupported value %q", c.Source)
+	}
+}
+
+// initNewDomains validates the newly-registered domains configuration and
+// creates the registration data source, unless it's already set.
+func (d *DNSFilter) initNewDomains() (err error) {
+	c := &d.conf.NewDomainsConf
+	if c.Source == "" {
+		if c.Enabled {
+			return fmt.Errorf("source: empty value")
+		}
+
+		return nil
+	}
+
+	err = c.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if d.newDomainSource != nil {
+		return nil
+	}
+
+	d.newDomainSource, err = c.newSource(d.conf)
+
+	// Don't wrap the error since it's informative enough as is.
+	return err
+}
+
+// isAllowlisted returns true if host is a domain from the allowlist or its
+// subdomain.
+func (c *NewDomainsConfig) isAllowlisted(host string) (ok bool) {
+	for _, d := range c.Allowlist {
+		d = strings.ToLower(d)
+		if host == d || netutil.IsSubdomain(host, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkNewDomain checks if host belongs to a newly-registered domain.  Lookup
+// errors are logged and the request isn't filtered, so err is always nil.  The
+// requests for domains with yet unknown registration time aren't filtered
+// either.
+func (d *DNSFilter) checkNewDomain(
+	host string,
+	_ uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled || !setts.NewDomainsEnabled || d.newDomainSource == nil {
+		return Result{}, nil
+	}
+
+	var conf NewDomainsConfig
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		conf = d.conf.NewDomainsConf
+	}()
+
+	if conf.isAllowlisted(host) {
+		return Result{}, nil
+	}
+
+	domain := aghnet.RegistrableDomain(host)
+
+	regAt, ok, err := d.newDomainSource.RegisteredAt(context.Background(), domain)
+	if err != nil {
+		log.Debug("filtering: checking new domain %q: %s", domain, err)
+
+		return Result{}, nil
+	}
+
+	maxAge := time.Duration(conf.MaxAgeDays) * timeutil.Day
+	if !ok || time.Since(regAt) > maxAge {
+		return Result{}, nil
+	}
+
+	log.Debug("filtering: %q is registered at %s", domain, regAt)
+
+	res = Result{
+		Rules: []*ResultRule{{
+			Text:         "newly-registered-domain",
+			FilterListID: rulelist.URLFilterIDNewDomain,
+		}},
+		Reason: NotFilteredNewDomain,
+	}
+
+	if conf.Action == NewDomainActionBlock {
+		res.Reason = FilteredNewDomain
+		res.IsFiltered = true
+	}
+
+	return res, nil
+}
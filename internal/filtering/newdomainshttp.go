@@ -0,0 +1,73 @@
+package filtering
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+)
+
+// handleNewDomainsStatus is the handler for the GET /control/new_domains/status
+// HTTP API.
+func (d *DNSFilter) handleNewDomainsStatus(w http.ResponseWriter, r *http.Request) {
+	var resp NewDomainsConfig
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		resp = d.conf.NewDomainsConf
+		resp.Allowlist = slices.Clone(resp.Allowlist)
+	}()
+
+	if resp.Allowlist == nil {
+		resp.Allowlist = []string{}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleNewDomainsConfig is the handler for the PUT /control/new_domains/config
+// HTTP API.
+func (d *DNSFilter) handleNewDomainsConfig(w http.ResponseWriter, r *http.Request) {
+	req := &NewDomainsConfig{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = req.Validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "%s", err)
+
+		return
+	}
+
+	if req.Enabled && d.newDomainSource == nil {
+		aghhttp.Error(
+			r,
+			w,
+			http.StatusUnprocessableEntity,
+			"no registration data source configured",
+		)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		conf := &d.conf.NewDomainsConf
+		conf.Enabled = req.Enabled
+		conf.Action = req.Action
+		conf.MaxAgeDays = req.MaxAgeDays
+		conf.Allowlist = req.Allowlist
+	}()
+
+	d.conf.ConfigModified()
+
+	aghhttp.OK(w)
+}
@@ -0,0 +1,159 @@
+package filtering
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// QuotaPeriod is the period the queries are counted within for a quota.
+type QuotaPeriod string
+
+// Supported quota periods.
+const (
+	QuotaPeriodHour QuotaPeriod = "hour"
+	QuotaPeriodDay  QuotaPeriod = "day"
+)
+
+// Start returns the start of the period containing t.  The days start at the
+// local midnight.
+func (p QuotaPeriod) Start(t time.Time) (start time.Time) {
+	if p == QuotaPeriodHour {
+		return t.Truncate(time.Hour)
+	}
+
+	y, m, d := t.Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// QuotaAction is the action taken on the queries exceeding a quota.
+type QuotaAction string
+
+// Supported quota actions.
+const (
+	// QuotaActionLog only logs and counts the queries exceeding the quota.
+	QuotaActionLog QuotaAction = "log"
+
+	// QuotaActionThrottle allows a single query per second exceeding the
+	// quota and refuses the others.
+	QuotaActionThrottle QuotaAction = "throttle"
+
+	// QuotaActionBlock blocks the queries exceeding the quota.
+	QuotaActionBlock QuotaAction = "block"
+)
+
+// QueryQuota limits the number of queries of a client within a period.
+type QueryQuota struct {
+	// BlockIP is the address the blocked A or AAAA queries are answered with,
+	// if Action is [QuotaActionBlock].  If it's invalid, the blocking mode is
+	// used.
+	BlockIP netip.Addr `yaml:"block_ip" json:"block_ip,omitempty"`
+
+	// Period is the period the queries are counted within.
+	Period QuotaPeriod `yaml:"period" json:"period"`
+
+	// Action is the action taken on the queries exceeding the limit.
+	Action QuotaAction `yaml:"action" json:"action"`
+
+	// Services are the IDs of the blocked services which domains are counted.
+	// If it's empty, all the queries are counted.
+	Services []string `yaml:"services,omitempty" json:"services,omitempty"`
+
+	// Limit is the maximum number of queries within the period.
+	Limit uint64 `yaml:"limit" json:"limit"`
+}
+
+// Clone returns a deep copy of q.
+func (q *QueryQuota) Clone() (c *QueryQuota) {
+	if q == nil {
+		return nil
+	}
+
+	c = &QueryQuota{}
+	*c = *q
+	c.Services = slices.Clone(q.Services)
+
+	return c
+}
+
+// Validate returns an error if q is not a valid quota.
+func (q *QueryQuota) Validate() (err error) {
+	if q == nil {
+		return errors.Error("no value")
+	}
+
+	switch q.Period {
+	case QuotaPeriodHour, QuotaPeriodDay:
+		// Go on.
+	default:
+		return fmt.Errorf("bad period %q", q.Period)
+	}
+
+	switch q.Action {
+	case QuotaActionLog, QuotaActionThrottle, QuotaActionBlock:
+		// Go on.
+	default:
+		return fmt.Errorf("bad action %q", q.Action)
+	}
+
+	if q.Limit == 0 {
+		return errors.Error("limit must be positive")
+	}
+
+	for _, id := range q.Services {
+		if _, ok := serviceRules[id]; !ok {
+			return fmt.Errorf("unknown blocked-service %q", id)
+		}
+	}
+
+	return nil
+}
+
+// Matches returns true if the query for host is counted by q.
+func (q *QueryQuota) Matches(host string) (ok bool) {
+	if len(q.Services) == 0 {
+		return true
+	}
+
+	req := rules.NewRequestForHostname(host)
+	for _, id := range q.Services {
+		for _, rule := range serviceRules[id] {
+			if rule.Match(req) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ValidateQueryQuotas returns an error if any of quotas is invalid.
+func ValidateQueryQuotas(quotas []*QueryQuota) (err error) {
+	for i, q := range quotas {
+		err = q.Validate()
+		if err != nil {
+			return fmt.Errorf("quota at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// CloneQueryQuotas returns a deep copy of quotas.
+func CloneQueryQuotas(quotas []*QueryQuota) (clone []*QueryQuota) {
+	if quotas == nil {
+		return nil
+	}
+
+	clone = make([]*QueryQuota, 0, len(quotas))
+	for _, q := range quotas {
+		clone = append(clone, q.Clone())
+	}
+
+	return clone
+}
@@ -0,0 +1,90 @@
+package filtering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryQuota_Validate(t *testing.T) {
+	InitModule()
+
+	testCases := []struct {
+		quota      *QueryQuota
+		name       string
+		wantErrMsg string
+	}{{
+		quota: &QueryQuota{
+			Period:   QuotaPeriodDay,
+			Action:   QuotaActionBlock,
+			Services: []string{"youtube"},
+			Limit:    100,
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		quota:      nil,
+		name:       "nil",
+		wantErrMsg: "no value",
+	}, {
+		quota: &QueryQuota{
+			Period: "week",
+			Action: QuotaActionLog,
+			Limit:  1,
+		},
+		name:       "bad_period",
+		wantErrMsg: `bad period "week"`,
+	}, {
+		quota: &QueryQuota{
+			Period: QuotaPeriodHour,
+			Action: "drop",
+			Limit:  1,
+		},
+		name:       "bad_action",
+		wantErrMsg: `bad action "drop"`,
+	}, {
+		quota: &QueryQuota{
+			Period: QuotaPeriodHour,
+			Action: QuotaActionLog,
+		},
+		name:       "zero_limit",
+		wantErrMsg: "limit must be positive",
+	}, {
+		quota: &QueryQuota{
+			Period:   QuotaPeriodHour,
+			Action:   QuotaActionLog,
+			Services: []string{"unknown"},
+			Limit:    1,
+		},
+		name:       "bad_service",
+		wantErrMsg: `unknown blocked-service "unknown"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.quota.Validate())
+		})
+	}
+}
+
+func TestQueryQuota_Matches(t *testing.T) {
+	InitModule()
+
+	all := &QueryQuota{}
+	assert.True(t, all.Matches("example.org"))
+
+	yt := &QueryQuota{
+		Services: []string{"youtube"},
+	}
+	assert.True(t, yt.Matches("www.youtube.com"))
+	assert.False(t, yt.Matches("example.org"))
+}
+
+func TestQuotaPeriod_Start(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC), QuotaPeriodHour.Start(now))
+	assert.Equal(t, time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), QuotaPeriodDay.Start(now))
+}
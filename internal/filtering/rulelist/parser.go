@@ -7,14 +7,18 @@ import (
 	"hash/crc32"
 	"io"
 	"slices"
+	"strconv"
+	"time"
 
 	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/timeutil"
 )
 
 // Parser is a filtering-rule parser that collects data, such as the checksum
 // and the title, as well as counts rules and removes comments.
 type Parser struct {
 	title      string
+	expires    time.Duration
 	rulesCount int
 	written    int
 	checksum   uint32
@@ -32,6 +36,10 @@ type ParseResult struct {
 	// Title is the title contained within the filtering-rule list, if any.
 	Title string
 
+	// Expires is the update period contained within the "! Expires:" header of
+	// the filtering-rule list, if any.
+	Expires time.Duration
+
 	// RulesCount is the number of rules in the list.  It excludes empty lines
 	// and comments.
 	RulesCount int
@@ -83,6 +91,7 @@ func (p *Parser) Parse(dst io.Writer, src io.Reader, buf []byte) (r *ParseResult
 func (p *Parser) result() (r *ParseResult) {
 	return &ParseResult{
 		Title:        p.title,
+		Expires:      p.expires,
 		RulesCount:   p.rulesCount,
 		BytesWritten: p.written,
 		Checksum:     p.checksum,
@@ -97,6 +106,10 @@ func (p *Parser) processLine(dst io.Writer, line []byte, lineNum int) (n int, er
 		return 0, ErrHTML
 	}
 
+	if p.rulesCount == 0 && p.expires == 0 {
+		p.expires = parseExpires(trimmed)
+	}
+
 	badIdx, isRule := 0, false
 	if p.titleFound {
 		badIdx, isRule = parseLine(trimmed)
@@ -189,3 +202,31 @@ func (p *Parser) parseLineTitle(line []byte) (badIdx int, isRule bool) {
 
 	return -1, false
 }
+
+// parseExpires returns the update period from the "! Expires:" header line,
+// e.g. "! Expires: 4 days (update frequency)".  A number without a unit is
+// considered to be in days.  line is assumed to be trimmed of whitespace
+// characters.  ivl is zero if line isn't a valid header.
+func parseExpires(line []byte) (ivl time.Duration) {
+	const expiresPattern = "! Expires:"
+	if !bytes.HasPrefix(line, []byte(expiresPattern)) {
+		return 0
+	}
+
+	fields := bytes.Fields(line[len(expiresPattern):])
+	if len(fields) == 0 {
+		return 0
+	}
+
+	n, err := strconv.ParseUint(string(fields[0]), 10, 16)
+	if err != nil {
+		return 0
+	}
+
+	unit := timeutil.Day
+	if len(fields) > 1 && bytes.HasPrefix(bytes.ToLower(fields[1]), []byte("hour")) {
+		unit = time.Hour
+	}
+
+	return time.Duration(n) * unit
+}
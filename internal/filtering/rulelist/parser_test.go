@@ -3,13 +3,16 @@ package rulelist_test
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/AdguardTeam/golibs/testutil/fakeio"
+	"github.com/AdguardTeam/golibs/timeutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -155,6 +158,54 @@ func TestParser_Parse(t *testing.T) {
 	}
 }
 
+func TestParser_Parse_expires(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		in   string
+		want time.Duration
+	}{{
+		name: "none",
+		in:   testRuleTextTitle + testRuleTextBlocked,
+		want: 0,
+	}, {
+		name: "days",
+		in:   "! Expires: 4 days (update frequency)\n" + testRuleTextBlocked,
+		want: 4 * timeutil.Day,
+	}, {
+		name: "hours",
+		in:   "! Expires: 12 hours\n" + testRuleTextBlocked,
+		want: 12 * time.Hour,
+	}, {
+		name: "no_unit",
+		in:   "! Expires: 2\n" + testRuleTextBlocked,
+		want: 2 * timeutil.Day,
+	}, {
+		name: "invalid",
+		in:   "! Expires: soon\n" + testRuleTextBlocked,
+		want: 0,
+	}, {
+		name: "after_rules",
+		in:   testRuleTextBlocked + "! Expires: 1 day\n",
+		want: 0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := make([]byte, rulelist.DefaultRuleBufSize)
+
+			p := rulelist.NewParser()
+			r, err := p.Parse(io.Discard, strings.NewReader(tc.in), buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, r.Expires)
+		})
+	}
+}
+
 func TestParser_Parse_writeError(t *testing.T) {
 	t.Parallel()
 
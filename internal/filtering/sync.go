@@ -0,0 +1,250 @@
+package filtering
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering/rulelist"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// SyncFilter is a filter list in the configuration synchronized between the
+// instances.  Filter lists are identified by their URLs, since the IDs are
+// local to an instance.
+type SyncFilter struct {
+	URL     string `json:"url"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// SyncRewrite is a legacy rewrite in the configuration synchronized between the
+// instances.
+type SyncRewrite struct {
+	Domain string `json:"domain"`
+	Answer string `json:"answer"`
+}
+
+// toSyncFilters converts filters into the synchronized ones.
+func toSyncFilters(filters []FilterYAML) (sfs []*SyncFilter) {
+	sfs = make([]*SyncFilter, 0, len(filters))
+	for _, f := range filters {
+		sfs = append(sfs, &SyncFilter{
+			URL:     f.URL,
+			Name:    f.Name,
+			Enabled: f.Enabled,
+		})
+	}
+
+	return sfs
+}
+
+// SyncLists returns the blocking and the allowing filter lists and the user
+// rules for the synchronization.
+func (d *DNSFilter) SyncLists() (block, allow []*SyncFilter, rules []string) {
+	d.conf.filtersMu.RLock()
+	defer d.conf.filtersMu.RUnlock()
+
+	return toSyncFilters(d.conf.Filters),
+		toSyncFilters(d.conf.WhitelistFilters),
+		slices.Clone(d.conf.UserRules)
+}
+
+// validateSyncFilters returns an error if any of the lists has an invalid URL
+// or if there are several lists with the same URL.
+func validateSyncFilters(block, allow []*SyncFilter) (err error) {
+	urls := container.NewMapSet[string]()
+	for i, sf := range slices.Concat(block, allow) {
+		if sf == nil {
+			return fmt.Errorf("filter at index %d: no value", i)
+		}
+
+		err = validateFilterURL(sf.URL)
+		if err != nil {
+			return fmt.Errorf("filter at index %d: %w", i, err)
+		} else if urls.Has(sf.URL) {
+			return fmt.Errorf("filter at index %d: %w", i, errFilterExists)
+		}
+
+		urls.Add(sf.URL)
+	}
+
+	return nil
+}
+
+// SetSyncLists replaces the blocking and the allowing filter lists and the user
+// rules with the synchronized ones.  The lists already present keep their IDs
+// and contents, the new ones are downloaded in the background.
+func (d *DNSFilter) SetSyncLists(block, allow []*SyncFilter, rules []string) (err error) {
+	err = validateSyncFilters(block, allow)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	rules, err = resolveUserRulesExpiry(rules, time.Now())
+	if err != nil {
+		return fmt.Errorf("user rules: %w", err)
+	}
+
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		prev := slices.Concat(d.conf.Filters, d.conf.WhitelistFilters)
+		d.conf.Filters = d.syncedFilters(prev, block, false)
+		d.conf.WhitelistFilters = d.syncedFilters(prev, allow, true)
+		d.conf.UserRules = rules
+
+		d.removeUnsyncedFiles(prev)
+	}()
+
+	d.EnableFilters(true)
+
+	go func() {
+		defer log.OnPanic("filtering: refreshing synced filters")
+
+		_, _, _ = d.tryRefreshFilters(true, true, false)
+	}()
+
+	return nil
+}
+
+// syncedFilters returns the filter lists for sfs reusing the ones from prev
+// with the same URLs.  d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) syncedFilters(prev []FilterYAML, sfs []*SyncFilter, white bool) (res []FilterYAML) {
+	res = make([]FilterYAML, 0, len(sfs))
+	for _, sf := range sfs {
+		i := slices.IndexFunc(prev, func(f FilterYAML) (ok bool) { return f.URL == sf.URL })
+
+		var f FilterYAML
+		if i >= 0 && prev[i].white == white {
+			f = prev[i]
+		} else {
+			f = FilterYAML{
+				URL:   sf.URL,
+				white: white,
+				Filter: Filter{
+					ID: d.idGen.next(),
+				},
+			}
+		}
+
+		f.Name, f.Enabled = sf.Name, sf.Enabled
+		res = append(res, f)
+	}
+
+	return res
+}
+
+// removeUnsyncedFiles renames the files of the filter lists from prev, which
+// are no longer present, the same way the removal HTTP API does.
+// d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) removeUnsyncedFiles(prev []FilterYAML) {
+	ids := container.NewMapSet[rulelist.URLFilterID]()
+	for _, f := range slices.Concat(d.conf.Filters, d.conf.WhitelistFilters) {
+		ids.Add(f.ID)
+	}
+
+	for _, f := range prev {
+		if ids.Has(f.ID) {
+			continue
+		}
+
+		p := f.Path(d.conf.DataDir)
+		err := os.Rename(p, p+".old")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error("filtering: removing synced filter %d: renaming file %q: %s", f.ID, p, err)
+		}
+	}
+}
+
+// SyncRewrites returns the legacy rewrites for the synchronization.
+func (d *DNSFilter) SyncRewrites() (rws []*SyncRewrite) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	rws = make([]*SyncRewrite, 0, len(d.conf.Rewrites))
+	for _, rw := range d.conf.Rewrites {
+		rws = append(rws, &SyncRewrite{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		})
+	}
+
+	return rws
+}
+
+// SetSyncRewrites replaces the legacy rewrites with the synchronized ones.
+func (d *DNSFilter) SetSyncRewrites(rws []*SyncRewrite) (err error) {
+	res := make([]*LegacyRewrite, 0, len(rws))
+	for i, srw := range rws {
+		if srw == nil {
+			return fmt.Errorf("rewrite at index %d: no value", i)
+		}
+
+		rw := &LegacyRewrite{
+			Domain: srw.Domain,
+			Answer: srw.Answer,
+		}
+
+		err = rw.normalize()
+		if err != nil {
+			return fmt.Errorf("rewrite at index %d: %w", i, err)
+		}
+
+		res = append(res, rw)
+	}
+
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	d.conf.Rewrites = res
+
+	return nil
+}
+
+// SyncBlockedServices returns a clone of the global blocked services for the
+// synchronization.
+func (d *DNSFilter) SyncBlockedServices() (bsvc *BlockedServices) {
+	d.confMu.RLock()
+	defer d.confMu.RUnlock()
+
+	if d.conf.BlockedServices == nil {
+		return &BlockedServices{
+			Schedule: schedule.EmptyWeekly(),
+			IDs:      []string{},
+		}
+	}
+
+	return d.conf.BlockedServices.Clone()
+}
+
+// SetSyncBlockedServices replaces the global blocked services with the
+// synchronized ones.
+func (d *DNSFilter) SetSyncBlockedServices(bsvc *BlockedServices) (err error) {
+	if bsvc == nil {
+		return errors.Error("no value")
+	}
+
+	err = bsvc.Validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if bsvc.Schedule == nil {
+		bsvc.Schedule = schedule.EmptyWeekly()
+	}
+
+	d.confMu.Lock()
+	defer d.confMu.Unlock()
+
+	d.conf.BlockedServices = bsvc
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package filtering
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/urlfilter"
+	"github.com/AdguardTeam/urlfilter/filterlist"
+	"github.com/AdguardTeam/urlfilter/rules"
+)
+
+// ThreatCategory is the category of a threat feed.  Each category can be
+// enabled or disabled independently, both globally and per client.
+type ThreatCategory string
+
+// Supported threat categories.
+const (
+	ThreatCategoryPhishing     ThreatCategory = "phishing"
+	ThreatCategoryMalware      ThreatCategory = "malware"
+	ThreatCategoryCryptomining ThreatCategory = "cryptomining"
+	ThreatCategoryNewDomains   ThreatCategory = "new_domains"
+)
+
+// threatCategories contains all supported threat categories in the order in
+// which the feeds are checked.
+var threatCategories = []ThreatCategory{
+	ThreatCategoryPhishing,
+	ThreatCategoryMalware,
+	ThreatCategoryCryptomining,
+	ThreatCategoryNewDomains,
+}
+
+// Validate returns an error if c is not a supported threat category.
+func (c ThreatCategory) Validate() (err error) {
+	if !slices.Contains(threatCategories, c) {
+		return fmt.Errorf("unknown threat category %q", c)
+	}
+
+	return nil
+}
+
+// ValidateThreatCategories returns an error if any of cats is not a supported
+// threat category.
+func ValidateThreatCategories(cats []ThreatCategory) (err error) {
+	for i, c := range cats {
+		err = c.Validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateThreatFeeds returns an error if the threat-feed configuration of d is
+// invalid.
+func (d *DNSFilter) validateThreatFeeds() (err error) {
+	for _, flt := range d.conf.ThreatFeeds {
+		err = flt.Category.Validate()
+		if err != nil {
+			return fmt.Errorf("feed %q: %w", flt.URL, err)
+		}
+	}
+
+	return ValidateThreatCategories(d.conf.ThreatCategories)
+}
+
+// threatEngine is the filtering engine for a single threat category.
+type threatEngine struct {
+	storage *filterlist.RuleStorage
+	engine  *urlfilter.DNSEngine
+}
+
+// newThreatEngines creates the filtering engines for every category in
+// filters.  mmap is passed to [newRuleStorage].
+func newThreatEngines(
+	filters map[ThreatCategory][]Filter,
+	mmap bool,
+) (engines map[ThreatCategory]*threatEngine, err error) {
+	engines = make(map[ThreatCategory]*threatEngine, len(filters))
+	for cat, flts := range filters {
+		var rs *filterlist.RuleStorage
+		rs, err = newRuleStorage(flts, mmap)
+		if err != nil {
+			closeThreatEngines(engines)
+
+			return nil, fmt.Errorf("threat category %q: %w", cat, err)
+		}
+
+		engines[cat] = &threatEngine{
+			storage: rs,
+			engine:  urlfilter.NewDNSEngine(rs),
+		}
+	}
+
+	return engines, nil
+}
+
+// closeThreatEngines closes the rule storages of engines.  Any errors are
+// logged.
+func closeThreatEngines(engines map[ThreatCategory]*threatEngine) {
+	for cat, e := range engines {
+		if err := e.storage.Close(); err != nil {
+			log.Error("filtering: closing threat feeds of category %q: %s", cat, err)
+		}
+	}
+}
+
+// threatFeedsFilters returns the enabled threat feeds grouped by category.
+// d.conf.filtersMu is expected to be locked.
+func (d *DNSFilter) threatFeedsFilters() (filters map[ThreatCategory][]Filter) {
+	filters = map[ThreatCategory][]Filter{}
+	for _, flt := range d.conf.ThreatFeeds {
+		if !flt.Enabled {
+			continue
+		}
+
+		filters[flt.Category] = append(filters[flt.Category], Filter{
+			ID:       flt.ID,
+			FilePath: flt.Path(d.conf.DataDir),
+		})
+	}
+
+	return filters
+}
+
+// checkThreatFeeds checks the host against the feeds of the threat categories
+// enabled in setts.  The err is always nil, it is only there to make this a
+// valid hostChecker function.
+func (d *DNSFilter) checkThreatFeeds(
+	host string,
+	qtype uint16,
+	setts *Settings,
+) (res Result, err error) {
+	if !setts.ProtectionEnabled || len(setts.ThreatCategories) == 0 {
+		return Result{}, nil
+	}
+
+	ufReq := &urlfilter.DNSRequest{
+		Hostname:         host,
+		SortedClientTags: setts.ClientTags,
+		ClientIP:         setts.ClientIP,
+		ClientName:       setts.ClientName,
+		DNSType:          qtype,
+	}
+
+	d.engineLock.RLock()
+	defer d.engineLock.RUnlock()
+
+	for _, cat := range threatCategories {
+		e := d.threatEngines[cat]
+		if e == nil || !slices.Contains(setts.ThreatCategories, cat) {
+			continue
+		}
+
+		dnsres, ok := e.engine.MatchRequest(ufReq)
+		if !ok {
+			continue
+		}
+
+		var matched []rules.Rule
+		switch nr := dnsres.NetworkRule; {
+		case nr != nil && nr.Whitelist:
+			continue
+		case nr != nil:
+			matched = []rules.Rule{nr}
+		case len(dnsres.HostRulesV4) > 0:
+			matched = []rules.Rule{dnsres.HostRulesV4[0]}
+		case len(dnsres.HostRulesV6) > 0:
+			matched = []rules.Rule{dnsres.HostRulesV6[0]}
+		default:
+			continue
+		}
+
+		res = makeResult(matched, FilteredThreatFeed)
+		res.ThreatCategory = cat
+
+		log.Debug("filtering: host %q matched threat category %q", host, cat)
+
+		return res, nil
+	}
+
+	return Result{}, nil
+}
@@ -0,0 +1,228 @@
+package filtering
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// threatFeedJSON is the JSON representation of a threat feed.
+type threatFeedJSON struct {
+	Category ThreatCategory `json:"category"`
+
+	filterJSON
+}
+
+// threatFeedsStatusResp is the response to the GET /control/threat_feeds/status
+// HTTP API.
+type threatFeedsStatusResp struct {
+	Feeds      []threatFeedJSON `json:"feeds"`
+	Categories []ThreatCategory `json:"categories"`
+	Enabled    []ThreatCategory `json:"enabled_categories"`
+}
+
+// handleThreatFeedsStatus is the handler for the GET
+// /control/threat_feeds/status HTTP API.
+func (d *DNSFilter) handleThreatFeedsStatus(w http.ResponseWriter, r *http.Request) {
+	resp := &threatFeedsStatusResp{
+		Feeds:      []threatFeedJSON{},
+		Categories: slices.Clone(threatCategories),
+	}
+
+	func() {
+		d.confMu.RLock()
+		defer d.confMu.RUnlock()
+
+		resp.Enabled = slices.Clone(d.conf.ThreatCategories)
+	}()
+
+	func() {
+		d.conf.filtersMu.RLock()
+		defer d.conf.filtersMu.RUnlock()
+
+		for _, f := range d.conf.ThreatFeeds {
+			resp.Feeds = append(resp.Feeds, threatFeedJSON{
+				Category:   f.Category,
+				filterJSON: filterToJSON(f),
+			})
+		}
+	}()
+
+	if resp.Enabled == nil {
+		resp.Enabled = []ThreatCategory{}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// threatFeedsConfigReq is the request for the PUT /control/threat_feeds/config
+// HTTP API.
+type threatFeedsConfigReq struct {
+	Enabled []ThreatCategory `json:"enabled_categories"`
+}
+
+// handleThreatFeedsConfig is the handler for the PUT
+// /control/threat_feeds/config HTTP API.
+func (d *DNSFilter) handleThreatFeedsConfig(w http.ResponseWriter, r *http.Request) {
+	req := &threatFeedsConfigReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = ValidateThreatCategories(req.Enabled)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "enabled_categories: %s", err)
+
+		return
+	}
+
+	func() {
+		d.confMu.Lock()
+		defer d.confMu.Unlock()
+
+		d.conf.ThreatCategories = slices.Clone(req.Enabled)
+	}()
+
+	d.conf.ConfigModified()
+
+	aghhttp.OK(w)
+}
+
+// threatFeedAddReq is the request for the POST /control/threat_feeds/add_url
+// HTTP API.
+type threatFeedAddReq struct {
+	Name     string         `json:"name"`
+	URL      string         `json:"url"`
+	Category ThreatCategory `json:"category"`
+}
+
+// handleThreatFeedsAddURL is the handler for the POST
+// /control/threat_feeds/add_url HTTP API.
+func (d *DNSFilter) handleThreatFeedsAddURL(w http.ResponseWriter, r *http.Request) {
+	req := &threatFeedAddReq{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = req.Category.Validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "category: %s", err)
+
+		return
+	}
+
+	err = validateFilterURL(req.URL)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if d.filterExists(req.URL) {
+		aghhttp.Error(r, w, http.StatusBadRequest, "feed with url %q: %s", req.URL, errFilterExists)
+
+		return
+	}
+
+	flt := FilterYAML{
+		Enabled:  true,
+		URL:      req.URL,
+		Name:     req.Name,
+		Category: req.Category,
+		Filter: Filter{
+			ID: d.idGen.next(),
+		},
+	}
+
+	ok, err := d.update(&flt)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "fetching feed from url %q: %s", flt.URL, err)
+
+		return
+	} else if !ok {
+		aghhttp.Error(r, w, http.StatusBadRequest, "feed with url %q is invalid", flt.URL)
+
+		return
+	}
+
+	err = d.filterAdd(flt)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "feed with url %q: %s", flt.URL, err)
+
+		return
+	}
+
+	d.conf.ConfigModified()
+	d.EnableFilters(true)
+
+	_, err = fmt.Fprintf(w, "OK %d rules\n", flt.RulesCount)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "writing body: %s", err)
+	}
+}
+
+// handleThreatFeedsRemoveURL is the handler for the POST
+// /control/threat_feeds/remove_url HTTP API.
+func (d *DNSFilter) handleThreatFeedsRemoveURL(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		URL string `json:"url"`
+	}
+
+	req := request{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = d.removeThreatFeed(req.URL)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	d.conf.ConfigModified()
+	d.EnableFilters(true)
+
+	aghhttp.OK(w)
+}
+
+// removeThreatFeed removes the threat feed with the given URL from the
+// configuration and renames its file.
+func (d *DNSFilter) removeThreatFeed(u string) (err error) {
+	d.conf.filtersMu.Lock()
+	defer d.conf.filtersMu.Unlock()
+
+	feeds := d.conf.ThreatFeeds
+	delIdx := slices.IndexFunc(feeds, func(flt FilterYAML) bool { return flt.URL == u })
+	if delIdx == -1 {
+		return fmt.Errorf("deleting feed with url %q: %w", u, errFilterNotExist)
+	}
+
+	deleted := feeds[delIdx]
+	p := deleted.Path(d.conf.DataDir)
+	err = os.Rename(p, p+".old")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error("filtering: deleting feed %d: renaming file %q: %s", deleted.ID, p, err)
+	}
+
+	d.conf.ThreatFeeds = slices.Delete(feeds, delIdx, delIdx+1)
+
+	log.Info("filtering: deleted threat feed %d", deleted.ID)
+
+	return nil
+}
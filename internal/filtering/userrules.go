@@ -0,0 +1,151 @@
+package filtering
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// userRulesExpiryIvl is the interval between the checks for expired user
+// rules.
+const userRulesExpiryIvl = 1 * time.Minute
+
+// expiresModifier is the prefix of the modifier of user rules which sets the
+// time after which the rule is removed.  Its value is either a duration, e.g.
+// "expires=2h", or an RFC 3339 timestamp.
+const expiresModifier = "expires="
+
+// splitExpires returns rule without the expires modifier and the raw value of
+// that modifier.  val is empty if rule has no such modifier.
+func splitExpires(rule string) (res, val string) {
+	if rule == "" || rule[0] == '!' || rule[0] == '#' {
+		return rule, ""
+	}
+
+	dollarIdx := strings.LastIndexByte(rule, '$')
+	if dollarIdx == -1 {
+		return rule, ""
+	}
+
+	mods := strings.Split(rule[dollarIdx+1:], ",")
+	modIdx := slices.IndexFunc(mods, func(m string) (ok bool) {
+		return strings.HasPrefix(m, expiresModifier)
+	})
+	if modIdx == -1 {
+		return rule, ""
+	}
+
+	val = mods[modIdx][len(expiresModifier):]
+	mods = slices.Delete(mods, modIdx, modIdx+1)
+	if len(mods) == 0 {
+		return rule[:dollarIdx], val
+	}
+
+	return rule[:dollarIdx+1] + strings.Join(mods, ","), val
+}
+
+// parseExpires parses the value of the expires modifier.  Durations are
+// counted from now.
+func parseExpires(val string, now time.Time) (exp time.Time, err error) {
+	exp, err = time.Parse(time.RFC3339, val)
+	if err == nil {
+		return exp, nil
+	}
+
+	dur, err := time.ParseDuration(val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad %q value %q: want duration or rfc3339 time", expiresModifier, val)
+	} else if dur <= 0 {
+		return time.Time{}, fmt.Errorf("bad %q value %q: must be positive", expiresModifier, val)
+	}
+
+	return now.Add(dur), nil
+}
+
+// resolveUserRulesExpiry returns a copy of rules with the durations in the
+// expires modifiers replaced by the absolute expiration times, so that they
+// survive the restarts.
+func resolveUserRulesExpiry(rules []string, now time.Time) (res []string, err error) {
+	res = make([]string, 0, len(rules))
+	for i, rule := range rules {
+		stripped, val := splitExpires(rule)
+		if val == "" {
+			res = append(res, rule)
+
+			continue
+		}
+
+		var exp time.Time
+		exp, err = parseExpires(val, now)
+		if err != nil {
+			return nil, fmt.Errorf("rule at index %d: %w", i, err)
+		}
+
+		res = append(res, withExpires(stripped, exp))
+	}
+
+	return res, nil
+}
+
+// withExpires returns rule with the expires modifier set to exp.
+func withExpires(rule string, exp time.Time) (res string) {
+	sep := "$"
+	if strings.IndexByte(rule, '$') != -1 {
+		sep = ","
+	}
+
+	return rule + sep + expiresModifier + exp.UTC().Format(time.RFC3339)
+}
+
+// activeUserRules returns the rules that haven't expired by now with the
+// expires modifiers removed, since the filtering engine doesn't support them.
+// rules must be resolved with [resolveUserRulesExpiry].
+func activeUserRules(rules []string, now time.Time) (active []string) {
+	active = make([]string, 0, len(rules))
+	for _, rule := range rules {
+		stripped, val := splitExpires(rule)
+		if val != "" {
+			exp, err := time.Parse(time.RFC3339, val)
+			if err == nil && !now.Before(exp) {
+				continue
+			}
+		}
+
+		active = append(active, stripped)
+	}
+
+	return active
+}
+
+// removeExpiredUserRules removes the expired user rules from the configuration
+// and reloads the filters if there were any.
+func (d *DNSFilter) removeExpiredUserRules() {
+	now := time.Now()
+
+	var removed int
+	func() {
+		d.conf.filtersMu.Lock()
+		defer d.conf.filtersMu.Unlock()
+
+		l := len(d.conf.UserRules)
+		d.conf.UserRules = slices.DeleteFunc(d.conf.UserRules, func(rule string) (ok bool) {
+			_, val := splitExpires(rule)
+			exp, err := time.Parse(time.RFC3339, val)
+
+			return err == nil && !now.Before(exp)
+		})
+		removed = l - len(d.conf.UserRules)
+	}()
+
+	if removed == 0 {
+		return
+	}
+
+	log.Info("filtering: removed %d expired user rules", removed)
+
+	d.conf.ConfigModified()
+	d.EnableFilters(true)
+}
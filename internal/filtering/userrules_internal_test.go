@@ -0,0 +1,87 @@
+package filtering
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveUserRulesExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		in         []string
+		want       []string
+	}{{
+		name:       "no_expires",
+		wantErrMsg: "",
+		in:         []string{"||example.org^", "! comment $expires=1h"},
+		want:       []string{"||example.org^", "! comment $expires=1h"},
+	}, {
+		name:       "duration",
+		wantErrMsg: "",
+		in:         []string{"||example.org^$expires=2h"},
+		want:       []string{"||example.org^$expires=2024-01-01T14:00:00Z"},
+	}, {
+		name:       "duration_with_modifiers",
+		wantErrMsg: "",
+		in:         []string{"||example.org^$important,expires=30m,client=1.2.3.4"},
+		want:       []string{"||example.org^$important,client=1.2.3.4,expires=2024-01-01T12:30:00Z"},
+	}, {
+		name:       "timestamp",
+		wantErrMsg: "",
+		in:         []string{"||example.org^$expires=2024-01-02T00:00:00Z"},
+		want:       []string{"||example.org^$expires=2024-01-02T00:00:00Z"},
+	}, {
+		name: "bad_value",
+		wantErrMsg: `rule at index 0: bad "expires=" value "soon": ` +
+			`want duration or rfc3339 time`,
+		in:   []string{"||example.org^$expires=soon"},
+		want: nil,
+	}, {
+		name:       "negative",
+		wantErrMsg: `rule at index 0: bad "expires=" value "-1h": must be positive`,
+		in:         []string{"||example.org^$expires=-1h"},
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := resolveUserRulesExpiry(tc.in, now)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
+
+func TestActiveUserRules(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	rules, err := resolveUserRulesExpiry([]string{
+		"||permanent.example^",
+		"||active.example^$important,expires=1h",
+		"||expired.example^$expires=2024-01-01T11:00:00Z",
+	}, now)
+	require.NoError(t, err)
+
+	got := activeUserRules(rules, now)
+	assert.Equal(t, []string{
+		"||permanent.example^",
+		"||active.example^$important",
+	}, got)
+
+	got = activeUserRules(rules, now.Add(2*time.Hour))
+	assert.Equal(t, []string{"||permanent.example^"}, got)
+}
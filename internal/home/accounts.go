@@ -0,0 +1,414 @@
+package home
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userRole is the role of a web user, which defines the HTTP APIs the user can
+// use.
+type userRole string
+
+// Supported user roles.  An empty role is considered [userRoleAdmin] for
+// compatibility with the configurations without roles.
+const (
+	// userRoleAdmin can use all the HTTP APIs, including the accounts
+	// management.
+	userRoleAdmin userRole = "admin"
+
+	// userRoleOperator can change the settings, except the accounts, the
+	// encryption settings, and the updates.
+	userRoleOperator userRole = "operator"
+
+	// userRoleViewer can only see the settings, the statistics, and the query
+	// log.
+	userRoleViewer userRole = "viewer"
+)
+
+// validate returns an error if r is not a supported role.
+func (r userRole) validate() (err error) {
+	switch r {
+	case "", userRoleAdmin, userRoleOperator, userRoleViewer:
+		return nil
+	default:
+		return fmt.Errorf("unsupported role %q", r)
+	}
+}
+
+// isAdmin returns true if r is the admin role.
+func (r userRole) isAdmin() (ok bool) {
+	return r == "" || r == userRoleAdmin
+}
+
+// accountsURLPrefix is the prefix of the accounts management HTTP APIs.
+const accountsURLPrefix = "/control/accounts/"
+
+// adminOnlyURLs are the URLs of the HTTP APIs which only the admins can use,
+// besides the accounts management ones.
+var adminOnlyURLs = container.NewMapSet(
+	"/control/backup",
+	"/control/restore",
+	"/control/tls/configure",
+	"/control/update",
+)
+
+// anyRoleURLs are the URLs of the HTTP APIs changing the settings of the user
+// itself, which all the roles can use.
+var anyRoleURLs = container.NewMapSet(
+	"/control/profile/update",
+	"/control/profile/totp/enroll",
+	"/control/profile/totp/confirm",
+	"/control/profile/totp/disable",
+)
+
+// allows returns true if r allows using the HTTP API with method and url.
+func (r userRole) allows(method, url string) (ok bool) {
+	if r.isAdmin() || anyRoleURLs.Has(url) {
+		return true
+	} else if strings.HasPrefix(url, accountsURLPrefix) || adminOnlyURLs.Has(url) {
+		return false
+	}
+
+	return r == userRoleOperator || method == http.MethodGet
+}
+
+// checkRole returns a handler responding with 403 Forbidden, unless the role of
+// the current user allows using the HTTP API with method and url.
+func checkRole(method, url string, h http.HandlerFunc) (wrapped http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !currentUserAllowed(r, method, url) {
+			aghhttp.Error(r, w, http.StatusForbidden, "not allowed for the role of the user")
+
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// currentUserAllowed returns true if the user of r is allowed to use the HTTP
+// API with method and url.
+func currentUserAllowed(r *http.Request, method, url string) (ok bool) {
+	if GLMode || Context.auth == nil || !Context.auth.authRequired() {
+		// The users are either managed elsewhere or not set up.
+		return true
+	}
+
+	if tok, ok := bearerToken(r); ok {
+		t, found := Context.auth.findToken(tok)
+
+		return found && t.allows(method, url)
+	}
+
+	u := Context.auth.getCurrentUser(r)
+	if u.Name == "" {
+		return false
+	}
+
+	return u.Role.allows(method, url)
+}
+
+// validateUsers returns an error if any of users has an invalid role or if
+// none of them is an admin.
+func validateUsers(users []webUser) (err error) {
+	if len(users) == 0 {
+		return nil
+	}
+
+	hasAdmin := false
+	for _, u := range users {
+		err = u.Role.validate()
+		if err != nil {
+			return fmt.Errorf("user %q: %w", u.Name, err)
+		}
+
+		hasAdmin = hasAdmin || u.Role.isAdmin()
+	}
+
+	if !hasAdmin {
+		return errLastAdmin
+	}
+
+	return nil
+}
+
+const (
+	// errUserNotFound is returned when there is no user with the name.
+	errUserNotFound errors.Error = "user not found"
+
+	// errUserExists is returned when a user with the name already exists.
+	errUserExists errors.Error = "user already exists"
+
+	// errLastAdmin is returned when a change would leave no admins.
+	errLastAdmin errors.Error = "at least one admin is required"
+)
+
+// findByNameLocked returns the index of the user with name in a.users or -1.
+// a.lock is expected to be locked.
+func (a *Auth) findByNameLocked(name string) (i int) {
+	for i, u := range a.users {
+		if u.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// hasOtherAdminLocked returns true if a user other than the one with name is an
+// admin.  a.lock is expected to be locked.
+func (a *Auth) hasOtherAdminLocked(name string) (ok bool) {
+	for _, u := range a.users {
+		if u.Name != name && u.Role.isAdmin() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addAccount adds a new user with password and role.
+func (a *Auth) addAccount(name, password string, role userRole) (err error) {
+	if password == "" {
+		return errors.Error("empty password")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("generating hash: %w", err)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.findByNameLocked(name) >= 0 {
+		return errUserExists
+	}
+
+	a.users = append(a.users, webUser{
+		Name:         name,
+		PasswordHash: string(hash),
+		Role:         role,
+	})
+
+	log.Debug("auth: added user with login %q", name)
+
+	return nil
+}
+
+// updateAccount sets the role of the user with name and also its password, if
+// it's not empty.  The sessions of the user are removed, so that the changes
+// take effect.
+func (a *Auth) updateAccount(name, password string, role userRole) (err error) {
+	var hash []byte
+	if password != "" {
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("generating hash: %w", err)
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.findByNameLocked(name)
+	if i < 0 {
+		return errUserNotFound
+	} else if !role.isAdmin() && !a.hasOtherAdminLocked(name) {
+		return errLastAdmin
+	}
+
+	u := &a.users[i]
+	u.Role = role
+	if hash != nil {
+		u.PasswordHash = string(hash)
+	}
+
+	a.removeUserSessionsLocked(name)
+
+	log.Debug("auth: updated user with login %q", name)
+
+	return nil
+}
+
+// removeAccount removes the user with name along with its sessions.
+func (a *Auth) removeAccount(name string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.findByNameLocked(name)
+	if i < 0 {
+		return errUserNotFound
+	} else if !a.hasOtherAdminLocked(name) {
+		return errLastAdmin
+	}
+
+	a.users = slices.Delete(a.users, i, i+1)
+	a.removeUserSessionsLocked(name)
+	delete(a.totpPending, name)
+	delete(a.totpCounters, name)
+
+	log.Debug("auth: removed user with login %q", name)
+
+	return nil
+}
+
+// removeUserSessionsLocked removes the sessions of the user with name from the
+// memory and the database file.  a.lock is expected to be locked.
+func (a *Auth) removeUserSessionsLocked(name string) {
+	for sess, s := range a.sessions {
+		if s.userName != name {
+			continue
+		}
+
+		delete(a.sessions, sess)
+
+		key, _ := hex.DecodeString(sess)
+		a.removeSessionFromFile(key)
+	}
+}
+
+// accountJSON is a single web user in the accounts HTTP API.
+type accountJSON struct {
+	Name string `json:"name"`
+
+	// Password is only set in the requests.  It may be empty in the update
+	// request, in which case the password isn't changed.
+	Password string `json:"password,omitempty"`
+
+	Role userRole `json:"role"`
+}
+
+// accountsListJSON is the response to the GET /control/accounts/list HTTP API.
+type accountsListJSON struct {
+	Accounts []*accountJSON `json:"accounts"`
+}
+
+// handleAccountsList is the handler for the GET /control/accounts/list HTTP
+// API.
+func handleAccountsList(w http.ResponseWriter, r *http.Request) {
+	resp := &accountsListJSON{
+		Accounts: []*accountJSON{},
+	}
+
+	for _, u := range Context.auth.usersList() {
+		role := u.Role
+		if role == "" {
+			role = userRoleAdmin
+		}
+
+		resp.Accounts = append(resp.Accounts, &accountJSON{
+			Name: u.Name,
+			Role: role,
+		})
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// decodeAccount decodes the account from the body of r and validates it.
+func decodeAccount(r *http.Request) (acc *accountJSON, err error) {
+	acc = &accountJSON{}
+	err = json.NewDecoder(r.Body).Decode(acc)
+	if err != nil {
+		return nil, fmt.Errorf("decoding request: %w", err)
+	} else if acc.Name == "" {
+		return nil, errors.Error("name: empty value")
+	}
+
+	err = acc.Role.validate()
+	if err != nil {
+		return nil, fmt.Errorf("role: %w", err)
+	}
+
+	return acc, nil
+}
+
+// handleAccountsAdd is the handler for the POST /control/accounts/add HTTP API.
+func handleAccountsAdd(w http.ResponseWriter, r *http.Request) {
+	acc, err := decodeAccount(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	err = Context.auth.addAccount(acc.Name, acc.Password, acc.Role)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "adding account: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+}
+
+// handleAccountsUpdate is the handler for the POST /control/accounts/update
+// HTTP API.
+func handleAccountsUpdate(w http.ResponseWriter, r *http.Request) {
+	acc, err := decodeAccount(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	err = Context.auth.updateAccount(acc.Name, acc.Password, acc.Role)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "updating account: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+}
+
+// accountNameJSON is the request to the POST /control/accounts/delete HTTP
+// API.
+type accountNameJSON struct {
+	Name string `json:"name"`
+}
+
+// handleAccountsDelete is the handler for the POST /control/accounts/delete
+// HTTP API.
+func handleAccountsDelete(w http.ResponseWriter, r *http.Request) {
+	req := &accountNameJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = Context.auth.removeAccount(req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "deleting account: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+}
+
+// registerAccountsHandlers registers the HTTP handlers of the accounts
+// management.
+func registerAccountsHandlers() {
+	httpRegister(http.MethodGet, accountsURLPrefix+"list", handleAccountsList)
+	httpRegister(http.MethodPost, accountsURLPrefix+"add", handleAccountsAdd)
+	httpRegister(http.MethodPost, accountsURLPrefix+"update", handleAccountsUpdate)
+	httpRegister(http.MethodPost, accountsURLPrefix+"delete", handleAccountsDelete)
+	httpRegister(http.MethodPost, accountsURLPrefix+"totp/reset", handleAccountsTOTPReset)
+	httpRegister(http.MethodGet, accountsURLPrefix+"tokens/list", handleTokensList)
+	httpRegister(http.MethodPost, accountsURLPrefix+"tokens/add", handleTokensAdd)
+	httpRegister(http.MethodPost, accountsURLPrefix+"tokens/revoke", handleTokensRevoke)
+}
@@ -0,0 +1,148 @@
+package home
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRole_Allows(t *testing.T) {
+	testCases := []struct {
+		role   userRole
+		name   string
+		method string
+		url    string
+		want   bool
+	}{{
+		role:   "",
+		name:   "empty_accounts",
+		method: http.MethodPost,
+		url:    "/control/accounts/add",
+		want:   true,
+	}, {
+		role:   userRoleAdmin,
+		name:   "admin_tls",
+		method: http.MethodPost,
+		url:    "/control/tls/configure",
+		want:   true,
+	}, {
+		role:   userRoleOperator,
+		name:   "operator_settings",
+		method: http.MethodPost,
+		url:    "/control/filtering/add_url",
+		want:   true,
+	}, {
+		role:   userRoleOperator,
+		name:   "operator_tls",
+		method: http.MethodPost,
+		url:    "/control/tls/configure",
+		want:   false,
+	}, {
+		role:   userRoleOperator,
+		name:   "operator_accounts",
+		method: http.MethodGet,
+		url:    "/control/accounts/list",
+		want:   false,
+	}, {
+		role:   userRoleViewer,
+		name:   "viewer_backup",
+		method: http.MethodGet,
+		url:    "/control/backup",
+		want:   false,
+	}, {
+		role:   userRoleViewer,
+		name:   "viewer_stats",
+		method: http.MethodGet,
+		url:    "/control/stats",
+		want:   true,
+	}, {
+		role:   userRoleViewer,
+		name:   "viewer_settings",
+		method: http.MethodPost,
+		url:    "/control/filtering/add_url",
+		want:   false,
+	}, {
+		role:   userRoleViewer,
+		name:   "viewer_profile",
+		method: http.MethodPut,
+		url:    "/control/profile/update",
+		want:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.role.allows(tc.method, tc.url))
+		})
+	}
+}
+
+func TestAuth_Accounts(t *testing.T) {
+	a := InitAuth(filepath.Join(t.TempDir(), "sessions.db"), nil, 60, nil, nil)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	require.NoError(t, a.addAccount("admin", "password", userRoleAdmin))
+	require.NoError(t, a.addAccount("viewer", "password", userRoleViewer))
+
+	err := a.addAccount("viewer", "password", userRoleViewer)
+	assert.ErrorIs(t, err, errUserExists)
+
+	err = a.updateAccount("admin", "", userRoleOperator)
+	assert.ErrorIs(t, err, errLastAdmin)
+
+	err = a.removeAccount("admin")
+	assert.ErrorIs(t, err, errLastAdmin)
+
+	err = a.removeAccount("none")
+	assert.ErrorIs(t, err, errUserNotFound)
+
+	sess, err := newSessionToken()
+	require.NoError(t, err)
+
+	a.addSession(sess, &session{userName: "viewer", expire: 1 << 31})
+
+	require.NoError(t, a.updateAccount("viewer", "new_password", userRoleOperator))
+	assert.Empty(t, a.sessions)
+
+	u, ok := a.findUser("viewer", "new_password")
+	require.True(t, ok)
+
+	assert.Equal(t, userRoleOperator, u.Role)
+
+	require.NoError(t, a.removeAccount("viewer"))
+	assert.Len(t, a.usersList(), 1)
+}
+
+func TestValidateUsers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		users      []webUser
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		users:      nil,
+	}, {
+		name:       "no_role",
+		wantErrMsg: "",
+		users:      []webUser{{Name: "user"}},
+	}, {
+		name:       "bad_role",
+		wantErrMsg: `user "user": unsupported role "root"`,
+		users:      []webUser{{Name: "user", Role: "root"}},
+	}, {
+		name:       "no_admin",
+		wantErrMsg: "at least one admin is required",
+		users:      []webUser{{Name: "user", Role: userRoleViewer}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, validateUsers(tc.users))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package home
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// acmeConfig is the configuration of obtaining and renewing the TLS
+// certificate with ACME.
+type acmeConfig struct {
+	// DNSProviderParams are the parameters of the DNS provider, for example the
+	// path to the program for the "exec" one.  These may contain secrets, so
+	// they're never sent to the frontend.
+	DNSProviderParams map[string]string `yaml:"dns_provider_params" json:"-"`
+
+	// DirectoryURL is the ACME directory URL of the certificate authority.  If
+	// it's empty, Let's Encrypt is used.
+	DirectoryURL string `yaml:"directory_url" json:"directory_url"`
+
+	// Email is the contact address of the account, if any.
+	Email string `yaml:"email" json:"email"`
+
+	// EABKeyID is the key identifier of the external account binding.
+	EABKeyID string `yaml:"eab_key_id" json:"-"`
+
+	// EABHMACKey is the base64url-encoded MAC key of the external account
+	// binding.
+	EABHMACKey string `yaml:"eab_hmac_key" json:"-"`
+
+	// Challenge is the type of the challenge, either "http-01" or "dns-01".
+	Challenge aghacme.ChallengeType `yaml:"challenge" json:"challenge"`
+
+	// DNSProvider is the name of the DNS provider for the "dns-01" challenge.
+	DNSProvider string `yaml:"dns_provider" json:"dns_provider"`
+
+	// Domains are the domain names the certificate is issued for.  If it's
+	// empty, the server name is used.
+	Domains []string `yaml:"domains" json:"domains"`
+
+	// DNSPropagationDelay is the time to wait for the challenge records to
+	// propagate.
+	DNSPropagationDelay timeutil.Duration `yaml:"dns_propagation_delay" json:"-"`
+
+	// RenewBefore is the time before the expiration of the certificate it's
+	// renewed at.  If it's zero, the certificate is renewed 30 days before.
+	RenewBefore timeutil.Duration `yaml:"renew_before" json:"-"`
+
+	// Enabled defines if the certificate is obtained with ACME.  In that case
+	// the certificate and the private key set manually are ignored.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+// acmeDir returns the directory the ACME account key and the certificate are
+// stored in.
+func acmeDir() (dir string) {
+	return filepath.Join(Context.getDataDir(), "acme")
+}
+
+// setACMEPaths replaces the certificate and the private key in conf with the
+// files of the ACME certificate, if ACME is enabled.  ok is true if it is.
+func setACMEPaths(conf *tlsConfigSettings) (ok bool) {
+	if conf.ACME == nil || !conf.ACME.Enabled {
+		return false
+	}
+
+	dir := acmeDir()
+	conf.CertificateChain, conf.PrivateKey = "", ""
+	conf.CertificatePath = filepath.Join(dir, aghacme.CertFileName)
+	conf.PrivateKeyPath = filepath.Join(dir, aghacme.KeyFileName)
+
+	return true
+}
+
+// newACMEManager returns a new manager of the ACME certificate, if ACME is
+// enabled in conf.
+func newACMEManager(conf *tlsConfigSettings) (m *aghacme.Manager, err error) {
+	acmeConf := conf.ACME
+	if acmeConf == nil || !acmeConf.Enabled {
+		return nil, nil
+	}
+
+	var provider aghacme.DNSProvider
+	if acmeConf.Challenge == aghacme.ChallengeDNS01 {
+		provider, err = aghacme.NewDNSProvider(
+			acmeConf.DNSProvider,
+			acmeConf.DNSProviderParams,
+			httpClient(),
+		)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	domains := acmeConf.Domains
+	if len(domains) == 0 && conf.ServerName != "" {
+		domains = []string{conf.ServerName}
+	}
+
+	return aghacme.NewManager(&aghacme.Config{
+		OnCertificate:       Context.tls.setACMECert,
+		HTTPClient:          httpClient(),
+		DNSProvider:         provider,
+		DirectoryURL:        acmeConf.DirectoryURL,
+		Email:               acmeConf.Email,
+		EABKeyID:            acmeConf.EABKeyID,
+		EABHMACKey:          acmeConf.EABHMACKey,
+		Dir:                 acmeDir(),
+		Domains:             domains,
+		Challenge:           acmeConf.Challenge,
+		DNSPropagationDelay: acmeConf.DNSPropagationDelay.Duration,
+		RenewBefore:         acmeConf.RenewBefore.Duration,
+	})
+}
+
+// handleACMEChallenge serves the responses to the HTTP-01 challenges of the
+// ACME certificate authority.
+func handleACMEChallenge(w http.ResponseWriter, r *http.Request) {
+	if Context.acme == nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	Context.acme.ServeHTTP(w, r)
+}
@@ -0,0 +1,326 @@
+package home
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// tokenScope is a scope of an API token, which defines the HTTP APIs the token
+// can be used with.
+type tokenScope string
+
+// Supported token scopes.
+const (
+	// tokenScopeRead allows all the GET HTTP APIs.
+	tokenScopeRead tokenScope = "read"
+
+	// tokenScopeWrite allows all the HTTP APIs the operators can use.
+	tokenScopeWrite tokenScope = "write"
+
+	// tokenScopeStats allows the GET HTTP APIs of the statistics.
+	tokenScopeStats tokenScope = "stats"
+
+	// tokenScopeQueryLog allows the GET HTTP APIs of the query log.
+	tokenScopeQueryLog tokenScope = "querylog"
+
+	// tokenScopeMetrics allows the metrics endpoint.
+	tokenScopeMetrics tokenScope = "metrics"
+)
+
+// validate returns an error if s is not a supported scope.
+func (s tokenScope) validate() (err error) {
+	switch s {
+	case tokenScopeRead, tokenScopeWrite, tokenScopeStats, tokenScopeQueryLog, tokenScopeMetrics:
+		return nil
+	default:
+		return fmt.Errorf("unsupported scope %q", s)
+	}
+}
+
+// allows returns true if s allows using the HTTP API with method and url.  The
+// accounts management and the other admin-only HTTP APIs are never allowed.
+func (s tokenScope) allows(method, url string) (ok bool) {
+	if strings.HasPrefix(url, accountsURLPrefix) || adminOnlyURLs.Has(url) {
+		return false
+	} else if s == tokenScopeWrite {
+		return userRoleOperator.allows(method, url)
+	} else if method != http.MethodGet {
+		return false
+	}
+
+	switch s {
+	case tokenScopeRead:
+		return true
+	case tokenScopeStats:
+		return strings.HasPrefix(url, "/control/stats")
+	case tokenScopeQueryLog:
+		return strings.HasPrefix(url, "/control/querylog")
+	case tokenScopeMetrics:
+		return url == "/metrics"
+	default:
+		return false
+	}
+}
+
+// apiToken is a long-lived token for using the HTTP API without the password.
+// The token itself is only known to its user, only its hash is stored.
+type apiToken struct {
+	// CreatedAt is the time the token has been created at.
+	CreatedAt time.Time `yaml:"created_at"`
+
+	// Name is the unique name of the token.
+	Name string `yaml:"name"`
+
+	// Hash is the hex-encoded SHA-256 hash of the token.
+	Hash string `yaml:"hash"`
+
+	// Scopes are the scopes of the token.  It must not be empty.
+	Scopes []tokenScope `yaml:"scopes"`
+}
+
+// allows returns true if any of the scopes of t allows using the HTTP API with
+// method and url.
+func (t *apiToken) allows(method, url string) (ok bool) {
+	return slices.ContainsFunc(t.Scopes, func(s tokenScope) (ok bool) {
+		return s.allows(method, url)
+	})
+}
+
+// validateScopes returns an error if scopes are empty or contain an
+// unsupported scope.
+func validateScopes(scopes []tokenScope) (err error) {
+	if len(scopes) == 0 {
+		return errors.Error("scopes: empty value")
+	}
+
+	for i, s := range scopes {
+		err = s.validate()
+		if err != nil {
+			return fmt.Errorf("scopes: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateAPITokens returns an error if any of tokens is invalid.
+func validateAPITokens(tokens []apiToken) (err error) {
+	names := map[string]struct{}{}
+	for _, t := range tokens {
+		if _, ok := names[t.Name]; ok {
+			return fmt.Errorf("token %q: duplicate name", t.Name)
+		}
+
+		names[t.Name] = struct{}{}
+
+		err = validateScopes(t.Scopes)
+		if err != nil {
+			return fmt.Errorf("token %q: %w", t.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// apiTokenSize is the length of an API token in bytes.
+const apiTokenSize = 32
+
+// hashSecret returns the hex-encoded SHA-256 hash of tok.
+func hashSecret(tok string) (hash string) {
+	sum := sha256.Sum256([]byte(tok))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the bearer token from the Authorization header of r, if
+// any.
+func bearerToken(r *http.Request) (tok string, ok bool) {
+	const prefix = "Bearer "
+
+	h := r.Header.Get(httphdr.Authorization)
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	return h[len(prefix):], true
+}
+
+// findToken returns the API token with the value tok, if there is one.
+func (a *Auth) findToken(tok string) (t apiToken, ok bool) {
+	hash := []byte(hashSecret(tok))
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, t = range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), hash) == 1 {
+			return t, true
+		}
+	}
+
+	return apiToken{}, false
+}
+
+// addToken generates a new API token with name and scopes and returns its
+// value.
+func (a *Auth) addToken(name string, scopes []tokenScope) (tok string, err error) {
+	data := make([]byte, apiTokenSize)
+	_, err = rand.Read(data)
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	tok = hex.EncodeToString(data)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if slices.ContainsFunc(a.tokens, func(t apiToken) (ok bool) { return t.Name == name }) {
+		return "", fmt.Errorf("token %q already exists", name)
+	}
+
+	a.tokens = append(a.tokens, apiToken{
+		CreatedAt: time.Now(),
+		Name:      name,
+		Hash:      hashSecret(tok),
+		Scopes:    scopes,
+	})
+
+	log.Debug("auth: added api token %q", name)
+
+	return tok, nil
+}
+
+// revokeToken removes the API token with name.
+func (a *Auth) revokeToken(name string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := slices.IndexFunc(a.tokens, func(t apiToken) (ok bool) { return t.Name == name })
+	if i < 0 {
+		return fmt.Errorf("token %q not found", name)
+	}
+
+	a.tokens = slices.Delete(a.tokens, i, i+1)
+
+	log.Debug("auth: revoked api token %q", name)
+
+	return nil
+}
+
+// tokensList returns a copy of the API tokens list.
+func (a *Auth) tokensList() (tokens []apiToken) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return slices.Clone(a.tokens)
+}
+
+// apiTokenJSON is a single API token in the tokens HTTP API.
+type apiTokenJSON struct {
+	// CreatedAt is only set in the responses.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	Name string `json:"name"`
+
+	// Token is only set in the response to the add request.
+	Token string `json:"token,omitempty"`
+
+	Scopes []tokenScope `json:"scopes"`
+}
+
+// apiTokensListJSON is the response to the GET /control/accounts/tokens/list
+// HTTP API.
+type apiTokensListJSON struct {
+	Tokens []*apiTokenJSON `json:"tokens"`
+}
+
+// handleTokensList is the handler for the GET /control/accounts/tokens/list
+// HTTP API.
+func handleTokensList(w http.ResponseWriter, r *http.Request) {
+	resp := &apiTokensListJSON{
+		Tokens: []*apiTokenJSON{},
+	}
+
+	for _, t := range Context.auth.tokensList() {
+		resp.Tokens = append(resp.Tokens, &apiTokenJSON{
+			CreatedAt: &t.CreatedAt,
+			Name:      t.Name,
+			Scopes:    t.Scopes,
+		})
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleTokensAdd is the handler for the POST /control/accounts/tokens/add HTTP
+// API.  The response contains the token, which can't be retrieved later.
+func handleTokensAdd(w http.ResponseWriter, r *http.Request) {
+	req := &apiTokenJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	} else if req.Name == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "name: empty value")
+
+		return
+	}
+
+	err = validateScopes(req.Scopes)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	tok, err := Context.auth.addToken(req.Name, req.Scopes)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "adding token: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+
+	aghhttp.WriteJSONResponseOK(w, r, &apiTokenJSON{
+		Name:   req.Name,
+		Token:  tok,
+		Scopes: req.Scopes,
+	})
+}
+
+// handleTokensRevoke is the handler for the POST
+// /control/accounts/tokens/revoke HTTP API.
+func handleTokensRevoke(w http.ResponseWriter, r *http.Request) {
+	req := &accountNameJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = Context.auth.revokeToken(req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "revoking token: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+}
@@ -0,0 +1,117 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIToken_Allows(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		url    string
+		scopes []tokenScope
+		want   bool
+	}{{
+		name:   "stats",
+		method: http.MethodGet,
+		url:    "/control/stats",
+		scopes: []tokenScope{tokenScopeStats},
+		want:   true,
+	}, {
+		name:   "stats_reset",
+		method: http.MethodPost,
+		url:    "/control/stats_reset",
+		scopes: []tokenScope{tokenScopeStats},
+		want:   false,
+	}, {
+		name:   "stats_querylog",
+		method: http.MethodGet,
+		url:    "/control/querylog",
+		scopes: []tokenScope{tokenScopeStats},
+		want:   false,
+	}, {
+		name:   "several",
+		method: http.MethodGet,
+		url:    "/metrics",
+		scopes: []tokenScope{tokenScopeStats, tokenScopeMetrics},
+		want:   true,
+	}, {
+		name:   "read",
+		method: http.MethodGet,
+		url:    "/control/status",
+		scopes: []tokenScope{tokenScopeRead},
+		want:   true,
+	}, {
+		name:   "read_accounts",
+		method: http.MethodGet,
+		url:    "/control/accounts/list",
+		scopes: []tokenScope{tokenScopeRead},
+		want:   false,
+	}, {
+		name:   "read_backup",
+		method: http.MethodGet,
+		url:    "/control/backup",
+		scopes: []tokenScope{tokenScopeRead},
+		want:   false,
+	}, {
+		name:   "write",
+		method: http.MethodPost,
+		url:    "/control/filtering/refresh",
+		scopes: []tokenScope{tokenScopeWrite},
+		want:   true,
+	}, {
+		name:   "write_tokens",
+		method: http.MethodPost,
+		url:    "/control/accounts/tokens/add",
+		scopes: []tokenScope{tokenScopeWrite},
+		want:   false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tok := &apiToken{Scopes: tc.scopes}
+			assert.Equal(t, tc.want, tok.allows(tc.method, tc.url))
+		})
+	}
+}
+
+func TestAuth_Tokens(t *testing.T) {
+	a := InitAuth(filepath.Join(t.TempDir(), "sessions.db"), nil, 60, nil, nil)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	tok, err := a.addToken("scraper", []tokenScope{tokenScopeMetrics})
+	require.NoError(t, err)
+
+	_, err = a.addToken("scraper", []tokenScope{tokenScopeRead})
+	assert.Error(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set(httphdr.Authorization, "Bearer "+tok)
+
+	got, ok := bearerToken(r)
+	require.True(t, ok)
+
+	found, ok := a.findToken(got)
+	require.True(t, ok)
+
+	assert.Equal(t, "scraper", found.Name)
+	assert.NotContains(t, found.Hash, tok)
+
+	_, ok = a.findToken("bad")
+	assert.False(t, ok)
+
+	require.NoError(t, a.revokeToken("scraper"))
+
+	_, ok = a.findToken(tok)
+	assert.False(t, ok)
+
+	assert.Error(t, a.revokeToken("scraper"))
+}
@@ -59,8 +59,17 @@ type Auth struct {
 	rateLimiter    *authRateLimiter
 	sessions       map[string]*session
 	users          []webUser
+	tokens         []apiToken
 	lock           sync.Mutex
 	sessionTTL     uint32
+
+	// totpPending are the TOTP secrets of the users, which haven't been
+	// confirmed yet, by the names of the users.
+	totpPending map[string]string
+
+	// totpCounters are the time step counters of the last accepted TOTP codes
+	// by the names of the users.
+	totpCounters map[string]uint64
 }
 
 // webUser represents a user of the Web UI.
@@ -69,6 +78,19 @@ type Auth struct {
 type webUser struct {
 	Name         string `yaml:"name"`
 	PasswordHash string `yaml:"password"`
+
+	// Role defines the HTTP APIs the user can use.  An empty role is the admin
+	// one.
+	Role userRole `yaml:"role,omitempty"`
+
+	// TOTPSecret is the base32-encoded secret of the two-factor
+	// authentication.  If it's empty, the two-factor authentication is
+	// disabled for the user.
+	TOTPSecret string `yaml:"totp_secret,omitempty"`
+
+	// TOTPRecoveryCodes are the hex-encoded SHA-256 hashes of the unused
+	// recovery codes.
+	TOTPRecoveryCodes []string `yaml:"totp_recovery_codes,omitempty"`
 }
 
 // InitAuth initializes the global authentication object.
@@ -87,6 +109,8 @@ func InitAuth(
 		sessions:       make(map[string]*session),
 		users:          users,
 		trustedProxies: trustedProxies,
+		totpPending:    map[string]string{},
+		totpCounters:   map[string]uint64{},
 	}
 	var err error
 	a.db, err = bbolt.Open(dbFilename, 0o644, nil)
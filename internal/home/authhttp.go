@@ -29,6 +29,10 @@ const sessionCookieName = "agh_session"
 type loginJSON struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
+
+	// TOTP is the two-factor authentication code or a recovery code.  It's
+	// only required for the users with the two-factor authentication enabled.
+	TOTP string `json:"totp"`
 }
 
 // newCookie creates a new authentication cookie.
@@ -43,6 +47,21 @@ func (a *Auth) newCookie(req loginJSON, addr string) (c *http.Cookie, err error)
 		return nil, errors.Error("invalid username or password")
 	}
 
+	if u.TOTPSecret != "" {
+		var usedRecovery bool
+		usedRecovery, err = a.checkSecondFactor(u.Name, req.TOTP, time.Now())
+		if err != nil {
+			if rateLimiter != nil && !errors.Is(err, errTOTPRequired) {
+				rateLimiter.inc(addr)
+			}
+
+			// Don't wrap the error, since the frontend expects it as is.
+			return nil, err
+		} else if usedRecovery {
+			onConfigModified()
+		}
+	}
+
 	if rateLimiter != nil {
 		rateLimiter.remove(addr)
 	}
@@ -183,6 +202,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 			logIP = ip.String()
 		}
 
+		notifyAuthFailed(req.Name, logIP)
 		writeErrorWithIP(r, w, http.StatusForbidden, logIP, "%s", err)
 
 		return
@@ -249,14 +269,28 @@ func optionalAuthThird(w http.ResponseWriter, r *http.Request) (mustAuth bool) {
 	// redirect to login page if not authenticated
 	isAuthenticated := false
 	cookie, err := r.Cookie(sessionCookieName)
-	if err != nil {
+	if tok, ok := bearerToken(r); ok {
+		var t apiToken
+		t, isAuthenticated = Context.auth.findToken(tok)
+		if isAuthenticated && !t.allows(r.Method, r.URL.Path) {
+			log.Info("%s: api token %q not allowed for %s %s", pref, t.Name, r.Method, r.URL.Path)
+			isAuthenticated = false
+		} else if !isAuthenticated {
+			log.Info("%s: invalid api token", pref)
+		}
+	} else if err != nil {
 		// The only error that is returned from r.Cookie is [http.ErrNoCookie].
 		// Check Basic authentication.
 		user, pass, hasBasic := r.BasicAuth()
 		if hasBasic {
-			_, isAuthenticated = Context.auth.findUser(user, pass)
+			var u webUser
+			u, isAuthenticated = Context.auth.findUser(user, pass)
 			if !isAuthenticated {
 				log.Info("%s: invalid basic authorization value", pref)
+			} else if u.TOTPSecret != "" {
+				// Basic authentication would bypass the second factor.
+				log.Info("%s: basic authorization for user %q with two-factor authentication", pref, user)
+				isAuthenticated = false
 			}
 		}
 	} else {
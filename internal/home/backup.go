@@ -0,0 +1,582 @@
+package home
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/c2h5oh/datasize"
+)
+
+// Names of the entries of the backup archive.  The data files have the same
+// names regardless of the directories they're stored in, so that the archive
+// could be restored on another host.
+const (
+	backupManifestName = "manifest.json"
+	backupConfigName   = "AdGuardHome.yaml"
+	backupLeasesName   = "data/leases.json"
+	backupStatsName    = "data/stats.db"
+	backupQueryLogName = "data/querylog.json"
+
+	// backupQueryLogRotatedName is the name of the rotated query log file.
+	backupQueryLogRotatedName = backupQueryLogName + ".1"
+
+	// backupIncludeDir is the directory of the included configuration files,
+	// which are stored under their paths relative to the directory of the main
+	// configuration file.
+	backupIncludeDir = "include"
+)
+
+// maxBackupDataSize is the maximum total size of the decompressed entries of a
+// restored backup archive.
+const maxBackupDataSize = 4 * datasize.GB
+
+// errBackupTooLarge is returned when the decompressed entries of a restored
+// backup archive exceed [maxBackupDataSize].
+const errBackupTooLarge errors.Error = "backup archive is too large"
+
+// backupFiltersRe matches the names of the filter list files in the backup
+// archive.
+var backupFiltersRe = regexp.MustCompile(`^data/filters/[0-9]+\.txt$`)
+
+// backupManifest is the description of the backup archive.
+type backupManifest struct {
+	// CreatedAt is the time the archive has been created at.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Version is the version of AdGuard Home which created the archive.
+	Version string `json:"version"`
+
+	// Files are the names of the other entries of the archive.
+	Files []string `json:"files"`
+}
+
+// backupPaths returns the local paths of the entries of the backup archive by
+// their names, except the filter lists.  statsDir and querylogDir are the
+// directories of the statistics and the query log.
+func backupPaths(statsDir, querylogDir string) (paths map[string]string) {
+	dataDir := Context.getDataDir()
+
+	return map[string]string{
+		backupConfigName:          configFilePath(),
+		backupLeasesName:          filepath.Join(dataDir, filepath.Base(backupLeasesName)),
+		backupStatsName:           filepath.Join(statsDir, filepath.Base(backupStatsName)),
+		backupQueryLogName:        filepath.Join(querylogDir, filepath.Base(backupQueryLogName)),
+		backupQueryLogRotatedName: filepath.Join(querylogDir, filepath.Base(backupQueryLogRotatedName)),
+	}
+}
+
+// backupFiltersPath returns the local path of the filter list file with name.
+func backupFiltersPath(name string) (p string) {
+	return filepath.Join(Context.getDataDir(), filepath.FromSlash(name[len("data/"):]))
+}
+
+// backupIncludeNames returns the names of the entries of the backup archive
+// for the included configuration files matching patterns and adds their local
+// paths to paths.  The files outside of confDir are skipped, since they
+// couldn't be restored on another host.
+func backupIncludeNames(
+	confDir string,
+	patterns []string,
+	paths map[string]string,
+) (names []string, err error) {
+	files, err := includedFiles(confDir, patterns)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	for _, f := range files {
+		rel, relErr := filepath.Rel(confDir, f)
+		if relErr != nil || !filepath.IsLocal(rel) {
+			log.Info("backup: skipping included file %q outside of %q", f, confDir)
+
+			continue
+		}
+
+		name := path.Join(backupIncludeDir, filepath.ToSlash(rel))
+		names = append(names, name)
+		paths[name] = f
+	}
+
+	return names, nil
+}
+
+// isBackupIncludeName returns true if name is a valid name of an included
+// configuration file in the backup archive.
+func isBackupIncludeName(name string) (ok bool) {
+	rel, ok := strings.CutPrefix(name, backupIncludeDir+"/")
+
+	return ok && path.Clean(rel) == rel && filepath.IsLocal(filepath.FromSlash(rel))
+}
+
+// writeBackup writes the backup archive to w.  The statistics and the query
+// log are only included if withStats and withQueryLog are true respectively.
+func writeBackup(w io.Writer, withStats, withQueryLog bool) (err error) {
+	var statsDir, querylogDir string
+	var includes []string
+	func() {
+		config.RLock()
+		defer config.RUnlock()
+
+		includes = slices.Clone(config.Include)
+		statsDir, querylogDir, err = checkStatsAndQuerylogDirs(&Context, config)
+	}()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	paths := backupPaths(statsDir, querylogDir)
+	names := []string{backupConfigName, backupLeasesName}
+
+	incNames, err := backupIncludeNames(filepath.Dir(configFilePath()), includes, paths)
+	if err != nil {
+		return fmt.Errorf("listing included files: %w", err)
+	}
+
+	names = append(names, incNames...)
+	if withStats {
+		names = append(names, backupStatsName)
+	}
+
+	if withQueryLog {
+		names = append(names, backupQueryLogName, backupQueryLogRotatedName)
+	}
+
+	filters, err := filepath.Glob(filepath.Join(Context.getDataDir(), "filters", "*.txt"))
+	if err != nil {
+		return fmt.Errorf("listing filters: %w", err)
+	}
+
+	for _, f := range filters {
+		name := path.Join("data", "filters", filepath.Base(f))
+		if backupFiltersRe.MatchString(name) {
+			names = append(names, name)
+			paths[name] = f
+		}
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	manifest := &backupManifest{
+		CreatedAt: time.Now().UTC(),
+		Version:   version.Version(),
+		Files:     []string{},
+	}
+
+	for _, name := range names {
+		var ok bool
+		ok, err = addBackupFile(tw, name, paths[name])
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", name, err)
+		} else if ok {
+			manifest.Files = append(manifest.Files, name)
+		}
+	}
+
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    backupManifestName,
+		Mode:    0o644,
+		Size:    int64(len(b)),
+		ModTime: manifest.CreatedAt,
+	})
+	if err == nil {
+		_, err = tw.Write(b)
+	}
+
+	if err != nil {
+		return fmt.Errorf("adding manifest: %w", err)
+	}
+
+	return errors.Join(tw.Close(), gw.Close())
+}
+
+// addBackupFile adds the file at p to tw as name.  ok is false if the file
+// doesn't exist.
+func addBackupFile(tw *tar.Writer, name, p string) (ok bool, err error) {
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("writing header: %w", err)
+	}
+
+	// Copy exactly the size from the header, since the file, for example the
+	// query log, may grow meanwhile.
+	_, err = io.CopyN(tw, f, fi.Size())
+	if err != nil {
+		return false, fmt.Errorf("copying: %w", err)
+	}
+
+	return true, nil
+}
+
+// validBackupName returns true if name is a supported entry of the backup
+// archive.
+func validBackupName(name string) (ok bool) {
+	switch name {
+	case
+		backupManifestName,
+		backupConfigName,
+		backupLeasesName,
+		backupStatsName,
+		backupQueryLogName,
+		backupQueryLogRotatedName:
+		return true
+	default:
+		return backupFiltersRe.MatchString(name) || isBackupIncludeName(name)
+	}
+}
+
+// extractBackup extracts the backup archive from r into dir and returns the
+// names of the extracted entries.  It returns [errBackupTooLarge] if the total
+// size of the entries exceeds maxSize.
+func extractBackup(r io.Reader, dir string, maxSize datasize.ByteSize) (names []string, err error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip: %w", err)
+	}
+
+	tr := tar.NewReader(gr)
+
+	// lr limits the total size of the extracted data, including the entries
+	// which sizes in the headers don't match their contents.
+	lr := &io.LimitedReader{R: tr, N: int64(maxSize.Bytes())}
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading tar: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !validBackupName(hdr.Name) {
+			return nil, fmt.Errorf("unexpected entry %q", hdr.Name)
+		}
+
+		if hdr.Size > lr.N {
+			err = fmt.Errorf("%w: more than %s", errBackupTooLarge, maxSize)
+
+			return nil, fmt.Errorf("extracting %s: %w", hdr.Name, err)
+		}
+
+		err = extractBackupFile(lr, filepath.Join(dir, filepath.FromSlash(hdr.Name)))
+		if err != nil {
+			return nil, fmt.Errorf("extracting %s: %w", hdr.Name, err)
+		}
+
+		names = append(names, hdr.Name)
+	}
+
+	return names, nil
+}
+
+// extractBackupFile writes the contents of r to the new file at p.
+func extractBackupFile(r io.Reader, p string) (err error) {
+	err = os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	_, err = io.Copy(f, r)
+
+	// Don't wrap the error since it's informative enough as is.
+	return err
+}
+
+// validateBackup checks the extracted backup archive in dir with the entries
+// names and returns the local paths of the entries by their extracted paths.
+func validateBackup(dir string, names []string) (moves map[string]string, err error) {
+	b, err := os.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	manifest := &backupManifest{}
+	err = json.Unmarshal(b, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+
+	confData, err := os.ReadFile(filepath.Join(dir, backupConfigName))
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration: %w", err)
+	}
+
+	// Use the temporary directory as the working one, so that the migrations
+	// don't change the current data.
+	migrator := configmigrate.New(&configmigrate.Config{
+		WorkingDir: dir,
+	})
+
+	confData, _, err = migrator.Migrate(confData, configmigrate.LastSchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("migrating configuration: %w", err)
+	}
+
+	// Decode the configuration the same way it's decoded on start, so that the
+	// restored included files are merged and the references are expanded.
+	confDir := filepath.Dir(configFilePath())
+	incDir := filepath.Join(dir, backupIncludeDir)
+	conf := &configuration{}
+	err = conf.decodeConfigIncluding(confData, confDir, incDir)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	// Only restore the included files the restored configuration uses.
+	incFiles, err := includedFiles(incDir, conf.Include)
+	if err != nil {
+		return nil, fmt.Errorf("configuration: %w", err)
+	}
+
+	err = validateUsers(conf.Users)
+	if err != nil {
+		return nil, fmt.Errorf("configuration: %w", err)
+	}
+
+	statsDir, querylogDir, err := checkStatsAndQuerylogDirs(&Context, conf)
+	if err != nil {
+		return nil, fmt.Errorf("configuration: %w", err)
+	}
+
+	paths := backupPaths(statsDir, querylogDir)
+	moves = map[string]string{}
+	for _, name := range names {
+		src := filepath.Join(dir, filepath.FromSlash(name))
+
+		dst, ok := paths[name]
+		switch {
+		case ok:
+			// Go on.
+		case name == backupManifestName:
+			continue
+		case isBackupIncludeName(name):
+			if !slices.Contains(incFiles, src) {
+				log.Info("restore: skipping unused included file %q", name)
+
+				continue
+			}
+
+			rel := strings.TrimPrefix(name, backupIncludeDir+"/")
+			dst = filepath.Join(confDir, filepath.FromSlash(rel))
+		default:
+			dst = backupFiltersPath(name)
+		}
+
+		moves[src] = dst
+	}
+
+	return moves, nil
+}
+
+// finishRestore stops all the tasks, moves the restored files from the
+// temporary directory dir to their places according to moves, and restarts
+// the process.
+func finishRestore(
+	ctx context.Context,
+	dir string,
+	moves map[string]string,
+	execPath string,
+	runningAsService bool,
+) {
+	log.Info("restore: stopping all tasks")
+
+	restart(ctx, execPath, runningAsService, func() {
+		for src, dst := range moves {
+			err := moveFile(src, dst)
+			if err != nil {
+				log.Error("restore: moving %q to %q: %s", src, dst, err)
+			}
+		}
+
+		err := os.RemoveAll(dir)
+		if err != nil {
+			log.Error("restore: removing %q: %s", dir, err)
+		}
+	})
+}
+
+// moveFile moves the file at src to dst, copying it if they're on different
+// file systems.
+func moveFile(src, dst string) (err error) {
+	err = os.MkdirAll(filepath.Dir(dst), 0o755)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, in.Close()) }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, out.Close()) }()
+
+	_, err = io.Copy(out, in)
+
+	// Don't wrap the error since it's informative enough as is.
+	return err
+}
+
+// queryBool returns the boolean value of the query parameter name of r.  An
+// empty value is false.
+func queryBool(r *http.Request, name string) (ok bool, err error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+
+	ok, err = strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return ok, nil
+}
+
+// handleBackup is the handler for the GET /control/backup HTTP API.  The stats
+// and the querylog query parameters define if the statistics and the query log
+// are included.
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+	withStats, err := queryBool(r, "stats")
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	withQueryLog, err := queryBool(r, "querylog")
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	name := fmt.Sprintf("AdGuardHome-backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, "application/gzip")
+	h.Set(httphdr.ContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+
+	err = writeBackup(w, withStats, withQueryLog)
+	if err != nil {
+		// The headers are most likely sent already, so only log the error.
+		log.Error("backup: writing archive: %s", err)
+	}
+}
+
+// handleRestore is the handler for the POST /control/restore HTTP API.  The
+// request body is the backup archive.  AdGuard Home restarts after the
+// response, if the archive is valid.
+func (web *webAPI) handleRestore(w http.ResponseWriter, r *http.Request) {
+	execPath, err := os.Executable()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "getting path: %s", err)
+
+		return
+	}
+
+	dir, err := os.MkdirTemp(Context.getDataDir(), "restore-")
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "creating directory: %s", err)
+
+		return
+	}
+
+	names, err := extractBackup(r.Body, dir, maxBackupDataSize)
+	if err != nil {
+		removeRestoreDir(dir)
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	moves, err := validateBackup(dir, names)
+	if err != nil {
+		removeRestoreDir(dir)
+		aghhttp.Error(r, w, http.StatusBadRequest, "validating: %s", err)
+
+		return
+	}
+
+	aghhttp.OK(w)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	// The background context is used for the same reasons as in
+	// [webAPI.handleUpdate].
+	go finishRestore(context.Background(), dir, moves, execPath, web.conf.runningAsService)
+}
+
+// removeRestoreDir removes the temporary directory of a failed restore.
+func removeRestoreDir(dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		log.Error("restore: removing %q: %s", dir, err)
+	}
+}
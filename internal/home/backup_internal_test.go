@@ -0,0 +1,142 @@
+package home
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBackup returns a gzipped tar archive with files.
+func newTestBackup(t *testing.T, files map[string]string) (b []byte) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+
+	for name, data := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0o644,
+			Size: int64(len(data)),
+		}))
+
+		_, err := tw.Write([]byte(data))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	return buf.Bytes()
+}
+
+func TestValidBackupName(t *testing.T) {
+	testCases := []struct {
+		name string
+		want bool
+	}{{
+		name: backupConfigName,
+		want: true,
+	}, {
+		name: backupQueryLogRotatedName,
+		want: true,
+	}, {
+		name: "data/filters/1700000000.txt",
+		want: true,
+	}, {
+		name: "data/filters/../../AdGuardHome.yaml",
+		want: false,
+	}, {
+		name: "data/sessions.db",
+		want: false,
+	}, {
+		name: "/etc/passwd",
+		want: false,
+	}, {
+		name: "include/conf.d/clients.yaml",
+		want: true,
+	}, {
+		name: "include/../AdGuardHome.yaml",
+		want: false,
+	}, {
+		name: "include/",
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, validBackupName(tc.name))
+		})
+	}
+}
+
+func TestBackupIncludeNames(t *testing.T) {
+	confDir := t.TempDir()
+	outDir := t.TempDir()
+
+	inside := filepath.Join(confDir, "conf.d", "clients.yaml")
+	outside := filepath.Join(outDir, "upstreams.yaml")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(inside), 0o755))
+	require.NoError(t, os.WriteFile(inside, []byte("clients: {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(outside, []byte("dns: {}\n"), 0o644))
+
+	paths := map[string]string{}
+	names, err := backupIncludeNames(confDir, []string{"conf.d/*.yaml", outside}, paths)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"include/conf.d/clients.yaml"}, names)
+	assert.Equal(t, map[string]string{"include/conf.d/clients.yaml": inside}, paths)
+}
+
+func TestExtractBackup(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		dir := t.TempDir()
+		b := newTestBackup(t, map[string]string{
+			backupConfigName:              "schema_version: 28\n",
+			"data/filters/1700000000.txt": "||example.org^\n",
+		})
+
+		names, err := extractBackup(bytes.NewReader(b), dir, maxBackupDataSize)
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{backupConfigName, "data/filters/1700000000.txt"}, names)
+
+		data, err := os.ReadFile(filepath.Join(dir, "data", "filters", "1700000000.txt"))
+		require.NoError(t, err)
+
+		assert.Equal(t, "||example.org^\n", string(data))
+	})
+
+	t.Run("unexpected", func(t *testing.T) {
+		b := newTestBackup(t, map[string]string{
+			"../AdGuardHome.yaml": "",
+		})
+
+		_, err := extractBackup(bytes.NewReader(b), t.TempDir(), maxBackupDataSize)
+		assert.EqualError(t, err, `unexpected entry "../AdGuardHome.yaml"`)
+	})
+
+	t.Run("too_large", func(t *testing.T) {
+		b := newTestBackup(t, map[string]string{
+			backupConfigName:              "schema_version: 28\n",
+			"data/filters/1700000000.txt": "||example.org^\n",
+		})
+
+		_, err := extractBackup(bytes.NewReader(b), t.TempDir(), 16*datasize.B)
+		assert.ErrorIs(t, err, errBackupTooLarge)
+	})
+
+	t.Run("not_gzip", func(t *testing.T) {
+		_, err := extractBackup(bytes.NewReader([]byte("not an archive")), t.TempDir(), maxBackupDataSize)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,490 @@
+package home
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/stringutil"
+)
+
+// cliTokenEnv is the name of the environment variable containing the API token
+// used by the subcommands, if the -token flag isn't set.
+const cliTokenEnv = "ADGUARDHOME_TOKEN"
+
+// cliTimeout is the timeout of the requests made by the subcommands.
+const cliTimeout = 1 * time.Minute
+
+// errCLICheckFailed is returned by the subcommands when the check has
+// completed, but hasn't passed.
+const errCLICheckFailed errors.Error = "check failed"
+
+// cliOptions are the options of the subcommands.
+type cliOptions struct {
+	// out is the destination of the results.
+	out io.Writer
+
+	// confPath is the path to the configuration file.
+	confPath string
+
+	// url is the base URL of the running instance.
+	url string
+
+	// token is the API token used to authenticate the requests.
+	token string
+
+	// qtype is the type of the checked request.
+	qtype string
+
+	// offline makes the subcommand evaluate the configuration file instead of
+	// sending requests to the running instance.
+	offline bool
+}
+
+// cliCommand is a subcommand of the executable.
+type cliCommand struct {
+	// run runs the subcommand with the positional arguments.
+	run func(o *cliOptions, args []string) (err error)
+
+	// usage is the usage line of the subcommand without the executable.
+	usage string
+
+	// hasQType defines if the subcommand accepts the -type flag.
+	hasQType bool
+
+	// hasOffline defines if the subcommand accepts the -offline flag.
+	hasOffline bool
+}
+
+// cliCommands are the supported subcommands.
+var cliCommands = map[string]*cliCommand{
+	"check-host": {
+		run:      cliCheckHost,
+		usage:    "check-host [flags] NAME",
+		hasQType: true,
+	},
+	"test-upstreams": {
+		run:        cliTestUpstreams,
+		usage:      "test-upstreams [flags] [UPSTREAM...]",
+		hasOffline: true,
+	},
+}
+
+// runSubcommand runs the subcommand from args, which are the command-line
+// arguments without the executable name.  ok is false if args don't start with
+// a subcommand, and code is the exit code otherwise.
+func runSubcommand(exec string, args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	name := args[0]
+	if name == "gfwlist" {
+		// There are no GFW lists in this build, so report it explicitly
+		// instead of starting the server with an unknown argument.
+		_, _ = fmt.Fprintf(os.Stderr, "%s %s: not supported\n", exec, name)
+
+		return 2, true
+	}
+
+	cmd, ok := cliCommands[name]
+	if !ok {
+		return 0, false
+	}
+
+	o := &cliOptions{
+		out: os.Stdout,
+	}
+
+	flags := flag.NewFlagSet(exec+" "+name, flag.ContinueOnError)
+	flags.StringVar(
+		&o.confPath,
+		"c",
+		"",
+		"path to the config file, AdGuardHome.yaml in the executable's directory by default",
+	)
+	flags.StringVar(
+		&o.url,
+		"url",
+		"",
+		"base URL of the running instance, taken from the config file by default",
+	)
+	flags.StringVar(&o.token, "token", os.Getenv(cliTokenEnv), "API token, $"+cliTokenEnv+" by default")
+	if cmd.hasQType {
+		flags.StringVar(&o.qtype, "type", "A", "type of the request")
+	}
+
+	if cmd.hasOffline {
+		flags.BoolVar(
+			&o.offline,
+			"offline",
+			false,
+			"check the upstreams from the config file without the running instance",
+		)
+	}
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "Usage:\n\n%s %s\n\nFlags:\n", exec, cmd.usage)
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0, true
+	} else if err != nil {
+		return 2, true
+	}
+
+	err = cmd.run(o, flags.Args())
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s %s: %s\n", exec, name, err)
+
+		return 1, true
+	}
+
+	return 0, true
+}
+
+// loadCLIConfig reads the configuration file for the subcommands.
+func (o *cliOptions) loadCLIConfig() (conf *configuration, err error) {
+	confPath := o.confPath
+	if confPath == "" {
+		var execPath string
+		execPath, err = os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("getting executable path: %w", err)
+		}
+
+		confPath = filepath.Join(filepath.Dir(execPath), "AdGuardHome.yaml")
+	}
+
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	conf = &configuration{}
+	err = conf.decodeConfig(data, filepath.Dir(confPath))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", confPath, err)
+	}
+
+	return conf, nil
+}
+
+// baseURL returns the base URL of the running instance.
+func (o *cliOptions) baseURL() (u string, err error) {
+	if o.url != "" {
+		return strings.TrimSuffix(o.url, "/"), nil
+	}
+
+	conf, err := o.loadCLIConfig()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	addr := conf.HTTPConfig.Address
+	if !addr.IsValid() {
+		return "", errors.Error("http.address is not a valid address, use -url")
+	}
+
+	host := addr.Addr().Unmap()
+	if host.IsUnspecified() {
+		host = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+		if addr.Addr().Is6() {
+			host = netip.IPv6Loopback()
+		}
+	}
+
+	hostPort := net.JoinHostPort(host.String(), strconv.Itoa(int(addr.Port())))
+
+	return (&url.URL{Scheme: "http", Host: hostPort}).String(), nil
+}
+
+// request sends the request with the JSON-encoded body, if any, to the path of
+// the running instance and decodes the JSON response into resp.
+func (o *cliOptions) request(method, path string, q url.Values, body, resp any) (err error) {
+	base, err := o.baseURL()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	u := base + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		var data []byte
+		data, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set(httphdr.ContentType, "application/json")
+	}
+
+	if o.token != "" {
+		req.Header.Set(httphdr.Authorization, "Bearer "+o.token)
+	}
+
+	cli := &http.Client{
+		Timeout: cliTimeout,
+	}
+
+	httpResp, err := cli.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, httpResp.Body.Close()) }()
+
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+
+		return fmt.Errorf("%s %s: %s: %s", method, path, httpResp.Status, bytes.TrimSpace(msg))
+	}
+
+	err = json.NewDecoder(httpResp.Body).Decode(resp)
+	if err != nil {
+		return fmt.Errorf("decoding response to %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
+
+// cliCheckHostResp is the part of the response to the GET
+// /control/filtering/check_host HTTP API used by the check-host subcommand.
+type cliCheckHostResp struct {
+	Reason  string `json:"reason"`
+	Service string `json:"service_name"`
+	CName   string `json:"cname"`
+	Rules   []*struct {
+		Text         string `json:"text"`
+		FilterListID int64  `json:"filter_list_id"`
+	} `json:"rules"`
+	IPs []string `json:"ip_addrs"`
+}
+
+// cliHostUpstreamsResp is the response to the GET /control/dns_upstreams HTTP
+// API.
+type cliHostUpstreamsResp struct {
+	RoutingRule string   `json:"routing_rule"`
+	Upstreams   []string `json:"upstreams"`
+}
+
+// cliCheckHost runs the check-host subcommand, which prints the filtering rules
+// matching the name and the upstream servers the request is sent to.
+func cliCheckHost(o *cliOptions, args []string) (err error) {
+	if len(args) != 1 {
+		return errors.Error("exactly one name is required")
+	}
+
+	q := url.Values{
+		"name": []string{args[0]},
+	}
+
+	filterResp := &cliCheckHostResp{}
+	err = o.request(http.MethodGet, "/control/filtering/check_host", q, nil, filterResp)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	q = url.Values{
+		"name": []string{args[0]},
+		"type": []string{o.qtype},
+	}
+
+	upsResp := &cliHostUpstreamsResp{}
+	err = o.request(http.MethodGet, "/control/dns_upstreams", q, nil, upsResp)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	printCheckHost(o.out, filterResp, upsResp)
+
+	return nil
+}
+
+// printCheckHost writes the results of the check-host subcommand to w.
+func printCheckHost(w io.Writer, filterResp *cliCheckHostResp, upsResp *cliHostUpstreamsResp) {
+	b := &strings.Builder{}
+
+	stringutil.WriteToBuilder(b, "reason: ", filterResp.Reason, "\n")
+	for _, r := range filterResp.Rules {
+		_, _ = fmt.Fprintf(b, "rule: %s (filter list %d)\n", r.Text, r.FilterListID)
+	}
+
+	if filterResp.Service != "" {
+		stringutil.WriteToBuilder(b, "blocked service: ", filterResp.Service, "\n")
+	}
+
+	if filterResp.CName != "" {
+		stringutil.WriteToBuilder(b, "cname: ", filterResp.CName, "\n")
+	}
+
+	for _, ip := range filterResp.IPs {
+		stringutil.WriteToBuilder(b, "ip: ", ip, "\n")
+	}
+
+	if upsResp.RoutingRule != "" {
+		stringutil.WriteToBuilder(b, "routing rule: ", upsResp.RoutingRule, "\n")
+	}
+
+	for _, u := range upsResp.Upstreams {
+		stringutil.WriteToBuilder(b, "upstream: ", u, "\n")
+	}
+
+	_, _ = io.WriteString(w, b.String())
+}
+
+// cliUpstreamsJSON is the set of the upstream servers in the GET
+// /control/dns_info and the POST /control/test_upstream_dns HTTP APIs.
+type cliUpstreamsJSON struct {
+	Upstreams []string `json:"upstream_dns"`
+	Bootstrap []string `json:"bootstrap_dns"`
+	Fallback  []string `json:"fallback_dns"`
+	Private   []string `json:"private_upstream"`
+
+	// LocalPTR is only set in the response to the GET /control/dns_info.
+	LocalPTR []string `json:"local_ptr_upstreams,omitempty"`
+}
+
+// cliTestUpstreams runs the test-upstreams subcommand, which checks the
+// upstream servers from args or, if there are none, the configured ones.
+func cliTestUpstreams(o *cliOptions, args []string) (err error) {
+	var status map[string]string
+	if o.offline {
+		status, err = o.testUpstreamsOffline(args)
+	} else {
+		status, err = o.testUpstreamsOnline(args)
+	}
+
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	return printUpstreamsStatus(o.out, status)
+}
+
+// testUpstreamsOnline checks the upstream servers using the running instance.
+func (o *cliOptions) testUpstreamsOnline(args []string) (status map[string]string, err error) {
+	req := &cliUpstreamsJSON{
+		Upstreams: args,
+	}
+
+	if len(args) == 0 {
+		err = o.request(http.MethodGet, "/control/dns_info", nil, nil, req)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+
+		req.Private, req.LocalPTR = req.LocalPTR, nil
+	}
+
+	err = o.request(http.MethodPost, "/control/test_upstream_dns", nil, req, &status)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// testUpstreamsOffline checks the upstream servers using the configuration
+// file.
+func (o *cliOptions) testUpstreamsOffline(args []string) (status map[string]string, err error) {
+	conf, err := o.loadCLIConfig()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	dnsConf := conf.DNS
+	checkConf := &dnsforward.UpstreamsCheckConfig{
+		Upstreams:  args,
+		Bootstrap:  dnsConf.BootstrapDNS,
+		Timeout:    dnsConf.UpstreamTimeout.Duration,
+		PreferIPv6: dnsConf.BootstrapPrefersIPv6(),
+	}
+
+	if len(args) == 0 {
+		checkConf.Upstreams = dnsConf.UpstreamDNS
+		if fn := dnsConf.UpstreamDNSFileName; fn != "" {
+			var data []byte
+			data, err = os.ReadFile(fn)
+			if err != nil {
+				return nil, fmt.Errorf("reading upstream_dns_file: %w", err)
+			}
+
+			checkConf.Upstreams = stringutil.SplitTrimmed(string(data), "\n")
+		}
+
+		checkConf.Fallback = dnsConf.FallbackDNS
+		checkConf.Private = dnsConf.PrivateRDNSResolvers
+	}
+
+	if checkConf.Timeout == 0 {
+		checkConf.Timeout = dnsforward.DefaultTimeout
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return dnsforward.CheckUpstreamsConfig(checkConf)
+}
+
+// printUpstreamsStatus writes the status of each upstream server to w sorted
+// by the address.  It returns errCLICheckFailed if any of them isn't working.
+func printUpstreamsStatus(w io.Writer, status map[string]string) (err error) {
+	addrs := make([]string, 0, len(status))
+	for addr := range status {
+		addrs = append(addrs, addr)
+	}
+
+	slices.Sort(addrs)
+
+	b := &strings.Builder{}
+	for _, addr := range addrs {
+		st := status[addr]
+		if st != "OK" {
+			err = errCLICheckFailed
+		}
+
+		stringutil.WriteToBuilder(b, addr, ": ", st, "\n")
+	}
+
+	_, _ = io.WriteString(w, b.String())
+
+	return err
+}
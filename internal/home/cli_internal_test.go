@@ -0,0 +1,82 @@
+package home
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLICheckHost(t *testing.T) {
+	const token = "secret"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control/filtering/check_host", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer "+token, r.Header.Get(httphdr.Authorization))
+		assert.Equal(t, "ads.example", r.URL.Query().Get("name"))
+
+		_, _ = w.Write([]byte(`{"reason":"FilteredBlackList","rules":[{"text":"||ads.example^","filter_list_id":1}]}`))
+	})
+	mux.HandleFunc("/control/dns_upstreams", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AAAA", r.URL.Query().Get("type"))
+
+		_, _ = w.Write([]byte(`{"routing_rule":"qtype == \"AAAA\"","upstreams":["1.1.1.1:53"]}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	out := &strings.Builder{}
+	o := &cliOptions{
+		out:   out,
+		url:   srv.URL + "/",
+		token: token,
+		qtype: "AAAA",
+	}
+
+	require.NoError(t, cliCheckHost(o, []string{"ads.example"}))
+
+	assert.Equal(t, "reason: FilteredBlackList\n"+
+		"rule: ||ads.example^ (filter list 1)\n"+
+		"routing rule: qtype == \"AAAA\"\n"+
+		"upstream: 1.1.1.1:53\n", out.String())
+
+	err := cliCheckHost(o, nil)
+	testutil.AssertErrorMsg(t, "exactly one name is required", err)
+}
+
+func TestCLITestUpstreams(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control/dns_info", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"upstream_dns":["8.8.8.8"],"local_ptr_upstreams":["192.168.1.1"]}`))
+	})
+	mux.HandleFunc("/control/test_upstream_dns", func(w http.ResponseWriter, r *http.Request) {
+		req := &cliUpstreamsJSON{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		assert.Equal(t, &cliUpstreamsJSON{
+			Upstreams: []string{"8.8.8.8"},
+			Private:   []string{"192.168.1.1"},
+		}, req)
+
+		_, _ = w.Write([]byte(`{"8.8.8.8":"OK","192.168.1.1":"timeout"}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	out := &strings.Builder{}
+	o := &cliOptions{
+		out: out,
+		url: srv.URL,
+	}
+
+	err := cliTestUpstreams(o, nil)
+	assert.ErrorIs(t, err, errCLICheckFailed)
+	assert.Equal(t, "192.168.1.1: timeout\n8.8.8.8: OK\n", out.String())
+}
@@ -0,0 +1,474 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/dnsproxy/proxy"
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// clientGroupObject is the YAML representation of a client group.
+type clientGroupObject struct {
+	SafeSearchConf filtering.SafeSearchConfig `yaml:"safe_search"`
+
+	// BlockedServices is the configuration of blocked services of the group.
+	// It's ignored if UseGlobalBlockedServices is true.
+	BlockedServices *filtering.BlockedServices `yaml:"blocked_services"`
+
+	Name string `yaml:"name"`
+
+	// ThreatCategories are the threat-feed categories enabled for the group.
+	ThreatCategories []filtering.ThreatCategory `yaml:"threat_categories"`
+
+	Upstreams []string `yaml:"upstreams"`
+
+	FilteringEnabled         bool `yaml:"filtering_enabled"`
+	ParentalEnabled          bool `yaml:"parental_enabled"`
+	SafeBrowsingEnabled      bool `yaml:"safebrowsing_enabled"`
+	NewDomainsEnabled        bool `yaml:"new_domains_enabled"`
+	UseGlobalBlockedServices bool `yaml:"use_global_blocked_services"`
+}
+
+// toGroup returns an initialized client group if there are no errors.
+func (o *clientGroupObject) toGroup(filteringConf *filtering.Config) (g *client.Group, err error) {
+	g = &client.Group{
+		Name:                o.Name,
+		Upstreams:           slices.Clone(o.Upstreams),
+		SafeSearchConf:      o.SafeSearchConf,
+		FilteringEnabled:    o.FilteringEnabled,
+		SafeBrowsingEnabled: o.SafeBrowsingEnabled,
+		ParentalEnabled:     o.ParentalEnabled,
+		NewDomainsEnabled:   o.NewDomainsEnabled,
+	}
+
+	if o.SafeSearchConf.Enabled {
+		err = g.SetSafeSearch(
+			o.SafeSearchConf,
+			filteringConf.SafeSearchCacheSize,
+			time.Minute*time.Duration(filteringConf.CacheTime),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("init safesearch %q: %w", g.Name, err)
+		}
+	}
+
+	if !o.UseGlobalBlockedServices {
+		err = o.BlockedServices.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("init blocked services %q: %w", g.Name, err)
+		}
+
+		g.BlockedServices = o.BlockedServices.Clone()
+	}
+
+	err = filtering.ValidateThreatCategories(o.ThreatCategories)
+	if err != nil {
+		return nil, fmt.Errorf("init threat categories %q: %w", g.Name, err)
+	}
+
+	g.ThreatCategories = slices.Clone(o.ThreatCategories)
+
+	return g, nil
+}
+
+// addGroupsFromConfig initializes the client groups with objects from the
+// configuration file.
+func (clients *clientsContainer) addGroupsFromConfig(
+	objects []*clientGroupObject,
+	filteringConf *filtering.Config,
+) (err error) {
+	clients.groups = make(map[string]*client.Group, len(objects))
+	for i, o := range objects {
+		var g *client.Group
+		g, err = o.toGroup(filteringConf)
+		if err == nil {
+			err = clients.addGroup(g)
+		}
+
+		if err != nil {
+			return fmt.Errorf("clients: init group at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// groupsForConfig returns all the client groups as objects for the
+// configuration file sorted by name.
+func (clients *clientsContainer) groupsForConfig() (objs []*clientGroupObject) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	objs = make([]*clientGroupObject, 0, len(clients.groups))
+	for _, g := range clients.groups {
+		objs = append(objs, &clientGroupObject{
+			SafeSearchConf:           g.SafeSearchConf,
+			BlockedServices:          g.BlockedServices.Clone(),
+			Name:                     g.Name,
+			ThreatCategories:         slices.Clone(g.ThreatCategories),
+			Upstreams:                slices.Clone(g.Upstreams),
+			FilteringEnabled:         g.FilteringEnabled,
+			ParentalEnabled:          g.ParentalEnabled,
+			SafeBrowsingEnabled:      g.SafeBrowsingEnabled,
+			NewDomainsEnabled:        g.NewDomainsEnabled,
+			UseGlobalBlockedServices: g.BlockedServices == nil,
+		})
+	}
+
+	slices.SortFunc(objs, func(a, b *clientGroupObject) (res int) {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return objs
+}
+
+// checkGroup returns an error if g is not a valid group.
+func checkGroup(g *client.Group) (err error) {
+	if g.Name == "" {
+		return errors.Error("invalid name")
+	}
+
+	_, err = proxy.ParseUpstreamsConfig(g.Upstreams, &upstream.Options{})
+	if err != nil {
+		return fmt.Errorf("invalid upstream servers: %w", err)
+	}
+
+	return nil
+}
+
+// checkGroupLocked returns an error if the group of c doesn't exist.
+// clients.lock is expected to be locked.
+func (clients *clientsContainer) checkGroupLocked(c *client.Persistent) (err error) {
+	if c.Group == "" {
+		return nil
+	}
+
+	if _, ok := clients.groups[c.Group]; !ok {
+		return fmt.Errorf("group %q not found", c.Group)
+	}
+
+	return nil
+}
+
+// addGroup adds a client group or returns an error.
+func (clients *clientsContainer) addGroup(g *client.Group) (err error) {
+	err = checkGroup(g)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	if _, ok := clients.groups[g.Name]; ok {
+		return fmt.Errorf("group %q already exists", g.Name)
+	}
+
+	clients.groups[g.Name] = g
+
+	log.Debug("clients: added group %q [%d]", g.Name, len(clients.groups))
+
+	return nil
+}
+
+// updateGroup replaces the client group named prevName with g.  The clients
+// of the group are moved to g if it's renamed.
+func (clients *clientsContainer) updateGroup(prevName string, g *client.Group) (err error) {
+	err = checkGroup(g)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	if _, ok := clients.groups[prevName]; !ok {
+		return fmt.Errorf("group %q not found", prevName)
+	} else if _, ok = clients.groups[g.Name]; ok && g.Name != prevName {
+		return fmt.Errorf("group %q already exists", g.Name)
+	}
+
+	delete(clients.groups, prevName)
+	clients.groups[g.Name] = g
+
+	clients.clientIndex.Range(func(c *client.Persistent) (cont bool) {
+		if c.Group != prevName {
+			return true
+		}
+
+		c.Group = g.Name
+		if len(c.Upstreams) == 0 {
+			// Reset the upstreams inherited from the group, so that they are
+			// recreated from the new ones on the next request.
+			if closeErr := c.CloseUpstreams(); closeErr != nil {
+				log.Error("clients: updating group %q: %s", g.Name, closeErr)
+			}
+
+			c.UpstreamConfig = nil
+		}
+
+		return true
+	})
+
+	return nil
+}
+
+// removeGroup removes the client group by its name.  It returns an error if
+// there is no such group or it's used by any client.
+func (clients *clientsContainer) removeGroup(name string) (err error) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	if _, ok := clients.groups[name]; !ok {
+		return fmt.Errorf("group %q not found", name)
+	}
+
+	clients.clientIndex.Range(func(c *client.Persistent) (cont bool) {
+		if c.Group == name {
+			err = fmt.Errorf("group %q is used by client %q", name, c.Name)
+		}
+
+		return err == nil
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	delete(clients.groups, name)
+
+	return nil
+}
+
+// findWithGroup returns a shallow copy of the client with the settings it
+// doesn't override taken from its group, if there is one found.
+func (clients *clientsContainer) findWithGroup(id string) (c *client.Persistent, ok bool) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	c, ok = clients.findLocked(id)
+	if !ok {
+		return nil, false
+	}
+
+	return c.Inherit(clients.groups[c.Group]), true
+}
+
+// clientGroupJSON is the JSON representation of a client group.
+type clientGroupJSON struct {
+	SafeSearchConf *filtering.SafeSearchConfig `json:"safe_search"`
+
+	// Schedule is blocked services schedule for every day of the week.
+	Schedule *schedule.Weekly `json:"blocked_services_schedule"`
+
+	Name string `json:"name"`
+
+	// BlockedServices is the names of blocked services.
+	BlockedServices []string `json:"blocked_services"`
+	Upstreams       []string `json:"upstreams"`
+
+	// ThreatCategories are the threat-feed categories enabled for the group.
+	ThreatCategories []filtering.ThreatCategory `json:"threat_categories"`
+
+	FilteringEnabled         bool `json:"filtering_enabled"`
+	ParentalEnabled          bool `json:"parental_enabled"`
+	SafeBrowsingEnabled      bool `json:"safebrowsing_enabled"`
+	NewDomainsEnabled        bool `json:"new_domains_enabled"`
+	UseGlobalBlockedServices bool `json:"use_global_blocked_services"`
+}
+
+// jsonToGroup converts the JSON object to a client group if there are no
+// errors.
+func (clients *clientsContainer) jsonToGroup(gj *clientGroupJSON) (g *client.Group, err error) {
+	g = &client.Group{
+		Name:                gj.Name,
+		Upstreams:           gj.Upstreams,
+		FilteringEnabled:    gj.FilteringEnabled,
+		SafeBrowsingEnabled: gj.SafeBrowsingEnabled,
+		ParentalEnabled:     gj.ParentalEnabled,
+		NewDomainsEnabled:   gj.NewDomainsEnabled,
+	}
+
+	if gj.SafeSearchConf != nil {
+		g.SafeSearchConf = *gj.SafeSearchConf
+	}
+
+	if g.SafeSearchConf.Enabled {
+		err = g.SetSafeSearch(
+			g.SafeSearchConf,
+			clients.safeSearchCacheSize,
+			clients.safeSearchCacheTTL,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("creating safesearch for group %q: %w", g.Name, err)
+		}
+	}
+
+	if !gj.UseGlobalBlockedServices {
+		g.BlockedServices, err = copyBlockedServices(gj.Schedule, gj.BlockedServices, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked services: %w", err)
+		}
+	}
+
+	err = filtering.ValidateThreatCategories(gj.ThreatCategories)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threat categories: %w", err)
+	}
+
+	g.ThreatCategories = slices.Clone(gj.ThreatCategories)
+
+	return g, nil
+}
+
+// groupToJSON converts the client group to the JSON object.
+func groupToJSON(g *client.Group) (gj *clientGroupJSON) {
+	safeSearchConf := g.SafeSearchConf
+
+	gj = &clientGroupJSON{
+		SafeSearchConf:           &safeSearchConf,
+		Name:                     g.Name,
+		Upstreams:                g.Upstreams,
+		ThreatCategories:         g.ThreatCategories,
+		FilteringEnabled:         g.FilteringEnabled,
+		ParentalEnabled:          g.ParentalEnabled,
+		SafeBrowsingEnabled:      g.SafeBrowsingEnabled,
+		NewDomainsEnabled:        g.NewDomainsEnabled,
+		UseGlobalBlockedServices: g.BlockedServices == nil,
+	}
+
+	if svcs := g.BlockedServices; svcs != nil {
+		gj.Schedule = svcs.Schedule
+		gj.BlockedServices = svcs.IDs
+	}
+
+	return gj
+}
+
+// groupsToJSONLocked returns the JSON objects of all the client groups sorted
+// by name.  clients.lock is expected to be locked.
+func (clients *clientsContainer) groupsToJSONLocked() (gjs []*clientGroupJSON) {
+	gjs = make([]*clientGroupJSON, 0, len(clients.groups))
+	for _, g := range clients.groups {
+		gjs = append(gjs, groupToJSON(g))
+	}
+
+	slices.SortFunc(gjs, func(a, b *clientGroupJSON) (res int) {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return gjs
+}
+
+// handleAddGroup is the handler for the POST /control/clients/groups/add HTTP
+// API.
+func (clients *clientsContainer) handleAddGroup(w http.ResponseWriter, r *http.Request) {
+	gj := &clientGroupJSON{}
+	err := json.NewDecoder(r.Body).Decode(gj)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	g, err := clients.jsonToGroup(gj)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	err = clients.addGroup(g)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
+
+// groupDeleteJSON is the request for the POST /control/clients/groups/delete
+// HTTP API.
+type groupDeleteJSON struct {
+	Name string `json:"name"`
+}
+
+// handleDelGroup is the handler for the POST /control/clients/groups/delete
+// HTTP API.
+func (clients *clientsContainer) handleDelGroup(w http.ResponseWriter, r *http.Request) {
+	req := &groupDeleteJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	err = clients.removeGroup(req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
+
+// groupUpdateJSON is the request for the POST /control/clients/groups/update
+// HTTP API.
+type groupUpdateJSON struct {
+	Data *clientGroupJSON `json:"data"`
+	Name string           `json:"name"`
+}
+
+// handleUpdateGroup is the handler for the POST /control/clients/groups/update
+// HTTP API.
+func (clients *clientsContainer) handleUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	req := &groupUpdateJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	} else if req.Data == nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "no data")
+
+		return
+	}
+
+	g, err := clients.jsonToGroup(req.Data)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	err = clients.updateGroup(req.Name, g)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	if !clients.testing {
+		onConfigModified()
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
 	"github.com/AdguardTeam/dnsproxy/proxy"
 	"github.com/AdguardTeam/dnsproxy/upstream"
@@ -41,6 +42,11 @@ type DHCP interface {
 	// returns nil if there is no such client, due to an assumption that a DHCP
 	// client must always have a MAC address.
 	MACByIP(ip netip.Addr) (mac net.HardwareAddr)
+
+	// FingerprintByIP returns the DHCP fingerprint of the client with the
+	// given IP address.  fp is empty if there is no such client or its
+	// fingerprint is unknown.
+	FingerprintByIP(ip netip.Addr) (fp dhcpsvc.Fingerprint)
 }
 
 // clientsContainer is the storage of all runtime and persistent clients.
@@ -67,6 +73,22 @@ type clientsContainer struct {
 	// arpDB stores the neighbors retrieved from ARP.
 	arpDB arpdb.Interface
 
+	// groups are the client groups by their names.
+	groups map[string]*client.Group
+
+	// priority is the order of the sources of the runtime clients' hostnames.
+	// The sources missing from it are considered in the default order.
+	priority []client.Source
+
+	// listenerIfaces are the names of the network interfaces by the local
+	// addresses of the listeners.  The name is empty if the interface is
+	// unknown.  It's reset periodically, since the addresses may change.
+	listenerIfaces map[netip.Addr]string
+
+	// seenRuntime are the addresses of the runtime clients, which have already
+	// been reported to the webhooks.
+	seenRuntime *container.MapSet[netip.Addr]
+
 	// lock protects all fields.
 	//
 	// TODO(a.garipov): Use a pointer and describe which fields are protected in
@@ -98,6 +120,7 @@ type BlockedClientChecker interface {
 // Note: this function must be called only once
 func (clients *clientsContainer) Init(
 	objects []*clientObject,
+	groups []*clientGroupObject,
 	dhcpServer DHCP,
 	etcHosts *aghnet.HostsContainer,
 	arpDB arpdb.Interface,
@@ -109,6 +132,7 @@ func (clients *clientsContainer) Init(
 	}
 
 	clients.runtimeIndex = client.NewRuntimeIndex()
+	clients.seenRuntime = container.NewMapSet[netip.Addr]()
 
 	clients.clientIndex = client.NewIndex()
 
@@ -119,6 +143,12 @@ func (clients *clientsContainer) Init(
 
 	clients.etcHosts = etcHosts
 	clients.arpDB = arpDB
+	err = clients.addGroupsFromConfig(groups, filteringConf)
+	if err != nil {
+		// Don't wrap the error, because it's informative enough as is.
+		return err
+	}
+
 	err = clients.addFromConfig(objects, filteringConf)
 	if err != nil {
 		// Don't wrap the error, because it's informative enough as is.
@@ -132,6 +162,11 @@ func (clients *clientsContainer) Init(
 		return nil
 	}
 
+	clients.priority, err = parseSourcePriority(config.Clients.Sources.Priority)
+	if err != nil {
+		return fmt.Errorf("clients: runtime_sources: %w", err)
+	}
+
 	// The clients.etcHosts may be nil even if config.Clients.Sources.HostsFile
 	// is true, because of the deprecated option --no-etc-hosts.
 	//
@@ -173,6 +208,56 @@ func (clients *clientsContainer) Start() {
 	go clients.periodicUpdate()
 }
 
+// sourceNames maps the names of the runtime client sources used in the
+// configuration to the sources.
+var sourceNames = map[string]client.Source{
+	"arp":   client.SourceARP,
+	"rdns":  client.SourceRDNS,
+	"dhcp":  client.SourceDHCP,
+	"hosts": client.SourceHostsFile,
+}
+
+// parseSourcePriority parses the priority of the runtime client sources from
+// their names.
+func parseSourcePriority(names []string) (prio []client.Source, err error) {
+	prio = make([]client.Source, 0, len(names))
+	for i, name := range names {
+		src, ok := sourceNames[name]
+		if !ok {
+			return nil, fmt.Errorf("priority: at index %d: bad source %q", i, name)
+		} else if slices.Contains(prio, src) {
+			return nil, fmt.Errorf("priority: at index %d: duplicate source %q", i, name)
+		}
+
+		prio = append(prio, src)
+	}
+
+	return prio, nil
+}
+
+// runtimeInfo returns the information about rc from the source with the
+// highest configured priority.
+func (clients *clientsContainer) runtimeInfo(rc *client.Runtime) (src client.Source, host string) {
+	return rc.InfoByPriority(clients.priority)
+}
+
+// rescan reloads the runtime clients from the ARP neighborhood and the system
+// hosts files, if configured.  The rDNS and WHOIS information is refreshed
+// once the clients send new queries.
+func (clients *clientsContainer) rescan() (err error) {
+	clients.reloadARP()
+	clients.resetListenerIfaces()
+
+	if config.Clients.Sources.HostsFile && clients.etcHosts != nil {
+		err = clients.etcHosts.Refresh()
+		if err != nil {
+			return fmt.Errorf("refreshing hosts files: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // reloadARP reloads runtime clients from ARP, if configured.
 func (clients *clientsContainer) reloadARP() {
 	if clients.arpDB != nil {
@@ -189,6 +274,16 @@ type clientObject struct {
 
 	Name string `yaml:"name"`
 
+	// Group is the name of the group the client takes the settings it doesn't
+	// override from.
+	Group string `yaml:"group,omitempty"`
+
+	// ThreatCategories are the threat-feed categories enabled for the client.
+	ThreatCategories []filtering.ThreatCategory `yaml:"threat_categories"`
+
+	// QueryQuotas are the limits of the numbers of queries of the client.
+	QueryQuotas []*filtering.QueryQuota `yaml:"query_quotas,omitempty"`
+
 	IDs       []string `yaml:"ids"`
 	Tags      []string `yaml:"tags"`
 	Upstreams []string `yaml:"upstreams"`
@@ -208,10 +303,19 @@ type clientObject struct {
 	FilteringEnabled         bool `yaml:"filtering_enabled"`
 	ParentalEnabled          bool `yaml:"parental_enabled"`
 	SafeBrowsingEnabled      bool `yaml:"safebrowsing_enabled"`
+	NewDomainsEnabled        bool `yaml:"new_domains_enabled"`
 	UseGlobalBlockedServices bool `yaml:"use_global_blocked_services"`
 
 	IgnoreQueryLog   bool `yaml:"ignore_querylog"`
 	IgnoreStatistics bool `yaml:"ignore_statistics"`
+
+	// UseOwnSafeBrowsing defines if SafeBrowsingEnabled is used even if
+	// UseGlobalSettings is true.
+	UseOwnSafeBrowsing bool `yaml:"use_own_safebrowsing"`
+
+	// UseOwnParental defines if ParentalEnabled is used even if
+	// UseGlobalSettings is true.
+	UseOwnParental bool `yaml:"use_own_parental"`
 }
 
 // toPersistent returns an initialized persistent client if there are no errors.
@@ -220,7 +324,8 @@ func (o *clientObject) toPersistent(
 	allTags *container.MapSet[string],
 ) (cli *client.Persistent, err error) {
 	cli = &client.Persistent{
-		Name: o.Name,
+		Name:  o.Name,
+		Group: o.Group,
 
 		Upstreams: o.Upstreams,
 
@@ -231,11 +336,14 @@ func (o *clientObject) toPersistent(
 		ParentalEnabled:       o.ParentalEnabled,
 		SafeSearchConf:        o.SafeSearchConf,
 		SafeBrowsingEnabled:   o.SafeBrowsingEnabled,
+		NewDomainsEnabled:     o.NewDomainsEnabled,
 		UseOwnBlockedServices: !o.UseGlobalBlockedServices,
 		IgnoreQueryLog:        o.IgnoreQueryLog,
 		IgnoreStatistics:      o.IgnoreStatistics,
 		UpstreamsCacheEnabled: o.UpstreamsCacheEnabled,
 		UpstreamsCacheSize:    o.UpstreamsCacheSize,
+		UseOwnSafeBrowsing:    o.UseOwnSafeBrowsing,
+		UseOwnParental:        o.UseOwnParental,
 	}
 
 	err = cli.SetIDs(o.IDs)
@@ -268,6 +376,20 @@ func (o *clientObject) toPersistent(
 
 	cli.BlockedServices = o.BlockedServices.Clone()
 
+	err = filtering.ValidateThreatCategories(o.ThreatCategories)
+	if err != nil {
+		return nil, fmt.Errorf("init threat categories %q: %w", cli.Name, err)
+	}
+
+	cli.ThreatCategories = slices.Clone(o.ThreatCategories)
+
+	err = filtering.ValidateQueryQuotas(o.QueryQuotas)
+	if err != nil {
+		return nil, fmt.Errorf("init query quotas %q: %w", cli.Name, err)
+	}
+
+	cli.QueryQuotas = filtering.CloneQueryQuotas(o.QueryQuotas)
+
 	cli.SetTags(o.Tags, allTags)
 
 	return cli, nil
@@ -312,10 +434,14 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 	objs = make([]*clientObject, 0, clients.clientIndex.Size())
 	clients.clientIndex.Range(func(cli *client.Persistent) (cont bool) {
 		objs = append(objs, &clientObject{
-			Name: cli.Name,
+			Name:  cli.Name,
+			Group: cli.Group,
 
 			BlockedServices: cli.BlockedServices.Clone(),
 
+			ThreatCategories: slices.Clone(cli.ThreatCategories),
+			QueryQuotas:      filtering.CloneQueryQuotas(cli.QueryQuotas),
+
 			IDs:       cli.IDs(),
 			Tags:      slices.Clone(cli.Tags),
 			Upstreams: slices.Clone(cli.Upstreams),
@@ -327,11 +453,14 @@ func (clients *clientsContainer) forConfig() (objs []*clientObject) {
 			ParentalEnabled:          cli.ParentalEnabled,
 			SafeSearchConf:           cli.SafeSearchConf,
 			SafeBrowsingEnabled:      cli.SafeBrowsingEnabled,
+			NewDomainsEnabled:        cli.NewDomainsEnabled,
 			UseGlobalBlockedServices: !cli.UseOwnBlockedServices,
 			IgnoreQueryLog:           cli.IgnoreQueryLog,
 			IgnoreStatistics:         cli.IgnoreStatistics,
 			UpstreamsCacheEnabled:    cli.UpstreamsCacheEnabled,
 			UpstreamsCacheSize:       cli.UpstreamsCacheSize,
+			UseOwnSafeBrowsing:       cli.UseOwnSafeBrowsing,
+			UseOwnParental:           cli.UseOwnParental,
 		})
 
 		return true
@@ -356,6 +485,7 @@ func (clients *clientsContainer) periodicUpdate() {
 
 	for {
 		clients.reloadARP()
+		clients.resetListenerIfaces()
 		time.Sleep(arpClientsUpdatePeriod)
 	}
 }
@@ -435,7 +565,7 @@ func (clients *clientsContainer) clientOrArtificial(
 
 	rc := clients.findRuntimeClient(ip)
 	if rc != nil {
-		_, host := rc.Info()
+		_, host := clients.runtimeInfo(rc)
 
 		return &querylog.Client{
 			Name:  host,
@@ -498,7 +628,12 @@ func (clients *clientsContainer) UpstreamConfigByID(
 		return c.UpstreamConfig, nil
 	}
 
-	upstreams := stringutil.FilterOut(c.Upstreams, dnsforward.IsCommentOrEmpty)
+	upstreams := c.Upstreams
+	if g := clients.groups[c.Group]; g != nil && len(upstreams) == 0 {
+		upstreams = g.Upstreams
+	}
+
+	upstreams = stringutil.FilterOut(upstreams, dnsforward.IsCommentOrEmpty)
 	if len(upstreams) == 0 {
 		return nil, nil
 	}
@@ -510,7 +645,7 @@ func (clients *clientsContainer) UpstreamConfigByID(
 			Bootstrap:    bootstrap,
 			Timeout:      config.DNS.UpstreamTimeout.Duration,
 			HTTPVersions: dnsforward.UpstreamHTTPVersions(config.DNS.UseHTTP3Upstreams),
-			PreferIPv6:   config.DNS.BootstrapPreferIPv6,
+			PreferIPv6:   config.DNS.BootstrapPrefersIPv6(),
 		},
 	)
 	if err != nil {
@@ -529,6 +664,67 @@ func (clients *clientsContainer) UpstreamConfigByID(
 	return conf, nil
 }
 
+// ClientIDByListener implements the [dnsforward.ClientsContainer] interface
+// for *clientsContainer.
+func (clients *clientsContainer) ClientIDByListener(
+	cliAddr netip.Addr,
+	laddr netip.Addr,
+	listenerID string,
+) (id string) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	if _, ok := clients.findLocked(cliAddr.String()); ok {
+		// Prefer the more specific client definition.
+		return ""
+	}
+
+	if listenerID != "" {
+		if _, ok := clients.findLocked(listenerID); ok {
+			return listenerID
+		}
+
+		log.Debug("clients: no client %q configured for listener", listenerID)
+	}
+
+	if !laddr.IsValid() || laddr.IsUnspecified() {
+		return ""
+	}
+
+	if _, ok := clients.clientIndex.FindByListener(laddr); ok {
+		return client.ListenerIDPrefix + laddr.String()
+	}
+
+	name, ok := clients.listenerIfaces[laddr]
+	if !ok {
+		name = aghnet.InterfaceByIP(laddr)
+		if clients.listenerIfaces == nil {
+			clients.listenerIfaces = map[netip.Addr]string{}
+		}
+
+		clients.listenerIfaces[laddr] = name
+	}
+
+	if name == "" {
+		return ""
+	}
+
+	id = client.InterfaceIDPrefix + name
+	if _, ok = clients.clientIndex.Find(id); !ok {
+		return ""
+	}
+
+	return id
+}
+
+// resetListenerIfaces resets the cached network interfaces of the listeners.
+func (clients *clientsContainer) resetListenerIfaces() {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	clients.listenerIfaces = nil
+}
+
 // findLocked searches for a client by its ID.  clients.lock is expected to be
 // locked.
 func (clients *clientsContainer) findLocked(id string) (c *client.Persistent, ok bool) {
@@ -581,6 +777,7 @@ func (clients *clientsContainer) findRuntimeClient(ip netip.Addr) (rc *client.Ru
 		}
 
 		rc.SetInfo(client.SourceDHCP, []string{host})
+		rc.SetTags(client.GuessTags(clients.dhcp.FingerprintByIP(ip)))
 
 		return rc
 	}
@@ -635,6 +832,12 @@ func (clients *clientsContainer) add(c *client.Persistent) (err error) {
 		return err
 	}
 
+	err = clients.checkGroupLocked(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
 	clients.addLocked(c)
 
 	log.Debug("clients: added %q: ID:%q [%d]", c.Name, c.IDs(), clients.clientIndex.Size())
@@ -690,6 +893,12 @@ func (clients *clientsContainer) update(prev, c *client.Persistent) (err error)
 		return err
 	}
 
+	err = clients.checkGroupLocked(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
 	clients.removeLocked(prev)
 	clients.addLocked(c)
 
@@ -712,6 +921,7 @@ func (clients *clientsContainer) setWHOISInfo(ip netip.Addr, wi *whois.Info) {
 		// again.
 		rc = client.NewRuntime(ip)
 		clients.runtimeIndex.Add(rc)
+		clients.notifyNewRuntime(ip, "", client.SourceWHOIS)
 
 		log.Debug("clients: set whois info for runtime client with ip %s: %+v", ip, wi)
 	} else {
@@ -780,6 +990,7 @@ func (clients *clientsContainer) addHostLocked(
 
 		rc = client.NewRuntime(ip)
 		clients.runtimeIndex.Add(rc)
+		clients.notifyNewRuntime(ip, host, src)
 	}
 
 	rc.SetInfo(src, []string{host})
@@ -795,6 +1006,25 @@ func (clients *clientsContainer) addHostLocked(
 	return true
 }
 
+// notifyNewRuntime sends the webhook event and the MQTT message about the new
+// runtime client with ip found in src, unless it has already been reported.
+// The clients from the system hosts files are configured by the administrator,
+// so they aren't reported.  clients.lock is expected to be locked.
+func (clients *clientsContainer) notifyNewRuntime(ip netip.Addr, host string, src client.Source) {
+	if src == client.SourceHostsFile || clients.seenRuntime.Has(ip) {
+		return
+	}
+
+	clients.seenRuntime.Add(ip)
+
+	Context.webhooks.Notify(webhook.EventRuntimeClientAdded, &webhook.RuntimeClientAddedData{
+		Host:   host,
+		Source: src.String(),
+		IP:     ip,
+	})
+	Context.mqtt.NotifyNewClient(ip, host, src.String())
+}
+
 // addFromHostsFile fills the client-hostname pairing index from the system's
 // hosts files.
 func (clients *clientsContainer) addFromHostsFile(hosts *hostsfile.DefaultStorage) {
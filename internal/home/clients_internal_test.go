@@ -12,6 +12,7 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpsvc"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/whois"
+	"github.com/AdguardTeam/golibs/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,6 +21,8 @@ type testDHCP struct {
 	OnLeases func() (leases []*dhcpsvc.Lease)
 	OnHostBy func(ip netip.Addr) (host string)
 	OnMACBy  func(ip netip.Addr) (mac net.HardwareAddr)
+
+	OnFingerprintBy func(ip netip.Addr) (fp dhcpsvc.Fingerprint)
 }
 
 // Lease implements the [DHCP] interface for testDHCP.
@@ -31,6 +34,11 @@ func (t *testDHCP) HostByIP(ip netip.Addr) (host string) { return t.OnHostBy(ip)
 // MACByIP implements the [DHCP] interface for testDHCP.
 func (t *testDHCP) MACByIP(ip netip.Addr) (mac net.HardwareAddr) { return t.OnMACBy(ip) }
 
+// FingerprintByIP implements the [DHCP] interface for testDHCP.
+func (t *testDHCP) FingerprintByIP(ip netip.Addr) (fp dhcpsvc.Fingerprint) {
+	return t.OnFingerprintBy(ip)
+}
+
 // newClientsContainer is a helper that creates a new clients container for
 // tests.
 func newClientsContainer(t *testing.T) (c *clientsContainer) {
@@ -44,9 +52,12 @@ func newClientsContainer(t *testing.T) (c *clientsContainer) {
 		OnLeases: func() (leases []*dhcpsvc.Lease) { return nil },
 		OnHostBy: func(ip netip.Addr) (host string) { return "" },
 		OnMACBy:  func(ip netip.Addr) (mac net.HardwareAddr) { return nil },
+		OnFingerprintBy: func(ip netip.Addr) (fp dhcpsvc.Fingerprint) {
+			return dhcpsvc.Fingerprint{}
+		},
 	}
 
-	require.NoError(t, c.Init(nil, dhcp, nil, nil, &filtering.Config{}))
+	require.NoError(t, c.Init(nil, nil, dhcp, nil, nil, &filtering.Config{}))
 
 	return c
 }
@@ -373,3 +384,170 @@ func TestClientsCustomUpstream(t *testing.T) {
 	require.NotNil(t, upsConf)
 	assert.NoError(t, err)
 }
+
+func TestClientsContainer_ClientIDByListener(t *testing.T) {
+	clients := newClientsContainer(t)
+
+	listener := newPersistentClientWithIDs(t, "guest", []string{"listener:192.168.20.1"})
+	require.NoError(t, clients.add(listener))
+
+	subnet := newPersistentClientWithIDs(t, "guest_printer", []string{"192.168.20.0/24"})
+	require.NoError(t, clients.add(subnet))
+
+	laddr := netip.MustParseAddr("192.168.20.1")
+
+	testCases := []struct {
+		cliAddr    netip.Addr
+		laddr      netip.Addr
+		name       string
+		listenerID string
+		want       string
+	}{{
+		cliAddr:    netip.MustParseAddr("10.0.0.5"),
+		laddr:      laddr,
+		name:       "listener",
+		listenerID: "",
+		want:       "listener:192.168.20.1",
+	}, {
+		cliAddr:    netip.MustParseAddr("192.168.20.5"),
+		laddr:      laddr,
+		name:       "more_specific",
+		listenerID: "",
+		want:       "",
+	}, {
+		cliAddr:    netip.MustParseAddr("10.0.0.5"),
+		laddr:      netip.MustParseAddr("203.0.113.1"),
+		name:       "unknown_listener",
+		listenerID: "",
+		want:       "",
+	}, {
+		cliAddr:    netip.MustParseAddr("10.0.0.5"),
+		laddr:      netip.IPv4Unspecified(),
+		name:       "configured",
+		listenerID: "listener:192.168.20.1",
+		want:       "listener:192.168.20.1",
+	}, {
+		cliAddr:    netip.MustParseAddr("192.168.20.5"),
+		laddr:      netip.IPv4Unspecified(),
+		name:       "configured_more_specific",
+		listenerID: "listener:192.168.20.1",
+		want:       "",
+	}, {
+		cliAddr:    netip.MustParseAddr("10.0.0.5"),
+		laddr:      laddr,
+		name:       "configured_unknown",
+		listenerID: "unknown",
+		want:       "listener:192.168.20.1",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			id := clients.ClientIDByListener(tc.cliAddr, tc.laddr, tc.listenerID)
+			assert.Equal(t, tc.want, id)
+
+			if id == "" {
+				return
+			}
+
+			c, ok := clients.find(id)
+			require.True(t, ok)
+
+			assert.Equal(t, listener.Name, c.Name)
+		})
+	}
+}
+
+func TestParseSourcePriority(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		names      []string
+		want       []client.Source
+	}{{
+		name:       "empty",
+		wantErrMsg: "",
+		names:      nil,
+		want:       []client.Source{},
+	}, {
+		name:       "valid",
+		wantErrMsg: "",
+		names:      []string{"arp", "hosts"},
+		want:       []client.Source{client.SourceARP, client.SourceHostsFile},
+	}, {
+		name:       "bad",
+		wantErrMsg: `priority: at index 1: bad source "whois"`,
+		names:      []string{"dhcp", "whois"},
+		want:       nil,
+	}, {
+		name:       "duplicate",
+		wantErrMsg: `priority: at index 1: duplicate source "rdns"`,
+		names:      []string{"rdns", "rdns"},
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			prio, err := parseSourcePriority(tc.names)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, prio)
+		})
+	}
+}
+
+func TestClientsContainer_groups(t *testing.T) {
+	clients := newClientsContainer(t)
+
+	grp := &client.Group{
+		Name:             "kids",
+		Upstreams:        []string{"1.1.1.3"},
+		FilteringEnabled: true,
+		ParentalEnabled:  true,
+	}
+
+	require.NoError(t, clients.addGroup(grp))
+
+	err := clients.addGroup(&client.Group{Name: grp.Name})
+	testutil.AssertErrorMsg(t, `group "kids" already exists`, err)
+
+	const cliIP = "1.1.1.1"
+
+	err = clients.add(&client.Persistent{
+		Name:  "client_bad_group",
+		Group: "unknown",
+		UID:   client.MustNewUID(),
+		IPs:   []netip.Addr{netip.MustParseAddr("2.2.2.2")},
+	})
+	testutil.AssertErrorMsg(t, `group "unknown" not found`, err)
+
+	err = clients.add(&client.Persistent{
+		Name:  "client",
+		Group: grp.Name,
+		UID:   client.MustNewUID(),
+		IPs:   []netip.Addr{netip.MustParseAddr(cliIP)},
+	})
+	require.NoError(t, err)
+
+	c, ok := clients.findWithGroup(cliIP)
+	require.True(t, ok)
+
+	assert.True(t, c.UseOwnSettings)
+	assert.True(t, c.ParentalEnabled)
+	assert.Equal(t, grp.Upstreams, c.Upstreams)
+
+	err = clients.removeGroup(grp.Name)
+	testutil.AssertErrorMsg(t, `group "kids" is used by client "client"`, err)
+
+	err = clients.updateGroup(grp.Name, &client.Group{Name: "children"})
+	require.NoError(t, err)
+
+	c, ok = clients.find(cliIP)
+	require.True(t, ok)
+
+	assert.Equal(t, "children", c.Group)
+
+	assert.True(t, clients.remove("client"))
+	require.NoError(t, clients.removeGroup("children"))
+
+	assert.Empty(t, clients.groupsForConfig())
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/netip"
+	"slices"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
@@ -40,20 +41,39 @@ type clientJSON struct {
 
 	Name string `json:"name"`
 
+	// Group is the name of the group the client takes the settings it
+	// doesn't override from, if any.
+	Group string `json:"group"`
+
 	// BlockedServices is the names of blocked services.
 	BlockedServices []string `json:"blocked_services"`
 	IDs             []string `json:"ids"`
 	Tags            []string `json:"tags"`
 	Upstreams       []string `json:"upstreams"`
 
+	// ThreatCategories are the threat-feed categories enabled for the client.
+	ThreatCategories []filtering.ThreatCategory `json:"threat_categories"`
+
+	// QueryQuotas are the limits of the numbers of queries of the client.
+	QueryQuotas []*filtering.QueryQuota `json:"query_quotas"`
+
 	FilteringEnabled    bool `json:"filtering_enabled"`
 	ParentalEnabled     bool `json:"parental_enabled"`
 	SafeBrowsingEnabled bool `json:"safebrowsing_enabled"`
+	NewDomainsEnabled   bool `json:"new_domains_enabled"`
 	// Deprecated: use safeSearchConf.
 	SafeSearchEnabled        bool `json:"safesearch_enabled"`
 	UseGlobalBlockedServices bool `json:"use_global_blocked_services"`
 	UseGlobalSettings        bool `json:"use_global_settings"`
 
+	// UseOwnSafeBrowsing defines if SafeBrowsingEnabled is used even if
+	// UseGlobalSettings is true.
+	UseOwnSafeBrowsing bool `json:"use_own_safebrowsing"`
+
+	// UseOwnParental defines if ParentalEnabled is used even if
+	// UseGlobalSettings is true.
+	UseOwnParental bool `json:"use_own_parental"`
+
 	IgnoreQueryLog   aghalg.NullBool `json:"ignore_querylog"`
 	IgnoreStatistics aghalg.NullBool `json:"ignore_statistics"`
 
@@ -68,6 +88,39 @@ type runtimeClientJSON struct {
 	IP     netip.Addr    `json:"ip"`
 	Name   string        `json:"name"`
 	Source client.Source `json:"source"`
+
+	// Tags are the client tags guessed from the DHCP fingerprint, if any.
+	Tags []string `json:"tags,omitempty"`
+
+	// Names are the hostnames of the client from all the sources, if any.
+	Names []*runtimeClientNameJSON `json:"names,omitempty"`
+}
+
+// runtimeClientNameJSON is a JSON representation of a hostname of the runtime
+// client along with its source.
+type runtimeClientNameJSON struct {
+	Name   string        `json:"name"`
+	Source client.Source `json:"source"`
+}
+
+// runtimeClientNames returns the hostnames of rc from all the sources ordered
+// by prio.
+func runtimeClientNames(rc *client.Runtime, prio []client.Source) (names []*runtimeClientNameJSON) {
+	srcs := slices.Concat(prio, client.DefaultPriority)
+	for i, src := range srcs {
+		if slices.Contains(srcs[:i], src) {
+			continue
+		}
+
+		for _, host := range rc.Hosts(src) {
+			names = append(names, &runtimeClientNameJSON{
+				Name:   host,
+				Source: src,
+			})
+		}
+	}
+
+	return names
 }
 
 // clientListJSON contains lists of persistent clients, runtime clients and also
@@ -75,6 +128,7 @@ type runtimeClientJSON struct {
 type clientListJSON struct {
 	Clients        []*clientJSON       `json:"clients"`
 	RuntimeClients []runtimeClientJSON `json:"auto_clients"`
+	Groups         []*clientGroupJSON  `json:"groups"`
 	Tags           []string            `json:"supported_tags"`
 }
 
@@ -104,12 +158,14 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 	})
 
 	clients.runtimeIndex.Range(func(rc *client.Runtime) (cont bool) {
-		src, host := rc.Info()
+		src, host := clients.runtimeInfo(rc)
 		cj := runtimeClientJSON{
 			WHOIS:  whoisOrEmpty(rc),
 			Name:   host,
 			Source: src,
 			IP:     rc.Addr(),
+			Tags:   rc.Tags(),
+			Names:  runtimeClientNames(rc, clients.priority),
 		}
 
 		data.RuntimeClients = append(data.RuntimeClients, cj)
@@ -123,11 +179,13 @@ func (clients *clientsContainer) handleGetClients(w http.ResponseWriter, r *http
 			Source: client.SourceDHCP,
 			IP:     l.IP,
 			WHOIS:  &whois.Info{},
+			Tags:   client.GuessTags(l.Fingerprint),
 		}
 
 		data.RuntimeClients = append(data.RuntimeClients, cj)
 	}
 
+	data.Groups = clients.groupsToJSONLocked()
 	data.Tags = clientTags
 
 	aghhttp.WriteJSONResponseOK(w, r, data)
@@ -207,13 +265,31 @@ func (clients *clientsContainer) jsonToClient(
 
 	c.SafeSearchConf = copySafeSearch(cj.SafeSearchConf, cj.SafeSearchEnabled)
 	c.Name = cj.Name
+	c.Group = cj.Group
 	c.Tags = cj.Tags
 	c.Upstreams = cj.Upstreams
 	c.UseOwnSettings = !cj.UseGlobalSettings
 	c.FilteringEnabled = cj.FilteringEnabled
 	c.ParentalEnabled = cj.ParentalEnabled
 	c.SafeBrowsingEnabled = cj.SafeBrowsingEnabled
+	c.NewDomainsEnabled = cj.NewDomainsEnabled
 	c.UseOwnBlockedServices = !cj.UseGlobalBlockedServices
+	c.UseOwnSafeBrowsing = cj.UseOwnSafeBrowsing
+	c.UseOwnParental = cj.UseOwnParental
+
+	err = filtering.ValidateThreatCategories(cj.ThreatCategories)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threat categories: %w", err)
+	}
+
+	c.ThreatCategories = slices.Clone(cj.ThreatCategories)
+
+	err = filtering.ValidateQueryQuotas(cj.QueryQuotas)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query quotas: %w", err)
+	}
+
+	c.QueryQuotas = filtering.CloneQueryQuotas(cj.QueryQuotas)
 
 	if c.SafeSearchConf.Enabled {
 		err = c.SetSafeSearch(
@@ -295,6 +371,7 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 
 	return &clientJSON{
 		Name:                c.Name,
+		Group:               c.Group,
 		IDs:                 c.IDs(),
 		Tags:                c.Tags,
 		UseGlobalSettings:   !c.UseOwnSettings,
@@ -303,12 +380,18 @@ func clientToJSON(c *client.Persistent) (cj *clientJSON) {
 		SafeSearchEnabled:   safeSearchConf.Enabled,
 		SafeSearchConf:      safeSearchConf,
 		SafeBrowsingEnabled: c.SafeBrowsingEnabled,
+		NewDomainsEnabled:   c.NewDomainsEnabled,
+		UseOwnSafeBrowsing:  c.UseOwnSafeBrowsing,
+		UseOwnParental:      c.UseOwnParental,
 
 		UseGlobalBlockedServices: !c.UseOwnBlockedServices,
 
 		Schedule:        c.BlockedServices.Schedule,
 		BlockedServices: c.BlockedServices.IDs,
 
+		ThreatCategories: c.ThreatCategories,
+		QueryQuotas:      c.QueryQuotas,
+
 		Upstreams: c.Upstreams,
 
 		IgnoreQueryLog:   aghalg.BoolToNullBool(c.IgnoreQueryLog),
@@ -375,6 +458,78 @@ func (clients *clientsContainer) handleDelClient(w http.ResponseWriter, r *http.
 	}
 }
 
+// purgeReqJSON is the request for the POST /control/clients/purge HTTP API.
+type purgeReqJSON struct {
+	// IDs are the IP addresses and the ClientIDs of the clients which data
+	// should be removed.
+	IDs []string `json:"ids"`
+}
+
+// purgeRespJSON is the response for the POST /control/clients/purge HTTP API.
+type purgeRespJSON struct {
+	// QueryLogEntries is the number of the removed query log entries.
+	QueryLogEntries int `json:"querylog_entries"`
+
+	// StatsRequests is the number of the requests removed from the
+	// statistics.
+	StatsRequests uint64 `json:"stats_requests"`
+}
+
+// handlePurgeClient is the handler for POST /control/clients/purge HTTP API.
+// It removes all the query log entries and statistics attributable to the
+// clients.
+func (clients *clientsContainer) handlePurgeClient(w http.ResponseWriter, r *http.Request) {
+	req := &purgeReqJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "failed to process request body: %s", err)
+
+		return
+	}
+
+	if len(req.IDs) == 0 {
+		aghhttp.Error(r, w, http.StatusBadRequest, "ids must be non-empty")
+
+		return
+	}
+
+	ids := make([]string, 0, len(req.IDs))
+	for i, id := range req.IDs {
+		if id == "" {
+			aghhttp.Error(r, w, http.StatusBadRequest, "ids: at index %d: empty value", i)
+
+			return
+		}
+
+		if ip, pErr := netip.ParseAddr(id); pErr == nil {
+			id = ip.Unmap().String()
+		}
+
+		ids = append(ids, id)
+	}
+
+	resp := &purgeRespJSON{}
+	if Context.queryLog != nil {
+		resp.QueryLogEntries, err = Context.queryLog.PurgeClient(ids)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusInternalServerError, "purging query log: %s", err)
+
+			return
+		}
+	}
+
+	if Context.stats != nil {
+		resp.StatsRequests, err = Context.stats.PurgeClient(ids)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusInternalServerError, "purging statistics: %s", err)
+
+			return
+		}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
 // updateJSON contains the name and data of the updated persistent client.
 type updateJSON struct {
 	Name string     `json:"name"`
@@ -485,10 +640,11 @@ func (clients *clientsContainer) findRuntime(ip netip.Addr, idStr string) (cj *c
 		return cj
 	}
 
-	_, host := rc.Info()
+	_, host := clients.runtimeInfo(rc)
 	cj = &clientJSON{
 		Name:  host,
 		IDs:   []string{idStr},
+		Tags:  rc.Tags(),
 		WHOIS: whoisOrEmpty(rc),
 	}
 
@@ -498,6 +654,20 @@ func (clients *clientsContainer) findRuntime(ip netip.Addr, idStr string) (cj *c
 	return cj
 }
 
+// handleRescanClients is the handler for the POST /control/clients/rescan HTTP
+// API.  It reloads the runtime clients from the ARP neighborhood and the system
+// hosts files.
+func (clients *clientsContainer) handleRescanClients(w http.ResponseWriter, r *http.Request) {
+	err := clients.rescan()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "rescanning clients: %s", err)
+
+		return
+	}
+
+	aghhttp.OK(w)
+}
+
 // RegisterClientsHandlers registers HTTP handlers
 func (clients *clientsContainer) registerWebHandlers() {
 	httpRegister(http.MethodGet, "/control/clients", clients.handleGetClients)
@@ -505,4 +675,11 @@ func (clients *clientsContainer) registerWebHandlers() {
 	httpRegister(http.MethodPost, "/control/clients/delete", clients.handleDelClient)
 	httpRegister(http.MethodPost, "/control/clients/update", clients.handleUpdateClient)
 	httpRegister(http.MethodGet, "/control/clients/find", clients.handleFindClient)
+	httpRegister(http.MethodPost, "/control/clients/purge", clients.handlePurgeClient)
+	httpRegister(http.MethodPost, "/control/clients/rescan", clients.handleRescanClients)
+	httpRegister(http.MethodGet, "/control/clients/export", clients.handleExportClients)
+	httpRegister(http.MethodPost, "/control/clients/import", clients.handleImportClients)
+	httpRegister(http.MethodPost, "/control/clients/groups/add", clients.handleAddGroup)
+	httpRegister(http.MethodPost, "/control/clients/groups/delete", clients.handleDelGroup)
+	httpRegister(http.MethodPost, "/control/clients/groups/update", clients.handleUpdateGroup)
 }
@@ -397,3 +397,107 @@ func TestClientsContainer_HandleFindClient(t *testing.T) {
 		})
 	}
 }
+
+func TestClientsContainer_HandleImportClients(t *testing.T) {
+	clientOne := newPersistentClientWithIDs(t, "client1", []string{testClientIP1})
+	clientTwo := newPersistentClientWithIDs(t, "client2", []string{testClientIP2})
+
+	src := newClientsContainer(t)
+	require.NoError(t, src.add(clientOne))
+	require.NoError(t, src.add(clientTwo))
+
+	export := func(t *testing.T, f clientsFormat) (data []byte) {
+		t.Helper()
+
+		rw := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/control/clients/export?format="+string(f), nil)
+		src.handleExportClients(rw, r)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		return rw.Body.Bytes()
+	}
+
+	doImport := func(
+		t *testing.T,
+		clients *clientsContainer,
+		f clientsFormat,
+		mode clientsImportMode,
+		body []byte,
+	) (resp *clientsImportResp) {
+		t.Helper()
+
+		q := url.Values{
+			"format": []string{string(f)},
+			"mode":   []string{string(mode)},
+		}
+		r := httptest.NewRequest(
+			http.MethodPost,
+			"/control/clients/import?"+q.Encode(),
+			bytes.NewReader(body),
+		)
+
+		rw := httptest.NewRecorder()
+		clients.handleImportClients(rw, r)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		resp = &clientsImportResp{}
+		require.NoError(t, json.NewDecoder(rw.Body).Decode(resp))
+
+		return resp
+	}
+
+	for _, f := range []clientsFormat{clientsFormatJSON, clientsFormatYAML} {
+		t.Run(string(f), func(t *testing.T) {
+			dst := newClientsContainer(t)
+			resp := doImport(t, dst, f, clientsImportModeReplace, export(t, f))
+
+			assert.Equal(t, 2, resp.Added)
+			assertPersistentClients(t, dst, []*client.Persistent{clientOne, clientTwo})
+		})
+	}
+
+	clientThree := newPersistentClientWithIDs(t, "client3", []string{"3.3.3.3"})
+	clientClash := newPersistentClientWithIDs(t, "client4", []string{testClientIP2})
+	body, err := json.Marshal([]*clientJSON{
+		clientToJSON(clientThree),
+		clientToJSON(clientClash),
+		{Name: "no_ids"},
+	})
+	require.NoError(t, err)
+
+	t.Run("replace_invalid", func(t *testing.T) {
+		dst := newClientsContainer(t)
+		require.NoError(t, dst.add(newPersistentClientWithIDs(t, "client1", []string{testClientIP2})))
+
+		resp := doImport(t, dst, clientsFormatJSON, clientsImportModeReplace, body)
+
+		assert.Zero(t, resp.Added)
+		assert.Zero(t, resp.Removed)
+		require.Len(t, resp.Results, 3)
+
+		assert.Empty(t, resp.Results[0].Error)
+		assert.Empty(t, resp.Results[1].Error)
+		assert.Equal(t, "id required", resp.Results[2].Error)
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		dst := newClientsContainer(t)
+		require.NoError(t, dst.add(newPersistentClientWithIDs(t, "client3", []string{"4.4.4.4"})))
+		require.NoError(t, dst.add(newPersistentClientWithIDs(t, "client2", []string{testClientIP2})))
+
+		resp := doImport(t, dst, clientsFormatJSON, clientsImportModeMerge, body)
+
+		assert.Equal(t, 1, resp.Updated)
+		assert.Zero(t, resp.Added)
+		require.Len(t, resp.Results, 3)
+
+		assert.Empty(t, resp.Results[0].Error)
+		assert.Equal(t, `another client "client2" uses the same IP "2.2.2.2"`, resp.Results[1].Error)
+		assert.Equal(t, "id required", resp.Results[2].Error)
+
+		assertPersistentClients(t, dst, []*client.Persistent{
+			clientThree,
+			newPersistentClientWithIDs(t, "client2", []string{testClientIP2}),
+		})
+	})
+}
@@ -0,0 +1,380 @@
+package home
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// clientsFormat is the format of the exported persistent clients.
+type clientsFormat string
+
+// Supported clientsFormat values.
+const (
+	// clientsFormatJSON is the JSON array of the client objects as in the
+	// clients HTTP API.
+	clientsFormatJSON clientsFormat = "json"
+
+	// clientsFormatYAML is the YAML sequence of the client objects as in the
+	// clients.persistent section of the configuration file.
+	clientsFormatYAML clientsFormat = "yaml"
+)
+
+// validate returns an error if f is not a supported format.
+func (f clientsFormat) validate() (err error) {
+	switch f {
+	case clientsFormatJSON, clientsFormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q", f)
+	}
+}
+
+// errNilClient is returned when an imported client is null.
+const errNilClient errors.Error = "no value"
+
+// clientsImportMode defines how the imported persistent clients are combined
+// with the existing ones.
+type clientsImportMode string
+
+// Supported clientsImportMode values.
+const (
+	// clientsImportModeMerge adds the imported clients and updates the existing
+	// ones with the same names.  The valid entries are applied even if some
+	// other entries are invalid.
+	clientsImportModeMerge clientsImportMode = "merge"
+
+	// clientsImportModeReplace removes all the existing clients and adds the
+	// imported ones.  Nothing is changed unless all the entries are valid.
+	clientsImportModeReplace clientsImportMode = "replace"
+)
+
+// clientImportResult is the result of the import of a single persistent
+// client.
+type clientImportResult struct {
+	Name string `json:"name"`
+
+	// Error is the error message, if the client hasn't been imported.
+	Error string `json:"error,omitempty"`
+}
+
+// clientsImportResp is the response to the POST /control/clients/import HTTP
+// API.
+type clientsImportResp struct {
+	// Results are the results for the clients in the same order as in the
+	// request.
+	Results []*clientImportResult `json:"results"`
+
+	// Added is the number of the added clients.
+	Added int `json:"added"`
+
+	// Updated is the number of the existing clients updated in the merge
+	// mode.
+	Updated int `json:"updated"`
+
+	// Removed is the number of the existing clients removed in the replace
+	// mode.
+	Removed int `json:"removed"`
+}
+
+// exportClients writes all the persistent clients to w in the format f.
+func (clients *clientsContainer) exportClients(w io.Writer, f clientsFormat) (err error) {
+	if f == clientsFormatYAML {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+
+		// Don't wrap the error since it's informative enough as is.
+		return enc.Encode(clients.forConfig())
+	}
+
+	cjs := []*clientJSON{}
+	func() {
+		clients.lock.Lock()
+		defer clients.lock.Unlock()
+
+		clients.clientIndex.RangeByName(func(c *client.Persistent) (cont bool) {
+			cjs = append(cjs, clientToJSON(c))
+
+			return true
+		})
+	}()
+
+	// Don't wrap the error since it's informative enough as is.
+	return json.NewEncoder(w).Encode(cjs)
+}
+
+// parseImported parses the persistent clients in the format f from r.  The
+// invalid entries are nil in cs and have the errors set in results.  err is
+// only returned if the document itself can't be decoded.
+func (clients *clientsContainer) parseImported(
+	r io.Reader,
+	f clientsFormat,
+) (cs []*client.Persistent, results []*clientImportResult, err error) {
+	var names []string
+	var convErrs []error
+	if f == clientsFormatYAML {
+		var objs []*clientObject
+		err = yaml.NewDecoder(r).Decode(&objs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding yaml: %w", err)
+		}
+
+		filteringConf := &filtering.Config{
+			SafeSearchCacheSize: clients.safeSearchCacheSize,
+			CacheTime:           uint(clients.safeSearchCacheTTL / time.Minute),
+		}
+
+		for i, o := range objs {
+			if o == nil {
+				return nil, nil, fmt.Errorf("client at index %d: %w", i, errNilClient)
+			}
+
+			if o.BlockedServices == nil {
+				o.BlockedServices = &filtering.BlockedServices{
+					Schedule: schedule.EmptyWeekly(),
+				}
+			}
+
+			c, convErr := o.toPersistent(filteringConf, clients.allTags)
+			names, cs, convErrs = append(names, o.Name), append(cs, c), append(convErrs, convErr)
+		}
+	} else {
+		var cjs []clientJSON
+		err = json.NewDecoder(r).Decode(&cjs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding json: %w", err)
+		}
+
+		for _, cj := range cjs {
+			c, convErr := clients.jsonToClient(cj, nil)
+			names, cs, convErrs = append(names, cj.Name), append(cs, c), append(convErrs, convErr)
+		}
+	}
+
+	results = make([]*clientImportResult, 0, len(cs))
+	for i, c := range cs {
+		res := &clientImportResult{
+			Name: names[i],
+		}
+
+		if convErr := convErrs[i]; convErr != nil {
+			res.Error = convErr.Error()
+		} else if checkErr := clients.check(c); checkErr != nil {
+			res.Error = checkErr.Error()
+		}
+
+		if res.Error != "" {
+			cs[i] = nil
+		}
+
+		results = append(results, res)
+	}
+
+	return cs, results, nil
+}
+
+// importClients adds the valid persistent clients from cs according to mode
+// and fills resp.  cs must be checked with [clientsContainer.check].
+func (clients *clientsContainer) importClients(
+	cs []*client.Persistent,
+	mode clientsImportMode,
+	resp *clientsImportResp,
+) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	if mode == clientsImportModeReplace {
+		clients.replaceLocked(cs, resp)
+
+		return
+	}
+
+	for i, c := range cs {
+		if c == nil {
+			continue
+		}
+
+		updated, err := clients.mergeLocked(c)
+		if err != nil {
+			resp.Results[i].Error = err.Error()
+		} else if updated {
+			resp.Updated++
+		} else {
+			resp.Added++
+		}
+	}
+}
+
+// mergeLocked adds c or replaces the existing persistent client with the same
+// name.  clients.lock is expected to be locked.
+func (clients *clientsContainer) mergeLocked(c *client.Persistent) (updated bool, err error) {
+	prev, updated := clients.clientIndex.FindByName(c.Name)
+	if updated {
+		c.UID = prev.UID
+	} else if clients.clientIndex.ClashesUID(c) != nil {
+		c.UID, err = client.NewUID()
+		if err != nil {
+			return false, fmt.Errorf("generating uid: %w", err)
+		}
+	}
+
+	err = clients.clientIndex.Clashes(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+
+	err = clients.checkGroupLocked(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+
+	if updated {
+		clients.removeLocked(prev)
+	}
+
+	clients.addLocked(c)
+
+	return updated, nil
+}
+
+// replaceLocked replaces all the persistent clients with cs, unless any of them
+// is invalid or clashes with another one.  clients.lock is expected to be
+// locked.
+func (clients *clientsContainer) replaceLocked(cs []*client.Persistent, resp *clientsImportResp) {
+	valid := true
+	idx := client.NewIndex()
+	for i, c := range cs {
+		if c == nil {
+			valid = false
+
+			continue
+		}
+
+		if prev, ok := clients.clientIndex.FindByName(c.Name); ok {
+			c.UID = prev.UID
+		}
+
+		err := idx.ClashesUID(c)
+		if err == nil {
+			err = idx.Clashes(c)
+		}
+
+		if err == nil {
+			err = clients.checkGroupLocked(c)
+		}
+
+		if err != nil {
+			resp.Results[i].Error = err.Error()
+			valid = false
+
+			continue
+		}
+
+		idx.Add(c)
+	}
+
+	if !valid {
+		return
+	}
+
+	var prevs []*client.Persistent
+	clients.clientIndex.Range(func(c *client.Persistent) (cont bool) {
+		prevs = append(prevs, c)
+
+		return true
+	})
+
+	for _, c := range prevs {
+		clients.removeLocked(c)
+	}
+
+	for _, c := range cs {
+		clients.addLocked(c)
+	}
+
+	resp.Removed, resp.Added = len(prevs), len(cs)
+}
+
+// handleExportClients is the handler for the GET /control/clients/export HTTP
+// API.  It writes all the persistent clients in the format from the format
+// query parameter.
+func (clients *clientsContainer) handleExportClients(w http.ResponseWriter, r *http.Request) {
+	f := clientsFormat(r.URL.Query().Get("format"))
+	err := f.validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: %s", err)
+
+		return
+	}
+
+	h := w.Header()
+	if f == clientsFormatYAML {
+		h.Set(httphdr.ContentType, aghhttp.HdrValTextPlain)
+	} else {
+		h.Set(httphdr.ContentType, aghhttp.HdrValApplicationJSON)
+	}
+
+	h.Set(httphdr.ContentDisposition, fmt.Sprintf("attachment; filename=\"clients.%s\"", f))
+
+	err = clients.exportClients(w, f)
+	if err != nil {
+		log.Debug("clients: exporting: %s", err)
+	}
+}
+
+// handleImportClients is the handler for the POST /control/clients/import HTTP
+// API.  The format of the request body is set by the format query parameter
+// and the way the clients are imported by the mode one.
+func (clients *clientsContainer) handleImportClients(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := clientsFormat(q.Get("format"))
+	err := f.validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: %s", err)
+
+		return
+	}
+
+	mode := clientsImportMode(q.Get("mode"))
+	switch mode {
+	case "":
+		mode = clientsImportModeMerge
+	case clientsImportModeMerge, clientsImportModeReplace:
+		// Go on.
+	default:
+		aghhttp.Error(r, w, http.StatusBadRequest, "bad mode %q", mode)
+
+		return
+	}
+
+	cs, results, err := clients.parseImported(r.Body, f)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing clients: %s", err)
+
+		return
+	}
+
+	resp := &clientsImportResp{
+		Results: results,
+	}
+
+	clients.importClients(cs, mode, resp)
+	if resp.Added+resp.Updated+resp.Removed > 0 && !clients.testing {
+		onConfigModified()
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
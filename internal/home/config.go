@@ -7,13 +7,18 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghtls"
 	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnstap"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/metrics"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/schedule"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
@@ -22,6 +27,7 @@ import (
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/c2h5oh/datasize"
 	"github.com/google/renameio/v2/maybe"
 	yaml "gopkg.in/yaml.v3"
 )
@@ -58,6 +64,14 @@ type logSettings struct {
 
 	// Verbose determines, if verbose (aka debug) logging is enabled.
 	Verbose bool `yaml:"verbose"`
+
+	// Format is the format of the log entries, see [aghlog.Format].  The
+	// default is "text".
+	Format aghlog.Format `yaml:"format,omitempty"`
+
+	// Levels are the log levels of the modules, such as "dnsforward", which
+	// override the one defined by Verbose.
+	Levels map[string]aghlog.Level `yaml:"levels,omitempty"`
 }
 
 // osConfig contains OS-related configuration.
@@ -78,11 +92,19 @@ type clientsConfig struct {
 	Sources *clientSourcesConfig `yaml:"runtime_sources"`
 	// Persistent are the configured clients.
 	Persistent []*clientObject `yaml:"persistent"`
+	// Groups are the configured client groups.
+	Groups []*clientGroupObject `yaml:"groups"`
 }
 
 // clientSourceConfig is used to configure where the runtime clients will be
 // obtained from.
 type clientSourcesConfig struct {
+	// Priority is the order of the sources of the runtime clients' hostnames,
+	// from the highest priority to the lowest.  The values are "arp",
+	// "rdns", "dhcp", and "hosts".  The sources missing from it have lower
+	// priority in the default order.
+	Priority []string `yaml:"priority,omitempty"`
+
 	WHOIS     bool `yaml:"whois"`
 	ARP       bool `yaml:"arp"`
 	RDNS      bool `yaml:"rdns"`
@@ -99,10 +121,26 @@ type configuration struct {
 	// It's reset after config is parsed
 	fileData []byte
 
+	// included is the merged contents of the included configuration files.  It
+	// is nil if there are none.
+	included *yaml.Node
+
+	// refs are the original environment variable and file references replaced
+	// with their values during decoding, which are restored when writing.
+	refs configRefs
+
+	// Include are the glob patterns of the configuration files merged beneath
+	// this one.  The relative patterns are resolved against the directory of
+	// the configuration file.
+	Include []string `yaml:"include,omitempty"`
+
 	// HTTPConfig is the block with http conf.
 	HTTPConfig httpConfig `yaml:"http"`
 	// Users are the clients capable for accessing the web interface.
 	Users []webUser `yaml:"users"`
+	// APITokens are the long-lived tokens for using the HTTP API without the
+	// password of a user.
+	APITokens []apiToken `yaml:"api_tokens,omitempty"`
 	// AuthAttempts is the maximum number of failed login attempts a user
 	// can do before being blocked.
 	AuthAttempts uint `yaml:"auth_attempts"`
@@ -111,6 +149,9 @@ type configuration struct {
 	AuthBlockMin uint `yaml:"block_auth_min"`
 	// ProxyURL is the address of proxy server for the internal HTTP client.
 	ProxyURL string `yaml:"http_proxy"`
+	// AddrFamilies are the address families preferred by the internal HTTP
+	// clients.
+	AddrFamilies addrFamiliesConfig `yaml:"address_families"`
 	// Language is a two-letter ISO 639-1 language code.
 	Language string `yaml:"language"`
 	// Theme is a UI theme for current user.
@@ -147,6 +188,24 @@ type configuration struct {
 
 	OSConfig *osConfig `yaml:"os"`
 
+	// Sync is the configuration of the synchronization with the other
+	// instances.
+	Sync *syncConfig `yaml:"sync,omitempty"`
+
+	// MDNS is the configuration of the advertising of the service endpoints
+	// over mDNS and DNS-SD.
+	MDNS *mdnsConfig `yaml:"mdns,omitempty"`
+
+	// Webhooks is the configuration of the webhooks sending the server events.
+	Webhooks *webhooksConfig `yaml:"webhooks,omitempty"`
+
+	// MQTT is the configuration of the MQTT and Home Assistant integration.
+	MQTT *mqttConfig `yaml:"mqtt,omitempty"`
+
+	// SNMP is the configuration of the SNMP agent exposing the resolver
+	// statistics.
+	SNMP *snmpConfig `yaml:"snmp,omitempty"`
+
 	sync.RWMutex `yaml:"-"`
 
 	// SchemaVersion is the version of the configuration schema.  See
@@ -162,9 +221,23 @@ type httpConfig struct {
 	// Pprof defines the profiling HTTP handler.
 	Pprof *httpPprofConfig `yaml:"pprof"`
 
+	// Metrics defines the Prometheus metrics HTTP handler.
+	Metrics *httpMetricsConfig `yaml:"metrics"`
+
 	// Address is the address to serve the web UI on.
 	Address netip.AddrPort
 
+	// DoHAddress is the address to serve only DNS-over-HTTPS on, so that DoH
+	// may be exposed publicly without exposing the web UI and the HTTP API.  It
+	// is only used when encryption is enabled.  If zero, DoH is only served on
+	// the web UI addresses.
+	DoHAddress netip.AddrPort `yaml:"doh_address"`
+
+	// AllowedNetworks are the networks of the clients allowed to access the web
+	// UI and the HTTP API.  DoH, ACME challenges, and the health endpoints are
+	// accessible from any network.  If empty, all clients are allowed.
+	AllowedNetworks []netip.Prefix `yaml:"allowed_networks,omitempty"`
+
 	// SessionTTL for a web session.
 	// An active session is automatically refreshed once a day.
 	SessionTTL timeutil.Duration `yaml:"session_ttl"`
@@ -179,6 +252,69 @@ type httpPprofConfig struct {
 	Enabled bool `yaml:"enabled"`
 }
 
+// httpMetricsConfig is the block with the Prometheus metrics HTTP
+// configuration.
+type httpMetricsConfig struct {
+	// Enabled defines if the metrics are served on the /metrics path of the
+	// web UI address.
+	Enabled bool `yaml:"enabled"`
+
+	// RequireAuth defines if the metrics require the same authentication as
+	// the web UI.
+	RequireAuth bool `yaml:"require_auth"`
+
+	// Push defines pushing the metrics to a monitoring system.  It works
+	// regardless of Enabled.
+	Push *metricsPushConfig `yaml:"push"`
+}
+
+// metricsPushConfig is the block with the configuration of pushing the metrics
+// to a monitoring system.
+type metricsPushConfig struct {
+	// Format is the format of the pushed metrics, see [metrics.PushFormat].
+	Format metrics.PushFormat `yaml:"format"`
+
+	// URL is the base URL of the InfluxDB v2 server, the udp:// URL of the
+	// StatsD server, or the tcp:// URL of the Graphite server.
+	URL string `yaml:"url"`
+
+	// Token is the API token of InfluxDB.
+	Token string `yaml:"token"`
+
+	// Org is the organization of InfluxDB.
+	Org string `yaml:"org"`
+
+	// Bucket is the bucket of InfluxDB.
+	Bucket string `yaml:"bucket"`
+
+	// Interval is the interval between the pushes.
+	Interval timeutil.Duration `yaml:"interval"`
+
+	// Enabled defines if the metrics are pushed.
+	Enabled bool `yaml:"enabled"`
+}
+
+// addrFamiliesConfig is the configuration of the address families preferred
+// for the outgoing connections of the different components.  The preference of
+// the upstream bootstrap is set by [dnsforward.Config.BootstrapPreferIPv6].
+type addrFamiliesConfig struct {
+	// Filters is the address family preferred for downloading the filter
+	// lists.
+	Filters aghnet.AddrFamilyPref `yaml:"filters"`
+
+	// Updates is the address family preferred for checking for and
+	// downloading the updates.
+	Updates aghnet.AddrFamilyPref `yaml:"updates"`
+}
+
+// validate returns an error if c contains an invalid preference.
+func (c *addrFamiliesConfig) validate() (err error) {
+	return errors.Join(
+		errors.Annotate(c.Filters.Validate(), "filters: %w"),
+		errors.Annotate(c.Updates.Validate(), "updates: %w"),
+	)
+}
+
 // dnsConfig is a block with DNS configuration params.
 //
 // Field ordering is important, YAML fields better not to be reordered, if it's
@@ -187,6 +323,10 @@ type dnsConfig struct {
 	BindHosts []netip.Addr `yaml:"bind_hosts"`
 	Port      uint16       `yaml:"port"`
 
+	// Listeners are the additional plain-DNS listeners with their own
+	// settings.
+	Listeners []*dnsListenerConfig `yaml:"listeners,omitempty"`
+
 	// AnonymizeClientIP defines if clients' IP addresses should be anonymized
 	// in query log and statistics.
 	AnonymizeClientIP bool `yaml:"anonymize_client_ip"`
@@ -245,6 +385,9 @@ type dnsConfig struct {
 	// HostsFileEnabled defines whether to use information from the system hosts
 	// file to resolve queries.
 	HostsFileEnabled bool `yaml:"hostsfile_enabled"`
+
+	// Dnstap is the configuration of the dnstap output.
+	Dnstap dnstap.Config `yaml:"dnstap"`
 }
 
 type tlsConfigSettings struct {
@@ -268,6 +411,10 @@ type tlsConfigSettings struct {
 	// Allow DoH queries via unencrypted HTTP (e.g. for reverse proxying)
 	AllowUnencryptedDoH bool `yaml:"allow_unencrypted_doh" json:"allow_unencrypted_doh"`
 
+	// ACME is the configuration of obtaining the certificate with ACME.  It's
+	// only set in the configuration file.
+	ACME *acmeConfig `yaml:"acme,omitempty" json:"acme,omitempty"`
+
 	dnsforward.TLSConfig `yaml:",inline" json:",inline"`
 }
 
@@ -287,11 +434,41 @@ type queryLogConfig struct {
 	// to disk.
 	MemSize uint `yaml:"size_memory"`
 
+	// FlushInterval is the maximum time the entries are kept in memory before
+	// they are flushed to disk.  Zero means that they are only flushed once
+	// there are MemSize of them.
+	FlushInterval timeutil.Duration `yaml:"flush_interval"`
+
+	// MaxSize is the maximum total size of the query log files.  The oldest
+	// entries are removed once it's exceeded.  Zero means no limit.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+
+	// SampleRate is the sampling rate of the queries that aren't filtered:
+	// only one in SampleRate of them is logged.  Zero and one mean that all
+	// queries are logged.
+	SampleRate uint `yaml:"sample_rate"`
+
 	// Enabled defines if the query log is enabled.
 	Enabled bool `yaml:"enabled"`
 
 	// FileEnabled defines, if the query log is written to the file.
 	FileEnabled bool `yaml:"file_enabled"`
+
+	// Compress defines if the rotated query log files are compressed.
+	Compress bool `yaml:"compress"`
+
+	// Syslog is the configuration of the syslog output of the query log.
+	Syslog querylog.SyslogConfig `yaml:"syslog"`
+
+	// Storage is the configuration of the remote storage of the query log.
+	Storage querylog.StorageConfig `yaml:"storage"`
+
+	// Rollup is the configuration of the pre-aggregated summaries of the query
+	// log.
+	Rollup querylog.RollupConfig `yaml:"rollup"`
+
+	// Privacy is the configuration of the anonymization of the query log.
+	Privacy dnsforward.PrivacyConfig `yaml:"privacy"`
 }
 
 type statsConfig struct {
@@ -305,8 +482,20 @@ type statsConfig struct {
 	// Interval is the retention interval for statistics.
 	Interval timeutil.Duration `yaml:"interval"`
 
+	// DailyInterval is the retention interval for the daily statistics, which
+	// the hourly statistics older than Interval are downsampled to.  Zero
+	// means that the old statistics are removed without downsampling.
+	DailyInterval timeutil.Duration `yaml:"daily_interval"`
+
+	// ResetPeriod is the period after which the statistics are reset, for
+	// example "month".  Empty means that the statistics are never reset.
+	ResetPeriod stats.Period `yaml:"reset_period"`
+
 	// Enabled defines if the statistics are enabled.
 	Enabled bool `yaml:"enabled"`
+
+	// Privacy is the configuration of the anonymization of the statistics.
+	Privacy dnsforward.PrivacyConfig `yaml:"privacy"`
 }
 
 // Default block host constants.
@@ -328,6 +517,15 @@ var config = &configuration{
 			Enabled: false,
 			Port:    6060,
 		},
+		Metrics: &httpMetricsConfig{
+			Enabled:     false,
+			RequireAuth: true,
+			Push: &metricsPushConfig{
+				Format:   metrics.PushFormatInfluxDB,
+				Interval: timeutil.Duration{Duration: 1 * time.Minute},
+				Enabled:  false,
+			},
+		},
 	},
 	DNS: dnsConfig{
 		BindHosts: []netip.Addr{netip.IPv4Unspecified()},
@@ -356,6 +554,12 @@ var config = &configuration{
 				UseCustom: false,
 			},
 
+			EDNSClientMAC: &dnsforward.EDNSClientMAC{
+				TrustedForwarders: nil,
+				OptionCode:        0,
+				Enabled:           false,
+			},
+
 			// set default maximum concurrent queries to 300
 			// we introduced a default limit due to this:
 			// https://github.com/AdguardTeam/AdGuardHome/issues/2015#issuecomment-674041912
@@ -378,6 +582,16 @@ var config = &configuration{
 		Interval:    timeutil.Duration{Duration: 90 * timeutil.Day},
 		MemSize:     1000,
 		Ignored:     []string{},
+		Syslog: querylog.SyslogConfig{
+			Network: "udp",
+			Address: "127.0.0.1:514",
+			Enabled: false,
+		},
+		Rollup: querylog.RollupConfig{
+			Window:    timeutil.Duration{Duration: time.Hour},
+			Retention: timeutil.Duration{Duration: 90 * timeutil.Day},
+			Enabled:   false,
+		},
 	},
 	Stats: statsConfig{
 		Enabled:  true,
@@ -426,6 +640,15 @@ var config = &configuration{
 			YouTube:    true,
 		},
 
+		NewDomainsConf: filtering.NewDomainsConfig{
+			Action:     filtering.NewDomainActionBlock,
+			Source:     filtering.NewDomainSourceRDAP,
+			CacheTTL:   timeutil.Duration{Duration: timeutil.Day},
+			CacheSize:  1 * 1024 * 1024,
+			MaxAgeDays: 30,
+			Enabled:    false,
+		},
+
 		BlockedServices: &filtering.BlockedServices{
 			Schedule: schedule.EmptyWeekly(),
 			IDs:      []string{},
@@ -533,7 +756,7 @@ func parseConfig() (err error) {
 		}
 	}
 
-	err = yaml.Unmarshal(config.fileData, &config)
+	err = config.decodeConfig(config.fileData, filepath.Dir(configFilePath()))
 	if err != nil {
 		// Don't wrap the error since it's informative enough as is.
 		return err
@@ -560,6 +783,11 @@ func validateConfig() (err error) {
 		return err
 	}
 
+	err = validateDNSListeners(config.DNS.BindHosts, config.DNS.Port, config.DNS.Listeners)
+	if err != nil {
+		return fmt.Errorf("dns.listeners: %w", err)
+	}
+
 	tcpPorts := aghalg.UniqChecker[tcpPort]{}
 	addPorts(tcpPorts, tcpPort(config.HTTPConfig.Address.Port()))
 
@@ -572,6 +800,7 @@ func validateConfig() (err error) {
 			tcpPort(config.TLS.PortHTTPS),
 			tcpPort(config.TLS.PortDNSOverTLS),
 			tcpPort(config.TLS.PortDNSCrypt),
+			tcpPort(config.HTTPConfig.DoHAddress.Port()),
 		)
 
 		// TODO(e.burkov):  Consider adding a udpPort with the same value when
@@ -589,6 +818,11 @@ func validateConfig() (err error) {
 		config.Filtering.FiltersUpdateIntervalHours = 24
 	}
 
+	err = config.AddrFamilies.validate()
+	if err != nil {
+		return fmt.Errorf("address_families: %w", err)
+	}
+
 	return nil
 }
 
@@ -627,6 +861,7 @@ func (c *configuration) write() (err error) {
 
 	if Context.auth != nil {
 		config.Users = Context.auth.usersList()
+		config.APITokens = Context.auth.tokensList()
 	}
 
 	if Context.tls != nil {
@@ -639,6 +874,8 @@ func (c *configuration) write() (err error) {
 		statsConf := stats.Config{}
 		Context.stats.WriteDiskConfig(&statsConf)
 		config.Stats.Interval = timeutil.Duration{Duration: statsConf.Limit}
+		config.Stats.DailyInterval = timeutil.Duration{Duration: statsConf.DailyLimit}
+		config.Stats.ResetPeriod = statsConf.ResetPeriod
 		config.Stats.Enabled = statsConf.Enabled
 		config.Stats.Ignored = statsConf.Ignored.Values()
 	}
@@ -649,8 +886,12 @@ func (c *configuration) write() (err error) {
 		config.DNS.AnonymizeClientIP = dc.AnonymizeClientIP
 		config.QueryLog.Enabled = dc.Enabled
 		config.QueryLog.FileEnabled = dc.FileEnabled
+		config.QueryLog.Compress = dc.Compress
 		config.QueryLog.Interval = timeutil.Duration{Duration: dc.RotationIvl}
 		config.QueryLog.MemSize = dc.MemSize
+		config.QueryLog.FlushInterval = timeutil.Duration{Duration: dc.FlushInterval}
+		config.QueryLog.MaxSize = datasize.ByteSize(dc.MaxSize)
+		config.QueryLog.SampleRate = dc.SampleRate
 		config.QueryLog.Ignored = dc.Ignored.Values()
 	}
 
@@ -680,15 +921,21 @@ func (c *configuration) write() (err error) {
 	}
 
 	config.Clients.Persistent = Context.clients.forConfig()
+	config.Clients.Groups = Context.clients.groupsForConfig()
 
 	confPath := configFilePath()
 	log.Debug("writing config file %q", confPath)
 
+	n, err := config.encodeConfig()
+	if err != nil {
+		return fmt.Errorf("generating config file: %w", err)
+	}
+
 	buf := &bytes.Buffer{}
 	enc := yaml.NewEncoder(buf)
 	enc.SetIndent(2)
 
-	err = enc.Encode(config)
+	err = enc.Encode(n)
 	if err != nil {
 		return fmt.Errorf("generating config file: %w", err)
 	}
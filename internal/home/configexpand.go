@@ -0,0 +1,244 @@
+package home
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Syntax of the references in the configuration values.
+const (
+	// envRefStart and envRefEnd enclose the name of an environment variable,
+	// which value replaces the reference.
+	envRefStart = "${"
+	envRefEnd   = "}"
+
+	// envRefEscaped is replaced with a literal [envRefStart].
+	envRefEscaped = "$${"
+
+	// fileRefPrefix starts the values which are replaced with the contents of
+	// the file with the following path.  The relative paths are resolved
+	// against the directory of the configuration file.
+	fileRefPrefix = "file://"
+)
+
+// noFileRefKeys are the top-level keys of the sections which values may
+// legitimately start with [fileRefPrefix], so that such values aren't treated as
+// the file references.
+var noFileRefKeys = []string{
+	"filters",
+	"whitelist_filters",
+}
+
+// noExpandKeys are the top-level keys of the sections which values are never
+// expanded, since the filtering rules use "$" in their own syntax.
+var noExpandKeys = []string{
+	"user_rules",
+}
+
+// configRefs are the original values of the expanded references by the paths
+// of the nodes and by the expanded values.  The paths don't contain the indexes
+// of the sequence items, so that the references are restored after the items
+// are reordered.
+type configRefs map[string]map[string]string
+
+// expandYAML replaces the environment variable and the file references in the
+// string values within n and returns the original values of the replaced ones.
+// confDir is the directory of the configuration file.
+func expandYAML(n *yaml.Node, confDir string) (refs configRefs, err error) {
+	refs = configRefs{}
+	err = refs.expand(n, "", confDir, true)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// expand expands the values within n located at path.  fileRefs is false if
+// n is within one of the [noFileRefKeys] sections.
+func (refs configRefs) expand(n *yaml.Node, path, confDir string, fileRefs bool) (err error) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			k := n.Content[i].Value
+			if path == "" && slices.Contains(noExpandKeys, k) {
+				continue
+			}
+
+			allowFile := fileRefs && !(path == "" && slices.Contains(noFileRefKeys, k))
+			err = refs.expand(n.Content[i+1], joinYAMLPath(path, k), confDir, allowFile)
+			if err != nil {
+				// Don't wrap the error since it's informative enough as is.
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			err = refs.expand(c, path+"[]", confDir, fileRefs)
+			if err != nil {
+				return fmt.Errorf("at index %d: %w", i, err)
+			}
+		}
+	case yaml.ScalarNode:
+		return refs.expandScalar(n, path, confDir, fileRefs)
+	default:
+		// Go on.
+	}
+
+	return nil
+}
+
+// expandScalar expands the value of the string scalar n located at path.
+func (refs configRefs) expandScalar(n *yaml.Node, path, confDir string, fileRefs bool) (err error) {
+	if n.ShortTag() != "!!str" {
+		return nil
+	}
+
+	orig := n.Value
+	var val string
+	if fileRefs && strings.HasPrefix(orig, fileRefPrefix) {
+		val, err = readFileRef(strings.TrimPrefix(orig, fileRefPrefix), confDir)
+	} else if strings.Contains(orig, envRefStart) {
+		val, err = expandEnvRefs(orig)
+	} else {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	} else if val == orig {
+		return nil
+	}
+
+	if refs[path] == nil {
+		refs[path] = map[string]string{}
+	}
+
+	refs[path][val] = orig
+	n.Value = val
+	n.Style = 0
+
+	return nil
+}
+
+// restore replaces the expanded values within n located at path with the
+// original references.  It's the inverse of [configRefs.expand].
+func (refs configRefs) restore(n *yaml.Node, path string) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			refs.restore(n.Content[i+1], joinYAMLPath(path, n.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			refs.restore(c, path+"[]")
+		}
+	case yaml.ScalarNode:
+		orig, ok := refs[path][n.Value]
+		if ok {
+			n.Value = orig
+			n.Style = 0
+		}
+	default:
+		// Go on.
+	}
+}
+
+// joinYAMLPath returns the path of the value with key within the mapping at
+// path.
+func joinYAMLPath(path, key string) (res string) {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// readFileRef returns the contents of the file at p without the trailing
+// newlines.  p is relative to confDir unless absolute.
+func readFileRef(p, confDir string) (val string, err error) {
+	if p == "" {
+		return "", errors.Error("empty file path")
+	} else if !filepath.IsAbs(p) {
+		p = filepath.Join(confDir, p)
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("reading secret file: %w", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// expandEnvRefs replaces the environment variable references in s with their
+// values.  Unlike [os.Expand], only the braced form is recognized, since the
+// values like password hashes often contain "$".  It returns an error if a
+// referenced variable isn't set.
+func expandEnvRefs(s string) (res string, err error) {
+	b := &strings.Builder{}
+	for {
+		i := strings.Index(s, "$")
+		if i < 0 {
+			b.WriteString(s)
+
+			return b.String(), nil
+		}
+
+		b.WriteString(s[:i])
+		s = s[i:]
+
+		switch {
+		case strings.HasPrefix(s, envRefEscaped):
+			b.WriteString(envRefStart)
+			s = s[len(envRefEscaped):]
+		case strings.HasPrefix(s, envRefStart):
+			end := strings.Index(s, envRefEnd)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference in %q", s)
+			}
+
+			name := s[len(envRefStart):end]
+			if !isEnvName(name) {
+				return "", fmt.Errorf("bad environment variable name %q", name)
+			}
+
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				return "", fmt.Errorf("environment variable %q is not set", name)
+			}
+
+			b.WriteString(val)
+			s = s[end+len(envRefEnd):]
+		default:
+			b.WriteByte('$')
+			s = s[1:]
+		}
+	}
+}
+
+// isEnvName returns true if name is a valid environment variable name.
+func isEnvName(name string) (ok bool) {
+	if name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		if c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			continue
+		} else if i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
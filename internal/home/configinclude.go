@@ -0,0 +1,300 @@
+package home
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Keys of the main configuration file, which the included files must not
+// contain.
+const (
+	includeKey       = "include"
+	schemaVersionKey = "schema_version"
+)
+
+// includedFiles returns the paths of the files matching the include patterns,
+// which are relative to confDir unless absolute.  The files matching each
+// pattern are sorted lexically, the patterns are processed in order, and each
+// file is only included once.
+func includedFiles(confDir string, patterns []string) (paths []string, err error) {
+	seen := container.NewMapSet[string]()
+	for i, pat := range patterns {
+		if !filepath.IsAbs(pat) {
+			pat = filepath.Join(confDir, pat)
+		}
+
+		var matches []string
+		matches, err = filepath.Glob(pat)
+		if err != nil {
+			return nil, fmt.Errorf("include at index %d: %w", i, err)
+		}
+
+		slices.Sort(matches)
+		for _, m := range matches {
+			if !seen.Has(m) {
+				seen.Add(m)
+				paths = append(paths, m)
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// readIncluded reads the files from paths and merges them in order into a
+// single mapping node.  Each file must contain a mapping without the include
+// and the schema version keys.
+func readIncluded(paths []string) (inc *yaml.Node, err error) {
+	inc = &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  "!!map",
+	}
+
+	for _, p := range paths {
+		log.Debug("reading included config file %q", p)
+
+		var n *yaml.Node
+		n, err = readIncludedFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("included file %q: %w", p, err)
+		}
+
+		inc = mergeYAML(inc, n)
+	}
+
+	return inc, nil
+}
+
+// readIncludedFile reads and validates a single included file.  n is nil if the
+// file is empty.
+func readIncludedFile(p string) (n *yaml.Node, err error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	} else if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	n = doc.Content[0]
+	if n.Kind != yaml.MappingNode {
+		return nil, errors.Error("not a mapping")
+	}
+
+	for i := 0; i < len(n.Content); i += 2 {
+		switch k := n.Content[i].Value; k {
+		case includeKey, schemaVersionKey:
+			return nil, fmt.Errorf("key %q is only allowed in the main file", k)
+		default:
+			// Go on.
+		}
+	}
+
+	return n, nil
+}
+
+// mergeYAML merges src into dst and returns the result.  The mappings are
+// merged recursively, the sequences are concatenated, and any other value from
+// src replaces the one from dst.  A nil src leaves dst as is.
+func mergeYAML(dst, src *yaml.Node) (res *yaml.Node) {
+	if src == nil {
+		return dst
+	} else if dst == nil || dst.Kind != src.Kind {
+		return src
+	}
+
+	switch src.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(src.Content); i += 2 {
+			k, v := src.Content[i], src.Content[i+1]
+			j := mappingIndex(dst, k.Value)
+			if j < 0 {
+				dst.Content = append(dst.Content, k, v)
+			} else {
+				dst.Content[j+1] = mergeYAML(dst.Content[j+1], v)
+			}
+		}
+
+		return dst
+	case yaml.SequenceNode:
+		dst.Content = append(dst.Content, src.Content...)
+
+		return dst
+	default:
+		return src
+	}
+}
+
+// subtractYAML removes from n the values which are equal to the ones in inc,
+// so that merging inc back into n restores the original value.  It returns
+// true if nothing is left of n.
+func subtractYAML(n, inc *yaml.Node) (empty bool) {
+	if n.Kind != inc.Kind {
+		return false
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(inc.Content); i += 2 {
+			j := mappingIndex(n, inc.Content[i].Value)
+			if j >= 0 && subtractYAML(n.Content[j+1], inc.Content[i+1]) {
+				n.Content = slices.Delete(n.Content, j, j+2)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range inc.Content {
+			j := slices.IndexFunc(n.Content, func(c *yaml.Node) (ok bool) {
+				return equalYAML(c, item)
+			})
+			if j >= 0 {
+				n.Content = slices.Delete(n.Content, j, j+1)
+			}
+		}
+	default:
+		return equalYAML(n, inc)
+	}
+
+	return len(n.Content) == 0
+}
+
+// mappingIndex returns the index of the key in the mapping node n or -1 if
+// there is no such key.
+func mappingIndex(n *yaml.Node, key string) (i int) {
+	for i = 0; i < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// equalYAML returns true if a and b represent the same value, regardless of the
+// style and the position.
+func equalYAML(a, b *yaml.Node) (ok bool) {
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+
+	if a.Kind == yaml.ScalarNode {
+		return a.Value == b.Value && a.ShortTag() == b.ShortTag()
+	}
+
+	for i, c := range a.Content {
+		if !equalYAML(c, b.Content[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeConfig decodes the main configuration file data into c, merging the
+// included files, if any, beneath it, and expanding the references.
+func (c *configuration) decodeConfig(data []byte, confDir string) (err error) {
+	return c.decodeConfigIncluding(data, confDir, confDir)
+}
+
+// decodeConfigIncluding is like [configuration.decodeConfig], but resolves the
+// relative include patterns against incDir instead of confDir.
+func (c *configuration) decodeConfigIncluding(data []byte, confDir, incDir string) (err error) {
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	} else if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+
+	var incl struct {
+		Include []string `yaml:"include"`
+	}
+	err = root.Decode(&incl)
+	if err != nil {
+		return fmt.Errorf("decoding include: %w", err)
+	}
+
+	c.included = nil
+	if len(incl.Include) > 0 {
+		var paths []string
+		paths, err = includedFiles(incDir, incl.Include)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		c.included, err = readIncluded(paths)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		log.Info("merged %d included config files", len(paths))
+
+		// Merge into a copy, since the merging modifies the destination and
+		// c.included is required later for writing.
+		root = mergeYAML(cloneYAML(c.included), root)
+	}
+
+	c.refs, err = expandYAML(root, confDir)
+	if err != nil {
+		return fmt.Errorf("expanding references: %w", err)
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return root.Decode(c)
+}
+
+// cloneYAML returns a deep copy of n.
+func cloneYAML(n *yaml.Node) (clone *yaml.Node) {
+	if n == nil {
+		return nil
+	}
+
+	clone = &yaml.Node{}
+	*clone = *n
+	clone.Content = make([]*yaml.Node, 0, len(n.Content))
+	for _, c := range n.Content {
+		clone.Content = append(clone.Content, cloneYAML(c))
+	}
+
+	return clone
+}
+
+// encodeConfig returns the node representing c to be written into the main
+// configuration file.  The values which came from the included files are left
+// out so that they aren't duplicated in the main file, and the expanded
+// references are replaced back so that the secrets aren't written.
+func (c *configuration) encodeConfig() (n *yaml.Node, err error) {
+	n = &yaml.Node{}
+	err = n.Encode(c)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	c.refs.restore(n, "")
+
+	if c.included != nil {
+		_ = subtractYAML(n, c.included)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,220 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// newTestYAML returns the root node of the YAML document from s.
+func newTestYAML(t *testing.T, s string) (n *yaml.Node) {
+	t.Helper()
+
+	doc := &yaml.Node{}
+	require.NoError(t, yaml.Unmarshal([]byte(s), doc))
+	require.NotEmpty(t, doc.Content)
+
+	return doc.Content[0]
+}
+
+// assertYAML checks that n represents the same value as the YAML from want.
+func assertYAML(t *testing.T, want string, n *yaml.Node) {
+	t.Helper()
+
+	var wantVal, gotVal any
+	require.NoError(t, yaml.Unmarshal([]byte(want), &wantVal))
+	require.NoError(t, n.Decode(&gotVal))
+
+	assert.Equal(t, wantVal, gotVal)
+}
+
+func TestMergeYAML(t *testing.T) {
+	testCases := []struct {
+		dst  string
+		src  string
+		want string
+		name string
+	}{{
+		dst:  "a: 1\nb: 2\n",
+		src:  "b: 3\nc: 4\n",
+		want: "a: 1\nb: 3\nc: 4\n",
+		name: "scalars",
+	}, {
+		dst:  "user_rules: [a, b]\n",
+		src:  "user_rules: [c]\n",
+		want: "user_rules: [a, b, c]\n",
+		name: "sequences",
+	}, {
+		dst:  "dns: {port: 53, upstream_dns: [a]}\n",
+		src:  "dns: {upstream_dns: [b], ratelimit: 0}\n",
+		want: "dns: {port: 53, upstream_dns: [a, b], ratelimit: 0}\n",
+		name: "nested",
+	}, {
+		dst:  "clients:\n",
+		src:  "clients: {persistent: []}\n",
+		want: "clients: {persistent: []}\n",
+		name: "kind_mismatch",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := mergeYAML(newTestYAML(t, tc.dst), newTestYAML(t, tc.src))
+			assertYAML(t, tc.want, res)
+		})
+	}
+}
+
+func TestSubtractYAML(t *testing.T) {
+	testCases := []struct {
+		n         string
+		inc       string
+		want      string
+		name      string
+		wantEmpty bool
+	}{{
+		n:         "a: 1\nb: 2\n",
+		inc:       "b: 2\n",
+		want:      "a: 1\n",
+		name:      "scalar",
+		wantEmpty: false,
+	}, {
+		n:         "a: 1\nb: 3\n",
+		inc:       "b: 2\n",
+		want:      "a: 1\nb: 3\n",
+		name:      "changed_scalar",
+		wantEmpty: false,
+	}, {
+		n:         "user_rules: [a, c, b]\n",
+		inc:       "user_rules: [b, c]\n",
+		want:      "user_rules: [a]\n",
+		name:      "sequence",
+		wantEmpty: false,
+	}, {
+		n:         "clients: {persistent: [{name: a}, {name: b, ids: [x]}]}\n",
+		inc:       "clients: {persistent: [{name: b, ids: [x]}]}\n",
+		want:      "clients: {persistent: [{name: a}]}\n",
+		name:      "nested",
+		wantEmpty: false,
+	}, {
+		n:         "user_rules: [a]\n",
+		inc:       "user_rules: [a]\n",
+		want:      "{}\n",
+		name:      "all",
+		wantEmpty: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestYAML(t, tc.n)
+			empty := subtractYAML(n, newTestYAML(t, tc.inc))
+
+			assert.Equal(t, tc.wantEmpty, empty)
+			assertYAML(t, tc.want, n)
+		})
+	}
+}
+
+func TestIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, 0o755))
+
+	for _, name := range []string{"20-b.yaml", "10-a.yaml", "30-c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(confDir, name), nil, 0o644))
+	}
+
+	paths, err := includedFiles(dir, []string{"conf.d/*.yaml", "conf.d/10-a.yaml"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(confDir, "10-a.yaml"),
+		filepath.Join(confDir, "20-b.yaml"),
+	}, paths)
+
+	_, err = includedFiles(dir, []string{"["})
+	testutil.AssertErrorMsg(t, "include at index 0: syntax error in pattern", err)
+}
+
+func TestReadIncludedFile(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name       string
+		data       string
+		wantErrMsg string
+	}{{
+		name:       "valid",
+		data:       "user_rules: [a]\n",
+		wantErrMsg: "",
+	}, {
+		name:       "empty",
+		data:       "",
+		wantErrMsg: "",
+	}, {
+		name:       "not_mapping",
+		data:       "[a]\n",
+		wantErrMsg: "not a mapping",
+	}, {
+		name:       "schema_version",
+		data:       "schema_version: 28\n",
+		wantErrMsg: `key "schema_version" is only allowed in the main file`,
+	}, {
+		name:       "include",
+		data:       "include: [a.yaml]\n",
+		wantErrMsg: `key "include" is only allowed in the main file`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := filepath.Join(dir, tc.name+".yaml")
+			require.NoError(t, os.WriteFile(p, []byte(tc.data), 0o644))
+
+			_, err := readIncludedFile(p)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestConfiguration_DecodeConfig(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, 0o755))
+
+	require.NoError(t, os.WriteFile(
+		filepath.Join(confDir, "10-rules.yaml"),
+		[]byte("user_rules: ['||included.example^']\nlanguage: en\n"),
+		0o644,
+	))
+
+	conf := &configuration{}
+	err := conf.decodeConfig([]byte(`
+include: ['conf.d/*.yaml']
+user_rules: ['||main.example^']
+language: de
+schema_version: 28
+`), dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"||included.example^", "||main.example^"}, conf.UserRules)
+	assert.Equal(t, "de", conf.Language)
+
+	conf.UserRules = append(conf.UserRules, "||new.example^")
+	conf.Language = "en"
+
+	n, err := conf.encodeConfig()
+	require.NoError(t, err)
+
+	var written struct {
+		Language  string   `yaml:"language"`
+		UserRules []string `yaml:"user_rules"`
+	}
+	require.NoError(t, n.Decode(&written))
+
+	assert.Equal(t, []string{"||main.example^", "||new.example^"}, written.UserRules)
+	assert.Empty(t, written.Language)
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
@@ -176,17 +177,29 @@ func registerControlHandlers(web *webAPI) {
 		postInstall(optionalAuth(web.handleVersionJSON)),
 	)
 	httpRegister(http.MethodPost, "/control/update", web.handleUpdate)
+	httpRegister(http.MethodGet, "/control/backup", handleBackup)
+	httpRegister(http.MethodPost, "/control/restore", web.handleRestore)
+	httpRegister(http.MethodPost, "/control/reload", handleReload)
 
 	httpRegister(http.MethodGet, "/control/status", handleStatus)
 	httpRegister(http.MethodPost, "/control/i18n/change_language", handleI18nChangeLanguage)
 	httpRegister(http.MethodGet, "/control/i18n/current_language", handleI18nCurrentLanguage)
 	httpRegister(http.MethodGet, "/control/profile", handleGetProfile)
 	httpRegister(http.MethodPut, "/control/profile/update", handlePutProfile)
+	httpRegister(http.MethodPost, "/control/profile/totp/enroll", handleTOTPEnroll)
+	httpRegister(http.MethodPost, "/control/profile/totp/confirm", handleTOTPConfirm)
+	httpRegister(http.MethodPost, "/control/profile/totp/disable", handleTOTPDisable)
 
 	// No auth is necessary for DoH/DoT configurations
 	Context.mux.HandleFunc("/apple/doh.mobileconfig", postInstall(handleMobileConfigDoH))
 	Context.mux.HandleFunc("/apple/dot.mobileconfig", postInstall(handleMobileConfigDoT))
+	// The certificate authority requests the ACME challenges without auth.
+	Context.mux.HandleFunc(aghacme.HTTP01Path, postInstall(handleACMEChallenge))
 	RegisterAuthHandlers()
+	registerAccountsHandlers()
+	registerMetricsHandler()
+	registerHealthHandlers()
+	Context.syncer.registerSyncHandlers()
 }
 
 func httpRegister(method, url string, handler http.HandlerFunc) {
@@ -196,6 +209,7 @@ func httpRegister(method, url string, handler http.HandlerFunc) {
 		return
 	}
 
+	handler = checkRole(method, url, handler)
 	Context.mux.Handle(url, postInstallHandler(optionalAuthHandler(gziphandler.GzipHandler(ensureHandler(method, handler)))))
 }
 
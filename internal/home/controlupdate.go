@@ -181,13 +181,15 @@ func tlsConfUsesPrivilegedPorts(c *tlsConfigSettings) (ok bool) {
 
 // finishUpdate completes an update procedure.
 func finishUpdate(ctx context.Context, execPath string, runningAsService bool) {
-	var err error
-
 	log.Info("stopping all tasks")
 
-	cleanup(ctx)
-	cleanupAlways()
+	restart(ctx, execPath, runningAsService, nil)
+}
 
+// restartProcess starts the executable at execPath again in place of the
+// current process.  All the tasks are expected to be stopped.
+func restartProcess(execPath string, runningAsService bool) {
+	var err error
 	if runtime.GOOS == "windows" {
 		if runningAsService {
 			// NOTE: We can't restart the service via "kardianos/service"
@@ -1,6 +1,7 @@
 package home
 
 import (
+	"crypto/rand"
 	"fmt"
 	"net"
 	"net/netip"
@@ -14,13 +15,16 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/client"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnstap"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/google/renameio/v2/maybe"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -55,6 +59,8 @@ func initDNS() (err error) {
 	statsConf := stats.Config{
 		Filename:          filepath.Join(statsDir, "stats.db"),
 		Limit:             config.Stats.Interval.Duration,
+		DailyLimit:        config.Stats.DailyInterval.Duration,
+		ResetPeriod:       config.Stats.ResetPeriod,
 		ConfigModified:    onConfigModified,
 		HTTPRegister:      httpRegister,
 		Enabled:           config.Stats.Enabled,
@@ -81,8 +87,15 @@ func initDNS() (err error) {
 		AnonymizeClientIP: config.DNS.AnonymizeClientIP,
 		RotationIvl:       config.QueryLog.Interval.Duration,
 		MemSize:           config.QueryLog.MemSize,
+		FlushInterval:     config.QueryLog.FlushInterval.Duration,
+		MaxSize:           uint64(config.QueryLog.MaxSize),
+		SampleRate:        config.QueryLog.SampleRate,
 		Enabled:           config.QueryLog.Enabled,
 		FileEnabled:       config.QueryLog.FileEnabled,
+		Compress:          config.QueryLog.Compress,
+		Syslog:            &config.QueryLog.Syslog,
+		Storage:           &config.QueryLog.Storage,
+		Rollup:            &config.QueryLog.Rollup,
 	}
 
 	engine, err = aghnet.NewIgnoreEngine(config.QueryLog.Ignored)
@@ -96,6 +109,11 @@ func initDNS() (err error) {
 		return fmt.Errorf("init querylog: %w", err)
 	}
 
+	Context.dnstap, err = dnstap.New(&config.DNS.Dnstap, version.Version())
+	if err != nil {
+		return fmt.Errorf("init dnstap: %w", err)
+	}
+
 	Context.filters, err = filtering.New(config.Filtering, nil)
 	if err != nil {
 		// Don't wrap the error, since it's informative enough as is.
@@ -105,6 +123,14 @@ func initDNS() (err error) {
 	tlsConf := &tlsConfigSettings{}
 	Context.tls.WriteDiskConfig(tlsConf)
 
+	var pseudonymKey []byte
+	if config.QueryLog.Privacy.PseudonymizeClients || config.Stats.Privacy.PseudonymizeClients {
+		pseudonymKey, err = loadPseudonymKey(filepath.Join(Context.getDataDir(), pseudonymKeyFileName))
+		if err != nil {
+			return fmt.Errorf("loading pseudonymization key: %w", err)
+		}
+	}
+
 	return initDNSServer(
 		Context.filters,
 		Context.stats,
@@ -113,13 +139,57 @@ func initDNS() (err error) {
 		anonymizer,
 		httpRegister,
 		tlsConf,
+		pseudonymKey,
 	)
 }
 
+// cacheFileName is the name of the file within the data directory containing
+// the questions to warm up the DNS cache with.
+const cacheFileName = "dnscache.json"
+
+// pseudonymKeyFileName is the name of the file within the data directory
+// containing the key of the clients' pseudonyms.
+const pseudonymKeyFileName = "pseudonym.key"
+
+// pseudonymKeyLen is the length of the key of the clients' pseudonyms.
+const pseudonymKeyLen = 32
+
+// loadPseudonymKey reads the key of the clients' pseudonyms from the file at
+// path, generating and saving a new one if the file doesn't exist.
+func loadPseudonymKey(path string) (key []byte, err error) {
+	key, err = os.ReadFile(path)
+	if err == nil {
+		if len(key) != pseudonymKeyLen {
+			return nil, fmt.Errorf("bad key length %d, want %d", len(key), pseudonymKeyLen)
+		}
+
+		return key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	key = make([]byte, pseudonymKeyLen)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	err = maybe.WriteFile(path, key, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("saving key: %w", err)
+	}
+
+	log.Info("dns: generated new pseudonymization key at %q", path)
+
+	return key, nil
+}
+
 // initDNSServer initializes the [context.dnsServer].  To only use the internal
 // proxy, none of the arguments are required, but tlsConf still must not be nil,
-// in other cases all the arguments also must not be nil.  It also must not be
-// called unless [config] and [Context] are initialized.
+// in other cases all the arguments also must not be nil, except for
+// pseudonymKey, which is only required if the pseudonymization is enabled.  It
+// also must not be called unless [config] and [Context] are initialized.
 func initDNSServer(
 	filters *filtering.DNSFilter,
 	sts stats.Interface,
@@ -128,16 +198,32 @@ func initDNSServer(
 	anonymizer *aghnet.IPMut,
 	httpReg aghhttp.RegisterFunc,
 	tlsConf *tlsConfigSettings,
+	pseudonymKey []byte,
 ) (err error) {
+	// Only use the privacy settings when there is the data to anonymize, since
+	// the internal proxy has no key.
+	var logPrivacy, statsPrivacy *dnsforward.PrivacyConfig
+	if qlog != nil {
+		logPrivacy = &config.QueryLog.Privacy
+	}
+
+	if sts != nil {
+		statsPrivacy = &config.Stats.Privacy
+	}
+
 	Context.dnsServer, err = dnsforward.NewServer(dnsforward.DNSCreateParams{
-		DNSFilter:   filters,
-		Stats:       sts,
-		QueryLog:    qlog,
-		PrivateNets: parseSubnetSet(config.DNS.PrivateNets),
-		Anonymizer:  anonymizer,
-		DHCPServer:  dhcpSrv,
-		EtcHosts:    Context.etcHosts,
-		LocalDomain: config.DHCP.LocalDomainName,
+		DNSFilter:    filters,
+		Stats:        sts,
+		QueryLog:     qlog,
+		PrivateNets:  parseSubnetSet(config.DNS.PrivateNets),
+		Anonymizer:   anonymizer,
+		DHCPServer:   dhcpSrv,
+		EtcHosts:     Context.etcHosts,
+		Dnstap:       Context.dnstap,
+		LogPrivacy:   logPrivacy,
+		StatsPrivacy: statsPrivacy,
+		LocalDomain:  config.DHCP.LocalDomainName,
+		PseudonymKey: pseudonymKey,
 	})
 	defer func() {
 		if err != nil {
@@ -234,10 +320,12 @@ func newServerConfig(
 	newConf = &dnsforward.ServerConfig{
 		UDPListenAddrs:         ipsToUDPAddrs(hosts, dnsConf.Port),
 		TCPListenAddrs:         ipsToTCPAddrs(hosts, dnsConf.Port),
+		Listeners:              newDNSListenerConfigs(dnsConf.Listeners),
 		Config:                 fwdConf,
 		TLSConfig:              newDNSTLSConfig(tlsConf, hosts),
 		TLSAllowUnencryptedDoH: tlsConf.AllowUnencryptedDoH,
 		UpstreamTimeout:        dnsConf.UpstreamTimeout.Duration,
+		CacheFile:              filepath.Join(Context.getDataDir(), cacheFileName),
 		TLSv12Roots:            Context.tlsRoots,
 		ConfigModified:         onConfigModified,
 		HTTPRegister:           httpReg,
@@ -406,12 +494,18 @@ func applyAdditionalFiltering(clientIP netip.Addr, clientID string, setts *filte
 
 	setts.ClientIP = clientIP
 
-	c, ok := Context.clients.find(clientID)
+	c, ok := Context.clients.findWithGroup(clientID)
 	if !ok {
-		c, ok = Context.clients.find(clientIP.String())
+		c, ok = Context.clients.findWithGroup(clientIP.String())
 		if !ok {
 			log.Debug("%s: no clients with ip %s and clientid %q", pref, clientIP, clientID)
 
+			// Use the tags guessed for the runtime client, if any, so that
+			// the ctag rules apply to it.
+			if rc := Context.clients.findRuntimeClient(clientIP); rc != nil {
+				setts.ClientTags = rc.Tags()
+			}
+
 			return
 		}
 	}
@@ -430,6 +524,18 @@ func applyAdditionalFiltering(clientIP netip.Addr, clientID string, setts *filte
 
 	setts.ClientName = c.Name
 	setts.ClientTags = c.Tags
+	setts.QueryQuotas = c.QueryQuotas
+
+	if c.UseOwnSettings || c.UseOwnSafeBrowsing {
+		setts.SafeBrowsingEnabled = c.SafeBrowsingEnabled
+		setts.SafeBrowsingLevel = filtering.SettingsLevelClient
+	}
+
+	if c.UseOwnSettings || c.UseOwnParental {
+		setts.ParentalEnabled = c.ParentalEnabled
+		setts.ParentalLevel = filtering.SettingsLevelClient
+	}
+
 	if !c.UseOwnSettings {
 		return
 	}
@@ -437,8 +543,8 @@ func applyAdditionalFiltering(clientIP netip.Addr, clientID string, setts *filte
 	setts.FilteringEnabled = c.FilteringEnabled
 	setts.SafeSearchEnabled = c.SafeSearchConf.Enabled
 	setts.ClientSafeSearch = c.SafeSearch
-	setts.SafeBrowsingEnabled = c.SafeBrowsingEnabled
-	setts.ParentalEnabled = c.ParentalEnabled
+	setts.NewDomainsEnabled = c.NewDomainsEnabled
+	setts.ThreatCategories = c.ThreatCategories
 }
 
 func startDNSServer() error {
@@ -449,7 +555,11 @@ func startDNSServer() error {
 		return fmt.Errorf("unable to start forwarding DNS server: Already running")
 	}
 
-	Context.filters.EnableFilters(false)
+	lazy := config.Filtering.LazyLoading
+	if !lazy {
+		Context.filters.EnableFilters(false)
+		Context.filtersLoaded.Store(true)
+	}
 
 	Context.clients.Start()
 
@@ -459,6 +569,17 @@ func startDNSServer() error {
 	}
 
 	Context.filters.Start()
+	if lazy {
+		Context.filters.EnableFiltersLazily(func(err error) {
+			if err != nil {
+				Context.filtersLoadErr.Store(&err)
+			} else {
+				Context.filtersLoadErr.Store(nil)
+			}
+
+			Context.filtersLoaded.Store(true)
+		})
+	}
 	Context.stats.Start()
 	Context.queryLog.Start()
 
@@ -509,6 +630,15 @@ func closeDNSServer() {
 		Context.dnsServer = nil
 	}
 
+	if Context.dnstap != nil {
+		err := Context.dnstap.Close()
+		if err != nil {
+			log.Debug("closing dnstap: %s", err)
+		}
+
+		Context.dnstap = nil
+	}
+
 	if Context.filters != nil {
 		Context.filters.Close()
 	}
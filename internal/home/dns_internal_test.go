@@ -57,11 +57,19 @@ func TestApplyAdditionalFiltering(t *testing.T) {
 		FilteringEnabled:    true,
 		SafeBrowsingEnabled: false,
 		ParentalEnabled:     false,
+	}, {
+		ClientIDs:           []string{"own_safebrowsing"},
+		UseOwnSettings:      false,
+		SafeBrowsingEnabled: true,
+		ParentalEnabled:     true,
+		UseOwnSafeBrowsing:  true,
 	}})
 
 	testCases := []struct {
 		name                string
 		id                  string
+		wantSBLevel         filtering.SettingsLevel
+		wantParentalLevel   filtering.SettingsLevel
 		FilteringEnabled    assert.BoolAssertionFunc
 		SafeSearchEnabled   assert.BoolAssertionFunc
 		SafeBrowsingEnabled assert.BoolAssertionFunc
@@ -69,6 +77,8 @@ func TestApplyAdditionalFiltering(t *testing.T) {
 	}{{
 		name:                "global_settings",
 		id:                  "default",
+		wantSBLevel:         filtering.SettingsLevelGlobal,
+		wantParentalLevel:   filtering.SettingsLevelGlobal,
 		FilteringEnabled:    assert.False,
 		SafeSearchEnabled:   assert.False,
 		SafeBrowsingEnabled: assert.False,
@@ -76,6 +86,8 @@ func TestApplyAdditionalFiltering(t *testing.T) {
 	}, {
 		name:                "custom_settings",
 		id:                  "custom_filtering",
+		wantSBLevel:         filtering.SettingsLevelClient,
+		wantParentalLevel:   filtering.SettingsLevelClient,
 		FilteringEnabled:    assert.True,
 		SafeSearchEnabled:   assert.True,
 		SafeBrowsingEnabled: assert.True,
@@ -83,21 +95,34 @@ func TestApplyAdditionalFiltering(t *testing.T) {
 	}, {
 		name:                "partial",
 		id:                  "partial_custom_filtering",
+		wantSBLevel:         filtering.SettingsLevelClient,
+		wantParentalLevel:   filtering.SettingsLevelClient,
 		FilteringEnabled:    assert.True,
 		SafeSearchEnabled:   assert.True,
 		SafeBrowsingEnabled: assert.False,
 		ParentalEnabled:     assert.False,
+	}, {
+		name:                "own_safebrowsing",
+		id:                  "own_safebrowsing",
+		wantSBLevel:         filtering.SettingsLevelClient,
+		wantParentalLevel:   filtering.SettingsLevelGlobal,
+		FilteringEnabled:    assert.False,
+		SafeSearchEnabled:   assert.False,
+		SafeBrowsingEnabled: assert.True,
+		ParentalEnabled:     assert.False,
 	}}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			setts := &filtering.Settings{}
+			setts := Context.filters.Settings()
 
 			applyAdditionalFiltering(testIPv4, tc.id, setts)
 			tc.FilteringEnabled(t, setts.FilteringEnabled)
 			tc.SafeSearchEnabled(t, setts.SafeSearchEnabled)
 			tc.SafeBrowsingEnabled(t, setts.SafeBrowsingEnabled)
 			tc.ParentalEnabled(t, setts.ParentalEnabled)
+			assert.Equal(t, tc.wantSBLevel, setts.SafeBrowsingLevel)
+			assert.Equal(t, tc.wantParentalLevel, setts.ParentalLevel)
 		})
 	}
 }
@@ -0,0 +1,138 @@
+package home
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/golibs/container"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// dnsListenerConfig is the configuration of an additional plain-DNS listener,
+// for example, the one for a guest network with a stricter filtering and
+// without logging.
+type dnsListenerConfig struct {
+	// Name is the unique name of the listener.
+	Name string `yaml:"name"`
+
+	// BindHosts are the addresses to listen on.
+	BindHosts []netip.Addr `yaml:"bind_hosts"`
+
+	// Port is the port to listen on.
+	Port uint16 `yaml:"port"`
+
+	// Client is the identifier of the persistent client, which settings are
+	// applied to the queries from the clients not defined more specifically,
+	// for example, its ClientID.
+	Client string `yaml:"client"`
+
+	// AllowedClients are the clients allowed to use the listener, in addition
+	// to the global access settings.
+	AllowedClients []string `yaml:"allowed_clients"`
+
+	// DisallowedClients are the clients not allowed to use the listener, in
+	// addition to the global access settings.
+	DisallowedClients []string `yaml:"disallowed_clients"`
+
+	// IgnoreQueryLog, if true, disables the query log for the queries
+	// received on the listener.
+	IgnoreQueryLog bool `yaml:"ignore_querylog"`
+
+	// IgnoreStatistics, if true, disables the statistics for the queries
+	// received on the listener.
+	IgnoreStatistics bool `yaml:"ignore_statistics"`
+}
+
+// validateDNSListeners returns an error if any of the listeners is invalid or
+// if they are bound to the same addresses as each other or as the main
+// listeners with hosts and port.  The listeners bound to all addresses must use
+// a port not used by any other listener, since it's impossible to tell such
+// listeners apart.
+func validateDNSListeners(hosts []netip.Addr, port uint16, listeners []*dnsListenerConfig) (err error) {
+	names := container.NewMapSet[string]()
+	bound := map[netip.AddrPort]string{}
+	for _, h := range hosts {
+		bound[netip.AddrPortFrom(h.Unmap(), port)] = "dns.bind_hosts"
+	}
+
+	for i, l := range listeners {
+		err = l.validate()
+		if err != nil {
+			return fmt.Errorf("at index %d: %w", i, err)
+		} else if names.Has(l.Name) {
+			return fmt.Errorf("at index %d: duplicate name %q", i, l.Name)
+		}
+
+		names.Add(l.Name)
+
+		for _, h := range l.BindHosts {
+			ap := netip.AddrPortFrom(h.Unmap(), l.Port)
+			if other, ok := boundTo(bound, ap); ok {
+				return fmt.Errorf("listener %q: %s is already used by %s", l.Name, ap, other)
+			}
+
+			bound[ap] = fmt.Sprintf("listener %q", l.Name)
+		}
+	}
+
+	return nil
+}
+
+// boundTo returns the owner of the address in bound, which conflicts with ap.
+// The unspecified address conflicts with any address with the same port.
+func boundTo(bound map[netip.AddrPort]string, ap netip.AddrPort) (owner string, ok bool) {
+	for b, o := range bound {
+		if b.Port() != ap.Port() {
+			continue
+		}
+
+		if b.Addr() == ap.Addr() || b.Addr().IsUnspecified() || ap.Addr().IsUnspecified() {
+			return o, true
+		}
+	}
+
+	return "", false
+}
+
+// validate returns an error if the listener configuration is invalid.
+func (l *dnsListenerConfig) validate() (err error) {
+	switch {
+	case l == nil:
+		return errors.Error("no value")
+	case l.Name == "":
+		return errors.Error("name: empty value")
+	case len(l.BindHosts) == 0:
+		return fmt.Errorf("listener %q: bind_hosts: empty value", l.Name)
+	case l.Port == 0:
+		return fmt.Errorf("listener %q: port: must be positive", l.Name)
+	}
+
+	i := slices.IndexFunc(l.BindHosts, func(h netip.Addr) (ok bool) { return !h.IsValid() })
+	if i >= 0 {
+		return fmt.Errorf("listener %q: bind_hosts at index %d is not a valid ip address", l.Name, i)
+	}
+
+	return nil
+}
+
+// newDNSListenerConfigs converts the listeners from the configuration file into
+// the ones of the DNS server.
+func newDNSListenerConfigs(listeners []*dnsListenerConfig) (confs []*dnsforward.ListenerConfig) {
+	confs = make([]*dnsforward.ListenerConfig, 0, len(listeners))
+	for _, l := range listeners {
+		confs = append(confs, &dnsforward.ListenerConfig{
+			Name:              l.Name,
+			ClientID:          l.Client,
+			AllowedClients:    l.AllowedClients,
+			DisallowedClients: l.DisallowedClients,
+			UDPListenAddrs:    ipsToUDPAddrs(l.BindHosts, l.Port),
+			TCPListenAddrs:    ipsToTCPAddrs(l.BindHosts, l.Port),
+			IgnoreQueryLog:    l.IgnoreQueryLog,
+			IgnoreStatistics:  l.IgnoreStatistics,
+		})
+	}
+
+	return confs
+}
@@ -0,0 +1,96 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+)
+
+func TestValidateDNSListeners(t *testing.T) {
+	mainHosts := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+	guestHosts := []netip.Addr{netip.MustParseAddr("192.168.20.1")}
+	allHosts := []netip.Addr{netip.IPv4Unspecified()}
+
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		listeners  []*dnsListenerConfig
+	}{{
+		name:       "none",
+		wantErrMsg: "",
+		listeners:  nil,
+	}, {
+		name:       "same_port",
+		wantErrMsg: "",
+		listeners: []*dnsListenerConfig{{
+			Name:      "guest",
+			BindHosts: guestHosts,
+			Port:      53,
+		}},
+	}, {
+		name:       "wildcard_other_port",
+		wantErrMsg: "",
+		listeners: []*dnsListenerConfig{{
+			Name:      "iot",
+			BindHosts: allHosts,
+			Port:      5353,
+		}},
+	}, {
+		name:       "wildcard_same_port",
+		wantErrMsg: `listener "iot": 0.0.0.0:53 is already used by dns.bind_hosts`,
+		listeners: []*dnsListenerConfig{{
+			Name:      "iot",
+			BindHosts: allHosts,
+			Port:      53,
+		}},
+	}, {
+		name:       "main_addr",
+		wantErrMsg: `listener "guest": 192.168.1.1:53 is already used by dns.bind_hosts`,
+		listeners: []*dnsListenerConfig{{
+			Name:      "guest",
+			BindHosts: mainHosts,
+			Port:      53,
+		}},
+	}, {
+		name:       "duplicate_name",
+		wantErrMsg: `at index 1: duplicate name "guest"`,
+		listeners: []*dnsListenerConfig{{
+			Name:      "guest",
+			BindHosts: guestHosts,
+			Port:      53,
+		}, {
+			Name:      "guest",
+			BindHosts: guestHosts,
+			Port:      5353,
+		}},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "at index 0: name: empty value",
+		listeners: []*dnsListenerConfig{{
+			BindHosts: guestHosts,
+			Port:      53,
+		}},
+	}, {
+		name:       "no_port",
+		wantErrMsg: `at index 0: listener "guest": port: must be positive`,
+		listeners: []*dnsListenerConfig{{
+			Name:      "guest",
+			BindHosts: guestHosts,
+		}},
+	}, {
+		name:       "no_hosts",
+		wantErrMsg: `at index 0: listener "guest": bind_hosts: empty value`,
+		listeners: []*dnsListenerConfig{{
+			Name: "guest",
+			Port: 53,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDNSListeners(mainHosts, 53, tc.listeners)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
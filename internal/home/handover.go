@@ -0,0 +1,268 @@
+package home
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// envHandoverFD is the environment variable with the descriptor of the pipe,
+// which the new process writes to once it's ready to serve DNS.
+const envHandoverFD = "ADGUARDHOME_HANDOVER_FD"
+
+// handoverTimeout is the maximum duration to wait for the new process to start
+// serving DNS.  It's generous, since loading large filter lists may take a
+// while on slow devices.
+const handoverTimeout = 5 * time.Minute
+
+// restart restarts AdGuard Home.  If possible, the new process is started while
+// the DNS server of the current one is still running, which only stops after
+// the new one starts serving DNS.  The DNS listeners are bound with
+// SO_REUSEPORT, so both processes can serve at the same time.  Otherwise, or if
+// the handover fails, all the tasks are stopped and the executable replaces the
+// current process.
+//
+// prepare, if not nil, is called after the exclusively used resources, such as
+// the databases and the web interface, are released, but before the new process
+// is started.
+func restart(ctx context.Context, execPath string, runningAsService bool, prepare func()) {
+	if !canHandOver(runningAsService) {
+		cleanup(ctx)
+		cleanupAlways()
+
+		if prepare != nil {
+			prepare()
+		}
+
+		restartProcess(execPath, runningAsService)
+
+		return
+	}
+
+	releaseForHandover(ctx)
+
+	if prepare != nil {
+		prepare()
+	}
+
+	err := handOver(ctx, execPath)
+	if err == nil {
+		// Don't call cleanupAlways, since the PID file now belongs to the new
+		// process.
+		log.Info("restarting: handed over to the new process")
+
+		os.Exit(0)
+	}
+
+	log.Error("restarting: handing over: %s; restarting in place", err)
+
+	cleanup(ctx)
+	cleanupAlways()
+
+	restartProcess(execPath, runningAsService)
+}
+
+// canHandOver returns true if the DNS server can be handed over to a new
+// process.  The process supervisors other than systemd, which is told about the
+// new main PID, would consider the service stopped once the current process
+// exits.
+func canHandOver(runningAsService bool) (ok bool) {
+	if runtime.GOOS == "windows" || !isRunning() {
+		return false
+	}
+
+	return !runningAsService || Context.sdNotifier != nil
+}
+
+// releaseForHandover stops all the tasks except the DNS server, so that the
+// new process is able to bind the ports and to open the databases.  The
+// statistics and the query log entries collected after that are lost.
+func releaseForHandover(ctx context.Context) {
+	log.Info("restarting: stopping all tasks except dns")
+
+	if Context.web != nil {
+		Context.web.close(ctx)
+		Context.web = nil
+	}
+
+	if Context.auth != nil {
+		Context.auth.Close()
+		Context.auth = nil
+	}
+
+	if Context.metricsPusher != nil {
+		Context.metricsPusher.Close()
+		Context.metricsPusher = nil
+	}
+
+	if Context.acme != nil {
+		Context.acme.Close()
+		Context.acme = nil
+	}
+
+	if Context.syncer != nil {
+		Context.syncer.Close()
+		Context.syncer = nil
+	}
+
+	if Context.mdns != nil {
+		Context.mdns.Close()
+		Context.mdns = nil
+	}
+
+	if Context.eventMonitor != nil {
+		Context.eventMonitor.Close()
+		Context.eventMonitor = nil
+	}
+
+	Context.webhooks.Close()
+	Context.webhooks = nil
+
+	Context.mqtt.Close()
+	Context.mqtt = nil
+
+	Context.snmp.Close()
+	Context.snmp = nil
+
+	Context.confWatcher.Close()
+	Context.confWatcher = nil
+
+	if Context.dhcpServer != nil {
+		err := Context.dhcpServer.Stop()
+		if err != nil {
+			log.Error("stopping dhcp server: %s", err)
+		}
+	}
+
+	if Context.stats != nil {
+		err := Context.stats.Close()
+		if err != nil {
+			log.Error("closing stats: %s", err)
+		}
+	}
+
+	// Flush the buffered entries, so that the new process reads them, and
+	// close the summaries database.
+	if Context.queryLog != nil {
+		Context.queryLog.Close()
+	}
+}
+
+// handOver starts the executable at execPath and waits until it starts serving
+// DNS.  After that, it stops the remaining tasks of the current process.
+func handOver(ctx context.Context, execPath string) (err error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating pipe: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, r.Close()) }()
+
+	cmd := exec.Command(execPath, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// The first extra file always gets the descriptor 3.
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = handoverEnv(os.Environ(), 3)
+
+	log.Info("restarting: starting %q %q", execPath, os.Args[1:])
+
+	err = cmd.Start()
+
+	// Close the write end in this process, so that reading fails once the new
+	// process exits.
+	err = errors.WithDeferred(err, w.Close())
+	if err != nil {
+		return fmt.Errorf("starting: %w", err)
+	}
+
+	err = waitHandover(r, handoverTimeout)
+	if err != nil {
+		killErr := cmd.Process.Kill()
+		_ = cmd.Wait()
+
+		return errors.WithDeferred(err, killErr)
+	}
+
+	Context.sdNotifier.HandOver(cmd.Process.Pid)
+	Context.sdNotifier = nil
+
+	cleanup(ctx)
+
+	return nil
+}
+
+// waitHandover waits until the new process writes to r or until timeout
+// passes.
+func waitHandover(r *os.File, timeout time.Duration) (err error) {
+	errCh := make(chan error, 1)
+	go func() {
+		defer log.OnPanic("restarting: waiting for handover")
+
+		_, rErr := r.Read(make([]byte, 1))
+		errCh <- rErr
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-errCh:
+		if err != nil {
+			return fmt.Errorf("new process exited before serving dns: %w", err)
+		}
+
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("new process didn't start serving dns in %s", timeout)
+	}
+}
+
+// handoverEnv returns the environment for the new process from env with the
+// handover pipe descriptor set to fd.  The watchdog PID is removed, since it's
+// going to be the new process that sends the watchdog notifications.
+func handoverEnv(env []string, fd int) (res []string) {
+	res = make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		if k != envHandoverFD && k != envWatchdogPID {
+			res = append(res, kv)
+		}
+	}
+
+	return append(res, envHandoverFD+"="+strconv.Itoa(fd))
+}
+
+// notifyHandover tells the previous process, if there is one, that this one
+// has started serving DNS.
+func notifyHandover() {
+	fdStr := os.Getenv(envHandoverFD)
+	if fdStr == "" {
+		return
+	}
+
+	// Don't pass the descriptor to the processes started later.
+	_ = os.Unsetenv(envHandoverFD)
+
+	fd, err := strconv.ParseUint(fdStr, 10, 0)
+	if err != nil {
+		log.Error("restarting: parsing handover descriptor: %s", err)
+
+		return
+	}
+
+	f := os.NewFile(uintptr(fd), "handover")
+	_, err = f.Write([]byte{1})
+	err = errors.WithDeferred(err, f.Close())
+	if err != nil {
+		log.Error("restarting: notifying previous process: %s", err)
+	}
+}
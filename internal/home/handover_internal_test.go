@@ -0,0 +1,61 @@
+package home
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandoverEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin",
+		envWatchdogPID + "=1",
+		envWatchdogUSec + "=60000000",
+		envHandoverFD + "=4",
+	}
+
+	assert.Equal(t, []string{
+		"PATH=/usr/bin",
+		envWatchdogUSec + "=60000000",
+		envHandoverFD + "=3",
+	}, handoverEnv(env, 3))
+}
+
+func TestWaitHandover(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	t.Run("ready", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, r.Close)
+
+		_, err = w.Write([]byte{1})
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		assert.NoError(t, waitHandover(r, timeout))
+	})
+
+	t.Run("exited", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, r.Close)
+
+		require.NoError(t, w.Close())
+
+		testutil.AssertErrorMsg(t, "new process exited before serving dns: EOF", waitHandover(r, timeout))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		testutil.CleanupAndRequireSuccess(t, r.Close)
+		testutil.CleanupAndRequireSuccess(t, w.Close)
+
+		testutil.AssertErrorMsg(t, "new process didn't start serving dns in 100ms", waitHandover(r, timeout))
+	})
+}
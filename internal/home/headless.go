@@ -0,0 +1,85 @@
+package home
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// errHeadlessFirstRun is returned when the headless mode is requested, but
+// there is no configuration file to run with.
+const errHeadlessFirstRun errors.Error = "headless mode requires an existing config file"
+
+// configWatcher reloads the configuration file when it changes.  It's used in
+// the headless mode, where there is no HTTP API to change the settings with.
+// A nil *configWatcher is a valid watcher, which does nothing.
+type configWatcher struct {
+	watcher aghos.FSWatcher
+}
+
+// newConfigWatcher returns a new watcher of the configuration file at confPath,
+// which must be absolute.
+func newConfigWatcher(confPath string) (w *configWatcher, err error) {
+	watcher, err := aghos.NewOSWritesWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating watcher: %w", err)
+	}
+
+	// The watcher expects the paths relative to the root directory.
+	err = watcher.Add(strings.TrimPrefix(filepath.ToSlash(confPath), "/"))
+	if err != nil {
+		return nil, errors.WithDeferred(err, watcher.Close())
+	}
+
+	return &configWatcher{
+		watcher: watcher,
+	}, nil
+}
+
+// Start starts watching the configuration file.
+func (w *configWatcher) Start() (err error) {
+	if w == nil {
+		return nil
+	}
+
+	err = w.watcher.Start()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	go w.handleEvents()
+
+	return nil
+}
+
+// Close stops watching the configuration file.
+func (w *configWatcher) Close() {
+	if w == nil {
+		return
+	}
+
+	err := w.watcher.Close()
+	if err != nil {
+		log.Error("config watcher: closing: %s", err)
+	}
+}
+
+// handleEvents reloads the configuration on each event until the watcher is
+// closed.  It is intended to be used as a goroutine.
+func (w *configWatcher) handleEvents() {
+	defer log.OnPanic("config watcher: handling events")
+
+	for range w.watcher.Events() {
+		log.Info("config watcher: config file changed, reloading")
+
+		_, err := reloadConfig()
+		if err != nil {
+			log.Error("config watcher: reloading: %s", err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package home
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Paths of the health endpoints.
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// verboseParam is the query parameter requesting the detailed JSON response
+// from the health endpoints.
+const verboseParam = "verbose"
+
+// Statuses of the health checks.
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+// upstreamCheckTTL is the duration for which the result of the upstream check
+// is reused, so that the frequent probes don't flood the upstream servers.
+const upstreamCheckTTL = 10 * time.Second
+
+// healthCheck is the result of a single check in the detailed response.
+type healthCheck struct {
+	// Error is the reason of the failure.  It's empty if Status is
+	// [healthStatusOK].
+	Error string `json:"error,omitempty"`
+
+	// Status is either [healthStatusOK] or [healthStatusFail].
+	Status string `json:"status"`
+}
+
+// healthResp is the detailed response of the health endpoints.
+type healthResp struct {
+	// Checks are the results of the readiness checks by their names.  It's
+	// empty for the liveness endpoint.
+	Checks map[string]*healthCheck `json:"checks,omitempty"`
+
+	// Status is [healthStatusOK] if all the checks have passed.
+	Status string `json:"status"`
+}
+
+// upstreamChecker checks the upstream servers and caches the result.
+type upstreamChecker struct {
+	// mu protects checked and err.
+	mu *sync.Mutex
+
+	// checked is the time of the last check.
+	checked time.Time
+
+	// err is the result of the last check.
+	err error
+}
+
+// check returns the result of the upstream check, which is only performed
+// again if the last result is older than [upstreamCheckTTL].
+func (c *upstreamChecker) check() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !c.checked.IsZero() && now.Sub(c.checked) < upstreamCheckTTL {
+		return c.err
+	}
+
+	c.err = Context.dnsServer.CheckUpstreams()
+	c.checked = now
+
+	return c.err
+}
+
+// readyzUpstreams is the cached upstream checker of the readiness endpoint.
+var readyzUpstreams = &upstreamChecker{
+	mu: &sync.Mutex{},
+}
+
+// registerHealthHandlers registers the unauthenticated health endpoints, which
+// are available during the first run as well.
+func registerHealthHandlers() {
+	Context.mux.HandleFunc(healthzPath, ensureGET(handleHealthz))
+	Context.mux.HandleFunc(readyzPath, ensureGET(handleReadyz))
+}
+
+// handleHealthz is the handler for the GET /healthz HTTP API.  It reports that
+// the process is alive.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, &healthResp{
+		Status: healthStatusOK,
+	})
+}
+
+// handleReadyz is the handler for the GET /readyz HTTP API.  It reports if the
+// DNS server is running with the filters loaded and at least one of the
+// upstream servers answers.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := &healthResp{
+		Status: healthStatusOK,
+		Checks: map[string]*healthCheck{},
+	}
+
+	dnsErr := checkReadyDNS()
+	addHealthCheck(resp, "dns", dnsErr)
+
+	filtersErr := dnsErr
+	if filtersErr == nil {
+		filtersErr = checkFiltersLoaded()
+	}
+	addHealthCheck(resp, "filters", filtersErr)
+
+	upsErr := dnsErr
+	if upsErr == nil {
+		upsErr = readyzUpstreams.check()
+	}
+	addHealthCheck(resp, "upstreams", upsErr)
+
+	writeHealth(w, r, resp)
+}
+
+// checkFiltersLoaded returns an error if the filters aren't loaded yet or their
+// loading has failed.
+func checkFiltersLoaded() (err error) {
+	if !Context.filtersLoaded.Load() {
+		return errors.Error("filters are not loaded")
+	}
+
+	if errPtr := Context.filtersLoadErr.Load(); errPtr != nil {
+		return fmt.Errorf("loading filters: %w", *errPtr)
+	}
+
+	return nil
+}
+
+// checkReadyDNS returns an error if the DNS server isn't running or doesn't
+// answer the queries.
+func checkReadyDNS() (err error) {
+	if Context.firstRun {
+		return errors.Error("not configured")
+	} else if !isRunning() {
+		return errors.Error("dns server is not running")
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return checkHealth()
+}
+
+// addHealthCheck adds the result of the check with name to resp and fails resp,
+// if err isn't nil.
+func addHealthCheck(resp *healthResp, name string, err error) {
+	if err == nil {
+		resp.Checks[name] = &healthCheck{
+			Status: healthStatusOK,
+		}
+
+		return
+	}
+
+	resp.Status = healthStatusFail
+	resp.Checks[name] = &healthCheck{
+		Error:  err.Error(),
+		Status: healthStatusFail,
+	}
+}
+
+// writeHealth writes resp to w either as a plain-text status or, if requested
+// in r, as JSON.  The status code is 503 Service Unavailable if resp fails.
+func writeHealth(w http.ResponseWriter, r *http.Request, resp *healthResp) {
+	code := http.StatusOK
+	if resp.Status != healthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	if r.URL.Query().Has(verboseParam) {
+		aghhttp.WriteJSONResponse(w, r, code, resp)
+
+		return
+	}
+
+	w.Header().Set(httphdr.ContentType, aghhttp.HdrValTextPlain)
+	w.WriteHeader(code)
+
+	_, err := w.Write([]byte(resp.Status + "\n"))
+	if err != nil {
+		log.Debug("health: writing response: %s", err)
+	}
+}
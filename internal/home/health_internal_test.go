@@ -0,0 +1,92 @@
+package home
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteHealth(t *testing.T) {
+	failed := &healthResp{
+		Status: healthStatusOK,
+		Checks: map[string]*healthCheck{},
+	}
+	addHealthCheck(failed, "dns", nil)
+	addHealthCheck(failed, "upstreams", errors.Error("no upstream servers"))
+
+	testCases := []struct {
+		resp     *healthResp
+		name     string
+		target   string
+		wantBody string
+		wantType string
+		wantCode int
+	}{{
+		resp:     &healthResp{Status: healthStatusOK},
+		name:     "ok",
+		target:   healthzPath,
+		wantBody: "ok\n",
+		wantType: aghhttp.HdrValTextPlain,
+		wantCode: http.StatusOK,
+	}, {
+		resp:     &healthResp{Status: healthStatusOK},
+		name:     "ok_verbose",
+		target:   healthzPath + "?" + verboseParam,
+		wantBody: `{"status":"ok"}` + "\n",
+		wantType: aghhttp.HdrValApplicationJSON,
+		wantCode: http.StatusOK,
+	}, {
+		resp:     failed,
+		name:     "fail",
+		target:   readyzPath,
+		wantBody: "fail\n",
+		wantType: aghhttp.HdrValTextPlain,
+		wantCode: http.StatusServiceUnavailable,
+	}, {
+		resp:   failed,
+		name:   "fail_verbose",
+		target: readyzPath + "?" + verboseParam,
+		wantBody: `{"checks":{"dns":{"status":"ok"},"upstreams":` +
+			`{"error":"no upstream servers","status":"fail"}},"status":"fail"}` +
+			"\n",
+		wantType: aghhttp.HdrValApplicationJSON,
+		wantCode: http.StatusServiceUnavailable,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			w := httptest.NewRecorder()
+
+			writeHealth(w, r, tc.resp)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantType, w.Header().Get(httphdr.ContentType))
+			assert.Equal(t, tc.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestCheckFiltersLoaded(t *testing.T) {
+	t.Cleanup(func() {
+		Context.filtersLoaded.Store(false)
+		Context.filtersLoadErr.Store(nil)
+	})
+
+	assert.Error(t, checkFiltersLoaded())
+
+	loadErr := error(errors.Error("bad rule list"))
+	Context.filtersLoadErr.Store(&loadErr)
+	Context.filtersLoaded.Store(true)
+
+	assert.ErrorIs(t, checkFiltersLoaded(), loadErr)
+
+	Context.filtersLoadErr.Store(nil)
+
+	assert.NoError(t, checkFiltersLoaded())
+}
@@ -16,9 +16,11 @@ import (
 	"runtime"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
@@ -27,13 +29,17 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/arpdb"
 	"github.com/AdguardTeam/AdGuardHome/internal/dhcpd"
 	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnstap"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/hashprefix"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering/safesearch"
+	"github.com/AdguardTeam/AdGuardHome/internal/mdns"
+	"github.com/AdguardTeam/AdGuardHome/internal/metrics"
 	"github.com/AdguardTeam/AdGuardHome/internal/querylog"
 	"github.com/AdguardTeam/AdGuardHome/internal/stats"
 	"github.com/AdguardTeam/AdGuardHome/internal/updater"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
 	"github.com/AdguardTeam/dnsproxy/upstream"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/hostsfile"
@@ -51,12 +57,56 @@ type homeContext struct {
 	stats      stats.Interface      // statistics module
 	queryLog   querylog.QueryLog    // query log module
 	dnsServer  *dnsforward.Server   // DNS module
+	dnstap     *dnstap.Writer       // dnstap output, nil if disabled
 	dhcpServer dhcpd.Interface      // DHCP module
 	auth       *Auth                // HTTP authentication module
 	filters    *filtering.DNSFilter // DNS filtering module
 	web        *webAPI              // Web (HTTP, HTTPS) module
 	tls        *tlsManager          // TLS module
 
+	// metricsPusher pushes the metrics to a monitoring system.  It's nil if
+	// pushing is disabled.
+	metricsPusher *metrics.Pusher
+
+	// acme obtains and renews the TLS certificate.  It's nil if ACME is
+	// disabled.
+	acme *aghacme.Manager
+
+	// syncer synchronizes the configuration with the other instances.
+	syncer *syncer
+
+	// sdNotifier reports the readiness and the health to systemd.  It's nil if
+	// AdGuard Home isn't started by systemd with the notify service type.
+	sdNotifier *sdNotifier
+
+	// mdns advertises the service endpoints over mDNS.  It's nil if the
+	// advertising is disabled.
+	mdns *mdns.Responder
+
+	// webhooks sends the server events to the configured endpoints.  It's nil
+	// if the webhooks are disabled, in which case the events are dropped.
+	webhooks *webhook.Notifier
+
+	// eventMonitor checks the upstream servers and the disk space for the
+	// webhook events.  It's nil if the webhooks are disabled.
+	eventMonitor *eventMonitor
+
+	// mqtt publishes the server state to an MQTT broker.  It's nil if the MQTT
+	// integration is disabled.
+	mqtt *mqttBridge
+
+	// snmp exposes the resolver statistics over SNMP.  It's nil if the SNMP
+	// agent is disabled.
+	snmp *snmpAgent
+
+	// confWatcher reloads the configuration file on changes.  It's nil unless
+	// AdGuard Home runs in the headless mode.
+	confWatcher *configWatcher
+
+	// reloadLock protects the running modules from the concurrent reloads of
+	// the configuration file.
+	reloadLock sync.Mutex
+
 	// etcHosts contains IP-hostname mappings taken from the OS-specific hosts
 	// configuration files, for example /etc/hosts.
 	etcHosts *aghnet.HostsContainer
@@ -79,6 +129,13 @@ type homeContext struct {
 	// tlsCipherIDs are the ID of the cipher suites that AdGuard Home must use.
 	tlsCipherIDs []uint16
 
+	// filtersLoaded is true once the filters are loaded for the first time.
+	filtersLoaded atomic.Bool
+
+	// filtersLoadErr is the error of loading the filters in the background,
+	// if any, see [filtering.Config.LazyLoading].
+	filtersLoadErr atomic.Pointer[error]
+
 	// firstRun, if true, tells AdGuard Home to only start the web interface
 	// service, and only serve the first-run APIs.
 	firstRun bool
@@ -94,6 +151,10 @@ var Context homeContext
 
 // Main is the entry point
 func Main(clientBuildFS fs.FS) {
+	if code, ok := runSubcommand(os.Args[0], os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	initCmdLineOpts()
 
 	// The configuration file path can be overridden, but other command-line
@@ -117,6 +178,11 @@ func Main(clientBuildFS fs.FS) {
 			case syscall.SIGHUP:
 				Context.clients.reloadARP()
 				Context.tls.reload()
+
+				_, err := reloadConfig()
+				if err != nil {
+					log.Error("reloading config: %s", err)
+				}
 			default:
 				cleanup(context.Background())
 				cleanupAlways()
@@ -300,6 +366,7 @@ func initContextClients() (err error) {
 
 	return Context.clients.Init(
 		config.Clients.Persistent,
+		config.Clients.Groups,
 		Context.dhcpServer,
 		Context.etcHosts,
 		arpDB,
@@ -369,11 +436,12 @@ func setupDNSFilteringConf(conf *filtering.Config) (err error) {
 
 	conf.ConfigModified = onConfigModified
 	conf.HTTPRegister = httpRegister
+	conf.FilterUpdateFailed = notifyFilterUpdateFailed
 	conf.DataDir = Context.getDataDir()
 	conf.Filters = slices.Clone(config.Filters)
 	conf.WhitelistFilters = slices.Clone(config.WhitelistFilters)
 	conf.UserRules = slices.Clone(config.UserRules)
-	conf.HTTPClient = httpClient()
+	conf.HTTPClient = httpClientWithPref(config.AddrFamilies.Filters)
 
 	cacheTime := time.Duration(conf.CacheTime) * time.Minute
 
@@ -466,6 +534,7 @@ func checkPorts() (err error) {
 			tcpPort(config.TLS.PortHTTPS),
 			tcpPort(config.TLS.PortDNSOverTLS),
 			tcpPort(config.TLS.PortDNSCrypt),
+			tcpPort(config.HTTPConfig.DoHAddress.Port()),
 		)
 
 		addPorts(udpPorts, udpPort(config.TLS.PortDNSOverQUIC))
@@ -510,7 +579,9 @@ func initWeb(opts options, clientBuildFS fs.FS, upd *updater.Updater) (web *webA
 
 		clientFS: clientFS,
 
-		BindAddr: config.HTTPConfig.Address,
+		BindAddr:    config.HTTPConfig.Address,
+		DoHAddr:     config.HTTPConfig.DoHAddress,
+		AllowedNets: config.HTTPConfig.AllowedNetworks,
 
 		ReadTimeout:       readTimeout,
 		ReadHeaderTimeout: readHdrTimeout,
@@ -559,9 +630,21 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	err = setupContext(opts)
 	fatalOnError(err)
 
+	if opts.headless && Context.firstRun {
+		fatalOnError(errHeadlessFirstRun)
+	}
+
 	err = configureOS(config)
 	fatalOnError(err)
 
+	Context.sdNotifier, err = newSDNotifier(checkHealth)
+	fatalOnError(errors.Annotate(err, "initializing sdnotify: %w"))
+
+	Context.webhooks, err = newWebhookNotifier(config.Webhooks)
+	fatalOnError(errors.Annotate(err, "initializing webhooks: %w"))
+
+	Context.webhooks.Start()
+
 	// Clients package uses filtering package's static data
 	// (filtering.BlockedSvcKnown()), so we have to initialize filtering static
 	// data first, but also to avoid relying on automatic Go init() function.
@@ -570,6 +653,9 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	err = initContextClients()
 	fatalOnError(err)
 
+	Context.syncer, err = newSyncer(config.Sync, httpClient())
+	fatalOnError(errors.Annotate(err, "initializing sync: %w"))
+
 	err = setupOpts(opts)
 	fatalOnError(err)
 
@@ -587,7 +673,7 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 	log.Debug("using config path %q for updater", confPath)
 
 	upd := updater.NewUpdater(&updater.Config{
-		Client:          config.Filtering.HTTPClient,
+		Client:          httpClientWithPref(config.AddrFamilies.Updates),
 		Version:         version.Version(),
 		Channel:         version.Channel(),
 		GOARCH:          runtime.GOARCH,
@@ -630,8 +716,10 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 		onConfigModified()
 	}
 
-	Context.web, err = initWeb(opts, clientBuildFS, upd)
-	fatalOnError(err)
+	if !opts.headless {
+		Context.web, err = initWeb(opts, clientBuildFS, upd)
+		fatalOnError(err)
+	}
 
 	if !Context.firstRun {
 		err = initDNS()
@@ -645,8 +733,58 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 				closeDNSServer()
 				fatalOnError(startErr)
 			}
+
+			// The listeners are up and the filters are loaded at this point.
+			Context.sdNotifier.Ready()
+			notifyHandover()
 		}()
 
+		Context.metricsPusher, err = newMetricsPusher(config.HTTPConfig.Metrics)
+		fatalOnError(errors.Annotate(err, "initializing metrics pusher: %w"))
+
+		if Context.metricsPusher != nil {
+			Context.metricsPusher.Start()
+		}
+
+		Context.acme, err = newACMEManager(&config.TLS)
+		fatalOnError(errors.Annotate(err, "initializing acme: %w"))
+
+		if Context.acme != nil {
+			Context.acme.Start()
+		}
+
+		Context.syncer.Start()
+
+		Context.eventMonitor = newEventMonitor(Context.webhooks, config.Webhooks, Context.getDataDir())
+		if Context.eventMonitor != nil {
+			Context.eventMonitor.Start()
+		}
+
+		Context.mqtt, err = newMQTTBridge(config.MQTT)
+		fatalOnError(errors.Annotate(err, "initializing mqtt: %w"))
+
+		Context.mqtt.Start()
+
+		Context.snmp, err = newSNMPAgent(config.SNMP)
+		fatalOnError(errors.Annotate(err, "initializing snmp: %w"))
+
+		err = Context.snmp.Start()
+		if err != nil {
+			log.Error("starting snmp agent: %s", err)
+			Context.snmp = nil
+		}
+
+		Context.mdns, err = newMDNSResponder(config.MDNS)
+		fatalOnError(errors.Annotate(err, "initializing mdns: %w"))
+
+		if Context.mdns != nil {
+			err = Context.mdns.Start()
+			if err != nil {
+				log.Error("starting mdns: %s", err)
+				Context.mdns = nil
+			}
+		}
+
 		if Context.dhcpServer != nil {
 			err = Context.dhcpServer.Start()
 			if err != nil {
@@ -655,7 +793,23 @@ func run(opts options, clientBuildFS fs.FS, done chan struct{}) {
 		}
 	}
 
-	Context.web.start()
+	if Context.firstRun {
+		// Only the web interface is going to be started, so there is nothing
+		// else to wait for.
+		Context.sdNotifier.Ready()
+	}
+
+	if opts.headless {
+		log.Info("running in headless mode, the web interface is disabled")
+
+		Context.confWatcher, err = newConfigWatcher(configFilePath())
+		fatalOnError(errors.Annotate(err, "initializing config watcher: %w"))
+
+		err = Context.confWatcher.Start()
+		fatalOnError(errors.Annotate(err, "starting config watcher: %w"))
+	} else {
+		Context.web.start()
+	}
 
 	// Wait for other goroutines to complete their job.
 	<-done
@@ -675,13 +829,25 @@ func initUsers() (auth *Auth, err error) {
 
 	trustedProxies := netutil.SliceSubnetSet(netutil.UnembedPrefixes(config.DNS.TrustedProxies))
 
+	err = validateUsers(config.Users)
+	if err != nil {
+		return nil, fmt.Errorf("validating users: %w", err)
+	}
+
+	err = validateAPITokens(config.APITokens)
+	if err != nil {
+		return nil, fmt.Errorf("validating api tokens: %w", err)
+	}
+
 	sessionTTL := config.HTTPConfig.SessionTTL.Seconds()
 	auth = InitAuth(sessFilename, config.Users, uint32(sessionTTL), rateLimiter, trustedProxies)
 	if auth == nil {
 		return nil, errors.Error("initializing auth module failed")
 	}
 
-	config.Users = nil
+	auth.tokens = config.APITokens
+
+	config.Users, config.APITokens = nil, nil
 
 	return auth, nil
 }
@@ -805,6 +971,11 @@ func initWorkingDir(opts options) (err error) {
 func cleanup(ctx context.Context) {
 	log.Info("stopping AdGuard Home")
 
+	if Context.sdNotifier != nil {
+		Context.sdNotifier.Close()
+		Context.sdNotifier = nil
+	}
+
 	if Context.web != nil {
 		Context.web.close(ctx)
 		Context.web = nil
@@ -814,6 +985,43 @@ func cleanup(ctx context.Context) {
 		Context.auth = nil
 	}
 
+	if Context.metricsPusher != nil {
+		Context.metricsPusher.Close()
+		Context.metricsPusher = nil
+	}
+
+	if Context.acme != nil {
+		Context.acme.Close()
+		Context.acme = nil
+	}
+
+	if Context.syncer != nil {
+		Context.syncer.Close()
+		Context.syncer = nil
+	}
+
+	if Context.mdns != nil {
+		Context.mdns.Close()
+		Context.mdns = nil
+	}
+
+	if Context.eventMonitor != nil {
+		Context.eventMonitor.Close()
+		Context.eventMonitor = nil
+	}
+
+	Context.webhooks.Close()
+	Context.webhooks = nil
+
+	Context.mqtt.Close()
+	Context.mqtt = nil
+
+	Context.snmp.Close()
+	Context.snmp = nil
+
+	Context.confWatcher.Close()
+	Context.confWatcher = nil
+
 	err := stopDNSServer()
 	if err != nil {
 		log.Error("stopping dns server: %s", err)
@@ -968,7 +1176,7 @@ func cmdlineUpdate(opts options, upd *updater.Updater) {
 	//
 	// TODO(e.burkov):  We could probably initialize the internal resolver
 	// separately.
-	err := initDNSServer(nil, nil, nil, nil, nil, nil, &tlsConfigSettings{})
+	err := initDNSServer(nil, nil, nil, nil, nil, nil, &tlsConfigSettings{}, nil)
 	fatalOnError(err)
 
 	log.Info("cmdline update: performing update")
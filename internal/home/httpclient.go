@@ -6,18 +6,27 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 )
 
 // httpClient returns a new HTTP client that uses the AdGuard Home's own DNS
 // server for resolving hostnames.  The resulting client should not be used
 // until [Context.dnsServer] is initialized.
+func httpClient() (c *http.Client) {
+	return httpClientWithPref(aghnet.AddrFamilyPrefAuto)
+}
+
+// httpClientWithPref is like [httpClient], but the resulting client connects to
+// the addresses of the family preferred by pref first.
 //
 // TODO(a.garipov, e.burkov): This is rather messy.  Refactor.
-func httpClient() (c *http.Client) {
-	// Do not use Context.dnsServer.DialContext directly in the struct literal
-	// below, since Context.dnsServer may be nil when this function is called.
+func httpClientWithPref(pref aghnet.AddrFamilyPref) (c *http.Client) {
+	// Do not use Context.dnsServer.NewDialContext directly in the struct
+	// literal below, since Context.dnsServer may be nil when this function is
+	// called.
 	dialContext := func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
-		return Context.dnsServer.DialContext(ctx, network, addr)
+		return Context.dnsServer.NewDialContext(pref)(ctx, network, addr)
 	}
 
 	return &http.Client{
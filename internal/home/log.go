@@ -6,10 +6,10 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghlog"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
 	"github.com/AdguardTeam/golibs/log"
 	"gopkg.in/natefinch/lumberjack.v2"
-	"gopkg.in/yaml.v3"
 )
 
 // configSyslog is used to indicate that syslog or eventlog (win) should be used
@@ -29,6 +29,33 @@ func configureLogger(opts options) (err error) {
 	// happen pretty quickly.
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
+	err = configureLogOutput(ls)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if (ls.Format == "" || ls.Format == aghlog.FormatText) && len(ls.Levels) == 0 {
+		return nil
+	}
+
+	h, err := aghlog.NewHandler(&aghlog.Config{
+		Output:  log.Writer(),
+		Levels:  ls.Levels,
+		Format:  ls.Format,
+		Verbose: ls.Verbose,
+	})
+	if err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+
+	aghlog.Install(h)
+
+	return nil
+}
+
+// configureLogOutput sets the output of the logger according to ls.
+func configureLogOutput(ls *logSettings) (err error) {
 	// Write logs to stdout by default.
 	if ls.File == "" {
 		return nil
@@ -98,7 +125,10 @@ func readLogSettings() (ls *logSettings) {
 		return nil
 	}
 
-	err = yaml.Unmarshal(yamlFile, conf)
+	// Decode the whole configuration the same way as later, so that the
+	// logging settings could be included from other files and could contain
+	// references.
+	err = conf.decodeConfig(yamlFile, filepath.Dir(configFilePath()))
 	if err != nil {
 		log.Error("Couldn't get logging settings from the configuration: %s", err)
 	}
@@ -0,0 +1,42 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLogSettings(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, 0o755))
+
+	require.NoError(t, os.WriteFile(
+		filepath.Join(confDir, "log.yaml"),
+		[]byte("log:\n  file: ${AGH_TEST_LOG_FILE}\n  verbose: true\n"),
+		0o644,
+	))
+
+	confPath := filepath.Join(dir, "AdGuardHome.yaml")
+	require.NoError(t, os.WriteFile(
+		confPath,
+		[]byte("include: ['conf.d/*.yaml']\nschema_version: 28\n"),
+		0o644,
+	))
+
+	t.Setenv("AGH_TEST_LOG_FILE", "/var/log/agh.log")
+
+	prevPath := Context.confFilePath
+	t.Cleanup(func() { Context.confFilePath = prevPath })
+
+	Context.confFilePath = confPath
+
+	ls := readLogSettings()
+	require.NotNil(t, ls)
+
+	assert.Equal(t, "/var/log/agh.log", ls.File)
+	assert.True(t, ls.Verbose)
+}
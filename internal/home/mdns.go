@@ -0,0 +1,193 @@
+package home
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/mdns"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+)
+
+// mdnsConfig is the configuration of the advertising of the service endpoints
+// over mDNS and DNS-SD.
+type mdnsConfig struct {
+	// Interface is the name of the network interface to advertise the
+	// endpoints on.  If empty, the system-chosen one is used.
+	Interface string `yaml:"interface"`
+
+	// Hostname is the host name advertised within the local domain.  If empty,
+	// the first label of the system host name is used.
+	Hostname string `yaml:"hostname"`
+
+	// Instance is the user-friendly name of the advertised service instances.
+	// If empty, [defaultMDNSInstance] is used.
+	Instance string `yaml:"instance"`
+
+	// Enabled defines if the endpoints are advertised.
+	Enabled bool `yaml:"enabled"`
+}
+
+// defaultMDNSInstance is the default name of the advertised service instances.
+const defaultMDNSInstance = "AdGuard Home"
+
+// Service types of the advertised endpoints.  _domain-s is the IANA-registered
+// service name of DNS-over-TLS.
+const (
+	mdnsTypeHTTP  = "_http._tcp"
+	mdnsTypeHTTPS = "_https._tcp"
+	mdnsTypeDoT   = "_domain-s._tcp"
+)
+
+// newMDNSResponder returns a new mDNS responder advertising the web interface
+// and the encrypted DNS endpoints from the current configuration.  r is nil if
+// conf is nil or disabled.
+func newMDNSResponder(conf *mdnsConfig) (r *mdns.Responder, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	var iface *net.Interface
+	if conf.Interface != "" {
+		iface, err = net.InterfaceByName(conf.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("interface: %w", err)
+		}
+	}
+
+	hostname := conf.Hostname
+	if hostname == "" {
+		hostname = systemHostnameLabel()
+	}
+
+	config.RLock()
+	defer config.RUnlock()
+
+	addrs, err := mdnsAddrs(iface, config.HTTPConfig.Address.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("getting addresses: %w", err)
+	}
+
+	instance := conf.Instance
+	if instance == "" {
+		instance = defaultMDNSInstance
+	}
+
+	return mdns.NewResponder(&mdns.Config{
+		Interface: iface,
+		Hostname:  hostname,
+		Addrs:     addrs,
+		Services:  mdnsServices(instance, config.HTTPConfig.Address.Port(), &config.TLS),
+	})
+}
+
+// systemHostnameLabel returns the first label of the system host name or the
+// default one, if it isn't a valid label.
+func systemHostnameLabel() (label string) {
+	const defaultLabel = "adguardhome"
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Debug("mdns: getting hostname: %s", err)
+
+		return defaultLabel
+	}
+
+	label, _, _ = strings.Cut(hostname, ".")
+	if netutil.ValidateHostnameLabel(label) != nil {
+		return defaultLabel
+	}
+
+	return label
+}
+
+// mdnsAddrs returns the addresses to advertise.  If webAddr is specified, it's
+// the only one.  Otherwise, those are the addresses of iface or, if it's nil, of
+// all the interfaces, except the loopback and the link-local ones.
+func mdnsAddrs(iface *net.Interface, webAddr netip.Addr) (addrs []netip.Addr, err error) {
+	if !webAddr.IsUnspecified() {
+		return []netip.Addr{webAddr}, nil
+	}
+
+	var ifaceAddrs []net.Addr
+	if iface != nil {
+		ifaceAddrs, err = iface.Addrs()
+	} else {
+		ifaceAddrs, err = net.InterfaceAddrs()
+	}
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	for _, a := range ifaceAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+
+		ip = ip.Unmap()
+		if !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+			addrs = append(addrs, ip)
+		}
+	}
+
+	return addrs, nil
+}
+
+// mdnsServices returns the services to advertise: the web interface served on
+// webPort, as well as the DNS-over-HTTPS and the DNS-over-TLS endpoints, if
+// enabled in tlsConf.
+func mdnsServices(instance string, webPort uint16, tlsConf *tlsConfigSettings) (svcs []*mdns.Service) {
+	httpsEnabled := tlsConf.Enabled && tlsConf.PortHTTPS != 0
+
+	web := &mdns.Service{
+		Instance: instance,
+		Type:     mdnsTypeHTTP,
+		TXT:      []string{"path=/"},
+		Port:     webPort,
+	}
+
+	if httpsEnabled && tlsConf.ForceHTTPS {
+		web.Type = mdnsTypeHTTPS
+		web.Port = tlsConf.PortHTTPS
+	}
+
+	svcs = append(svcs, web)
+	if !tlsConf.Enabled {
+		return svcs
+	}
+
+	var hostTXT []string
+	if tlsConf.ServerName != "" {
+		hostTXT = []string{"host=" + tlsConf.ServerName}
+	}
+
+	if httpsEnabled {
+		svcs = append(svcs, &mdns.Service{
+			Instance: instance + " DNS-over-HTTPS",
+			Type:     mdnsTypeHTTPS,
+			TXT:      append([]string{"path=/dns-query"}, hostTXT...),
+			Port:     tlsConf.PortHTTPS,
+		})
+	}
+
+	if tlsConf.PortDNSOverTLS != 0 {
+		svcs = append(svcs, &mdns.Service{
+			Instance: instance,
+			Type:     mdnsTypeDoT,
+			TXT:      hostTXT,
+			Port:     tlsConf.PortDNSOverTLS,
+		})
+	}
+
+	return svcs
+}
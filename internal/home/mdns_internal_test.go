@@ -0,0 +1,94 @@
+package home
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/mdns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMDNSServices(t *testing.T) {
+	const (
+		inst    = "AdGuard Home"
+		webPort = 3000
+	)
+
+	webHTTP := &mdns.Service{
+		Instance: inst,
+		Type:     mdnsTypeHTTP,
+		TXT:      []string{"path=/"},
+		Port:     webPort,
+	}
+
+	testCases := []struct {
+		tlsConf *tlsConfigSettings
+		name    string
+		want    []*mdns.Service
+	}{{
+		tlsConf: &tlsConfigSettings{},
+		name:    "plain",
+		want:    []*mdns.Service{webHTTP},
+	}, {
+		tlsConf: &tlsConfigSettings{
+			Enabled:        true,
+			ServerName:     "dns.example.com",
+			PortDNSOverTLS: 853,
+		},
+		name: "dot_only",
+		want: []*mdns.Service{webHTTP, {
+			Instance: inst,
+			Type:     mdnsTypeDoT,
+			TXT:      []string{"host=dns.example.com"},
+			Port:     853,
+		}},
+	}, {
+		tlsConf: &tlsConfigSettings{
+			Enabled:        true,
+			ServerName:     "dns.example.com",
+			ForceHTTPS:     true,
+			PortHTTPS:      443,
+			PortDNSOverTLS: 853,
+		},
+		name: "all",
+		want: []*mdns.Service{{
+			Instance: inst,
+			Type:     mdnsTypeHTTPS,
+			TXT:      []string{"path=/"},
+			Port:     443,
+		}, {
+			Instance: inst + " DNS-over-HTTPS",
+			Type:     mdnsTypeHTTPS,
+			TXT:      []string{"path=/dns-query", "host=dns.example.com"},
+			Port:     443,
+		}, {
+			Instance: inst,
+			Type:     mdnsTypeDoT,
+			TXT:      []string{"host=dns.example.com"},
+			Port:     853,
+		}},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, mdnsServices(inst, webPort, tc.tlsConf))
+		})
+	}
+}
+
+func TestMDNSAddrs(t *testing.T) {
+	webAddr := netip.MustParseAddr("192.168.1.1")
+
+	addrs, err := mdnsAddrs(nil, webAddr)
+	require.NoError(t, err)
+
+	assert.Equal(t, []netip.Addr{webAddr}, addrs)
+
+	addrs, err = mdnsAddrs(nil, netip.IPv4Unspecified())
+	require.NoError(t, err)
+
+	for _, a := range addrs {
+		assert.False(t, a.IsLoopback(), a)
+	}
+}
@@ -0,0 +1,95 @@
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/metrics"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// processStart is the time the process has started at.
+var processStart = time.Now()
+
+// registerMetricsHandler registers the handler of the metrics endpoint, if
+// it's enabled.
+func registerMetricsHandler() {
+	conf := config.HTTPConfig.Metrics
+	if conf == nil || !conf.Enabled {
+		return
+	}
+
+	h := ensure(http.MethodGet, handleMetrics)
+	if conf.RequireAuth {
+		h = optionalAuth(h)
+	}
+
+	Context.mux.HandleFunc("/metrics", postInstall(h))
+}
+
+// writeMetrics writes all the metrics in the Prometheus text-based exposition
+// format to w.
+func writeMetrics(w io.Writer) (err error) {
+	err = metrics.WriteRuntime(w, processStart)
+	if err == nil && Context.dnsServer != nil {
+		err = Context.dnsServer.WriteMetrics(w)
+	}
+
+	if err == nil && Context.filters != nil {
+		err = Context.filters.WriteMetrics(w)
+	}
+
+	return err
+}
+
+// handleMetrics is the handler for the GET /metrics HTTP API.  It writes the
+// metrics in the Prometheus text-based exposition format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	buf := &bytes.Buffer{}
+
+	err := writeMetrics(buf)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "writing metrics: %s", err)
+
+		return
+	}
+
+	w.Header().Set(httphdr.ContentType, metrics.ContentType)
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		log.Debug("metrics: writing response: %s", err)
+	}
+}
+
+// newMetricsPusher returns a new pusher of the metrics, if it's enabled.
+// metricsConf may be nil.
+func newMetricsPusher(metricsConf *httpMetricsConfig) (p *metrics.Pusher, err error) {
+	if metricsConf == nil || metricsConf.Push == nil || !metricsConf.Push.Enabled {
+		return nil, nil
+	}
+
+	conf := metricsConf.Push
+
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing url: %w", err)
+	}
+
+	return metrics.NewPusher(&metrics.PushConfig{
+		Gather:     writeMetrics,
+		HTTPClient: httpClient(),
+		URL:        u,
+		Format:     conf.Format,
+		Token:      conf.Token,
+		Org:        conf.Org,
+		Bucket:     conf.Bucket,
+		Interval:   conf.Interval.Duration,
+	})
+}
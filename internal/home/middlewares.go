@@ -3,8 +3,13 @@ package home
 import (
 	"io"
 	"net/http"
+	"net/netip"
+	"strings"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghacme"
 	"github.com/AdguardTeam/golibs/ioutil"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
 )
 
 // middlerware is a wrapper function signature.
@@ -28,6 +33,9 @@ const (
 	// largerReqBodySzLim is the maximum request body size for APIs expecting
 	// larger requests.
 	largerReqBodySzLim = 4 * 1024 * 1024
+
+	// restoreReqBodySzLim is the maximum size of the backup archive.
+	restoreReqBodySzLim = 1024 * 1024 * 1024
 )
 
 // expectsLargerRequests shows if this request should use a larger body size
@@ -45,7 +53,10 @@ func expectsLargerRequests(r *http.Request) (ok bool) {
 
 	p := r.URL.Path
 	return p == "/control/access/set" ||
-		p == "/control/filtering/set_rules"
+		p == "/control/clients/import" ||
+		p == "/control/dhcp/leases/import" ||
+		p == "/control/filtering/set_rules" ||
+		p == "/control/sync/import"
 }
 
 // limitRequestBody wraps underlying handler h, making it's request's body Read
@@ -53,7 +64,9 @@ func expectsLargerRequests(r *http.Request) (ok bool) {
 func limitRequestBody(h http.Handler) (limited http.Handler) {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var szLim uint64 = defaultReqBodySzLim
-		if expectsLargerRequests(r) {
+		if r.Method == http.MethodPost && r.URL.Path == "/control/restore" {
+			szLim = restoreReqBodySzLim
+		} else if expectsLargerRequests(r) {
 			szLim = largerReqBodySzLim
 		}
 
@@ -67,3 +80,81 @@ func limitRequestBody(h http.Handler) (limited http.Handler) {
 		h.ServeHTTP(w, rr)
 	})
 }
+
+// dohPath is the path of the DNS-over-HTTPS handler.  The paths under it
+// contain the ClientIDs.
+const dohPath = "/dns-query"
+
+// isDoHPath returns true if p is the path of the DNS-over-HTTPS handler.
+func isDoHPath(p string) (ok bool) {
+	return p == dohPath || strings.HasPrefix(p, dohPath+"/")
+}
+
+// isPublicPath returns true if p is accessible regardless of the allowed
+// networks.
+func isPublicPath(p string) (ok bool) {
+	return isDoHPath(p) ||
+		strings.HasPrefix(p, aghacme.HTTP01Path) ||
+		p == healthzPath ||
+		p == readyzPath
+}
+
+// allowedNetworksHandler returns a middleware, which responds with 403
+// Forbidden to the requests from outside of nets, except for the public paths.
+// The address of the peer is used instead of the proxy headers, since those can
+// be forged.  If nets is empty, all requests are allowed.
+func allowedNetworksHandler(nets []netip.Prefix) (mw middleware) {
+	return func(h http.Handler) (wrapped http.Handler) {
+		if len(nets) == 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublicPath(r.URL.Path) || isAllowedRemote(r.RemoteAddr, nets) {
+				h.ServeHTTP(w, r)
+
+				return
+			}
+
+			log.Debug("web: %s %s from %s: not in allowed networks", r.Method, r.URL.Path, r.RemoteAddr)
+
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
+
+// isAllowedRemote returns true if the address of remoteAddr is within nets.
+func isAllowedRemote(remoteAddr string, nets []netip.Prefix) (ok bool) {
+	host, err := netutil.SplitHost(remoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+
+	ip = ip.Unmap()
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dohOnlyHandler wraps h, responding with 404 Not Found to all the requests,
+// except for the DNS-over-HTTPS ones.
+func dohOnlyHandler(h http.Handler) (wrapped http.Handler) {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isDoHPath(r.URL.Path) {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
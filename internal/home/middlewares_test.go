@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
 
@@ -66,3 +67,120 @@ func TestLimitRequestBody(t *testing.T) {
 		})
 	}
 }
+
+func TestAllowedNetworksHandler(t *testing.T) {
+	nets := []netip.Prefix{
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	h := withMiddlewares(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}),
+		allowedNetworksHandler(nets),
+	)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		path       string
+		wantCode   int
+	}{{
+		name:       "allowed_ipv4",
+		remoteAddr: "192.168.1.1:12345",
+		path:       "/control/status",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "allowed_ipv4_mapped",
+		remoteAddr: "[::ffff:192.168.1.1]:12345",
+		path:       "/control/status",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "allowed_ipv6",
+		remoteAddr: "[fd00::1]:12345",
+		path:       "/",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "forbidden",
+		remoteAddr: "1.2.3.4:12345",
+		path:       "/control/status",
+		wantCode:   http.StatusForbidden,
+	}, {
+		name:       "doh",
+		remoteAddr: "1.2.3.4:12345",
+		path:       "/dns-query",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "doh_client_id",
+		remoteAddr: "1.2.3.4:12345",
+		path:       "/dns-query/cli",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "acme",
+		remoteAddr: "1.2.3.4:12345",
+		path:       "/.well-known/acme-challenge/token",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "health",
+		remoteAddr: "1.2.3.4:12345",
+		path:       "/healthz",
+		wantCode:   http.StatusOK,
+	}, {
+		name:       "bad_addr",
+		remoteAddr: "bad",
+		path:       "/",
+		wantCode:   http.StatusForbidden,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://www.example.com"+tc.path, nil)
+			r.RemoteAddr = tc.remoteAddr
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
+
+func TestDoHOnlyHandler(t *testing.T) {
+	h := dohOnlyHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{{
+		name:     "doh",
+		path:     "/dns-query",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "doh_client_id",
+		path:     "/dns-query/cli",
+		wantCode: http.StatusOK,
+	}, {
+		name:     "ui",
+		path:     "/",
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "api",
+		path:     "/control/status",
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "prefix",
+		path:     "/dns-query-other",
+		wantCode: http.StatusNotFound,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://www.example.com"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
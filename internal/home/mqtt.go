@@ -0,0 +1,591 @@
+package home
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/mqtt"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// mqttConfig is the configuration of the MQTT integration, which publishes the
+// server state to an MQTT broker and accepts the commands from it.
+type mqttConfig struct {
+	// Broker is the address of the MQTT broker in the host:port form.
+	Broker string `yaml:"broker"`
+
+	// ClientID is the MQTT client identifier, which is also used to identify
+	// the device in Home Assistant.  If empty, the first label of the system
+	// host name is used.
+	ClientID string `yaml:"client_id"`
+
+	// Username is the name of the user.  If empty, no credentials are sent.
+	Username string `yaml:"username"`
+
+	// Password is the password of the user.
+	Password string `yaml:"password"`
+
+	// TopicPrefix is the prefix of the state and command topics.  If empty,
+	// [defaultMQTTTopicPrefix] is used.
+	TopicPrefix string `yaml:"topic_prefix"`
+
+	// DiscoveryPrefix is the prefix of the Home Assistant discovery topics.  If
+	// empty, [defaultMQTTDiscoveryPrefix] is used.
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+
+	// PublishInterval is the interval between the publications of the
+	// sensors.  If zero, [defaultMQTTPublishIvl] is used.
+	PublishInterval timeutil.Duration `yaml:"publish_interval"`
+
+	// TLS defines if the connection to the broker is encrypted.
+	TLS bool `yaml:"tls"`
+
+	// Discovery defines if the Home Assistant discovery payloads are
+	// published.
+	Discovery bool `yaml:"discovery"`
+
+	// Enabled defines if the integration is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Default values of the MQTT configuration.
+const (
+	defaultMQTTTopicPrefix     = "adguardhome"
+	defaultMQTTDiscoveryPrefix = "homeassistant"
+	defaultMQTTPublishIvl      = 30 * time.Second
+	defaultMQTTReconnectDelay  = 10 * time.Second
+	mqttConnectTimeout         = 10 * time.Second
+	mqttKeepAlive              = 60 * time.Second
+)
+
+// Payloads of the MQTT messages.
+const (
+	mqttPayloadOnline  = "online"
+	mqttPayloadOffline = "offline"
+	mqttPayloadOn      = "ON"
+	mqttPayloadOff     = "OFF"
+)
+
+// mqttState is the state of the server published to the broker.
+type mqttState struct {
+	// total is the number of the queries processed since the start.
+	total uint64
+
+	// blocked is the number of the queries blocked since the start.
+	blocked uint64
+
+	// qps is the number of the queries within the last second.
+	qps uint64
+
+	// protection is true if the protection is enabled.
+	protection bool
+}
+
+// mqttBridge publishes the server state to an MQTT broker and toggles the
+// protection by the commands received from it.  A nil *mqttBridge is a valid
+// bridge, which does nothing.
+type mqttBridge struct {
+	// state returns the current state of the server.  ok is false if the DNS
+	// server isn't running.
+	state func() (s *mqttState, ok bool)
+
+	// setProtection enables or disables the protection.
+	setProtection func(enabled bool)
+
+	// connect connects to the broker.
+	connect func(ctx context.Context) (c *mqtt.Client, err error)
+
+	// mu protects client.
+	mu *sync.Mutex
+
+	// client is the current connection to the broker.  It's nil if the bridge
+	// isn't connected.
+	client *mqtt.Client
+
+	// done is closed when the bridge is closed.
+	done chan struct{}
+
+	// nodeID identifies the device in the topics and in Home Assistant.
+	nodeID string
+
+	topicPrefix     string
+	discoveryPrefix string
+
+	publishIvl time.Duration
+
+	discovery bool
+}
+
+// newMQTTBridge returns a new MQTT bridge from conf.  b is nil if conf is nil
+// or disabled.
+func newMQTTBridge(conf *mqttConfig) (b *mqttBridge, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	_, _, err = net.SplitHostPort(conf.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("broker: %w", err)
+	}
+
+	nodeID := conf.ClientID
+	if nodeID == "" {
+		nodeID = systemHostnameLabel()
+	}
+
+	b = &mqttBridge{
+		state:           currentMQTTState,
+		setProtection:   func(enabled bool) { Context.dnsServer.SetProtectionEnabled(enabled) },
+		mu:              &sync.Mutex{},
+		done:            make(chan struct{}),
+		nodeID:          nodeID,
+		topicPrefix:     strings.TrimSuffix(stringOr(conf.TopicPrefix, defaultMQTTTopicPrefix), "/"),
+		discoveryPrefix: strings.TrimSuffix(stringOr(conf.DiscoveryPrefix, defaultMQTTDiscoveryPrefix), "/"),
+		publishIvl:      durationOr(conf.PublishInterval, defaultMQTTPublishIvl),
+		discovery:       conf.Discovery,
+	}
+
+	mconf := &mqtt.Config{
+		Will: &mqtt.Message{
+			Topic:   b.topic("status"),
+			Payload: []byte(mqttPayloadOffline),
+			Retain:  true,
+		},
+		Addr:      conf.Broker,
+		ClientID:  nodeID,
+		Username:  conf.Username,
+		Password:  conf.Password,
+		KeepAlive: mqttKeepAlive,
+	}
+	if conf.TLS {
+		host, _, _ := net.SplitHostPort(conf.Broker)
+		mconf.TLSConfig = &tls.Config{ServerName: host}
+	}
+
+	b.connect = func(ctx context.Context) (c *mqtt.Client, err error) {
+		return mqtt.Connect(ctx, mconf)
+	}
+
+	return b, nil
+}
+
+// stringOr returns s or def, if s is empty.
+func stringOr(s, def string) (res string) {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
+
+// currentMQTTState returns the current state of the DNS server.
+func currentMQTTState() (s *mqttState, ok bool) {
+	if !isRunning() {
+		return nil, false
+	}
+
+	dnsSrv := Context.dnsServer
+	s = &mqttState{
+		qps: dnsSrv.QPS(),
+	}
+	s.protection, _ = dnsSrv.UpdatedProtectionStatus()
+	s.total, s.blocked = dnsSrv.QueryCounts()
+
+	return s, true
+}
+
+// topic returns the state or command topic with the name.
+func (b *mqttBridge) topic(name string) (t string) {
+	return b.topicPrefix + "/" + b.nodeID + "/" + name
+}
+
+// Start connects to the broker in a separate goroutine.
+func (b *mqttBridge) Start() {
+	if b == nil {
+		return
+	}
+
+	go b.loop()
+}
+
+// Close disconnects from the broker.  It must only be called once.
+func (b *mqttBridge) Close() {
+	if b == nil {
+		return
+	}
+
+	close(b.done)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != nil {
+		// Mark the device unavailable explicitly, since the broker only
+		// publishes the will on unexpected disconnections.
+		_ = b.client.Publish(&mqtt.Message{
+			Topic:   b.topic("status"),
+			Payload: []byte(mqttPayloadOffline),
+			Retain:  true,
+		})
+
+		err := b.client.Close()
+		if err != nil {
+			log.Debug("mqtt: closing connection: %s", err)
+		}
+
+		b.client = nil
+	}
+}
+
+// NotifyNewClient publishes the information about the new runtime client with
+// ip and host found in src.
+func (b *mqttBridge) NotifyNewClient(ip netip.Addr, host, src string) {
+	if b == nil {
+		return
+	}
+
+	payload, err := json.Marshal(&mqttNewClient{
+		IP:     ip,
+		Host:   host,
+		Source: src,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		log.Error("mqtt: encoding new client: %s", err)
+
+		return
+	}
+
+	b.publish(&mqtt.Message{
+		Topic:   b.topic("new_client"),
+		Payload: payload,
+		Retain:  true,
+	})
+}
+
+// mqttNewClient is the payload of the message about a new runtime client.
+type mqttNewClient struct {
+	Time   time.Time  `json:"time"`
+	Host   string     `json:"host,omitempty"`
+	Source string     `json:"source"`
+	IP     netip.Addr `json:"ip"`
+}
+
+// loop connects to the broker and serves the connection until b is closed,
+// reconnecting after failures.
+func (b *mqttBridge) loop() {
+	defer log.OnPanic("mqtt: bridge")
+
+	for {
+		err := b.session()
+		if err != nil {
+			log.Error("mqtt: %s", err)
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-time.After(defaultMQTTReconnectDelay):
+			// Go on.
+		}
+	}
+}
+
+// session connects to the broker, announces the device, and serves the
+// connection until it fails or b is closed.
+func (b *mqttBridge) session() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mqttConnectTimeout)
+	defer cancel()
+
+	c, err := b.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+
+	b.mu.Lock()
+	select {
+	case <-b.done:
+		b.mu.Unlock()
+
+		return c.Close()
+	default:
+		b.client = c
+	}
+	b.mu.Unlock()
+
+	defer func() { err = errors.WithDeferred(err, b.disconnect(c)) }()
+
+	log.Info("mqtt: connected to broker")
+
+	err = b.announce(c)
+	if err != nil {
+		return fmt.Errorf("announcing: %w", err)
+	}
+
+	stopPublish := make(chan struct{})
+	defer close(stopPublish)
+
+	go b.publishLoop(stopPublish)
+
+	return c.Serve(b.handleMessage)
+}
+
+// disconnect closes c unless it has already been closed by [mqttBridge.Close].
+func (b *mqttBridge) disconnect(c *mqtt.Client) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != c {
+		return nil
+	}
+
+	b.client = nil
+
+	return c.Close()
+}
+
+// announce subscribes to the command topic and publishes the discovery
+// payloads, the availability, and the current state.
+func (b *mqttBridge) announce(c *mqtt.Client) (err error) {
+	err = c.Subscribe(b.topic("protection/set"))
+	if err != nil {
+		return fmt.Errorf("subscribing: %w", err)
+	}
+
+	if b.discovery {
+		for _, msg := range b.discoveryMessages() {
+			err = c.Publish(msg)
+			if err != nil {
+				return fmt.Errorf("publishing discovery to %q: %w", msg.Topic, err)
+			}
+		}
+	}
+
+	err = c.Publish(&mqtt.Message{
+		Topic:   b.topic("status"),
+		Payload: []byte(mqttPayloadOnline),
+		Retain:  true,
+	})
+	if err != nil {
+		return fmt.Errorf("publishing availability: %w", err)
+	}
+
+	b.publishState()
+
+	return nil
+}
+
+// publishLoop publishes the state each interval until stop is closed.
+func (b *mqttBridge) publishLoop(stop chan struct{}) {
+	defer log.OnPanic("mqtt: publishing")
+
+	t := time.NewTicker(b.publishIvl)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			b.publishState()
+		}
+	}
+}
+
+// publishState publishes the current state of the server, if it's running.
+func (b *mqttBridge) publishState() {
+	s, ok := b.state()
+	if !ok {
+		return
+	}
+
+	for _, msg := range b.stateMessages(s) {
+		b.publish(msg)
+	}
+}
+
+// stateMessages returns the messages with the values of the sensors from s.
+func (b *mqttBridge) stateMessages(s *mqttState) (msgs []*mqtt.Message) {
+	protection := mqttPayloadOff
+	if s.protection {
+		protection = mqttPayloadOn
+	}
+
+	return []*mqtt.Message{{
+		Topic:   b.topic("protection"),
+		Payload: []byte(protection),
+		Retain:  true,
+	}, {
+		Topic:   b.topic("queries_per_second"),
+		Payload: strconv.AppendUint(nil, s.qps, 10),
+	}, {
+		Topic:   b.topic("queries_total"),
+		Payload: strconv.AppendUint(nil, s.total, 10),
+	}, {
+		Topic:   b.topic("queries_blocked"),
+		Payload: strconv.AppendUint(nil, s.blocked, 10),
+	}}
+}
+
+// publish sends msg, if b is connected.
+func (b *mqttBridge) publish(msg *mqtt.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client == nil {
+		return
+	}
+
+	err := b.client.Publish(msg)
+	if err != nil {
+		log.Debug("mqtt: publishing to %q: %s", msg.Topic, err)
+	}
+}
+
+// handleMessage handles the commands received from the broker.
+func (b *mqttBridge) handleMessage(msg *mqtt.Message) {
+	if msg.Topic != b.topic("protection/set") {
+		log.Debug("mqtt: unexpected message on topic %q", msg.Topic)
+
+		return
+	}
+
+	var enabled bool
+	switch p := strings.ToUpper(strings.TrimSpace(string(msg.Payload))); p {
+	case mqttPayloadOn:
+		enabled = true
+	case mqttPayloadOff:
+		enabled = false
+	default:
+		log.Info("mqtt: bad protection command %q", p)
+
+		return
+	}
+
+	if _, ok := b.state(); !ok {
+		log.Info("mqtt: dns server is not running, ignoring protection command")
+
+		return
+	}
+
+	log.Info("mqtt: setting protection to %t", enabled)
+
+	b.setProtection(enabled)
+	b.publishState()
+}
+
+// haDevice is the device object of the Home Assistant discovery payload.
+type haDevice struct {
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+	SWVersion    string   `json:"sw_version"`
+	Identifiers  []string `json:"identifiers"`
+}
+
+// haEntity is the Home Assistant discovery payload of a single entity.
+type haEntity struct {
+	Device              *haDevice `json:"device"`
+	Name                string    `json:"name"`
+	UniqueID            string    `json:"unique_id"`
+	StateTopic          string    `json:"state_topic"`
+	CommandTopic        string    `json:"command_topic,omitempty"`
+	AvailabilityTopic   string    `json:"availability_topic"`
+	Icon                string    `json:"icon,omitempty"`
+	StateClass          string    `json:"state_class,omitempty"`
+	UnitOfMeasurement   string    `json:"unit_of_measurement,omitempty"`
+	ValueTemplate       string    `json:"value_template,omitempty"`
+	JSONAttributesTopic string    `json:"json_attributes_topic,omitempty"`
+}
+
+// discoveryMessages returns the Home Assistant discovery messages for all the
+// entities of the device.
+func (b *mqttBridge) discoveryMessages() (msgs []*mqtt.Message) {
+	dev := &haDevice{
+		Name:         "AdGuard Home (" + b.nodeID + ")",
+		Manufacturer: "AdGuard",
+		Model:        "AdGuard Home",
+		SWVersion:    version.Version(),
+		Identifiers:  []string{"adguardhome_" + b.nodeID},
+	}
+
+	entities := []struct {
+		ent       *haEntity
+		component string
+		objectID  string
+	}{{
+		ent: &haEntity{
+			Name:         "Protection",
+			StateTopic:   b.topic("protection"),
+			CommandTopic: b.topic("protection/set"),
+			Icon:         "mdi:shield-check",
+		},
+		component: "switch",
+		objectID:  "protection",
+	}, {
+		ent: &haEntity{
+			Name:              "Queries per second",
+			StateTopic:        b.topic("queries_per_second"),
+			Icon:              "mdi:speedometer",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "q/s",
+		},
+		component: "sensor",
+		objectID:  "queries_per_second",
+	}, {
+		ent: &haEntity{
+			Name:       "Queries",
+			StateTopic: b.topic("queries_total"),
+			Icon:       "mdi:dns",
+			StateClass: "total_increasing",
+		},
+		component: "sensor",
+		objectID:  "queries_total",
+	}, {
+		ent: &haEntity{
+			Name:       "Blocked queries",
+			StateTopic: b.topic("queries_blocked"),
+			Icon:       "mdi:cancel",
+			StateClass: "total_increasing",
+		},
+		component: "sensor",
+		objectID:  "queries_blocked",
+	}, {
+		ent: &haEntity{
+			Name:                "New client",
+			StateTopic:          b.topic("new_client"),
+			Icon:                "mdi:devices",
+			ValueTemplate:       "{{ value_json.ip }}",
+			JSONAttributesTopic: b.topic("new_client"),
+		},
+		component: "sensor",
+		objectID:  "new_client",
+	}}
+
+	for _, e := range entities {
+		e.ent.Device = dev
+		e.ent.UniqueID = "adguardhome_" + b.nodeID + "_" + e.objectID
+		e.ent.AvailabilityTopic = b.topic("status")
+
+		// Don't check the error, since the payloads are always valid JSON.
+		payload, _ := json.Marshal(e.ent)
+		msgs = append(msgs, &mqtt.Message{
+			Topic:   b.discoveryPrefix + "/" + e.component + "/" + b.nodeID + "/" + e.objectID + "/config",
+			Payload: payload,
+			Retain:  true,
+		})
+	}
+
+	return msgs
+}
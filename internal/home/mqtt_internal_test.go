@@ -0,0 +1,93 @@
+package home
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/mqtt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMQTTBridge returns a new disconnected *mqttBridge with the state st,
+// which records the protection commands into got.
+func newTestMQTTBridge(st *mqttState, got *[]bool) (b *mqttBridge) {
+	return &mqttBridge{
+		state: func() (s *mqttState, ok bool) { return st, st != nil },
+		setProtection: func(enabled bool) {
+			*got = append(*got, enabled)
+		},
+		mu:              &sync.Mutex{},
+		nodeID:          "router",
+		topicPrefix:     defaultMQTTTopicPrefix,
+		discoveryPrefix: defaultMQTTDiscoveryPrefix,
+	}
+}
+
+func TestMQTTBridge_HandleMessage(t *testing.T) {
+	var got []bool
+	b := newTestMQTTBridge(&mqttState{}, &got)
+
+	const cmdTopic = "adguardhome/router/protection/set"
+
+	b.handleMessage(&mqtt.Message{Topic: cmdTopic, Payload: []byte("OFF")})
+	b.handleMessage(&mqtt.Message{Topic: cmdTopic, Payload: []byte(" on\n")})
+	b.handleMessage(&mqtt.Message{Topic: cmdTopic, Payload: []byte("toggle")})
+	b.handleMessage(&mqtt.Message{Topic: "adguardhome/router/other", Payload: []byte("ON")})
+	assert.Equal(t, []bool{false, true}, got)
+
+	b.state = func() (s *mqttState, ok bool) { return nil, false }
+	b.handleMessage(&mqtt.Message{Topic: cmdTopic, Payload: []byte("OFF")})
+	assert.Equal(t, []bool{false, true}, got)
+}
+
+func TestMQTTBridge_StateMessages(t *testing.T) {
+	b := newTestMQTTBridge(nil, nil)
+
+	msgs := b.stateMessages(&mqttState{
+		total:      100,
+		blocked:    25,
+		qps:        3,
+		protection: true,
+	})
+
+	got := map[string]string{}
+	for _, msg := range msgs {
+		got[msg.Topic] = string(msg.Payload)
+	}
+
+	assert.Equal(t, map[string]string{
+		"adguardhome/router/protection":         "ON",
+		"adguardhome/router/queries_per_second": "3",
+		"adguardhome/router/queries_total":      "100",
+		"adguardhome/router/queries_blocked":    "25",
+	}, got)
+}
+
+func TestMQTTBridge_DiscoveryMessages(t *testing.T) {
+	b := newTestMQTTBridge(nil, nil)
+
+	msgs := b.discoveryMessages()
+	require.NotEmpty(t, msgs)
+
+	msg := msgs[0]
+	assert.Equal(t, "homeassistant/switch/router/protection/config", msg.Topic)
+	assert.True(t, msg.Retain)
+
+	ent := &haEntity{}
+	err := json.Unmarshal(msg.Payload, ent)
+	require.NoError(t, err)
+
+	assert.Equal(t, "adguardhome_router_protection", ent.UniqueID)
+	assert.Equal(t, "adguardhome/router/protection", ent.StateTopic)
+	assert.Equal(t, "adguardhome/router/protection/set", ent.CommandTopic)
+	assert.Equal(t, "adguardhome/router/status", ent.AvailabilityTopic)
+	require.NotNil(t, ent.Device)
+
+	assert.Equal(t, []string{"adguardhome_router"}, ent.Device.Identifiers)
+
+	for _, m := range msgs[1:] {
+		assert.Regexp(t, `^homeassistant/sensor/router/\w+/config$`, m.Topic)
+	}
+}
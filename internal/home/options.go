@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/netip"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/configmigrate"
 	"github.com/AdguardTeam/AdGuardHome/internal/version"
 	"github.com/AdguardTeam/golibs/log"
@@ -71,6 +73,10 @@ type options struct {
 	// glinetMode shows if the GL-Inet compatibility mode is enabled.
 	glinetMode bool
 
+	// headless, if set, makes AdGuard Home run without the web interface and
+	// the HTTP API, applying the changes of the configuration file instead.
+	headless bool
+
 	// noEtcHosts flag should be provided when /etc/hosts file shouldn't be
 	// used.
 	noEtcHosts bool
@@ -142,7 +148,7 @@ var cmdLineOpts = []cmdLineOpt{{
 	shortName:       "w",
 }, {
 	updateWithValue: func(o options, v string) (oo options, err error) {
-		o.bindHost, err = netip.ParseAddr(v)
+		o.bindHost, err = aghnet.ParseAddr(v)
 
 		return o, err
 	},
@@ -305,6 +311,14 @@ var cmdLineOpts = []cmdLineOpt{{
 	description:     "Run in GL-Inet compatibility mode.",
 	longName:        "glinet",
 	shortName:       "",
+}, {
+	updateWithValue: nil,
+	updateNoValue:   func(o options) (options, error) { o.headless = true; return o, nil },
+	effect:          nil,
+	serialize:       func(o options) (val string, ok bool) { return "", o.headless },
+	description:     "Run without the web interface and the HTTP API, reloading the config file on changes.",
+	longName:        "headless",
+	shortName:       "",
 }, {
 	updateWithValue: nil,
 	updateNoValue:   nil,
@@ -335,10 +349,21 @@ func printHelp(exec string) {
 	stringutil.WriteToBuilder(
 		b,
 		"Usage:\n\n",
-		fmt.Sprintf("%s [options]\n\n", exec),
-		"Options:\n",
+		fmt.Sprintf("%s [options]\n", exec),
 	)
 
+	cmds := make([]string, 0, len(cliCommands))
+	for _, cmd := range cliCommands {
+		cmds = append(cmds, cmd.usage)
+	}
+
+	slices.Sort(cmds)
+	for _, usage := range cmds {
+		stringutil.WriteToBuilder(b, exec, " ", usage, "\n")
+	}
+
+	stringutil.WriteToBuilder(b, "\nOptions:\n")
+
 	var err error
 	for _, opt := range cmdLineOpts {
 		val := ""
@@ -145,6 +145,11 @@ func TestParseGLInet(t *testing.T) {
 	assert.True(t, testParseOK(t, "--glinet").glinetMode, "--glinet is GL-Inet mode")
 }
 
+func TestParseHeadless(t *testing.T) {
+	assert.False(t, testParseOK(t).headless, "empty is not headless mode")
+	assert.True(t, testParseOK(t, "--headless").headless, "--headless is headless mode")
+}
+
 func TestParseUnknown(t *testing.T) {
 	testParseErr(t, "unknown word", "x")
 	testParseErr(t, "unknown short", "-x")
@@ -207,6 +212,10 @@ func TestOptsToArgs(t *testing.T) {
 		name: "glinet_mode",
 		args: []string{"--glinet"},
 		opts: options{glinetMode: true},
+	}, {
+		name: "headless",
+		args: []string{"--headless"},
+		opts: options{headless: true},
 	}, {
 		name: "multiple",
 		args: []string{
@@ -43,11 +43,22 @@ type profileJSON struct {
 	Name     string `json:"name"`
 	Language string `json:"language"`
 	Theme    Theme  `json:"theme"`
+
+	// Role is the role of the current user.  It's ignored in the update
+	// requests.
+	Role userRole `json:"role,omitempty"`
+
+	// TOTPEnabled is true if the current user has the two-factor
+	// authentication enabled.  It's ignored in the update requests.
+	TOTPEnabled bool `json:"totp_enabled"`
 }
 
 // handleGetProfile is the handler for GET /control/profile endpoint.
 func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	u := Context.auth.getCurrentUser(r)
+	if u.Name != "" && u.Role == "" {
+		u.Role = userRoleAdmin
+	}
 
 	var resp profileJSON
 	func() {
@@ -55,9 +66,11 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 		defer config.RUnlock()
 
 		resp = profileJSON{
-			Name:     u.Name,
-			Language: config.Language,
-			Theme:    config.Theme,
+			Name:        u.Name,
+			Language:    config.Language,
+			Theme:       config.Theme,
+			Role:        u.Role,
+			TOTPEnabled: u.TOTPSecret != "",
 		}
 	}()
 
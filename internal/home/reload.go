@@ -0,0 +1,422 @@
+package home
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// reloadResp is the result of reloading the configuration file and the
+// response to the POST /control/reload HTTP API.
+type reloadResp struct {
+	// Applied are the top-level objects of the configuration file, which
+	// changes have been applied.
+	Applied []string `json:"applied"`
+
+	// RestartRequired are the top-level objects of the configuration file,
+	// which changes require a restart to be applied.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// reloadConfig reads the configuration file and applies its changes to the
+// running modules.  The DNS listeners are only restarted if the settings of the
+// proxy, such as the listen addresses, have changed.  The upstream servers and
+// the access lists are replaced in place, as well as the filter lists, the
+// rewrites, the blocked services, and the persistent clients.  The changes of
+// the other objects are reported in resp and require a restart.
+func reloadConfig() (resp *reloadResp, err error) {
+	Context.reloadLock.Lock()
+	defer Context.reloadLock.Unlock()
+
+	confPath := configFilePath()
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	conf := &configuration{}
+	err = conf.decodeConfig(data, filepath.Dir(confPath))
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	err = validateReloaded(conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	config.RLock()
+	changed, err := changedSections(conf, config)
+	config.RUnlock()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	// Use the references and the included files of the new file when writing
+	// it, so that the new secrets and the values of the new included files
+	// aren't written into the main file.
+	config.Lock()
+	config.refs, config.included = conf.refs, conf.included
+	config.Unlock()
+
+	resp = &reloadResp{
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+
+	var errs []error
+	for _, sec := range changed {
+		var applied bool
+		applied, err = reloadSection(conf, sec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sec, err))
+		} else if applied {
+			resp.Applied = append(resp.Applied, sec)
+		} else {
+			resp.RestartRequired = append(resp.RestartRequired, sec)
+		}
+	}
+
+	if len(changed) == 0 {
+		// Most probably, the file has been written by AdGuard Home itself.
+		log.Debug("reload: config not changed")
+	} else {
+		log.Info("reload: applied %q, restart required for %q", resp.Applied, resp.RestartRequired)
+	}
+
+	if len(resp.Applied) > 0 {
+		// Update the configuration from the modules to not apply the same
+		// changes again.
+		onConfigModified()
+	}
+
+	return resp, errors.Join(errs...)
+}
+
+// validateReloaded sets the defaults of conf the same way the configuration
+// is parsed on start and returns an error if the reloadable settings of conf
+// are invalid.
+func validateReloaded(conf *configuration) (err error) {
+	dnsConf := &conf.DNS
+	if dnsConf.UpstreamTimeout.Duration == 0 {
+		dnsConf.UpstreamTimeout = timeutil.Duration{Duration: dnsforward.DefaultTimeout}
+	}
+
+	err = validateDNSListeners(dnsConf.BindHosts, dnsConf.Port, dnsConf.Listeners)
+	if err != nil {
+		return fmt.Errorf("dns.listeners: %w", err)
+	}
+
+	if conf.Filtering == nil {
+		return errors.Error("filtering: no value")
+	}
+
+	if !filtering.ValidateUpdateIvl(conf.Filtering.FiltersUpdateIntervalHours) {
+		conf.Filtering.FiltersUpdateIntervalHours = 24
+	}
+
+	return nil
+}
+
+// changedSections returns the sorted keys of the top-level objects, which YAML
+// encodings differ between next and prev, except for the ignored ones.
+// Comparing the encodings instead of the values ignores the differences the
+// configuration file can't express, for example between nil and empty slices.
+func changedSections(next, prev any, ignored ...string) (keys []string, err error) {
+	nextSecs, err := yamlSections(next)
+	if err != nil {
+		return nil, fmt.Errorf("encoding new config: %w", err)
+	}
+
+	prevSecs, err := yamlSections(prev)
+	if err != nil {
+		return nil, fmt.Errorf("encoding current config: %w", err)
+	}
+
+	for k, v := range nextSecs {
+		if pv, ok := prevSecs[k]; !ok || !bytes.Equal(v, pv) {
+			keys = append(keys, k)
+		}
+	}
+
+	for k := range prevSecs {
+		if _, ok := nextSecs[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	keys = slices.DeleteFunc(keys, func(k string) (ok bool) { return slices.Contains(ignored, k) })
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+// yamlSections returns the YAML encodings of the top-level objects of v by
+// their keys.
+func yamlSections(v any) (secs map[string][]byte, err error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	var raw map[string]any
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	secs = make(map[string][]byte, len(raw))
+	for k, sec := range raw {
+		secs[k], err = yaml.Marshal(sec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+
+	return secs, nil
+}
+
+// reloadSection applies the changes of the top-level object sec of conf.
+// applied is false if the changes require a restart.
+func reloadSection(conf *configuration, sec string) (applied bool, err error) {
+	switch sec {
+	case "dns":
+		return true, reloadDNS(&conf.DNS)
+	case "filters", "whitelist_filters", "user_rules":
+		return true, reloadFilterLists(conf)
+	case "filtering":
+		return reloadFiltering(conf.Filtering)
+	case "clients":
+		return reloadClients(conf)
+	default:
+		return false, nil
+	}
+}
+
+// reloadDNS applies the changes of the DNS settings.  The upstream servers and
+// the access lists are replaced without restarting the listeners, the other
+// changes restart the DNS server.
+func reloadDNS(next *dnsConfig) (err error) {
+	// Compare the settings other than the ones applied in place.
+	config.RLock()
+	changed, err := changedSections(
+		next,
+		&config.DNS,
+		"upstream_dns",
+		"upstream_dns_file",
+		"allowed_clients",
+		"disallowed_clients",
+		"blocked_hosts",
+	)
+	config.RUnlock()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	restart := len(changed) > 0
+
+	// The DNS server is reconfigured from the global configuration, so set it
+	// first and restore the previous one if the changes couldn't be applied.
+	config.Lock()
+	prev := config.DNS
+	config.DNS = *next
+	config.Unlock()
+
+	defer func() {
+		if err != nil {
+			config.Lock()
+			config.DNS = prev
+			config.Unlock()
+		}
+	}()
+
+	if !isRunning() {
+		return nil
+	} else if restart {
+		log.Info("reload: restarting dns server, changed %q", changed)
+
+		// Don't wrap the error since it's informative enough as is.
+		return reconfigureDNSServer()
+	}
+
+	err = Context.dnsServer.ReconfigureUpstreams(next.UpstreamDNS, next.UpstreamDNSFileName)
+	if err != nil {
+		return fmt.Errorf("upstreams: %w", err)
+	}
+
+	err = Context.dnsServer.SetAccessLists(next.AllowedClients, next.DisallowedClients, next.BlockedHosts)
+	if err != nil {
+		// Bring the upstreams back in line with the restored configuration.
+		upsErr := Context.dnsServer.ReconfigureUpstreams(prev.UpstreamDNS, prev.UpstreamDNSFileName)
+		if upsErr != nil {
+			log.Error("reload: restoring upstreams: %s", upsErr)
+		}
+
+		return fmt.Errorf("access: %w", err)
+	}
+
+	return nil
+}
+
+// reloadFilterLists replaces the filter lists and the user rules with the ones
+// from conf.
+func reloadFilterLists(conf *configuration) (err error) {
+	toSync := func(filters []filtering.FilterYAML) (sfs []*filtering.SyncFilter) {
+		sfs = make([]*filtering.SyncFilter, 0, len(filters))
+		for _, f := range filters {
+			sfs = append(sfs, &filtering.SyncFilter{
+				URL:     f.URL,
+				Name:    f.Name,
+				Enabled: f.Enabled,
+			})
+		}
+
+		return sfs
+	}
+
+	// Don't wrap the error since it's informative enough as is.
+	return Context.filters.SetSyncLists(
+		toSync(conf.Filters),
+		toSync(conf.WhitelistFilters),
+		conf.UserRules,
+	)
+}
+
+// reloadFiltering applies the changes of the rewrites and the global blocked
+// services.  applied is false if the other filtering settings have changed.
+func reloadFiltering(next *filtering.Config) (applied bool, err error) {
+	rws := make([]*filtering.SyncRewrite, 0, len(next.Rewrites))
+	for _, rw := range next.Rewrites {
+		rws = append(rws, &filtering.SyncRewrite{
+			Domain: rw.Domain,
+			Answer: rw.Answer,
+		})
+	}
+
+	err = Context.filters.SetSyncRewrites(rws)
+	if err != nil {
+		return false, fmt.Errorf("rewrites: %w", err)
+	}
+
+	bsvc := next.BlockedServices
+	if bsvc == nil {
+		bsvc = &filtering.BlockedServices{}
+	}
+
+	err = Context.filters.SetSyncBlockedServices(bsvc)
+	if err != nil {
+		return false, fmt.Errorf("blocked_services: %w", err)
+	}
+
+	// Compare the settings other than the ones applied above.
+	config.RLock()
+	changed, err := changedSections(next, config.Filtering, "rewrites", "blocked_services")
+	config.RUnlock()
+
+	return len(changed) == 0, err
+}
+
+// reloadClients replaces the persistent clients and the client groups with
+// the ones from conf.  applied is false if the runtime sources of the clients
+// have changed.
+func reloadClients(conf *configuration) (applied bool, err error) {
+	err = Context.clients.reload(conf.Clients.Persistent, conf.Clients.Groups, conf.Filtering)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return false, err
+	}
+
+	config.RLock()
+	changed, err := changedSections(conf.Clients, config.Clients, "persistent", "groups")
+	config.RUnlock()
+
+	return len(changed) == 0, err
+}
+
+// reload replaces the persistent clients and the client groups with the ones
+// from the configuration file, unless any of them is invalid.
+func (clients *clientsContainer) reload(
+	objects []*clientObject,
+	groupObjects []*clientGroupObject,
+	filteringConf *filtering.Config,
+) (err error) {
+	groups := make(map[string]*client.Group, len(groupObjects))
+	for i, o := range groupObjects {
+		var g *client.Group
+		g, err = o.toGroup(filteringConf)
+		if err == nil {
+			err = checkGroup(g)
+		}
+
+		if err != nil {
+			return fmt.Errorf("group at index %d: %w", i, err)
+		} else if _, ok := groups[g.Name]; ok {
+			return fmt.Errorf("group at index %d: group %q already exists", i, g.Name)
+		}
+
+		groups[g.Name] = g
+	}
+
+	cs := make([]*client.Persistent, 0, len(objects))
+	resp := &clientsImportResp{}
+	for i, o := range objects {
+		var c *client.Persistent
+		c, err = o.toPersistent(filteringConf, clients.allTags)
+		if err != nil {
+			return fmt.Errorf("client at index %d: %w", i, err)
+		}
+
+		cs = append(cs, c)
+		resp.Results = append(resp.Results, &clientImportResult{Name: c.Name})
+	}
+
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	prevGroups := clients.groups
+	clients.groups = groups
+	clients.replaceLocked(cs, resp)
+
+	var errs []error
+	for _, r := range resp.Results {
+		if r.Error != "" {
+			errs = append(errs, fmt.Errorf("client %q: %s", r.Name, r.Error))
+		}
+	}
+
+	if len(errs) > 0 {
+		clients.groups = prevGroups
+	}
+
+	return errors.Join(errs...)
+}
+
+// handleReload is the handler for the POST /control/reload HTTP API.
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	resp, err := reloadConfig()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusUnprocessableEntity, "reloading config: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
@@ -0,0 +1,38 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedSections(t *testing.T) {
+	a := &dnsConfig{
+		Port: 53,
+	}
+	a.UpstreamDNS = nil
+
+	b := &dnsConfig{
+		Port: 53,
+	}
+	b.UpstreamDNS = []string{}
+
+	changed, err := changedSections(a, b)
+	require.NoError(t, err)
+
+	assert.Empty(t, changed)
+
+	b.Port = 5353
+	b.UpstreamDNS = []string{"1.1.1.1"}
+
+	changed, err = changedSections(a, b)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"port", "upstream_dns"}, changed)
+
+	changed, err = changedSections(a, b, "upstream_dns")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"port"}, changed)
+}
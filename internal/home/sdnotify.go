@@ -0,0 +1,267 @@
+package home
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+)
+
+// Environment variables set by systemd for the services of the notify type.
+//
+// See https://www.freedesktop.org/software/systemd/man/latest/sd_notify.html.
+const (
+	envNotifySocket = "NOTIFY_SOCKET"
+	envWatchdogUSec = "WATCHDOG_USEC"
+	envWatchdogPID  = "WATCHDOG_PID"
+)
+
+// Service states sent to systemd.
+const (
+	sdStateReady    = "READY=1"
+	sdStateStopping = "STOPPING=1"
+	sdStateWatchdog = "WATCHDOG=1"
+
+	sdStateMainPIDFmt = "MAINPID=%d"
+)
+
+// healthcheckFQDN is the reserved domain name answered by the DNS server
+// itself.  The requests for it sent from the host itself aren't subject to the
+// access settings.  Keep in sync with the one in package dnsforward.
+const healthcheckFQDN = "healthcheck.adguardhome.test."
+
+// sdNotifier sends the readiness and the watchdog notifications to systemd.  A
+// nil *sdNotifier is a valid notifier that does nothing, which is used when
+// AdGuard Home isn't started by systemd.
+type sdNotifier struct {
+	// addr is the address of the notification socket.
+	addr *net.UnixAddr
+
+	// done is closed when the notifier is closed.
+	done chan struct{}
+
+	// check returns an error if the service is unhealthy and the watchdog
+	// must not be notified.
+	check func() (err error)
+
+	// watchdogIvl is the interval between the watchdog notifications.  It's
+	// zero if the watchdog is disabled.
+	watchdogIvl time.Duration
+}
+
+// newSDNotifier returns a new notifier from the environment.  check is called
+// before each watchdog notification.  n is nil if NOTIFY_SOCKET is not set.
+func newSDNotifier(check func() (err error)) (n *sdNotifier, err error) {
+	sock := os.Getenv(envNotifySocket)
+	if sock == "" {
+		return nil, nil
+	}
+
+	// Support the abstract namespace sockets.
+	if sock[0] == '@' {
+		sock = "\x00" + sock[1:]
+	}
+
+	n = &sdNotifier{
+		addr: &net.UnixAddr{
+			Name: sock,
+			Net:  "unixgram",
+		},
+		done:  make(chan struct{}),
+		check: check,
+	}
+
+	n.watchdogIvl, err = watchdogInterval(os.Getenv(envWatchdogUSec), os.Getenv(envWatchdogPID))
+	if err != nil {
+		return nil, fmt.Errorf("watchdog: %w", err)
+	}
+
+	return n, nil
+}
+
+// watchdogInterval returns the interval between the watchdog notifications from
+// the values of the corresponding environment variables.  ivl is zero if the
+// watchdog is disabled or is meant for another process.
+func watchdogInterval(usecStr, pidStr string) (ivl time.Duration, err error) {
+	if usecStr == "" {
+		return 0, nil
+	}
+
+	if pidStr != "" {
+		var pid int
+		pid, err = strconv.Atoi(pidStr)
+		if err != nil {
+			return 0, fmt.Errorf("parsing pid: %w", err)
+		} else if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseUint(usecStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing timeout: %w", err)
+	}
+
+	// Notify twice per timeout, as recommended by sd_watchdog_enabled(3).
+	return time.Duration(usec) * time.Microsecond / 2, nil
+}
+
+// notify sends the state to systemd.
+func (n *sdNotifier) notify(state string) (err error) {
+	conn, err := net.DialUnix(n.addr.Net, nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("dialing: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return fmt.Errorf("writing: %w", err)
+	}
+
+	return nil
+}
+
+// Ready tells systemd that AdGuard Home has started and starts sending the
+// watchdog notifications, if required.
+func (n *sdNotifier) Ready() {
+	if n == nil {
+		return
+	}
+
+	err := n.notify(sdStateReady)
+	if err != nil {
+		log.Error("sdnotify: sending readiness: %s", err)
+
+		return
+	}
+
+	log.Debug("sdnotify: sent readiness")
+
+	if n.watchdogIvl > 0 {
+		go n.loop()
+	}
+}
+
+// loop sends the watchdog notifications until n is closed.
+func (n *sdNotifier) loop() {
+	defer log.OnPanic("sdnotify")
+
+	log.Info("sdnotify: sending watchdog notifications every %s", n.watchdogIvl)
+
+	ticker := time.NewTicker(n.watchdogIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n.ping()
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// ping sends the watchdog notification if the service is healthy.
+func (n *sdNotifier) ping() {
+	err := n.check()
+	if err != nil {
+		log.Error("sdnotify: skipping watchdog notification: %s", err)
+
+		return
+	}
+
+	err = n.notify(sdStateWatchdog)
+	if err != nil {
+		log.Error("sdnotify: sending watchdog notification: %s", err)
+	}
+}
+
+// Close tells systemd that AdGuard Home is stopping and stops the watchdog
+// notifications.
+func (n *sdNotifier) Close() {
+	if n == nil {
+		return
+	}
+
+	close(n.done)
+
+	err := n.notify(sdStateStopping)
+	if err != nil {
+		log.Debug("sdnotify: sending stopping: %s", err)
+	}
+}
+
+// HandOver tells systemd that the process with pid is the main one from now on
+// and stops the watchdog notifications from the current one.
+func (n *sdNotifier) HandOver(pid int) {
+	if n == nil {
+		return
+	}
+
+	close(n.done)
+
+	err := n.notify(fmt.Sprintf(sdStateMainPIDFmt, pid))
+	if err != nil {
+		log.Error("sdnotify: sending main pid: %s", err)
+	}
+}
+
+// checkHealth returns an error if AdGuard Home is configured but the DNS server
+// isn't running or doesn't answer the healthcheck queries.
+func checkHealth() (err error) {
+	if Context.firstRun {
+		return nil
+	} else if !isRunning() {
+		return errors.Error("dns server is not running")
+	}
+
+	config.RLock()
+	addr, ok := healthcheckAddr(config.DNS.BindHosts, config.DNS.Port, config.DNS.ServePlainDNS)
+	config.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	req := &dns.Msg{}
+	req.SetQuestion(healthcheckFQDN, dns.TypeA)
+
+	cli := &dns.Client{
+		Net:     "udp",
+		Timeout: 5 * time.Second,
+	}
+
+	_, _, err = cli.Exchange(req, addr.String())
+	if err != nil {
+		return fmt.Errorf("checking dns server at %s: %w", addr, err)
+	}
+
+	return nil
+}
+
+// healthcheckAddr returns the address to send the healthcheck queries to.  ok
+// is false if there is no plain DNS listener to check.
+func healthcheckAddr(hosts []netip.Addr, port uint16, plain bool) (addr netip.AddrPort, ok bool) {
+	if !plain || port == 0 || len(hosts) == 0 {
+		return netip.AddrPort{}, false
+	}
+
+	host := hosts[0]
+	if host.IsUnspecified() {
+		if host.Is4() {
+			host = netutil.IPv4Localhost()
+		} else {
+			host = netutil.IPv6Localhost()
+		}
+	}
+
+	return netip.AddrPortFrom(host, port), true
+}
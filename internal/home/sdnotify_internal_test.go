@@ -0,0 +1,123 @@
+package home
+
+import (
+	"net/netip"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	testCases := []struct {
+		name       string
+		usec       string
+		pid        string
+		wantErrMsg string
+		want       time.Duration
+	}{{
+		name:       "disabled",
+		usec:       "",
+		pid:        "",
+		wantErrMsg: "",
+		want:       0,
+	}, {
+		name:       "enabled",
+		usec:       "60000000",
+		pid:        "",
+		wantErrMsg: "",
+		want:       30 * time.Second,
+	}, {
+		name:       "this_pid",
+		usec:       "10000000",
+		pid:        pid,
+		wantErrMsg: "",
+		want:       5 * time.Second,
+	}, {
+		name:       "other_pid",
+		usec:       "10000000",
+		pid:        "1",
+		wantErrMsg: "",
+		want:       0,
+	}, {
+		name:       "bad_usec",
+		usec:       "1s",
+		pid:        "",
+		wantErrMsg: `parsing timeout: strconv.ParseUint: parsing "1s": invalid syntax`,
+		want:       0,
+	}, {
+		name:       "bad_pid",
+		usec:       "10000000",
+		pid:        "main",
+		wantErrMsg: `parsing pid: strconv.Atoi: parsing "main": invalid syntax`,
+		want:       0,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ivl, err := watchdogInterval(tc.usec, tc.pid)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, ivl)
+		})
+	}
+}
+
+func TestHealthcheckAddr(t *testing.T) {
+	testCases := []struct {
+		want   netip.AddrPort
+		name   string
+		hosts  []netip.Addr
+		port   uint16
+		plain  bool
+		wantOK bool
+	}{{
+		want:   netip.MustParseAddrPort("127.0.0.1:53"),
+		name:   "unspecified_v4",
+		hosts:  []netip.Addr{netip.IPv4Unspecified()},
+		port:   53,
+		plain:  true,
+		wantOK: true,
+	}, {
+		want:   netip.MustParseAddrPort("[::1]:53"),
+		name:   "unspecified_v6",
+		hosts:  []netip.Addr{netip.IPv6Unspecified()},
+		port:   53,
+		plain:  true,
+		wantOK: true,
+	}, {
+		want:   netip.MustParseAddrPort("192.168.1.1:5353"),
+		name:   "specified",
+		hosts:  []netip.Addr{netip.MustParseAddr("192.168.1.1")},
+		port:   5353,
+		plain:  true,
+		wantOK: true,
+	}, {
+		want:   netip.AddrPort{},
+		name:   "no_plain",
+		hosts:  []netip.Addr{netip.IPv4Unspecified()},
+		port:   53,
+		plain:  false,
+		wantOK: false,
+	}, {
+		want:   netip.AddrPort{},
+		name:   "no_port",
+		hosts:  []netip.Addr{netip.IPv4Unspecified()},
+		port:   0,
+		plain:  true,
+		wantOK: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, ok := healthcheckAddr(tc.hosts, tc.port, tc.plain)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.want, addr)
+		})
+	}
+}
@@ -462,6 +462,10 @@ var launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
 //
 //  2. The ExecStartPre setting is added to make sure that the log directory is
 //     always created to prevent the 209/STDOUT errors.
+//
+//  3. The Type setting is set to notify and the WatchdogSec setting is added to
+//     make systemd wait for the DNS server to start and restart it if it stops
+//     answering.  See sdNotifier.
 const systemdScript = `[Unit]
 Description={{.Description}}
 ConditionFileIsExecutable={{.Path|cmdEscape}}
@@ -469,6 +473,9 @@ ConditionFileIsExecutable={{.Path|cmdEscape}}
 {{$dep}} {{end}}
 
 [Service]
+Type=notify
+NotifyAccess=main
+WatchdogSec=60
 StartLimitInterval=5
 StartLimitBurst=10
 ExecStartPre=/bin/mkdir -p /var/log/
@@ -0,0 +1,309 @@
+package home
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/snmp"
+	"github.com/AdguardTeam/AdGuardHome/internal/version"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// snmpConfig is the configuration of the SNMP agent exposing the resolver
+// statistics.
+type snmpConfig struct {
+	// Address is the UDP address to listen on.
+	Address netip.AddrPort `yaml:"address"`
+
+	// Community is the SNMPv2c community string.  If empty, SNMPv2c is
+	// disabled.  It must not be empty if Users are empty.
+	Community string `yaml:"community"`
+
+	// EngineID is the hexadecimal SNMPv3 engine ID.  If empty, a random one is
+	// generated on each start.
+	EngineID string `yaml:"engine_id"`
+
+	// Users are the SNMPv3 users.
+	Users []*snmpUserConfig `yaml:"users"`
+
+	// EnterpriseOID is the OID the statistics are exposed under.  If empty,
+	// [defaultSNMPEnterpriseOID] is used.
+	EnterpriseOID string `yaml:"enterprise_oid"`
+
+	// CheckInterval is the interval between the checks of the upstream
+	// servers.  If zero, [defaultSNMPCheckIvl] is used.
+	CheckInterval timeutil.Duration `yaml:"check_interval"`
+
+	// Enabled defines if the agent is enabled.
+	Enabled bool `yaml:"enabled"`
+}
+
+// snmpUserConfig is the configuration of an SNMPv3 user.  The security level
+// of the user is defined by the configured protocols.
+type snmpUserConfig struct {
+	// Name is the name of the user.
+	Name string `yaml:"name"`
+
+	// AuthProtocol is the authentication protocol, either "md5", "sha", or
+	// "sha256".  If empty, the authentication is disabled.
+	AuthProtocol snmp.AuthProtocol `yaml:"auth_protocol"`
+
+	// AuthPassword is the authentication password.
+	AuthPassword string `yaml:"auth_password"`
+
+	// PrivProtocol is the privacy protocol, either "des" or "aes".  If empty,
+	// the encryption is disabled.
+	PrivProtocol snmp.PrivProtocol `yaml:"priv_protocol"`
+
+	// PrivPassword is the privacy password.
+	PrivPassword string `yaml:"priv_password"`
+}
+
+// defaultSNMPEnterpriseOID is the default OID the statistics are exposed under.
+// It's the netSnmpPlaypen subtree, which is reserved for the local
+// experiments, since AdGuard Home has no registered enterprise number.
+const defaultSNMPEnterpriseOID = "1.3.6.1.4.1.8072.9999.9999"
+
+// defaultSNMPCheckIvl is the default interval between the checks of the
+// upstream servers.
+const defaultSNMPCheckIvl = 1 * time.Minute
+
+// Values of the upstream status column.
+const (
+	snmpUpstreamUp   = 1
+	snmpUpstreamDown = 2
+)
+
+// Values of the TruthValue textual convention.
+const (
+	snmpTrue  = 1
+	snmpFalse = 2
+)
+
+// sysOID is the OID of the system group of MIB-II, see RFC 3418.
+var sysOID = snmp.OID{1, 3, 6, 1, 2, 1, 1}
+
+// snmpAgent exposes the resolver statistics over SNMP.  The objects under the
+// enterprise OID are:
+//
+//	.1.1.0       queries processed, Counter64
+//	.1.2.0       queries blocked, Counter64
+//	.1.3.0       queries within the last second, Gauge32
+//	.2.1.0       cache hits, Counter64
+//	.2.2.0       cache misses, Counter64
+//	.3.1.0       number of the upstream servers, INTEGER
+//	.3.2.1.2.N   upstream server address, OCTET STRING
+//	.3.2.1.3.N   upstream server status, INTEGER up(1), down(2)
+//	.3.2.1.4.N   upstream server responses, Counter64
+//	.4.1.0       protection enabled, TruthValue
+//	.4.2.0       version, OCTET STRING
+//
+// The MIB-II system group is exposed as well.  A nil *snmpAgent is a valid
+// agent, which does nothing.
+type snmpAgent struct {
+	agent *snmp.Agent
+
+	// stats returns the statistics of the DNS server.  ok is false if the
+	// server isn't running.
+	stats func() (st *dnsforward.Stats, protection, ok bool)
+
+	// checkUpstreams returns the health of each of the upstream servers.
+	checkUpstreams func() (health []*dnsforward.UpstreamHealth)
+
+	// mu protects health.
+	mu *sync.Mutex
+
+	// health is the result of the last check of the upstream servers.
+	health []*dnsforward.UpstreamHealth
+
+	// done is closed when the agent is closed.
+	done chan struct{}
+
+	// base is the enterprise OID.
+	base snmp.OID
+
+	// hostname is the value of sysName.
+	hostname string
+
+	checkIvl time.Duration
+}
+
+// newSNMPAgent returns a new SNMP agent from conf.  a is nil if conf is nil or
+// disabled.
+func newSNMPAgent(conf *snmpConfig) (a *snmpAgent, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+
+	base, err := snmp.ParseOID(stringOr(conf.EnterpriseOID, defaultSNMPEnterpriseOID))
+	if err != nil {
+		return nil, fmt.Errorf("enterprise_oid: %w", err)
+	}
+
+	engineID, err := hex.DecodeString(conf.EngineID)
+	if err != nil {
+		return nil, fmt.Errorf("engine_id: %w", err)
+	}
+
+	users := make([]*snmp.User, 0, len(conf.Users))
+	for _, u := range conf.Users {
+		users = append(users, &snmp.User{
+			Name:         u.Name,
+			AuthPassword: u.AuthPassword,
+			PrivPassword: u.PrivPassword,
+			AuthProtocol: u.AuthProtocol,
+			PrivProtocol: u.PrivProtocol,
+		})
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Debug("snmp: getting hostname: %s", err)
+	}
+
+	a = &snmpAgent{
+		stats:          currentSNMPStats,
+		checkUpstreams: func() (h []*dnsforward.UpstreamHealth) { return Context.dnsServer.CheckEachUpstream() },
+		mu:             &sync.Mutex{},
+		done:           make(chan struct{}),
+		base:           base,
+		hostname:       hostname,
+		checkIvl:       durationOr(conf.CheckInterval, defaultSNMPCheckIvl),
+	}
+
+	a.agent, err = snmp.NewAgent(&snmp.Config{
+		MIB:       a.mib,
+		Users:     users,
+		EngineID:  engineID,
+		Community: conf.Community,
+		Addr:      conf.Address,
+	})
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// currentSNMPStats returns the current statistics of the DNS server.
+func currentSNMPStats() (st *dnsforward.Stats, protection, ok bool) {
+	if !isRunning() {
+		return nil, false, false
+	}
+
+	protection, _ = Context.dnsServer.UpdatedProtectionStatus()
+
+	return Context.dnsServer.Stats(), protection, true
+}
+
+// Start starts serving the requests and checking the upstream servers.
+func (a *snmpAgent) Start() (err error) {
+	if a == nil {
+		return nil
+	}
+
+	err = a.agent.Start()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	go a.checkLoop()
+
+	return nil
+}
+
+// Close stops the agent.  It must only be called once after a successful call
+// to Start.
+func (a *snmpAgent) Close() {
+	if a == nil {
+		return
+	}
+
+	close(a.done)
+	a.agent.Close()
+}
+
+// checkLoop checks the upstream servers each interval until a is closed.
+func (a *snmpAgent) checkLoop() {
+	defer log.OnPanic("snmp: checking upstreams")
+
+	t := time.NewTicker(a.checkIvl)
+	defer t.Stop()
+
+	for {
+		if _, _, ok := a.stats(); ok {
+			health := a.checkUpstreams()
+
+			a.mu.Lock()
+			a.health = health
+			a.mu.Unlock()
+		}
+
+		select {
+		case <-a.done:
+			return
+		case <-t.C:
+			// Go on.
+		}
+	}
+}
+
+// mib returns the objects exposed by the agent.
+func (a *snmpAgent) mib() (vars []*snmp.Variable) {
+	vars = []*snmp.Variable{
+		snmp.OctetString(sysOID.Append(1, 0), "AdGuard Home "+version.Version()),
+		snmp.ObjectID(sysOID.Append(2, 0), a.base),
+		snmp.TimeTicks(sysOID.Append(3, 0), uint32(time.Since(processStart)/(10*time.Millisecond))),
+		snmp.OctetString(sysOID.Append(5, 0), a.hostname),
+		snmp.OctetString(a.base.Append(4, 2, 0), version.Version()),
+	}
+
+	st, protection, ok := a.stats()
+	if !ok {
+		return vars
+	}
+
+	protectionVal := int64(snmpFalse)
+	if protection {
+		protectionVal = snmpTrue
+	}
+
+	vars = append(
+		vars,
+		snmp.Counter64(a.base.Append(1, 1, 0), st.Total),
+		snmp.Counter64(a.base.Append(1, 2, 0), st.Blocked),
+		snmp.Gauge32(a.base.Append(1, 3, 0), uint32(min(st.QPS, 1<<32-1))),
+		snmp.Counter64(a.base.Append(2, 1, 0), st.CacheHits),
+		snmp.Counter64(a.base.Append(2, 2, 0), st.CacheMisses),
+		snmp.Integer(a.base.Append(4, 1, 0), protectionVal),
+	)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	vars = append(vars, snmp.Integer(a.base.Append(3, 1, 0), int64(len(a.health))))
+	for i, h := range a.health {
+		idx := uint32(i + 1)
+		status := int64(snmpUpstreamUp)
+		if h.Err != nil {
+			status = snmpUpstreamDown
+		}
+
+		vars = append(
+			vars,
+			snmp.OctetString(a.base.Append(3, 2, 1, 2, idx), h.Address),
+			snmp.Integer(a.base.Append(3, 2, 1, 3, idx), status),
+			snmp.Counter64(a.base.Append(3, 2, 1, 4, idx), st.Upstreams[h.Address]),
+		)
+	}
+
+	return vars
+}
@@ -0,0 +1,74 @@
+package home
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/dnsforward"
+	"github.com/AdguardTeam/AdGuardHome/internal/snmp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSNMPAgent_MIB(t *testing.T) {
+	var running bool
+	a := &snmpAgent{
+		stats: func() (st *dnsforward.Stats, protection, ok bool) {
+			return &dnsforward.Stats{
+				Upstreams: map[string]uint64{"8.8.8.8:53": 7},
+				Total:     10,
+				Blocked:   3,
+				QPS:       2,
+			}, true, running
+		},
+		mu: &sync.Mutex{},
+		health: []*dnsforward.UpstreamHealth{{
+			Address: "8.8.8.8:53",
+		}, {
+			Err:     errors.Error("timeout"),
+			Address: "1.1.1.1:53",
+		}},
+		base:     snmp.OID{1, 3, 6, 1, 4, 1, 99},
+		hostname: "router",
+	}
+
+	// values returns the values of the variables from the enterprise subtree.
+	values := func() (vals map[string]any) {
+		vals = map[string]any{}
+		for _, v := range a.mib() {
+			oid := v.OID.String()
+			switch v.Type {
+			case snmp.TypeInteger:
+				vals[oid] = v.Int
+			case snmp.TypeOctetString:
+				vals[oid] = v.Str
+			case snmp.TypeObjectID:
+				vals[oid] = v.ObjectID.String()
+			case snmp.TypeTimeTicks:
+				// The uptime depends on the time of the test.
+			default:
+				vals[oid] = v.Uint
+			}
+		}
+
+		return vals
+	}
+
+	vals := values()
+	assert.Equal(t, "1.3.6.1.4.1.99", vals["1.3.6.1.2.1.1.2.0"])
+	assert.Equal(t, "router", vals["1.3.6.1.2.1.1.5.0"])
+	assert.NotContains(t, vals, "1.3.6.1.4.1.99.1.1.0")
+
+	running = true
+	vals = values()
+	assert.Equal(t, uint64(10), vals["1.3.6.1.4.1.99.1.1.0"])
+	assert.Equal(t, uint64(3), vals["1.3.6.1.4.1.99.1.2.0"])
+	assert.Equal(t, uint64(2), vals["1.3.6.1.4.1.99.1.3.0"])
+	assert.Equal(t, int64(2), vals["1.3.6.1.4.1.99.3.1.0"])
+	assert.Equal(t, "8.8.8.8:53", vals["1.3.6.1.4.1.99.3.2.1.2.1"])
+	assert.Equal(t, int64(snmpUpstreamUp), vals["1.3.6.1.4.1.99.3.2.1.3.1"])
+	assert.Equal(t, uint64(7), vals["1.3.6.1.4.1.99.3.2.1.4.1"])
+	assert.Equal(t, int64(snmpUpstreamDown), vals["1.3.6.1.4.1.99.3.2.1.3.2"])
+	assert.Equal(t, uint64(0), vals["1.3.6.1.4.1.99.3.2.1.4.2"])
+	assert.Equal(t, int64(snmpTrue), vals["1.3.6.1.4.1.99.4.1.0"])
+}
@@ -0,0 +1,756 @@
+package home
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/client"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// syncSection is a part of the configuration synchronized between the
+// instances.
+type syncSection string
+
+// Supported sync sections.
+const (
+	// syncSectionFilters is the blocking and the allowing filter lists and the
+	// user rules.
+	syncSectionFilters syncSection = "filters"
+
+	// syncSectionClients is the persistent clients.
+	syncSectionClients syncSection = "clients"
+
+	// syncSectionRewrites is the legacy DNS rewrites.
+	syncSectionRewrites syncSection = "rewrites"
+
+	// syncSectionBlockedServices is the global blocked services.
+	syncSectionBlockedServices syncSection = "blocked_services"
+)
+
+// allSyncSections are all the supported sync sections in the order they're
+// applied in.
+var allSyncSections = []syncSection{
+	syncSectionFilters,
+	syncSectionClients,
+	syncSectionRewrites,
+	syncSectionBlockedServices,
+}
+
+// validate returns an error if s is not a supported section.
+func (s syncSection) validate() (err error) {
+	if !slices.Contains(allSyncSections, s) {
+		return fmt.Errorf("unsupported section %q", s)
+	}
+
+	return nil
+}
+
+// syncMode defines how the instance takes part in the synchronization.
+type syncMode string
+
+// Supported sync modes.  An empty mode disables the periodic synchronization,
+// but the instance still accepts the configuration pushed to it.
+const (
+	// syncModePull is the mode of a secondary instance, which periodically
+	// pulls the configuration from the primary one.
+	syncModePull syncMode = "pull"
+
+	// syncModePush is the mode of a primary instance, which periodically
+	// pushes its configuration to the secondary ones.
+	syncModePush syncMode = "push"
+)
+
+// syncPeerConfig is the configuration of another instance taking part in the
+// synchronization.
+type syncPeerConfig struct {
+	// URL is the base URL of the web interface of the instance.
+	URL string `yaml:"url"`
+
+	// Token is the API token for the instance, see [apiToken].  The "read"
+	// scope is enough for pulling and the "write" one is required for pushing.
+	Token string `yaml:"token"`
+}
+
+// syncConfig is the configuration of the synchronization between the
+// instances.
+type syncConfig struct {
+	// Primary is the instance to pull the configuration from in the
+	// [syncModePull] mode.
+	Primary *syncPeerConfig `yaml:"primary"`
+
+	// Mode defines how the instance takes part in the synchronization.
+	Mode syncMode `yaml:"mode"`
+
+	// Replicas are the instances to push the configuration to in the
+	// [syncModePush] mode.
+	Replicas []*syncPeerConfig `yaml:"replicas"`
+
+	// Sections are the synchronized sections.  If it's empty, all the sections
+	// are synchronized.  On the receiving side the other sections are ignored.
+	Sections []syncSection `yaml:"sections"`
+
+	// Interval is the interval between the synchronizations.
+	Interval timeutil.Duration `yaml:"interval"`
+}
+
+// validate returns an error if c is invalid.  c may be nil.
+func (c *syncConfig) validate() (err error) {
+	if c == nil {
+		return nil
+	}
+
+	for i, s := range c.Sections {
+		err = s.validate()
+		if err != nil {
+			return fmt.Errorf("sections: at index %d: %w", i, err)
+		}
+	}
+
+	var peers []*syncPeerConfig
+	switch c.Mode {
+	case "":
+		return nil
+	case syncModePull:
+		if c.Primary == nil {
+			return errors.Error("primary: no value")
+		}
+
+		peers = []*syncPeerConfig{c.Primary}
+	case syncModePush:
+		if len(c.Replicas) == 0 {
+			return errors.Error("replicas: empty value")
+		}
+
+		peers = c.Replicas
+	default:
+		return fmt.Errorf("mode: unsupported value %q", c.Mode)
+	}
+
+	if c.Interval.Duration <= 0 {
+		return fmt.Errorf("interval: must be positive, got %s", c.Interval)
+	}
+
+	for i, p := range peers {
+		if p == nil {
+			return fmt.Errorf("peer at index %d: no value", i)
+		}
+
+		_, err = url.ParseRequestURI(p.URL)
+		if err != nil {
+			return fmt.Errorf("peer at index %d: url: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// syncFiltersJSON is the [syncSectionFilters] section of a sync snapshot.
+type syncFiltersJSON struct {
+	Filters          []*filtering.SyncFilter `json:"filters"`
+	WhitelistFilters []*filtering.SyncFilter `json:"whitelist_filters"`
+	UserRules        []string                `json:"user_rules"`
+}
+
+// syncSnapshot is the synchronized configuration.  Only the fields of the
+// sections listed in Sections are set.
+type syncSnapshot struct {
+	Filters         *syncFiltersJSON           `json:"filters,omitempty"`
+	BlockedServices *filtering.BlockedServices `json:"blocked_services,omitempty"`
+	Sections        []syncSection              `json:"sections"`
+	Clients         []*clientJSON              `json:"clients,omitempty"`
+	Rewrites        []*filtering.SyncRewrite   `json:"rewrites,omitempty"`
+}
+
+// syncConflict is a local change, which has been overwritten by the
+// synchronization.
+type syncConflict struct {
+	Section syncSection `json:"section"`
+
+	// Key identifies the changed item within the section.
+	Key string `json:"key"`
+}
+
+// syncSectionError is an error of applying a section.
+type syncSectionError struct {
+	Section syncSection `json:"section"`
+	Error   string      `json:"error"`
+}
+
+// syncResult is the result of applying a sync snapshot.
+type syncResult struct {
+	Applied   []syncSection       `json:"applied"`
+	Conflicts []*syncConflict     `json:"conflicts"`
+	Errors    []*syncSectionError `json:"errors"`
+}
+
+// syncPeerStatus is the status of the synchronization with another instance.
+type syncPeerStatus struct {
+	// LastSync is the time of the last attempt to synchronize, if any.
+	LastSync *time.Time `json:"last_sync,omitempty"`
+
+	// Result is the result of the last successful synchronization, if any.
+	Result *syncResult `json:"result,omitempty"`
+
+	URL string `json:"url"`
+
+	// Error is the error of the last attempt, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// syncer synchronizes the configuration between the instances.
+type syncer struct {
+	conf *syncConfig
+
+	httpCli *http.Client
+
+	// done is closed when the syncer is closed.
+	done chan struct{}
+
+	// mu protects the fields below.
+	mu *sync.Mutex
+
+	// prev are the items of the sections as of the last synchronization.
+	// They're used to tell the local changes, which are reported as the
+	// conflicts, from the ones made by the synchronization itself.
+	prev map[syncSection]map[string]string
+
+	// peers are the statuses of the synchronization with the primary or the
+	// replicas, depending on the mode.
+	peers []*syncPeerStatus
+
+	// lastImport is the status of the last configuration pushed to this
+	// instance, if any.
+	lastImport *syncPeerStatus
+}
+
+// newSyncer returns a new properly initialized *syncer.  conf may be nil, in
+// which case the instance only accepts the pushed configuration.
+func newSyncer(conf *syncConfig, httpCli *http.Client) (s *syncer, err error) {
+	err = conf.validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	if conf == nil {
+		conf = &syncConfig{}
+	}
+
+	s = &syncer{
+		conf:    conf,
+		httpCli: httpCli,
+		done:    make(chan struct{}),
+		mu:      &sync.Mutex{},
+		prev:    map[syncSection]map[string]string{},
+	}
+
+	var peers []*syncPeerConfig
+	switch conf.Mode {
+	case syncModePull:
+		peers = []*syncPeerConfig{conf.Primary}
+	case syncModePush:
+		peers = conf.Replicas
+	}
+
+	for _, p := range peers {
+		s.peers = append(s.peers, &syncPeerStatus{URL: p.URL})
+	}
+
+	return s, nil
+}
+
+// sections returns the sections synchronized by s.
+func (s *syncer) sections() (sections []syncSection) {
+	if len(s.conf.Sections) == 0 {
+		return allSyncSections
+	}
+
+	return s.conf.Sections
+}
+
+// Start starts the periodic synchronization in a separate goroutine, if it's
+// enabled.
+func (s *syncer) Start() {
+	if s.conf.Mode != "" {
+		go s.loop()
+	}
+}
+
+// Close stops the periodic synchronization.  It must only be called once.
+func (s *syncer) Close() {
+	close(s.done)
+}
+
+// loop synchronizes the configuration right away and then each interval until
+// s is closed.
+func (s *syncer) loop() {
+	defer log.OnPanic("sync: loop")
+
+	t := time.NewTicker(s.conf.Interval.Duration)
+	defer t.Stop()
+
+	for {
+		s.syncAll()
+
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			// Go on.
+		}
+	}
+}
+
+// syncAll pulls the configuration from the primary or pushes it to all the
+// replicas, depending on the mode.
+func (s *syncer) syncAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.conf.Interval.Duration)
+	defer cancel()
+
+	var peers []*syncPeerConfig
+	if s.conf.Mode == syncModePull {
+		peers = []*syncPeerConfig{s.conf.Primary}
+	} else {
+		peers = s.conf.Replicas
+	}
+
+	for i, p := range peers {
+		var res *syncResult
+		var err error
+		if s.conf.Mode == syncModePull {
+			res, err = s.pull(ctx, p)
+		} else {
+			res, err = s.push(ctx, p)
+		}
+
+		if err != nil {
+			log.Error("sync: %s %s: %s", s.conf.Mode, p.URL, err)
+		} else if len(res.Conflicts) > 0 {
+			log.Info("sync: %s %s: %d conflicts", s.conf.Mode, p.URL, len(res.Conflicts))
+		}
+
+		s.setPeerStatus(s.peers[i], res, err)
+	}
+}
+
+// setPeerStatus sets the status of the last synchronization with a peer.
+func (s *syncer) setPeerStatus(st *syncPeerStatus, res *syncResult, err error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st.LastSync = &now
+	if err != nil {
+		st.Error = err.Error()
+
+		return
+	}
+
+	st.Error, st.Result = "", res
+}
+
+// do sends an HTTP request with method to the HTTP API of p at path and
+// decodes the response into v.
+func (s *syncer) do(
+	ctx context.Context,
+	p *syncPeerConfig,
+	method string,
+	path string,
+	body io.Reader,
+	v any,
+) (err error) {
+	u := strings.TrimSuffix(p.URL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	if p.Token != "" {
+		req.Header.Set(httphdr.Authorization, "Bearer "+p.Token)
+	}
+
+	if body != nil {
+		req.Header.Set(httphdr.ContentType, aghhttp.HdrValApplicationJSON)
+	}
+
+	resp, err := s.httpCli.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// pull gets the configuration from the primary instance p and applies it.
+func (s *syncer) pull(ctx context.Context, p *syncPeerConfig) (res *syncResult, err error) {
+	names := make([]string, 0, len(s.sections()))
+	for _, sec := range s.sections() {
+		names = append(names, string(sec))
+	}
+
+	path := "/control/sync/export?" + url.Values{"sections": {strings.Join(names, ",")}}.Encode()
+
+	snap := &syncSnapshot{}
+	err = s.do(ctx, p, http.MethodGet, path, nil, snap)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return s.apply(snap), nil
+}
+
+// push sends the configuration to the replica p.
+func (s *syncer) push(ctx context.Context, p *syncPeerConfig) (res *syncResult, err error) {
+	b, err := json.Marshal(s.snapshot(s.sections()))
+	if err != nil {
+		return nil, fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	res = &syncResult{}
+	err = s.do(ctx, p, http.MethodPost, "/control/sync/import", bytes.NewReader(b), res)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// snapshot returns the current configuration of sections.
+func (s *syncer) snapshot(sections []syncSection) (snap *syncSnapshot) {
+	snap = &syncSnapshot{
+		Sections: sections,
+	}
+
+	for _, sec := range sections {
+		switch sec {
+		case syncSectionFilters:
+			block, allow, rules := Context.filters.SyncLists()
+			snap.Filters = &syncFiltersJSON{
+				Filters:          block,
+				WhitelistFilters: allow,
+				UserRules:        rules,
+			}
+		case syncSectionClients:
+			snap.Clients = Context.clients.syncClients()
+		case syncSectionRewrites:
+			snap.Rewrites = Context.filters.SyncRewrites()
+		case syncSectionBlockedServices:
+			snap.BlockedServices = Context.filters.SyncBlockedServices()
+		}
+	}
+
+	return snap
+}
+
+// apply applies the sections of snap synchronized by s and reports the local
+// changes overwritten by it.
+func (s *syncer) apply(snap *syncSnapshot) (res *syncResult) {
+	res = &syncResult{
+		Applied:   []syncSection{},
+		Conflicts: []*syncConflict{},
+		Errors:    []*syncSectionError{},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sec := range s.sections() {
+		if !slices.Contains(snap.Sections, sec) {
+			continue
+		}
+
+		local := syncItems(s.snapshot([]syncSection{sec}), sec)
+		next := syncItems(snap, sec)
+
+		err := applySyncSection(snap, sec)
+		if err != nil {
+			log.Error("sync: applying %s: %s", sec, err)
+			res.Errors = append(res.Errors, &syncSectionError{
+				Section: sec,
+				Error:   err.Error(),
+			})
+
+			continue
+		}
+
+		for _, k := range findSyncConflicts(local, s.prev[sec], next) {
+			res.Conflicts = append(res.Conflicts, &syncConflict{
+				Section: sec,
+				Key:     k,
+			})
+		}
+
+		s.prev[sec] = next
+		res.Applied = append(res.Applied, sec)
+	}
+
+	if len(res.Applied) > 0 {
+		onConfigModified()
+	}
+
+	return res
+}
+
+// applySyncSection replaces the local configuration of sec with the one from
+// snap.
+func applySyncSection(snap *syncSnapshot, sec syncSection) (err error) {
+	switch sec {
+	case syncSectionFilters:
+		if snap.Filters == nil {
+			return errors.Error("no value")
+		}
+
+		f := snap.Filters
+
+		return Context.filters.SetSyncLists(f.Filters, f.WhitelistFilters, f.UserRules)
+	case syncSectionClients:
+		return Context.clients.setSyncClients(snap.Clients)
+	case syncSectionRewrites:
+		return Context.filters.SetSyncRewrites(snap.Rewrites)
+	case syncSectionBlockedServices:
+		return Context.filters.SetSyncBlockedServices(snap.BlockedServices)
+	default:
+		return fmt.Errorf("unsupported section %q", sec)
+	}
+}
+
+// syncItems returns the items of the section sec of snap by their keys.  The
+// values are only compared, so they're the JSON encodings of the items.
+func syncItems(snap *syncSnapshot, sec syncSection) (items map[string]string) {
+	items = map[string]string{}
+	add := func(key string, v any) {
+		// Don't check the error, since all the values are encodable.
+		b, _ := json.Marshal(v)
+		items[key] = string(b)
+	}
+
+	switch sec {
+	case syncSectionFilters:
+		if snap.Filters == nil {
+			break
+		}
+
+		for _, f := range snap.Filters.Filters {
+			add("filter "+f.URL, f)
+		}
+
+		for _, f := range snap.Filters.WhitelistFilters {
+			add("allowlist "+f.URL, f)
+		}
+
+		for _, r := range snap.Filters.UserRules {
+			add("rule "+r, nil)
+		}
+	case syncSectionClients:
+		for _, c := range snap.Clients {
+			add(c.Name, c)
+		}
+	case syncSectionRewrites:
+		for _, rw := range snap.Rewrites {
+			add(rw.Domain+" "+rw.Answer, nil)
+		}
+	case syncSectionBlockedServices:
+		if snap.BlockedServices != nil {
+			add(string(sec), snap.BlockedServices)
+		}
+	}
+
+	return items
+}
+
+// findSyncConflicts returns the sorted keys of the local items, which are
+// changed or removed by next, unless they haven't changed since prev.  If prev
+// is nil, which is the case for the first synchronization, all such items are
+// considered conflicting.
+func findSyncConflicts(local, prev, next map[string]string) (keys []string) {
+	for k, v := range local {
+		if nv, ok := next[k]; ok && nv == v {
+			continue
+		} else if pv, ok := prev[k]; ok && pv == v {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// syncClients returns the persistent clients for the synchronization.
+func (clients *clientsContainer) syncClients() (cjs []*clientJSON) {
+	clients.lock.Lock()
+	defer clients.lock.Unlock()
+
+	cjs = []*clientJSON{}
+	clients.clientIndex.RangeByName(func(c *client.Persistent) (cont bool) {
+		cjs = append(cjs, clientToJSON(c))
+
+		return true
+	})
+
+	return cjs
+}
+
+// setSyncClients replaces the persistent clients with cjs, unless any of them
+// is invalid.
+func (clients *clientsContainer) setSyncClients(cjs []*clientJSON) (err error) {
+	cs := make([]*client.Persistent, 0, len(cjs))
+	resp := &clientsImportResp{}
+	for i, cj := range cjs {
+		if cj == nil {
+			return fmt.Errorf("client at index %d: %w", i, errNilClient)
+		}
+
+		var c *client.Persistent
+		c, err = clients.jsonToClient(*cj, nil)
+		if err == nil {
+			err = clients.check(c)
+		}
+
+		if err != nil {
+			return fmt.Errorf("client %q: %w", cj.Name, err)
+		}
+
+		cs = append(cs, c)
+		resp.Results = append(resp.Results, &clientImportResult{Name: cj.Name})
+	}
+
+	clients.importClients(cs, clientsImportModeReplace, resp)
+
+	var errs []error
+	for _, r := range resp.Results {
+		if r.Error != "" {
+			errs = append(errs, fmt.Errorf("client %q: %s", r.Name, r.Error))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// syncStatusJSON is the response to the GET /control/sync/status HTTP API.
+type syncStatusJSON struct {
+	// LastImport is the status of the last configuration pushed to this
+	// instance, if any.
+	LastImport *syncPeerStatus `json:"last_import,omitempty"`
+
+	Mode     syncMode          `json:"mode"`
+	Sections []syncSection     `json:"sections"`
+	Peers    []*syncPeerStatus `json:"peers"`
+}
+
+// handleSyncStatus is the handler for the GET /control/sync/status HTTP API.
+func (s *syncer) handleSyncStatus(w http.ResponseWriter, r *http.Request) {
+	resp := &syncStatusJSON{
+		Mode:     s.conf.Mode,
+		Sections: s.sections(),
+		Peers:    []*syncPeerStatus{},
+	}
+
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for _, p := range s.peers {
+			cp := *p
+			resp.Peers = append(resp.Peers, &cp)
+		}
+
+		if s.lastImport != nil {
+			cp := *s.lastImport
+			resp.LastImport = &cp
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleSyncExport is the handler for the GET /control/sync/export HTTP API.
+// The sections query parameter is a comma-separated list of the sections, all
+// the sections are exported if it's empty.
+func (s *syncer) handleSyncExport(w http.ResponseWriter, r *http.Request) {
+	sections := allSyncSections
+	if q := r.URL.Query().Get("sections"); q != "" {
+		sections = nil
+		for _, name := range strings.Split(q, ",") {
+			sec := syncSection(strings.TrimSpace(name))
+			err := sec.validate()
+			if err != nil {
+				aghhttp.Error(r, w, http.StatusBadRequest, "sections: %s", err)
+
+				return
+			}
+
+			sections = append(sections, sec)
+		}
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, s.snapshot(sections))
+}
+
+// handleSyncImport is the handler for the POST /control/sync/import HTTP API.
+// The sections not synchronized by this instance are ignored.
+func (s *syncer) handleSyncImport(w http.ResponseWriter, r *http.Request) {
+	snap := &syncSnapshot{}
+	err := json.NewDecoder(r.Body).Decode(snap)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	res := s.apply(snap)
+	if len(res.Conflicts) > 0 {
+		log.Info("sync: import from %s: %d conflicts", r.RemoteAddr, len(res.Conflicts))
+	}
+
+	now := time.Now()
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.lastImport = &syncPeerStatus{
+			LastSync: &now,
+			Result:   res,
+			URL:      r.RemoteAddr,
+		}
+	}()
+
+	aghhttp.WriteJSONResponseOK(w, r, res)
+}
+
+// registerSyncHandlers registers the HTTP handlers of the synchronization.
+func (s *syncer) registerSyncHandlers() {
+	httpRegister(http.MethodGet, "/control/sync/status", s.handleSyncStatus)
+	httpRegister(http.MethodGet, "/control/sync/export", s.handleSyncExport)
+	httpRegister(http.MethodPost, "/control/sync/import", s.handleSyncImport)
+}
@@ -0,0 +1,150 @@
+package home
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncConfig_Validate(t *testing.T) {
+	peer := &syncPeerConfig{
+		URL: "http://192.168.0.1:3000",
+	}
+
+	testCases := []struct {
+		conf       *syncConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       nil,
+		name:       "nil",
+		wantErrMsg: "",
+	}, {
+		conf:       &syncConfig{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &syncConfig{
+			Primary:  peer,
+			Mode:     syncModePull,
+			Sections: []syncSection{syncSectionFilters},
+			Interval: timeutil.Duration{Duration: time.Minute},
+		},
+		name:       "pull",
+		wantErrMsg: "",
+	}, {
+		conf: &syncConfig{
+			Mode:     syncModePull,
+			Interval: timeutil.Duration{Duration: time.Minute},
+		},
+		name:       "no_primary",
+		wantErrMsg: "primary: no value",
+	}, {
+		conf: &syncConfig{
+			Mode:     syncModePush,
+			Interval: timeutil.Duration{Duration: time.Minute},
+		},
+		name:       "no_replicas",
+		wantErrMsg: "replicas: empty value",
+	}, {
+		conf: &syncConfig{
+			Replicas: []*syncPeerConfig{peer},
+			Mode:     syncModePush,
+		},
+		name:       "no_interval",
+		wantErrMsg: "interval: must be positive, got 0s",
+	}, {
+		conf: &syncConfig{
+			Sections: []syncSection{"gfw"},
+		},
+		name:       "bad_section",
+		wantErrMsg: `sections: at index 0: unsupported section "gfw"`,
+	}, {
+		conf: &syncConfig{
+			Replicas: []*syncPeerConfig{{URL: "bad"}},
+			Mode:     syncModePush,
+			Interval: timeutil.Duration{Duration: time.Minute},
+		},
+		name:       "bad_url",
+		wantErrMsg: `peer at index 0: url: parse "bad": invalid URI for request`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.validate())
+		})
+	}
+}
+
+func TestFindSyncConflicts(t *testing.T) {
+	testCases := []struct {
+		local map[string]string
+		prev  map[string]string
+		next  map[string]string
+		name  string
+		want  []string
+	}{{
+		local: map[string]string{"a": "1"},
+		prev:  nil,
+		next:  map[string]string{"a": "1"},
+		name:  "same",
+		want:  nil,
+	}, {
+		local: map[string]string{"a": "1", "b": "2"},
+		prev:  nil,
+		next:  map[string]string{"a": "2"},
+		name:  "first_sync",
+		want:  []string{"a", "b"},
+	}, {
+		local: map[string]string{"a": "1", "b": "2"},
+		prev:  map[string]string{"a": "1", "b": "2"},
+		next:  map[string]string{"a": "2"},
+		name:  "changed_by_primary",
+		want:  nil,
+	}, {
+		local: map[string]string{"a": "3", "c": "1"},
+		prev:  map[string]string{"a": "1"},
+		next:  map[string]string{"a": "2"},
+		name:  "changed_locally",
+		want:  []string{"a", "c"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, findSyncConflicts(tc.local, tc.prev, tc.next))
+		})
+	}
+}
+
+func TestSyncItems(t *testing.T) {
+	snap := &syncSnapshot{
+		Filters: &syncFiltersJSON{
+			Filters: []*filtering.SyncFilter{{
+				URL:     "https://example.com/list.txt",
+				Name:    "List",
+				Enabled: true,
+			}},
+			UserRules: []string{"||example.org^"},
+		},
+		Sections: []syncSection{syncSectionFilters, syncSectionRewrites},
+		Rewrites: []*filtering.SyncRewrite{{
+			Domain: "host.example",
+			Answer: "1.2.3.4",
+		}},
+	}
+
+	assert.Equal(t, map[string]string{
+		"filter https://example.com/list.txt": `{"url":"https://example.com/list.txt","name":"List","enabled":true}`,
+		"rule ||example.org^":                 "null",
+	}, syncItems(snap, syncSectionFilters))
+
+	assert.Equal(t, map[string]string{
+		"host.example 1.2.3.4": "null",
+	}, syncItems(snap, syncSectionRewrites))
+
+	assert.Empty(t, syncItems(snap, syncSectionBlockedServices))
+}
@@ -14,6 +14,8 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -53,6 +55,15 @@ func newTLSManager(conf tlsConfigSettings, servePlainDNS bool) (m *tlsManager, e
 		servePlainDNS: servePlainDNS,
 	}
 
+	if setACMEPaths(&m.conf) {
+		_, err = os.Stat(m.conf.CertificatePath)
+		if errors.Is(err, os.ErrNotExist) {
+			// The certificate hasn't been obtained yet, so don't disable the
+			// encryption until it is.
+			return m, nil
+		}
+	}
+
 	if m.conf.Enabled {
 		err = m.load()
 		if err != nil {
@@ -163,6 +174,41 @@ func (m *tlsManager) reload() {
 	Context.web.tlsConfigChanged(context.Background(), tlsConf)
 }
 
+// setACMECert makes m use the certificate and the private key obtained with
+// ACME and applies them to the encrypted DNS servers and the HTTPS server.
+func (m *tlsManager) setACMECert(certPath, keyPath string) {
+	status := &tlsConfigStatus{}
+
+	m.confLock.Lock()
+	m.conf.CertificateChain, m.conf.PrivateKey = "", ""
+	m.conf.CertificatePath, m.conf.PrivateKeyPath = certPath, keyPath
+	err := loadTLSConf(&m.conf, status)
+	if err == nil {
+		m.status = status
+	}
+	tlsConf := m.conf
+	m.confLock.Unlock()
+
+	if err != nil {
+		log.Error("tls: loading acme certificate: %s", err)
+
+		return
+	}
+
+	m.setCertFileTime()
+
+	onConfigModified()
+
+	err = reconfigureDNSServer()
+	if err != nil {
+		log.Error("tls: applying acme certificate to dns server: %s", err)
+	}
+
+	// The background context is used because the TLSConfigChanged wraps context
+	// with timeout on its own.
+	Context.web.tlsConfigChanged(context.Background(), tlsConf)
+}
+
 // loadTLSConf loads and validates the TLS configuration.  The returned error is
 // also set in status.WarningValidation.
 func loadTLSConf(tlsConf *tlsConfigSettings, status *tlsConfigStatus) (err error) {
@@ -364,6 +410,7 @@ func (m *tlsManager) setConfig(
 	// TODO(a.garipov): Define a custom comparer for dnsforward.TLSConfig.
 	newConf.DNSCryptConfigFile = m.conf.DNSCryptConfigFile
 	newConf.PortDNSCrypt = m.conf.PortDNSCrypt
+	newConf.ACME = m.conf.ACME
 	if !cmp.Equal(m.conf, newConf, cmp.AllowUnexported(dnsforward.TLSConfig{})) {
 		log.Info("tls config has changed, restarting https server")
 		restartHTTPS = true
@@ -374,6 +421,7 @@ func (m *tlsManager) setConfig(
 	// Note: don't do just `t.conf = data` because we must preserve all other members of t.conf
 	m.conf.Enabled = newConf.Enabled
 	m.conf.ServerName = newConf.ServerName
+	m.conf.ClientIDPattern = newConf.ClientIDPattern
 	m.conf.ForceHTTPS = newConf.ForceHTTPS
 	m.conf.PortHTTPS = newConf.PortHTTPS
 	m.conf.PortDNSOverTLS = newConf.PortDNSOverTLS
@@ -492,6 +540,13 @@ func validateTLSSettings(setts tlsConfigSettingsExt) (err error) {
 		return fmt.Errorf("port %d is not available, cannot enable HTTPS on it", setts.PortHTTPS)
 	}
 
+	if setts.ClientIDPattern != "" {
+		_, err = regexp.Compile(setts.ClientIDPattern)
+		if err != nil {
+			return fmt.Errorf("clientid_pattern: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -527,7 +582,9 @@ func validatePorts(
 }
 
 // validateCertChain verifies certs using the first as the main one and others
-// as intermediate.  srvName stands for the expected DNS name.
+// as intermediate.  srvName stands for the expected DNS name.  A wildcard
+// certificate for the subdomains of srvName is also accepted, since these are
+// used by the clients with ClientIDs.
 func validateCertChain(certs []*x509.Certificate, srvName string) (err error) {
 	main, others := certs[0], certs[1:]
 
@@ -542,6 +599,15 @@ func validateCertChain(certs []*x509.Certificate, srvName string) (err error) {
 		Roots:         Context.tlsRoots,
 		Intermediates: pool,
 	}
+
+	if srvName != "" && main.VerifyHostname(srvName) != nil {
+		if slices.Contains(main.DNSNames, "*."+srvName) {
+			// Only verify the chain itself, since the hostnames the clients
+			// use are covered by the wildcard.
+			opts.DNSName = ""
+		}
+	}
+
 	_, err = main.Verify(opts)
 	if err != nil {
 		return fmt.Errorf("certificate does not verify: %w", err)
@@ -0,0 +1,431 @@
+package home
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// TOTP parameters, see RFC 6238.  These are the defaults of the most
+// authenticator applications.
+const (
+	// totpPeriod is the time step of the codes.
+	totpPeriod = 30 * time.Second
+
+	// totpDigits is the number of digits in a code.
+	totpDigits = 6
+
+	// totpSkew is the number of time steps before and after the current one
+	// the codes of which are also accepted to tolerate clock drift.
+	totpSkew = 1
+
+	// totpSecretSize is the length of a secret in bytes.
+	totpSecretSize = 20
+
+	// totpIssuer is the issuer of the codes shown by the authenticator
+	// applications.
+	totpIssuer = "AdGuard Home"
+)
+
+// recoveryCodesNum is the number of recovery codes generated on enrollment.
+const recoveryCodesNum = 10
+
+const (
+	// errTOTPRequired is returned when the two-factor code is required but
+	// isn't provided.
+	errTOTPRequired errors.Error = "two-factor authentication code required"
+
+	// errTOTPInvalid is returned when the two-factor code or the recovery code
+	// is invalid.
+	errTOTPInvalid errors.Error = "invalid two-factor authentication code"
+)
+
+// totpEncoding is the encoding of the secrets, as expected by the
+// authenticator applications.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a new random base32-encoded secret.
+func newTOTPSecret() (secret string, err error) {
+	key := make([]byte, totpSecretSize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return "", fmt.Errorf("generating secret: %w", err)
+	}
+
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// totpCode returns the HOTP code for key and counter, see RFC 4226.
+func totpCode(key []byte, counter uint64) (code string) {
+	mac := hmac.New(sha1.New, key)
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	// Don't check the error since hash.Hash never returns errors.
+	_, _ = mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:]) & 0x7fff_ffff
+
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod)
+}
+
+// validateTOTP returns the time step counter of code, if it's a valid code for
+// secret at now.
+func validateTOTP(secret, code string, now time.Time) (counter uint64, ok bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	cur := uint64(now.Unix()) / uint64(totpPeriod/time.Second)
+	for c := cur - totpSkew; c <= cur+totpSkew; c++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, c)), []byte(code)) == 1 {
+			return c, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpURI returns the key URI of secret for the user with name, which the
+// authenticator applications accept as a QR code.
+func totpURI(secret, name string) (uri string) {
+	q := url.Values{
+		"secret": []string{secret},
+		"issuer": []string{totpIssuer},
+	}
+
+	u := &url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + name,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
+
+// newRecoveryCodes returns new random recovery codes and their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes = make([]string, 0, recoveryCodesNum)
+	hashes = make([]string, 0, recoveryCodesNum)
+	for range recoveryCodesNum {
+		data := make([]byte, 5)
+		_, err = rand.Read(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+
+		code := hex.EncodeToString(data)
+		code = code[:5] + "-" + code[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashSecret(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// checkSecondFactor returns nil if code is either a valid TOTP code or an
+// unused recovery code of the user with name.  A used recovery code is removed,
+// in which case usedRecovery is true.
+func (a *Auth) checkSecondFactor(
+	name string,
+	code string,
+	now time.Time,
+) (usedRecovery bool, err error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, errTOTPRequired
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.findByNameLocked(name)
+	if i < 0 {
+		return false, errUserNotFound
+	}
+
+	u := &a.users[i]
+	if c, ok := validateTOTP(u.TOTPSecret, code, now); ok {
+		// Don't accept the same code twice, since it could've been intercepted.
+		if last, used := a.totpCounters[name]; used && c <= last {
+			return false, errTOTPInvalid
+		}
+
+		a.totpCounters[name] = c
+
+		return false, nil
+	}
+
+	hash := []byte(hashSecret(strings.ToLower(code)))
+	j := slices.IndexFunc(u.TOTPRecoveryCodes, func(h string) (ok bool) {
+		return subtle.ConstantTimeCompare([]byte(h), hash) == 1
+	})
+	if j < 0 {
+		return false, errTOTPInvalid
+	}
+
+	// Don't modify the slice in place, since it's shared with the copies from
+	// [Auth.usersList].
+	u.TOTPRecoveryCodes = slices.Concat(u.TOTPRecoveryCodes[:j], u.TOTPRecoveryCodes[j+1:])
+
+	log.Info("auth: user %q used a recovery code, %d left", name, len(u.TOTPRecoveryCodes))
+
+	return true, nil
+}
+
+// enrollTOTP generates a new pending TOTP secret for the user with name.  It
+// becomes effective once confirmed with [Auth.confirmTOTP].
+func (a *Auth) enrollTOTP(name string) (secret string, err error) {
+	secret, err = newTOTPSecret()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.findByNameLocked(name)
+	if i < 0 {
+		return "", errUserNotFound
+	} else if a.users[i].TOTPSecret != "" {
+		return "", errors.Error("two-factor authentication is already enabled")
+	}
+
+	a.totpPending[name] = secret
+
+	return secret, nil
+}
+
+// confirmTOTP enables the pending TOTP secret of the user with name, if code is
+// valid for it, and returns the new recovery codes.
+func (a *Auth) confirmTOTP(name, code string, now time.Time) (codes []string, err error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	secret, ok := a.totpPending[name]
+	if !ok {
+		return nil, errors.Error("no pending enrollment")
+	}
+
+	i := a.findByNameLocked(name)
+	if i < 0 {
+		return nil, errUserNotFound
+	}
+
+	c, ok := validateTOTP(secret, strings.TrimSpace(code), now)
+	if !ok {
+		return nil, errTOTPInvalid
+	}
+
+	delete(a.totpPending, name)
+	a.totpCounters[name] = c
+
+	u := &a.users[i]
+	u.TOTPSecret = secret
+	u.TOTPRecoveryCodes = hashes
+
+	log.Info("auth: enabled two-factor authentication for user %q", name)
+
+	return codes, nil
+}
+
+// disableTOTP disables the two-factor authentication of the user with name.
+func (a *Auth) disableTOTP(name string) (err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	i := a.findByNameLocked(name)
+	if i < 0 {
+		return errUserNotFound
+	}
+
+	u := &a.users[i]
+	u.TOTPSecret, u.TOTPRecoveryCodes = "", nil
+	delete(a.totpPending, name)
+	delete(a.totpCounters, name)
+
+	log.Info("auth: disabled two-factor authentication for user %q", name)
+
+	return nil
+}
+
+// totpEnrollJSON is the response to the POST /control/profile/totp/enroll HTTP
+// API.
+type totpEnrollJSON struct {
+	// Secret is the base32-encoded secret for entering it manually.
+	Secret string `json:"secret"`
+
+	// URI is the otpauth key URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+// totpCodeJSON is the request to the POST /control/profile/totp/confirm and
+// POST /control/profile/totp/disable HTTP APIs.
+type totpCodeJSON struct {
+	// Code is either a TOTP code or, when disabling, a recovery code.
+	Code string `json:"code"`
+}
+
+// totpRecoveryCodesJSON is the response to the POST
+// /control/profile/totp/confirm HTTP API.
+type totpRecoveryCodesJSON struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// currentUserName returns the name of the user of r or writes an error and
+// returns an empty string, if there is none, for example if r is authenticated
+// with an API token.
+func currentUserName(w http.ResponseWriter, r *http.Request) (name string) {
+	name = Context.auth.getCurrentUser(r).Name
+	if name == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "no user")
+	}
+
+	return name
+}
+
+// handleTOTPEnroll is the handler for the POST /control/profile/totp/enroll
+// HTTP API.
+func handleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	name := currentUserName(w, r)
+	if name == "" {
+		return
+	}
+
+	secret, err := Context.auth.enrollTOTP(name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "enrolling: %s", err)
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, &totpEnrollJSON{
+		Secret: secret,
+		URI:    totpURI(secret, name),
+	})
+}
+
+// handleTOTPConfirm is the handler for the POST /control/profile/totp/confirm
+// HTTP API.  The response contains the recovery codes, which can't be retrieved
+// later.
+func handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	name := currentUserName(w, r)
+	if name == "" {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	codes, err := Context.auth.confirmTOTP(name, req.Code, time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "confirming: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+
+	aghhttp.WriteJSONResponseOK(w, r, &totpRecoveryCodesJSON{
+		RecoveryCodes: codes,
+	})
+}
+
+// handleTOTPDisable is the handler for the POST /control/profile/totp/disable
+// HTTP API.  It requires a valid code, so that a stolen session isn't enough to
+// disable the two-factor authentication.
+func handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	name := currentUserName(w, r)
+	if name == "" {
+		return
+	}
+
+	req := &totpCodeJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	_, err = Context.auth.checkSecondFactor(name, req.Code, time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "disabling: %s", err)
+
+		return
+	}
+
+	err = Context.auth.disableTOTP(name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "disabling: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+}
+
+// handleAccountsTOTPReset is the handler for the POST
+// /control/accounts/totp/reset HTTP API.  It allows the admins to disable the
+// two-factor authentication of the users who lost both their authenticators
+// and the recovery codes.
+func handleAccountsTOTPReset(w http.ResponseWriter, r *http.Request) {
+	req := &accountNameJSON{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "decoding request: %s", err)
+
+		return
+	}
+
+	err = Context.auth.disableTOTP(req.Name)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "resetting: %s", err)
+
+		return
+	}
+
+	onConfigModified()
+}
@@ -0,0 +1,121 @@
+package home
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// The test vectors are from RFC 6238, Appendix B, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+
+	testCases := []struct {
+		want string
+		unix int64
+	}{{
+		want: "287082",
+		unix: 59,
+	}, {
+		want: "081804",
+		unix: 1_111_111_109,
+	}, {
+		want: "050471",
+		unix: 1_111_111_111,
+	}, {
+		want: "005924",
+		unix: 1_234_567_890,
+	}, {
+		want: "279037",
+		unix: 2_000_000_000,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, totpCode(key, uint64(tc.unix)/30))
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1_111_111_111, 0)
+
+	_, ok := validateTOTP(secret, "050471", now)
+	assert.True(t, ok)
+
+	_, ok = validateTOTP(secret, "050471", now.Add(totpPeriod))
+	assert.True(t, ok)
+
+	_, ok = validateTOTP(secret, "050471", now.Add(5*totpPeriod))
+	assert.False(t, ok)
+
+	_, ok = validateTOTP(secret, "123", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("ABCDEF", "user")
+	assert.Equal(t, "otpauth://totp/AdGuard%20Home:user?issuer=AdGuard+Home&secret=ABCDEF", uri)
+}
+
+func TestAuth_TOTP(t *testing.T) {
+	a := InitAuth(filepath.Join(t.TempDir(), "sessions.db"), nil, 60, nil, nil)
+	require.NotNil(t, a)
+	t.Cleanup(a.Close)
+
+	require.NoError(t, a.addAccount("user", "password", userRoleAdmin))
+
+	secret, err := a.enrollTOTP("user")
+	require.NoError(t, err)
+
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+
+	now := time.Now()
+	code := totpCode(key, uint64(now.Unix())/30)
+
+	_, err = a.confirmTOTP("user", "000000x", now)
+	assert.ErrorIs(t, err, errTOTPInvalid)
+
+	recovery, err := a.confirmTOTP("user", code, now)
+	require.NoError(t, err)
+	require.Len(t, recovery, recoveryCodesNum)
+
+	u, ok := a.findUser("user", "password")
+	require.True(t, ok)
+
+	assert.Equal(t, secret, u.TOTPSecret)
+	assert.NotContains(t, u.TOTPRecoveryCodes, recovery[0])
+
+	_, err = a.checkSecondFactor("user", "", now)
+	assert.ErrorIs(t, err, errTOTPRequired)
+
+	// The code used for the confirmation must not be accepted again.
+	_, err = a.checkSecondFactor("user", code, now)
+	assert.ErrorIs(t, err, errTOTPInvalid)
+
+	next := now.Add(totpPeriod)
+	usedRecovery, err := a.checkSecondFactor("user", totpCode(key, uint64(next.Unix())/30), next)
+	require.NoError(t, err)
+	assert.False(t, usedRecovery)
+
+	usedRecovery, err = a.checkSecondFactor("user", strings.ToUpper(recovery[0]), now)
+	require.NoError(t, err)
+	assert.True(t, usedRecovery)
+
+	_, err = a.checkSecondFactor("user", recovery[0], now)
+	assert.ErrorIs(t, err, errTOTPInvalid)
+
+	require.NoError(t, a.disableTOTP("user"))
+
+	u, ok = a.findUser("user", "password")
+	require.True(t, ok)
+
+	assert.Empty(t, u.TOTPSecret)
+	assert.Empty(t, u.TOTPRecoveryCodes)
+}
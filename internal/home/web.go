@@ -43,6 +43,14 @@ type webConfig struct {
 	// BindAddr is the binding address with port for plain HTTP web interface.
 	BindAddr netip.AddrPort
 
+	// DoHAddr is the address to serve only DNS-over-HTTPS on.  If it's not
+	// valid, DoH is only served on the web interface addresses.
+	DoHAddr netip.AddrPort
+
+	// AllowedNets are the networks of the clients allowed to access the web
+	// interface.  If empty, all clients are allowed.
+	AllowedNets []netip.Prefix
+
 	// ReadTimeout is an option to pass to http.Server for setting an
 	// appropriate field.
 	ReadTimeout time.Duration
@@ -74,6 +82,9 @@ type httpsServer struct {
 	// server3 is the HTTP/3 HTTPS server.  If it is not nil,
 	// [httpsServer.server] must also be non-nil.
 	server3 *http3.Server
+	// serverDoH is the HTTPS server serving only DNS-over-HTTPS.  It is nil
+	// unless [webConfig.DoHAddr] is valid.
+	serverDoH *http.Server
 
 	// TODO(a.garipov): Why is there a *sync.Cond here?  Remove.
 	cond       *sync.Cond
@@ -137,8 +148,12 @@ func webCheckPortAvailable(port uint16) (ok bool) {
 }
 
 // tlsConfigChanged updates the TLS configuration and restarts the HTTPS server
-// if necessary.
+// if necessary.  web may be nil, in which case it does nothing.
 func (web *webAPI) tlsConfigChanged(ctx context.Context, tlsConf tlsConfigSettings) {
+	if web == nil {
+		return
+	}
+
 	log.Debug("web: applying new tls configuration")
 
 	enabled := tlsConf.Enabled &&
@@ -160,6 +175,7 @@ func (web *webAPI) tlsConfigChanged(ctx context.Context, tlsConf tlsConfigSettin
 		ctx, cancel = context.WithTimeout(ctx, shutdownTimeout)
 		shutdownSrv(ctx, web.httpsServer.server)
 		shutdownSrv3(web.httpsServer.server3)
+		shutdownSrv(ctx, web.httpsServer.serverDoH)
 
 		cancel()
 	}
@@ -183,7 +199,7 @@ func (web *webAPI) start() {
 		errs := make(chan error, 2)
 
 		// Use an h2c handler to support unencrypted HTTP/2, e.g. for proxies.
-		hdlr := h2c.NewHandler(withMiddlewares(Context.mux, limitRequestBody), &http2.Server{})
+		hdlr := h2c.NewHandler(web.handler(), &http2.Server{})
 
 		// Create a new instance, because the Web is not usable after Shutdown.
 		web.httpServer = &http.Server{
@@ -225,6 +241,7 @@ func (web *webAPI) close(ctx context.Context) {
 
 	shutdownSrv(ctx, web.httpsServer.server)
 	shutdownSrv3(web.httpsServer.server3)
+	shutdownSrv(ctx, web.httpsServer.serverDoH)
 	shutdownSrv(ctx, web.httpServer)
 
 	log.Info("stopped http server")
@@ -267,7 +284,7 @@ func (web *webAPI) tlsServerLoop() {
 				CipherSuites: Context.tlsCipherIDs,
 				MinVersion:   tls.VersionTLS12,
 			},
-			Handler:           withMiddlewares(Context.mux, limitRequestBody),
+			Handler:           web.handler(),
 			ReadTimeout:       web.conf.ReadTimeout,
 			ReadHeaderTimeout: web.conf.ReadHeaderTimeout,
 			WriteTimeout:      web.conf.WriteTimeout,
@@ -279,6 +296,10 @@ func (web *webAPI) tlsServerLoop() {
 			go web.mustStartHTTP3(addr)
 		}
 
+		if web.conf.DoHAddr.IsValid() {
+			go web.mustStartDoH()
+		}
+
 		log.Debug("web: starting https server")
 		err := web.httpsServer.server.ListenAndServeTLS("", "")
 		if !errors.Is(err, http.ErrServerClosed) {
@@ -301,7 +322,7 @@ func (web *webAPI) mustStartHTTP3(address string) {
 			CipherSuites: Context.tlsCipherIDs,
 			MinVersion:   tls.VersionTLS12,
 		},
-		Handler: withMiddlewares(Context.mux, limitRequestBody),
+		Handler: web.handler(),
 	}
 
 	log.Debug("web: starting http/3 server")
@@ -312,6 +333,39 @@ func (web *webAPI) mustStartHTTP3(address string) {
 	}
 }
 
+// mustStartDoH starts the HTTPS server serving only DNS-over-HTTPS on
+// [webConfig.DoHAddr].  The allowed networks aren't applied to it.
+func (web *webAPI) mustStartDoH() {
+	defer log.OnPanic("web: doh")
+
+	web.httpsServer.serverDoH = &http.Server{
+		ErrorLog: log.StdLog("web: doh", log.DEBUG),
+		Addr:     web.conf.DoHAddr.String(),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{web.httpsServer.cert},
+			RootCAs:      Context.tlsRoots,
+			CipherSuites: Context.tlsCipherIDs,
+			MinVersion:   tls.VersionTLS12,
+		},
+		Handler:           withMiddlewares(Context.mux, dohOnlyHandler, limitRequestBody),
+		ReadTimeout:       web.conf.ReadTimeout,
+		ReadHeaderTimeout: web.conf.ReadHeaderTimeout,
+		WriteTimeout:      web.conf.WriteTimeout,
+	}
+
+	log.Info("web: serving dns-over-https on https://%s%s", web.conf.DoHAddr, dohPath)
+	err := web.httpsServer.serverDoH.ListenAndServeTLS("", "")
+	if !errors.Is(err, http.ErrServerClosed) {
+		cleanupAlways()
+		log.Fatalf("web: doh: %s", err)
+	}
+}
+
+// handler returns the handler of the web interface servers.
+func (web *webAPI) handler() (h http.Handler) {
+	return withMiddlewares(Context.mux, allowedNetworksHandler(web.conf.AllowedNets), limitRequestBody)
+}
+
 // startPprof launches the debug and profiling server on the provided port.
 func startPprof(port uint16) {
 	addr := netip.AddrPortFrom(netutil.IPv4Localhost(), port)
@@ -0,0 +1,259 @@
+package home
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghos"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// webhooksConfig is the configuration of the webhooks sending the server
+// events.
+type webhooksConfig struct {
+	// Endpoints are the endpoints to send the events to.
+	Endpoints []*webhookEndpointConfig `yaml:"endpoints"`
+
+	// Timeout is the timeout of a single request.  If zero,
+	// [defaultWebhookTimeout] is used.
+	Timeout timeutil.Duration `yaml:"timeout"`
+
+	// RetryDelay is the delay before the first retry of a failed request,
+	// which is doubled before each next one.  If zero,
+	// [defaultWebhookRetryDelay] is used.
+	RetryDelay timeutil.Duration `yaml:"retry_delay"`
+
+	// CheckInterval is the interval between the checks of the upstream servers
+	// and the free disk space.  If zero, [defaultWebhookCheckIvl] is used.
+	CheckInterval timeutil.Duration `yaml:"check_interval"`
+
+	// Retries is the maximum number of retries of a failed request.
+	Retries uint `yaml:"retries"`
+
+	// DiskFreePercent is the percentage of the free disk space below which the
+	// [webhook.EventDiskNearlyFull] event is sent.  If zero, the disk space
+	// isn't checked.
+	DiskFreePercent uint `yaml:"disk_free_percent"`
+
+	// Enabled defines if the events are sent.
+	Enabled bool `yaml:"enabled"`
+}
+
+// webhookEndpointConfig is the configuration of a single webhook endpoint.
+type webhookEndpointConfig struct {
+	// URL is the URL to POST the events to.
+	URL string `yaml:"url"`
+
+	// Secret is the key to sign the request bodies with HMAC-SHA256.  If
+	// empty, the requests aren't signed.
+	Secret string `yaml:"secret"`
+
+	// Events are the types of the events sent to the endpoint.  If empty, all
+	// the events are sent.
+	Events []webhook.EventType `yaml:"events"`
+}
+
+// Default values of the webhooks configuration.
+const (
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookRetryDelay = 5 * time.Second
+	defaultWebhookCheckIvl   = 1 * time.Minute
+)
+
+// newWebhookNotifier returns a new webhook notifier from conf.  n is nil if conf
+// is nil or disabled.
+func newWebhookNotifier(conf *webhooksConfig) (n *webhook.Notifier, err error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	} else if conf.DiskFreePercent >= 100 {
+		return nil, fmt.Errorf("disk_free_percent: must be less than 100, got %d", conf.DiskFreePercent)
+	}
+
+	endpoints := make([]*webhook.Endpoint, 0, len(conf.Endpoints))
+	for i, e := range conf.Endpoints {
+		var u *url.URL
+		u, err = url.Parse(e.URL)
+		if err != nil {
+			return nil, fmt.Errorf("endpoints: at index %d: url: %w", i, err)
+		}
+
+		endpoints = append(endpoints, &webhook.Endpoint{
+			URL:    u,
+			Secret: []byte(e.Secret),
+			Events: e.Events,
+		})
+	}
+
+	cli := httpClient()
+	cli.Timeout = durationOr(conf.Timeout, defaultWebhookTimeout)
+
+	return webhook.NewNotifier(&webhook.Config{
+		HTTPClient: cli,
+		Endpoints:  endpoints,
+		RetryDelay: durationOr(conf.RetryDelay, defaultWebhookRetryDelay),
+		Retries:    conf.Retries,
+	})
+}
+
+// durationOr returns d or def, if d is zero.
+func durationOr(d timeutil.Duration, def time.Duration) (res time.Duration) {
+	if d.Duration == 0 {
+		return def
+	}
+
+	return d.Duration
+}
+
+// notifyFilterUpdateFailed sends the webhook event about the failed update of
+// flt.  It's used as [filtering.Config.FilterUpdateFailed].
+func notifyFilterUpdateFailed(flt *filtering.FilterYAML, err error) {
+	Context.webhooks.Notify(webhook.EventFilterUpdateFailed, &webhook.FilterUpdateFailedData{
+		Name:  flt.Name,
+		URL:   flt.URL,
+		Error: err.Error(),
+	})
+}
+
+// notifyAuthFailed sends the webhook event about the failed login of user from
+// ip.
+func notifyAuthFailed(user, ip string) {
+	Context.webhooks.Notify(webhook.EventAuthFailed, &webhook.AuthFailedData{
+		User: user,
+		IP:   ip,
+	})
+}
+
+// eventMonitor periodically checks the state of the upstream servers and of
+// the disk and sends the webhook events when it changes.
+type eventMonitor struct {
+	// notify sends the event of typ with data.
+	notify func(typ webhook.EventType, data any)
+
+	// checkUpstreams returns an error if none of the upstream servers answers.
+	checkUpstreams func() (err error)
+
+	// diskSpace returns the available and the total disk space in bytes.
+	diskSpace func() (avail, total uint64, err error)
+
+	// done is closed when the monitor is closed.
+	done chan struct{}
+
+	// dataDir is the directory, which disk space is checked.
+	dataDir string
+
+	ivl time.Duration
+
+	// diskFreePercent is the threshold of the free disk space.  If zero, the
+	// disk space isn't checked.
+	diskFreePercent uint
+
+	// upstreamDown is true if the last upstream check has failed.
+	upstreamDown bool
+
+	// diskFull is true if the free disk space was below the threshold during
+	// the last check.
+	diskFull bool
+}
+
+// newEventMonitor returns a new monitor sending the events to n.  m is nil if n
+// is nil.  conf must not be nil if n isn't nil.
+func newEventMonitor(n *webhook.Notifier, conf *webhooksConfig, dataDir string) (m *eventMonitor) {
+	if n == nil {
+		return nil
+	}
+
+	return &eventMonitor{
+		notify:         n.Notify,
+		checkUpstreams: func() (err error) { return Context.dnsServer.CheckUpstreams() },
+		diskSpace: func() (avail, total uint64, err error) {
+			return aghos.DiskSpace(dataDir)
+		},
+		done:            make(chan struct{}),
+		dataDir:         dataDir,
+		ivl:             durationOr(conf.CheckInterval, defaultWebhookCheckIvl),
+		diskFreePercent: conf.DiskFreePercent,
+	}
+}
+
+// Start starts the checks in a separate goroutine.
+func (m *eventMonitor) Start() {
+	go m.loop()
+}
+
+// Close stops the checks.  It must only be called once.
+func (m *eventMonitor) Close() {
+	close(m.done)
+}
+
+// loop runs the checks each interval until m is closed.
+func (m *eventMonitor) loop() {
+	defer log.OnPanic("webhook: event monitor")
+
+	t := time.NewTicker(m.ivl)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			if isRunning() {
+				m.checkUpstreamsState()
+			}
+
+			m.checkDiskState()
+		}
+	}
+}
+
+// checkUpstreamsState sends an event if the state of the upstream servers has
+// changed since the last check.
+func (m *eventMonitor) checkUpstreamsState() {
+	err := m.checkUpstreams()
+	down := err != nil
+	if down == m.upstreamDown {
+		return
+	}
+
+	m.upstreamDown = down
+	if down {
+		m.notify(webhook.EventUpstreamDown, &webhook.UpstreamData{
+			Error: err.Error(),
+		})
+	} else {
+		m.notify(webhook.EventUpstreamUp, &webhook.UpstreamData{})
+	}
+}
+
+// checkDiskState sends an event if the free disk space has fallen below the
+// threshold since the last check.
+func (m *eventMonitor) checkDiskState() {
+	if m.diskFreePercent == 0 {
+		return
+	}
+
+	avail, total, err := m.diskSpace()
+	if err != nil {
+		log.Error("webhook: getting disk space of %q: %s", m.dataDir, err)
+
+		return
+	}
+
+	full := total > 0 && avail*100 < total*uint64(m.diskFreePercent)
+	if full == m.diskFull {
+		return
+	}
+
+	m.diskFull = full
+	if full {
+		m.notify(webhook.EventDiskNearlyFull, &webhook.DiskNearlyFullData{
+			Path:      m.dataDir,
+			Available: avail,
+			Total:     total,
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package home
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/webhook"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestEventMonitor returns a new *eventMonitor, which records the types of
+// the sent events into got.
+func newTestEventMonitor(got *[]webhook.EventType) (m *eventMonitor) {
+	return &eventMonitor{
+		notify: func(typ webhook.EventType, _ any) {
+			*got = append(*got, typ)
+		},
+		dataDir:         "/var/lib/adguardhome",
+		diskFreePercent: 10,
+	}
+}
+
+func TestEventMonitor_CheckUpstreamsState(t *testing.T) {
+	var got []webhook.EventType
+	m := newTestEventMonitor(&got)
+
+	var upsErr error
+	m.checkUpstreams = func() (err error) { return upsErr }
+
+	m.checkUpstreamsState()
+	assert.Empty(t, got)
+
+	upsErr = errors.Error("no upstream servers")
+	m.checkUpstreamsState()
+	m.checkUpstreamsState()
+	assert.Equal(t, []webhook.EventType{webhook.EventUpstreamDown}, got)
+
+	upsErr = nil
+	m.checkUpstreamsState()
+	assert.Equal(t, []webhook.EventType{
+		webhook.EventUpstreamDown,
+		webhook.EventUpstreamUp,
+	}, got)
+}
+
+func TestEventMonitor_CheckDiskState(t *testing.T) {
+	var got []webhook.EventType
+	m := newTestEventMonitor(&got)
+
+	var avail uint64
+	m.diskSpace = func() (a, total uint64, err error) { return avail, 1000, nil }
+
+	avail = 500
+	m.checkDiskState()
+	assert.Empty(t, got)
+
+	avail = 50
+	m.checkDiskState()
+	m.checkDiskState()
+	assert.Equal(t, []webhook.EventType{webhook.EventDiskNearlyFull}, got)
+
+	avail = 500
+	m.checkDiskState()
+
+	avail = 99
+	m.checkDiskState()
+	assert.Equal(t, []webhook.EventType{
+		webhook.EventDiskNearlyFull,
+		webhook.EventDiskNearlyFull,
+	}, got)
+}
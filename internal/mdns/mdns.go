@@ -0,0 +1,514 @@
+// Package mdns implements a minimal multicast DNS responder, which advertises
+// the services of AdGuard Home using DNS-based service discovery.
+//
+// See RFC 6762 and RFC 6763.
+package mdns
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/netutil"
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+)
+
+// Port is the UDP port of mDNS.
+const Port = 5353
+
+// groupAddr is the IPv4 multicast group of mDNS.
+var groupAddr = netip.AddrPortFrom(netip.AddrFrom4([4]byte{224, 0, 0, 251}), Port)
+
+// localDomain is the domain all the mDNS names belong to.
+const localDomain = "local."
+
+// servicesName is the name of the meta-query for enumerating the service types,
+// see RFC 6763 Section 9.
+const servicesName = "_services._dns-sd._udp." + localDomain
+
+// TTLs of the records as recommended by RFC 6762 Section 10.
+const (
+	// hostTTL is the TTL of the records containing the host name.
+	hostTTL = 120
+
+	// otherTTL is the TTL of the other records.
+	otherTTL = 4500
+
+	// legacyTTL is the maximum TTL of the records sent in the responses to the
+	// legacy unicast queries, see RFC 6762 Section 6.7.
+	legacyTTL = 10
+)
+
+// classTopBit is the top bit of the class, which means cache-flush in the
+// records, see RFC 6762 Section 10.2, and unicast response requested in the
+// questions, see RFC 6762 Section 5.4.
+const classTopBit = 1 << 15
+
+// maxMsgSize is the maximum size of an mDNS message, see RFC 6762 Section 17.
+const maxMsgSize = 9000
+
+// announceCount is the number of the unsolicited announcements sent on start,
+// see RFC 6762 Section 8.3.
+const announceCount = 2
+
+// Service is a service instance to advertise.
+type Service struct {
+	// Instance is the user-friendly name of the service instance, for example
+	// "AdGuard Home".  Instances of the same type must have different names.
+	Instance string
+
+	// Type is the type of the service with the protocol, for example
+	// "_http._tcp".
+	Type string
+
+	// TXT are the key-value pairs describing the service, for example
+	// "path=/".
+	TXT []string
+
+	// Port is the port the service is served on.
+	Port uint16
+}
+
+// Config is the configuration of a [Responder].
+type Config struct {
+	// Interface is the network interface to serve mDNS on.  If nil, the
+	// system-chosen one is used.
+	Interface *net.Interface
+
+	// Hostname is the single-label host name, which is advertised within the
+	// local domain.  It must not be empty.
+	Hostname string
+
+	// Addrs are the addresses of the host.  It must not be empty.
+	Addrs []netip.Addr
+
+	// Services are the services to advertise.
+	Services []*Service
+}
+
+// Responder answers the mDNS queries about the advertised services.  Only IPv4
+// multicast is currently supported.
+type Responder struct {
+	conn *net.UDPConn
+
+	// stopped is closed when the serving goroutine has exited.
+	stopped chan struct{}
+
+	iface *net.Interface
+
+	// records are all the records the responder is authoritative for.
+	records []dns.RR
+}
+
+// NewResponder returns a new properly initialized *Responder.  conf must not be
+// nil.
+func NewResponder(conf *Config) (r *Responder, err error) {
+	err = netutil.ValidateHostnameLabel(conf.Hostname)
+	if err != nil {
+		return nil, fmt.Errorf("hostname: %w", err)
+	} else if len(conf.Addrs) == 0 {
+		return nil, errors.Error("addrs: empty value")
+	}
+
+	records, err := newRecords(conf)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return &Responder{
+		stopped: make(chan struct{}),
+		iface:   conf.Interface,
+		records: records,
+	}, nil
+}
+
+// newRecords returns the records describing the host and the services from
+// conf.
+func newRecords(conf *Config) (records []dns.RR, err error) {
+	host := dns.Fqdn(conf.Hostname + "." + localDomain)
+	for _, addr := range conf.Addrs {
+		records = append(records, newAddrRecord(host, addr.Unmap()))
+	}
+
+	types := map[string]struct{}{}
+	for i, s := range conf.Services {
+		err = validateServiceType(s.Type)
+		if err != nil {
+			return nil, fmt.Errorf("services: at index %d: type: %w", i, err)
+		} else if s.Instance == "" {
+			return nil, fmt.Errorf("services: at index %d: instance: %w", i, errors.Error("empty value"))
+		}
+
+		var inst string
+		inst, err = instanceLabel(s.Instance)
+		if err != nil {
+			return nil, fmt.Errorf("services: at index %d: instance: %w", i, err)
+		}
+
+		typeName := s.Type + "." + localDomain
+		if _, ok := types[typeName]; !ok {
+			types[typeName] = struct{}{}
+			records = append(records, &dns.PTR{
+				Hdr: newHdr(servicesName, dns.TypePTR, otherTTL, false),
+				Ptr: typeName,
+			})
+		}
+
+		instName := inst + "." + typeName
+		txt := s.TXT
+		if len(txt) == 0 {
+			// A TXT record must not be empty, see RFC 6763 Section 6.1.
+			txt = []string{""}
+		}
+
+		records = append(
+			records,
+			&dns.PTR{
+				Hdr: newHdr(typeName, dns.TypePTR, otherTTL, false),
+				Ptr: instName,
+			},
+			&dns.SRV{
+				Hdr:    newHdr(instName, dns.TypeSRV, hostTTL, true),
+				Port:   s.Port,
+				Target: host,
+			},
+			&dns.TXT{
+				Hdr: newHdr(instName, dns.TypeTXT, otherTTL, true),
+				Txt: txt,
+			},
+		)
+	}
+
+	return records, nil
+}
+
+// validateServiceType returns an error if typ isn't a valid service type with
+// the protocol, such as "_http._tcp".
+func validateServiceType(typ string) (err error) {
+	name, proto, ok := strings.Cut(typ, ".")
+	if !ok || (proto != "_tcp" && proto != "_udp") {
+		return fmt.Errorf("bad value %q", typ)
+	}
+
+	return netutil.ValidateServiceNameLabel(name)
+}
+
+// instanceLabel returns the instance name as a label in the presentation
+// format, escaped the same way the names of the received queries are.
+func instanceLabel(inst string) (label string, err error) {
+	if len(inst) > 63 {
+		return "", fmt.Errorf("too long: %d bytes", len(inst))
+	}
+
+	wire := append(append([]byte{byte(len(inst))}, inst...), 0)
+	label, _, err = dns.UnpackDomainName(wire, 0)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	return strings.TrimSuffix(label, "."), nil
+}
+
+// newHdr returns a new header of the record of type rrType with name.  unique
+// defines if the cache-flush bit is set.
+func newHdr(name string, rrType uint16, ttl uint32, unique bool) (hdr dns.RR_Header) {
+	hdr = dns.RR_Header{
+		Name:   name,
+		Rrtype: rrType,
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+	}
+
+	if unique {
+		hdr.Class |= classTopBit
+	}
+
+	return hdr
+}
+
+// newAddrRecord returns an A or AAAA record for host with addr.
+func newAddrRecord(host string, addr netip.Addr) (rr dns.RR) {
+	if addr.Is4() {
+		return &dns.A{
+			Hdr: newHdr(host, dns.TypeA, hostTTL, true),
+			A:   addr.AsSlice(),
+		}
+	}
+
+	return &dns.AAAA{
+		Hdr:  newHdr(host, dns.TypeAAAA, hostTTL, true),
+		AAAA: addr.AsSlice(),
+	}
+}
+
+// Start starts serving mDNS and announces the services.
+func (r *Responder) Start() (err error) {
+	r.conn, err = net.ListenMulticastUDP("udp4", r.iface, net.UDPAddrFromAddrPort(groupAddr))
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	if r.iface != nil {
+		err = ipv4.NewPacketConn(r.conn).SetMulticastInterface(r.iface)
+		if err != nil {
+			return errors.WithDeferred(fmt.Errorf("setting interface: %w", err), r.conn.Close())
+		}
+	}
+
+	go r.loop()
+	go r.announce()
+
+	log.Info("mdns: advertising %d records", len(r.records))
+
+	return nil
+}
+
+// Close sends the goodbye packets and stops serving mDNS.  It must only be
+// called once after a successful call to Start.
+func (r *Responder) Close() {
+	goodbye := r.unsolicited()
+	for _, rr := range goodbye.Answer {
+		rr.Header().Ttl = 0
+	}
+
+	r.send(goodbye, groupAddr)
+
+	err := r.conn.Close()
+	if err != nil {
+		log.Debug("mdns: closing: %s", err)
+	}
+
+	<-r.stopped
+}
+
+// announce sends the unsolicited responses with all the records.
+func (r *Responder) announce() {
+	defer log.OnPanic("mdns: announcing")
+
+	for i := 0; i < announceCount; i++ {
+		if i > 0 {
+			select {
+			case <-r.stopped:
+				return
+			case <-time.After(time.Second):
+				// Go on.
+			}
+		}
+
+		r.send(r.unsolicited(), groupAddr)
+	}
+}
+
+// unsolicited returns a new unsolicited response with all the records.
+func (r *Responder) unsolicited() (resp *dns.Msg) {
+	resp = &dns.Msg{
+		MsgHdr: dns.MsgHdr{
+			Response:      true,
+			Authoritative: true,
+		},
+	}
+
+	for _, rr := range r.records {
+		resp.Answer = append(resp.Answer, dns.Copy(rr))
+	}
+
+	return resp
+}
+
+// loop serves the mDNS queries until the connection is closed.
+func (r *Responder) loop() {
+	defer log.OnPanic("mdns: responder")
+	defer close(r.stopped)
+
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, src, err := r.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			log.Debug("mdns: reading: %s", err)
+
+			continue
+		}
+
+		req := &dns.Msg{}
+		err = req.Unpack(buf[:n])
+		if err != nil {
+			log.Debug("mdns: unpacking from %s: %s", src, err)
+
+			continue
+		}
+
+		resp, dst := r.response(req, src)
+		if resp != nil {
+			r.send(resp, dst)
+		}
+	}
+}
+
+// send packs resp and sends it to dst.
+func (r *Responder) send(resp *dns.Msg, dst netip.AddrPort) {
+	b, err := resp.Pack()
+	if err != nil {
+		log.Error("mdns: packing: %s", err)
+
+		return
+	}
+
+	_, err = r.conn.WriteToUDPAddrPort(b, dst)
+	if err != nil {
+		log.Debug("mdns: sending to %s: %s", dst, err)
+	}
+}
+
+// response returns the response to the query req received from src and the
+// address to send it to.  resp is nil if there is nothing to respond with.
+func (r *Responder) response(req *dns.Msg, src netip.AddrPort) (resp *dns.Msg, dst netip.AddrPort) {
+	if req.Response || req.Opcode != dns.OpcodeQuery || req.Rcode != dns.RcodeSuccess {
+		return nil, dst
+	}
+
+	// The queries from a port other than the mDNS one are the legacy unicast
+	// ones, see RFC 6762 Section 6.7.
+	legacy := src.Port() != Port
+
+	unicast := legacy
+	resp = &dns.Msg{
+		MsgHdr: dns.MsgHdr{
+			Response:      true,
+			Authoritative: true,
+		},
+	}
+
+	for _, q := range req.Question {
+		unicast = unicast || q.Qclass&classTopBit != 0
+
+		for _, rr := range r.answers(q) {
+			if !isKnownAnswer(rr, req.Answer) && !containsRR(resp.Answer, rr) {
+				resp.Answer = append(resp.Answer, dns.Copy(rr))
+			}
+		}
+	}
+
+	if len(resp.Answer) == 0 {
+		return nil, dst
+	}
+
+	for _, rr := range r.additionals(resp.Answer) {
+		resp.Extra = append(resp.Extra, dns.Copy(rr))
+	}
+
+	if legacy {
+		resp.Id = req.Id
+		resp.Question = req.Question
+		capLegacy(resp)
+	}
+
+	if unicast {
+		return resp, src
+	}
+
+	return resp, groupAddr
+}
+
+// answers returns the records answering q.
+func (r *Responder) answers(q dns.Question) (ans []dns.RR) {
+	if q.Qclass&^classTopBit != dns.ClassINET && q.Qclass&^classTopBit != dns.ClassANY {
+		return nil
+	}
+
+	for _, rr := range r.records {
+		hdr := rr.Header()
+		if (q.Qtype == dns.TypeANY || q.Qtype == hdr.Rrtype) && strings.EqualFold(q.Name, hdr.Name) {
+			ans = append(ans, rr)
+		}
+	}
+
+	return ans
+}
+
+// additionals returns the records recommended to be added into the additional
+// section of a response with ans, see RFC 6763 Section 12.
+func (r *Responder) additionals(ans []dns.RR) (extra []dns.RR) {
+	var names []string
+	for _, rr := range ans {
+		switch rr := rr.(type) {
+		case *dns.PTR:
+			names = append(names, rr.Ptr)
+		case *dns.SRV:
+			names = append(names, rr.Target)
+		}
+	}
+
+	for i := 0; i < len(names); i++ {
+		for _, rr := range r.records {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypePTR || !strings.EqualFold(hdr.Name, names[i]) {
+				continue
+			} else if containsRR(ans, rr) || containsRR(extra, rr) {
+				continue
+			}
+
+			extra = append(extra, rr)
+			if srv, ok := rr.(*dns.SRV); ok {
+				names = append(names, srv.Target)
+			}
+		}
+	}
+
+	return extra
+}
+
+// capLegacy prepares resp to be sent in response to a legacy unicast query, see
+// RFC 6762 Section 6.7.
+func capLegacy(resp *dns.Msg) {
+	for _, rrs := range [][]dns.RR{resp.Answer, resp.Extra} {
+		for _, rr := range rrs {
+			hdr := rr.Header()
+			hdr.Class &^= classTopBit
+			hdr.Ttl = min(hdr.Ttl, legacyTTL)
+		}
+	}
+}
+
+// isKnownAnswer returns true if rr is among the known answers with at least
+// half of its TTL remaining, see RFC 6762 Section 7.1.
+func isKnownAnswer(rr dns.RR, known []dns.RR) (ok bool) {
+	for _, k := range known {
+		if k.Header().Ttl >= rr.Header().Ttl/2 && isSameRR(k, rr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsRR returns true if rrs contain a record with the same data as rr.
+func containsRR(rrs []dns.RR, rr dns.RR) (ok bool) {
+	for _, cur := range rrs {
+		if isSameRR(cur, rr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSameRR returns true if a and b have the same name, type, and data.  The
+// cache-flush bit and the TTL are ignored.
+func isSameRR(a, b dns.RR) (ok bool) {
+	a, b = dns.Copy(a), dns.Copy(b)
+	a.Header().Class &^= classTopBit
+	b.Header().Class &^= classTopBit
+
+	return dns.IsDuplicate(a, b)
+}
@@ -0,0 +1,236 @@
+package mdns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Common names for tests.
+const (
+	testHost     = "adguard.local."
+	testHTTPType = "_http._tcp.local."
+	testHTTPInst = `AdGuard\ Home._http._tcp.local.`
+	testDoTType  = "_domain-s._tcp.local."
+	testDoTInst  = `AdGuard\ Home._domain-s._tcp.local.`
+)
+
+// newTestResponder returns a new *Responder advertising the web UI and
+// DNS-over-TLS for tests.
+func newTestResponder(t *testing.T) (r *Responder) {
+	t.Helper()
+
+	r, err := NewResponder(&Config{
+		Hostname: "adguard",
+		Addrs:    []netip.Addr{netip.MustParseAddr("192.168.1.1")},
+		Services: []*Service{{
+			Instance: "AdGuard Home",
+			Type:     "_http._tcp",
+			TXT:      []string{"path=/"},
+			Port:     80,
+		}, {
+			Instance: "AdGuard Home",
+			Type:     "_domain-s._tcp",
+			Port:     853,
+		}},
+	})
+	require.NoError(t, err)
+
+	return r
+}
+
+// names returns the names and the types of rrs in the presentation format.
+func names(rrs []dns.RR) (res []string) {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		res = append(res, dns.TypeToString[hdr.Rrtype]+" "+hdr.Name)
+	}
+
+	return res
+}
+
+func TestNewResponder(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("192.168.1.1")}
+
+	testCases := []struct {
+		conf       *Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &Config{
+			Hostname: "adguard",
+			Addrs:    addrs,
+		},
+		name:       "no_services",
+		wantErrMsg: "",
+	}, {
+		conf: &Config{
+			Hostname: "ad.guard",
+			Addrs:    addrs,
+		},
+		name: "bad_hostname",
+		wantErrMsg: `hostname: bad hostname label "ad.guard": ` +
+			`bad hostname label rune '.'`,
+	}, {
+		conf: &Config{
+			Hostname: "adguard",
+		},
+		name:       "no_addrs",
+		wantErrMsg: "addrs: empty value",
+	}, {
+		conf: &Config{
+			Hostname: "adguard",
+			Addrs:    addrs,
+			Services: []*Service{{
+				Instance: "AdGuard Home",
+				Type:     "_http",
+			}},
+		},
+		name:       "bad_type",
+		wantErrMsg: `services: at index 0: type: bad value "_http"`,
+	}, {
+		conf: &Config{
+			Hostname: "adguard",
+			Addrs:    addrs,
+			Services: []*Service{{
+				Type: "_http._tcp",
+			}},
+		},
+		name:       "no_instance",
+		wantErrMsg: "services: at index 0: instance: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewResponder(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestResponder_Response(t *testing.T) {
+	r := newTestResponder(t)
+
+	mdnsSrc := netip.MustParseAddrPort("192.168.1.2:5353")
+	legacySrc := netip.MustParseAddrPort("192.168.1.2:34567")
+
+	testCases := []struct {
+		req       *dns.Msg
+		src       netip.AddrPort
+		wantDst   netip.AddrPort
+		name      string
+		wantAns   []string
+		wantExtra []string
+	}{{
+		req:       (&dns.Msg{}).SetQuestion(servicesName, dns.TypePTR),
+		src:       mdnsSrc,
+		wantDst:   groupAddr,
+		name:      "services",
+		wantAns:   []string{"PTR " + servicesName, "PTR " + servicesName},
+		wantExtra: nil,
+	}, {
+		req:     (&dns.Msg{}).SetQuestion(testDoTType, dns.TypePTR),
+		src:     mdnsSrc,
+		wantDst: groupAddr,
+		name:    "browse",
+		wantAns: []string{"PTR " + testDoTType},
+		wantExtra: []string{
+			"SRV " + testDoTInst,
+			"TXT " + testDoTInst,
+			"A " + testHost,
+		},
+	}, {
+		req:       (&dns.Msg{}).SetQuestion(testHTTPInst, dns.TypeSRV),
+		src:       legacySrc,
+		wantDst:   legacySrc,
+		name:      "legacy_srv",
+		wantAns:   []string{"SRV " + testHTTPInst},
+		wantExtra: []string{"A " + testHost},
+	}, {
+		req:       (&dns.Msg{}).SetQuestion("ADGUARD.local.", dns.TypeANY),
+		src:       mdnsSrc,
+		wantDst:   groupAddr,
+		name:      "any_case_insensitive",
+		wantAns:   []string{"A " + testHost},
+		wantExtra: nil,
+	}, {
+		req:       (&dns.Msg{}).SetQuestion("other.local.", dns.TypeA),
+		src:       mdnsSrc,
+		wantDst:   netip.AddrPort{},
+		name:      "other",
+		wantAns:   nil,
+		wantExtra: nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, dst := r.response(tc.req, tc.src)
+			assert.Equal(t, tc.wantDst, dst)
+
+			if tc.wantAns == nil {
+				assert.Nil(t, resp)
+
+				return
+			}
+
+			require.NotNil(t, resp)
+
+			assert.Equal(t, tc.wantAns, names(resp.Answer))
+			assert.Equal(t, tc.wantExtra, names(resp.Extra))
+		})
+	}
+
+	t.Run("legacy", func(t *testing.T) {
+		req := (&dns.Msg{}).SetQuestion(testHost, dns.TypeA)
+
+		resp, _ := r.response(req, legacySrc)
+		require.NotNil(t, resp)
+		require.Len(t, resp.Answer, 1)
+
+		assert.Equal(t, req.Id, resp.Id)
+		assert.Equal(t, req.Question, resp.Question)
+
+		hdr := resp.Answer[0].Header()
+		assert.Equal(t, uint16(dns.ClassINET), hdr.Class)
+		assert.Equal(t, uint32(legacyTTL), hdr.Ttl)
+
+		// Make sure the records of the responder aren't modified.
+		resp, _ = r.response(req, mdnsSrc)
+		require.NotNil(t, resp)
+		require.Len(t, resp.Answer, 1)
+
+		hdr = resp.Answer[0].Header()
+		assert.Equal(t, uint16(dns.ClassINET|classTopBit), hdr.Class)
+		assert.Equal(t, uint32(hostTTL), hdr.Ttl)
+	})
+
+	t.Run("unicast_requested", func(t *testing.T) {
+		req := (&dns.Msg{}).SetQuestion(testHost, dns.TypeA)
+		req.Question[0].Qclass |= classTopBit
+
+		resp, dst := r.response(req, mdnsSrc)
+		require.NotNil(t, resp)
+
+		assert.Equal(t, mdnsSrc, dst)
+	})
+
+	t.Run("known_answer", func(t *testing.T) {
+		req := (&dns.Msg{}).SetQuestion(testHTTPType, dns.TypePTR)
+		req.Answer = []dns.RR{&dns.PTR{
+			Hdr: dns.RR_Header{
+				Name:   testHTTPType,
+				Rrtype: dns.TypePTR,
+				Class:  dns.ClassINET,
+				Ttl:    otherTTL,
+			},
+			Ptr: testHTTPInst,
+		}}
+
+		resp, _ := r.response(req, mdnsSrc)
+		assert.Nil(t, resp)
+	})
+}
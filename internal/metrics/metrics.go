@@ -0,0 +1,219 @@
+// Package metrics contains the primitives for exposing the metrics in the
+// Prometheus text-based exposition format and pushing them to other monitoring
+// systems.
+//
+// See https://prometheus.io/docs/instrumenting/exposition_formats.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text-based exposition
+// format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Type is the type of a metric.
+type Type string
+
+// Metric types.
+const (
+	TypeCounter Type = "counter"
+	TypeGauge   Type = "gauge"
+)
+
+// overflowLabel is the value of all labels of the series counting the events,
+// which don't fit into the series limit of a [CounterVec].
+const overflowLabel = "other"
+
+// CounterVec is a set of counters with the same name partitioned by the values
+// of labels.  It's safe for concurrent use.
+type CounterVec struct {
+	// mu protects values.
+	mu *sync.Mutex
+
+	// values are the counters by the joined label values.
+	values map[string]uint64
+
+	// name is the name of the metric.
+	name string
+
+	// help is the description of the metric.
+	help string
+
+	// labels are the names of the labels.
+	labels []string
+
+	// maxSeries is the maximum number of the series.  Zero means no limit.
+	maxSeries int
+}
+
+// labelSep separates the label values in the keys of [CounterVec.values].  It
+// can't appear in a valid UTF-8 string.
+const labelSep = "\xff"
+
+// NewCounterVec returns a new *CounterVec with the given labels.  Once
+// maxSeries different series are counted, the events for the new ones are
+// counted in the series with all labels set to "other".  Zero maxSeries means
+// no limit.
+func NewCounterVec(name, help string, maxSeries int, labels ...string) (c *CounterVec) {
+	return &CounterVec{
+		mu:        &sync.Mutex{},
+		values:    map[string]uint64{},
+		name:      name,
+		help:      help,
+		labels:    labels,
+		maxSeries: maxSeries,
+	}
+}
+
+// Inc increments the counter with the label values vals.  The number of vals
+// must be equal to the number of labels.
+func (c *CounterVec) Inc(vals ...string) {
+	key := strings.Join(vals, labelSep)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; !ok && c.maxSeries > 0 && len(c.values) >= c.maxSeries {
+		other := make([]string, len(c.labels))
+		for i := range other {
+			other[i] = overflowLabel
+		}
+
+		key = strings.Join(other, labelSep)
+	}
+
+	c.values[key]++
+}
+
+// Value returns the counter with the label values vals.  The number of vals
+// must be equal to the number of labels.
+func (c *CounterVec) Value(vals ...string) (n uint64) {
+	key := strings.Join(vals, labelSep)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[key]
+}
+
+// Values returns the counters of a single-label vector by the label value.
+// It must only be called on the vectors with exactly one label.
+func (c *CounterVec) Values() (vals map[string]uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return maps.Clone(c.values)
+}
+
+// Reset removes all the series.
+func (c *CounterVec) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.values)
+}
+
+// Write writes the metric to w.
+func (c *CounterVec) Write(w io.Writer) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err = WriteHeader(w, c.name, c.help, TypeCounter)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		var vals []string
+		if len(c.labels) > 0 {
+			vals = strings.Split(k, labelSep)
+		}
+
+		err = WriteSample(w, c.name, c.labels, vals, float64(c.values[k]))
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteHeader writes the HELP and the TYPE lines of the metric to w.
+func WriteHeader(w io.Writer, name, help string, typ Type) (err error) {
+	_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+
+	return err
+}
+
+// WriteSample writes a single sample of the metric to w.  vals are the values of
+// labels, and their numbers must be equal.
+func WriteSample(w io.Writer, name string, labels, vals []string, v float64) (err error) {
+	b := &strings.Builder{}
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			b.WriteString(l)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(vals[i]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	b.WriteByte('\n')
+
+	_, err = io.WriteString(w, b.String())
+
+	return err
+}
+
+// WriteGauge writes the metric of the gauge type with a single unlabeled
+// sample to w.
+func WriteGauge(w io.Writer, name, help string, v float64) (err error) {
+	err = WriteHeader(w, name, help, TypeGauge)
+	if err != nil {
+		return err
+	}
+
+	return WriteSample(w, name, nil, nil, v)
+}
+
+// helpReplacer escapes the special characters in the HELP lines.
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// escapeHelp returns the help text escaped for the HELP line.
+func escapeHelp(s string) (escaped string) {
+	return helpReplacer.Replace(s)
+}
+
+// labelReplacer escapes the special characters in the label values.
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// escapeLabel returns the label value escaped for the sample line.
+func escapeLabel(s string) (escaped string) {
+	return labelReplacer.Replace(s)
+}
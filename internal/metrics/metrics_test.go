@@ -0,0 +1,64 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := metrics.NewCounterVec("test_total", "Test counter.", 2, "a", "b")
+
+	c.Inc("1", "x")
+	c.Inc("1", "x")
+	c.Inc("2", `q"\`)
+
+	// Exceeds the limit.
+	c.Inc("3", "z")
+
+	buf := &bytes.Buffer{}
+	err := c.Write(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{a="1",b="x"} 2
+test_total{a="2",b="q\"\\"} 1
+test_total{a="other",b="other"} 1
+`, buf.String())
+
+	assert.Equal(t, uint64(2), c.Value("1", "x"))
+	assert.Equal(t, uint64(0), c.Value("1", "y"))
+
+	c.Reset()
+	buf.Reset()
+
+	err = c.Write(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "# HELP test_total Test counter.\n# TYPE test_total counter\n", buf.String())
+}
+
+func TestCounterVec_Values(t *testing.T) {
+	c := metrics.NewCounterVec("test_total", "Test counter.", 0, "a")
+
+	c.Inc("1")
+	c.Inc("1")
+	c.Inc("2")
+
+	assert.Equal(t, map[string]uint64{"1": 2, "2": 1}, c.Values())
+}
+
+func TestWriteGauge(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := metrics.WriteGauge(buf, "test_gauge", "Multi\nline.", 1.5)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP test_gauge Multi\nline.
+# TYPE test_gauge gauge
+test_gauge 1.5
+`, buf.String())
+}
@@ -0,0 +1,471 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// PushFormat is the format of the metrics pushed to a monitoring system.
+type PushFormat string
+
+// Supported push formats.
+const (
+	// PushFormatInfluxDB is the line protocol of the InfluxDB v2 write HTTP
+	// API.
+	PushFormatInfluxDB PushFormat = "influxdb"
+
+	// PushFormatStatsD is the StatsD protocol over UDP with the tags in the
+	// DogStatsD format.
+	PushFormatStatsD PushFormat = "statsd"
+
+	// PushFormatGraphite is the Graphite plaintext protocol over TCP with the
+	// tags in the Graphite format.
+	PushFormatGraphite PushFormat = "graphite"
+)
+
+// PushConfig is the configuration of a [Pusher].
+type PushConfig struct {
+	// Gather writes the metrics in the Prometheus text-based exposition format
+	// to w.  It must not be nil.
+	Gather func(w io.Writer) (err error)
+
+	// HTTPClient is used to push the metrics in the [PushFormatInfluxDB]
+	// format.  It must not be nil if Format is [PushFormatInfluxDB].
+	HTTPClient *http.Client
+
+	// URL is the base URL of the InfluxDB server for [PushFormatInfluxDB], and
+	// the udp:// or tcp:// URL with the host and the port of the server for
+	// [PushFormatStatsD] and [PushFormatGraphite] respectively.
+	URL *url.URL
+
+	// Format is the format of the pushed metrics.
+	Format PushFormat
+
+	// Token is the API token of InfluxDB.
+	Token string
+
+	// Org is the organization of InfluxDB.
+	Org string
+
+	// Bucket is the bucket of InfluxDB.
+	Bucket string
+
+	// Interval is the interval between the pushes.  It must be positive.
+	Interval time.Duration
+}
+
+// Pusher periodically pushes the metrics to a monitoring system.
+type Pusher struct {
+	conf *PushConfig
+
+	// done is closed when the pusher is closed.
+	done chan struct{}
+}
+
+// NewPusher returns a new properly initialized *Pusher.  conf must not be nil.
+func NewPusher(conf *PushConfig) (p *Pusher, err error) {
+	if conf.Interval <= 0 {
+		return nil, fmt.Errorf("interval: must be positive, got %s", conf.Interval)
+	} else if conf.URL == nil {
+		return nil, errors.Error("url: no value")
+	}
+
+	var wantScheme string
+	switch conf.Format {
+	case PushFormatInfluxDB:
+		if conf.Bucket == "" {
+			return nil, errors.Error("bucket: empty value")
+		}
+	case PushFormatStatsD:
+		wantScheme = "udp"
+	case PushFormatGraphite:
+		wantScheme = "tcp"
+	default:
+		return nil, fmt.Errorf("format: unsupported value %q", conf.Format)
+	}
+
+	if wantScheme != "" && conf.URL.Scheme != wantScheme {
+		return nil, fmt.Errorf("url: scheme must be %q for %s", wantScheme, conf.Format)
+	}
+
+	return &Pusher{
+		conf: conf,
+		done: make(chan struct{}),
+	}, nil
+}
+
+// Start starts pushing the metrics in a separate goroutine.
+func (p *Pusher) Start() {
+	go p.loop()
+}
+
+// Close stops pushing the metrics.  It must only be called once.
+func (p *Pusher) Close() {
+	close(p.done)
+}
+
+// loop pushes the metrics each interval until p is closed.
+func (p *Pusher) loop() {
+	defer log.OnPanic("metrics: pusher")
+
+	t := time.NewTicker(p.conf.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-t.C:
+			err := p.push(now)
+			if err != nil {
+				log.Error("metrics: pushing to %s: %s", p.conf.Format, err)
+			}
+		}
+	}
+}
+
+// push gathers the metrics and pushes them as of now.
+func (p *Pusher) push(now time.Time) (err error) {
+	buf := &bytes.Buffer{}
+	err = p.conf.Gather(buf)
+	if err != nil {
+		return fmt.Errorf("gathering: %w", err)
+	}
+
+	samples, err := parseSamples(buf)
+	if err != nil {
+		return fmt.Errorf("parsing: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.conf.Interval)
+	defer cancel()
+
+	switch p.conf.Format {
+	case PushFormatInfluxDB:
+		return p.pushInfluxDB(ctx, samples, now)
+	case PushFormatStatsD:
+		return p.pushStatsD(ctx, samples)
+	default:
+		return p.pushGraphite(ctx, samples, now)
+	}
+}
+
+// pushInfluxDB pushes samples to the InfluxDB v2 write HTTP API.
+func (p *Pusher) pushInfluxDB(ctx context.Context, samples []*sample, now time.Time) (err error) {
+	u := p.conf.URL.JoinPath("api", "v2", "write")
+	u.RawQuery = url.Values{
+		"org":       {p.conf.Org},
+		"bucket":    {p.conf.Bucket},
+		"precision": {"s"},
+	}.Encode()
+
+	body := &bytes.Buffer{}
+	writeInfluxDB(body, samples, now)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set(httphdr.ContentType, "text/plain; charset=utf-8")
+	if p.conf.Token != "" {
+		req.Header.Set(httphdr.Authorization, "Token "+p.conf.Token)
+	}
+
+	resp, err := p.conf.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// maxStatsDPacketSize is the maximum size of a StatsD UDP packet, which fits
+// into the common Ethernet MTU.
+const maxStatsDPacketSize = 1432
+
+// pushStatsD pushes samples to the StatsD server over UDP.
+func (p *Pusher) pushStatsD(ctx context.Context, samples []*sample) (err error) {
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, "udp", p.conf.URL.Host)
+	if err != nil {
+		return fmt.Errorf("dialing: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	for _, pkt := range statsDPackets(samples, maxStatsDPacketSize) {
+		_, err = conn.Write(pkt)
+		if err != nil {
+			return fmt.Errorf("writing packet: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// pushGraphite pushes samples to the Graphite server over TCP.
+func (p *Pusher) pushGraphite(ctx context.Context, samples []*sample, now time.Time) (err error) {
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", p.conf.URL.Host)
+	if err != nil {
+		return fmt.Errorf("dialing: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, conn.Close()) }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetWriteDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	w := bufio.NewWriter(conn)
+	writeGraphite(w, samples, now)
+
+	return errors.Annotate(w.Flush(), "writing: %w")
+}
+
+// label is a single label of a sample.
+type label struct {
+	name  string
+	value string
+}
+
+// sample is a single sample of a metric.
+type sample struct {
+	name   string
+	labels []label
+	value  float64
+}
+
+// parseSamples parses the samples from r in the Prometheus text-based
+// exposition format, as written by [WriteSample].  The comments are skipped.
+func parseSamples(r io.Reader) (samples []*sample, err error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		var s *sample
+		s, err = parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+
+		samples = append(samples, s)
+	}
+
+	return samples, sc.Err()
+}
+
+// parseSample parses a single sample line.
+func parseSample(line string) (s *sample, err error) {
+	s = &sample{}
+
+	i := strings.IndexAny(line, "{ ")
+	if i <= 0 {
+		return nil, errors.Error("no metric name")
+	}
+
+	s.name, line = line[:i], line[i:]
+	if line[0] == '{' {
+		s.labels, line, err = parseLabels(line[1:])
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+	}
+
+	s.value, err = strconv.ParseFloat(strings.TrimSpace(line), 64)
+	if err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+
+	return s, nil
+}
+
+// parseLabels parses the labels from s up to and including the closing brace
+// and returns the rest of s.
+func parseLabels(s string) (labels []label, rest string, err error) {
+	for {
+		if s == "" {
+			return nil, "", errors.Error("unterminated labels")
+		} else if s[0] == '}' {
+			return labels, s[1:], nil
+		} else if s[0] == ',' {
+			s = s[1:]
+		}
+
+		i := strings.Index(s, `="`)
+		if i <= 0 {
+			return nil, "", errors.Error("bad label")
+		}
+
+		l := label{name: s[:i]}
+		l.value, s, err = parseLabelValue(s[i+2:])
+		if err != nil {
+			return nil, "", fmt.Errorf("label %q: %w", l.name, err)
+		}
+
+		labels = append(labels, l)
+	}
+}
+
+// parseLabelValue parses the escaped label value from s up to and including the
+// closing quote and returns the rest of s.
+func parseLabelValue(s string) (val, rest string, err error) {
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", errors.Error("bad escape")
+			}
+
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", "", errors.Error("unterminated value")
+}
+
+// influxReplacer escapes the special characters in the measurements, the tag
+// keys, and the tag values of the InfluxDB line protocol.
+var influxReplacer = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+
+// writeInfluxDB writes samples to w in the InfluxDB line protocol with the
+// precision of seconds.
+func writeInfluxDB(w io.Writer, samples []*sample, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	for _, s := range samples {
+		b := &strings.Builder{}
+		b.WriteString(influxReplacer.Replace(s.name))
+		for _, l := range s.labels {
+			if l.value == "" {
+				// InfluxDB doesn't accept empty tag values.
+				continue
+			}
+
+			b.WriteByte(',')
+			b.WriteString(influxReplacer.Replace(l.name))
+			b.WriteByte('=')
+			b.WriteString(influxReplacer.Replace(l.value))
+		}
+
+		b.WriteString(" value=")
+		b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		b.WriteByte('\n')
+
+		_, _ = io.WriteString(w, b.String())
+	}
+}
+
+// statsDReplacer replaces the special characters of the StatsD protocol.
+var statsDReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_", "\n", "_")
+
+// statsDPackets returns samples in the StatsD protocol split into packets of at
+// most maxSize bytes.  The counters are sent as gauges, since they are
+// cumulative.
+func statsDPackets(samples []*sample, maxSize int) (pkts [][]byte) {
+	buf := &bytes.Buffer{}
+	for _, s := range samples {
+		b := &strings.Builder{}
+		b.WriteString(statsDReplacer.Replace(s.name))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		b.WriteString("|g")
+		sep := "|#"
+		for _, l := range s.labels {
+			if l.value == "" {
+				continue
+			}
+
+			b.WriteString(sep)
+			sep = ","
+
+			b.WriteString(statsDReplacer.Replace(l.name))
+			b.WriteByte(':')
+			b.WriteString(statsDReplacer.Replace(l.value))
+		}
+
+		line := b.String()
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxSize {
+			pkts = append(pkts, bytes.Clone(buf.Bytes()))
+			buf.Reset()
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+
+		buf.WriteString(line)
+	}
+
+	if buf.Len() > 0 {
+		pkts = append(pkts, buf.Bytes())
+	}
+
+	return pkts
+}
+
+// graphiteReplacer replaces the special characters of the Graphite tags.
+var graphiteReplacer = strings.NewReplacer(";", "_", "~", "_", " ", "_", "\n", "_")
+
+// writeGraphite writes samples to w in the Graphite plaintext protocol.
+func writeGraphite(w io.Writer, samples []*sample, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	for _, s := range samples {
+		b := &strings.Builder{}
+		b.WriteString(graphiteReplacer.Replace(s.name))
+		for _, l := range s.labels {
+			if l.value == "" {
+				// Graphite doesn't accept empty tag values.
+				continue
+			}
+
+			b.WriteByte(';')
+			b.WriteString(graphiteReplacer.Replace(l.name))
+			b.WriteByte('=')
+			b.WriteString(graphiteReplacer.Replace(l.value))
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(ts)
+		b.WriteByte('\n')
+
+		_, _ = io.WriteString(w, b.String())
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMetrics are the metrics used in the tests.
+const testMetrics = `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{client="192.0.2.1",upstream="q \"a\",b"} 2
+test_total{client="",upstream="x"} 1
+go_goroutines 10
+`
+
+func TestParseSamples(t *testing.T) {
+	samples, err := parseSamples(strings.NewReader(testMetrics))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*sample{{
+		name: "test_total",
+		labels: []label{
+			{name: "client", value: "192.0.2.1"},
+			{name: "upstream", value: `q "a",b`},
+		},
+		value: 2,
+	}, {
+		name: "test_total",
+		labels: []label{
+			{name: "client", value: ""},
+			{name: "upstream", value: "x"},
+		},
+		value: 1,
+	}, {
+		name:  "go_goroutines",
+		value: 10,
+	}}, samples)
+
+	testCases := []struct {
+		name       string
+		in         string
+		wantErrMsg string
+	}{{
+		name:       "no_name",
+		in:         "{a=\"b\"} 1\n",
+		wantErrMsg: `line "{a=\"b\"} 1": no metric name`,
+	}, {
+		name:       "unterminated",
+		in:         "test{a=\"b\n",
+		wantErrMsg: `line "test{a=\"b": label "a": unterminated value`,
+	}, {
+		name: "bad_value",
+		in:   "test abc\n",
+		wantErrMsg: `line "test abc": value: strconv.ParseFloat: ` +
+			`parsing "abc": invalid syntax`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err = parseSamples(strings.NewReader(tc.in))
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestWritePushFormats(t *testing.T) {
+	samples, err := parseSamples(strings.NewReader(testMetrics))
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_000, 0)
+
+	t.Run("influxdb", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		writeInfluxDB(buf, samples, now)
+
+		assert.Equal(t, `test_total,client=192.0.2.1,upstream=q\ "a"\,b value=2 1700000000
+test_total,upstream=x value=1 1700000000
+go_goroutines value=10 1700000000
+`, buf.String())
+	})
+
+	t.Run("graphite", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		writeGraphite(buf, samples, now)
+
+		assert.Equal(t, `test_total;client=192.0.2.1;upstream=q_"a",b 2 1700000000
+test_total;upstream=x 1 1700000000
+go_goroutines 10 1700000000
+`, buf.String())
+	})
+
+	t.Run("statsd", func(t *testing.T) {
+		pkts := statsDPackets(samples, 40)
+		require.Len(t, pkts, 3)
+
+		assert.Equal(t, `test_total:2|g|#client:192.0.2.1,upstream:q "a"_b`, string(pkts[0]))
+		assert.Equal(t, "test_total:1|g|#upstream:x", string(pkts[1]))
+		assert.Equal(t, "go_goroutines:10|g", string(pkts[2]))
+
+		pkts = statsDPackets(samples, maxStatsDPacketSize)
+		require.Len(t, pkts, 1)
+	})
+}
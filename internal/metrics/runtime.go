@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+// WriteRuntime writes the Go runtime and the process metrics to w.  start is
+// the time the process has started at.
+func WriteRuntime(w io.Writer, start time.Time) (err error) {
+	ms := &runtime.MemStats{}
+	runtime.ReadMemStats(ms)
+
+	for _, g := range []struct {
+		name string
+		help string
+		val  float64
+	}{{
+		name: "go_goroutines",
+		help: "Number of goroutines that currently exist.",
+		val:  float64(runtime.NumGoroutine()),
+	}, {
+		name: "go_memstats_alloc_bytes",
+		help: "Number of bytes allocated and still in use.",
+		val:  float64(ms.Alloc),
+	}, {
+		name: "go_memstats_heap_inuse_bytes",
+		help: "Number of heap bytes that are in use.",
+		val:  float64(ms.HeapInuse),
+	}, {
+		name: "go_memstats_sys_bytes",
+		help: "Number of bytes obtained from system.",
+		val:  float64(ms.Sys),
+	}, {
+		name: "process_start_time_seconds",
+		help: "Start time of the process since unix epoch in seconds.",
+		val:  float64(start.Unix()),
+	}, {
+		name: "process_uptime_seconds",
+		help: "Time elapsed since the process has started in seconds.",
+		val:  time.Since(start).Seconds(),
+	}} {
+		err = WriteGauge(w, g.name, g.help, g.val)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,492 @@
+// Package mqtt implements a minimal MQTT 3.1.1 client, which only supports the
+// QoS 0 publishing and subscriptions.
+//
+// See https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/mqtt-v3.1.1.html.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Packet types.
+const (
+	typeConnect     byte = 1
+	typeConnAck     byte = 2
+	typePublish     byte = 3
+	typePubAck      byte = 4
+	typeSubscribe   byte = 8
+	typeSubAck      byte = 9
+	typePingReq     byte = 12
+	typePingResp    byte = 13
+	typeDisconnect  byte = 14
+	protocolLevel   byte = 4
+	protocolName         = "MQTT"
+	maxRemainingLen      = 1 << 20
+	writeTimeout         = 10 * time.Second
+)
+
+// Flags of the CONNECT packet.
+const (
+	flagCleanSession byte = 0x02
+	flagWill         byte = 0x04
+	flagWillRetain   byte = 0x20
+	flagPassword     byte = 0x40
+	flagUsername     byte = 0x80
+)
+
+// Config is the configuration of a [Client].
+type Config struct {
+	// TLSConfig, if not nil, makes the client connect over TLS.
+	TLSConfig *tls.Config
+
+	// Will, if not nil, is published by the broker when the client disconnects
+	// unexpectedly.
+	Will *Message
+
+	// Addr is the address of the broker in the host:port form.
+	Addr string
+
+	// ClientID is the identifier of the client.  It must not be empty.
+	ClientID string
+
+	// Username is the name of the user.  If empty, no credentials are sent.
+	Username string
+
+	// Password is the password of the user.
+	Password string
+
+	// KeepAlive is the interval between the keep-alive pings.  It must be
+	// positive and less than 18 hours.
+	KeepAlive time.Duration
+}
+
+// Message is an application message.
+type Message struct {
+	// Topic is the topic of the message.
+	Topic string
+
+	// Payload is the contents of the message.
+	Payload []byte
+
+	// Retain, if true, makes the broker keep the message for the future
+	// subscribers.
+	Retain bool
+}
+
+// Handler handles the messages received on the subscribed topics.
+type Handler func(msg *Message)
+
+// Client is a connection to an MQTT broker.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// writeMu protects the writes to conn.
+	writeMu *sync.Mutex
+
+	// done is closed when the client is closed.
+	done chan struct{}
+
+	// closeOnce makes Close idempotent.
+	closeOnce *sync.Once
+
+	keepAlive time.Duration
+
+	// packetID is the identifier of the last SUBSCRIBE packet.  It's only
+	// accessed under writeMu.
+	packetID uint16
+}
+
+// ConnectError is returned when the broker refuses the connection.
+type ConnectError struct {
+	// Code is the return code of the CONNACK packet.
+	Code byte
+}
+
+// type check
+var _ error = (*ConnectError)(nil)
+
+// Error implements the error interface for *ConnectError.
+func (err *ConnectError) Error() (msg string) {
+	switch err.Code {
+	case 1:
+		msg = "unacceptable protocol version"
+	case 2:
+		msg = "identifier rejected"
+	case 3:
+		msg = "server unavailable"
+	case 4:
+		msg = "bad user name or password"
+	case 5:
+		msg = "not authorized"
+	default:
+		msg = "unknown error"
+	}
+
+	return fmt.Sprintf("connection refused: code %d: %s", err.Code, msg)
+}
+
+// Connect connects to the broker and returns the connected client.  conf must
+// be valid.
+func Connect(ctx context.Context, conf *Config) (c *Client, err error) {
+	var conn net.Conn
+	if conf.TLSConfig != nil {
+		d := &tls.Dialer{Config: conf.TLSConfig}
+		conn, err = d.DialContext(ctx, "tcp", conf.Addr)
+	} else {
+		d := &net.Dialer{}
+		conn, err = d.DialContext(ctx, "tcp", conf.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dialing: %w", err)
+	}
+
+	c = &Client{
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		writeMu:   &sync.Mutex{},
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		keepAlive: conf.KeepAlive,
+	}
+
+	err = c.handshake(ctx, conf)
+	if err != nil {
+		return nil, errors.WithDeferred(err, conn.Close())
+	}
+
+	return c, nil
+}
+
+// handshake sends the CONNECT packet and reads the CONNACK one.
+func (c *Client) handshake(ctx context.Context, conf *Config) (err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		err = c.conn.SetDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("setting deadline: %w", err)
+		}
+
+		defer func() { err = errors.WithDeferred(err, c.conn.SetDeadline(time.Time{})) }()
+	}
+
+	err = c.write(typeConnect<<4, connectBody(conf))
+	if err != nil {
+		return fmt.Errorf("sending connect: %w", err)
+	}
+
+	typ, body, err := c.read()
+	if err != nil {
+		return fmt.Errorf("reading connack: %w", err)
+	} else if typ>>4 != typeConnAck || len(body) != 2 {
+		return fmt.Errorf("unexpected packet of type %d instead of connack", typ>>4)
+	} else if body[1] != 0 {
+		return &ConnectError{Code: body[1]}
+	}
+
+	return nil
+}
+
+// connectBody returns the variable header and the payload of the CONNECT
+// packet.
+func connectBody(conf *Config) (b []byte) {
+	flags := flagCleanSession
+	b = appendString(nil, protocolName)
+	b = append(b, protocolLevel, 0)
+
+	flagsIdx := len(b) - 1
+	b = binary.BigEndian.AppendUint16(b, uint16(conf.KeepAlive/time.Second))
+	b = appendString(b, conf.ClientID)
+
+	if w := conf.Will; w != nil {
+		flags |= flagWill
+		if w.Retain {
+			flags |= flagWillRetain
+		}
+
+		b = appendString(b, w.Topic)
+		b = appendBytes(b, w.Payload)
+	}
+
+	if conf.Username != "" {
+		flags |= flagUsername | flagPassword
+		b = appendString(b, conf.Username)
+		b = appendString(b, conf.Password)
+	}
+
+	b[flagsIdx] = flags
+
+	return b
+}
+
+// Publish sends msg with QoS 0.
+func (c *Client) Publish(msg *Message) (err error) {
+	var flags byte
+	if msg.Retain {
+		flags = 0x01
+	}
+
+	body := appendString(nil, msg.Topic)
+	body = append(body, msg.Payload...)
+
+	return c.write(typePublish<<4|flags, body)
+}
+
+// Subscribe subscribes to the topic filters with QoS 0.  The messages are
+// passed to the handler of [Client.Serve].
+func (c *Client) Subscribe(filters ...string) (err error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+
+	body := binary.BigEndian.AppendUint16(nil, c.packetID)
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0)
+	}
+
+	return c.writeLocked(typeSubscribe<<4|0x02, body)
+}
+
+// Serve reads the packets from the broker and passes the messages to h until
+// the connection fails or c is closed.  It also sends the keep-alive pings.  It
+// returns nil if c has been closed.
+func (c *Client) Serve(h Handler) (err error) {
+	go c.ping()
+
+	for {
+		var typ byte
+		var body []byte
+		typ, body, err = c.read()
+		if err != nil {
+			select {
+			case <-c.done:
+				return nil
+			default:
+				return fmt.Errorf("reading: %w", err)
+			}
+		}
+
+		err = c.handle(typ, body, h)
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+	}
+}
+
+// handle processes a single incoming packet.
+func (c *Client) handle(typ byte, body []byte, h Handler) (err error) {
+	switch typ >> 4 {
+	case typePublish:
+		var msg *Message
+		var id uint16
+		msg, id, err = parsePublish(typ, body)
+		if err != nil {
+			return fmt.Errorf("parsing publish: %w", err)
+		}
+
+		if id != 0 {
+			err = c.write(typePubAck<<4, binary.BigEndian.AppendUint16(nil, id))
+			if err != nil {
+				return fmt.Errorf("sending puback: %w", err)
+			}
+		}
+
+		h(msg)
+	case typeSubAck, typePingResp:
+		// Nothing to do.
+	default:
+		return fmt.Errorf("unexpected packet of type %d", typ>>4)
+	}
+
+	return nil
+}
+
+// parsePublish parses the PUBLISH packet.  id is the packet identifier, which
+// is zero for QoS 0.
+func parsePublish(typ byte, body []byte) (msg *Message, id uint16, err error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("topic: %w", err)
+	}
+
+	if qos := (typ >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+
+	return &Message{
+		Topic:   topic,
+		Payload: rest,
+		Retain:  typ&0x01 != 0,
+	}, id, nil
+}
+
+// ping sends the keep-alive pings until c is closed.
+func (c *Client) ping() {
+	t := time.NewTicker(c.keepAlive)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			// The read loop notices the broken connection.
+			_ = c.write(typePingReq<<4, nil)
+		}
+	}
+}
+
+// Close disconnects from the broker.  It's safe for concurrent use and may be
+// called several times.
+func (c *Client) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		// Don't care about the error, since the connection is closed anyway.
+		_ = c.write(typeDisconnect<<4, nil)
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+// write sends a packet with the first byte of the fixed header hdr and body.
+func (c *Client) write(hdr byte, body []byte) (err error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.writeLocked(hdr, body)
+}
+
+// writeLocked is like [Client.write] but c.writeMu is expected to be locked.
+func (c *Client) writeLocked(hdr byte, body []byte) (err error) {
+	if len(body) > maxRemainingLen {
+		return fmt.Errorf("packet is too large: %d bytes", len(body))
+	}
+
+	pkt := append([]byte{hdr}, appendRemainingLen(nil, len(body))...)
+	pkt = append(pkt, body...)
+
+	// Don't let a stalled broker block the writers forever.
+	err = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err != nil {
+		return fmt.Errorf("setting write deadline: %w", err)
+	}
+
+	_, err = c.conn.Write(pkt)
+
+	return err
+}
+
+// read reads a single packet and returns the first byte of its fixed header
+// and its body.
+func (c *Client) read() (hdr byte, body []byte, err error) {
+	hdr, err = c.r.ReadByte()
+	if err != nil {
+		// Don't wrap the error since the callers do.
+		return 0, nil, err
+	}
+
+	n, err := readRemainingLen(c.r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("remaining length: %w", err)
+	}
+
+	body = make([]byte, n)
+	_, err = io.ReadFull(c.r, body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("body: %w", err)
+	}
+
+	return hdr, body, nil
+}
+
+// appendRemainingLen appends the variable-length encoding of n to b.
+func appendRemainingLen(b []byte, n int) (res []byte) {
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// readRemainingLen reads the variable-length encoded remaining length.
+func readRemainingLen(r io.ByteReader) (n int, err error) {
+	mul := 1
+	for i := 0; i < 4; i++ {
+		var d byte
+		d, err = r.ReadByte()
+		if err != nil {
+			// Don't wrap the error since the caller does.
+			return 0, err
+		}
+
+		n += int(d&0x7f) * mul
+		if d&0x80 == 0 {
+			if n > maxRemainingLen {
+				return 0, fmt.Errorf("packet is too large: %d bytes", n)
+			}
+
+			return n, nil
+		}
+
+		mul *= 128
+	}
+
+	return 0, errors.Error("malformed remaining length")
+}
+
+// appendString appends the length-prefixed s to b.
+func appendString(b []byte, s string) (res []byte) {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+
+	return append(b, s...)
+}
+
+// appendBytes appends the length-prefixed data to b.
+func appendBytes(b, data []byte) (res []byte) {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+
+	return append(b, data...)
+}
+
+// readString reads a length-prefixed string from b.
+func readString(b []byte) (s string, rest []byte, err error) {
+	if len(b) < 2 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < n {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+
+	return string(b[:n]), b[n:], nil
+}
@@ -0,0 +1,199 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testPacket is a packet read by the fake broker.
+type testPacket struct {
+	body []byte
+	hdr  byte
+}
+
+// newTestBroker starts a fake broker accepting a single connection.  It
+// answers CONNECT with connAckCode, sends the packets from out, and sends the
+// received packets to the returned channel.
+func newTestBroker(t *testing.T, connAckCode byte, out [][]byte) (addr string, in chan testPacket) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, l.Close)
+
+	in = make(chan testPacket, 16)
+	go func() {
+		defer close(in)
+
+		conn, aErr := l.Accept()
+		if aErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		c := &Client{conn: conn, r: bufio.NewReader(conn)}
+		hdr, body, rErr := c.read()
+		if rErr != nil {
+			return
+		}
+
+		in <- testPacket{hdr: hdr, body: body}
+
+		_, _ = conn.Write([]byte{typeConnAck << 4, 2, 0, connAckCode})
+		for _, pkt := range out {
+			_, _ = conn.Write(pkt)
+		}
+
+		for {
+			hdr, body, rErr = c.read()
+			if rErr != nil {
+				return
+			}
+
+			in <- testPacket{hdr: hdr, body: body}
+		}
+	}()
+
+	return l.Addr().String(), in
+}
+
+// receive returns the next packet from in.
+func receive(t *testing.T, in chan testPacket) (pkt testPacket) {
+	t.Helper()
+
+	select {
+	case pkt = <-in:
+		return pkt
+	case <-time.After(testTimeout):
+		t.Fatal("no packet received")
+
+		return pkt
+	}
+}
+
+func TestClient(t *testing.T) {
+	incoming := []byte{typePublish << 4, 0, 0, 9}
+	incoming = append(incoming, "cmd/power"...)
+	incoming = append(incoming, "ON"...)
+	incoming[1] = byte(len(incoming) - 2)
+
+	addr, in := newTestBroker(t, 0, [][]byte{incoming})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	c, err := Connect(ctx, &Config{
+		Will:      &Message{Topic: "avail", Payload: []byte("offline"), Retain: true},
+		Addr:      addr,
+		ClientID:  "test",
+		Username:  "user",
+		Password:  "pass",
+		KeepAlive: time.Minute,
+	})
+	require.NoError(t, err)
+
+	connect := receive(t, in)
+	assert.Equal(t, typeConnect<<4, connect.hdr)
+
+	wantConnect := []byte{0, 4, 'M', 'Q', 'T', 'T', 4, 0xe6, 0, 60}
+	wantConnect = appendString(wantConnect, "test")
+	wantConnect = appendString(wantConnect, "avail")
+	wantConnect = appendString(wantConnect, "offline")
+	wantConnect = appendString(wantConnect, "user")
+	wantConnect = appendString(wantConnect, "pass")
+	assert.Equal(t, wantConnect, connect.body)
+
+	msgs := make(chan *Message, 1)
+	served := make(chan error, 1)
+	go func() { served <- c.Serve(func(msg *Message) { msgs <- msg }) }()
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, &Message{Topic: "cmd/power", Payload: []byte("ON")}, msg)
+	case <-time.After(testTimeout):
+		t.Fatal("no message received")
+	}
+
+	require.NoError(t, c.Subscribe("cmd/#"))
+
+	sub := receive(t, in)
+	assert.Equal(t, typeSubscribe<<4|0x02, sub.hdr)
+	assert.Equal(t, append([]byte{0, 1, 0, 5}, "cmd/#\x00"...), sub.body)
+
+	require.NoError(t, c.Publish(&Message{Topic: "state", Payload: []byte("1"), Retain: true}))
+
+	pub := receive(t, in)
+	assert.Equal(t, typePublish<<4|0x01, pub.hdr)
+	assert.Equal(t, append([]byte{0, 5}, "state1"...), pub.body)
+
+	require.NoError(t, c.Close())
+	assert.Equal(t, typeDisconnect<<4, receive(t, in).hdr)
+
+	select {
+	case err = <-served:
+		assert.NoError(t, err)
+	case <-time.After(testTimeout):
+		t.Fatal("serve has not returned")
+	}
+}
+
+func TestConnect_refused(t *testing.T) {
+	addr, _ := newTestBroker(t, 5, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	_, err := Connect(ctx, &Config{
+		Addr:      addr,
+		ClientID:  "test",
+		KeepAlive: time.Minute,
+	})
+	testutil.AssertErrorMsg(t, "connection refused: code 5: not authorized", err)
+}
+
+func TestRemainingLen(t *testing.T) {
+	testCases := []struct {
+		name string
+		want []byte
+		n    int
+	}{{
+		name: "zero",
+		want: []byte{0},
+		n:    0,
+	}, {
+		name: "one_byte",
+		want: []byte{0x7f},
+		n:    127,
+	}, {
+		name: "two_bytes",
+		want: []byte{0x80, 0x01},
+		n:    128,
+	}, {
+		name: "three_bytes",
+		want: []byte{0x80, 0x80, 0x01},
+		n:    16384,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := appendRemainingLen(nil, tc.n)
+			assert.Equal(t, tc.want, b)
+
+			n, err := readRemainingLen(bytes.NewReader(b))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.n, n)
+		})
+	}
+}
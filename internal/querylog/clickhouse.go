@@ -0,0 +1,155 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+)
+
+// clickHouseSchema is the schema of the ClickHouse table.  The table name is
+// substituted with fmt.
+const clickHouseSchema = `CREATE TABLE IF NOT EXISTS %s (
+	time DateTime64(3),
+	client String,
+	client_id String,
+	client_proto LowCardinality(String),
+	question_name String,
+	question_type LowCardinality(String),
+	question_class LowCardinality(String),
+	reason LowCardinality(String),
+	rules String,
+	service_name LowCardinality(String),
+	upstream LowCardinality(String),
+	elapsed_ms Float64,
+	cached Bool
+) ENGINE = MergeTree ORDER BY time`
+
+// clickHouseMaxErrBodyLen is the maximum length of the error response body
+// read from ClickHouse.
+const clickHouseMaxErrBodyLen = 1024
+
+// clickHouseBackend is a [storageBackend] writing to ClickHouse through its
+// HTTP interface.
+type clickHouseBackend struct {
+	client *http.Client
+
+	// url is the URL of the HTTP interface without the credentials.
+	url *url.URL
+
+	user     string
+	password string
+	table    string
+
+	// created is true if the table has been created.  It's only accessed by
+	// insert, which isn't called concurrently.
+	created bool
+}
+
+// newClickHouseBackend returns a new *clickHouseBackend.  u must not be nil.
+func newClickHouseBackend(u *url.URL, table string) (b *clickHouseBackend) {
+	b = &clickHouseBackend{
+		client: &http.Client{
+			Timeout: storageWriteTimeout,
+		},
+		table: table,
+	}
+
+	if u.User != nil {
+		b.user = u.User.Username()
+		b.password, _ = u.User.Password()
+	}
+
+	b.url = &url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     u.Path,
+		RawQuery: u.RawQuery,
+	}
+
+	return b
+}
+
+// type check
+var _ storageBackend = (*clickHouseBackend)(nil)
+
+// insert implements the [storageBackend] interface for *clickHouseBackend.
+func (b *clickHouseBackend) insert(ctx context.Context, rows []*storageRow) (err error) {
+	if !b.created {
+		err = b.exec(ctx, fmt.Sprintf(clickHouseSchema, b.table), nil)
+		if err != nil {
+			return fmt.Errorf("creating table: %w", err)
+		}
+
+		b.created = true
+	}
+
+	body := &bytes.Buffer{}
+	enc := json.NewEncoder(body)
+	for _, r := range rows {
+		err = enc.Encode(r)
+		if err != nil {
+			return fmt.Errorf("encoding row: %w", err)
+		}
+	}
+
+	return b.exec(ctx, fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", b.table), body)
+}
+
+// exec sends query with the data in body to ClickHouse.  body may be nil.
+func (b *clickHouseBackend) exec(ctx context.Context, query string, body io.Reader) (err error) {
+	u := *b.url
+	q := u.Query()
+	q.Set("query", query)
+	// Parse the RFC 3339 timestamps.
+	q.Set("date_time_input_format", "best_effort")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	if b.user != "" {
+		req.Header.Set("X-ClickHouse-User", b.user)
+		req.Header.Set("X-ClickHouse-Key", b.password)
+	}
+
+	if body != nil {
+		req.Header.Set(httphdr.ContentType, "application/x-ndjson")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode == http.StatusOK {
+		_, err = io.Copy(io.Discard, resp.Body)
+
+		return err
+	}
+
+	msg, err := io.ReadAll(io.LimitReader(resp.Body, clickHouseMaxErrBodyLen))
+	if err != nil {
+		return fmt.Errorf("reading error response: %w", err)
+	}
+
+	return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// close implements the [storageBackend] interface for *clickHouseBackend.
+func (b *clickHouseBackend) close() (err error) {
+	b.client.CloseIdleConnections()
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
@@ -156,23 +157,57 @@ var logEntryHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
-	"Elapsed": func(t json.Token, ent *logEntry) error {
+	"UG": func(t json.Token, ent *logEntry) error {
+		v, ok := t.(string)
+		if !ok {
+			return nil
+		}
+
+		ent.UpstreamGroup = UpstreamGroup(v)
+
+		return nil
+	},
+	"Elapsed": durationDecoder(func(ent *logEntry) *time.Duration { return &ent.Elapsed }),
+	"CE":      durationDecoder(func(ent *logEntry) *time.Duration { return &ent.CacheElapsed }),
+	"FE":      durationDecoder(func(ent *logEntry) *time.Duration { return &ent.FilteringElapsed }),
+	"UE":      durationDecoder(func(ent *logEntry) *time.Duration { return &ent.UpstreamElapsed }),
+	"SR": func(t json.Token, ent *logEntry) error {
 		v, ok := t.(json.Number)
 		if !ok {
 			return nil
 		}
 
-		i, err := v.Int64()
+		i, err := strconv.ParseUint(string(v), 10, 0)
 		if err != nil {
 			return err
 		}
 
-		ent.Elapsed = time.Duration(i)
+		ent.SampleRate = uint(i)
 
 		return nil
 	},
 }
 
+// durationDecoder returns a handler decoding the duration field of logEntry
+// returned by field.
+func durationDecoder(field func(ent *logEntry) (d *time.Duration)) (h logEntryHandler) {
+	return func(t json.Token, ent *logEntry) (err error) {
+		v, ok := t.(json.Number)
+		if !ok {
+			return nil
+		}
+
+		i, err := v.Int64()
+		if err != nil {
+			return err
+		}
+
+		*field(ent) = time.Duration(i)
+
+		return nil
+	}
+}
+
 // decodeResultRuleKey decodes the token of "Rules" type to logEntry struct.
 func decodeResultRuleKey(key string, i int, dec *json.Decoder, ent *logEntry) {
 	var vToken json.Token
@@ -624,6 +659,26 @@ var resultHandlers = map[string]logEntryHandler{
 
 		return nil
 	},
+	"ThreatCategory": func(t json.Token, ent *logEntry) error {
+		s, ok := t.(string)
+		if !ok {
+			return nil
+		}
+
+		ent.Result.ThreatCategory = filtering.ThreatCategory(s)
+
+		return nil
+	},
+	"SettingsLevel": func(t json.Token, ent *logEntry) error {
+		s, ok := t.(string)
+		if !ok {
+			return nil
+		}
+
+		ent.Result.SettingsLevel = filtering.SettingsLevel(s)
+
+		return nil
+	},
 	"CanonName": func(t json.Token, ent *logEntry) error {
 		s, ok := t.(string)
 		if !ok {
@@ -48,7 +48,11 @@ func TestDecodeLogEntry(t *testing.T) {
 			`"ServiceName":"example.org",` +
 			`"DNSRewriteResult":{"RCode":0,"Response":{"1":["127.0.0.2"]}}},` +
 			`"Upstream":"https://some.upstream",` +
-			`"Elapsed":837429}`
+			`"UG":"fallback",` +
+			`"Elapsed":837429,` +
+			`"FE":1000,` +
+			`"UE":800000,` +
+			`"SR":10}`
 
 		ans, err := base64.StdEncoding.DecodeString(ansStr)
 		require.NoError(t, err)
@@ -87,7 +91,11 @@ func TestDecodeLogEntry(t *testing.T) {
 				IsFiltered: true,
 			},
 			Upstream:          "https://some.upstream",
+			UpstreamGroup:     UpstreamGroupFallback,
 			Elapsed:           837429,
+			FilteringElapsed:  1000,
+			UpstreamElapsed:   800000,
+			SampleRate:        10,
 			AuthenticatedData: true,
 		}
 
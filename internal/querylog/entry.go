@@ -26,7 +26,8 @@ type logEntry struct {
 	ClientID    string      `json:"CID,omitempty"`
 	ClientProto ClientProto `json:"CP"`
 
-	Upstream string `json:",omitempty"`
+	Upstream      string        `json:",omitempty"`
+	UpstreamGroup UpstreamGroup `json:"UG,omitempty"`
 
 	Answer     []byte `json:",omitempty"`
 	OrigAnswer []byte `json:",omitempty"`
@@ -38,6 +39,16 @@ type logEntry struct {
 
 	Elapsed time.Duration
 
+	// CacheElapsed, FilteringElapsed, and UpstreamElapsed are the parts of
+	// Elapsed spent in the corresponding phases of processing.
+	CacheElapsed     time.Duration `json:"CE,omitempty"`
+	FilteringElapsed time.Duration `json:"FE,omitempty"`
+	UpstreamElapsed  time.Duration `json:"UE,omitempty"`
+
+	// SampleRate is the sampling rate in effect when the entry was written, if
+	// the entry has been sampled.  The entry represents SampleRate queries.
+	SampleRate uint `json:"SR,omitempty"`
+
 	Cached            bool `json:",omitempty"`
 	AuthenticatedData bool `json:"AD,omitempty"`
 }
@@ -0,0 +1,397 @@
+package querylog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Supported export formats.
+const (
+	exportFormatCSV   = "csv"
+	exportFormatJSONL = "jsonl"
+)
+
+// Supported export columns.
+const (
+	exportColTime        = "time"
+	exportColClient      = "client"
+	exportColClientID    = "client_id"
+	exportColClientName  = "client_name"
+	exportColClientProto = "client_proto"
+	exportColName        = "question_name"
+	exportColType        = "question_type"
+	exportColClass       = "question_class"
+	exportColReason      = "reason"
+	exportColRules       = "rules"
+	exportColServiceName = "service_name"
+	exportColUpstream    = "upstream"
+	exportColUpsGroup    = "upstream_group"
+	exportColUpsProto    = "upstream_transport"
+	exportColElapsedMs   = "elapsed_ms"
+	exportColCacheMs     = "cache_elapsed_ms"
+	exportColFilteringMs = "filtering_elapsed_ms"
+	exportColUpstreamMs  = "upstream_elapsed_ms"
+	exportColCached      = "cached"
+	exportColSampleRate  = "sample_rate"
+)
+
+// exportColumns are the columns supported by the query log export in their
+// default order.
+var exportColumns = []string{
+	exportColTime,
+	exportColClient,
+	exportColClientID,
+	exportColClientName,
+	exportColClientProto,
+	exportColName,
+	exportColType,
+	exportColClass,
+	exportColReason,
+	exportColRules,
+	exportColServiceName,
+	exportColUpstream,
+	exportColUpsGroup,
+	exportColUpsProto,
+	exportColElapsedMs,
+	exportColCacheMs,
+	exportColFilteringMs,
+	exportColUpstreamMs,
+	exportColCached,
+	exportColSampleRate,
+}
+
+// parseExportColumns parses the comma-separated list of columns.  It returns
+// all supported columns if s is empty.
+func parseExportColumns(s string) (cols []string, err error) {
+	if s == "" {
+		return exportColumns, nil
+	}
+
+	cols = strings.Split(s, ",")
+	for _, c := range cols {
+		if !slices.Contains(exportColumns, c) {
+			return nil, fmt.Errorf("unsupported column %q", c)
+		}
+	}
+
+	return cols, nil
+}
+
+// exportValue returns the value of column col for e.  entIP is the client's IP
+// address, anonymized if necessary.
+func exportValue(e *logEntry, entIP string, anonymized bool, col string) (v any) {
+	switch col {
+	case exportColTime:
+		return e.Time.Format(time.RFC3339Nano)
+	case exportColClient:
+		return entIP
+	case exportColClientID:
+		return e.ClientID
+	case exportColClientName:
+		if e.client == nil || anonymized {
+			return ""
+		}
+
+		return e.client.Name
+	case exportColClientProto:
+		return string(e.ClientProto)
+	case exportColName:
+		return e.QHost
+	case exportColType:
+		return e.QType
+	case exportColClass:
+		return e.QClass
+	case exportColReason:
+		return e.Result.Reason.String()
+	case exportColRules:
+		texts := make([]string, 0, len(e.Result.Rules))
+		for _, r := range e.Result.Rules {
+			texts = append(texts, r.Text)
+		}
+
+		return strings.Join(texts, "; ")
+	case exportColServiceName:
+		return e.Result.ServiceName
+	case exportColUpstream:
+		return e.Upstream
+	case exportColUpsGroup:
+		return string(e.UpstreamGroup)
+	case exportColUpsProto:
+		return upstreamTransport(e.Upstream)
+	case exportColElapsedMs:
+		return e.Elapsed.Seconds() * 1000
+	case exportColCacheMs:
+		return e.CacheElapsed.Seconds() * 1000
+	case exportColFilteringMs:
+		return e.FilteringElapsed.Seconds() * 1000
+	case exportColUpstreamMs:
+		return e.UpstreamElapsed.Seconds() * 1000
+	case exportColCached:
+		return e.Cached
+	case exportColSampleRate:
+		// Entries that haven't been sampled represent a single query.
+		return max(e.SampleRate, 1)
+	default:
+		// Shouldn't happen, since the columns are validated.
+		panic(fmt.Errorf("unexpected column %q", col))
+	}
+}
+
+// entryExporter writes log entries in a particular format.
+type entryExporter interface {
+	// writeEntry writes a single log entry.
+	writeEntry(e *logEntry) (err error)
+
+	// flush writes any buffered data.
+	flush() (err error)
+}
+
+// exporterBase contains the data common for the exporters.
+type exporterBase struct {
+	anonFunc aghnet.IPMutFunc
+	cols     []string
+}
+
+// values returns the values of the columns for e.
+func (b *exporterBase) values(e *logEntry) (vals []any) {
+	entIP := slices.Clone(e.IP)
+	b.anonFunc(entIP)
+
+	ipStr, anonymized := entIP.String(), !entIP.Equal(e.IP)
+
+	vals = make([]any, 0, len(b.cols))
+	for _, col := range b.cols {
+		vals = append(vals, exportValue(e, ipStr, anonymized, col))
+	}
+
+	return vals
+}
+
+// csvExporter is an [entryExporter] writing CSV.
+type csvExporter struct {
+	exporterBase
+
+	w *csv.Writer
+
+	// record is reused between the entries.
+	record []string
+}
+
+// type check
+var _ entryExporter = (*csvExporter)(nil)
+
+// writeEntry implements the [entryExporter] interface for *csvExporter.
+func (x *csvExporter) writeEntry(e *logEntry) (err error) {
+	x.record = x.record[:0]
+	for _, v := range x.values(e) {
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case uint:
+			s = strconv.FormatUint(uint64(v), 10)
+		case bool:
+			s = strconv.FormatBool(v)
+		}
+
+		x.record = append(x.record, s)
+	}
+
+	return x.w.Write(x.record)
+}
+
+// flush implements the [entryExporter] interface for *csvExporter.
+func (x *csvExporter) flush() (err error) {
+	x.w.Flush()
+
+	return x.w.Error()
+}
+
+// jsonlExporter is an [entryExporter] writing JSON Lines.
+type jsonlExporter struct {
+	exporterBase
+
+	enc *json.Encoder
+}
+
+// type check
+var _ entryExporter = (*jsonlExporter)(nil)
+
+// writeEntry implements the [entryExporter] interface for *jsonlExporter.
+func (x *jsonlExporter) writeEntry(e *logEntry) (err error) {
+	obj := make(jobject, len(x.cols))
+	for i, v := range x.values(e) {
+		obj[x.cols[i]] = v
+	}
+
+	// Encoder adds the newline itself.
+	return x.enc.Encode(obj)
+}
+
+// flush implements the [entryExporter] interface for *jsonlExporter.
+func (x *jsonlExporter) flush() (err error) {
+	return nil
+}
+
+// newEntryExporter returns a new exporter for format writing to w.  It writes
+// the CSV header, if necessary.
+func newEntryExporter(
+	w io.Writer,
+	format string,
+	cols []string,
+	anonFunc aghnet.IPMutFunc,
+) (x entryExporter, err error) {
+	base := exporterBase{
+		anonFunc: anonFunc,
+		cols:     cols,
+	}
+
+	switch format {
+	case exportFormatCSV:
+		cw := csv.NewWriter(w)
+
+		err = cw.Write(cols)
+		if err != nil {
+			return nil, fmt.Errorf("writing csv header: %w", err)
+		}
+
+		return &csvExporter{
+			exporterBase: base,
+			w:            cw,
+			record:       make([]string, 0, len(cols)),
+		}, nil
+	case exportFormatJSONL:
+		return &jsonlExporter{
+			exporterBase: base,
+			enc:          json.NewEncoder(w),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// handleQueryLogExport is the handler for the GET /control/querylog/export
+// HTTP API.
+func (l *queryLog) handleQueryLogExport(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSearchParams(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	q := r.URL.Query()
+	cols, err := parseExportColumns(q.Get("columns"))
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "columns: %s", err)
+
+		return
+	}
+
+	format := q.Get("format")
+	var contentType string
+	switch format {
+	case exportFormatCSV:
+		contentType = "text/csv"
+	case exportFormatJSONL:
+		contentType = "application/jsonl"
+	default:
+		aghhttp.Error(r, w, http.StatusBadRequest, "format: unsupported value %q", format)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, contentType)
+	h.Set(httphdr.ContentDisposition, fmt.Sprintf(`attachment; filename="querylog.%s"`, format))
+
+	x, err := newEntryExporter(w, format, cols, l.anonymizer.Load())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "%s", err)
+
+		return
+	}
+
+	err = l.export(params, x)
+	if err != nil {
+		log.Debug("querylog: export: %s", err)
+	}
+}
+
+// export writes all entries matching params to x, from newer to older,
+// ignoring the limit and the offset.  l.confMu is only locked to take the
+// entries from the memory buffer and the ignored hosts, since writing to a slow
+// client may take long.
+func (l *queryLog) export(params *searchParams, x entryExporter) (err error) {
+	cache := clientCache{}
+
+	var memEntries []*logEntry
+	var ignored *aghnet.IgnoreEngine
+	func() {
+		l.confMu.RLock()
+		defer l.confMu.RUnlock()
+
+		memEntries, _ = l.searchMemory(params, cache)
+		ignored = l.conf.Ignored
+	}()
+
+	for _, e := range memEntries {
+		err = x.writeEntry(e)
+		if err != nil {
+			return fmt.Errorf("writing memory entry: %w", err)
+		}
+	}
+
+	r, err := l.setQLogReader(params.olderThan)
+	if err != nil {
+		log.Error("querylog: export: %s", err)
+	}
+
+	if r == nil {
+		return x.flush()
+	}
+
+	defer func() {
+		if closeErr := r.Close(); closeErr != nil {
+			log.Error("querylog: closing file: %s", closeErr)
+		}
+	}()
+
+	for {
+		e, _, rErr := l.readNextEntry(r, params, cache, ignored)
+		if rErr == io.EOF {
+			break
+		} else if rErr != nil {
+			// Stop on the first read error, since it's most probably
+			// persistent, and the export isn't limited by the number of the
+			// scanned entries.
+			return errors.WithDeferred(fmt.Errorf("reading file entry: %w", rErr), x.flush())
+		}
+
+		if e == nil {
+			continue
+		}
+
+		err = x.writeEntry(e)
+		if err != nil {
+			return fmt.Errorf("writing file entry: %w", err)
+		}
+	}
+
+	return x.flush()
+}
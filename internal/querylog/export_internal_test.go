@@ -0,0 +1,99 @@
+package querylog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noopAnonymizer is an [aghnet.IPMutFunc] that doesn't modify the IP address.
+func noopAnonymizer(_ net.IP) {}
+
+func TestQueryLog_export(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	// Add disk entries.
+	addEntry(l, "example.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer())
+
+	// Add memory entries.
+	addEntry(l, "example.com", net.IPv4(1, 1, 1, 2), net.IPv4(2, 2, 2, 2))
+	addEntry(l, "test.example.org", net.IPv4(1, 1, 1, 3), net.IPv4(2, 2, 2, 3))
+
+	cols := []string{exportColName, exportColClient, exportColRules, exportColCached}
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		x, xErr := newEntryExporter(buf, exportFormatCSV, cols, noopAnonymizer)
+		require.NoError(t, xErr)
+
+		require.NoError(t, l.export(newSearchParams(), x))
+
+		records, rErr := csv.NewReader(buf).ReadAll()
+		require.NoError(t, rErr)
+
+		assert.Equal(t, [][]string{
+			cols,
+			{"test.example.org", "2.2.2.3", "SomeRule", "false"},
+			{"example.com", "2.2.2.2", "SomeRule", "false"},
+			{"example.org", "2.2.2.1", "SomeRule", "false"},
+		}, records)
+	})
+
+	t.Run("jsonl_search", func(t *testing.T) {
+		params := newSearchParams()
+		params.searchCriteria = []searchCriterion{{
+			criterionType: ctTerm,
+			value:         "example.org",
+		}}
+
+		buf := &bytes.Buffer{}
+		x, xErr := newEntryExporter(buf, exportFormatJSONL, cols, noopAnonymizer)
+		require.NoError(t, xErr)
+
+		require.NoError(t, l.export(params, x))
+
+		var hosts []string
+		s := bufio.NewScanner(buf)
+		for s.Scan() {
+			obj := map[string]any{}
+			require.NoError(t, json.Unmarshal(s.Bytes(), &obj))
+			require.Len(t, obj, len(cols))
+
+			hosts = append(hosts, obj[exportColName].(string))
+		}
+
+		require.NoError(t, s.Err())
+
+		assert.Equal(t, []string{"test.example.org", "example.org"}, hosts)
+	})
+}
+
+func TestParseExportColumns(t *testing.T) {
+	cols, err := parseExportColumns("")
+	require.NoError(t, err)
+
+	assert.Equal(t, exportColumns, cols)
+
+	cols, err = parseExportColumns("time,question_name")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{exportColTime, exportColName}, cols)
+
+	_, err = parseExportColumns("time,bad")
+	assert.EqualError(t, err, `unsupported column "bad"`)
+}
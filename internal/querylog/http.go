@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
@@ -15,8 +16,11 @@ import (
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
 	"golang.org/x/net/idna"
 )
 
@@ -44,6 +48,14 @@ type getConfigResp struct {
 	// Interval is the querylog rotation interval in milliseconds.
 	Interval float64 `json:"interval"`
 
+	// MaxSize is the maximum total size of the log files in bytes.  Zero means
+	// no limit.  It's a pointer to keep the current value when it's not set.
+	MaxSize *uint64 `json:"max_size,omitempty"`
+
+	// SampleRate is the sampling rate of the queries that aren't filtered.
+	// It's a pointer to keep the current value when it's not set.
+	SampleRate *uint `json:"sample_rate,omitempty"`
+
 	// Enabled shows if the querylog is enabled.  It is an aghalg.NullBool to
 	// be able to tell when it's set without using pointers.
 	Enabled aghalg.NullBool `json:"enabled"`
@@ -61,6 +73,9 @@ func (l *queryLog) initWeb() {
 	l.conf.HTTPRegister(http.MethodGet, "/control/querylog", l.handleQueryLog)
 	l.conf.HTTPRegister(http.MethodPost, "/control/querylog_clear", l.handleQueryLogClear)
 	l.conf.HTTPRegister(http.MethodGet, "/control/querylog/config", l.handleGetQueryLogConfig)
+	l.conf.HTTPRegister(http.MethodGet, "/control/querylog/export", l.handleQueryLogExport)
+	l.conf.HTTPRegister(http.MethodGet, "/control/querylog/stream", l.handleQueryLogStream)
+	l.conf.HTTPRegister(http.MethodGet, "/control/querylog/rollup", l.handleQueryLogRollup)
 	l.conf.HTTPRegister(
 		http.MethodPut,
 		"/control/querylog/config/update",
@@ -132,8 +147,11 @@ func (l *queryLog) handleGetQueryLogConfig(w http.ResponseWriter, r *http.Reques
 		l.confMu.RLock()
 		defer l.confMu.RUnlock()
 
+		maxSize, sampleRate := l.conf.MaxSize, l.conf.SampleRate
 		resp = &getConfigResp{
 			Interval:          float64(l.conf.RotationIvl.Milliseconds()),
+			MaxSize:           &maxSize,
+			SampleRate:        &sampleRate,
 			Enabled:           aghalg.BoolToNullBool(l.conf.Enabled),
 			AnonymizeClientIP: aghalg.BoolToNullBool(l.conf.AnonymizeClientIP),
 			Ignored:           l.conf.Ignored.Values(),
@@ -257,6 +275,14 @@ func (l *queryLog) handlePutQueryLogConfig(w http.ResponseWriter, r *http.Reques
 
 	conf.Ignored = engine
 	conf.RotationIvl = ivl
+	if newConf.MaxSize != nil {
+		conf.MaxSize = *newConf.MaxSize
+	}
+
+	if newConf.SampleRate != nil {
+		conf.SampleRate = *newConf.SampleRate
+	}
+
 	conf.Enabled = newConf.Enabled == aghalg.NBTrue
 
 	conf.AnonymizeClientIP = newConf.AnonymizeClientIP == aghalg.NBTrue
@@ -290,9 +316,22 @@ func parseSearchCriterion(q url.Values, name string, ct criterionType) (
 		return false, sc, nil
 	}
 
+	negate := false
+	switch {
+	case strings.HasPrefix(val, `\!`):
+		// The escaped exclamation mark is a part of the value.
+		val = val[1:]
+	case val[0] == '!':
+		negate, val = true, val[1:]
+		if val == "" {
+			return false, sc, errors.Error("empty negated value")
+		}
+	}
+
 	strict := getDoubleQuotesEnclosedValue(&val)
 
 	var asciiVal string
+	var re *regexp.Regexp
 	switch ct {
 	case ctTerm:
 		// Decode lowercased value from punycode to make EqualFold and
@@ -311,24 +350,64 @@ func parseSearchCriterion(q url.Values, name string, ct criterionType) (
 		if !slices.Contains(filteringStatusValues, val) {
 			return false, sc, fmt.Errorf("invalid value %s", val)
 		}
+	case ctDomainRegexp:
+		re, err = regexp.Compile(val)
+		if err != nil {
+			return false, sc, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	case ctQuestionType:
+		if _, ok = dns.StringToType[strings.ToUpper(val)]; !ok {
+			return false, sc, fmt.Errorf("invalid %s %q", name, val)
+		}
+	case ctResponseCode:
+		if _, ok = dns.StringToRcode[strings.ToUpper(val)]; !ok {
+			return false, sc, fmt.Errorf("invalid %s %q", name, val)
+		}
+	case ctUpstream:
+		// Go on, any value is allowed.
+	case ctReason:
+		if !isValidReason(val) {
+			return false, sc, fmt.Errorf("invalid %s %q", name, val)
+		}
 	default:
 		return false, sc, fmt.Errorf(
 			"invalid criterion type %v: should be one of %v",
 			ct,
-			[]criterionType{ctTerm, ctFilteringStatus},
+			[]criterionType{
+				ctTerm,
+				ctFilteringStatus,
+				ctDomainRegexp,
+				ctQuestionType,
+				ctResponseCode,
+				ctUpstream,
+				ctReason,
+			},
 		)
 	}
 
 	sc = searchCriterion{
+		re:            re,
 		criterionType: ct,
 		value:         val,
 		asciiVal:      asciiVal,
 		strict:        strict,
+		negate:        negate,
 	}
 
 	return true, sc, nil
 }
 
+// isValidReason returns true if s is a name of a filtering reason.
+func isValidReason(s string) (ok bool) {
+	for r := filtering.Reason(0); r.String() != ""; r++ {
+		if strings.EqualFold(r.String(), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // parseSearchParams parses search parameters from the HTTP request's query
 // string.
 func parseSearchParams(r *http.Request) (p *searchParams, err error) {
@@ -366,6 +445,21 @@ func parseSearchParams(r *http.Request) (p *searchParams, err error) {
 	}, {
 		urlField: "response_status",
 		ct:       ctFilteringStatus,
+	}, {
+		urlField: "domain_regexp",
+		ct:       ctDomainRegexp,
+	}, {
+		urlField: "question_type",
+		ct:       ctQuestionType,
+	}, {
+		urlField: "response_code",
+		ct:       ctResponseCode,
+	}, {
+		urlField: "upstream",
+		ct:       ctUpstream,
+	}, {
+		urlField: "reason",
+		ct:       ctReason,
 	}} {
 		var ok bool
 		var c searchCriterion
@@ -58,6 +58,10 @@ func entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (jsonEntry jobject)
 		question["unicode_name"] = qhost
 	}
 
+	if regDomain := aghnet.RegistrableDomain(hostname); regDomain != hostname {
+		question["registrable_domain"] = regDomain
+	}
+
 	entIP := slices.Clone(entry.IP)
 	anonFunc(entIP)
 
@@ -85,6 +89,28 @@ func entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (jsonEntry jobject)
 		jsonEntry["ecs"] = entry.ReqECS
 	}
 
+	if entry.UpstreamGroup != "" {
+		jsonEntry["upstream_group"] = entry.UpstreamGroup
+	}
+
+	if t := upstreamTransport(entry.Upstream); t != "" {
+		jsonEntry["upstream_transport"] = t
+	}
+
+	for key, d := range map[string]time.Duration{
+		"cache_elapsed_ms":     entry.CacheElapsed,
+		"filtering_elapsed_ms": entry.FilteringElapsed,
+		"upstream_elapsed_ms":  entry.UpstreamElapsed,
+	} {
+		if d != 0 {
+			jsonEntry[key] = strconv.FormatFloat(d.Seconds()*1000, 'f', -1, 64)
+		}
+	}
+
+	if entry.SampleRate > 1 {
+		jsonEntry["sample_rate"] = entry.SampleRate
+	}
+
 	if len(entry.Result.Rules) > 0 {
 		if r := entry.Result.Rules[0]; len(r.Text) > 0 {
 			jsonEntry["rule"] = r.Text
@@ -96,6 +122,14 @@ func entryToJSON(entry *logEntry, anonFunc aghnet.IPMutFunc) (jsonEntry jobject)
 		jsonEntry["service_name"] = entry.Result.ServiceName
 	}
 
+	if entry.Result.ThreatCategory != "" {
+		jsonEntry["threat_category"] = entry.Result.ThreatCategory
+	}
+
+	if entry.Result.SettingsLevel != "" {
+		jsonEntry["settings_level"] = entry.Result.SettingsLevel
+	}
+
 	setMsgData(entry, jsonEntry)
 	setOrigAns(entry, jsonEntry)
 
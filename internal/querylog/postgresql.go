@@ -0,0 +1,167 @@
+package querylog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// postgreSQLSchema is the schema of the PostgreSQL table.  The table name is
+// substituted with fmt.
+const postgreSQLSchema = `CREATE TABLE IF NOT EXISTS %s (
+	time timestamptz NOT NULL,
+	client text NOT NULL,
+	client_id text NOT NULL,
+	client_proto text NOT NULL,
+	question_name text NOT NULL,
+	question_type text NOT NULL,
+	question_class text NOT NULL,
+	reason text NOT NULL,
+	rules text NOT NULL,
+	service_name text NOT NULL,
+	upstream text NOT NULL,
+	elapsed_ms double precision NOT NULL,
+	cached boolean NOT NULL
+)`
+
+// postgreSQLIndex is the index on the time column of the PostgreSQL table.  The
+// index name and the table name are substituted with fmt.
+const postgreSQLIndex = `CREATE INDEX IF NOT EXISTS %s_time_idx ON %s (time)`
+
+// postgreSQLColumns are the columns the rows are copied into.  Keep in sync
+// with [postgreSQLSchema] and [postgreSQLValues].
+var postgreSQLColumns = []string{
+	"time",
+	"client",
+	"client_id",
+	"client_proto",
+	"question_name",
+	"question_type",
+	"question_class",
+	"reason",
+	"rules",
+	"service_name",
+	"upstream",
+	"elapsed_ms",
+	"cached",
+}
+
+// postgreSQLCloseTimeout is the timeout for closing the connection gracefully.
+const postgreSQLCloseTimeout = 5 * time.Second
+
+// postgreSQLBackend is a [storageBackend] writing to PostgreSQL.  It's not
+// safe for concurrent use.
+type postgreSQLBackend struct {
+	// conn is the connection to the server.  It's nil if there is no
+	// established connection.
+	conn *pgx.Conn
+
+	url   *url.URL
+	table string
+
+	// created is true if the table has been created.
+	created bool
+}
+
+// newPostgreSQLBackend returns a new *postgreSQLBackend.  u must not be nil.
+func newPostgreSQLBackend(u *url.URL, table string) (b *postgreSQLBackend) {
+	return &postgreSQLBackend{
+		url:   u,
+		table: table,
+	}
+}
+
+// type check
+var _ storageBackend = (*postgreSQLBackend)(nil)
+
+// insert implements the [storageBackend] interface for *postgreSQLBackend.
+func (b *postgreSQLBackend) insert(ctx context.Context, rows []*storageRow) (err error) {
+	if b.conn == nil {
+		b.conn, err = pgx.Connect(ctx, b.url.String())
+		if err != nil {
+			return fmt.Errorf("connecting: %w", err)
+		}
+	}
+
+	defer func() {
+		if err != nil {
+			// Reconnect on the next batch, since the connection may be in an
+			// unknown state.
+			err = errors.WithDeferred(err, b.close())
+		}
+	}()
+
+	if !b.created {
+		idxName := strings.ReplaceAll(b.table, ".", "_")
+		_, err = b.conn.Exec(ctx, fmt.Sprintf(postgreSQLSchema, b.table))
+		if err != nil {
+			return fmt.Errorf("creating table: %w", err)
+		}
+
+		_, err = b.conn.Exec(ctx, fmt.Sprintf(postgreSQLIndex, idxName, b.table))
+		if err != nil {
+			return fmt.Errorf("creating index: %w", err)
+		}
+
+		b.created = true
+	}
+
+	_, err = b.conn.CopyFrom(
+		ctx,
+		pgx.Identifier(strings.Split(b.table, ".")),
+		postgreSQLColumns,
+		pgx.CopyFromSlice(len(rows), func(i int) (vals []any, err error) {
+			return postgreSQLValues(rows[i]), nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("copying rows: %w", err)
+	}
+
+	return nil
+}
+
+// postgreSQLValues returns the values of the columns for r.  NUL bytes aren't
+// allowed in PostgreSQL strings, so they are removed.
+func postgreSQLValues(r *storageRow) (vals []any) {
+	return []any{
+		r.Time.UTC(),
+		pgText(r.Client),
+		pgText(r.ClientID),
+		pgText(r.ClientProto),
+		pgText(r.Name),
+		pgText(r.Type),
+		pgText(r.Class),
+		pgText(r.Reason),
+		pgText(r.Rules),
+		pgText(r.ServiceName),
+		pgText(r.Upstream),
+		r.ElapsedMs,
+		r.Cached,
+	}
+}
+
+// pgText returns s without the NUL bytes.
+func pgText(s string) (res string) {
+	return strings.ReplaceAll(s, "\x00", "")
+}
+
+// close implements the [storageBackend] interface for *postgreSQLBackend.
+func (b *postgreSQLBackend) close() (err error) {
+	if b.conn == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgreSQLCloseTimeout)
+	defer cancel()
+
+	err = b.conn.Close(ctx)
+	b.conn = nil
+
+	return err
+}
@@ -0,0 +1,211 @@
+package querylog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// clientIDSet is the set of the IP addresses and the ClientIDs of the clients
+// which entries are purged.
+type clientIDSet map[string]struct{}
+
+// newClientIDSet returns a new set of ids.  The IP addresses are normalized to
+// match the ones written to the log.
+func newClientIDSet(ids []string) (set clientIDSet) {
+	set = make(clientIDSet, len(ids))
+	for _, id := range ids {
+		if ip, err := netip.ParseAddr(id); err == nil {
+			id = ip.Unmap().String()
+		}
+
+		set[id] = struct{}{}
+	}
+
+	return set
+}
+
+// has returns true if the entry with the client IP address ip and the ClientID
+// clientID belongs to the clients from set.
+func (set clientIDSet) has(ip, clientID string) (ok bool) {
+	if _, ok = set[ip]; ok {
+		return true
+	}
+
+	if clientID == "" {
+		return false
+	}
+
+	_, ok = set[clientID]
+
+	return ok
+}
+
+// PurgeClient implements the [QueryLog] interface for *queryLog.
+func (l *queryLog) PurgeClient(ids []string) (removed int, err error) {
+	set := newClientIDSet(ids)
+
+	// Make sure that no entries are being written to the file.
+	l.fileFlushLock.Lock()
+	defer l.fileFlushLock.Unlock()
+
+	removed = l.purgeMemory(set)
+
+	if l.rollups != nil {
+		l.rollups.purge(set)
+	}
+
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
+	oldFile, compressed := l.oldFiles()
+	for _, f := range []struct {
+		path       string
+		compressed bool
+	}{{
+		path:       compressed,
+		compressed: true,
+	}, {
+		path:       oldFile,
+		compressed: false,
+	}, {
+		path:       l.logFile,
+		compressed: false,
+	}} {
+		var n int
+		n, err = purgeFile(f.path, f.compressed, set)
+		removed += n
+		if err != nil {
+			return removed, fmt.Errorf("purging %q: %w", f.path, err)
+		}
+	}
+
+	err = l.removeDecompressedOldFile()
+	if err != nil {
+		return removed, fmt.Errorf("removing decompressed old file: %w", err)
+	}
+
+	log.Info("querylog: purged %d entries of clients %q", removed, ids)
+
+	return removed, nil
+}
+
+// purgeMemory removes the entries of the clients from set from the memory
+// buffer and returns the number of removed entries.
+func (l *queryLog) purgeMemory(set clientIDSet) (removed int) {
+	l.bufferLock.Lock()
+	defer l.bufferLock.Unlock()
+
+	var kept []*logEntry
+	l.buffer.Range(func(e *logEntry) (cont bool) {
+		if set.has(e.IP.String(), e.ClientID) {
+			removed++
+		} else {
+			kept = append(kept, e)
+		}
+
+		return true
+	})
+
+	if removed == 0 {
+		return 0
+	}
+
+	l.buffer.Clear()
+	for _, e := range kept {
+		l.buffer.Append(e)
+	}
+
+	return removed
+}
+
+// purgeFile rewrites the log file at path without the entries of the clients
+// from set and returns the number of removed entries.  It does nothing if the
+// file doesn't exist.  The file is replaced atomically.
+func purgeFile(path string, compressed bool, set clientIDSet) (removed int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		// Don't wrap the error since it's informative enough as is.
+		return 0, err
+	}
+
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	var r io.Reader = f
+	if compressed {
+		var zr io.ReadCloser
+		zr, err = newDecompressor(f)
+		if err != nil {
+			return 0, fmt.Errorf("decompressing: %w", err)
+		}
+
+		defer func() { err = errors.WithDeferred(err, zr.Close()) }()
+
+		r = zr
+	}
+
+	pf, err := aghrenameio.NewPendingFile(path, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("creating pending file: %w", err)
+	}
+
+	var w io.Writer = pf
+	var zw io.WriteCloser
+	if compressed {
+		zw, err = newCompressor(pf)
+		if err != nil {
+			return 0, errors.WithDeferred(fmt.Errorf("compressing: %w", err), pf.Cleanup())
+		}
+
+		w = zw
+	}
+
+	removed, err = copyUnmatched(w, r, set)
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+
+	if err != nil || removed == 0 {
+		// There is nothing to replace the file with.
+		return 0, errors.WithDeferred(err, pf.Cleanup())
+	}
+
+	return removed, pf.CloseReplace()
+}
+
+// copyUnmatched copies the lines of r, except for the ones containing the
+// entries of the clients from set, to w.  It returns the number of skipped
+// lines.
+func copyUnmatched(w io.Writer, r io.Reader, set clientIDSet) (skipped int, err error) {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	for {
+		var line string
+		line, err = br.ReadString('\n')
+		if line != "" {
+			if set.has(readJSONValue(line, `"IP":"`), readJSONValue(line, `"CID":"`)) {
+				skipped++
+			} else if _, wErr := bw.WriteString(line); wErr != nil {
+				return skipped, fmt.Errorf("writing: %w", wErr)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return skipped, fmt.Errorf("reading: %w", err)
+		}
+	}
+
+	return skipped, bw.Flush()
+}
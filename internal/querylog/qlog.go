@@ -3,8 +3,9 @@ package querylog
 
 import (
 	"fmt"
-	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghalg"
@@ -37,9 +38,41 @@ type queryLog struct {
 	// logFile is the path to the log file.
 	logFile string
 
+	// syslog writes the entries to syslog, if enabled.  It is nil if the
+	// syslog output is disabled.
+	syslog *syslogSink
+
+	// remote writes the entries to a remote storage, if configured.  It is nil
+	// if there is no remote storage.
+	remote *remoteStorage
+
+	// rollups maintains the pre-aggregated summaries of the queries.  It is
+	// nil if the summaries are disabled.
+	rollups *rollupStore
+
+	// stream distributes the new entries to the live stream subscribers.
+	stream *streamHub
+
+	// sampleCounter counts the queries subject to sampling.
+	sampleCounter atomic.Uint64
+
+	// done is closed when the query log is closed.
+	done chan struct{}
+
+	// closeOnce makes sure that the query log is only closed once.
+	closeOnce sync.Once
+
 	// bufferLock protects buffer.
 	bufferLock sync.RWMutex
 
+	// decompressMu protects the decompressed copy of the compressed rotated
+	// log file and decompressRefs.
+	decompressMu sync.Mutex
+
+	// decompressRefs is the number of the searches reading the decompressed
+	// copy of the compressed rotated log file.
+	decompressRefs int
+
 	// fileFlushLock synchronizes a file-flushing goroutine and main thread.
 	fileFlushLock sync.Mutex
 	fileWriteLock sync.Mutex
@@ -76,15 +109,100 @@ func NewClientProto(s string) (cp ClientProto, err error) {
 	}
 }
 
+// UpstreamGroup values are names of the groups of upstream DNS servers.
+type UpstreamGroup string
+
+// Upstream group names.
+const (
+	UpstreamGroupDefault  UpstreamGroup = "default"
+	UpstreamGroupClient   UpstreamGroup = "client"
+	UpstreamGroupPrivate  UpstreamGroup = "private"
+	UpstreamGroupFallback UpstreamGroup = "fallback"
+)
+
+// Upstream transport names.
+const (
+	upstreamTransportUDP      = "udp"
+	upstreamTransportTCP      = "tcp"
+	upstreamTransportDoT      = "dot"
+	upstreamTransportDoH      = "doh"
+	upstreamTransportDoQ      = "doq"
+	upstreamTransportDNSCrypt = "dnscrypt"
+)
+
+// upstreamTransport returns the name of the transport used by the upstream
+// with the address addr.  It returns an empty string if addr is empty.
+func upstreamTransport(addr string) (t string) {
+	if addr == "" {
+		return ""
+	}
+
+	scheme, _, ok := strings.Cut(addr, "://")
+	if !ok {
+		// Plain DNS addresses are written without the scheme.
+		return upstreamTransportUDP
+	}
+
+	switch scheme {
+	case "tcp":
+		return upstreamTransportTCP
+	case "tls":
+		return upstreamTransportDoT
+	case "https", "h3":
+		return upstreamTransportDoH
+	case "quic":
+		return upstreamTransportDoQ
+	case "sdns":
+		return upstreamTransportDNSCrypt
+	default:
+		return upstreamTransportUDP
+	}
+}
+
 func (l *queryLog) Start() {
 	if l.conf.HTTPRegister != nil {
 		l.initWeb()
 	}
 
 	go l.periodicRotate()
+
+	if ivl := l.conf.FlushInterval; ivl > 0 {
+		go l.periodicFlush(ivl)
+	}
+
+	if l.syslog != nil {
+		go l.syslog.run()
+	}
+
+	if l.remote != nil {
+		go l.remote.run()
+	}
 }
 
 func (l *queryLog) Close() {
+	l.closeOnce.Do(l.close)
+}
+
+// close stops the background tasks of the query log and writes the buffered
+// entries to the file.
+func (l *queryLog) close() {
+	close(l.done)
+
+	if l.syslog != nil {
+		l.syslog.close()
+	}
+
+	if l.remote != nil {
+		l.remote.close()
+	}
+
+	if l.rollups != nil {
+		err := l.rollups.close()
+		if err != nil {
+			log.Error("querylog: closing rollups: %s", err)
+		}
+	}
+
 	l.confMu.RLock()
 	defer l.confMu.RUnlock()
 
@@ -143,15 +261,20 @@ func (l *queryLog) clear() {
 		l.flushPending = false
 	}()
 
-	oldLogFile := l.logFile + ".1"
-	err := os.Remove(oldLogFile)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		log.Error("removing old log file %q: %s", oldLogFile, err)
+	oldLogFile, compressed := l.oldFiles()
+	decompressed := compressed + decompressedExt
+	for _, f := range []string{decompressed, compressed, oldLogFile, l.logFile} {
+		err := removeIfExists(f)
+		if err != nil {
+			log.Error("removing log file %q: %s", f, err)
+		}
 	}
 
-	err = os.Remove(l.logFile)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		log.Error("removing log file %q: %s", l.logFile, err)
+	if l.rollups != nil {
+		err := l.rollups.clear()
+		if err != nil {
+			log.Error("querylog: clearing rollups: %s", err)
+		}
 	}
 
 	log.Debug("querylog: cleared")
@@ -177,7 +300,12 @@ func newLogEntry(params *AddParams) (entry *logEntry) {
 
 		IP: params.ClientIP,
 
-		Elapsed: params.Elapsed,
+		UpstreamGroup: params.UpstreamGroup,
+
+		Elapsed:          params.Elapsed,
+		CacheElapsed:     params.CacheElapsed,
+		FilteringElapsed: params.FilteringElapsed,
+		UpstreamElapsed:  params.UpstreamElapsed,
 
 		Cached:            params.Cached,
 		AuthenticatedData: params.AuthenticatedData,
@@ -196,19 +324,30 @@ func newLogEntry(params *AddParams) (entry *logEntry) {
 // Add implements the [QueryLog] interface for *queryLog.
 func (l *queryLog) Add(params *AddParams) {
 	var isEnabled, fileIsEnabled bool
-	var memSize uint
+	var memSize, sampleRate uint
+	var maxSize uint64
 	func() {
 		l.confMu.RLock()
 		defer l.confMu.RUnlock()
 
 		isEnabled, fileIsEnabled = l.conf.Enabled, l.conf.FileEnabled
-		memSize = l.conf.MemSize
+		memSize, maxSize = l.conf.MemSize, l.conf.MaxSize
+		sampleRate = l.conf.SampleRate
 	}()
 
 	if !isEnabled {
 		return
 	}
 
+	select {
+	case <-l.done:
+		// Drop the entries added after closing, e.g. by the DNS server which
+		// keeps serving while handing over to a new process.
+		return
+	default:
+		// Go on.
+	}
+
 	err := params.validate()
 	if err != nil {
 		log.Error("querylog: adding record: %s, skipping", err)
@@ -220,7 +359,30 @@ func (l *queryLog) Add(params *AddParams) {
 		params.Result = &filtering.Result{}
 	}
 
+	// Count all queries in the summaries, including the ones not sampled.
+	if l.rollups != nil {
+		l.rollups.add(params, time.Now())
+	}
+
+	sampled := sampleRate > 1 && !params.Result.IsFiltered
+	if sampled && l.sampleCounter.Add(1)%uint64(sampleRate) != 0 {
+		return
+	}
+
 	entry := newLogEntry(params)
+	if sampled {
+		entry.SampleRate = sampleRate
+	}
+
+	if l.syslog != nil {
+		l.syslog.add(entry)
+	}
+
+	if l.remote != nil {
+		l.remote.add(entry)
+	}
+
+	l.stream.publish(entry)
 
 	l.bufferLock.Lock()
 	defer l.bufferLock.Unlock()
@@ -235,16 +397,30 @@ func (l *queryLog) Add(params *AddParams) {
 			flushErr := l.flushLogBuffer()
 			if flushErr != nil {
 				log.Error("querylog: flushing after adding: %s", flushErr)
+
+				return
+			}
+
+			if maxSize > 0 {
+				trimErr := l.trimToMaxSize(maxSize)
+				if trimErr != nil {
+					log.Error("querylog: trimming to max size: %s", trimErr)
+				}
 			}
 		}()
 	}
 }
 
-// ShouldLog returns true if request for the host should be logged.
+// ShouldLog returns true if request for the host should be logged.  It's
+// false if the query log is disabled.
 func (l *queryLog) ShouldLog(host string, _, _ uint16, ids []string) bool {
 	l.confMu.RLock()
 	defer l.confMu.RUnlock()
 
+	if !l.conf.Enabled {
+		return false
+	}
+
 	c, err := l.findClient(ids)
 	if err != nil {
 		log.Error("querylog: finding client: %s", err)
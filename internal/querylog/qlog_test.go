@@ -1,9 +1,12 @@
 package querylog
 
 import (
+	"bytes"
 	"fmt"
 	"net"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
@@ -254,6 +257,317 @@ func TestQueryLogFileDisabled(t *testing.T) {
 	assert.Equal(t, "example2.org", ll[1].QHost)
 }
 
+func TestQueryLog_Close(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	addEntry(l, "example1.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+
+	l.Close()
+	require.FileExists(t, l.logFile)
+
+	// The entries added after closing are dropped and closing again is a
+	// no-op.
+	addEntry(l, "example2.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	l.Close()
+
+	params := newSearchParams()
+	ll, _ := l.search(params)
+	require.Len(t, ll, 1)
+
+	assert.Equal(t, "example1.org", ll[0].QHost)
+}
+
+func TestQueryLog_flushBuffered(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:       true,
+		FileEnabled:   true,
+		RotationIvl:   timeutil.Day,
+		MemSize:       100,
+		FlushInterval: time.Minute,
+		BaseDir:       t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	// Nothing to flush.
+	l.flushBuffered()
+	assert.NoFileExists(t, l.logFile)
+
+	addEntry(l, "example.org", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	addEntry(l, "example.com", net.IPv4(1, 1, 1, 2), net.IPv4(2, 2, 2, 2))
+
+	l.flushBuffered()
+	assert.Zero(t, l.buffer.Len())
+
+	data, err := os.ReadFile(l.logFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")))
+}
+
+func TestQueryLog_trimToMaxSize(t *testing.T) {
+	const (
+		oldData = "old1\nold2\nold3\nold4\n"
+		curData = "cur1\ncur2\ncur3\ncur4\n"
+	)
+
+	testCases := []struct {
+		name    string
+		wantOld string
+		wantCur string
+		maxSize uint64
+	}{{
+		name:    "not_exceeded",
+		wantOld: oldData,
+		wantCur: curData,
+		maxSize: 40,
+	}, {
+		name:    "trim_old",
+		wantOld: "old4\n",
+		wantCur: curData,
+		maxSize: 30,
+	}, {
+		name:    "remove_old_trim_current",
+		wantOld: "",
+		wantCur: "cur4\n",
+		maxSize: 10,
+	}, {
+		name:    "remove_all",
+		wantOld: "",
+		wantCur: "",
+		maxSize: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := newQueryLog(Config{
+				Enabled:     true,
+				FileEnabled: true,
+				RotationIvl: timeutil.Day,
+				BaseDir:     t.TempDir(),
+			})
+			require.NoError(t, err)
+
+			oldFile := l.logFile + ".1"
+			require.NoError(t, os.WriteFile(oldFile, []byte(oldData), 0o644))
+			require.NoError(t, os.WriteFile(l.logFile, []byte(curData), 0o644))
+
+			require.NoError(t, l.trimToMaxSize(tc.maxSize))
+
+			for file, want := range map[string]string{
+				oldFile:   tc.wantOld,
+				l.logFile: tc.wantCur,
+			} {
+				data, rErr := os.ReadFile(file)
+				if want == "" {
+					assert.ErrorIs(t, rErr, os.ErrNotExist)
+				} else {
+					require.NoError(t, rErr)
+					assert.Equal(t, want, string(data))
+				}
+			}
+		})
+	}
+}
+
+func TestQueryLog_rotateCompressed(t *testing.T) {
+	dir := t.TempDir()
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		Compress:    true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     dir,
+	})
+	require.NoError(t, err)
+
+	addEntry(l, "old.example", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer())
+	require.NoError(t, l.rotate())
+
+	oldFile, compressed := l.oldFiles()
+	assert.NoFileExists(t, oldFile)
+	assert.FileExists(t, compressed)
+
+	addEntry(l, "new.example", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	require.NoError(t, l.flushLogBuffer())
+
+	entries, _ := l.search(newSearchParams())
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "new.example", entries[0].QHost)
+	assert.Equal(t, "old.example", entries[1].QHost)
+
+	// The decompressed copy is removed after the search.
+	decompressed := compressed + decompressedExt
+	assert.NoFileExists(t, decompressed)
+
+	r, err := l.setQLogReader(time.Time{})
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	// The decompressed copy is kept while it's being read.
+	assert.FileExists(t, decompressed)
+	require.NoError(t, r.Close())
+
+	dirEntries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		names = append(names, de.Name())
+	}
+
+	assert.ElementsMatch(t, []string{
+		queryLogFileName,
+		queryLogFileName + ".1.zst",
+	}, names)
+}
+
+func TestQueryLog_PurgeClient(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		FileEnabled: true,
+		Compress:    true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	purged, kept := net.IPv4(2, 2, 2, 1), net.IPv4(2, 2, 2, 2)
+	answer := net.IPv4(1, 1, 1, 1)
+
+	// Put the entries into the compressed file, the current file, and the
+	// memory buffer.
+	addEntry(l, "compressed.example", answer, purged)
+	addEntry(l, "compressed.example", answer, kept)
+	require.NoError(t, l.flushLogBuffer())
+	require.NoError(t, l.rotate())
+
+	addEntry(l, "file.example", answer, purged)
+	addEntry(l, "file.example", answer, kept)
+	require.NoError(t, l.flushLogBuffer())
+
+	addEntry(l, "memory.example", answer, purged)
+	addEntry(l, "memory.example", answer, kept)
+
+	removed, err := l.PurgeClient([]string{purged.String()})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, removed)
+
+	entries, _ := l.search(newSearchParams())
+	require.Len(t, entries, 3)
+
+	for _, e := range entries {
+		assert.Equal(t, kept.To4(), e.IP.To4())
+	}
+
+	removed, err = l.PurgeClient([]string{purged.String()})
+	require.NoError(t, err)
+
+	assert.Zero(t, removed)
+}
+
+func TestQueryLog_sampling(t *testing.T) {
+	const sampleRate = 3
+
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		SampleRate:  sampleRate,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	const n = 2 * sampleRate
+
+	// Filtered queries are always logged.
+	for range n {
+		addEntry(l, "blocked.example", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	}
+
+	for range n {
+		l.Add(&AddParams{
+			Question: &dns.Msg{
+				Question: []dns.Question{{
+					Name:   "allowed.example.",
+					Qtype:  dns.TypeA,
+					Qclass: dns.ClassINET,
+				}},
+			},
+			Result:   &filtering.Result{},
+			ClientIP: net.IPv4(2, 2, 2, 1),
+		})
+	}
+
+	entries, _ := l.search(newSearchParams())
+
+	var blocked, allowed int
+	for _, e := range entries {
+		switch e.QHost {
+		case "blocked.example":
+			blocked++
+			assert.Zero(t, e.SampleRate)
+		case "allowed.example":
+			allowed++
+			assert.Equal(t, uint(sampleRate), e.SampleRate)
+		}
+	}
+
+	assert.Equal(t, n, blocked)
+	assert.Equal(t, n/sampleRate, allowed)
+}
+
+func TestUpstreamTransport(t *testing.T) {
+	testCases := []struct {
+		addr string
+		want string
+	}{{
+		addr: "",
+		want: "",
+	}, {
+		addr: "8.8.8.8:53",
+		want: upstreamTransportUDP,
+	}, {
+		addr: "udp://8.8.8.8:53",
+		want: upstreamTransportUDP,
+	}, {
+		addr: "tcp://8.8.8.8:53",
+		want: upstreamTransportTCP,
+	}, {
+		addr: "tls://dns.example:853",
+		want: upstreamTransportDoT,
+	}, {
+		addr: "https://dns.example:443/dns-query",
+		want: upstreamTransportDoH,
+	}, {
+		addr: "h3://dns.example:443/dns-query",
+		want: upstreamTransportDoH,
+	}, {
+		addr: "quic://dns.example:853",
+		want: upstreamTransportDoQ,
+	}, {
+		addr: "sdns://AQcAAAAAAAAA",
+		want: upstreamTransportDNSCrypt,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			assert.Equal(t, tc.want, upstreamTransport(tc.addr))
+		})
+	}
+}
+
 func TestQueryLogShouldLog(t *testing.T) {
 	const (
 		ignored1        = "ignor.ed"
@@ -332,6 +646,9 @@ func TestQueryLogShouldLog(t *testing.T) {
 			assert.Equal(t, tc.wantLog, res)
 		})
 	}
+
+	l.conf.Enabled = false
+	assert.False(t, l.ShouldLog("example.com", dns.TypeA, dns.ClassINET, []string{"whatever"}))
 }
 
 func addEntry(l *queryLog, host string, answerStr, client net.IP) {
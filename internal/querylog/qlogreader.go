@@ -20,6 +20,9 @@ type qLogReader struct {
 	// to newest.
 	qFiles []*qLogFile
 
+	// onClose, if not nil, is called when the reader is closed.
+	onClose func()
+
 	// currentFile is the index of the current file.
 	currentFile int
 }
@@ -146,6 +149,10 @@ func (r *qLogReader) ReadNext() (string, error) {
 
 // Close closes the qLogReader.
 func (r *qLogReader) Close() error {
+	if r.onClose != nil {
+		defer r.onClose()
+	}
+
 	return closeQFiles(r.qFiles)
 }
 
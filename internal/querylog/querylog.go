@@ -30,6 +30,11 @@ type QueryLog interface {
 
 	// ShouldLog returns true if request for the host should be logged.
 	ShouldLog(host string, qType, qClass uint16, ids []string) bool
+
+	// PurgeClient removes all the entries of the clients with the given IP
+	// addresses or ClientIDs from both the memory buffer and the log files.
+	// removed is the number of entries removed.
+	PurgeClient(ids []string) (removed int, err error)
 }
 
 // Config is the query log configuration structure.
@@ -53,6 +58,18 @@ type Config struct {
 	// FindClient returns client information by their IDs.
 	FindClient func(ids []string) (c *Client, err error)
 
+	// Syslog is the configuration of the syslog output.  If it's nil or
+	// disabled, the entries aren't written to syslog.
+	Syslog *SyslogConfig
+
+	// Storage is the configuration of the remote storage.  If it's nil or
+	// its type is empty, the entries aren't written to a remote storage.
+	Storage *StorageConfig
+
+	// Rollup is the configuration of the pre-aggregated summaries.  If it's
+	// nil or disabled, the summaries aren't maintained.
+	Rollup *RollupConfig
+
 	// BaseDir is the base directory for log files.
 	BaseDir string
 
@@ -61,16 +78,35 @@ type Config struct {
 	// is twice the interval.
 	RotationIvl time.Duration
 
+	// MaxSize is the maximum total size of the log files in bytes.  The oldest
+	// entries are removed once it's exceeded.  Zero means no limit.
+	MaxSize uint64
+
+	// SampleRate is the sampling rate of the queries that aren't filtered: only
+	// one in SampleRate of them is logged.  Filtered queries are always
+	// logged.  Zero and one mean that all queries are logged.
+	SampleRate uint
+
 	// MemSize is the number of entries kept in a memory buffer before they are
 	// flushed to disk.
 	MemSize uint
 
+	// FlushInterval is the maximum time the entries are kept in the memory
+	// buffer before they are flushed to disk, which bounds the number of the
+	// entries lost on a crash.  Zero means that the entries are only flushed
+	// once the buffer is full.
+	FlushInterval time.Duration
+
 	// Enabled tells if the query log is enabled.
 	Enabled bool
 
 	// FileEnabled tells if the query log writes logs to files.
 	FileEnabled bool
 
+	// Compress tells if the rotated log files are compressed.  The current log
+	// file is never compressed.
+	Compress bool
+
 	// AnonymizeClientIP tells if the query log should anonymize clients' IP
 	// addresses.
 	AnonymizeClientIP bool
@@ -99,6 +135,10 @@ type AddParams struct {
 	// Upstream is the URL of the upstream DNS server.
 	Upstream string
 
+	// UpstreamGroup is the group of the upstream DNS server.  It's empty if
+	// the request hasn't been sent to an upstream.
+	UpstreamGroup UpstreamGroup
+
 	ClientProto ClientProto
 
 	ClientIP net.IP
@@ -106,6 +146,17 @@ type AddParams struct {
 	// Elapsed is the time spent for processing the request.
 	Elapsed time.Duration
 
+	// CacheElapsed is the time spent for resolving the request from cache.  It
+	// is zero if the response hasn't been served from cache.
+	CacheElapsed time.Duration
+
+	// FilteringElapsed is the time spent for filtering the request and the
+	// response.
+	FilteringElapsed time.Duration
+
+	// UpstreamElapsed is the time spent for exchanging with the upstream.
+	UpstreamElapsed time.Duration
+
 	// Cached indicates if the response is served from cache.
 	Cached bool
 
@@ -160,6 +211,10 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		logFile: filepath.Join(conf.BaseDir, queryLogFileName),
 
 		anonymizer: conf.Anonymizer,
+
+		stream: newStreamHub(),
+
+		done: make(chan struct{}),
 	}
 
 	*l.conf = conf
@@ -169,5 +224,41 @@ func newQueryLog(conf Config) (l *queryLog, err error) {
 		return nil, fmt.Errorf("unsupported interval: %w", err)
 	}
 
+	if conf.Syslog != nil && conf.Syslog.Enabled {
+		err = conf.Syslog.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("syslog: %w", err)
+		}
+
+		l.syslog = newSyslogSink(conf.Syslog, conf.Anonymizer)
+	}
+
+	if conf.Storage != nil && conf.Storage.Type != "" {
+		err = conf.Storage.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+
+		var b storageBackend
+		b, err = newStorageBackend(conf.Storage)
+		if err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+
+		l.remote = newRemoteStorage(conf.Storage, b, conf.Anonymizer)
+	}
+
+	if conf.Rollup != nil && conf.Rollup.Enabled {
+		err = conf.Rollup.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("rollup: %w", err)
+		}
+
+		l.rollups, err = newRollupStore(conf.Rollup, conf.BaseDir, conf.Anonymizer)
+		if err != nil {
+			return nil, fmt.Errorf("rollup: %w", err)
+		}
+	}
+
 	return l, nil
 }
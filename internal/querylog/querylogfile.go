@@ -1,14 +1,18 @@
 package querylog
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
+	"github.com/klauspost/compress/zstd"
 )
 
 // flushLogBuffer flushes the current buffer to file and resets the current
@@ -87,11 +91,11 @@ func (l *queryLog) flushToFile(b *bytes.Buffer) (err error) {
 	return nil
 }
 
-func (l *queryLog) rotate() error {
+func (l *queryLog) rotate() (err error) {
 	from := l.logFile
-	to := l.logFile + ".1"
+	to, compressed := l.oldFiles()
 
-	err := os.Rename(from, to)
+	err = os.Rename(from, to)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			log.Debug("querylog: no log to rotate")
@@ -104,6 +108,205 @@ func (l *queryLog) rotate() error {
 
 	log.Debug("querylog: renamed %s into %s", from, to)
 
+	err = l.removeDecompressedOldFile()
+	if err != nil {
+		return fmt.Errorf("removing decompressed old file: %w", err)
+	}
+
+	l.confMu.RLock()
+	compress := l.conf.Compress
+	l.confMu.RUnlock()
+
+	if !compress {
+		// Remove the compressed file left from the previous rotations, since
+		// it's older than the renamed one.
+		return removeIfExists(compressed)
+	}
+
+	err = compressFile(to, compressed)
+	if err != nil {
+		return fmt.Errorf("compressing old file: %w", err)
+	}
+
+	log.Debug("querylog: compressed %s into %s", to, compressed)
+
+	return os.Remove(to)
+}
+
+// compressedExt is the extension of the compressed rotated log file.
+const compressedExt = ".zst"
+
+// decompressedExt is the extension of the decompressed copy of the compressed
+// rotated log file, which is kept for searching.
+const decompressedExt = ".decompressed"
+
+// oldFiles returns the paths of the rotated log file and of its compressed
+// version.  Normally, at most one of them exists.
+func (l *queryLog) oldFiles() (plain, compressed string) {
+	plain = l.logFile + ".1"
+
+	return plain, plain + compressedExt
+}
+
+// newCompressor returns a writer compressing the data written to w.
+func newCompressor(w io.Writer) (zw io.WriteCloser, err error) {
+	// Don't wrap the error since it's informative enough as is.
+	return zstd.NewWriter(w)
+}
+
+// newDecompressor returns a reader decompressing the data from r.
+func newDecompressor(r io.Reader) (zr io.ReadCloser, err error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return d.IOReadCloser(), nil
+}
+
+// compressFile writes the compressed contents of the file at src to the file at
+// dst, replacing it atomically.
+func compressFile(src, dst string) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	pf, err := aghrenameio.NewPendingFile(dst, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating pending file: %w", err)
+	}
+
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, pf) }()
+
+	zw, err := newCompressor(pf)
+	if err != nil {
+		return fmt.Errorf("creating compressor: %w", err)
+	}
+
+	_, err = io.Copy(zw, f)
+	if err != nil {
+		return errors.WithDeferred(fmt.Errorf("writing: %w", err), zw.Close())
+	}
+
+	return zw.Close()
+}
+
+// decompressedOldFile returns the path of the decompressed copy of the
+// compressed rotated log file, since the reading requires seeking.  path is
+// empty if there is no compressed file.  The copy is shared by the concurrent
+// searches, each of which must call [queryLog.releaseDecompressedOldFile] once
+// it's done reading if path isn't empty.  The stale copies, including the ones
+// left after a crash, are replaced or removed.
+func (l *queryLog) decompressedOldFile() (path string, err error) {
+	l.decompressMu.Lock()
+	defer l.decompressMu.Unlock()
+
+	_, compressed := l.oldFiles()
+	path = compressed + decompressedExt
+
+	zfi, err := os.Stat(compressed)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", removeIfExists(path)
+	} else if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// Don't wrap the error since it's informative enough as is.
+		return "", err
+	}
+
+	if err != nil || fi.ModTime().Before(zfi.ModTime()) {
+		err = decompressFile(compressed, path)
+		if err != nil {
+			return "", fmt.Errorf("decompressing %q: %w", compressed, err)
+		}
+
+		log.Debug("querylog: decompressed %s into %s", compressed, path)
+	}
+
+	l.decompressRefs++
+
+	return path, nil
+}
+
+// releaseDecompressedOldFile removes the decompressed copy of the compressed
+// rotated log file once the last of the searches reading it is done, so that
+// the copy doesn't take the disk space saved by the compression.
+func (l *queryLog) releaseDecompressedOldFile() {
+	l.decompressMu.Lock()
+	defer l.decompressMu.Unlock()
+
+	l.decompressRefs--
+	if l.decompressRefs > 0 {
+		return
+	}
+
+	_, compressed := l.oldFiles()
+	err := removeIfExists(compressed + decompressedExt)
+	if err != nil {
+		log.Error("querylog: removing decompressed old file: %s", err)
+	}
+}
+
+// removeDecompressedOldFile removes the decompressed copy of the compressed
+// rotated log file, so that it's recreated on the next search.
+func (l *queryLog) removeDecompressedOldFile() (err error) {
+	l.decompressMu.Lock()
+	defer l.decompressMu.Unlock()
+
+	_, compressed := l.oldFiles()
+
+	return removeIfExists(compressed + decompressedExt)
+}
+
+// decompressFile writes the decompressed contents of the file at src to the
+// file at dst, replacing it atomically.
+func decompressFile(src, dst string) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	zr, err := newDecompressor(f)
+	if err != nil {
+		return fmt.Errorf("creating decompressor: %w", err)
+	}
+
+	defer func() { err = errors.WithDeferred(err, zr.Close()) }()
+
+	pf, err := aghrenameio.NewPendingFile(dst, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating pending file: %w", err)
+	}
+
+	defer func() { err = aghrenameio.WithDeferredCleanup(err, pf) }()
+
+	_, err = io.Copy(pf, zr)
+	if err != nil {
+		return fmt.Errorf("writing: %w", err)
+	}
+
+	return nil
+}
+
+// removeIfExists removes the file at path, if it exists.
+func removeIfExists(path string) (err error) {
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
 	return nil
 }
 
@@ -154,17 +357,76 @@ func (l *queryLog) periodicRotate() {
 	}
 }
 
+// periodicFlush flushes the memory buffer to the log file every ivl until the
+// query log is closed.  It is intended to be used as a goroutine.
+func (l *queryLog) periodicFlush(ivl time.Duration) {
+	defer log.OnPanic("querylog: flushing")
+
+	flushes := time.NewTicker(ivl)
+	defer flushes.Stop()
+
+	for {
+		select {
+		case <-flushes.C:
+			l.flushBuffered()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// flushBuffered flushes the memory buffer to the log file, unless it's empty,
+// the file is disabled, or a flush is already pending.
+func (l *queryLog) flushBuffered() {
+	l.confMu.RLock()
+	fileIsEnabled := l.conf.FileEnabled
+	l.confMu.RUnlock()
+
+	if !fileIsEnabled {
+		return
+	}
+
+	skip := func() (ok bool) {
+		l.bufferLock.Lock()
+		defer l.bufferLock.Unlock()
+
+		if l.flushPending || l.buffer.Len() == 0 {
+			return true
+		}
+
+		l.flushPending = true
+
+		return false
+	}()
+	if skip {
+		return
+	}
+
+	err := l.flushLogBuffer()
+	if err != nil {
+		log.Error("querylog: flushing periodically: %s", err)
+	}
+}
+
 // checkAndRotate rotates log files if those are older than the specified
-// rotation interval.
+// rotation interval and trims them if they exceed the maximum size.
 func (l *queryLog) checkAndRotate() {
 	var rotationIvl time.Duration
+	var maxSize uint64
 	func() {
 		l.confMu.RLock()
 		defer l.confMu.RUnlock()
 
-		rotationIvl = l.conf.RotationIvl
+		rotationIvl, maxSize = l.conf.RotationIvl, l.conf.MaxSize
 	}()
 
+	if maxSize > 0 {
+		err := l.trimToMaxSize(maxSize)
+		if err != nil {
+			log.Error("querylog: trimming to max size: %s", err)
+		}
+	}
+
 	oldest, err := l.readFileFirstTimeValue()
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Error("querylog: reading oldest record for rotation: %s", err)
@@ -191,3 +453,148 @@ func (l *queryLog) checkAndRotate() {
 
 	log.Debug("querylog: rotated successfully")
 }
+
+// maxSizeTrimRatio is the share of the maximum size the log files are trimmed
+// to once it's exceeded, so that the trimming doesn't happen on every flush.
+const maxSizeTrimRatio = 0.9
+
+// trimToMaxSize removes the oldest entries from the log files if their total
+// size exceeds maxSize bytes.  The old file is trimmed first.  The compressed
+// old file is removed as a whole.
+func (l *queryLog) trimToMaxSize(maxSize uint64) (err error) {
+	l.fileWriteLock.Lock()
+	defer l.fileWriteLock.Unlock()
+
+	oldFile, compressed := l.oldFiles()
+	oldSize, err := fileSize(oldFile)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	// The compressed file can't be trimmed, so it's removed as a whole.
+	compressedSize, err := fileSize(compressed)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	if compressedSize > 0 {
+		oldFile, oldSize = compressed, compressedSize
+	}
+
+	curSize, err := fileSize(l.logFile)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	// The decompressed copy only exists while it's being searched, but it
+	// takes the disk space all the same.
+	decompressedSize, err := fileSize(compressed + decompressedExt)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	total := oldSize + curSize + decompressedSize
+	if total <= maxSize {
+		return nil
+	}
+
+	excess := total - uint64(float64(maxSize)*maxSizeTrimRatio)
+	log.Info("querylog: %d bytes of log files exceed %d bytes, trimming %d bytes", total, maxSize, excess)
+
+	if oldSize > 0 {
+		if oldSize > excess && compressedSize == 0 {
+			return trimFileHead(oldFile, excess)
+		}
+
+		err = os.Remove(oldFile)
+		if err != nil {
+			return fmt.Errorf("removing old file: %w", err)
+		}
+
+		if compressedSize > 0 {
+			err = l.removeDecompressedOldFile()
+			if err != nil {
+				return fmt.Errorf("removing decompressed old file: %w", err)
+			}
+		}
+
+		if oldSize >= excess {
+			return nil
+		}
+
+		excess -= oldSize
+	}
+
+	return trimFileHead(l.logFile, excess)
+}
+
+// fileSize returns the size of the file at path.  size is zero if the file
+// doesn't exist.
+func fileSize(path string) (size uint64, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return uint64(fi.Size()), nil
+}
+
+// trimFileHead removes at least n bytes from the beginning of the file at
+// path, cutting it at the line boundary, so that only whole entries remain.
+// The file is removed if nothing remains.
+func trimFileHead(path string, n uint64) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	pf, err := aghrenameio.NewPendingFile(path, 0o644)
+	if err != nil {
+		return errors.WithDeferred(fmt.Errorf("creating pending file: %w", err), f.Close())
+	}
+
+	written, err := copyTail(pf, f, n)
+
+	// Close the source file before replacing it, since that is required on
+	// Windows.
+	err = errors.WithDeferred(err, f.Close())
+	if err != nil || written == 0 {
+		err = errors.WithDeferred(err, pf.Cleanup())
+		if err != nil {
+			return fmt.Errorf("trimming %q: %w", path, err)
+		}
+
+		return os.Remove(path)
+	}
+
+	return pf.CloseReplace()
+}
+
+// copyTail copies the contents of f starting with the first line beginning
+// at or after the offset n to w.  n must be positive.
+func copyTail(w io.Writer, f *os.File, n uint64) (written int64, err error) {
+	// Step back a byte to not skip the line beginning exactly at n.
+	_, err = f.Seek(int64(n)-1, io.SeekStart)
+	if err != nil {
+		return 0, fmt.Errorf("seeking: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	_, err = r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("skipping partial line: %w", err)
+	}
+
+	return io.Copy(w, r)
+}
@@ -0,0 +1,518 @@
+package querylog
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/AdGuardHome/internal/aghrenameio"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// RollupConfig is the configuration of the pre-aggregated summaries of the
+// query log.
+type RollupConfig struct {
+	// Window is the period of time each summary covers.  It must be a divisor
+	// of a day not shorter than a minute.  If zero, [defaultRollupWindow] is
+	// used.
+	Window timeutil.Duration `yaml:"window"`
+
+	// Retention is the period of time the summaries are kept for.  It must be
+	// at least Window and at most a year.
+	Retention timeutil.Duration `yaml:"retention"`
+
+	// Enabled defines if the summaries are maintained.
+	Enabled bool `yaml:"enabled"`
+}
+
+// defaultRollupWindow is the default period of time a summary covers.
+const defaultRollupWindow = time.Hour
+
+// window returns the configured window or the default one.
+func (c *RollupConfig) window() (w time.Duration) {
+	if c.Window.Duration == 0 {
+		return defaultRollupWindow
+	}
+
+	return c.Window.Duration
+}
+
+// Validate returns an error if c contains invalid values.
+func (c *RollupConfig) Validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	w := c.window()
+	if w < time.Minute || timeutil.Day%w != 0 {
+		return fmt.Errorf("window: %s is not a divisor of a day of at least a minute", w)
+	}
+
+	if c.Retention.Duration < w {
+		return fmt.Errorf("retention: must be at least %s", w)
+	} else if c.Retention.Duration > timeutil.Day*365 {
+		return errors.Error("retention: more than a year")
+	}
+
+	return nil
+}
+
+// rollupFileName is the name of the file with the summaries.
+const rollupFileName = "querylog_rollup.json"
+
+// rollupMaxItems is the maximum number of the clients and the domains kept in
+// a single summary.
+const rollupMaxItems = 100
+
+// rollup is the summary of the queries made within a single window.
+type rollup struct {
+	// Start is the beginning of the window.
+	Start time.Time `json:"T"`
+
+	// Clients is the number of queries by the ClientID or the IP address of
+	// the client.
+	Clients map[string]uint64 `json:"C,omitempty"`
+
+	// Domains is the number of queries by the domain name.
+	Domains map[string]uint64 `json:"D,omitempty"`
+
+	// Reasons is the number of queries by the filtering reason.
+	Reasons map[string]uint64 `json:"R,omitempty"`
+
+	// Total is the total number of queries.
+	Total uint64 `json:"N"`
+}
+
+// newRollup returns a new empty summary of the window starting at start.
+func newRollup(start time.Time) (r *rollup) {
+	return &rollup{
+		Start:   start,
+		Clients: map[string]uint64{},
+		Domains: map[string]uint64{},
+		Reasons: map[string]uint64{},
+	}
+}
+
+// trim keeps only the [rollupMaxItems] most frequent clients and domains of r.
+func (r *rollup) trim() {
+	r.Clients = topCounts(r.Clients, rollupMaxItems)
+	r.Domains = topCounts(r.Domains, rollupMaxItems)
+}
+
+// rollupStore maintains the summaries of the query log.  It's safe for
+// concurrent use.
+type rollupStore struct {
+	// mu protects curr and stored.
+	mu *sync.Mutex
+
+	// anonymizer processes the IP addresses of the clients.
+	anonymizer *aghnet.IPMut
+
+	// curr is the summary of the current window.
+	curr *rollup
+
+	// path is the path to the file with the summaries.
+	path string
+
+	// stored are the summaries of the finished windows sorted by time.
+	stored []*rollup
+
+	// window is the period of time each summary covers.
+	window time.Duration
+
+	// retention is the period of time the summaries are kept for.
+	retention time.Duration
+}
+
+// newRollupStore returns a new *rollupStore and loads the summaries from the
+// file in baseDir.  conf must be valid and enabled.  anonymizer may be nil.
+func newRollupStore(
+	conf *RollupConfig,
+	baseDir string,
+	anonymizer *aghnet.IPMut,
+) (s *rollupStore, err error) {
+	if anonymizer == nil {
+		anonymizer = aghnet.NewIPMut(nil)
+	}
+
+	s = &rollupStore{
+		mu:         &sync.Mutex{},
+		anonymizer: anonymizer,
+		path:       filepath.Join(baseDir, rollupFileName),
+		window:     conf.window(),
+		retention:  conf.Retention.Duration,
+	}
+
+	err = s.load()
+	if err != nil {
+		return nil, fmt.Errorf("loading %q: %w", s.path, err)
+	}
+
+	return s, nil
+}
+
+// load reads the summaries from the file.  The missing file isn't an error.
+func (s *rollupStore) load() (err error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	defer func() { err = errors.WithDeferred(err, f.Close()) }()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, bufio.MaxScanTokenSize*64)
+	for sc.Scan() {
+		// Allocate the maps, since the empty ones are omitted.
+		r := newRollup(time.Time{})
+		err = json.Unmarshal(sc.Bytes(), r)
+		if err != nil {
+			log.Debug("querylog: rollup: skipping bad line: %s", err)
+
+			continue
+		}
+
+		s.stored = append(s.stored, r)
+	}
+
+	slices.SortFunc(s.stored, func(a, b *rollup) (res int) {
+		return a.Start.Compare(b.Start)
+	})
+
+	return sc.Err()
+}
+
+// add counts the query with params made at now.
+func (s *rollupStore) add(params *AddParams, now time.Time) {
+	client := params.ClientID
+	if client == "" {
+		ip := slices.Clone(params.ClientIP)
+		s.anonymizer.Load()(ip)
+		client = ip.String()
+	}
+
+	host := aghnet.NormalizeDomain(params.Question.Question[0].Name)
+	start := now.Truncate(s.window)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.curr == nil || !s.curr.Start.Equal(start) {
+		s.rotateLocked(start)
+	}
+
+	s.curr.Total++
+	s.curr.Clients[client]++
+	s.curr.Domains[host]++
+	s.curr.Reasons[params.Result.Reason.String()]++
+}
+
+// purge removes the counters of the clients from set.  The removed queries are
+// subtracted from the totals.
+func (s *rollupStore) purge(set clientIDSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollups := s.stored
+	if s.curr != nil {
+		rollups = append(slices.Clip(rollups), s.curr)
+	}
+
+	for _, r := range rollups {
+		for c, n := range r.Clients {
+			if set.has(c, c) {
+				r.Total -= min(n, r.Total)
+				delete(r.Clients, c)
+			}
+		}
+	}
+
+	err := s.writeLocked()
+	if err != nil {
+		log.Error("querylog: rollup: writing after purge: %s", err)
+	}
+}
+
+// rotateLocked finishes the current summary, if any, and starts the new one at
+// start.  The stale summaries are removed.  s.mu is expected to be locked.
+func (s *rollupStore) rotateLocked(start time.Time) {
+	if s.curr != nil {
+		s.curr.trim()
+		s.stored = append(s.stored, s.curr)
+	} else if l := len(s.stored); l > 0 && s.stored[l-1].Start.Equal(start) {
+		// Continue the summary loaded from the file.
+		s.curr, s.stored = s.stored[l-1], s.stored[:l-1]
+
+		return
+	}
+
+	s.curr = newRollup(start)
+
+	oldest := start.Add(-s.retention)
+	s.stored = slices.DeleteFunc(s.stored, func(r *rollup) (ok bool) {
+		return r.Start.Before(oldest)
+	})
+
+	err := s.writeLocked()
+	if err != nil {
+		log.Error("querylog: rollup: writing: %s", err)
+	}
+}
+
+// writeLocked writes the summaries to the file.  s.mu is expected to be
+// locked.
+func (s *rollupStore) writeLocked() (err error) {
+	pf, err := aghrenameio.NewPendingFile(s.path, 0o644)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	w := bufio.NewWriter(pf)
+	enc := json.NewEncoder(w)
+
+	rollups := s.stored
+	if s.curr != nil && s.curr.Total > 0 {
+		rollups = append(slices.Clip(rollups), s.curr)
+	}
+
+	for _, r := range rollups {
+		err = enc.Encode(r)
+		if err != nil {
+			return aghrenameio.WithDeferredCleanup(fmt.Errorf("encoding: %w", err), pf)
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return aghrenameio.WithDeferredCleanup(fmt.Errorf("flushing: %w", err), pf)
+	}
+
+	return pf.CloseReplace()
+}
+
+// close writes the summaries including the current one to the file.
+func (s *rollupStore) close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeLocked()
+}
+
+// clear removes all summaries.
+func (s *rollupStore) clear() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.curr, s.stored = nil, nil
+
+	return removeIfExists(s.path)
+}
+
+// rollupSummary is the merged summary of the queries within a time range.
+type rollupSummary struct {
+	// Clients is the number of queries by the client.
+	Clients map[string]uint64
+
+	// Domains is the number of queries by the domain name.
+	Domains map[string]uint64
+
+	// Reasons is the number of queries by the filtering reason.
+	Reasons map[string]uint64
+
+	// Totals is the total number of queries within each window, in the
+	// ascending order of time.
+	Totals []*rollupTotal
+}
+
+// rollupTotal is the total number of queries within a window.
+type rollupTotal struct {
+	// Start is the beginning of the window.
+	Start time.Time
+
+	// Total is the total number of queries.
+	Total uint64
+}
+
+// summary returns the merged summary of the windows starting not earlier than
+// since.  The clients and the domains are limited to limit most frequent ones.
+func (s *rollupStore) summary(since time.Time, limit int) (sum *rollupSummary) {
+	sum = &rollupSummary{
+		Clients: map[string]uint64{},
+		Domains: map[string]uint64{},
+		Reasons: map[string]uint64{},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollups := s.stored
+	if s.curr != nil {
+		rollups = append(slices.Clip(rollups), s.curr)
+	}
+
+	for _, r := range rollups {
+		if r.Start.Before(since) {
+			continue
+		}
+
+		sum.Totals = append(sum.Totals, &rollupTotal{Start: r.Start, Total: r.Total})
+		mergeCounts(sum.Clients, r.Clients)
+		mergeCounts(sum.Domains, r.Domains)
+		mergeCounts(sum.Reasons, r.Reasons)
+	}
+
+	sum.Clients = topCounts(sum.Clients, limit)
+	sum.Domains = topCounts(sum.Domains, limit)
+
+	return sum
+}
+
+// mergeCounts adds the counters from src to dst.
+func mergeCounts(dst, src map[string]uint64) {
+	for k, v := range src {
+		dst[k] += v
+	}
+}
+
+// topCounts returns the map with at most limit greatest counters from m.  m
+// itself is returned if it's already small enough.
+func topCounts(m map[string]uint64, limit int) (res map[string]uint64) {
+	if len(m) <= limit {
+		return m
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	// Sort by the counter in descending order and then by the key to keep the
+	// result stable.
+	slices.SortFunc(keys, func(a, b string) (res int) {
+		return cmp.Or(cmp.Compare(m[b], m[a]), strings.Compare(a, b))
+	})
+
+	res = make(map[string]uint64, limit)
+	for _, k := range keys[:limit] {
+		res[k] = m[k]
+	}
+
+	return res
+}
+
+// defaultRollupLimit is the default number of the most frequent clients and
+// domains in the response.
+const defaultRollupLimit = 10
+
+// rollupCountJSON is a single named counter in the rollup response.
+type rollupCountJSON struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// rollupTotalJSON is the total number of queries within a window.
+type rollupTotalJSON struct {
+	Time  string `json:"time"`
+	Count uint64 `json:"count"`
+}
+
+// rollupResp is the response for the GET /control/querylog/rollup HTTP API.
+type rollupResp struct {
+	Reasons    map[string]uint64  `json:"reasons"`
+	TopClients []*rollupCountJSON `json:"top_clients"`
+	TopDomains []*rollupCountJSON `json:"top_domains"`
+	Totals     []*rollupTotalJSON `json:"totals"`
+	WindowMs   float64            `json:"window_ms"`
+	Enabled    bool               `json:"enabled"`
+}
+
+// handleQueryLogRollup is the handler for the GET /control/querylog/rollup
+// HTTP API.  It returns the merged summaries of the queries made since the time
+// in the "since" query parameter, or all the kept summaries, if it's not set.
+func (l *queryLog) handleQueryLogRollup(w http.ResponseWriter, r *http.Request) {
+	resp := &rollupResp{
+		Reasons:    map[string]uint64{},
+		TopClients: []*rollupCountJSON{},
+		TopDomains: []*rollupCountJSON{},
+		Totals:     []*rollupTotalJSON{},
+	}
+
+	if l.rollups == nil {
+		aghhttp.WriteJSONResponseOK(w, r, resp)
+
+		return
+	}
+
+	q := r.URL.Query()
+
+	var since time.Time
+	if s := q.Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			aghhttp.Error(r, w, http.StatusBadRequest, "parsing since: %s", err)
+
+			return
+		}
+	}
+
+	limit := defaultRollupLimit
+	if s := q.Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > rollupMaxItems {
+			aghhttp.Error(r, w, http.StatusBadRequest, "limit: must be from 1 to %d", rollupMaxItems)
+
+			return
+		}
+	}
+
+	sum := l.rollups.summary(since, limit)
+
+	resp.Enabled = true
+	resp.WindowMs = float64(l.rollups.window.Milliseconds())
+	resp.Reasons = sum.Reasons
+	resp.TopClients = countsToJSON(sum.Clients)
+	resp.TopDomains = countsToJSON(sum.Domains)
+	for _, t := range sum.Totals {
+		resp.Totals = append(resp.Totals, &rollupTotalJSON{
+			Time:  t.Start.Format(time.RFC3339),
+			Count: t.Total,
+		})
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// countsToJSON returns the counters from m sorted in descending order.
+func countsToJSON(m map[string]uint64) (counts []*rollupCountJSON) {
+	counts = make([]*rollupCountJSON, 0, len(m))
+	for k, v := range m {
+		counts = append(counts, &rollupCountJSON{Name: k, Count: v})
+	}
+
+	slices.SortFunc(counts, func(a, b *rollupCountJSON) (res int) {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Name, b.Name))
+	})
+
+	return counts
+}
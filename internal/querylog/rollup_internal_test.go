@@ -0,0 +1,122 @@
+package querylog
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollupConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *RollupConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &RollupConfig{},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf: &RollupConfig{
+			Retention: timeutil.Duration{Duration: timeutil.Day},
+			Enabled:   true,
+		},
+		name:       "default_window",
+		wantErrMsg: "",
+	}, {
+		conf: &RollupConfig{
+			Window:    timeutil.Duration{Duration: 7 * time.Hour},
+			Retention: timeutil.Duration{Duration: timeutil.Day},
+			Enabled:   true,
+		},
+		name:       "bad_window",
+		wantErrMsg: "window: 7h0m0s is not a divisor of a day of at least a minute",
+	}, {
+		conf: &RollupConfig{
+			Window:    timeutil.Duration{Duration: time.Hour},
+			Retention: timeutil.Duration{Duration: time.Minute},
+			Enabled:   true,
+		},
+		name:       "short_retention",
+		wantErrMsg: "retention: must be at least 1h0m0s",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
+
+// newRollupParams returns the parameters of the query for host from the client
+// with ip and the given filtering reason.
+func newRollupParams(host string, ip net.IP, reason filtering.Reason) (p *AddParams) {
+	return &AddParams{
+		Question: (&dns.Msg{}).SetQuestion(host+".", dns.TypeA),
+		Result:   &filtering.Result{Reason: reason},
+		ClientIP: ip,
+	}
+}
+
+func TestRollupStore(t *testing.T) {
+	conf := &RollupConfig{
+		Window:    timeutil.Duration{Duration: time.Hour},
+		Retention: timeutil.Duration{Duration: 2 * time.Hour},
+		Enabled:   true,
+	}
+
+	dir := t.TempDir()
+	s, err := newRollupStore(conf, dir, nil)
+	require.NoError(t, err)
+
+	cli1, cli2 := net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The first window is going to be removed as stale.
+	s.add(newRollupParams("stale.example", cli1, filtering.NotFilteredNotFound), start)
+
+	s.add(newRollupParams("a.example", cli1, filtering.NotFilteredNotFound), start.Add(time.Hour))
+	s.add(newRollupParams("b.example", cli2, filtering.FilteredBlockList), start.Add(time.Hour))
+	s.add(newRollupParams("a.example", cli1, filtering.NotFilteredNotFound), start.Add(2*time.Hour))
+	s.add(newRollupParams("a.example", cli2, filtering.NotFilteredNotFound), start.Add(3*time.Hour))
+
+	require.NoError(t, s.close())
+
+	// Reload the summaries from the file.
+	s, err = newRollupStore(conf, dir, nil)
+	require.NoError(t, err)
+
+	sum := s.summary(time.Time{}, 1)
+	require.Len(t, sum.Totals, 3)
+
+	assert.Equal(t, start.Add(time.Hour), sum.Totals[0].Start)
+	assert.Equal(t, uint64(2), sum.Totals[0].Total)
+	assert.Equal(t, uint64(1), sum.Totals[2].Total)
+
+	assert.Equal(t, map[string]uint64{"a.example": 3}, sum.Domains)
+	assert.Len(t, sum.Clients, 1)
+	assert.Equal(t, map[string]uint64{
+		filtering.NotFilteredNotFound.String(): 3,
+		filtering.FilteredBlockList.String():   1,
+	}, sum.Reasons)
+
+	// Continue the last loaded window.
+	s.add(newRollupParams("c.example", cli1, filtering.NotFilteredNotFound), start.Add(3*time.Hour))
+
+	sum = s.summary(start.Add(3*time.Hour), rollupMaxItems)
+	require.Len(t, sum.Totals, 1)
+
+	assert.Equal(t, uint64(2), sum.Totals[0].Total)
+	assert.Equal(t, map[string]uint64{cli1.String(): 1, cli2.String(): 1}, sum.Clients)
+
+	s.purge(newClientIDSet([]string{cli1.String()}))
+
+	sum = s.summary(time.Time{}, rollupMaxItems)
+	assert.Equal(t, map[string]uint64{cli2.String(): 2}, sum.Clients)
+}
@@ -6,6 +6,7 @@ import (
 	"slices"
 	"time"
 
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
 	"github.com/AdguardTeam/golibs/errors"
 	"github.com/AdguardTeam/golibs/log"
 )
@@ -165,16 +166,34 @@ func (r *qLogReader) seekRecord(olderThan time.Time) (err error) {
 // setQLogReader creates a reader with the specified files and sets the
 // position to the next record older than the provided parameter.
 func (l *queryLog) setQLogReader(olderThan time.Time) (qr *qLogReader, err error) {
+	decompressed, err := l.decompressedOldFile()
+	if err != nil {
+		log.Error("querylog: %s", err)
+	}
+
+	oldFile, _ := l.oldFiles()
 	files := []string{
-		l.logFile + ".1",
+		oldFile,
 		l.logFile,
 	}
 
+	if decompressed != "" {
+		files = slices.Insert(files, 0, decompressed)
+	}
+
 	r, err := newQLogReader(files)
 	if err != nil {
+		if decompressed != "" {
+			l.releaseDecompressedOldFile()
+		}
+
 		return nil, fmt.Errorf("opening qlog reader: %s", err)
 	}
 
+	if decompressed != "" {
+		r.onClose = l.releaseDecompressedOldFile
+	}
+
 	err = r.seekRecord(olderThan)
 	if err != nil {
 		defer func() { err = errors.WithDeferred(err, r.Close()) }()
@@ -186,7 +205,8 @@ func (l *queryLog) setQLogReader(olderThan time.Time) (qr *qLogReader, err error
 	return r, nil
 }
 
-// readEntries reads entries from the reader to totalLimit.  By default, we do
+// readEntries reads entries from the reader to totalLimit.  l.confMu is
+// expected to be locked.  By default, we do
 // not scan more than maxFileScanEntries at once.  The idea is to make search
 // calls faster so that the UI could handle it and show something quicker.
 // This behavior can be overridden if maxFileScanEntries is set to 0.
@@ -197,7 +217,7 @@ func (l *queryLog) readEntries(
 	totalLimit int,
 ) (entries []*logEntry, oldestNano int64, total int) {
 	for total < params.maxFileScanEntries || params.maxFileScanEntries <= 0 {
-		ent, ts, rErr := l.readNextEntry(r, params, cache)
+		ent, ts, rErr := l.readNextEntry(r, params, cache, l.conf.Ignored)
 		if rErr != nil {
 			if rErr == io.EOF {
 				oldestNano = 0
@@ -283,12 +303,13 @@ func (f quickMatchClientFinder) findClient(clientID, ip string) (c *Client) {
 
 // readNextEntry reads the next log entry and checks if it matches the search
 // criteria.  It optionally uses the client cache, if provided.  e is nil if
-// the entry doesn't match the search criteria.  ts is the timestamp of the
-// processed entry.
+// the entry doesn't match the search criteria or its host is ignored by
+// ignored.  ts is the timestamp of the processed entry.
 func (l *queryLog) readNextEntry(
 	r *qLogReader,
 	params *searchParams,
 	cache clientCache,
+	ignored *aghnet.IgnoreEngine,
 ) (e *logEntry, ts int64, err error) {
 	var line string
 	line, err = r.ReadNext()
@@ -310,7 +331,7 @@ func (l *queryLog) readNextEntry(
 	e = &logEntry{}
 	decodeLogEntry(e, line)
 
-	if l.isIgnored(e.QHost) {
+	if ignored.Has(e.QHost) {
 		return nil, ts, nil
 	}
 
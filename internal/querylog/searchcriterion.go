@@ -2,10 +2,12 @@ package querylog
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
 	"github.com/AdguardTeam/golibs/stringutil"
+	"github.com/miekg/dns"
 )
 
 type criterionType int
@@ -19,6 +21,20 @@ const (
 	//
 	// See (*searchCriterion).ctFilteringStatusCase for details.
 	ctFilteringStatus
+	// ctDomainRegexp is for searching by a regular expression matching the
+	// domain name.
+	ctDomainRegexp
+	// ctQuestionType is for searching by the type of the question, e.g.
+	// "AAAA".
+	ctQuestionType
+	// ctResponseCode is for searching by the response code of the answer,
+	// e.g. "NXDOMAIN".
+	ctResponseCode
+	// ctUpstream is for searching by the address of the upstream server.
+	ctUpstream
+	// ctReason is for searching by the filtering reason, e.g.
+	// "FilteredBlackList".
+	ctReason
 )
 
 const (
@@ -29,6 +45,8 @@ const (
 	filteringStatusBlockedService      = "blocked_services"     // blocked
 	filteringStatusBlockedSafebrowsing = "blocked_safebrowsing" // blocked by safebrowsing
 	filteringStatusBlockedParental     = "blocked_parental"     // blocked by parental control
+	filteringStatusBlockedThreatFeeds  = "blocked_threat_feeds" // blocked by threat feeds
+	filteringStatusNewDomains          = "new_domains"          // blocked or flagged as newly-registered
 	filteringStatusWhitelisted         = "whitelisted"          // whitelisted
 	filteringStatusRewritten           = "rewritten"            // all kinds of rewrites
 	filteringStatusSafeSearch          = "safe_search"          // enforced safe search
@@ -39,12 +57,15 @@ const (
 var filteringStatusValues = []string{
 	filteringStatusAll, filteringStatusFiltered, filteringStatusBlocked,
 	filteringStatusBlockedService, filteringStatusBlockedSafebrowsing, filteringStatusBlockedParental,
-	filteringStatusWhitelisted, filteringStatusRewritten, filteringStatusSafeSearch,
+	filteringStatusBlockedThreatFeeds, filteringStatusNewDomains, filteringStatusWhitelisted, filteringStatusRewritten, filteringStatusSafeSearch,
 	filteringStatusProcessed,
 }
 
 // searchCriterion is a search criterion that is used to match a record.
 type searchCriterion struct {
+	// re is the compiled regular expression for ctDomainRegexp.
+	re *regexp.Regexp
+
 	value         string
 	asciiVal      string
 	criterionType criterionType
@@ -52,6 +73,9 @@ type searchCriterion struct {
 	// whole value rather than the part of it.  That is, equality and not
 	// containment.
 	strict bool
+	// negate, if true, means that the records not matching the criterion
+	// are selected.
+	negate bool
 }
 
 func ctDomainOrClientCaseStrict(
@@ -88,6 +112,11 @@ func ctDomainOrClientCaseNonStrict(
 // It returns false if the like doesn't match.  This method is only here for
 // optimization purposes.
 func (c *searchCriterion) quickMatch(line string, findClient quickMatchClientFunc) (ok bool) {
+	if c.negate {
+		// Go on, as the quick matches aren't precise enough to be negated.
+		return true
+	}
+
 	switch c.criterionType {
 	case ctTerm:
 		host := readJSONValue(line, `"QH":"`)
@@ -104,6 +133,8 @@ func (c *searchCriterion) quickMatch(line string, findClient quickMatchClientFun
 		}
 
 		return ctDomainOrClientCaseNonStrict(c.value, c.asciiVal, clientID, name, host, ip)
+	case ctDomainRegexp:
+		return c.re.MatchString(readJSONValue(line, `"QH":"`))
 	case ctFilteringStatus:
 		// Go on, as we currently don't do quick matches against
 		// filtering statuses.
@@ -113,18 +144,53 @@ func (c *searchCriterion) quickMatch(line string, findClient quickMatchClientFun
 	}
 }
 
-// match checks if the log entry matches this search criterion.
-func (c *searchCriterion) match(entry *logEntry) bool {
+// match checks if the log entry matches this search criterion, taking the
+// negation into account.
+func (c *searchCriterion) match(entry *logEntry) (ok bool) {
+	return c.matchEntry(entry) != c.negate
+}
+
+// matchEntry checks if the log entry matches this search criterion ignoring
+// the negation.
+func (c *searchCriterion) matchEntry(entry *logEntry) (ok bool) {
 	switch c.criterionType {
 	case ctTerm:
 		return c.ctDomainOrClientCase(entry)
 	case ctFilteringStatus:
 		return c.ctFilteringStatusCase(entry.Result.Reason, entry.Result.IsFiltered)
+	case ctDomainRegexp:
+		return c.re.MatchString(entry.QHost)
+	case ctQuestionType:
+		return strings.EqualFold(entry.QType, c.value)
+	case ctResponseCode:
+		return strings.EqualFold(responseCode(entry.Answer), c.value)
+	case ctUpstream:
+		if c.strict {
+			return strings.EqualFold(entry.Upstream, c.value)
+		}
+
+		return stringutil.ContainsFold(entry.Upstream, c.value)
+	case ctReason:
+		return strings.EqualFold(entry.Result.Reason.String(), c.value)
 	}
 
 	return false
 }
 
+// responseCode returns the name of the response code of the packed DNS
+// message.  It returns an empty string if there is no message.
+func responseCode(msg []byte) (rcode string) {
+	// The header of a DNS message is 12 bytes long, and the response code is
+	// in the lower four bits of the fourth byte.  The extended response codes
+	// aren't taken into account.
+	const dnsHeaderLen = 12
+	if len(msg) < dnsHeaderLen {
+		return ""
+	}
+
+	return dns.RcodeToString[int(msg[3]&0x0f)]
+}
+
 func (c *searchCriterion) ctDomainOrClientCase(e *logEntry) bool {
 	clientID := e.ClientID
 	host := e.QHost
@@ -162,8 +228,11 @@ func (c *searchCriterion) ctFilteringStatusCase(
 		filteringStatusBlockedParental,
 		filteringStatusBlockedSafebrowsing,
 		filteringStatusBlockedService,
+		filteringStatusBlockedThreatFeeds,
 		filteringStatusSafeSearch:
 		return isFiltered && c.isFilteredWithReason(reason)
+	case filteringStatusNewDomains:
+		return reason.In(filtering.FilteredNewDomain, filtering.NotFilteredNewDomain)
 	case filteringStatusWhitelisted:
 		return reason == filtering.NotFilteredAllowList
 	case filteringStatusRewritten:
@@ -176,6 +245,8 @@ func (c *searchCriterion) ctFilteringStatusCase(
 		return !reason.In(
 			filtering.FilteredBlockList,
 			filtering.FilteredBlockedService,
+			filtering.FilteredThreatFeed,
+			filtering.FilteredNewDomain,
 			filtering.NotFilteredAllowList,
 		)
 	default:
@@ -190,17 +261,25 @@ func (c *searchCriterion) ctFilteringStatusCase(
 //   - filteringStatusBlockedParental
 //   - filteringStatusBlockedSafebrowsing
 //   - filteringStatusBlockedService
+//   - filteringStatusBlockedThreatFeeds
 //   - filteringStatusSafeSearch
 func (c *searchCriterion) isFilteredWithReason(reason filtering.Reason) (matched bool) {
 	switch c.value {
 	case filteringStatusBlocked:
-		return reason.In(filtering.FilteredBlockList, filtering.FilteredBlockedService)
+		return reason.In(
+			filtering.FilteredBlockList,
+			filtering.FilteredBlockedService,
+			filtering.FilteredThreatFeed,
+			filtering.FilteredNewDomain,
+		)
 	case filteringStatusBlockedParental:
 		return reason == filtering.FilteredParental
 	case filteringStatusBlockedSafebrowsing:
 		return reason == filtering.FilteredSafeBrowsing
 	case filteringStatusBlockedService:
 		return reason == filtering.FilteredBlockedService
+	case filteringStatusBlockedThreatFeeds:
+		return reason == filtering.FilteredThreatFeed
 	case filteringStatusSafeSearch:
 		return reason == filtering.FilteredSafeSearch
 	default:
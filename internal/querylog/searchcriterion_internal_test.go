@@ -0,0 +1,143 @@
+package querylog
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchParams_advanced(t *testing.T) {
+	nxdomain := &dns.Msg{}
+	nxdomain.SetRcode(&dns.Msg{
+		Question: []dns.Question{{Name: "bad.example.org.", Qtype: dns.TypeA}},
+	}, dns.RcodeNameError)
+
+	nxdomainData, err := nxdomain.Pack()
+	require.NoError(t, err)
+
+	entries := []*logEntry{{
+		QHost:    "ads.example.org",
+		QType:    "A",
+		Upstream: "https://dns.example.net/dns-query",
+		Result: filtering.Result{
+			Reason:     filtering.FilteredBlockList,
+			IsFiltered: true,
+		},
+	}, {
+		QHost:    "www.example.org",
+		QType:    "AAAA",
+		Upstream: "tls://dns.example.com",
+	}, {
+		QHost:    "bad.example.org",
+		QType:    "A",
+		Upstream: "8.8.8.8:53",
+		Answer:   nxdomainData,
+	}, {
+		QHost:    "!bang.example.org",
+		QType:    "TXT",
+		Upstream: "8.8.8.8:53",
+	}}
+
+	testCases := []struct {
+		name       string
+		query      string
+		wantErrMsg string
+		want       []string
+	}{{
+		name:       "regexp",
+		query:      "domain_regexp=^(ads|www)\\.",
+		wantErrMsg: "",
+		want:       []string{"ads.example.org", "www.example.org"},
+	}, {
+		name:       "negated_regexp",
+		query:      "domain_regexp=!^ads\\.",
+		wantErrMsg: "",
+		want:       []string{"www.example.org", "bad.example.org", "!bang.example.org"},
+	}, {
+		name:       "negated_term",
+		query:      "search=!ads",
+		wantErrMsg: "",
+		want:       []string{"www.example.org", "bad.example.org", "!bang.example.org"},
+	}, {
+		name:       "escaped_term",
+		query:      "search=%5C!bang",
+		wantErrMsg: "",
+		want:       []string{"!bang.example.org"},
+	}, {
+		name:       "question_type",
+		query:      "question_type=aaaa",
+		wantErrMsg: "",
+		want:       []string{"www.example.org"},
+	}, {
+		name:       "response_code",
+		query:      "response_code=NXDOMAIN",
+		wantErrMsg: "",
+		want:       []string{"bad.example.org"},
+	}, {
+		name:       "upstream",
+		query:      "upstream=example",
+		wantErrMsg: "",
+		want:       []string{"ads.example.org", "www.example.org"},
+	}, {
+		name:       "upstream_strict",
+		query:      `upstream="8.8.8.8:53"`,
+		wantErrMsg: "",
+		want:       []string{"bad.example.org", "!bang.example.org"},
+	}, {
+		name:       "reason",
+		query:      "reason=FilteredBlackList",
+		wantErrMsg: "",
+		want:       []string{"ads.example.org"},
+	}, {
+		name:       "combined",
+		query:      "question_type=A&reason=!FilteredBlackList",
+		wantErrMsg: "",
+		want:       []string{"bad.example.org"},
+	}, {
+		name:       "bad_regexp",
+		query:      "domain_regexp=(",
+		wantErrMsg: "invalid domain_regexp: error parsing regexp: missing closing ): `(`",
+		want:       nil,
+	}, {
+		name:       "bad_question_type",
+		query:      "question_type=BAD",
+		wantErrMsg: `invalid question_type "BAD"`,
+		want:       nil,
+	}, {
+		name:       "bad_reason",
+		query:      "reason=Bad",
+		wantErrMsg: `invalid reason "Bad"`,
+		want:       nil,
+	}, {
+		name:       "empty_negation",
+		query:      "search=!",
+		wantErrMsg: "empty negated value",
+		want:       nil,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/control/querylog?"+tc.query, nil)
+
+			params, pErr := parseSearchParams(r)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, pErr)
+			if pErr != nil {
+				return
+			}
+
+			var got []string
+			for _, e := range entries {
+				if params.match(e) {
+					got = append(got, e.QHost)
+				}
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package querylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// streamQueueSize is the number of entries waiting to be sent to a single
+// stream subscriber.  New entries are dropped for the subscriber when its
+// queue is full.
+const streamQueueSize = 256
+
+// streamHeartbeatIvl is the interval between the comments sent to keep the
+// idle streams alive.
+const streamHeartbeatIvl = 15 * time.Second
+
+// streamMaxDuration is the maximum duration of a single stream.  It's less
+// than the write timeout of the HTTP server to close the stream gracefully.
+// The EventSource clients reconnect automatically.
+const streamMaxDuration = 4 * time.Minute
+
+// streamRetryMs is the reconnection delay suggested to the clients, in
+// milliseconds.
+const streamRetryMs = 1000
+
+// streamSubscriber is a single client of the query log stream.
+type streamSubscriber struct {
+	entries chan *logEntry
+}
+
+// streamHub distributes the new log entries to the stream subscribers.
+type streamHub struct {
+	// mu protects subs.
+	mu *sync.Mutex
+
+	subs map[*streamSubscriber]struct{}
+}
+
+// newStreamHub returns a new properly initialized *streamHub.
+func newStreamHub() (h *streamHub) {
+	return &streamHub{
+		mu:   &sync.Mutex{},
+		subs: map[*streamSubscriber]struct{}{},
+	}
+}
+
+// subscribe adds a new subscriber.  It must be unsubscribed when it's no longer
+// used.
+func (h *streamHub) subscribe() (s *streamSubscriber) {
+	s = &streamSubscriber{
+		entries: make(chan *logEntry, streamQueueSize),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+// unsubscribe removes s from the subscribers.
+func (h *streamHub) unsubscribe(s *streamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, s)
+}
+
+// publish sends e to all subscribers.  It never blocks.
+func (h *streamHub) publish(e *logEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		select {
+		case s.entries <- e:
+			// Go on.
+		default:
+			log.Debug("querylog: stream: subscriber queue is full, dropping entry")
+		}
+	}
+}
+
+// handleQueryLogStream is the handler for the GET /control/querylog/stream HTTP
+// API.  It sends the new log entries matching the search parameters as
+// server-sent events.
+func (l *queryLog) handleQueryLogStream(w http.ResponseWriter, r *http.Request) {
+	params, err := parseSearchParams(r)
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	// Only the new entries are streamed.
+	params.olderThan = time.Time{}
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "streaming is not supported")
+
+		return
+	}
+
+	sub := l.stream.subscribe()
+	defer l.stream.unsubscribe(sub)
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, "text/event-stream")
+	h.Set(httphdr.CacheControl, "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	err = l.writeStream(w, f, r, params, sub)
+	if err != nil {
+		log.Debug("querylog: stream: %s", err)
+	}
+}
+
+// writeStream writes the entries received by sub and matching params to w
+// until the request is done or the maximum duration is reached.
+func (l *queryLog) writeStream(
+	w io.Writer,
+	f http.Flusher,
+	r *http.Request,
+	params *searchParams,
+	sub *streamSubscriber,
+) (err error) {
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", streamRetryMs)
+	if err != nil {
+		return fmt.Errorf("writing retry: %w", err)
+	}
+
+	f.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatIvl)
+	defer heartbeat.Stop()
+
+	deadline := time.NewTimer(streamMaxDuration)
+	defer deadline.Stop()
+
+	cache := clientCache{}
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-heartbeat.C:
+			_, err = io.WriteString(w, ": heartbeat\n\n")
+		case e := <-sub.entries:
+			err = l.writeStreamEntry(w, e, params, cache)
+		}
+
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return err
+		}
+
+		f.Flush()
+	}
+}
+
+// writeStreamEntry writes e as an event to w if it matches params.
+func (l *queryLog) writeStreamEntry(
+	w io.Writer,
+	e *logEntry,
+	params *searchParams,
+	cache clientCache,
+) (err error) {
+	// A shallow clone is enough, since only the client field is modified.
+	e = e.shallowClone()
+	e.client, err = l.client(e.ClientID, e.IP.String(), cache)
+	if err != nil {
+		log.Error("querylog: stream: enriching entry for client %q: %s", e.IP, err)
+
+		// Go on and try to match anyway.
+	}
+
+	if !params.match(e) {
+		return nil
+	}
+
+	data, err := json.Marshal(entryToJSON(e, l.anonymizer.Load()))
+	if err != nil {
+		return fmt.Errorf("encoding entry: %w", err)
+	}
+
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	if err != nil {
+		return fmt.Errorf("writing entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package querylog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLog_handleQueryLogStream(t *testing.T) {
+	l, err := newQueryLog(Config{
+		Enabled:     true,
+		RotationIvl: timeutil.Day,
+		MemSize:     100,
+		BaseDir:     t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(l.handleQueryLogStream))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?search=example.org", nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(resp.Body)
+
+	// Wait for the subscription.
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "retry: "))
+
+	addEntry(l, "example.com", net.IPv4(1, 1, 1, 1), net.IPv4(2, 2, 2, 1))
+	addEntry(l, "example.org", net.IPv4(1, 1, 1, 2), net.IPv4(2, 2, 2, 2))
+
+	// Skip the heartbeats, if any.
+	var data string
+	for found := false; !found; {
+		line, err = r.ReadString('\n')
+		require.NoError(t, err)
+
+		data, found = strings.CutPrefix(line, "data: ")
+	}
+
+	obj := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(data), &obj))
+
+	q, ok := obj["question"].(map[string]any)
+	require.True(t, ok)
+
+	assert.Equal(t, "example.org", q["name"])
+}
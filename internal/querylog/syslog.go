@@ -0,0 +1,304 @@
+package querylog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghnet"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// SyslogConfig is the configuration of the syslog output of the query log.
+type SyslogConfig struct {
+	// Network is the network of the syslog server.  Supported values are
+	// "udp", "tcp", "unix", and "unixgram".
+	Network string `yaml:"network"`
+
+	// Address is the address of the syslog server, e.g. "192.0.2.1:514" or
+	// "/dev/log".
+	Address string `yaml:"address"`
+
+	// Tag is the APP-NAME of the syslog messages.  If empty,
+	// [defaultSyslogTag] is used.
+	Tag string `yaml:"tag"`
+
+	// Enabled defines if the query log entries are written to syslog.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Validate returns an error if c contains invalid values.
+func (c *SyslogConfig) Validate() (err error) {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch c.Network {
+	case "udp", "tcp", "unix", "unixgram":
+		// Go on.
+	default:
+		return fmt.Errorf("network: unsupported value %q", c.Network)
+	}
+
+	if c.Address == "" {
+		return errors.Error("address: empty value")
+	}
+
+	return nil
+}
+
+// defaultSyslogTag is the default APP-NAME of the syslog messages.
+const defaultSyslogTag = "AdGuardHome"
+
+// syslogQueueSize is the number of entries waiting to be sent to syslog.  New
+// entries are dropped when the queue is full.
+const syslogQueueSize = 1024
+
+// syslogDialTimeout is the timeout for connecting to the syslog server.
+const syslogDialTimeout = 5 * time.Second
+
+// syslogWriteTimeout is the timeout for writing a message to the syslog server.
+const syslogWriteTimeout = 5 * time.Second
+
+// Backoff bounds of reconnecting to the syslog server.  The delay doubles after
+// each failed attempt and is reset once a message is written.
+const (
+	syslogMinBackoff = 1 * time.Second
+	syslogMaxBackoff = 1 * time.Minute
+)
+
+// errSyslogBackoff is returned when the message is dropped, because the sink is
+// waiting before the next attempt to reconnect.
+const errSyslogBackoff errors.Error = "waiting to reconnect"
+
+// syslogPriority is the PRI value of the messages: the "user-level" facility
+// and the "informational" severity, see RFC 5424 Section 6.2.1.
+const syslogPriority = 1*8 + 6
+
+// syslogSDID is the SD-ID of the structured data element of the messages.  The
+// enterprise number is the one reserved for documentation.
+const syslogSDID = "query@32473"
+
+// syslogSink writes the query log entries to syslog in the RFC 5424 format.
+type syslogSink struct {
+	// mu protects conn, nextDial, and backoff.
+	mu *sync.Mutex
+
+	conn net.Conn
+
+	// nextDial is the earliest time of the next attempt to reconnect.
+	nextDial time.Time
+
+	anonymizer *aghnet.IPMut
+
+	queue chan *logEntry
+
+	// done is closed when the sink is stopped.
+	done chan struct{}
+
+	network  string
+	address  string
+	tag      string
+	hostname string
+	procID   string
+
+	// backoff is the delay before the next attempt to reconnect after a
+	// failure.
+	backoff time.Duration
+}
+
+// newSyslogSink returns a new properly initialized *syslogSink.  conf must be
+// valid.  anonymizer may be nil.
+func newSyslogSink(conf *SyslogConfig, anonymizer *aghnet.IPMut) (s *syslogSink) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	tag := conf.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+
+	if anonymizer == nil {
+		anonymizer = aghnet.NewIPMut(nil)
+	}
+
+	return &syslogSink{
+		mu:         &sync.Mutex{},
+		anonymizer: anonymizer,
+		queue:      make(chan *logEntry, syslogQueueSize),
+		done:       make(chan struct{}),
+		network:    conf.Network,
+		address:    conf.Address,
+		tag:        tag,
+		hostname:   hostname,
+		procID:     strconv.Itoa(os.Getpid()),
+		backoff:    syslogMinBackoff,
+	}
+}
+
+// add queues e for sending.  It never blocks.
+func (s *syslogSink) add(e *logEntry) {
+	select {
+	case s.queue <- e:
+		// Go on.
+	default:
+		log.Debug("querylog: syslog: queue is full, dropping entry")
+	}
+}
+
+// run sends the queued entries until the sink is stopped.  It is intended to be
+// used as a goroutine.
+func (s *syslogSink) run() {
+	defer log.OnPanic("querylog: syslog")
+
+	for {
+		select {
+		case e := <-s.queue:
+			err := s.send(e)
+			if err != nil {
+				log.Debug("querylog: syslog: %s", err)
+			}
+		case <-s.done:
+			s.closeConn()
+
+			return
+		}
+	}
+}
+
+// closeConn closes the connection to the syslog server, if any.
+func (s *syslogSink) closeConn() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		err := s.conn.Close()
+		if err != nil {
+			log.Debug("querylog: syslog: closing connection: %s", err)
+		}
+
+		s.conn = nil
+	}
+}
+
+// close stops the sink.  It must only be called once.  The entries added after
+// that are dropped once the queue is full.
+func (s *syslogSink) close() {
+	close(s.done)
+}
+
+// send writes e to the syslog server, reconnecting if necessary.  Messages are
+// dropped while the sink is backing off after a failed attempt.
+func (s *syslogSink) send(e *logEntry) (err error) {
+	now := time.Now()
+	msg := s.format(e, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if now.Before(s.nextDial) {
+			return errSyslogBackoff
+		}
+
+		s.conn, err = net.DialTimeout(s.network, s.address, syslogDialTimeout)
+		if err != nil {
+			s.conn = nil
+			s.failed(now)
+
+			return fmt.Errorf("connecting: %w", err)
+		}
+	}
+
+	if s.network == "tcp" || s.network == "unix" {
+		// Use the octet counting framing for stream transports, see RFC 6587
+		// Section 3.4.1.
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	err = s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+	if err == nil {
+		_, err = s.conn.Write(msg)
+	}
+
+	if err != nil {
+		// Reconnect on the next message after the backoff.
+		err = errors.WithDeferred(err, s.conn.Close())
+		s.conn = nil
+		s.failed(now)
+
+		return fmt.Errorf("writing: %w", err)
+	}
+
+	s.backoff = syslogMinBackoff
+
+	return nil
+}
+
+// failed schedules the next attempt to reconnect and increases the backoff.
+// s.mu must be locked.
+func (s *syslogSink) failed(now time.Time) {
+	s.nextDial = now.Add(s.backoff)
+	s.backoff = min(2*s.backoff, syslogMaxBackoff)
+}
+
+// format returns the RFC 5424 message for e.
+func (s *syslogSink) format(e *logEntry, now time.Time) (msg []byte) {
+	ip := slices.Clone(e.IP)
+	s.anonymizer.Load()(ip)
+
+	var rules []string
+	for _, r := range e.Result.Rules {
+		rules = append(rules, r.Text)
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(
+		b,
+		"<%d>1 %s %s %s %s query [%s",
+		syslogPriority,
+		now.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.tag,
+		s.procID,
+		syslogSDID,
+	)
+
+	for _, p := range []struct {
+		name string
+		val  string
+	}{
+		{name: "time", val: e.Time.Format(time.RFC3339Nano)},
+		{name: "host", val: e.QHost},
+		{name: "type", val: e.QType},
+		{name: "client", val: ip.String()},
+		{name: "client_id", val: e.ClientID},
+		{name: "client_proto", val: string(e.ClientProto)},
+		{name: "reason", val: e.Result.Reason.String()},
+		{name: "rules", val: strings.Join(rules, "; ")},
+		{name: "upstream", val: e.Upstream},
+		{name: "elapsed_ms", val: strconv.FormatFloat(e.Elapsed.Seconds()*1000, 'f', -1, 64)},
+		{name: "cached", val: strconv.FormatBool(e.Cached)},
+	} {
+		if p.val != "" {
+			fmt.Fprintf(b, ` %s="%s"`, p.name, sdParamEscaper.Replace(p.val))
+		}
+	}
+
+	fmt.Fprintf(b, "] %s %s from %s: %s", e.QHost, e.QType, ip, e.Result.Reason)
+
+	return b.Bytes()
+}
+
+// sdParamEscaper escapes the characters that must be escaped in the values of
+// the structured data parameters, see RFC 5424 Section 6.3.3.
+var sdParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
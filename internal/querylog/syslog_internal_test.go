@@ -0,0 +1,122 @@
+package querylog
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/filtering"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		conf       *SyslogConfig
+		name       string
+		wantErrMsg string
+	}{{
+		conf:       &SyslogConfig{Enabled: false, Network: "bad"},
+		name:       "disabled",
+		wantErrMsg: "",
+	}, {
+		conf:       &SyslogConfig{Enabled: true, Network: "udp", Address: "127.0.0.1:514"},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf:       &SyslogConfig{Enabled: true, Network: "bad", Address: "127.0.0.1:514"},
+		name:       "bad_network",
+		wantErrMsg: `network: unsupported value "bad"`,
+	}, {
+		conf:       &SyslogConfig{Enabled: true, Network: "tcp"},
+		name:       "no_address",
+		wantErrMsg: "address: empty value",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, tc.conf.Validate())
+		})
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, pc.Close)
+
+	s := newSyslogSink(&SyslogConfig{
+		Network: "udp",
+		Address: pc.LocalAddr().String(),
+		Tag:     "test",
+		Enabled: true,
+	}, nil)
+
+	go s.run()
+	t.Cleanup(s.close)
+
+	s.add(&logEntry{
+		Time:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		QHost: "example.org",
+		QType: "A",
+		IP:    net.IP{1, 2, 3, 4},
+		Result: filtering.Result{
+			Rules: []*filtering.ResultRule{{
+				Text: `||example.org^$client="a]b"`,
+			}},
+			Reason: filtering.FilteredBlockList,
+		},
+	})
+
+	require.NoError(t, pc.SetReadDeadline(time.Now().Add(time.Second)))
+
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<14>1 "))
+	assert.Contains(t, msg, " test ")
+	assert.Contains(t, msg, `[query@32473 time="2024-01-01T00:00:00Z" host="example.org"`)
+	assert.Contains(t, msg, `rules="||example.org^$client=\"a\]b\""`)
+	assert.True(t, strings.HasSuffix(msg, "] example.org A from 1.2.3.4: FilteredBlackList"))
+}
+
+func TestSyslogSink_send_backoff(t *testing.T) {
+	// Get a free port and close the listener, so that connecting fails.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	s := newSyslogSink(&SyslogConfig{
+		Network: "tcp",
+		Address: addr,
+		Enabled: true,
+	}, nil)
+
+	e := &logEntry{
+		QHost: "example.org",
+		QType: "A",
+		IP:    net.IP{1, 2, 3, 4},
+	}
+
+	err = s.send(e)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errSyslogBackoff)
+	assert.Equal(t, 2*syslogMinBackoff, s.backoff)
+
+	err = s.send(e)
+	assert.ErrorIs(t, err, errSyslogBackoff)
+
+	// Allow the next attempt and check that the backoff grows.
+	s.nextDial = time.Time{}
+
+	err = s.send(e)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errSyslogBackoff)
+	assert.Equal(t, 4*syslogMinBackoff, s.backoff)
+}
@@ -0,0 +1,276 @@
+package routescript
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a lexical token.
+type tokenKind uint8
+
+// Token kinds.
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp
+	tokPunct
+)
+
+// token is a lexical token.
+type token struct {
+	val  string
+	kind tokenKind
+	pos  int
+}
+
+// String implements the [fmt.Stringer] interface for token.
+func (t token) String() (s string) {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return "string " + t.val
+	default:
+		return strconv.Quote(t.val)
+	}
+}
+
+// lexer splits the source into tokens.
+type lexer struct {
+	src string
+	pos int
+}
+
+// newLexer returns a new lexer of src.
+func newLexer(src string) (l *lexer) {
+	return &lexer{src: src}
+}
+
+// operators are the symbolic operators and punctuation, the longer ones
+// first.
+var operators = []string{"&&", "||", "==", "!=", "!", "(", ")", "[", "]", ","}
+
+// next returns the next token.
+func (l *lexer) next() (t token, err error) {
+	l.pos += len(l.src[l.pos:]) - len(strings.TrimLeftFunc(l.src[l.pos:], unicode.IsSpace))
+	rest := l.src[l.pos:]
+	t.pos = l.pos
+	if rest == "" {
+		return t, nil
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			t.val, t.kind = op, tokPunct
+			if len(op) == 2 || op == "!" {
+				t.kind = tokOp
+			}
+
+			l.pos += len(op)
+
+			return t, nil
+		}
+	}
+
+	r, _ := utf8.DecodeRuneInString(rest)
+	switch {
+	case r == '"':
+		var q string
+		q, err = strconv.QuotedPrefix(rest)
+		if err != nil {
+			return t, fmt.Errorf("at %d: bad string", l.pos)
+		}
+
+		// The prefix is known to be a valid quoted string.
+		t.val, _ = strconv.Unquote(q)
+		t.kind = tokString
+		l.pos += len(q)
+	case r == '_' || unicode.IsLetter(r):
+		end := strings.IndexFunc(rest, func(c rune) (ok bool) {
+			return c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c)
+		})
+		if end < 0 {
+			end = len(rest)
+		}
+
+		t.val, t.kind = rest[:end], tokIdent
+		l.pos += end
+	default:
+		return t, fmt.Errorf("at %d: unexpected character %q", l.pos, r)
+	}
+
+	return t, nil
+}
+
+// parser is a recursive-descent parser of the expressions.
+type parser struct {
+	lex *lexer
+
+	// err is the first lexical error, if any.
+	err error
+
+	tok token
+}
+
+// next advances p to the next token.
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = token{kind: tokEOF, pos: p.lex.pos}
+	}
+}
+
+// errorf returns the error at the current token, unless there is a lexical
+// error already.
+func (p *parser) errorf(format string, args ...any) (err error) {
+	if p.err != nil {
+		return p.err
+	}
+
+	return fmt.Errorf("at %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// is returns true if the current token is the operator or punctuation val.
+func (p *parser) is(val string) (ok bool) {
+	return (p.tok.kind == tokOp || p.tok.kind == tokPunct) && p.tok.val == val
+}
+
+// parseOr parses a disjunction.
+func (p *parser) parseOr() (n node, err error) {
+	n, err = p.parseAnd()
+	for err == nil && p.is("||") {
+		p.next()
+
+		var right node
+		right, err = p.parseAnd()
+		n = &orNode{left: n, right: right}
+	}
+
+	return n, err
+}
+
+// parseAnd parses a conjunction.
+func (p *parser) parseAnd() (n node, err error) {
+	n, err = p.parseUnary()
+	for err == nil && p.is("&&") {
+		p.next()
+
+		var right node
+		right, err = p.parseUnary()
+		n = &andNode{left: n, right: right}
+	}
+
+	return n, err
+}
+
+// parseUnary parses a negation, a parenthesized expression, or a condition.
+func (p *parser) parseUnary() (n node, err error) {
+	switch {
+	case p.is("!"):
+		p.next()
+
+		n, err = p.parseUnary()
+
+		return &notNode{x: n}, err
+	case p.is("("):
+		p.next()
+
+		n, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		} else if !p.is(")") {
+			return nil, p.errorf("expected \")\", got %s", p.tok)
+		}
+
+		p.next()
+
+		return n, nil
+	default:
+		return p.parseCond()
+	}
+}
+
+// parseCond parses a condition.
+func (p *parser) parseCond() (n node, err error) {
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("expected field, got %s", p.tok)
+	}
+
+	field := p.tok.val
+	switch field {
+	case fieldName, fieldQType, fieldClient, fieldClientID, fieldDecision:
+		// Go on.
+	default:
+		return nil, p.errorf("unknown field %q", field)
+	}
+
+	p.next()
+
+	op := p.tok.val
+	switch {
+	case p.tok.kind == tokOp && (op == opEq || op == opNe),
+		p.tok.kind == tokIdent && (op == opIn || op == opSuffix || op == opMatches):
+		// Go on.
+	default:
+		return nil, p.errorf("expected operator, got %s", p.tok)
+	}
+
+	p.next()
+
+	pos := p.tok.pos
+	values, isList, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if field == fieldClient {
+		n, err = newClientCond(op, values, isList)
+	} else {
+		n, err = newStrCond(field, op, values, isList)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("at %d: %w", pos, err)
+	}
+
+	return n, nil
+}
+
+// parseValue parses a string or a list of strings.
+func (p *parser) parseValue() (values []string, isList bool, err error) {
+	if p.tok.kind == tokString {
+		values = []string{p.tok.val}
+		p.next()
+
+		return values, false, nil
+	} else if !p.is("[") {
+		return nil, false, p.errorf("expected value, got %s", p.tok)
+	}
+
+	p.next()
+	for {
+		if p.tok.kind != tokString {
+			return nil, false, p.errorf("expected string, got %s", p.tok)
+		}
+
+		values = append(values, p.tok.val)
+		p.next()
+
+		if p.is("]") {
+			p.next()
+
+			return values, true, nil
+		} else if !p.is(",") {
+			return nil, false, p.errorf("expected \",\" or \"]\", got %s", p.tok)
+		}
+
+		p.next()
+	}
+}
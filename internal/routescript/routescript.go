@@ -0,0 +1,290 @@
+// Package routescript implements the expressions of the routing rules, which
+// match the DNS requests by their properties and the filtering decision.
+//
+// The expressions have the following syntax:
+//
+//	expr    = and { "||" and } .
+//	and     = unary { "&&" unary } .
+//	unary   = "!" unary | "(" expr ")" | cond .
+//	cond    = field op value .
+//	field   = "name" | "qtype" | "client" | "client_id" | "decision" .
+//	op      = "==" | "!=" | "in" | "suffix" | "matches" .
+//	value   = string | "[" string { "," string } "]" .
+//
+// The strings are double-quoted with the Go escapes.  Only operator "in"
+// accepts lists.  For field client, the values of operator "in" are CIDRs and
+// the operators "suffix" and "matches" aren't allowed.  The names are compared
+// case-insensitively and without the trailing dot.  For example:
+//
+//	name suffix "corp.example" && client in ["10.0.0.0/8", "fd00::/8"]
+package routescript
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Decision is the filtering decision made for a request.
+type Decision string
+
+// Decision values.
+const (
+	DecisionNone      Decision = "none"
+	DecisionAllowed   Decision = "allowed"
+	DecisionBlocked   Decision = "blocked"
+	DecisionRewritten Decision = "rewritten"
+)
+
+// validate returns an error if d isn't a known decision.
+func (d Decision) validate() (err error) {
+	switch d {
+	case DecisionNone, DecisionAllowed, DecisionBlocked, DecisionRewritten:
+		return nil
+	default:
+		return fmt.Errorf("unknown decision %q", d)
+	}
+}
+
+// Env are the properties of a request the expressions are evaluated against.
+type Env struct {
+	// Client is the address of the client.
+	Client netip.Addr
+
+	// Name is the queried name.  It's compared case-insensitively and without
+	// the trailing dot.
+	Name string
+
+	// QType is the textual type of the question, for example "AAAA".
+	QType string
+
+	// ClientID is the ClientID of the client, if any.
+	ClientID string
+
+	// Decision is the filtering decision made for the request.
+	Decision Decision
+}
+
+// Expr is a compiled expression.
+type Expr struct {
+	root node
+	src  string
+}
+
+// Compile parses src into an expression.
+func Compile(src string) (e *Expr, err error) {
+	p := &parser{lex: newLexer(src)}
+	p.next()
+
+	root, err := p.parseOr()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("compiling %q: %w", src, err)
+	}
+
+	return &Expr{
+		root: root,
+		src:  src,
+	}, nil
+}
+
+// Match returns true if env matches e.  env must not be nil.
+func (e *Expr) Match(env *Env) (ok bool) {
+	return e.root.eval(env)
+}
+
+// String implements the [fmt.Stringer] interface for *Expr.
+func (e *Expr) String() (s string) {
+	return e.src
+}
+
+// node is a node of the expression tree.
+type node interface {
+	eval(env *Env) (ok bool)
+}
+
+// orNode is the "||" operator.
+type orNode struct {
+	left, right node
+}
+
+// eval implements the [node] interface for *orNode.
+func (n *orNode) eval(env *Env) (ok bool) { return n.left.eval(env) || n.right.eval(env) }
+
+// andNode is the "&&" operator.
+type andNode struct {
+	left, right node
+}
+
+// eval implements the [node] interface for *andNode.
+func (n *andNode) eval(env *Env) (ok bool) { return n.left.eval(env) && n.right.eval(env) }
+
+// notNode is the "!" operator.
+type notNode struct {
+	x node
+}
+
+// eval implements the [node] interface for *notNode.
+func (n *notNode) eval(env *Env) (ok bool) { return !n.x.eval(env) }
+
+// Fields of the requests.
+const (
+	fieldName     = "name"
+	fieldQType    = "qtype"
+	fieldClient   = "client"
+	fieldClientID = "client_id"
+	fieldDecision = "decision"
+)
+
+// Operators of the conditions.
+const (
+	opEq      = "=="
+	opNe      = "!="
+	opIn      = "in"
+	opSuffix  = "suffix"
+	opMatches = "matches"
+)
+
+// strCond is a condition on a string field.
+type strCond struct {
+	re     *regexp.Regexp
+	field  string
+	op     string
+	values []string
+}
+
+// newStrCond returns a new condition on a string field, validating and
+// normalizing the values.  The regular expressions are matched against the
+// normalized names as is.
+func newStrCond(field, op string, values []string, isList bool) (c *strCond, err error) {
+	if isList && op != opIn {
+		return nil, fmt.Errorf("operator %q requires a string", op)
+	}
+
+	c = &strCond{
+		field:  field,
+		op:     op,
+		values: values,
+	}
+
+	if op == opMatches {
+		c.re, err = regexp.Compile(values[0])
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	for i, v := range values {
+		switch field {
+		case fieldName:
+			values[i] = normalizeName(v)
+		case fieldQType:
+			values[i] = strings.ToUpper(v)
+		case fieldDecision:
+			err = Decision(v).validate()
+			if err != nil {
+				// Don't wrap the error since it's informative enough as is.
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// eval implements the [node] interface for *strCond.
+func (c *strCond) eval(env *Env) (ok bool) {
+	var v string
+	switch c.field {
+	case fieldName:
+		v = normalizeName(env.Name)
+	case fieldQType:
+		v = env.QType
+	case fieldClientID:
+		v = env.ClientID
+	default:
+		v = string(env.Decision)
+	}
+
+	switch c.op {
+	case opEq:
+		return v == c.values[0]
+	case opNe:
+		return v != c.values[0]
+	case opIn:
+		return slices.Contains(c.values, v)
+	case opSuffix:
+		return v == c.values[0] || strings.HasSuffix(v, "."+c.values[0])
+	default:
+		return c.re.MatchString(v)
+	}
+}
+
+// normalizeName returns the lowercased name without the trailing dot.
+func normalizeName(name string) (norm string) {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// clientCond is a condition on the client address.
+type clientCond struct {
+	addr netip.Addr
+	nets []netip.Prefix
+	op   string
+}
+
+// newClientCond returns a new condition on the client address.
+func newClientCond(op string, values []string, isList bool) (c *clientCond, err error) {
+	c = &clientCond{op: op}
+	switch op {
+	case opEq, opNe:
+		if isList {
+			return nil, fmt.Errorf("operator %q requires a string", op)
+		}
+
+		c.addr, err = netip.ParseAddr(values[0])
+		if err != nil {
+			// Don't wrap the error since it's informative enough as is.
+			return nil, err
+		}
+
+		c.addr = c.addr.Unmap()
+	case opIn:
+		for _, v := range values {
+			var p netip.Prefix
+			p, err = netip.ParsePrefix(v)
+			if err != nil {
+				// Don't wrap the error since it's informative enough as is.
+				return nil, err
+			}
+
+			c.nets = append(c.nets, p.Masked())
+		}
+	default:
+		return nil, fmt.Errorf("operator %q is not supported for field %q", op, fieldClient)
+	}
+
+	return c, nil
+}
+
+// eval implements the [node] interface for *clientCond.
+func (c *clientCond) eval(env *Env) (ok bool) {
+	ip := env.Client.Unmap()
+	switch c.op {
+	case opEq:
+		return ip == c.addr
+	case opNe:
+		return ip != c.addr
+	default:
+		return slices.ContainsFunc(c.nets, func(p netip.Prefix) (contains bool) {
+			return p.Contains(ip)
+		})
+	}
+}
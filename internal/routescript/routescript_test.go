@@ -0,0 +1,137 @@
+package routescript_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/routescript"
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpr_Match(t *testing.T) {
+	env := &routescript.Env{
+		Client:   netip.MustParseAddr("10.1.2.3"),
+		Name:     "WWW.Corp.Example.",
+		QType:    "AAAA",
+		ClientID: "laptop",
+		Decision: routescript.DecisionAllowed,
+	}
+
+	testCases := []struct {
+		name string
+		src  string
+		want bool
+	}{{
+		name: "name_eq",
+		src:  `name == "www.corp.example."`,
+		want: true,
+	}, {
+		name: "name_suffix",
+		src:  `name suffix "corp.example"`,
+		want: true,
+	}, {
+		name: "name_suffix_partial",
+		src:  `name suffix "rp.example"`,
+		want: false,
+	}, {
+		name: "name_matches",
+		src:  `name matches "^www\\."`,
+		want: true,
+	}, {
+		name: "qtype_in",
+		src:  `qtype in ["a", "aaaa"]`,
+		want: true,
+	}, {
+		name: "qtype_ne",
+		src:  `qtype != "AAAA"`,
+		want: false,
+	}, {
+		name: "client_in",
+		src:  `client in ["192.168.0.0/16", "10.0.0.0/8"]`,
+		want: true,
+	}, {
+		name: "client_eq",
+		src:  `client == "10.1.2.4"`,
+		want: false,
+	}, {
+		name: "client_id",
+		src:  `client_id == "laptop"`,
+		want: true,
+	}, {
+		name: "decision",
+		src:  `decision == "blocked"`,
+		want: false,
+	}, {
+		name: "precedence",
+		src:  `decision == "blocked" || qtype == "AAAA" && client_id == "laptop"`,
+		want: true,
+	}, {
+		name: "parens_not",
+		src:  `!(decision == "blocked" || qtype == "AAAA") && client_id == "laptop"`,
+		want: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := routescript.Compile(tc.src)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, e.Match(env))
+		})
+	}
+}
+
+func TestCompile_errors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		src        string
+		wantErrMsg string
+	}{{
+		name:       "empty",
+		src:        ``,
+		wantErrMsg: `compiling "": at 0: expected field, got end of expression`,
+	}, {
+		name:       "unknown_field",
+		src:        `host == "a"`,
+		wantErrMsg: `compiling "host == \"a\"": at 0: unknown field "host"`,
+	}, {
+		name:       "bad_op",
+		src:        `name = "a"`,
+		wantErrMsg: `compiling "name = \"a\"": at 5: unexpected character '='`,
+	}, {
+		name:       "list_not_in",
+		src:        `name == ["a"]`,
+		wantErrMsg: `compiling "name == [\"a\"]": at 8: operator "==" requires a string`,
+	}, {
+		name: "bad_cidr",
+		src:  `client in "10.0.0.0"`,
+		wantErrMsg: `compiling "client in \"10.0.0.0\"": at 10: ` +
+			`netip.ParsePrefix("10.0.0.0"): no '/'`,
+	}, {
+		name: "client_suffix",
+		src:  `client suffix "a"`,
+		wantErrMsg: `compiling "client suffix \"a\"": at 14: ` +
+			`operator "suffix" is not supported for field "client"`,
+	}, {
+		name:       "bad_decision",
+		src:        `decision == "dropped"`,
+		wantErrMsg: `compiling "decision == \"dropped\"": at 12: unknown decision "dropped"`,
+	}, {
+		name:       "unclosed_paren",
+		src:        `(name == "a"`,
+		wantErrMsg: `compiling "(name == \"a\"": at 12: expected ")", got end of expression`,
+	}, {
+		name:       "trailing",
+		src:        `name == "a" name`,
+		wantErrMsg: `compiling "name == \"a\" name": at 12: unexpected "name"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := routescript.Compile(tc.src)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package snmp
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// BER tags of the universal types.
+const (
+	tagInteger     byte = 0x02
+	tagOctetString byte = 0x04
+	tagNull        byte = 0x05
+	tagObjectID    byte = 0x06
+	tagSequence    byte = 0x30
+)
+
+// errUnexpectedEnd is returned when the data ends before the element does.
+const errUnexpectedEnd errors.Error = "unexpected end of data"
+
+// appendTLV appends the element with tag and the contents val to b.
+func appendTLV(b []byte, tag byte, val []byte) (res []byte) {
+	b = append(b, tag)
+	b = appendLength(b, len(val))
+
+	return append(b, val...)
+}
+
+// appendLength appends the definite-form encoding of the length n to b.
+func appendLength(b []byte, n int) (res []byte) {
+	if n < 0x80 {
+		return append(b, byte(n))
+	}
+
+	var buf [4]byte
+	i := len(buf)
+	for ; n > 0; n >>= 8 {
+		i--
+		buf[i] = byte(n)
+	}
+
+	b = append(b, 0x80|byte(len(buf)-i))
+
+	return append(b, buf[i:]...)
+}
+
+// appendInt appends the minimal two's complement encoding of v to b.
+func appendInt(b []byte, v int64) (res []byte) {
+	n := 1
+	for x := v; x > 127 || x < -128; x >>= 8 {
+		n++
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+
+	return b
+}
+
+// appendUint appends the minimal encoding of the unsigned v to b, which has a
+// leading zero byte if the most significant bit is set.
+func appendUint(b []byte, v uint64) (res []byte) {
+	n := 1
+	for x := v; x > 127; x >>= 8 {
+		n++
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+
+	return b
+}
+
+// appendOID appends the encoding of oid to b.  oid must have at least two arcs.
+func appendOID(b []byte, oid OID) (res []byte) {
+	b = appendBase128(b, oid[0]*40+oid[1])
+	for _, arc := range oid[2:] {
+		b = appendBase128(b, arc)
+	}
+
+	return b
+}
+
+// appendBase128 appends the base-128 encoding of an OID arc v to b.
+func appendBase128(b []byte, v uint32) (res []byte) {
+	var buf [5]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+
+	return append(b, buf[i:]...)
+}
+
+// readTLV reads a single element from b.  rest is the data after the element.
+func readTLV(b []byte) (tag byte, val, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errUnexpectedEnd
+	}
+
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		l := n & 0x7f
+		if l == 0 || l > 4 {
+			return 0, nil, nil, fmt.Errorf("unsupported length of %d bytes", l)
+		} else if len(b) < l {
+			return 0, nil, nil, errUnexpectedEnd
+		}
+
+		n = 0
+		for _, d := range b[:l] {
+			n = n<<8 | int(d)
+		}
+
+		b = b[l:]
+	}
+
+	if n < 0 || n > len(b) {
+		return 0, nil, nil, errUnexpectedEnd
+	}
+
+	return tag, b[:n], b[n:], nil
+}
+
+// readExpected reads a single element with the tag want from b.
+func readExpected(b []byte, want byte) (val, rest []byte, err error) {
+	tag, val, rest, err := readTLV(b)
+	if err != nil {
+		// Don't wrap the error since the callers do.
+		return nil, nil, err
+	} else if tag != want {
+		return nil, nil, fmt.Errorf("unexpected tag 0x%02x, want 0x%02x", tag, want)
+	}
+
+	return val, rest, nil
+}
+
+// readInt reads an integer element from b.
+func readInt(b []byte) (v int64, rest []byte, err error) {
+	val, rest, err := readExpected(b, tagInteger)
+	if err != nil {
+		// Don't wrap the error since the callers do.
+		return 0, nil, err
+	} else if len(val) == 0 || len(val) > 8 {
+		return 0, nil, fmt.Errorf("bad integer length %d", len(val))
+	}
+
+	v = int64(int8(val[0]))
+	for _, d := range val[1:] {
+		v = v<<8 | int64(d)
+	}
+
+	return v, rest, nil
+}
+
+// parseOID parses the contents of an object identifier element.
+func parseOID(val []byte) (oid OID, err error) {
+	if len(val) == 0 {
+		return nil, errors.Error("empty object identifier")
+	}
+
+	var arc uint32
+	for i, d := range val {
+		if arc > 1<<25 {
+			return nil, errors.Error("object identifier arc overflow")
+		}
+
+		arc = arc<<7 | uint32(d&0x7f)
+		if d&0x80 != 0 {
+			if i == len(val)-1 {
+				return nil, errUnexpectedEnd
+			}
+
+			continue
+		}
+
+		if oid == nil {
+			oid = splitFirstArc(arc)
+		} else {
+			oid = append(oid, arc)
+		}
+
+		arc = 0
+	}
+
+	return oid, nil
+}
+
+// splitFirstArc returns the first two arcs of an OID encoded as the single
+// first subidentifier v.
+func splitFirstArc(v uint32) (oid OID) {
+	switch {
+	case v < 40:
+		return OID{0, v}
+	case v < 80:
+		return OID{1, v - 40}
+	default:
+		return OID{2, v - 80}
+	}
+}
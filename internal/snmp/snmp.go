@@ -0,0 +1,624 @@
+// Package snmp implements a minimal read-only SNMPv2c and SNMPv3 agent.
+//
+// See RFC 1901, RFC 2578, RFC 3412, RFC 3414, RFC 3416, and RFC 3826.
+package snmp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// versionV2c is the value of the version field of SNMPv2c messages.
+const versionV2c = 1
+
+// PDU types.
+const (
+	pduGet      byte = 0xa0
+	pduGetNext  byte = 0xa1
+	pduResponse byte = 0xa2
+	pduSet      byte = 0xa3
+	pduGetBulk  byte = 0xa5
+)
+
+// Error statuses of the responses.
+const (
+	statusNoError     = 0
+	statusTooBig      = 1
+	statusNotWritable = 17
+)
+
+// maxMsgSize is the maximum size of the messages the agent receives and sends.
+const maxMsgSize = 8192
+
+// maxBulkVars is the maximum number of the variable bindings in a response to
+// a GetBulkRequest.
+const maxBulkVars = 256
+
+// OID is an object identifier.
+type OID []uint32
+
+// ParseOID parses the dotted-decimal representation of an object identifier,
+// for example "1.3.6.1.2.1.1.1.0".
+func ParseOID(s string) (oid OID, err error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("oid %q: too few arcs", s)
+	}
+
+	oid = make(OID, 0, len(parts))
+	for _, p := range parts {
+		var arc uint64
+		arc, err = strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("oid %q: %w", s, err)
+		}
+
+		oid = append(oid, uint32(arc))
+	}
+
+	if oid[0] > 2 || (oid[0] < 2 && oid[1] >= 40) {
+		return nil, fmt.Errorf("oid %q: bad first arcs", s)
+	}
+
+	return oid, nil
+}
+
+// String implements the [fmt.Stringer] interface for OID.
+func (oid OID) String() (s string) {
+	b := &strings.Builder{}
+	for i, arc := range oid {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+
+		b.WriteString(strconv.FormatUint(uint64(arc), 10))
+	}
+
+	return b.String()
+}
+
+// Append returns a new OID with arcs appended to oid.
+func (oid OID) Append(arcs ...uint32) (res OID) {
+	return append(slices.Clip(oid), arcs...)
+}
+
+// Type is the type of the value of a variable.
+type Type byte
+
+// Value types.
+const (
+	TypeInteger     Type = Type(tagInteger)
+	TypeOctetString Type = Type(tagOctetString)
+	TypeObjectID    Type = Type(tagObjectID)
+	TypeCounter32   Type = 0x41
+	TypeGauge32     Type = 0x42
+	TypeTimeTicks   Type = 0x43
+	TypeCounter64   Type = 0x46
+
+	// The exceptions, which are only used in the responses.
+	typeNoSuchObject Type = 0x80
+	typeEndOfMIBView Type = 0x82
+)
+
+// Variable is a single object exposed by the agent.
+type Variable struct {
+	// OID is the identifier of the object.
+	OID OID
+
+	// ObjectID is the value of a [TypeObjectID] variable.
+	ObjectID OID
+
+	// Str is the value of a [TypeOctetString] variable.
+	Str string
+
+	// Int is the value of a [TypeInteger] variable.
+	Int int64
+
+	// Uint is the value of the counter, gauge, and time ticks variables.
+	Uint uint64
+
+	// Type is the type of the value.
+	Type Type
+}
+
+// Integer returns a new variable of [TypeInteger].
+func Integer(oid OID, v int64) (vr *Variable) {
+	return &Variable{OID: oid, Int: v, Type: TypeInteger}
+}
+
+// OctetString returns a new variable of [TypeOctetString].
+func OctetString(oid OID, v string) (vr *Variable) {
+	return &Variable{OID: oid, Str: v, Type: TypeOctetString}
+}
+
+// ObjectID returns a new variable of [TypeObjectID].  v must have at least two
+// arcs.
+func ObjectID(oid, v OID) (vr *Variable) {
+	return &Variable{OID: oid, ObjectID: v, Type: TypeObjectID}
+}
+
+// Gauge32 returns a new variable of [TypeGauge32].
+func Gauge32(oid OID, v uint32) (vr *Variable) {
+	return &Variable{OID: oid, Uint: uint64(v), Type: TypeGauge32}
+}
+
+// TimeTicks returns a new variable of [TypeTimeTicks].  v is in hundredths of
+// a second.
+func TimeTicks(oid OID, v uint32) (vr *Variable) {
+	return &Variable{OID: oid, Uint: uint64(v), Type: TypeTimeTicks}
+}
+
+// Counter64 returns a new variable of [TypeCounter64].
+func Counter64(oid OID, v uint64) (vr *Variable) {
+	return &Variable{OID: oid, Uint: v, Type: TypeCounter64}
+}
+
+// appendVarBind appends the encoded variable binding of vr to b.
+func appendVarBind(b []byte, vr *Variable) (res []byte) {
+	val := appendTLV(nil, tagObjectID, appendOID(nil, vr.OID))
+	switch vr.Type {
+	case TypeInteger:
+		val = appendTLV(val, tagInteger, appendInt(nil, vr.Int))
+	case TypeOctetString:
+		val = appendTLV(val, tagOctetString, []byte(vr.Str))
+	case TypeObjectID:
+		val = appendTLV(val, tagObjectID, appendOID(nil, vr.ObjectID))
+	case TypeCounter32, TypeGauge32, TypeTimeTicks, TypeCounter64:
+		val = appendTLV(val, byte(vr.Type), appendUint(nil, vr.Uint))
+	default:
+		// The exceptions and the unknown types have no contents.
+		val = appendTLV(val, byte(vr.Type), nil)
+	}
+
+	return appendTLV(b, tagSequence, val)
+}
+
+// Config is the configuration of an [Agent].
+type Config struct {
+	// MIB returns the objects exposed by the agent in any order.  It's called
+	// once for each request.  It must not be nil.
+	MIB func() (vars []*Variable)
+
+	// Users are the SNMPv3 users.  If empty, the SNMPv3 requests are answered
+	// with the unknown user name reports.
+	Users []*User
+
+	// EngineID is the SNMPv3 engine ID of the agent.  If empty, a random one
+	// is generated.  Otherwise, it must be from 5 to 32 bytes long.
+	EngineID []byte
+
+	// Community is the community string the SNMPv2c requests must contain.  If
+	// empty, the SNMPv2c requests are ignored.  It must not be empty if Users
+	// are empty.
+	Community string
+
+	// Addr is the UDP address to listen on.
+	Addr netip.AddrPort
+}
+
+// Agent answers the SNMPv2c and SNMPv3 read requests.  SNMPv1 messages are
+// ignored.
+//
+// The snmpEngineBoots of the agent is the Unix time of its creation, so that it
+// increases with each restart without any persistent state.
+type Agent struct {
+	conn *net.UDPConn
+
+	// stopped is closed when the serving goroutine has exited.
+	stopped chan struct{}
+
+	mib func() (vars []*Variable)
+
+	// users are the SNMPv3 users by their names.
+	users map[string]*usmUser
+
+	// start is the time of the creation of the agent, which the snmpEngineTime
+	// is counted from.
+	start time.Time
+
+	community []byte
+
+	// engineID is the snmpEngineID of the agent.
+	engineID []byte
+
+	// salt is the counter the salts of the encrypted messages are derived
+	// from.
+	salt atomic.Uint64
+
+	// usmStats are the counters of the usmStats group.
+	usmStats [usmStatsNum]atomic.Uint32
+
+	// engineBoots is the snmpEngineBoots of the agent.
+	engineBoots int64
+
+	addr netip.AddrPort
+}
+
+// NewAgent returns a new properly initialized *Agent.  conf must not be nil.
+func NewAgent(conf *Config) (a *Agent, err error) {
+	if conf.Community == "" && len(conf.Users) == 0 {
+		return nil, errors.Error("community: empty value and no users")
+	} else if conf.MIB == nil {
+		return nil, errors.Error("mib: nil value")
+	}
+
+	engineID := conf.EngineID
+	if len(engineID) == 0 {
+		engineID = newEngineID()
+	} else if l := len(engineID); l < minEngineIDLen || l > maxEngineIDLen {
+		return nil, fmt.Errorf("engine id: bad length %d", l)
+	}
+
+	start := time.Now()
+	a = &Agent{
+		stopped:     make(chan struct{}),
+		mib:         conf.MIB,
+		users:       make(map[string]*usmUser, len(conf.Users)),
+		start:       start,
+		engineID:    engineID,
+		engineBoots: min(max(start.Unix(), 1), maxEngineBoots-1),
+		addr:        conf.Addr,
+	}
+
+	if conf.Community != "" {
+		a.community = []byte(conf.Community)
+	}
+
+	for i, u := range conf.Users {
+		var uu *usmUser
+		uu, err = newUSMUser(u, engineID)
+		if err != nil {
+			return nil, fmt.Errorf("users: at index %d: %w", i, err)
+		} else if _, ok := a.users[uu.name]; ok {
+			return nil, fmt.Errorf("users: at index %d: duplicate name %q", i, uu.name)
+		}
+
+		a.users[uu.name] = uu
+	}
+
+	// Start the salts at a random value, so that they aren't reused after a
+	// restart within the same second.
+	a.salt.Store(randUint64())
+
+	return a, nil
+}
+
+// Start starts serving the requests.
+func (a *Agent) Start() (err error) {
+	a.conn, err = net.ListenUDP("udp", net.UDPAddrFromAddrPort(a.addr))
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	go a.loop()
+
+	log.Info("snmp: listening on %s", a.conn.LocalAddr())
+
+	return nil
+}
+
+// Close stops serving the requests.  It must only be called once after a
+// successful call to Start.
+func (a *Agent) Close() {
+	err := a.conn.Close()
+	if err != nil {
+		log.Debug("snmp: closing: %s", err)
+	}
+
+	<-a.stopped
+}
+
+// loop serves the requests until the connection is closed.
+func (a *Agent) loop() {
+	defer log.OnPanic("snmp: agent")
+	defer close(a.stopped)
+
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, src, err := a.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			log.Debug("snmp: reading: %s", err)
+
+			continue
+		}
+
+		resp, err := a.respond(buf[:n])
+		if err != nil {
+			log.Debug("snmp: request from %s: %s", src, err)
+
+			continue
+		}
+
+		_, err = a.conn.WriteToUDPAddrPort(resp, src)
+		if err != nil {
+			log.Debug("snmp: sending to %s: %s", src, err)
+		}
+	}
+}
+
+// request is a parsed request PDU.
+type request struct {
+	// oids are the names of the requested variables.
+	oids []OID
+
+	// id is the request identifier.
+	id int64
+
+	// nonRepeaters is the number of the variables requested only once in a
+	// GetBulkRequest.
+	nonRepeaters int64
+
+	// maxRepetitions is the number of the lexicographic successors requested
+	// for the rest of the variables in a GetBulkRequest.
+	maxRepetitions int64
+
+	// typ is the type of the PDU.
+	typ byte
+}
+
+// respond returns the encoded response to the encoded message msg.  err is not
+// nil if the message must be ignored.  msg may be modified.
+func (a *Agent) respond(msg []byte) (resp []byte, err error) {
+	seq, _, err := readExpected(msg, tagSequence)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: message: %w", err)
+	}
+
+	version, rest, err := readInt(seq)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: version: %w", err)
+	}
+
+	switch version {
+	case versionV2c:
+		return a.respondV2c(rest)
+	case versionV3:
+		return a.respondV3(msg, rest)
+	default:
+		return nil, fmt.Errorf("parsing: unsupported version %d", version)
+	}
+}
+
+// respondV2c returns the encoded response to the SNMPv2c message.  seq is the
+// contents of the message sequence without the version.
+func (a *Agent) respondV2c(seq []byte) (resp []byte, err error) {
+	if a.community == nil {
+		return nil, errors.Error("snmpv2c is disabled")
+	}
+
+	community, req, err := parseMessage(seq)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	} else if subtle.ConstantTimeCompare(community, a.community) != 1 {
+		return nil, errors.Error("bad community")
+	}
+
+	vars, status, index, err := a.process(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return encodeResponse(community, req, vars, status, index), nil
+}
+
+// process returns the variables, the error status, and the error index of the
+// response to req.
+func (a *Agent) process(req *request) (vars []*Variable, status, index int, err error) {
+	switch req.typ {
+	case pduGet, pduGetNext, pduGetBulk:
+		mib := a.mib()
+		slices.SortFunc(mib, func(x, y *Variable) (res int) { return slices.Compare(x.OID, y.OID) })
+		vars = answer(mib, req)
+	case pduSet:
+		status, index = statusNotWritable, 1
+		for _, oid := range req.oids {
+			vars = append(vars, &Variable{OID: oid, Type: Type(tagNull)})
+		}
+	default:
+		return nil, 0, 0, fmt.Errorf("unsupported pdu type 0x%02x", req.typ)
+	}
+
+	return vars, status, index, nil
+}
+
+// answer returns the variables answering req of one of the Get types.  mib must
+// be sorted.
+func answer(mib []*Variable, req *request) (vars []*Variable) {
+	switch req.typ {
+	case pduGet:
+		for _, oid := range req.oids {
+			vars = append(vars, lookup(mib, oid))
+		}
+	case pduGetNext:
+		for _, oid := range req.oids {
+			vars = append(vars, next(mib, oid))
+		}
+	default:
+		vars = bulk(mib, req)
+	}
+
+	return vars
+}
+
+// lookup returns the variable with oid or the noSuchObject exception.
+func lookup(mib []*Variable, oid OID) (vr *Variable) {
+	i, ok := slices.BinarySearchFunc(mib, oid, compareVarOID)
+	if !ok {
+		return &Variable{OID: oid, Type: typeNoSuchObject}
+	}
+
+	return mib[i]
+}
+
+// next returns the first variable following oid or the endOfMibView exception.
+func next(mib []*Variable, oid OID) (vr *Variable) {
+	i, ok := slices.BinarySearchFunc(mib, oid, compareVarOID)
+	if ok {
+		i++
+	}
+
+	if i >= len(mib) {
+		return &Variable{OID: oid, Type: typeEndOfMIBView}
+	}
+
+	return mib[i]
+}
+
+// compareVarOID compares the OID of vr with oid.
+func compareVarOID(vr *Variable, oid OID) (res int) {
+	return slices.Compare(vr.OID, oid)
+}
+
+// bulk returns the variables answering a GetBulkRequest, see RFC 3416 Section
+// 4.2.3.
+func bulk(mib []*Variable, req *request) (vars []*Variable) {
+	n := int(min(max(req.nonRepeaters, 0), int64(len(req.oids))))
+	for _, oid := range req.oids[:n] {
+		vars = append(vars, next(mib, oid))
+	}
+
+	reps := slices.Clone(req.oids[n:])
+	if len(reps) == 0 {
+		return vars
+	}
+
+	m := min(max(req.maxRepetitions, 0), maxBulkVars)
+	for i := int64(0); i < m && len(vars) < maxBulkVars; i++ {
+		done := true
+		for j, oid := range reps {
+			vr := next(mib, oid)
+			vars = append(vars, vr)
+			reps[j] = vr.OID
+			done = done && vr.Type == typeEndOfMIBView
+		}
+
+		if done {
+			break
+		}
+	}
+
+	return vars
+}
+
+// parseMessage parses the SNMPv2c message seq, which is the contents of the
+// message sequence without the version.
+func parseMessage(seq []byte) (community []byte, req *request, err error) {
+	community, rest, err := readExpected(seq, tagOctetString)
+	if err != nil {
+		return nil, nil, fmt.Errorf("community: %w", err)
+	}
+
+	req, err = parsePDU(rest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pdu: %w", err)
+	}
+
+	return community, req, nil
+}
+
+// parsePDU parses the request PDU from b.
+func parsePDU(b []byte) (req *request, err error) {
+	typ, pdu, _, err := readTLV(b)
+	if err != nil {
+		// Don't wrap the error since the caller does.
+		return nil, err
+	}
+
+	req = &request{typ: typ}
+	var rest []byte
+	for _, p := range []*int64{&req.id, &req.nonRepeaters, &req.maxRepetitions} {
+		*p, pdu, err = readInt(pdu)
+		if err != nil {
+			// Don't wrap the error since the caller does.
+			return nil, err
+		}
+	}
+
+	rest, _, err = readExpected(pdu, tagSequence)
+	if err != nil {
+		return nil, fmt.Errorf("variable bindings: %w", err)
+	}
+
+	for len(rest) > 0 {
+		var vb, oidVal []byte
+		vb, rest, err = readExpected(rest, tagSequence)
+		if err == nil {
+			oidVal, _, err = readExpected(vb, tagObjectID)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("variable binding at index %d: %w", len(req.oids), err)
+		}
+
+		var oid OID
+		oid, err = parseOID(oidVal)
+		if err != nil {
+			return nil, fmt.Errorf("variable binding at index %d: %w", len(req.oids), err)
+		}
+
+		req.oids = append(req.oids, oid)
+	}
+
+	return req, nil
+}
+
+// encodeResponse returns the encoded SNMPv2c response to req with the variables
+// vars.
+func encodeResponse(community []byte, req *request, vars []*Variable, status, index int) (msg []byte) {
+	// The size of the message without the variable bindings is well below the
+	// limit, since the community has been received in a message of at most
+	// maxMsgSize bytes.
+	const overhead = 64
+
+	pdu := encodePDU(pduResponse, req, vars, status, index, maxMsgSize-overhead-len(community))
+
+	msg = appendTLV(nil, tagInteger, appendInt(nil, versionV2c))
+	msg = appendTLV(msg, tagOctetString, community)
+	msg = append(msg, pdu...)
+
+	return appendTLV(nil, tagSequence, msg)
+}
+
+// encodePDU returns the encoded PDU of typ answering req with the variables
+// vars.  The trailing variables of the GetBulkRequest responses are dropped to fit the
+// variable bindings into limit bytes, and the other responses are replaced with
+// the tooBig error.
+func encodePDU(typ byte, req *request, vars []*Variable, status, index, limit int) (pdu []byte) {
+	var vbs []byte
+	for _, vr := range vars {
+		l := len(vbs)
+		vbs = appendVarBind(vbs, vr)
+		if len(vbs) <= limit {
+			continue
+		}
+
+		vbs = vbs[:l]
+		if req.typ != pduGetBulk {
+			vbs, status, index = nil, statusTooBig, 0
+		}
+
+		break
+	}
+
+	pdu = appendTLV(nil, tagInteger, appendInt(nil, req.id))
+	pdu = appendTLV(pdu, tagInteger, appendInt(nil, int64(status)))
+	pdu = appendTLV(pdu, tagInteger, appendInt(nil, int64(index)))
+	pdu = appendTLV(pdu, tagSequence, vbs)
+
+	return appendTLV(nil, typ, pdu)
+}
@@ -0,0 +1,267 @@
+package snmp
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCommunity is the community used in tests.
+const testCommunity = "public"
+
+// testMIB returns the objects for tests.
+func testMIB() (vars []*Variable) {
+	return []*Variable{
+		Counter64(OID{1, 3, 6, 1, 4, 1, 99, 2, 0}, 1<<63),
+		OctetString(OID{1, 3, 6, 1, 2, 1, 1, 1, 0}, "AdGuard Home"),
+		Integer(OID{1, 3, 6, 1, 4, 1, 99, 1, 0}, -129),
+		TimeTicks(OID{1, 3, 6, 1, 2, 1, 1, 3, 0}, 4200),
+	}
+}
+
+// encodeRequest returns the encoded request of typ for oids.  For the
+// GetBulkRequest, a and b are the non-repeaters and the max-repetitions
+// fields, for others they are the error status and the error index.
+func encodeRequest(community string, typ byte, id, a, b int64, oids ...OID) (msg []byte) {
+	var vbs []byte
+	for _, oid := range oids {
+		vb := appendTLV(nil, tagObjectID, appendOID(nil, oid))
+		vb = appendTLV(vb, tagNull, nil)
+		vbs = appendTLV(vbs, tagSequence, vb)
+	}
+
+	pdu := appendTLV(nil, tagInteger, appendInt(nil, id))
+	pdu = appendTLV(pdu, tagInteger, appendInt(nil, a))
+	pdu = appendTLV(pdu, tagInteger, appendInt(nil, b))
+	pdu = appendTLV(pdu, tagSequence, vbs)
+
+	msg = appendTLV(nil, tagInteger, appendInt(nil, versionV2c))
+	msg = appendTLV(msg, tagOctetString, []byte(community))
+	msg = appendTLV(msg, typ, pdu)
+
+	return appendTLV(nil, tagSequence, msg)
+}
+
+// testResponse is a parsed response.
+type testResponse struct {
+	// oids are the names of the variables.
+	oids []string
+
+	// types are the tags of the values of the variables.
+	types []Type
+
+	id     int64
+	status int64
+	index  int64
+}
+
+// parseResponse parses the encoded response msg.
+func parseResponse(t *testing.T, msg []byte) (resp *testResponse) {
+	t.Helper()
+
+	seq, _, err := readExpected(msg, tagSequence)
+	require.NoError(t, err)
+
+	_, rest, err := readInt(seq)
+	require.NoError(t, err)
+
+	_, rest, err = readExpected(rest, tagOctetString)
+	require.NoError(t, err)
+
+	return parseResponsePDU(t, rest, pduResponse)
+}
+
+// parseResponsePDU parses the encoded PDU of typ from b.
+func parseResponsePDU(t *testing.T, b []byte, typ byte) (resp *testResponse) {
+	t.Helper()
+
+	pdu, _, err := readExpected(b, typ)
+	require.NoError(t, err)
+
+	resp = &testResponse{}
+	for _, p := range []*int64{&resp.id, &resp.status, &resp.index} {
+		*p, pdu, err = readInt(pdu)
+		require.NoError(t, err)
+	}
+
+	vbs, _, err := readExpected(pdu, tagSequence)
+	require.NoError(t, err)
+
+	for len(vbs) > 0 {
+		var vb, oidVal []byte
+		vb, vbs, err = readExpected(vbs, tagSequence)
+		require.NoError(t, err)
+
+		oidVal, vb, err = readExpected(vb, tagObjectID)
+		require.NoError(t, err)
+
+		var oid OID
+		oid, err = parseOID(oidVal)
+		require.NoError(t, err)
+
+		var tag byte
+		tag, _, _, err = readTLV(vb)
+		require.NoError(t, err)
+
+		resp.oids = append(resp.oids, oid.String())
+		resp.types = append(resp.types, Type(tag))
+	}
+
+	return resp
+}
+
+func TestAgent_respond(t *testing.T) {
+	a, err := NewAgent(&Config{
+		MIB:       testMIB,
+		Community: testCommunity,
+	})
+	require.NoError(t, err)
+
+	sysDescr := OID{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	sysUpTime := OID{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	priv := OID{1, 3, 6, 1, 4, 1, 99}
+
+	testCases := []struct {
+		name string
+		want *testResponse
+		req  []byte
+	}{{
+		name: "get",
+		want: &testResponse{
+			oids:  []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.2.0"},
+			types: []Type{TypeOctetString, typeNoSuchObject},
+			id:    1,
+		},
+		req: encodeRequest(testCommunity, pduGet, 1, 0, 0, sysDescr, OID{1, 3, 6, 1, 2, 1, 1, 2, 0}),
+	}, {
+		name: "get_next",
+		want: &testResponse{
+			oids:  []string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.4.1.99.1.0", "1.3.6.1.4.1.99.2.0"},
+			types: []Type{TypeTimeTicks, TypeInteger, typeEndOfMIBView},
+			id:    2,
+		},
+		req: encodeRequest(testCommunity, pduGetNext, 2, 0, 0, sysDescr, sysUpTime, OID{1, 3, 6, 1, 4, 1, 99, 2, 0}),
+	}, {
+		name: "get_bulk",
+		want: &testResponse{
+			oids: []string{
+				"1.3.6.1.2.1.1.1.0",
+				"1.3.6.1.4.1.99.1.0",
+				"1.3.6.1.4.1.99.2.0",
+				"1.3.6.1.4.1.99.2.0",
+			},
+			types: []Type{TypeOctetString, TypeInteger, TypeCounter64, typeEndOfMIBView},
+			id:    3,
+		},
+		req: encodeRequest(testCommunity, pduGetBulk, 3, 1, 10, OID{1, 3}, priv),
+	}, {
+		name: "set",
+		want: &testResponse{
+			oids:   []string{"1.3.6.1.2.1.1.1.0"},
+			types:  []Type{Type(tagNull)},
+			id:     4,
+			status: statusNotWritable,
+			index:  1,
+		},
+		req: encodeRequest(testCommunity, pduSet, 4, 0, 0, sysDescr),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, respErr := a.respond(tc.req)
+			require.NoError(t, respErr)
+
+			assert.Equal(t, tc.want, parseResponse(t, resp))
+		})
+	}
+
+	t.Run("bad_community", func(t *testing.T) {
+		_, err = a.respond(encodeRequest("private", pduGet, 5, 0, 0, sysDescr))
+		testutil.AssertErrorMsg(t, "bad community", err)
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		req := encodeRequest(testCommunity, pduGet, 6, 0, 0, sysDescr)
+
+		// Replace the version with the one of SNMPv1.
+		req[4] = 0
+
+		_, err = a.respond(req)
+		testutil.AssertErrorMsg(t, "parsing: unsupported version 0", err)
+	})
+}
+
+func TestAgent_Start(t *testing.T) {
+	a, err := NewAgent(&Config{
+		MIB:       testMIB,
+		Community: testCommunity,
+		Addr:      netip.MustParseAddrPort("127.0.0.1:0"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.Start())
+	t.Cleanup(a.Close)
+
+	conn, err := net.Dial("udp", a.conn.LocalAddr().String())
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, conn.Close)
+
+	_, err = conn.Write(encodeRequest(testCommunity, pduGet, 42, 0, 0, OID{1, 3, 6, 1, 2, 1, 1, 3, 0}))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	buf := make([]byte, maxMsgSize)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, &testResponse{
+		oids:  []string{"1.3.6.1.2.1.1.3.0"},
+		types: []Type{TypeTimeTicks},
+		id:    42,
+	}, parseResponse(t, buf[:n]))
+}
+
+func TestBER(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, -1, -128, -129, 1 << 40, -1 << 63} {
+		b := appendTLV(nil, tagInteger, appendInt(nil, v))
+		got, rest, err := readInt(b)
+		require.NoError(t, err)
+
+		assert.Equal(t, v, got)
+		assert.Empty(t, rest)
+	}
+
+	assert.Equal(t, []byte{0x00, 0x80, 0, 0, 0, 0, 0, 0, 0}, appendUint(nil, 1<<63))
+	assert.Equal(t, []byte{0x7f}, appendUint(nil, 127))
+
+	assert.Equal(t, []byte{0x82, 0x01, 0x00}, appendLength(nil, 256))
+
+	oid := OID{1, 3, 6, 1, 4, 1, 8072, 9999, 4294967295}
+	got, err := parseOID(appendOID(nil, oid))
+	require.NoError(t, err)
+
+	assert.Equal(t, oid, got)
+}
+
+func TestParseOID(t *testing.T) {
+	oid, err := ParseOID(".1.3.6.1.2.1.1.1.0")
+	require.NoError(t, err)
+
+	assert.Equal(t, OID{1, 3, 6, 1, 2, 1, 1, 1, 0}, oid)
+	assert.Equal(t, "1.3.6.1.2.1.1.1.0", oid.String())
+
+	_, err = ParseOID("1")
+	testutil.AssertErrorMsg(t, `oid "1": too few arcs`, err)
+
+	_, err = ParseOID("1.40")
+	testutil.AssertErrorMsg(t, `oid "1.40": bad first arcs`, err)
+
+	_, err = ParseOID("1.3.x")
+	testutil.AssertErrorMsg(t, `oid "1.3.x": strconv.ParseUint: parsing "x": invalid syntax`, err)
+}
@@ -0,0 +1,312 @@
+package snmp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// AuthProtocol is the authentication protocol of an SNMPv3 user.
+type AuthProtocol string
+
+// Valid authentication protocols.
+const (
+	// AuthNone disables the authentication.
+	AuthNone AuthProtocol = ""
+
+	// AuthMD5 is HMAC-MD5-96, see RFC 3414 Section 6.
+	AuthMD5 AuthProtocol = "md5"
+
+	// AuthSHA is HMAC-SHA-96, see RFC 3414 Section 7.
+	AuthSHA AuthProtocol = "sha"
+
+	// AuthSHA256 is HMAC-SHA-256-192, see RFC 7860.
+	AuthSHA256 AuthProtocol = "sha256"
+)
+
+// params returns the hash function and the length of the message
+// authentication code of p.
+func (p AuthProtocol) params() (newHash func() hash.Hash, macLen int, err error) {
+	switch p {
+	case AuthMD5:
+		return md5.New, 12, nil
+	case AuthSHA:
+		return sha1.New, 12, nil
+	case AuthSHA256:
+		return sha256.New, 24, nil
+	default:
+		return nil, 0, fmt.Errorf("auth_protocol: bad value %q", p)
+	}
+}
+
+// PrivProtocol is the privacy protocol of an SNMPv3 user.
+type PrivProtocol string
+
+// Valid privacy protocols.
+const (
+	// PrivNone disables the encryption.
+	PrivNone PrivProtocol = ""
+
+	// PrivDES is CBC-DES, see RFC 3414 Section 8.
+	PrivDES PrivProtocol = "des"
+
+	// PrivAES is CFB128-AES-128, see RFC 3826.
+	PrivAES PrivProtocol = "aes"
+)
+
+// validate returns an error if p isn't a valid privacy protocol.
+func (p PrivProtocol) validate() (err error) {
+	switch p {
+	case PrivNone, PrivDES, PrivAES:
+		return nil
+	default:
+		return fmt.Errorf("priv_protocol: bad value %q", p)
+	}
+}
+
+// minPasswordLen is the minimum length of the passwords, see RFC 3414 Section
+// 11.2.
+const minPasswordLen = 8
+
+// User is an SNMPv3 user of the user-based security model, see RFC 3414.  The
+// requests of the user must have at least the security level the user is
+// configured with.
+type User struct {
+	// Name is the name of the user.  It must not be empty.
+	Name string
+
+	// AuthPassword is the password the authentication key is derived from.
+	// It must be at least 8 bytes long if AuthProtocol isn't [AuthNone].
+	AuthPassword string
+
+	// PrivPassword is the password the privacy key is derived from.  It must
+	// be at least 8 bytes long if PrivProtocol isn't [PrivNone].
+	PrivPassword string
+
+	// AuthProtocol is the authentication protocol of the user.
+	AuthProtocol AuthProtocol
+
+	// PrivProtocol is the privacy protocol of the user.  It requires
+	// AuthProtocol to be set.
+	PrivProtocol PrivProtocol
+}
+
+// Flags of the msgFlags field, see RFC 3412 Section 6.4.
+const (
+	flagAuth       byte = 0x01
+	flagPriv       byte = 0x02
+	flagReportable byte = 0x04
+
+	// levelMask is the mask of the security level bits.
+	levelMask = flagAuth | flagPriv
+)
+
+// usmUser is a user with the keys localized for the engine of the agent.
+type usmUser struct {
+	// newHash is the hash function of the authentication protocol.  It's nil
+	// if the user has no authentication.
+	newHash func() hash.Hash
+
+	name string
+
+	authKey []byte
+	privKey []byte
+
+	priv PrivProtocol
+
+	// macLen is the length of the message authentication code.
+	macLen int
+
+	// level is the minimum security level of the requests.
+	level byte
+}
+
+// newUSMUser returns a new *usmUser with the keys localized for engineID.
+func newUSMUser(u *User, engineID []byte) (uu *usmUser, err error) {
+	if u.Name == "" {
+		return nil, errors.Error("name: empty value")
+	}
+
+	err = u.PrivProtocol.validate()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	uu = &usmUser{
+		name: u.Name,
+		priv: u.PrivProtocol,
+	}
+
+	if u.AuthProtocol == AuthNone {
+		if u.PrivProtocol != PrivNone {
+			return nil, errors.Error("priv_protocol: requires auth_protocol")
+		}
+
+		return uu, nil
+	}
+
+	uu.newHash, uu.macLen, err = u.AuthProtocol.params()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	} else if len(u.AuthPassword) < minPasswordLen {
+		return nil, fmt.Errorf("auth_password: shorter than %d bytes", minPasswordLen)
+	}
+
+	uu.authKey = localizeKey(uu.newHash, u.AuthPassword, engineID)
+	uu.level = flagAuth
+
+	if u.PrivProtocol == PrivNone {
+		return uu, nil
+	} else if len(u.PrivPassword) < minPasswordLen {
+		return nil, fmt.Errorf("priv_password: shorter than %d bytes", minPasswordLen)
+	}
+
+	// Both DES and AES-128 take the first 16 bytes of the localized key, which
+	// is at least as long for any of the hash functions, see RFC 3414 Section
+	// 8.1.1.1 and RFC 3826 Section 3.1.2.1.
+	uu.privKey = localizeKey(uu.newHash, u.PrivPassword, engineID)[:16]
+	uu.level = flagAuth | flagPriv
+
+	return uu, nil
+}
+
+// localizeKey returns the key derived from password with the hash function
+// newHash and localized for engineID, see RFC 3414 Section A.2.  password must
+// not be empty.
+func localizeKey(newHash func() hash.Hash, password string, engineID []byte) (key []byte) {
+	// The password is repeated to fill a megabyte.
+	const totalLen = 1 << 20
+
+	h := newHash()
+	buf := make([]byte, 64)
+	for i := 0; i < totalLen; i += len(buf) {
+		for j := range buf {
+			buf[j] = password[(i+j)%len(password)]
+		}
+
+		_, _ = h.Write(buf)
+	}
+
+	ku := h.Sum(nil)
+
+	h.Reset()
+	_, _ = h.Write(ku)
+	_, _ = h.Write(engineID)
+	_, _ = h.Write(ku)
+
+	return h.Sum(nil)
+}
+
+// mac returns the message authentication code of msg, which must have the
+// authentication parameters zeroed.  u must have authentication.
+func (u *usmUser) mac(msg []byte) (code []byte) {
+	h := hmac.New(u.newHash, u.authKey)
+	_, _ = h.Write(msg)
+
+	return h.Sum(nil)[:u.macLen]
+}
+
+// encrypt returns the encrypted scoped PDU and the privacy parameters.  boots
+// and engineTime are the ones sent in the message.  salt must be unique for
+// each encrypted message.  u must have privacy.
+func (u *usmUser) encrypt(pdu []byte, boots, engineTime int64, salt uint64) (data, params []byte) {
+	params = make([]byte, 8)
+	if u.priv == PrivAES {
+		binary.BigEndian.PutUint64(params, salt)
+
+		data = make([]byte, len(pdu))
+		cipher.NewCFBEncrypter(u.aesBlock(), aesIV(boots, engineTime, params)).XORKeyStream(data, pdu)
+
+		return data, params
+	}
+
+	// The DES salt is the engine boots followed by a counter, see RFC 3414
+	// Section 8.1.1.1.
+	binary.BigEndian.PutUint32(params, uint32(boots))
+	binary.BigEndian.PutUint32(params[4:], uint32(salt))
+
+	// The padding is ignored by the receiver, since the scoped PDU has its own
+	// length.
+	data = make([]byte, (len(pdu)+des.BlockSize-1)/des.BlockSize*des.BlockSize)
+	copy(data, pdu)
+	cipher.NewCBCEncrypter(u.desBlock(), u.desIV(params)).CryptBlocks(data, data)
+
+	return data, params
+}
+
+// decrypt returns the decrypted scoped PDU from data.  boots and engineTime are
+// the ones received in the message.  u must have privacy.
+func (u *usmUser) decrypt(data, params []byte, boots, engineTime int64) (pdu []byte, err error) {
+	if len(params) != 8 {
+		return nil, fmt.Errorf("privacy parameters: bad length %d", len(params))
+	}
+
+	pdu = make([]byte, len(data))
+	if u.priv == PrivAES {
+		cipher.NewCFBDecrypter(u.aesBlock(), aesIV(boots, engineTime, params)).XORKeyStream(pdu, data)
+
+		return pdu, nil
+	}
+
+	if len(data) == 0 || len(data)%des.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted pdu: bad length %d", len(data))
+	}
+
+	cipher.NewCBCDecrypter(u.desBlock(), u.desIV(params)).CryptBlocks(pdu, data)
+
+	return pdu, nil
+}
+
+// aesBlock returns the AES-128 cipher with the privacy key of u.
+func (u *usmUser) aesBlock() (b cipher.Block) {
+	b, err := aes.NewCipher(u.privKey)
+	if err != nil {
+		// Shouldn't happen, since the key is always 16 bytes long.
+		panic(err)
+	}
+
+	return b
+}
+
+// aesIV returns the initialization vector of AES, see RFC 3826 Section
+// 3.1.2.1.
+func aesIV(boots, engineTime int64, salt []byte) (iv []byte) {
+	iv = make([]byte, 0, aes.BlockSize)
+	iv = binary.BigEndian.AppendUint32(iv, uint32(boots))
+	iv = binary.BigEndian.AppendUint32(iv, uint32(engineTime))
+
+	return append(iv, salt...)
+}
+
+// desBlock returns the DES cipher with the privacy key of u.
+func (u *usmUser) desBlock() (b cipher.Block) {
+	b, err := des.NewCipher(u.privKey[:des.BlockSize])
+	if err != nil {
+		// Shouldn't happen, since the key is always 8 bytes long.
+		panic(err)
+	}
+
+	return b
+}
+
+// desIV returns the initialization vector of DES, which is the pre-IV part of
+// the privacy key XOR-ed with salt, see RFC 3414 Section 8.1.1.1.
+func (u *usmUser) desIV(salt []byte) (iv []byte) {
+	iv = make([]byte, des.BlockSize)
+	for i := range iv {
+		iv[i] = u.privKey[des.BlockSize+i] ^ salt[i]
+	}
+
+	return iv
+}
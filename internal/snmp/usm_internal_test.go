@@ -0,0 +1,288 @@
+package snmp
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPassword is the password of the users in tests.
+const testPassword = "maplesyrup"
+
+func TestLocalizeKey(t *testing.T) {
+	// See RFC 3414 Section A.3.
+	engineID, err := hex.DecodeString("000000000000000000000002")
+	require.NoError(t, err)
+
+	key := localizeKey(md5.New, testPassword, engineID)
+	assert.Equal(t, "526f5eed9fcce26f8964c2930787d82b", hex.EncodeToString(key))
+
+	key = localizeKey(sha1.New, testPassword, engineID)
+	assert.Equal(t, "6695febc9288e36282235fc7151f128497b38f3f", hex.EncodeToString(key))
+}
+
+// encodeScopedRequest returns the encoded scoped PDU with a GetRequest for
+// oids.
+func encodeScopedRequest(id int64, oids ...OID) (scoped []byte) {
+	req := encodeRequest("", pduGet, id, 0, 0, oids...)
+
+	// Take the PDU from the SNMPv2c message.
+	seq, _, _ := readExpected(req, tagSequence)
+	_, rest, _ := readInt(seq)
+	_, pdu, _ := readExpected(rest, tagOctetString)
+
+	return encodeScopedPDU(nil, nil, pdu)
+}
+
+// parseV3Response parses the encoded SNMPv3 response msg from a, which is
+// authenticated and encrypted according to the flags in the message, and
+// returns the PDU of typ.
+func parseV3Response(t *testing.T, a *Agent, msg []byte, typ byte) (flags byte, resp *testResponse) {
+	t.Helper()
+
+	seq, _, err := readExpected(msg, tagSequence)
+	require.NoError(t, err)
+
+	version, rest, err := readInt(seq)
+	require.NoError(t, err)
+	require.Equal(t, int64(versionV3), version)
+
+	m, err := parseV3Message(rest)
+	require.NoError(t, err)
+	require.Equal(t, a.engineID, m.engineID)
+
+	scoped := m.scopedPDU
+	if m.flags&levelMask != 0 {
+		_, scoped, err = a.processSecurity(msg, m)
+		require.NoError(t, err)
+	}
+
+	_, rest, err = readExpected(scoped, tagOctetString)
+	require.NoError(t, err)
+
+	_, rest, err = readExpected(rest, tagOctetString)
+	require.NoError(t, err)
+
+	return m.flags, parseResponsePDU(t, rest, typ)
+}
+
+func TestAgent_respondV3(t *testing.T) {
+	users := []*User{{
+		Name: "noauth",
+	}, {
+		Name:         "md5",
+		AuthPassword: testPassword,
+		AuthProtocol: AuthMD5,
+	}, {
+		Name:         "sha_des",
+		AuthPassword: testPassword,
+		PrivPassword: testPassword + "2",
+		AuthProtocol: AuthSHA,
+		PrivProtocol: PrivDES,
+	}, {
+		Name:         "sha256_aes",
+		AuthPassword: testPassword,
+		PrivPassword: testPassword + "2",
+		AuthProtocol: AuthSHA256,
+		PrivProtocol: PrivAES,
+	}}
+
+	a, err := NewAgent(&Config{
+		MIB:   testMIB,
+		Users: users,
+	})
+	require.NoError(t, err)
+
+	sysDescr := OID{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	scoped := encodeScopedRequest(1, sysDescr)
+
+	for _, u := range users {
+		uu := a.users[u.Name]
+		level := uu.supported()
+
+		t.Run(u.Name, func(t *testing.T) {
+			resp, respErr := a.respond(a.encodeV3(7, uu, level|flagReportable, scoped))
+			require.NoError(t, respErr)
+
+			flags, got := parseV3Response(t, a, resp, pduResponse)
+			assert.Equal(t, level, flags)
+			assert.Equal(t, &testResponse{
+				oids:  []string{"1.3.6.1.2.1.1.1.0"},
+				types: []Type{TypeOctetString},
+				id:    1,
+			}, got)
+		})
+	}
+
+	// wantReport returns the expected report of the usmStats counter stat.
+	wantReport := func(stat uint32, id int64) (resp *testResponse) {
+		return &testResponse{
+			oids:  []string{usmStatsOID.Append(stat+1, 0).String()},
+			types: []Type{TypeCounter32},
+			id:    id,
+		}
+	}
+
+	t.Run("discovery", func(t *testing.T) {
+		other, newErr := NewAgent(&Config{
+			MIB:      testMIB,
+			Users:    users[:1],
+			EngineID: []byte("other"),
+		})
+		require.NoError(t, newErr)
+
+		resp, respErr := a.respond(other.encodeV3(7, &usmUser{}, flagReportable, scoped))
+		require.NoError(t, respErr)
+
+		flags, got := parseV3Response(t, a, resp, pduReport)
+		assert.Zero(t, flags)
+		assert.Equal(t, wantReport(usmStatsUnknownEngineIDs, 1), got)
+	})
+
+	t.Run("unknown_user", func(t *testing.T) {
+		resp, respErr := a.respond(a.encodeV3(7, &usmUser{name: "nobody"}, flagReportable, scoped))
+		require.NoError(t, respErr)
+
+		_, got := parseV3Response(t, a, resp, pduReport)
+		assert.Equal(t, wantReport(usmStatsUnknownUserNames, 1), got)
+	})
+
+	t.Run("unsupported_level", func(t *testing.T) {
+		// The agent only knows the authentication key of the user.
+		uu, newErr := newUSMUser(&User{
+			Name:         "md5",
+			AuthPassword: testPassword,
+			PrivPassword: testPassword,
+			AuthProtocol: AuthMD5,
+			PrivProtocol: PrivDES,
+		}, a.engineID)
+		require.NoError(t, newErr)
+
+		resp, respErr := a.respond(a.encodeV3(7, uu, flagAuth|flagPriv|flagReportable, scoped))
+		require.NoError(t, respErr)
+
+		_, got := parseV3Response(t, a, resp, pduReport)
+		assert.Equal(t, wantReport(usmStatsUnsupportedSecLevels, unknownRequestID), got)
+	})
+
+	t.Run("wrong_digest", func(t *testing.T) {
+		uu, newErr := newUSMUser(&User{
+			Name:         "md5",
+			AuthPassword: "wrong password",
+			AuthProtocol: AuthMD5,
+		}, a.engineID)
+		require.NoError(t, newErr)
+
+		resp, respErr := a.respond(a.encodeV3(7, uu, flagAuth|flagReportable, scoped))
+		require.NoError(t, respErr)
+
+		_, got := parseV3Response(t, a, resp, pduReport)
+		assert.Equal(t, wantReport(usmStatsWrongDigests, 1), got)
+	})
+
+	t.Run("not_in_time_window", func(t *testing.T) {
+		uu := a.users["md5"]
+		req := a.encodeV3(7, uu, flagAuth|flagReportable, scoped)
+
+		a.engineBoots++
+		t.Cleanup(func() { a.engineBoots-- })
+
+		resp, respErr := a.respond(req)
+		require.NoError(t, respErr)
+
+		flags, got := parseV3Response(t, a, resp, pduReport)
+		assert.Equal(t, flagAuth, flags)
+		assert.Equal(t, wantReport(usmStatsNotInTimeWindows, 1), got)
+	})
+
+	t.Run("level_too_low", func(t *testing.T) {
+		uu := a.users["sha_des"]
+		_, err = a.respond(a.encodeV3(7, uu, flagAuth|flagReportable, scoped))
+		testutil.AssertErrorMsg(t, `user "sha_des": security level too low`, err)
+	})
+
+	t.Run("not_reportable", func(t *testing.T) {
+		_, err = a.respond(a.encodeV3(7, &usmUser{name: "nobody"}, 0, scoped))
+		testutil.AssertErrorMsg(t, "unknown user name", err)
+	})
+
+	t.Run("v2c_disabled", func(t *testing.T) {
+		_, err = a.respond(encodeRequest(testCommunity, pduGet, 1, 0, 0, sysDescr))
+		testutil.AssertErrorMsg(t, "snmpv2c is disabled", err)
+	})
+}
+
+func TestNewAgent_users(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		conf       *Config
+	}{{
+		name:       "no_community_and_users",
+		wantErrMsg: "community: empty value and no users",
+		conf:       &Config{MIB: testMIB},
+	}, {
+		name:       "short_engine_id",
+		wantErrMsg: "engine id: bad length 4",
+		conf: &Config{
+			MIB:       testMIB,
+			Community: testCommunity,
+			EngineID:  []byte("1234"),
+		},
+	}, {
+		name:       "no_name",
+		wantErrMsg: "users: at index 0: name: empty value",
+		conf: &Config{
+			MIB:   testMIB,
+			Users: []*User{{}},
+		},
+	}, {
+		name:       "duplicate_name",
+		wantErrMsg: `users: at index 1: duplicate name "user"`,
+		conf: &Config{
+			MIB:   testMIB,
+			Users: []*User{{Name: "user"}, {Name: "user"}},
+		},
+	}, {
+		name:       "bad_auth_protocol",
+		wantErrMsg: `users: at index 0: auth_protocol: bad value "sha1"`,
+		conf: &Config{
+			MIB:   testMIB,
+			Users: []*User{{Name: "user", AuthProtocol: "sha1"}},
+		},
+	}, {
+		name:       "short_auth_password",
+		wantErrMsg: "users: at index 0: auth_password: shorter than 8 bytes",
+		conf: &Config{
+			MIB: testMIB,
+			Users: []*User{{
+				Name:         "user",
+				AuthPassword: "short",
+				AuthProtocol: AuthSHA,
+			}},
+		},
+	}, {
+		name:       "priv_without_auth",
+		wantErrMsg: "users: at index 0: priv_protocol: requires auth_protocol",
+		conf: &Config{
+			MIB: testMIB,
+			Users: []*User{{
+				Name:         "user",
+				PrivPassword: testPassword,
+				PrivProtocol: PrivAES,
+			}},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAgent(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
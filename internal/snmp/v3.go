@@ -0,0 +1,468 @@
+package snmp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// versionV3 is the value of the version field of SNMPv3 messages.
+const versionV3 = 3
+
+// securityModelUSM is the identifier of the user-based security model.
+const securityModelUSM = 3
+
+// pduReport is the type of the Report PDU.
+const pduReport byte = 0xa8
+
+// Limits of the SNMPv3 message fields, see RFC 3412 Section 6 and RFC 3414
+// Section 2.2.
+const (
+	minMsgMaxSize  = 484
+	maxEngineBoots = 1<<31 - 1
+	timeWindow     = 150
+)
+
+// unknownRequestID is the request ID of the Report PDUs sent when the request
+// ID of the request can't be determined, see RFC 3412 Section 7.1.
+const unknownRequestID = 1<<31 - 1
+
+// v3Overhead is the upper bound of the size of a response without the
+// variable bindings, the engine ID, the user name, and the context.
+const v3Overhead = 192
+
+// Indexes of the counters of the usmStats group, see RFC 3414 Section 5.
+const (
+	usmStatsUnsupportedSecLevels = iota
+	usmStatsNotInTimeWindows
+	usmStatsUnknownUserNames
+	usmStatsUnknownEngineIDs
+	usmStatsWrongDigests
+	usmStatsDecryptionErrors
+
+	usmStatsNum
+)
+
+// usmStatsOID is the OID of the usmStats group.
+var usmStatsOID = OID{1, 3, 6, 1, 6, 3, 15, 1, 1}
+
+// Engine ID limits, see RFC 3411 Section 5.
+const (
+	minEngineIDLen = 5
+	maxEngineIDLen = 32
+)
+
+// newEngineID returns a random engine ID in the octets format of RFC 3411
+// Section 5 under the enterprise number of Net-SNMP, whose experimental subtree
+// the statistics are exposed under by default.
+func newEngineID() (id []byte) {
+	id = []byte{0x80, 0x00, 0x1f, 0x88, 0x05, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	// rand.Read never returns an error.
+	_, _ = rand.Read(id[5:])
+
+	return id
+}
+
+// randUint64 returns a random 64-bit integer.
+func randUint64() (v uint64) {
+	b := make([]byte, 8)
+
+	// rand.Read never returns an error.
+	_, _ = rand.Read(b)
+
+	return binary.BigEndian.Uint64(b)
+}
+
+// v3Message is a parsed SNMPv3 message, see RFC 3412 Section 6 and RFC 3414
+// Section 2.4.
+type v3Message struct {
+	// engineID is the msgAuthoritativeEngineID.
+	engineID []byte
+
+	// userName is the msgUserName.
+	userName []byte
+
+	// authParams are the msgAuthenticationParameters.  They alias the
+	// message, so that they can be zeroed to verify it.
+	authParams []byte
+
+	// privParams are the msgPrivacyParameters.
+	privParams []byte
+
+	// scopedPDU is the encoded scoped PDU, if the message isn't encrypted, or
+	// the encrypted one otherwise.
+	scopedPDU []byte
+
+	// id is the msgID.
+	id int64
+
+	// maxSize is the msgMaxSize.
+	maxSize int64
+
+	// boots is the msgAuthoritativeEngineBoots.
+	boots int64
+
+	// engineTime is the msgAuthoritativeEngineTime.
+	engineTime int64
+
+	// flags are the msgFlags.
+	flags byte
+}
+
+// parseV3Message parses the SNMPv3 message seq, which is the contents of the
+// message sequence without the version.
+func parseV3Message(seq []byte) (m *v3Message, err error) {
+	header, rest, err := readExpected(seq, tagSequence)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	m = &v3Message{}
+	err = m.parseHeader(header)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	secParams, rest, err := readExpected(rest, tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("security parameters: %w", err)
+	}
+
+	err = m.parseSecParams(secParams)
+	if err != nil {
+		return nil, fmt.Errorf("security parameters: %w", err)
+	}
+
+	want := tagSequence
+	if m.flags&flagPriv != 0 {
+		want = tagOctetString
+	}
+
+	m.scopedPDU, _, err = readExpected(rest, want)
+	if err != nil {
+		return nil, fmt.Errorf("scoped pdu: %w", err)
+	}
+
+	return m, nil
+}
+
+// parseHeader parses the msgGlobalData fields from b.
+func (m *v3Message) parseHeader(b []byte) (err error) {
+	m.id, b, err = readInt(b)
+	if err != nil {
+		return fmt.Errorf("id: %w", err)
+	}
+
+	m.maxSize, b, err = readInt(b)
+	if err != nil {
+		return fmt.Errorf("max size: %w", err)
+	} else if m.maxSize < minMsgMaxSize {
+		return fmt.Errorf("max size: %d is less than %d", m.maxSize, minMsgMaxSize)
+	}
+
+	flags, b, err := readExpected(b, tagOctetString)
+	if err != nil {
+		return fmt.Errorf("flags: %w", err)
+	} else if len(flags) != 1 {
+		return fmt.Errorf("flags: bad length %d", len(flags))
+	}
+
+	m.flags = flags[0]
+	if m.flags&levelMask == flagPriv {
+		return errors.Error("flags: privacy without authentication")
+	}
+
+	model, _, err := readInt(b)
+	if err != nil {
+		return fmt.Errorf("security model: %w", err)
+	} else if model != securityModelUSM {
+		return fmt.Errorf("unsupported security model %d", model)
+	}
+
+	return nil
+}
+
+// parseSecParams parses the UsmSecurityParameters from b.
+func (m *v3Message) parseSecParams(b []byte) (err error) {
+	seq, _, err := readExpected(b, tagSequence)
+	if err != nil {
+		// Don't wrap the error since the caller does.
+		return err
+	}
+
+	m.engineID, seq, err = readExpected(seq, tagOctetString)
+	if err == nil {
+		m.boots, seq, err = readInt(seq)
+	}
+
+	if err == nil {
+		m.engineTime, seq, err = readInt(seq)
+	}
+
+	for _, p := range []*[]byte{&m.userName, &m.authParams, &m.privParams} {
+		if err != nil {
+			break
+		}
+
+		*p, seq, err = readExpected(seq, tagOctetString)
+	}
+
+	// Don't wrap the error since the caller does.
+	return err
+}
+
+// usmError is the failure of the security processing of a message, which is
+// reported back to the sender, see RFC 3414 Section 3.2.
+type usmError struct {
+	// user is the user to authenticate the report with.  It's nil if the
+	// report isn't authenticated.
+	user *usmUser
+
+	// stat is the index of the usmStats counter to report.
+	stat int
+}
+
+// Error implements the error interface for *usmError.
+func (err *usmError) Error() (msg string) {
+	switch err.stat {
+	case usmStatsUnsupportedSecLevels:
+		return "unsupported security level"
+	case usmStatsNotInTimeWindows:
+		return "not in time window"
+	case usmStatsUnknownUserNames:
+		return "unknown user name"
+	case usmStatsUnknownEngineIDs:
+		return "unknown engine id"
+	case usmStatsWrongDigests:
+		return "wrong digest"
+	default:
+		return "decryption error"
+	}
+}
+
+// respondV3 returns the encoded response to the SNMPv3 message msg, which may
+// be a Report PDU.  seq is the contents of the message sequence without the
+// version.  msg is modified.
+func (a *Agent) respondV3(msg, seq []byte) (resp []byte, err error) {
+	m, err := parseV3Message(seq)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	u, scoped, err := a.processSecurity(msg, m)
+	if err != nil {
+		uerr := &usmError{}
+		if errors.As(err, &uerr) && m.flags&flagReportable != 0 {
+			return a.encodeReport(m, scoped, uerr), nil
+		}
+
+		return nil, err
+	} else if m.flags&levelMask < u.level {
+		return nil, fmt.Errorf("user %q: security level too low", u.name)
+	}
+
+	ctxEngineID, rest, err := readExpected(scoped, tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("context engine id: %w", err)
+	}
+
+	ctxName, rest, err := readExpected(rest, tagOctetString)
+	if err != nil {
+		return nil, fmt.Errorf("context name: %w", err)
+	}
+
+	req, err := parsePDU(rest)
+	if err != nil {
+		return nil, fmt.Errorf("pdu: %w", err)
+	}
+
+	vars, status, index, err := a.process(req)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	maxSize := min(int(m.maxSize), maxMsgSize)
+	limit := maxSize - v3Overhead - len(a.engineID) - len(u.name) - len(ctxEngineID) - len(ctxName)
+	pdu := encodePDU(pduResponse, req, vars, status, index, limit)
+
+	return a.encodeV3(m.id, u, m.flags&levelMask, encodeScopedPDU(ctxEngineID, ctxName, pdu)), nil
+}
+
+// processSecurity authenticates and decrypts the message msg parsed into m,
+// see RFC 3414 Section 3.2.  scoped is the contents of the scoped PDU
+// sequence.  If err is a *usmError, scoped is only set if the message isn't
+// encrypted.  msg is modified.
+func (a *Agent) processSecurity(msg []byte, m *v3Message) (u *usmUser, scoped []byte, err error) {
+	level := m.flags & levelMask
+	if level&flagPriv == 0 {
+		scoped = m.scopedPDU
+	}
+
+	if !hmac.Equal(m.engineID, a.engineID) {
+		return nil, scoped, &usmError{stat: usmStatsUnknownEngineIDs}
+	}
+
+	u, ok := a.users[string(m.userName)]
+	if !ok {
+		return nil, scoped, &usmError{stat: usmStatsUnknownUserNames}
+	} else if level&^u.supported() != 0 {
+		return nil, scoped, &usmError{stat: usmStatsUnsupportedSecLevels}
+	}
+
+	if level&flagAuth == 0 {
+		return u, scoped, nil
+	}
+
+	if len(m.authParams) != u.macLen {
+		return nil, scoped, &usmError{stat: usmStatsWrongDigests}
+	}
+
+	code := append([]byte(nil), m.authParams...)
+	clear(m.authParams)
+	if !hmac.Equal(code, u.mac(msg)) {
+		return nil, scoped, &usmError{stat: usmStatsWrongDigests}
+	}
+
+	if m.boots != a.engineBoots || m.boots == maxEngineBoots || abs(m.engineTime-a.engineTime()) > timeWindow {
+		// The report must be authenticated, so that the sender could
+		// synchronize its notion of the engine time with it.
+		return nil, scoped, &usmError{user: u, stat: usmStatsNotInTimeWindows}
+	}
+
+	if level&flagPriv == 0 {
+		return u, scoped, nil
+	}
+
+	data, err := u.decrypt(m.scopedPDU, m.privParams, m.boots, m.engineTime)
+	if err == nil {
+		scoped, _, err = readExpected(data, tagSequence)
+	}
+
+	if err != nil {
+		return nil, nil, &usmError{stat: usmStatsDecryptionErrors}
+	}
+
+	return u, scoped, nil
+}
+
+// supported returns the security levels u supports.
+func (u *usmUser) supported() (levels byte) {
+	if u.privKey != nil {
+		return flagAuth | flagPriv
+	} else if u.authKey != nil {
+		return flagAuth
+	}
+
+	return 0
+}
+
+// abs returns the absolute value of v.
+func abs(v int64) (res int64) {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+// engineTime returns the snmpEngineTime of the agent.
+func (a *Agent) engineTime() (sec int64) {
+	return int64(time.Since(a.start) / time.Second)
+}
+
+// encodeReport returns the encoded Report PDU for the failure err of the
+// message m.  scoped is the contents of the scoped PDU sequence of m, if known.
+func (a *Agent) encodeReport(m *v3Message, scoped []byte, err *usmError) (msg []byte) {
+	n := a.usmStats[err.stat].Add(1)
+
+	req := &request{id: unknownRequestID, typ: pduReport}
+	if _, rest, rerr := readExpected(scoped, tagOctetString); rerr == nil {
+		if _, rest, rerr = readExpected(rest, tagOctetString); rerr == nil {
+			if r, perr := parsePDU(rest); perr == nil {
+				req.id = r.id
+			}
+		}
+	}
+
+	vr := &Variable{
+		OID:  usmStatsOID.Append(uint32(err.stat)+1, 0),
+		Uint: uint64(n),
+		Type: TypeCounter32,
+	}
+
+	pdu := encodePDU(pduReport, req, []*Variable{vr}, statusNoError, 0, maxMsgSize)
+
+	var level byte
+	u := err.user
+	if u != nil {
+		level = flagAuth
+	} else {
+		u = &usmUser{name: string(m.userName)}
+	}
+
+	return a.encodeV3(m.id, u, level, encodeScopedPDU(a.engineID, nil, pdu))
+}
+
+// encodeScopedPDU returns the encoded scoped PDU.
+func encodeScopedPDU(ctxEngineID, ctxName, pdu []byte) (scoped []byte) {
+	scoped = appendTLV(nil, tagOctetString, ctxEngineID)
+	scoped = appendTLV(scoped, tagOctetString, ctxName)
+	scoped = append(scoped, pdu...)
+
+	return appendTLV(nil, tagSequence, scoped)
+}
+
+// encodeV3 returns the encoded SNMPv3 message from the agent with the encoded
+// scoped PDU scoped, which is encrypted and authenticated with the keys of u
+// according to flags.
+func (a *Agent) encodeV3(id int64, u *usmUser, flags byte, scoped []byte) (msg []byte) {
+	boots, engineTime := a.engineBoots, a.engineTime()
+
+	var privParams []byte
+	if flags&flagPriv != 0 {
+		var data []byte
+		data, privParams = u.encrypt(scoped, boots, engineTime, a.salt.Add(1))
+		scoped = appendTLV(nil, tagOctetString, data)
+	}
+
+	var authParams []byte
+	if flags&flagAuth != 0 {
+		authParams = make([]byte, u.macLen)
+	}
+
+	header := appendTLV(nil, tagInteger, appendInt(nil, id))
+	header = appendTLV(header, tagInteger, appendInt(nil, maxMsgSize))
+	header = appendTLV(header, tagOctetString, []byte{flags})
+	header = appendTLV(header, tagInteger, appendInt(nil, securityModelUSM))
+
+	privTLV := appendTLV(nil, tagOctetString, privParams)
+
+	secParams := appendTLV(nil, tagOctetString, a.engineID)
+	secParams = appendTLV(secParams, tagInteger, appendInt(nil, boots))
+	secParams = appendTLV(secParams, tagInteger, appendInt(nil, engineTime))
+	secParams = appendTLV(secParams, tagOctetString, []byte(u.name))
+	secParams = appendTLV(secParams, tagOctetString, authParams)
+	secParams = append(secParams, privTLV...)
+
+	msg = appendTLV(nil, tagInteger, appendInt(nil, versionV3))
+	msg = appendTLV(msg, tagSequence, header)
+	msg = appendTLV(msg, tagOctetString, appendTLV(nil, tagSequence, secParams))
+	msg = append(msg, scoped...)
+	msg = appendTLV(nil, tagSequence, msg)
+
+	if flags&flagAuth != 0 {
+		// The authentication parameters are only followed by the privacy
+		// parameters and the scoped PDU, so their offset from the end of the
+		// message is known.
+		off := len(msg) - len(scoped) - len(privTLV) - len(authParams)
+		copy(msg[off:], u.mac(msg))
+	}
+
+	return msg
+}
@@ -0,0 +1,50 @@
+package stats
+
+// CacheResult is the result of looking up the response for a request in the
+// DNS cache.
+type CacheResult uint8
+
+// Supported CacheResult values.
+const (
+	// CacheResultNone means that the cache hasn't been looked up, for example
+	// because it's disabled or the request has been filtered.
+	CacheResultNone CacheResult = iota
+
+	// CacheResultHit means that the response has been served from cache.
+	CacheResultHit
+
+	// CacheResultMiss means that the response hasn't been found in cache and
+	// has been requested from an upstream.
+	CacheResultMiss
+
+	// CacheResultStale means that the expired response has been served from
+	// cache, which only happens with the optimistic cache.
+	CacheResultStale
+
+	cacheResultLast = CacheResultStale + 1
+)
+
+// cacheCount returns the number of requests with the cache result r in udb.
+// The units written before the cache statistics have been introduced have no
+// cache counters.
+func (udb *unitDB) cacheCount(r CacheResult) (n uint64) {
+	if int(r) >= len(udb.NCacheResult) {
+		return 0
+	}
+
+	return udb.NCacheResult[r]
+}
+
+// addCacheCounts adds the cache counters of u to the i-th time unit of data.
+func (data *StatsResp) addCacheCounts(i int, u *unitDB) {
+	data.CacheHits[i] += u.cacheCount(CacheResultHit)
+	data.CacheMisses[i] += u.cacheCount(CacheResultMiss)
+	data.CacheStaleHits[i] += u.cacheCount(CacheResultStale)
+}
+
+// makeCacheSeries allocates the cache time series of data for size time units.
+func (data *StatsResp) makeCacheSeries(size int) {
+	data.CacheHits = make([]uint64, size)
+	data.CacheMisses = make([]uint64, size)
+	data.CacheStaleHits = make([]uint64, size)
+}
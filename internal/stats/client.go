@@ -0,0 +1,274 @@
+package stats
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// maxClientDomains is the max number of top domains kept for each client
+// within a unit.
+const maxClientDomains = 20
+
+// clientUnit collects the statistics data of a single client for a specific
+// period of time.
+type clientUnit struct {
+	// domains stores the number of requests for each domain.
+	domains map[string]uint64
+
+	// blockedDomains stores the number of requests for each domain that has
+	// been blocked.
+	blockedDomains map[string]uint64
+
+	// nTotal stores the total number of requests.
+	nTotal uint64
+
+	// nBlocked stores the number of requests that have been blocked.
+	nBlocked uint64
+}
+
+// newClientUnit allocates the new *clientUnit.
+func newClientUnit() (cu *clientUnit) {
+	return &clientUnit{
+		domains:        map[string]uint64{},
+		blockedDomains: map[string]uint64{},
+	}
+}
+
+// add adds new data to cu.
+func (cu *clientUnit) add(e *Entry) {
+	cu.nTotal++
+	if e.Result == RNotFiltered {
+		cu.domains[e.Domain]++
+	} else {
+		cu.nBlocked++
+		cu.blockedDomains[e.Domain]++
+	}
+}
+
+// clientUnitDB is the structure for serializing the statistics data of a
+// single client into the database.
+//
+// NOTE: Do not change the names or types of fields, as this structure is used
+// for GOB encoding.
+type clientUnitDB struct {
+	// Name is the client's primary ID.
+	Name string
+
+	// Domains is the number of requests for each domain name.
+	Domains []countPair
+
+	// BlockedDomains is the number of requests blocked for each domain name.
+	BlockedDomains []countPair
+
+	// NTotal is the total number of requests.
+	NTotal uint64
+
+	// NBlocked is the number of requests that have been blocked.
+	NBlocked uint64
+}
+
+// serializeClients converts the clients' data to the slice of at most
+// [maxClients] clients with the most number of requests.
+func serializeClients(clients map[string]*clientUnit) (cudbs []clientUnitDB) {
+	cudbs = make([]clientUnitDB, 0, len(clients))
+	for name, cu := range clients {
+		cudbs = append(cudbs, clientUnitDB{
+			Name:           name,
+			Domains:        convertMapToSlice(cu.domains, maxClientDomains),
+			BlockedDomains: convertMapToSlice(cu.blockedDomains, maxClientDomains),
+			NTotal:         cu.nTotal,
+			NBlocked:       cu.nBlocked,
+		})
+	}
+
+	slices.SortFunc(cudbs, func(a, b clientUnitDB) (res int) {
+		return cmp.Or(cmp.Compare(b.NTotal, a.NTotal), strings.Compare(a.Name, b.Name))
+	})
+
+	return cudbs[:min(len(cudbs), maxClients)]
+}
+
+// deserializeClients converts the serialized clients' data to the map.
+func deserializeClients(cudbs []clientUnitDB) (clients map[string]*clientUnit) {
+	clients = make(map[string]*clientUnit, len(cudbs))
+	for _, cudb := range cudbs {
+		clients[cudb.Name] = &clientUnit{
+			domains:        convertSliceToMap(cudb.Domains),
+			blockedDomains: convertSliceToMap(cudb.BlockedDomains),
+			nTotal:         cudb.NTotal,
+			nBlocked:       cudb.NBlocked,
+		}
+	}
+
+	return clients
+}
+
+// clientSummaryJSON is the total statistics of a single client.
+type clientSummaryJSON struct {
+	// Name is the client's primary ID.
+	Name string `json:"name"`
+
+	// NumDNSQueries is the total number of requests.
+	NumDNSQueries uint64 `json:"num_dns_queries"`
+
+	// NumBlocked is the number of requests that have been blocked.
+	NumBlocked uint64 `json:"num_blocked"`
+}
+
+// clientsResp is the response to the GET /control/stats/clients HTTP API.
+type clientsResp struct {
+	Clients []*clientSummaryJSON `json:"clients"`
+}
+
+// clientResp is the response to the GET /control/stats/client HTTP API.
+type clientResp struct {
+	Name      string `json:"name"`
+	TimeUnits string `json:"time_units"`
+
+	TopQueried []topAddrs `json:"top_queried_domains"`
+	TopBlocked []topAddrs `json:"top_blocked_domains"`
+
+	DNSQueries []uint64 `json:"dns_queries"`
+	Blocked    []uint64 `json:"blocked"`
+
+	NumDNSQueries uint64 `json:"num_dns_queries"`
+	NumBlocked    uint64 `json:"num_blocked"`
+}
+
+// loadUnitsForWeb returns the units within the statistics interval.  ok is
+// false if the units couldn't be loaded.
+func (s *StatsCtx) loadUnitsForWeb() (units []*unitDB, curID uint32, ok bool) {
+	s.confMu.RLock()
+	defer s.confMu.RUnlock()
+
+	limit := uint32(s.limit.Hours())
+	if limit == 0 {
+		return nil, 0, true
+	}
+
+	units, curID = s.loadUnits(limit)
+
+	return units, curID, units != nil
+}
+
+// handleStatsClients is the handler for the GET /control/stats/clients HTTP
+// API.  It returns the total statistics of each client within the statistics
+// interval.
+func (s *StatsCtx) handleStatsClients(w http.ResponseWriter, r *http.Request) {
+	units, _, ok := s.loadUnitsForWeb()
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics")
+
+		return
+	}
+
+	sums := map[string]*clientSummaryJSON{}
+	for _, u := range units {
+		for _, cudb := range u.ClientDetails {
+			sum := sums[cudb.Name]
+			if sum == nil {
+				sum = &clientSummaryJSON{Name: cudb.Name}
+				sums[cudb.Name] = sum
+			}
+
+			sum.NumDNSQueries += cudb.NTotal
+			sum.NumBlocked += cudb.NBlocked
+		}
+	}
+
+	resp := &clientsResp{
+		Clients: make([]*clientSummaryJSON, 0, len(sums)),
+	}
+
+	for name, sum := range sums {
+		if s.shouldCountClient([]string{name}) {
+			resp.Clients = append(resp.Clients, sum)
+		}
+	}
+
+	slices.SortFunc(resp.Clients, func(a, b *clientSummaryJSON) (res int) {
+		return cmp.Or(
+			cmp.Compare(b.NumDNSQueries, a.NumDNSQueries),
+			strings.Compare(a.Name, b.Name),
+		)
+	})
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// handleStatsClient is the handler for the GET /control/stats/client HTTP API.
+// It returns the statistics of the client with the ID from the name query
+// parameter within the statistics interval.
+func (s *StatsCtx) handleStatsClient(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		aghhttp.Error(r, w, http.StatusBadRequest, "name: empty value")
+
+		return
+	}
+
+	units, curID, ok := s.loadUnitsForWeb()
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics")
+
+		return
+	}
+
+	resp := s.clientFromUnits(name, units, curID)
+
+	log.Debug("stats: prepared client data in %v", time.Since(start))
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
+
+// clientFromUnits collects the statistics data of the client with the ID name.
+func (s *StatsCtx) clientFromUnits(name string, units []*unitDB, curID uint32) (resp *clientResp) {
+	// Build the per-client units to reuse the existing collectors.
+	clientUnits := make([]*unitDB, 0, len(units))
+	for _, u := range units {
+		cu := &unitDB{NResult: make([]uint64, resultLast)}
+		i := slices.IndexFunc(u.ClientDetails, func(cudb clientUnitDB) (ok bool) {
+			return cudb.Name == name
+		})
+		if i >= 0 {
+			cudb := u.ClientDetails[i]
+			cu.NTotal = cudb.NTotal
+			cu.NResult[RFiltered] = cudb.NBlocked
+			cu.Domains = cudb.Domains
+			cu.BlockedDomains = cudb.BlockedDomains
+		}
+
+		clientUnits = append(clientUnits, cu)
+	}
+
+	data := &StatsResp{}
+	s.fillCollectedStats(data, clientUnits, curID)
+
+	resp = &clientResp{
+		Name:      name,
+		TimeUnits: data.TimeUnits,
+		TopQueried: topsCollector(clientUnits, maxDomains, nil, func(u *unitDB) (pairs []countPair) {
+			return u.Domains
+		}),
+		TopBlocked: topsCollector(clientUnits, maxDomains, nil, func(u *unitDB) (pairs []countPair) {
+			return u.BlockedDomains
+		}),
+		DNSQueries: data.DNSQueries,
+		Blocked:    data.BlockedFiltering,
+	}
+
+	for _, cu := range clientUnits {
+		resp.NumDNSQueries += cu.NTotal
+		resp.NumBlocked += cu.NResult[RFiltered]
+	}
+
+	return resp
+}
@@ -0,0 +1,392 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"go.etcd.io/bbolt"
+)
+
+// maxDailyLimit is the maximum retention interval of the daily statistics.
+const maxDailyLimit = 10 * 365 * timeutil.Day
+
+// dailyBucketName is the name of the database bucket containing the daily
+// units, which the hourly units are downsampled to after they are out of the
+// hourly retention interval.  Its keys are the day numbers since the beginning
+// of UNIX time.
+var dailyBucketName = []byte("daily")
+
+// hoursInDay is the number of hourly units in a daily unit.
+const hoursInDay = 24
+
+// validateDailyIvl returns an error if ivl is not a valid retention interval of
+// the daily statistics for the hourly retention interval limit.
+func validateDailyIvl(ivl, limit time.Duration) (err error) {
+	switch {
+	case ivl == 0:
+		return nil
+	case ivl%timeutil.Day != 0:
+		return errors.Error("not a whole number of days")
+	case ivl < limit:
+		return fmt.Errorf("less than the hourly interval %s", limit)
+	case ivl > maxDailyLimit:
+		return errors.Error("more than ten years")
+	default:
+		return nil
+	}
+}
+
+// merge adds the statistics data from other to udb.  The top lists are
+// truncated the same way the unit serialization does.
+func (udb *unitDB) merge(other *unitDB) {
+	total := udb.NTotal + other.NTotal
+	if total != 0 {
+		udb.TimeAvg = uint32(
+			(uint64(udb.TimeAvg)*udb.NTotal + uint64(other.TimeAvg)*other.NTotal) / total,
+		)
+	}
+
+	udb.NTotal = total
+
+	if len(udb.NResult) < len(other.NResult) {
+		udb.NResult = append(udb.NResult, make([]uint64, len(other.NResult)-len(udb.NResult))...)
+	}
+
+	for i, n := range other.NResult {
+		udb.NResult[i] += n
+	}
+
+	if len(udb.NCacheResult) < len(other.NCacheResult) {
+		udb.NCacheResult = append(
+			udb.NCacheResult,
+			make([]uint64, len(other.NCacheResult)-len(udb.NCacheResult))...,
+		)
+	}
+
+	for i, n := range other.NCacheResult {
+		udb.NCacheResult[i] += n
+	}
+
+	udb.Domains = mergePairs(udb.Domains, other.Domains, maxDomains)
+	udb.BlockedDomains = mergePairs(udb.BlockedDomains, other.BlockedDomains, maxDomains)
+	udb.Clients = mergePairs(udb.Clients, other.Clients, maxClients)
+	udb.UpstreamsResponses = mergePairs(udb.UpstreamsResponses, other.UpstreamsResponses, maxUpstreams)
+	udb.UpstreamsTimeSum = mergePairs(udb.UpstreamsTimeSum, other.UpstreamsTimeSum, maxUpstreams)
+	udb.ThreatCategories = mergePairs(udb.ThreatCategories, other.ThreatCategories, maxDomains)
+	udb.FilterLists = mergePairs(udb.FilterLists, other.FilterLists, maxFilterLists)
+	udb.QuotaClients = mergePairs(udb.QuotaClients, other.QuotaClients, maxClients)
+	udb.QueryTypes = mergePairs(udb.QueryTypes, other.QueryTypes, maxDomains)
+	udb.RCodes = mergePairs(udb.RCodes, other.RCodes, maxDomains)
+
+	udb.UpstreamsPerf = mergeUpstreams(udb.UpstreamsPerf, other.UpstreamsPerf)
+	udb.UpstreamGroupsPerf = mergeUpstreams(udb.UpstreamGroupsPerf, other.UpstreamGroupsPerf)
+
+	clients := deserializeClients(udb.ClientDetails)
+	for _, cudb := range other.ClientDetails {
+		cu := clients[cudb.Name]
+		if cu == nil {
+			cu = newClientUnit()
+			clients[cudb.Name] = cu
+		}
+
+		cu.nTotal += cudb.NTotal
+		cu.nBlocked += cudb.NBlocked
+		addPairs(cu.domains, cudb.Domains)
+		addPairs(cu.blockedDomains, cudb.BlockedDomains)
+	}
+
+	udb.ClientDetails = serializeClients(clients)
+}
+
+// mergePairs returns at most max pairs with the largest sums of counts of a and
+// b.
+func mergePairs(a, b []countPair, max int) (merged []countPair) {
+	m := convertSliceToMap(a)
+	addPairs(m, b)
+
+	return convertMapToSlice(m, max)
+}
+
+// addPairs adds the counts of pairs to m.
+func addPairs(m map[string]uint64, pairs []countPair) {
+	for _, p := range pairs {
+		m[p.Name] += p.Count
+	}
+}
+
+// dayToName converts a day number into a key of the daily units bucket.
+func dayToName(day uint32) (name []byte) {
+	n := [bucketNameLen]byte{}
+	binary.BigEndian.PutUint64(n[:], uint64(day))
+
+	return n[:]
+}
+
+// loadDailyUnit loads the daily unit for day from bkt.  bkt may be nil.  udb is
+// nil if there is no such unit or it can't be decoded.
+func loadDailyUnit(bkt *bbolt.Bucket, day uint32) (udb *unitDB) {
+	if bkt == nil {
+		return nil
+	}
+
+	data := bkt.Get(dayToName(day))
+	if data == nil {
+		return nil
+	}
+
+	udb = &unitDB{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(udb)
+	if err != nil {
+		log.Error("stats: gob decode daily unit %d: %s", day, err)
+
+		return nil
+	}
+
+	return udb
+}
+
+// downsampleUnit merges the hourly unit with id into the daily unit of its day.
+// It does nothing if there is no such hourly unit.
+func downsampleUnit(tx *bbolt.Tx, id uint32) (err error) {
+	udb := loadUnitFromDB(tx, id)
+	if udb == nil {
+		return nil
+	}
+
+	bkt, err := tx.CreateBucketIfNotExists(dailyBucketName)
+	if err != nil {
+		return fmt.Errorf("creating daily bucket: %w", err)
+	}
+
+	day := id / hoursInDay
+	daily := loadDailyUnit(bkt, day)
+	if daily == nil {
+		daily = &unitDB{NResult: make([]uint64, resultLast)}
+	}
+
+	daily.merge(udb)
+
+	log.Debug("stats: downsampling unit %d to day %d", id, day)
+
+	return putDailyUnit(bkt, day, daily)
+}
+
+// putDailyUnit puts udb to bkt as the daily unit for day.
+func putDailyUnit(bkt *bbolt.Bucket, day uint32, udb *unitDB) (err error) {
+	buf := &bytes.Buffer{}
+	err = gob.NewEncoder(buf).Encode(udb)
+	if err != nil {
+		return fmt.Errorf("encoding daily unit: %w", err)
+	}
+
+	err = bkt.Put(dayToName(day), buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("putting daily unit to database: %w", err)
+	}
+
+	return nil
+}
+
+// downsampleOldUnits merges all the hourly units with the identifiers less than
+// firstID into the daily units.
+func downsampleOldUnits(tx *bbolt.Tx, firstID uint32) (err error) {
+	var ids []uint32
+	err = tx.ForEach(func(name []byte, _ *bbolt.Bucket) (_ error) {
+		if id, ok := unitNameToID(name); ok && id < firstID {
+			ids = append(ids, id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("listing units: %w", err)
+	}
+
+	for _, id := range ids {
+		err = downsampleUnit(tx, id)
+		if err != nil {
+			return fmt.Errorf("downsampling unit %d: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteOldDailyUnits deletes the daily units for the days before firstDay.  It
+// returns the number of deletions performed.
+func deleteOldDailyUnits(tx *bbolt.Tx, firstDay uint32) (deleted int, err error) {
+	bkt := tx.Bucket(dailyBucketName)
+	if bkt == nil {
+		return 0, nil
+	}
+
+	// Don't modify the bucket while iterating over it.
+	var keys [][]byte
+	c := bkt.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if len(k) != bucketNameLen || uint32(binary.BigEndian.Uint64(k)) >= firstDay {
+			break
+		}
+
+		keys = append(keys, bytes.Clone(k))
+	}
+
+	for _, k := range keys {
+		err = bkt.Delete(k)
+		if err != nil {
+			return deleted, fmt.Errorf("deleting daily unit: %w", err)
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// downsample moves the hourly unit with id into the daily units and removes the
+// daily units out of the daily retention interval, if the downsampling is
+// enabled.  confMu is expected to be locked.
+func (s *StatsCtx) downsample(tx *bbolt.Tx, id, curID uint32) (err error) {
+	if s.dailyLimit == 0 {
+		return nil
+	}
+
+	err = downsampleUnit(tx, id)
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return err
+	}
+
+	days, curDay := uint32(s.dailyLimit/timeutil.Day), curID/hoursInDay
+	if curDay < days {
+		return nil
+	}
+
+	_, err = deleteOldDailyUnits(tx, curDay-days+1)
+
+	return err
+}
+
+// loadHistory returns the daily units for the last days, including the
+// current one, combined from the downsampled daily units and the hourly units.
+func (s *StatsCtx) loadHistory(days uint32) (units []*unitDB, ok bool) {
+	curDay := s.currID() / hoursInDay
+
+	return s.loadDays(curDay-days+1, days)
+}
+
+// loadDays returns the daily units for n days starting with firstDay, combined
+// from the downsampled daily units and the hourly units.
+func (s *StatsCtx) loadDays(firstDay, n uint32) (units []*unitDB, ok bool) {
+	db := s.db.Load()
+	if db == nil {
+		return nil, false
+	}
+
+	units = make([]*unitDB, n)
+	err := db.View(func(tx *bbolt.Tx) (_ error) {
+		bkt := tx.Bucket(dailyBucketName)
+		for i := range units {
+			units[i] = loadDailyUnit(bkt, firstDay+uint32(i))
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Error("stats: loading daily units: %s", err)
+
+		return nil, false
+	}
+
+	for i, u := range units {
+		if u == nil {
+			units[i] = &unitDB{NResult: make([]uint64, resultLast)}
+		}
+	}
+
+	hourly, ok := s.loadHourly(firstDay*hoursInDay, n*hoursInDay)
+	if !ok {
+		return nil, false
+	}
+
+	for i, u := range hourly {
+		units[i/hoursInDay].merge(u)
+	}
+
+	return units, true
+}
+
+// handleStatsHistory is the handler for the GET /control/stats/history HTTP
+// API.  It returns the daily statistics for the number of days from the days
+// query parameter, which is the whole retention interval by default.
+func (s *StatsCtx) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var (
+		resp *StatsResp
+		ok   bool
+		err  error
+	)
+	func() {
+		s.confMu.RLock()
+		defer s.confMu.RUnlock()
+
+		maxDays := uint32(max(s.dailyLimit, s.limit+timeutil.Day-1) / timeutil.Day)
+
+		days := maxDays
+		if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+			var d uint64
+			d, err = strconv.ParseUint(daysStr, 10, 32)
+			if err != nil {
+				err = fmt.Errorf("days: %w", err)
+
+				return
+			} else if d == 0 || uint32(d) > maxDays {
+				err = fmt.Errorf("days: must be from 1 to %d, got %d", maxDays, d)
+
+				return
+			}
+
+			days = uint32(d)
+		}
+
+		if !s.enabled {
+			resp, ok = s.getData(0, false)
+
+			return
+		}
+
+		var units []*unitDB
+		units, ok = s.loadHistory(days)
+		if ok {
+			// The time series are refilled below, since the units are daily.
+			resp = s.dataFromUnits(units, 0, false)
+			resp.TimeUnits = timeUnitsDays
+			fillCollectedStatsPerUnit(resp, units)
+		}
+	}()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "%s", err)
+
+		return
+	}
+
+	log.Debug("stats: prepared history in %v", time.Since(start))
+
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics history")
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
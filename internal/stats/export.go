@@ -0,0 +1,305 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/AdguardTeam/golibs/timeutil"
+)
+
+// Supported export formats.
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// Supported export resolutions.
+const (
+	exportResolutionHour = "hour"
+	exportResolutionDay  = "day"
+)
+
+// maxExportPoints is the maximum number of points in a single export.
+const maxExportPoints = 10_000
+
+// exportParams are the parameters of a statistics export.
+type exportParams struct {
+	// from is the start of the first point.
+	from time.Time
+
+	// to is the time within the last point.
+	to time.Time
+
+	// resolution is the duration of each point, either [exportResolutionHour]
+	// or [exportResolutionDay].
+	resolution string
+
+	// format is the format of the export, either [exportFormatCSV] or
+	// [exportFormatJSON].
+	format string
+
+	// first is the number of the first point since the beginning of UNIX time.
+	first uint32
+
+	// n is the number of points.
+	n uint32
+}
+
+// parseExportParams parses the export parameters from the URL query q.  now is
+// used as the default end of the range.
+func parseExportParams(q url.Values, now time.Time) (p *exportParams, err error) {
+	p = &exportParams{
+		to:         now,
+		resolution: exportResolutionHour,
+		format:     exportFormatJSON,
+	}
+
+	fromStr := q.Get("from")
+	if fromStr == "" {
+		return nil, errors.Error("from: empty value")
+	}
+
+	p.from, err = time.Parse(time.RFC3339, fromStr)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+
+	if toStr := q.Get("to"); toStr != "" {
+		p.to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+	}
+
+	if p.to.Before(p.from) {
+		return nil, errors.Error("to: must not be before from")
+	}
+
+	switch res := q.Get("resolution"); res {
+	case "":
+		// Go on.
+	case exportResolutionHour, exportResolutionDay:
+		p.resolution = res
+	default:
+		return nil, fmt.Errorf("resolution: unsupported value %q", res)
+	}
+
+	switch format := q.Get("format"); format {
+	case "":
+		// Go on.
+	case exportFormatCSV, exportFormatJSON:
+		p.format = format
+	default:
+		return nil, fmt.Errorf("format: unsupported value %q", format)
+	}
+
+	p.first, p.n, err = p.points()
+	if err != nil {
+		// Don't wrap the error since it's informative enough as is.
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// step returns the duration of a single point.
+func (p *exportParams) step() (d time.Duration) {
+	if p.resolution == exportResolutionDay {
+		return timeutil.Day
+	}
+
+	return time.Hour
+}
+
+// points returns the number of the first point since the beginning of UNIX time
+// and the number of points within the range.
+func (p *exportParams) points() (first, n uint32, err error) {
+	secs := int64(p.step() / time.Second)
+
+	first64, last64 := p.from.Unix()/secs, p.to.Unix()/secs
+	if first64 < 0 {
+		return 0, 0, errors.Error("from: before the beginning of unix time")
+	}
+
+	n64 := last64 - first64 + 1
+	if n64 > maxExportPoints {
+		return 0, 0, fmt.Errorf("range: more than %d points", maxExportPoints)
+	}
+
+	return uint32(first64), uint32(n64), nil
+}
+
+// exportPoint is the statistics data for a single time unit of the export.
+type exportPoint struct {
+	// Time is the start of the time unit.
+	Time time.Time `json:"time"`
+
+	NumDNSQueries           uint64 `json:"num_dns_queries"`
+	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
+	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
+	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
+	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+	NumBlockedThreatFeeds   uint64 `json:"num_blocked_threat_feeds"`
+
+	// AvgProcessingTime is the average processing time in seconds.
+	AvgProcessingTime float64 `json:"avg_processing_time"`
+}
+
+// newExportPoint returns the export point for u starting at t.
+func newExportPoint(u *unitDB, t time.Time) (p *exportPoint) {
+	return &exportPoint{
+		Time:                    t,
+		NumDNSQueries:           u.NTotal,
+		NumBlockedFiltering:     u.NResult[RFiltered],
+		NumReplacedSafebrowsing: u.NResult[RSafeBrowsing],
+		NumReplacedSafesearch:   u.NResult[RSafeSearch],
+		NumReplacedParental:     u.NResult[RParental],
+		NumBlockedThreatFeeds:   u.NResult[RThreatFeed],
+		AvgProcessingTime:       microsecondsToSeconds(float64(u.TimeAvg)),
+	}
+}
+
+// exportResp is the response to the GET /control/stats/export HTTP API in the
+// JSON format.
+type exportResp struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Resolution string    `json:"resolution"`
+
+	Points []*exportPoint `json:"points"`
+
+	TopQueried []topAddrs `json:"top_queried_domains"`
+	TopBlocked []topAddrs `json:"top_blocked_domains"`
+	TopClients []topAddrs `json:"top_clients"`
+}
+
+// exportCSVHeader is the header of the statistics export in the CSV format.
+var exportCSVHeader = []string{
+	"time",
+	"num_dns_queries",
+	"num_blocked_filtering",
+	"num_replaced_safebrowsing",
+	"num_replaced_safesearch",
+	"num_replaced_parental",
+	"num_blocked_threat_feeds",
+	"avg_processing_time",
+}
+
+// writeExportCSV writes points to w in the CSV format.
+func writeExportCSV(w io.Writer, points []*exportPoint) (err error) {
+	cw := csv.NewWriter(w)
+
+	err = cw.Write(exportCSVHeader)
+	if err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	for _, p := range points {
+		err = cw.Write([]string{
+			p.Time.Format(time.RFC3339),
+			strconv.FormatUint(p.NumDNSQueries, 10),
+			strconv.FormatUint(p.NumBlockedFiltering, 10),
+			strconv.FormatUint(p.NumReplacedSafebrowsing, 10),
+			strconv.FormatUint(p.NumReplacedSafesearch, 10),
+			strconv.FormatUint(p.NumReplacedParental, 10),
+			strconv.FormatUint(p.NumBlockedThreatFeeds, 10),
+			strconv.FormatFloat(p.AvgProcessingTime, 'f', -1, 64),
+		})
+		if err != nil {
+			return fmt.Errorf("writing point: %w", err)
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// export returns the statistics data for the range and the resolution from p.
+// ok is false if the units couldn't be loaded.  s.confMu is expected to be
+// locked.
+func (s *StatsCtx) export(p *exportParams) (resp *exportResp, ok bool) {
+	var units []*unitDB
+	if p.resolution == exportResolutionDay {
+		units, ok = s.loadDays(p.first, p.n)
+	} else {
+		units, ok = s.loadHourly(p.first, p.n)
+	}
+
+	if !ok {
+		return nil, false
+	}
+
+	step := p.step()
+	start := time.Unix(int64(p.first)*int64(step/time.Second), 0).UTC()
+
+	resp = &exportResp{
+		From:       p.from,
+		To:         p.to,
+		Resolution: p.resolution,
+		Points:     make([]*exportPoint, 0, len(units)),
+		TopQueried: topsCollector(units, maxDomains, s.ignored, func(u *unitDB) (pairs []countPair) {
+			return u.Domains
+		}),
+		TopBlocked: topsCollector(units, maxDomains, s.ignored, func(u *unitDB) (pairs []countPair) {
+			return u.BlockedDomains
+		}),
+		TopClients: topsCollector(units, maxClients, nil, topClientPairs(s)),
+	}
+
+	for i, u := range units {
+		resp.Points = append(resp.Points, newExportPoint(u, start.Add(time.Duration(i)*step)))
+	}
+
+	return resp, true
+}
+
+// handleStatsExport is the handler for the GET /control/stats/export HTTP API.
+func (s *StatsCtx) handleStatsExport(w http.ResponseWriter, r *http.Request) {
+	p, err := parseExportParams(r.URL.Query(), time.Now())
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "parsing params: %s", err)
+
+		return
+	}
+
+	var (
+		resp *exportResp
+		ok   bool
+	)
+	func() {
+		s.confMu.RLock()
+		defer s.confMu.RUnlock()
+
+		resp, ok = s.export(p)
+	}()
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics")
+
+		return
+	}
+
+	if p.format == exportFormatJSON {
+		aghhttp.WriteJSONResponseOK(w, r, resp)
+
+		return
+	}
+
+	h := w.Header()
+	h.Set(httphdr.ContentType, "text/csv")
+	h.Set(httphdr.ContentDisposition, `attachment; filename="stats.csv"`)
+
+	err = writeExportCSV(w, resp.Points)
+	if err != nil {
+		log.Debug("stats: export: %s", err)
+	}
+}
@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"bytes"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExportParams(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		query      url.Values
+		want       *exportParams
+		name       string
+		wantErrMsg string
+	}{{
+		query: url.Values{"from": {"2024-01-02T01:00:00Z"}},
+		want: &exportParams{
+			from:       time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC),
+			to:         now,
+			resolution: exportResolutionHour,
+			format:     exportFormatJSON,
+			first:      uint32(now.Unix()/3600) - 2,
+			n:          3,
+		},
+		name:       "defaults",
+		wantErrMsg: "",
+	}, {
+		query: url.Values{
+			"from":       {"2024-01-01T12:00:00Z"},
+			"to":         {"2024-01-02T00:00:00Z"},
+			"resolution": {exportResolutionDay},
+			"format":     {exportFormatCSV},
+		},
+		want: &exportParams{
+			from:       time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+			to:         time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			resolution: exportResolutionDay,
+			format:     exportFormatCSV,
+			first:      uint32(now.Unix()/86400) - 1,
+			n:          2,
+		},
+		name:       "days_csv",
+		wantErrMsg: "",
+	}, {
+		query:      url.Values{},
+		want:       nil,
+		name:       "no_from",
+		wantErrMsg: "from: empty value",
+	}, {
+		query: url.Values{
+			"from": {"2024-01-02T00:00:00Z"},
+			"to":   {"2024-01-01T00:00:00Z"},
+		},
+		want:       nil,
+		name:       "reversed",
+		wantErrMsg: "to: must not be before from",
+	}, {
+		query: url.Values{
+			"from":       {"2024-01-02T00:00:00Z"},
+			"resolution": {"week"},
+		},
+		want:       nil,
+		name:       "bad_resolution",
+		wantErrMsg: `resolution: unsupported value "week"`,
+	}, {
+		query: url.Values{
+			"from":   {"2024-01-02T00:00:00Z"},
+			"format": {"xml"},
+		},
+		want:       nil,
+		name:       "bad_format",
+		wantErrMsg: `format: unsupported value "xml"`,
+	}, {
+		query:      url.Values{"from": {"2020-01-01T00:00:00Z"}},
+		want:       nil,
+		name:       "too_many_points",
+		wantErrMsg: "range: more than 10000 points",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parseExportParams(tc.query, now)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+
+			assert.Equal(t, tc.want, p)
+		})
+	}
+}
+
+func TestStatsCtx_export(t *testing.T) {
+	const cliIP = "192.0.2.1"
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := uint32(start.Unix() / 3600)
+
+	s, err := New(Config{
+		ShouldCountClient: func([]string) bool { return true },
+		UnitID:            func() (id uint32) { return atomic.LoadUint32(&r) },
+		Filename:          filepath.Join(t.TempDir(), "stats.db"),
+		Limit:             timeutil.Day,
+		Enabled:           true,
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	s.Update(&Entry{Domain: "example.org", Client: cliIP, Result: RNotFiltered})
+	s.Update(&Entry{Domain: "blocked.example", Client: cliIP, Result: RFiltered})
+
+	atomic.AddUint32(&r, 1)
+	_, _ = s.flush()
+
+	s.Update(&Entry{Domain: "example.org", Client: cliIP, Result: RNotFiltered})
+
+	p, err := parseExportParams(url.Values{
+		"from": {start.Format(time.RFC3339)},
+		"to":   {start.Add(2 * time.Hour).Format(time.RFC3339)},
+	}, time.Now())
+	require.NoError(t, err)
+
+	resp, ok := s.export(p)
+	require.True(t, ok)
+	require.Len(t, resp.Points, 3)
+
+	assert.Equal(t, start, resp.Points[0].Time)
+	assert.Equal(t, uint64(2), resp.Points[0].NumDNSQueries)
+	assert.Equal(t, uint64(1), resp.Points[0].NumBlockedFiltering)
+	assert.Equal(t, uint64(1), resp.Points[1].NumDNSQueries)
+	assert.Zero(t, resp.Points[2].NumDNSQueries)
+
+	assert.Equal(t, []topAddrs{{"example.org": 2}}, resp.TopQueried)
+	assert.Equal(t, []topAddrs{{cliIP: 3}}, resp.TopClients)
+
+	p.resolution = exportResolutionDay
+	p.first, p.n, err = p.points()
+	require.NoError(t, err)
+
+	resp, ok = s.export(p)
+	require.True(t, ok)
+	require.Len(t, resp.Points, 1)
+
+	assert.Equal(t, uint64(3), resp.Points[0].NumDNSQueries)
+
+	buf := &bytes.Buffer{}
+	err = writeExportCSV(buf, resp.Points)
+	require.NoError(t, err)
+
+	assert.Equal(t, "time,num_dns_queries,num_blocked_filtering,"+
+		"num_replaced_safebrowsing,num_replaced_safesearch,num_replaced_parental,"+
+		"num_blocked_threat_feeds,avg_processing_time\n"+
+		"2024-01-01T00:00:00Z,3,1,0,0,0,0,0\n", buf.String())
+}
@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// maxFilterLists is the max number of filter lists stored in a single unit.
+const maxFilterLists = 1000
+
+// filterListSeriesJSON is the time series of the number of requests blocked by
+// a single filter list.
+type filterListSeriesJSON struct {
+	// ID is the ID of the filter list.  The negative IDs are the built-in
+	// lists, and 0 is the user rules.
+	ID int `json:"id"`
+
+	NumBlocked []uint64 `json:"num_blocked"`
+}
+
+// filterListsResp is the response to the GET /control/stats/filter_lists HTTP
+// API.
+type filterListsResp struct {
+	TimeUnits string `json:"time_units"`
+
+	FilterLists []*filterListSeriesJSON `json:"filter_lists"`
+}
+
+// filterListSeries returns the time series of the number of blocked requests of
+// each filter list sorted by the total number in descending order.  Each
+// element of timeUnits is the units of a single point.
+func filterListSeries(timeUnits [][]*unitDB) (series []*filterListSeriesJSON) {
+	totals := map[int]uint64{}
+	byID := map[string]*filterListSeriesJSON{}
+	for i, units := range timeUnits {
+		for _, u := range units {
+			for _, cp := range u.FilterLists {
+				s := byID[cp.Name]
+				if s == nil {
+					id, err := strconv.Atoi(cp.Name)
+					if err != nil {
+						log.Debug("stats: bad filter list id %q: %s", cp.Name, err)
+
+						continue
+					}
+
+					s = &filterListSeriesJSON{
+						ID:         id,
+						NumBlocked: make([]uint64, len(timeUnits)),
+					}
+					byID[cp.Name] = s
+				}
+
+				s.NumBlocked[i] += cp.Count
+				totals[s.ID] += cp.Count
+			}
+		}
+	}
+
+	series = make([]*filterListSeriesJSON, 0, len(byID))
+	for _, s := range byID {
+		series = append(series, s)
+	}
+
+	slices.SortFunc(series, func(a, b *filterListSeriesJSON) (res int) {
+		return cmp.Or(
+			cmp.Compare(totals[b.ID], totals[a.ID]),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	return series
+}
+
+// handleStatsFilterLists is the handler for the GET /control/stats/filter_lists
+// HTTP API.  It returns the time series of the number of requests blocked by
+// each filter list within the statistics interval.
+func (s *StatsCtx) handleStatsFilterLists(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	units, curID, ok := s.loadUnitsForWeb()
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics")
+
+		return
+	}
+
+	timeUnits, split := splitTimeUnits(units, curID)
+	resp := &filterListsResp{
+		TimeUnits:   timeUnits,
+		FilterLists: filterListSeries(split),
+	}
+
+	log.Debug("stats: prepared filter lists data in %v", time.Since(start))
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
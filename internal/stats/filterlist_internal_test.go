@@ -0,0 +1,29 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterListSeries(t *testing.T) {
+	const cliIP = "192.0.2.1"
+
+	u1 := newUnit(0)
+	u1.add(&Entry{Domain: "a.example", Client: cliIP, Result: RFiltered, FilterList: "1"})
+	u1.add(&Entry{Domain: "b.example", Client: cliIP, Result: RFiltered, FilterList: "0"})
+	u1.add(&Entry{Domain: "c.example", Client: cliIP, Result: RFiltered, FilterList: "0"})
+	u1.add(&Entry{Domain: "d.example", Client: cliIP, Result: RNotFiltered, FilterList: "2"})
+
+	u2 := newUnit(1)
+	u2.add(&Entry{Domain: "a.example", Client: cliIP, Result: RFiltered, FilterList: "1"})
+	u2.add(&Entry{Domain: "a.example", Client: cliIP, Result: RFiltered, FilterList: "1"})
+
+	_, split := splitTimeUnits([]*unitDB{u1.serialize(), u2.serialize()}, 1)
+	series := filterListSeries(split)
+	require.Len(t, series, 2)
+
+	assert.Equal(t, &filterListSeriesJSON{ID: 1, NumBlocked: []uint64{1, 2}}, series[0])
+	assert.Equal(t, &filterListSeriesJSON{ID: 0, NumBlocked: []uint64{2, 0}}, series[1])
+}
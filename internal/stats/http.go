@@ -32,25 +32,67 @@ type StatsResp struct {
 	TopUpstreamsResponses []topAddrs      `json:"top_upstreams_responses"`
 	TopUpstreamsAvgTime   []topAddrsFloat `json:"top_upstreams_avg_time"`
 
+	TopThreatCategories []topAddrs `json:"top_threat_categories"`
+
+	// TopQuotaClients are the clients with the most requests exceeding their
+	// query quotas.
+	TopQuotaClients []topAddrs `json:"top_quota_exceeded_clients"`
+
+	TopQueryTypes    []topAddrs `json:"top_query_types"`
+	TopResponseCodes []topAddrs `json:"top_response_codes"`
+
 	DNSQueries []uint64 `json:"dns_queries"`
 
 	BlockedFiltering     []uint64 `json:"blocked_filtering"`
 	ReplacedSafebrowsing []uint64 `json:"replaced_safebrowsing"`
 	ReplacedParental     []uint64 `json:"replaced_parental"`
 
+	CacheHits      []uint64 `json:"cache_hits"`
+	CacheMisses    []uint64 `json:"cache_misses"`
+	CacheStaleHits []uint64 `json:"cache_stale_hits"`
+
+	// QueryTypes are the time series of the number of requests by the name of
+	// the question type.
+	QueryTypes map[string][]uint64 `json:"query_types"`
+
+	// ResponseCodes are the time series of the number of responses by the name
+	// of the response code.
+	ResponseCodes map[string][]uint64 `json:"response_codes"`
+
 	NumDNSQueries           uint64 `json:"num_dns_queries"`
 	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
 	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
 	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
 	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+	NumBlockedThreatFeeds   uint64 `json:"num_blocked_threat_feeds"`
+	NumCacheHits            uint64 `json:"num_cache_hits"`
+	NumCacheMisses          uint64 `json:"num_cache_misses"`
+	NumCacheStaleHits       uint64 `json:"num_cache_stale_hits"`
 
 	AvgProcessingTime float64 `json:"avg_processing_time"`
 }
 
+// groupByRegistrable is the value of the group_by query parameter of the GET
+// /control/stats HTTP API which groups the top domains by their registrable
+// domains.
+const groupByRegistrable = "registrable_domain"
+
 // handleStats is the handler for the GET /control/stats HTTP API.
 func (s *StatsCtx) handleStats(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	var byRegistrable bool
+	switch groupBy := r.URL.Query().Get("group_by"); groupBy {
+	case "":
+		// Go on.
+	case groupByRegistrable:
+		byRegistrable = true
+	default:
+		aghhttp.Error(r, w, http.StatusBadRequest, "unsupported group_by value %q", groupBy)
+
+		return
+	}
+
 	var (
 		resp *StatsResp
 		ok   bool
@@ -59,7 +101,7 @@ func (s *StatsCtx) handleStats(w http.ResponseWriter, r *http.Request) {
 		s.confMu.RLock()
 		defer s.confMu.RUnlock()
 
-		resp, ok = s.getData(uint32(s.limit.Hours()))
+		resp, ok = s.getData(uint32(s.limit.Hours()), byRegistrable)
 	}()
 
 	log.Debug("stats: prepared data in %v", time.Since(start))
@@ -230,6 +272,13 @@ func (s *StatsCtx) initWeb() {
 	s.httpRegister(http.MethodPost, "/control/stats_reset", s.handleStatsReset)
 	s.httpRegister(http.MethodGet, "/control/stats/config", s.handleGetStatsConfig)
 	s.httpRegister(http.MethodPut, "/control/stats/config/update", s.handlePutStatsConfig)
+	s.httpRegister(http.MethodGet, "/control/stats/clients", s.handleStatsClients)
+	s.httpRegister(http.MethodGet, "/control/stats/client", s.handleStatsClient)
+	s.httpRegister(http.MethodGet, "/control/stats/history", s.handleStatsHistory)
+	s.httpRegister(http.MethodGet, "/control/stats/export", s.handleStatsExport)
+	s.httpRegister(http.MethodGet, "/control/stats/upstreams", s.handleStatsUpstreams)
+	s.httpRegister(http.MethodGet, "/control/stats/filter_lists", s.handleStatsFilterLists)
+	s.httpRegister(http.MethodGet, "/control/stats/compare", s.handleStatsCompare)
 
 	// Deprecated handlers.
 	s.httpRegister(http.MethodGet, "/control/stats_info", s.handleStatsInfo)
@@ -0,0 +1,337 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"go.etcd.io/bbolt"
+)
+
+// Period is the period of the statistics reports, for example a billing period.
+type Period string
+
+// Supported Period values.
+const (
+	PeriodNone  Period = ""
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+)
+
+// Validate returns an error if p is not a supported period.
+func (p Period) Validate() (err error) {
+	switch p {
+	case PeriodNone, PeriodDay, PeriodWeek, PeriodMonth:
+		return nil
+	default:
+		return fmt.Errorf("unsupported period %q", p)
+	}
+}
+
+// secsInHour is the number of seconds in an hour.
+const secsInHour = int64(time.Hour / time.Second)
+
+// periodsBucketName is the name of the bucket with the counters of the periods
+// finished by the scheduled resets.
+var periodsBucketName = []byte("periods")
+
+// bounds returns the IDs of the first hourly unit of the period containing the
+// unit with id and of the first one of the next period.  The periods start at
+// midnight in loc, and the weeks start on Monday.  p must not be [PeriodNone].
+func (p Period) bounds(id uint32, loc *time.Location) (first, next uint32) {
+	y, m, d := time.Unix(int64(id)*secsInHour, 0).In(loc).Date()
+
+	var start, end time.Time
+	switch p {
+	case PeriodDay:
+		start = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 0, 1)
+	case PeriodWeek:
+		t := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		start = t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+		end = start.AddDate(0, 0, 7)
+	default:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 1, 0)
+	}
+
+	return uint32(start.Unix() / secsInHour), uint32(end.Unix() / secsInHour)
+}
+
+// periodCounters are the main counters of a statistics period.
+//
+// NOTE: Do not change the names or types of fields, as this structure is used
+// for GOB encoding.
+type periodCounters struct {
+	NumDNSQueries           uint64 `json:"num_dns_queries"`
+	NumBlockedFiltering     uint64 `json:"num_blocked_filtering"`
+	NumReplacedSafebrowsing uint64 `json:"num_replaced_safebrowsing"`
+	NumReplacedSafesearch   uint64 `json:"num_replaced_safesearch"`
+	NumReplacedParental     uint64 `json:"num_replaced_parental"`
+	NumBlockedThreatFeeds   uint64 `json:"num_blocked_threat_feeds"`
+}
+
+// add adds the counters of u to c.
+func (c *periodCounters) add(u *unitDB) {
+	c.NumDNSQueries += u.NTotal
+	c.NumBlockedFiltering += u.NResult[RFiltered]
+	c.NumReplacedSafebrowsing += u.NResult[RSafeBrowsing]
+	c.NumReplacedSafesearch += u.NResult[RSafeSearch]
+	c.NumReplacedParental += u.NResult[RParental]
+	c.NumBlockedThreatFeeds += u.NResult[RThreatFeed]
+}
+
+// countersInRange returns the counters of the units from first up to next,
+// except the one with skipID.  The counters saved by the scheduled reset of the
+// period starting with first are preferred.  The daily units are included if
+// their first hour is within the range.
+func countersInRange(tx *bbolt.Tx, first, next, skipID uint32) (c *periodCounters) {
+	c = &periodCounters{}
+	if data := bucketGet(tx, periodsBucketName, idToUnitName(first)); data != nil {
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(c)
+		if err == nil {
+			return c
+		}
+
+		log.Error("stats: gob decode period %d: %s", first, err)
+		c = &periodCounters{}
+	}
+
+	for id := first; id < next; id++ {
+		if id == skipID {
+			continue
+		}
+
+		if u := loadUnitFromDB(tx, id); u != nil {
+			c.add(u)
+		}
+	}
+
+	bkt := tx.Bucket(dailyBucketName)
+	for day := (first + hoursInDay - 1) / hoursInDay; day*hoursInDay < next; day++ {
+		if u := loadDailyUnit(bkt, day); u != nil {
+			c.add(u)
+		}
+	}
+
+	return c
+}
+
+// bucketGet returns the value of key from the bucket with name, if any.
+func bucketGet(tx *bbolt.Tx, name, key []byte) (val []byte) {
+	bkt := tx.Bucket(name)
+	if bkt == nil {
+		return nil
+	}
+
+	return bkt.Get(key)
+}
+
+// resetIfPeriodEnded saves the counters of the period containing the unit with
+// lastID and removes all the units, if id belongs to the next period.  The
+// unit with lastID is expected to be flushed.  confMu is expected to be
+// locked.
+func (s *StatsCtx) resetIfPeriodEnded(tx *bbolt.Tx, lastID, id uint32) (err error) {
+	if s.resetPeriod == PeriodNone {
+		return nil
+	}
+
+	first, next := s.resetPeriod.bounds(lastID, time.Local)
+	if id < next {
+		return nil
+	}
+
+	c := countersInRange(tx, first, next, id)
+
+	buf := &bytes.Buffer{}
+	err = gob.NewEncoder(buf).Encode(c)
+	if err != nil {
+		return fmt.Errorf("encoding period: %w", err)
+	}
+
+	bkt, err := tx.CreateBucketIfNotExists(periodsBucketName)
+	if err != nil {
+		return fmt.Errorf("creating periods bucket: %w", err)
+	}
+
+	err = bkt.Put(idToUnitName(first), buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("putting period: %w", err)
+	}
+
+	deleteOldUnits(tx, id)
+	err = tx.DeleteBucket(dailyBucketName)
+	if err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+		return fmt.Errorf("deleting daily units: %w", err)
+	}
+
+	log.Info("stats: %s ended, statistics reset", s.resetPeriod)
+
+	return nil
+}
+
+// periodCounters returns the counters of the units from first up to next,
+// including the current one.
+func (s *StatsCtx) periodCounters(first, next uint32) (c *periodCounters, ok bool) {
+	db := s.db.Load()
+	if db == nil {
+		return nil, false
+	}
+
+	// Serialize the current unit before opening the transaction, since
+	// flushing locks currMu before opening a writable one.
+	var cur *unitDB
+	curID := s.unitIDGen()
+	func() {
+		s.currMu.RLock()
+		defer s.currMu.RUnlock()
+
+		if s.curr != nil {
+			curID = s.curr.id
+			if curID >= first && curID < next {
+				cur = s.curr.serialize()
+			}
+		}
+	}()
+
+	err := db.View(func(tx *bbolt.Tx) (_ error) {
+		c = countersInRange(tx, first, next, curID)
+
+		return nil
+	})
+	if err != nil {
+		log.Error("stats: loading period: %s", err)
+
+		return nil, false
+	}
+
+	if cur != nil {
+		c.add(cur)
+	}
+
+	return c, true
+}
+
+// periodResp is the counters of a single period.
+type periodResp struct {
+	// Start is the start of the period.
+	Start time.Time `json:"start"`
+
+	// End is the start of the next period.
+	End time.Time `json:"end"`
+
+	periodCounters
+}
+
+// periodDelta is the difference between the counters of the current and the
+// previous periods.
+type periodDelta struct {
+	NumDNSQueries           int64 `json:"num_dns_queries"`
+	NumBlockedFiltering     int64 `json:"num_blocked_filtering"`
+	NumReplacedSafebrowsing int64 `json:"num_replaced_safebrowsing"`
+	NumReplacedSafesearch   int64 `json:"num_replaced_safesearch"`
+	NumReplacedParental     int64 `json:"num_replaced_parental"`
+	NumBlockedThreatFeeds   int64 `json:"num_blocked_threat_feeds"`
+}
+
+// newPeriodDelta returns the difference between cur and prev.
+func newPeriodDelta(cur, prev *periodCounters) (d *periodDelta) {
+	return &periodDelta{
+		NumDNSQueries:           int64(cur.NumDNSQueries) - int64(prev.NumDNSQueries),
+		NumBlockedFiltering:     int64(cur.NumBlockedFiltering) - int64(prev.NumBlockedFiltering),
+		NumReplacedSafebrowsing: int64(cur.NumReplacedSafebrowsing) - int64(prev.NumReplacedSafebrowsing),
+		NumReplacedSafesearch:   int64(cur.NumReplacedSafesearch) - int64(prev.NumReplacedSafesearch),
+		NumReplacedParental:     int64(cur.NumReplacedParental) - int64(prev.NumReplacedParental),
+		NumBlockedThreatFeeds:   int64(cur.NumBlockedThreatFeeds) - int64(prev.NumBlockedThreatFeeds),
+	}
+}
+
+// compareResp is the response to the GET /control/stats/compare HTTP API.
+type compareResp struct {
+	Current  *periodResp  `json:"current"`
+	Previous *periodResp  `json:"previous"`
+	Delta    *periodDelta `json:"delta"`
+	Period   Period       `json:"period"`
+}
+
+// compare returns the counters of the current and the previous periods p.  p
+// must not be [PeriodNone].  ok is false if the units couldn't be loaded.
+func (s *StatsCtx) compare(p Period) (resp *compareResp, ok bool) {
+	curFirst, curNext := p.bounds(s.currID(), time.Local)
+	prevFirst, _ := p.bounds(curFirst-1, time.Local)
+
+	cur, ok := s.periodCounters(curFirst, curNext)
+	if !ok {
+		return nil, false
+	}
+
+	prev, ok := s.periodCounters(prevFirst, curFirst)
+	if !ok {
+		return nil, false
+	}
+
+	idToTime := func(id uint32) (t time.Time) {
+		return time.Unix(int64(id)*secsInHour, 0)
+	}
+
+	return &compareResp{
+		Current: &periodResp{
+			Start:          idToTime(curFirst),
+			End:            idToTime(curNext),
+			periodCounters: *cur,
+		},
+		Previous: &periodResp{
+			Start:          idToTime(prevFirst),
+			End:            idToTime(curFirst),
+			periodCounters: *prev,
+		},
+		Delta:  newPeriodDelta(cur, prev),
+		Period: p,
+	}, true
+}
+
+// handleStatsCompare is the handler for the GET /control/stats/compare HTTP
+// API.  It returns the main counters of the current and the previous periods
+// from the period query parameter, which is the reset period or a day by
+// default.
+func (s *StatsCtx) handleStatsCompare(w http.ResponseWriter, r *http.Request) {
+	p := Period(r.URL.Query().Get("period"))
+	err := p.Validate()
+	if err != nil {
+		aghhttp.Error(r, w, http.StatusBadRequest, "period: %s", err)
+
+		return
+	}
+
+	var (
+		resp *compareResp
+		ok   bool
+	)
+	func() {
+		s.confMu.RLock()
+		defer s.confMu.RUnlock()
+
+		if p == PeriodNone {
+			p = s.resetPeriod
+		}
+
+		if p == PeriodNone {
+			p = PeriodDay
+		}
+
+		resp, ok = s.compare(p)
+	}()
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics")
+
+		return
+	}
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeToID returns the ID of the hourly unit containing t.
+func timeToID(t time.Time) (id uint32) {
+	return uint32(t.Unix() / secsInHour)
+}
+
+func TestPeriod_bounds(t *testing.T) {
+	// Wednesday.
+	id := timeToID(time.Date(2024, 2, 14, 15, 0, 0, 0, time.UTC))
+
+	testCases := []struct {
+		wantFirst time.Time
+		wantNext  time.Time
+		name      string
+		period    Period
+	}{{
+		wantFirst: time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC),
+		wantNext:  time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC),
+		name:      "day",
+		period:    PeriodDay,
+	}, {
+		wantFirst: time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC),
+		wantNext:  time.Date(2024, 2, 19, 0, 0, 0, 0, time.UTC),
+		name:      "week",
+		period:    PeriodWeek,
+	}, {
+		wantFirst: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		wantNext:  time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		name:      "month",
+		period:    PeriodMonth,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, next := tc.period.bounds(id, time.UTC)
+			assert.Equal(t, timeToID(tc.wantFirst), first)
+			assert.Equal(t, timeToID(tc.wantNext), next)
+		})
+	}
+}
+
+func TestStatsCtx_compare(t *testing.T) {
+	const cliIP = "192.0.2.1"
+
+	r := timeToID(time.Date(2024, 1, 31, 23, 0, 0, 0, time.Local))
+
+	s, err := New(Config{
+		ShouldCountClient: func([]string) bool { return true },
+		UnitID:            func() (id uint32) { return atomic.LoadUint32(&r) },
+		Filename:          filepath.Join(t.TempDir(), "stats.db"),
+		Limit:             timeutil.Day,
+		ResetPeriod:       PeriodMonth,
+		Enabled:           true,
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	s.Update(&Entry{Domain: "example.org", Client: cliIP, Result: RNotFiltered})
+	s.Update(&Entry{Domain: "blocked.example", Client: cliIP, Result: RFiltered})
+
+	atomic.AddUint32(&r, 1)
+	_, _ = s.flush()
+
+	units, _ := s.loadUnits(uint32(s.limit.Hours()))
+	for _, u := range units {
+		require.Zero(t, u.NTotal)
+	}
+
+	s.Update(&Entry{Domain: "example.org", Client: cliIP, Result: RNotFiltered})
+
+	resp, ok := s.compare(PeriodMonth)
+	require.True(t, ok)
+
+	assert.Equal(t, uint64(1), resp.Current.NumDNSQueries)
+	assert.Equal(t, uint64(2), resp.Previous.NumDNSQueries)
+	assert.Equal(t, uint64(1), resp.Previous.NumBlockedFiltering)
+	assert.Equal(t, int64(-1), resp.Delta.NumDNSQueries)
+	assert.Equal(t, int64(-1), resp.Delta.NumBlockedFiltering)
+
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local), resp.Current.Start)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), resp.Previous.Start)
+}
@@ -0,0 +1,165 @@
+package stats
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/AdguardTeam/golibs/log"
+	"go.etcd.io/bbolt"
+)
+
+// PurgeClient implements the [Interface] interface for *StatsCtx.
+func (s *StatsCtx) PurgeClient(ids []string) (removed uint64, err error) {
+	removed = s.purgeClientsFromCurr(ids)
+
+	// Don't hold currMu while updating the database, since loadUnits locks
+	// it within a transaction.
+	db := s.db.Load()
+	if db == nil {
+		return removed, nil
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) (txErr error) {
+		var n uint64
+		n, txErr = purgeClientsFromDB(tx, ids)
+		removed += n
+
+		return txErr
+	})
+	if err != nil {
+		return removed, fmt.Errorf("purging database: %w", err)
+	}
+
+	log.Info("stats: purged %d requests of clients %q", removed, ids)
+
+	return removed, nil
+}
+
+// purgeClientsFromCurr removes the request counters of the clients with ids
+// from the current unit.
+func (s *StatsCtx) purgeClientsFromCurr(ids []string) (removed uint64) {
+	s.currMu.Lock()
+	defer s.currMu.Unlock()
+
+	if s.curr == nil {
+		return 0
+	}
+
+	for _, id := range ids {
+		removed += s.curr.clients[id]
+		delete(s.curr.clients, id)
+		delete(s.curr.clientDetails, id)
+		delete(s.curr.quotaClients, id)
+	}
+
+	return removed
+}
+
+// purgeClientsFromDB removes the request counters of the clients with ids from
+// each unit stored in the database.
+func purgeClientsFromDB(tx *bbolt.Tx, ids []string) (removed uint64, err error) {
+	// Don't modify the buckets while iterating over them.
+	var unitIDs []uint32
+	err = tx.ForEach(func(name []byte, _ *bbolt.Bucket) (_ error) {
+		if id, ok := unitNameToID(name); ok {
+			unitIDs = append(unitIDs, id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("listing units: %w", err)
+	}
+
+	for _, id := range unitIDs {
+		udb := loadUnitFromDB(tx, id)
+		if udb == nil {
+			continue
+		}
+
+		n := udb.removeClients(ids)
+		if n == 0 {
+			continue
+		}
+
+		err = udb.flushUnitToDB(tx, id)
+		if err != nil {
+			return removed, fmt.Errorf("flushing unit %d: %w", id, err)
+		}
+
+		removed += n
+	}
+
+	n, err := purgeClientsFromDaily(tx, ids)
+	if err != nil {
+		return removed, fmt.Errorf("purging daily units: %w", err)
+	}
+
+	return removed + n, nil
+}
+
+// purgeClientsFromDaily removes the request counters of the clients with ids
+// from each downsampled daily unit.
+func purgeClientsFromDaily(tx *bbolt.Tx, ids []string) (removed uint64, err error) {
+	bkt := tx.Bucket(dailyBucketName)
+	if bkt == nil {
+		return 0, nil
+	}
+
+	// Don't modify the bucket while iterating over it.
+	var days []uint32
+	err = bkt.ForEach(func(k, _ []byte) (_ error) {
+		if day, ok := unitNameToID(k); ok {
+			days = append(days, day)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("listing daily units: %w", err)
+	}
+
+	for _, day := range days {
+		udb := loadDailyUnit(bkt, day)
+		if udb == nil {
+			continue
+		}
+
+		n := udb.removeClients(ids)
+		if n == 0 {
+			continue
+		}
+
+		err = putDailyUnit(bkt, day, udb)
+		if err != nil {
+			return removed, fmt.Errorf("day %d: %w", day, err)
+		}
+
+		removed += n
+	}
+
+	return removed, nil
+}
+
+// removeClients removes the counters of the clients with ids from udb and
+// returns the number of the removed requests.
+func (udb *unitDB) removeClients(ids []string) (removed uint64) {
+	clients := udb.Clients[:0]
+	for _, p := range udb.Clients {
+		if slices.Contains(ids, p.Name) {
+			removed += p.Count
+		} else {
+			clients = append(clients, p)
+		}
+	}
+
+	udb.Clients = clients
+	udb.ClientDetails = slices.DeleteFunc(udb.ClientDetails, func(cudb clientUnitDB) (ok bool) {
+		return slices.Contains(ids, cudb.Name)
+	})
+	udb.QuotaClients = slices.DeleteFunc(udb.QuotaClients, func(p countPair) (ok bool) {
+		return slices.Contains(ids, p.Name)
+	})
+
+	return removed
+}
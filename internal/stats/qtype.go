@@ -0,0 +1,42 @@
+package stats
+
+import "github.com/miekg/dns"
+
+// queryTypeName returns the name of the question type qt, for example "A" or
+// "TYPE65534" for the unknown ones.
+func queryTypeName(qt uint16) (name string) {
+	return dns.Type(qt).String()
+}
+
+// makeNamedSeries allocates the query types and the response codes time
+// series of data.  The series of each name are allocated when the name is
+// first met.
+func (data *StatsResp) makeNamedSeries() {
+	data.QueryTypes = map[string][]uint64{}
+	data.ResponseCodes = map[string][]uint64{}
+}
+
+// addNamedCounts adds the numbers of requests by the question type and by
+// the response code of u to the i-th time unit of data.  size is the number of
+// time units.
+func (data *StatsResp) addNamedCounts(i, size int, u *unitDB) {
+	for _, cp := range u.QueryTypes {
+		addSeriesCount(data.QueryTypes, cp.Name, cp.Count, i, size)
+	}
+
+	for _, cp := range u.RCodes {
+		addSeriesCount(data.ResponseCodes, cp.Name, cp.Count, i, size)
+	}
+}
+
+// addSeriesCount adds n to the i-th time unit of the time series of name in
+// series, allocating it for size time units if needed.
+func addSeriesCount(series map[string][]uint64, name string, n uint64, i, size int) {
+	s := series[name]
+	if s == nil {
+		s = make([]uint64, size)
+		series[name] = s
+	}
+
+	s[i] += n
+}
@@ -3,6 +3,7 @@
 package stats
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/netip"
@@ -68,6 +69,17 @@ type Config struct {
 	// Limit is an upper limit for collecting statistics.
 	Limit time.Duration
 
+	// DailyLimit is an upper limit for keeping the daily statistics, which the
+	// hourly units older than Limit are downsampled to.  It must be a whole
+	// number of days not less than Limit.  Zero means that the old units are
+	// removed without downsampling.
+	DailyLimit time.Duration
+
+	// ResetPeriod is the period after which the statistics are reset, see
+	// [Period].  The counters of the finished period are kept for comparison.
+	// [PeriodNone] means that the statistics are never reset.
+	ResetPeriod Period
+
 	// Enabled tells if the statistics are enabled.
 	Enabled bool
 }
@@ -91,6 +103,15 @@ type Interface interface {
 
 	// ShouldCount returns true if request for the host should be counted.
 	ShouldCount(host string, qType, qClass uint16, ids []string) bool
+
+	// UpdateUpstreamError counts the failed request to the upstream of the
+	// group.  upstream is empty if it's unknown.
+	UpdateUpstreamError(upstream, group string)
+
+	// PurgeClient removes the request counters of the clients with the given
+	// IP addresses or ClientIDs from the current unit and the database.
+	// removed is the number of the clients' requests removed.
+	PurgeClient(ids []string) (removed uint64, err error)
 }
 
 // StatsCtx collects the statistics and flushes it to the database.  Its default
@@ -131,6 +152,13 @@ type StatsCtx struct {
 	// limit is an upper limit for collecting statistics.
 	limit time.Duration
 
+	// dailyLimit is an upper limit for keeping the daily statistics.  Zero
+	// means that the downsampling is disabled.
+	dailyLimit time.Duration
+
+	// resetPeriod is the period after which the statistics are reset.
+	resetPeriod Period
+
 	// enabled tells if the statistics are enabled.
 	enabled bool
 }
@@ -145,6 +173,16 @@ func New(conf Config) (s *StatsCtx, err error) {
 		return nil, fmt.Errorf("unsupported interval: %w", err)
 	}
 
+	err = validateDailyIvl(conf.DailyLimit, conf.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported daily interval: %w", err)
+	}
+
+	err = conf.ResetPeriod.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("reset period: %w", err)
+	}
+
 	if conf.ShouldCountClient == nil {
 		return nil, errors.Error("should count client is unspecified")
 	}
@@ -159,6 +197,8 @@ func New(conf Config) (s *StatsCtx, err error) {
 		ignored:           conf.Ignored,
 		shouldCountClient: conf.ShouldCountClient,
 		limit:             conf.Limit,
+		dailyLimit:        conf.DailyLimit,
+		resetPeriod:       conf.ResetPeriod,
 		enabled:           conf.Enabled,
 	}
 
@@ -181,7 +221,15 @@ func New(conf Config) (s *StatsCtx, err error) {
 		return nil, fmt.Errorf("stats: opening a transaction: %w", err)
 	}
 
-	deleted := deleteOldUnits(tx, id-uint32(s.limit.Hours())-1)
+	firstID := id - uint32(s.limit.Hours()) - 1
+	if s.dailyLimit != 0 {
+		err = downsampleOldUnits(tx, firstID)
+		if err != nil {
+			log.Error("stats: %s", err)
+		}
+	}
+
+	deleted := deleteOldUnits(tx, firstID)
 	udb = loadUnitFromDB(tx, id)
 
 	err = finishTxn(tx, deleted > 0)
@@ -286,6 +334,27 @@ func (s *StatsCtx) Update(e *Entry) {
 	s.curr.add(e)
 }
 
+// UpdateUpstreamError implements the [Interface] interface for *StatsCtx.
+func (s *StatsCtx) UpdateUpstreamError(upstream, group string) {
+	s.confMu.RLock()
+	defer s.confMu.RUnlock()
+
+	if !s.enabled || s.limit == 0 {
+		return
+	}
+
+	s.currMu.Lock()
+	defer s.currMu.Unlock()
+
+	if s.curr == nil {
+		log.Error("stats: current unit is nil")
+
+		return
+	}
+
+	s.curr.addUpstreamError(upstream, group)
+}
+
 // WriteDiskConfig implements the [Interface] interface for *StatsCtx.
 func (s *StatsCtx) WriteDiskConfig(dc *Config) {
 	s.confMu.RLock()
@@ -293,6 +362,8 @@ func (s *StatsCtx) WriteDiskConfig(dc *Config) {
 
 	dc.Ignored = s.ignored
 	dc.Limit = s.limit
+	dc.DailyLimit = s.dailyLimit
+	dc.ResetPeriod = s.resetPeriod
 	dc.Enabled = s.enabled
 }
 
@@ -341,6 +412,10 @@ func deleteOldUnits(tx *bbolt.Tx, firstID uint32) (deleted int) {
 	const errStop errors.Error = "stop iteration"
 
 	walk := func(name []byte, _ *bbolt.Bucket) (err error) {
+		if bytes.Equal(name, dailyBucketName) {
+			return nil
+		}
+
 		nameID, ok := unitNameToID(name)
 		if ok && nameID >= firstID {
 			return errStop
@@ -442,6 +517,12 @@ func (s *StatsCtx) flushDB(id, limit uint32, ptr *unit) (cont bool, sleepFor tim
 		isCommitable = false
 	}
 
+	dsErr := s.downsample(tx, id-limit, id)
+	if dsErr != nil {
+		log.Error("stats: downsampling unit: %s", dsErr)
+		isCommitable = false
+	}
+
 	delErr := tx.DeleteBucket(idToUnitName(id - limit))
 	if delErr != nil {
 		// TODO(e.burkov):  Improve the algorithm of deleting the oldest bucket
@@ -454,6 +535,12 @@ func (s *StatsCtx) flushDB(id, limit uint32, ptr *unit) (cont bool, sleepFor tim
 		}
 	}
 
+	resetErr := s.resetIfPeriodEnded(tx, ptr.id, id)
+	if resetErr != nil {
+		log.Error("stats: resetting period: %s", resetErr)
+		isCommitable = false
+	}
+
 	return true, 0
 }
 
@@ -591,6 +678,69 @@ func (s *StatsCtx) loadUnits(limit uint32) (units []*unitDB, curID uint32) {
 	return units, curID
 }
 
+// currID returns the identifier of the current unit.
+func (s *StatsCtx) currID() (id uint32) {
+	s.currMu.RLock()
+	defer s.currMu.RUnlock()
+
+	if s.curr != nil {
+		return s.curr.id
+	}
+
+	return s.unitIDGen()
+}
+
+// loadHourly returns n hourly units starting with firstID, including the
+// current one if it's within the range.  The missing units are empty.
+func (s *StatsCtx) loadHourly(firstID, n uint32) (units []*unitDB, ok bool) {
+	db := s.db.Load()
+	if db == nil {
+		return nil, false
+	}
+
+	// Serialize the current unit before opening the transaction, since
+	// flushing locks currMu before opening a writable one.
+	var cur *unitDB
+	var curIdx uint32
+	func() {
+		s.currMu.RLock()
+		defer s.currMu.RUnlock()
+
+		if s.curr != nil {
+			curIdx = s.curr.id - firstID
+			if curIdx < n {
+				cur = s.curr.serialize()
+			}
+		}
+	}()
+
+	units = make([]*unitDB, n)
+	err := db.View(func(tx *bbolt.Tx) (_ error) {
+		for i := range units {
+			units[i] = loadUnitFromDB(tx, firstID+uint32(i))
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Error("stats: loading units: %s", err)
+
+		return nil, false
+	}
+
+	if cur != nil {
+		units[curIdx] = cur
+	}
+
+	for i, u := range units {
+		if u == nil {
+			units[i] = &unitDB{NResult: make([]uint64, resultLast)}
+		}
+	}
+
+	return units, true
+}
+
 // ShouldCount returns true if request for the host should be counted.
 func (s *StatsCtx) ShouldCount(host string, _, _ uint16, ids []string) bool {
 	s.confMu.RLock()
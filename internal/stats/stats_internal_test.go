@@ -52,7 +52,7 @@ func TestStats_races(t *testing.T) {
 
 		<-waitCh
 
-		_, _ = s.getData(24)
+		_, _ = s.getData(24, false)
 	}
 
 	const (
@@ -164,7 +164,193 @@ func TestStatsCtx_DataFromUnits_month(t *testing.T) {
 
 	var h uint32
 	for h = 1; h <= hoursInMonth; h++ {
-		data := s.dataFromUnits(units[:h], curID)
+		data := s.dataFromUnits(units[:h], curID, false)
 		require.NotNil(t, data)
 	}
 }
+
+func TestStatsCtx_PurgeClient(t *testing.T) {
+	const (
+		cliIP    = "192.0.2.1"
+		cliID    = "cli"
+		otherIP  = "192.0.2.2"
+		reqCount = 2
+	)
+
+	var r uint32
+	s, err := New(Config{
+		ShouldCountClient: func([]string) bool { return true },
+		UnitID:            func() (id uint32) { return atomic.LoadUint32(&r) },
+		Filename:          filepath.Join(t.TempDir(), "stats.db"),
+		Limit:             timeutil.Day,
+		Enabled:           true,
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	update := func() {
+		for _, cli := range []string{cliIP, cliID, otherIP} {
+			for range reqCount {
+				s.Update(&Entry{
+					Domain: "example.org",
+					Client: cli,
+					Result: RNotFiltered,
+				})
+			}
+		}
+	}
+
+	// Fill a unit, flush it to the database, and fill the current one.
+	update()
+	atomic.StoreUint32(&r, 1)
+	_, _ = s.flush()
+	update()
+
+	removed, err := s.PurgeClient([]string{cliIP, cliID})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(2*2*reqCount), removed)
+
+	data, ok := s.getData(24, false)
+	require.True(t, ok)
+
+	assert.Equal(t, []map[string]uint64{{otherIP: 2 * reqCount}}, data.TopClients)
+
+	removed, err = s.PurgeClient([]string{cliIP})
+	require.NoError(t, err)
+
+	assert.Zero(t, removed)
+}
+
+func TestStatsCtx_clientFromUnits(t *testing.T) {
+	const (
+		cliIP   = "192.0.2.1"
+		otherIP = "192.0.2.2"
+	)
+
+	var r uint32
+	s, err := New(Config{
+		ShouldCountClient: func([]string) bool { return true },
+		UnitID:            func() (id uint32) { return atomic.LoadUint32(&r) },
+		Filename:          filepath.Join(t.TempDir(), "stats.db"),
+		Limit:             timeutil.Day,
+		Enabled:           true,
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	s.Update(&Entry{Domain: "a.example", Client: cliIP, Result: RNotFiltered})
+	s.Update(&Entry{Domain: "b.example", Client: cliIP, Result: RFiltered})
+	s.Update(&Entry{Domain: "c.example", Client: otherIP, Result: RNotFiltered})
+
+	atomic.StoreUint32(&r, 1)
+	_, _ = s.flush()
+
+	s.Update(&Entry{Domain: "a.example", Client: cliIP, Result: RNotFiltered})
+
+	units, curID, ok := s.loadUnitsForWeb()
+	require.True(t, ok)
+
+	resp := s.clientFromUnits(cliIP, units, curID)
+
+	assert.Equal(t, uint64(3), resp.NumDNSQueries)
+	assert.Equal(t, uint64(1), resp.NumBlocked)
+	assert.Equal(t, []topAddrs{{"a.example": 2}}, resp.TopQueried)
+	assert.Equal(t, []topAddrs{{"b.example": 1}}, resp.TopBlocked)
+
+	require.Len(t, resp.DNSQueries, 24)
+
+	assert.Equal(t, []uint64{2, 1}, resp.DNSQueries[22:])
+	assert.Equal(t, []uint64{1, 0}, resp.Blocked[22:])
+
+	resp = s.clientFromUnits("unknown", units, curID)
+
+	assert.Zero(t, resp.NumDNSQueries)
+	assert.Empty(t, resp.TopQueried)
+}
+
+func TestValidateDailyIvl(t *testing.T) {
+	testCases := []struct {
+		name       string
+		wantErrMsg string
+		ivl        time.Duration
+	}{{
+		name:       "disabled",
+		wantErrMsg: "",
+		ivl:        0,
+	}, {
+		name:       "year",
+		wantErrMsg: "",
+		ivl:        365 * timeutil.Day,
+	}, {
+		name:       "not_days",
+		wantErrMsg: "not a whole number of days",
+		ivl:        36 * time.Hour,
+	}, {
+		name:       "less_than_limit",
+		wantErrMsg: "less than the hourly interval 168h0m0s",
+		ivl:        timeutil.Day,
+	}, {
+		name:       "too_long",
+		wantErrMsg: "more than ten years",
+		ivl:        maxDailyLimit + timeutil.Day,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDailyIvl(tc.ivl, 7*timeutil.Day)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestStatsCtx_downsample(t *testing.T) {
+	const cliIP = "192.0.2.1"
+
+	// Start at the second day to have the previous one within the daily
+	// retention interval.
+	r := uint32(hoursInDay)
+	s, err := New(Config{
+		ShouldCountClient: func([]string) bool { return true },
+		UnitID:            func() (id uint32) { return atomic.LoadUint32(&r) },
+		Filename:          filepath.Join(t.TempDir(), "stats.db"),
+		Limit:             2 * time.Hour,
+		DailyLimit:        7 * timeutil.Day,
+		Enabled:           true,
+	})
+	require.NoError(t, err)
+	testutil.CleanupAndRequireSuccess(t, s.Close)
+
+	// Fill four hours, so that the first three of them are downsampled.
+	for range 4 {
+		s.Update(&Entry{Domain: "example.org", Client: cliIP, Result: RNotFiltered})
+		s.Update(&Entry{Domain: "blocked.example", Client: cliIP, Result: RFiltered})
+
+		atomic.AddUint32(&r, 1)
+		_, _ = s.flush()
+	}
+
+	hourly, _ := s.loadUnits(2)
+	require.Len(t, hourly, 2)
+
+	// The current unit is empty.
+	assert.Equal(t, uint64(2), hourly[0].NTotal)
+	assert.Zero(t, hourly[1].NTotal)
+
+	units, ok := s.loadHistory(2)
+	require.True(t, ok)
+	require.Len(t, units, 2)
+
+	assert.Zero(t, units[0].NTotal)
+
+	day := units[1]
+	assert.Equal(t, uint64(8), day.NTotal)
+	assert.Equal(t, uint64(4), day.NResult[RFiltered])
+	assert.Equal(t, []countPair{{Name: "example.org", Count: 4}}, day.Domains)
+	assert.Equal(t, []countPair{{Name: cliIP, Count: 8}}, day.Clients)
+
+	removed, err := s.PurgeClient([]string{cliIP})
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(8), removed)
+}
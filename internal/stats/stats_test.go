@@ -82,6 +82,9 @@ func TestStats(t *testing.T) {
 			ProcessingTime: time.Microsecond * 123456,
 			Upstream:       respUpstream,
 			UpstreamTime:   time.Microsecond * 222222,
+			CacheResult:    stats.CacheResultMiss,
+			QType:          dns.TypeA,
+			RCode:          "NOERROR",
 		}, {
 			Domain:         reqDomain,
 			Client:         cliIPStr,
@@ -89,6 +92,9 @@ func TestStats(t *testing.T) {
 			ProcessingTime: time.Microsecond * 123456,
 			Upstream:       respUpstream,
 			UpstreamTime:   time.Microsecond * 222222,
+			CacheResult:    stats.CacheResultHit,
+			QType:          dns.TypeA,
+			RCode:          "NOERROR",
 		}}
 
 		wantData := &stats.StatsResp{
@@ -98,6 +104,10 @@ func TestStats(t *testing.T) {
 			TopBlocked:            []map[string]uint64{0: {reqDomain: 1}},
 			TopUpstreamsResponses: []map[string]uint64{0: {respUpstream: 2}},
 			TopUpstreamsAvgTime:   []map[string]float64{0: {respUpstream: 0.222222}},
+			TopThreatCategories:   []map[string]uint64{},
+			TopQuotaClients:       []map[string]uint64{},
+			TopQueryTypes:         []map[string]uint64{0: {"A": 2}},
+			TopResponseCodes:      []map[string]uint64{0: {"NOERROR": 2}},
 			DNSQueries: []uint64{
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
@@ -114,11 +124,37 @@ func TestStats(t *testing.T) {
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 			},
+			CacheHits: []uint64{
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+			},
+			CacheMisses: []uint64{
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+			},
+			CacheStaleHits: []uint64{
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			QueryTypes: map[string][]uint64{
+				"A": {
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+				},
+			},
+			ResponseCodes: map[string][]uint64{
+				"NOERROR": {
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+					0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+				},
+			},
 			NumDNSQueries:           2,
 			NumBlockedFiltering:     1,
 			NumReplacedSafebrowsing: 0,
 			NumReplacedSafesearch:   0,
 			NumReplacedParental:     0,
+			NumCacheHits:            1,
+			NumCacheMisses:          1,
 			AvgProcessingTime:       0.123456,
 		}
 
@@ -152,10 +188,19 @@ func TestStats(t *testing.T) {
 			TopBlocked:            []map[string]uint64{},
 			TopUpstreamsResponses: []map[string]uint64{},
 			TopUpstreamsAvgTime:   []map[string]float64{},
+			TopThreatCategories:   []map[string]uint64{},
+			TopQuotaClients:       []map[string]uint64{},
+			TopQueryTypes:         []map[string]uint64{},
+			TopResponseCodes:      []map[string]uint64{},
 			DNSQueries:            _24zeroes[:],
 			BlockedFiltering:      _24zeroes[:],
 			ReplacedSafebrowsing:  _24zeroes[:],
 			ReplacedParental:      _24zeroes[:],
+			CacheHits:             _24zeroes[:],
+			CacheMisses:           _24zeroes[:],
+			CacheStaleHits:        _24zeroes[:],
+			QueryTypes:            map[string][]uint64{},
+			ResponseCodes:         map[string][]uint64{},
 		}
 
 		req = httptest.NewRequest(http.MethodGet, "/control/stats", nil)
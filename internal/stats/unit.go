@@ -48,8 +48,9 @@ const (
 	RSafeBrowsing
 	RSafeSearch
 	RParental
+	RThreatFeed
 
-	resultLast = RParental + 1
+	resultLast = RThreatFeed + 1
 )
 
 // Entry is a statistics data entry.
@@ -65,15 +66,44 @@ type Entry struct {
 	// Upstream is the upstream DNS server.
 	Upstream string
 
+	// UpstreamGroup is the group of the upstream DNS server.  It's empty if the
+	// request hasn't been sent to an upstream.
+	UpstreamGroup string
+
 	// Result is the result of processing the request.
 	Result Result
 
+	// ThreatCategory is the category of the threat feed that blocked the
+	// request.  It is empty unless Result is RThreatFeed.
+	ThreatCategory string
+
+	// FilterList is the ID of the filter list which rule has blocked the
+	// request.  It is empty unless Result is RFiltered and the list is known.
+	FilterList string
+
+	// QuotaExceeded tells if the request has exceeded a query quota of the
+	// client.
+	QuotaExceeded bool
+
 	// ProcessingTime is the duration of the request processing from the start
 	// of the request including timeouts.
 	ProcessingTime time.Duration
 
 	// UpstreamTime is the duration of the successful request to the upstream.
 	UpstreamTime time.Duration
+
+	// CacheResult is the result of looking up the response in the DNS cache.
+	CacheResult CacheResult
+
+	// RCode is the name of the response code, for example "NXDOMAIN".  It's
+	// empty if there is no response.
+	RCode string
+
+	// QType is the type of the question of the request.  Zero means unknown.
+	QType uint16
+
+	// UpstreamFailed tells if the upstream has responded with SERVFAIL.
+	UpstreamFailed bool
 }
 
 // validate returns an error if entry is not valid.
@@ -83,6 +113,8 @@ func (e *Entry) validate() (err error) {
 		return errors.Error("result code is not set")
 	case e.Result >= resultLast:
 		return fmt.Errorf("unknown result code %d", e.Result)
+	case e.CacheResult >= cacheResultLast:
+		return fmt.Errorf("unknown cache result %d", e.CacheResult)
 	case e.Domain == "":
 		return errors.Error("domain is empty")
 	case e.Client == "":
@@ -104,6 +136,9 @@ type unit struct {
 	// clients stores the number of requests from each client.
 	clients map[string]uint64
 
+	// clientDetails stores the detailed statistics of each client.
+	clientDetails map[string]*clientUnit
+
 	// upstreamsResponses stores the number of responses from each upstream.
 	upstreamsResponses map[string]uint64
 
@@ -111,9 +146,37 @@ type unit struct {
 	// microseconds to each upstream.
 	upstreamsTimeSum map[string]uint64
 
+	// threatCategories stores the number of requests blocked by each threat
+	// category.
+	threatCategories map[string]uint64
+
+	// filterLists stores the number of requests blocked by each filter list.
+	filterLists map[string]uint64
+
+	// quotaClients stores the number of requests exceeding the query quotas
+	// from each client.
+	quotaClients map[string]uint64
+
+	// queryTypes stores the number of requests by the question type.
+	queryTypes map[string]uint64
+
+	// rcodes stores the number of responses by the response code.
+	rcodes map[string]uint64
+
+	// upstreamsPerf stores the performance data of each upstream.
+	upstreamsPerf map[string]*upstreamUnit
+
+	// upstreamGroupsPerf stores the performance data of each group of
+	// upstreams.
+	upstreamGroupsPerf map[string]*upstreamUnit
+
 	// nResult stores the number of requests grouped by it's result.
 	nResult []uint64
 
+	// nCacheResult stores the number of requests grouped by the result of
+	// looking up the cache.
+	nCacheResult []uint64
+
 	// id is the unique unit's identifier.  It's set to an absolute hour number
 	// since the beginning of UNIX time by the default ID generating function.
 	//
@@ -135,9 +198,18 @@ func newUnit(id uint32) (u *unit) {
 		domains:            map[string]uint64{},
 		blockedDomains:     map[string]uint64{},
 		clients:            map[string]uint64{},
+		clientDetails:      map[string]*clientUnit{},
 		upstreamsResponses: map[string]uint64{},
 		upstreamsTimeSum:   map[string]uint64{},
+		threatCategories:   map[string]uint64{},
+		filterLists:        map[string]uint64{},
+		quotaClients:       map[string]uint64{},
+		queryTypes:         map[string]uint64{},
+		rcodes:             map[string]uint64{},
+		upstreamsPerf:      map[string]*upstreamUnit{},
+		upstreamGroupsPerf: map[string]*upstreamUnit{},
 		nResult:            make([]uint64, resultLast),
+		nCacheResult:       make([]uint64, cacheResultLast),
 		id:                 id,
 	}
 }
@@ -157,6 +229,10 @@ type unitDB struct {
 	// NResult is the number of requests by the result's kind.
 	NResult []uint64
 
+	// NCacheResult is the number of requests by the result of looking up the
+	// cache.
+	NCacheResult []uint64
+
 	// Domains is the number of requests for each domain name.
 	Domains []countPair
 
@@ -173,6 +249,32 @@ type unitDB struct {
 	// responses from each upstream.
 	UpstreamsTimeSum []countPair
 
+	// ThreatCategories is the number of requests blocked by each threat
+	// category.
+	ThreatCategories []countPair
+
+	// FilterLists is the number of requests blocked by each filter list.
+	FilterLists []countPair
+
+	// QuotaClients is the number of requests exceeding the query quotas from
+	// each client.
+	QuotaClients []countPair
+
+	// QueryTypes is the number of requests by the question type.
+	QueryTypes []countPair
+
+	// RCodes is the number of responses by the response code.
+	RCodes []countPair
+
+	// ClientDetails is the detailed statistics of each client.
+	ClientDetails []clientUnitDB
+
+	// UpstreamsPerf is the performance data of each upstream.
+	UpstreamsPerf []upstreamUnitDB
+
+	// UpstreamGroupsPerf is the performance data of each group of upstreams.
+	UpstreamGroupsPerf []upstreamUnitDB
+
 	// NTotal is the total number of requests.
 	NTotal uint64
 
@@ -183,8 +285,6 @@ type unitDB struct {
 
 // newUnitID is the default UnitIDGenFunc that generates the unique id hourly.
 func newUnitID() (id uint32) {
-	const secsInHour = int64(time.Hour / time.Second)
-
 	return uint32(time.Now().Unix() / secsInHour)
 }
 
@@ -268,11 +368,20 @@ func (u *unit) serialize() (udb *unitDB) {
 	return &unitDB{
 		NTotal:             u.nTotal,
 		NResult:            append([]uint64{}, u.nResult...),
+		NCacheResult:       append([]uint64{}, u.nCacheResult...),
 		Domains:            convertMapToSlice(u.domains, maxDomains),
 		BlockedDomains:     convertMapToSlice(u.blockedDomains, maxDomains),
 		Clients:            convertMapToSlice(u.clients, maxClients),
 		UpstreamsResponses: convertMapToSlice(u.upstreamsResponses, maxUpstreams),
 		UpstreamsTimeSum:   convertMapToSlice(u.upstreamsTimeSum, maxUpstreams),
+		ThreatCategories:   convertMapToSlice(u.threatCategories, maxDomains),
+		FilterLists:        convertMapToSlice(u.filterLists, maxFilterLists),
+		QuotaClients:       convertMapToSlice(u.quotaClients, maxClients),
+		QueryTypes:         convertMapToSlice(u.queryTypes, maxDomains),
+		RCodes:             convertMapToSlice(u.rcodes, maxDomains),
+		ClientDetails:      serializeClients(u.clientDetails),
+		UpstreamsPerf:      serializeUpstreams(u.upstreamsPerf),
+		UpstreamGroupsPerf: serializeUpstreams(u.upstreamGroupsPerf),
 		TimeAvg:            timeAvg,
 	}
 }
@@ -309,24 +418,64 @@ func (u *unit) deserialize(udb *unitDB) {
 	u.nTotal = udb.NTotal
 	u.nResult = make([]uint64, resultLast)
 	copy(u.nResult, udb.NResult)
+	u.nCacheResult = make([]uint64, cacheResultLast)
+	copy(u.nCacheResult, udb.NCacheResult)
 	u.domains = convertSliceToMap(udb.Domains)
 	u.blockedDomains = convertSliceToMap(udb.BlockedDomains)
 	u.clients = convertSliceToMap(udb.Clients)
 	u.upstreamsResponses = convertSliceToMap(udb.UpstreamsResponses)
 	u.upstreamsTimeSum = convertSliceToMap(udb.UpstreamsTimeSum)
+	u.threatCategories = convertSliceToMap(udb.ThreatCategories)
+	u.filterLists = convertSliceToMap(udb.FilterLists)
+	u.quotaClients = convertSliceToMap(udb.QuotaClients)
+	u.queryTypes = convertSliceToMap(udb.QueryTypes)
+	u.rcodes = convertSliceToMap(udb.RCodes)
+	u.clientDetails = deserializeClients(udb.ClientDetails)
+	u.upstreamsPerf = deserializeUpstreams(udb.UpstreamsPerf)
+	u.upstreamGroupsPerf = deserializeUpstreams(udb.UpstreamGroupsPerf)
 	u.timeSum = uint64(udb.TimeAvg) * udb.NTotal
 }
 
 // add adds new data to u.  It's safe for concurrent use.
 func (u *unit) add(e *Entry) {
 	u.nResult[e.Result]++
+	u.nCacheResult[e.CacheResult]++
 	if e.Result == RNotFiltered {
 		u.domains[e.Domain]++
 	} else {
 		u.blockedDomains[e.Domain]++
 	}
 
+	if e.ThreatCategory != "" {
+		u.threatCategories[e.ThreatCategory]++
+	}
+
+	if e.Result == RFiltered && e.FilterList != "" {
+		u.filterLists[e.FilterList]++
+	}
+
+	if e.QuotaExceeded {
+		u.quotaClients[e.Client]++
+	}
+
+	if e.QType != 0 {
+		u.queryTypes[queryTypeName(e.QType)]++
+	}
+
+	if e.RCode != "" {
+		u.rcodes[e.RCode]++
+	}
+
 	u.clients[e.Client]++
+
+	cu := u.clientDetails[e.Client]
+	if cu == nil {
+		cu = newClientUnit()
+		u.clientDetails[e.Client] = cu
+	}
+
+	cu.add(e)
+
 	pt := uint64(e.ProcessingTime.Microseconds())
 	u.timeSum += pt
 	u.nTotal++
@@ -335,6 +484,32 @@ func (u *unit) add(e *Entry) {
 		u.upstreamsResponses[e.Upstream]++
 		ut := uint64(e.UpstreamTime.Microseconds())
 		u.upstreamsTimeSum[e.Upstream] += ut
+
+		upstreamUnitFor(u.upstreamsPerf, e.Upstream).addResponse(
+			e.UpstreamTime,
+			e.RCode,
+			e.UpstreamFailed,
+		)
+	}
+
+	if e.UpstreamGroup != "" {
+		upstreamUnitFor(u.upstreamGroupsPerf, e.UpstreamGroup).addResponse(
+			e.UpstreamTime,
+			e.RCode,
+			e.UpstreamFailed,
+		)
+	}
+}
+
+// addUpstreamError adds the failed request to the upstream and the group to u.
+// upstream may be empty if it's unknown.
+func (u *unit) addUpstreamError(upstream, group string) {
+	if upstream != "" {
+		upstreamUnitFor(u.upstreamsPerf, upstream).nErrors++
+	}
+
+	if group != "" {
+		upstreamUnitFor(u.upstreamGroupsPerf, group).nErrors++
 	}
 }
 
@@ -389,6 +564,26 @@ func topsCollector(units []*unitDB, max int, ignored *aghnet.IgnoreEngine, pg pa
 	return convertTopSlice(a2)
 }
 
+// registrablePairs returns a pairsGetter which replaces the domain names
+// returned by pg with their registrable domains.  The ignored domains are
+// filtered out before that.
+func registrablePairs(pg pairsGetter, ignored *aghnet.IgnoreEngine) (res pairsGetter) {
+	return func(u *unitDB) (pairs []countPair) {
+		for _, cp := range pg(u) {
+			if ignored.Has(cp.Name) {
+				continue
+			}
+
+			pairs = append(pairs, countPair{
+				Name:  aghnet.RegistrableDomain(cp.Name),
+				Count: cp.Count,
+			})
+		}
+
+		return pairs
+	}
+}
+
 // getData returns the statistics data using the following algorithm:
 //
 //  1. Prepare a slice of N units, where N is the value of "limit" configuration
@@ -408,7 +603,10 @@ func topsCollector(units []*unitDB, max int, ignored *aghnet.IgnoreEngine, pg pa
 //
 //     The total counters (DNS queries, blocked, etc.) are just the sum of data
 //     for all units.
-func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
+//
+// If byRegistrable is true, the top domains are grouped by their registrable
+// domains, see [aghnet.RegistrableDomain].
+func (s *StatsCtx) getData(limit uint32, byRegistrable bool) (resp *StatsResp, ok bool) {
 	if limit == 0 {
 		return &StatsResp{
 			TimeUnits: "days",
@@ -418,11 +616,22 @@ func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
 			TopQueried:            []topAddrs{},
 			TopUpstreamsResponses: []topAddrs{},
 			TopUpstreamsAvgTime:   []topAddrsFloat{},
+			TopThreatCategories:   []topAddrs{},
+			TopQuotaClients:       []topAddrs{},
+			TopQueryTypes:         []topAddrs{},
+			TopResponseCodes:      []topAddrs{},
 
 			BlockedFiltering:     []uint64{},
 			DNSQueries:           []uint64{},
 			ReplacedParental:     []uint64{},
 			ReplacedSafebrowsing: []uint64{},
+
+			CacheHits:      []uint64{},
+			CacheMisses:    []uint64{},
+			CacheStaleHits: []uint64{},
+
+			QueryTypes:    map[string][]uint64{},
+			ResponseCodes: map[string][]uint64{},
 		}, true
 	}
 
@@ -431,26 +640,44 @@ func (s *StatsCtx) getData(limit uint32) (resp *StatsResp, ok bool) {
 		return &StatsResp{}, false
 	}
 
-	return s.dataFromUnits(units, curID), true
+	return s.dataFromUnits(units, curID, byRegistrable), true
 }
 
 // dataFromUnits collects and returns the statistics data.
-func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp) {
+func (s *StatsCtx) dataFromUnits(
+	units []*unitDB,
+	curID uint32,
+	byRegistrable bool,
+) (resp *StatsResp) {
 	topUpstreamsResponses, topUpstreamsAvgTime := topUpstreamsPairs(units)
 
+	var queriedPG pairsGetter = func(u *unitDB) (pairs []countPair) { return u.Domains }
+	var blockedPG pairsGetter = func(u *unitDB) (pairs []countPair) { return u.BlockedDomains }
+	ignored := s.ignored
+	if byRegistrable {
+		queriedPG = registrablePairs(queriedPG, ignored)
+		blockedPG = registrablePairs(blockedPG, ignored)
+		ignored = nil
+	}
+
 	resp = &StatsResp{
-		TopQueried:            topsCollector(units, maxDomains, s.ignored, func(u *unitDB) (pairs []countPair) { return u.Domains }),
-		TopBlocked:            topsCollector(units, maxDomains, s.ignored, func(u *unitDB) (pairs []countPair) { return u.BlockedDomains }),
+		TopQueried:            topsCollector(units, maxDomains, ignored, queriedPG),
+		TopBlocked:            topsCollector(units, maxDomains, ignored, blockedPG),
 		TopUpstreamsResponses: topUpstreamsResponses,
 		TopUpstreamsAvgTime:   topUpstreamsAvgTime,
 		TopClients:            topsCollector(units, maxClients, nil, topClientPairs(s)),
+		TopThreatCategories:   topsCollector(units, maxDomains, nil, func(u *unitDB) (pairs []countPair) { return u.ThreatCategories }),
+		TopQuotaClients:       topsCollector(units, maxClients, nil, func(u *unitDB) (pairs []countPair) { return u.QuotaClients }),
+		TopQueryTypes:         topsCollector(units, maxDomains, nil, func(u *unitDB) (pairs []countPair) { return u.QueryTypes }),
+		TopResponseCodes:      topsCollector(units, maxDomains, nil, func(u *unitDB) (pairs []countPair) { return u.RCodes }),
 	}
 
 	s.fillCollectedStats(resp, units, curID)
 
 	// Total counters:
 	sum := unitDB{
-		NResult: make([]uint64, resultLast),
+		NResult:      make([]uint64, resultLast),
+		NCacheResult: make([]uint64, cacheResultLast),
 	}
 	var timeN uint32
 	for _, u := range units {
@@ -463,13 +690,21 @@ func (s *StatsCtx) dataFromUnits(units []*unitDB, curID uint32) (resp *StatsResp
 		sum.NResult[RSafeBrowsing] += u.NResult[RSafeBrowsing]
 		sum.NResult[RSafeSearch] += u.NResult[RSafeSearch]
 		sum.NResult[RParental] += u.NResult[RParental]
+		sum.NResult[RThreatFeed] += u.NResult[RThreatFeed]
+		for r := range sum.NCacheResult {
+			sum.NCacheResult[r] += u.cacheCount(CacheResult(r))
+		}
 	}
 
 	resp.NumDNSQueries = sum.NTotal
+	resp.NumCacheHits = sum.cacheCount(CacheResultHit)
+	resp.NumCacheMisses = sum.cacheCount(CacheResultMiss)
+	resp.NumCacheStaleHits = sum.cacheCount(CacheResultStale)
 	resp.NumBlockedFiltering = sum.NResult[RFiltered]
 	resp.NumReplacedSafebrowsing = sum.NResult[RSafeBrowsing]
 	resp.NumReplacedSafesearch = sum.NResult[RSafeSearch]
 	resp.NumReplacedParental = sum.NResult[RParental]
+	resp.NumBlockedThreatFeeds = sum.NResult[RThreatFeed]
 
 	if timeN != 0 {
 		resp.AvgProcessingTime = microsecondsToSeconds(float64(sum.TimeAvg / timeN))
@@ -489,22 +724,40 @@ func (s *StatsCtx) fillCollectedStats(data *StatsResp, units []*unitDB, curID ui
 		data.TimeUnits = timeUnitsDays
 	}
 
-	data.DNSQueries = make([]uint64, size)
-	data.BlockedFiltering = make([]uint64, size)
-	data.ReplacedSafebrowsing = make([]uint64, size)
-	data.ReplacedParental = make([]uint64, size)
-
 	if data.TimeUnits == timeUnitsDays {
+		data.DNSQueries = make([]uint64, size)
+		data.BlockedFiltering = make([]uint64, size)
+		data.ReplacedSafebrowsing = make([]uint64, size)
+		data.ReplacedParental = make([]uint64, size)
+		data.makeCacheSeries(size)
+		data.makeNamedSeries()
+
 		s.fillCollectedStatsDaily(data, units, curID, size)
 
 		return
 	}
 
+	fillCollectedStatsPerUnit(data, units)
+}
+
+// fillCollectedStatsPerUnit fills data with collected statistics using a single
+// unit for each time unit.
+func fillCollectedStatsPerUnit(data *StatsResp, units []*unitDB) {
+	size := len(units)
+	data.DNSQueries = make([]uint64, size)
+	data.BlockedFiltering = make([]uint64, size)
+	data.ReplacedSafebrowsing = make([]uint64, size)
+	data.ReplacedParental = make([]uint64, size)
+	data.makeCacheSeries(size)
+	data.makeNamedSeries()
+
 	for i, u := range units {
 		data.DNSQueries[i] += u.NTotal
 		data.BlockedFiltering[i] += u.NResult[RFiltered]
 		data.ReplacedSafebrowsing[i] += u.NResult[RSafeBrowsing]
 		data.ReplacedParental[i] += u.NResult[RParental]
+		data.addCacheCounts(i, u)
+		data.addNamedCounts(i, size, u)
 	}
 }
 
@@ -532,6 +785,8 @@ func (s *StatsCtx) fillCollectedStatsDaily(
 		data.BlockedFiltering[day] += u.NResult[RFiltered]
 		data.ReplacedSafebrowsing[day] += u.NResult[RSafeBrowsing]
 		data.ReplacedParental[day] += u.NResult[RParental]
+		data.addCacheCounts(day, u)
+		data.addNamedCounts(day, days, u)
 	}
 }
 
@@ -0,0 +1,367 @@
+package stats
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// latencyBounds are the upper bounds of the buckets of the upstream latency
+// histogram in milliseconds.  The last bucket counts the rest.
+var latencyBounds = []uint64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1_000, 2_000, 5_000}
+
+// upstreamUnit collects the performance data of a single upstream or a group
+// of upstreams for a specific period of time.
+type upstreamUnit struct {
+	// latency is the histogram of the durations of the responses, see
+	// [latencyBounds].
+	latency []uint64
+
+	// rcodes is the number of responses by the name of the response code.
+	rcodes map[string]uint64
+
+	// nResponses is the number of responses.
+	nResponses uint64
+
+	// nErrors is the number of failed requests, including the ones with the
+	// SERVFAIL responses.
+	nErrors uint64
+
+	// timeSum is the sum of the durations of the responses in microseconds.
+	timeSum uint64
+}
+
+// newUpstreamUnit allocates the new *upstreamUnit.
+func newUpstreamUnit() (uu *upstreamUnit) {
+	return &upstreamUnit{
+		latency: make([]uint64, len(latencyBounds)+1),
+		rcodes:  map[string]uint64{},
+	}
+}
+
+// upstreamUnitFor returns the unit for name from units, creating it if needed.
+func upstreamUnitFor(units map[string]*upstreamUnit, name string) (uu *upstreamUnit) {
+	uu = units[name]
+	if uu == nil {
+		uu = newUpstreamUnit()
+		units[name] = uu
+	}
+
+	return uu
+}
+
+// addResponse adds the response with the response code named rcode received in
+// d to uu.  rcode may be empty if it's unknown.  failed is true if it's a
+// SERVFAIL response.
+func (uu *upstreamUnit) addResponse(d time.Duration, rcode string, failed bool) {
+	uu.nResponses++
+	if failed {
+		uu.nErrors++
+	}
+
+	if rcode != "" {
+		uu.rcodes[rcode]++
+	}
+
+	uu.timeSum += uint64(d.Microseconds())
+
+	ms := uint64(d.Milliseconds())
+	i, _ := slices.BinarySearch(latencyBounds, ms)
+	uu.latency[i]++
+}
+
+// merge adds the data of other to uu.
+func (uu *upstreamUnit) merge(other *upstreamUnit) {
+	uu.nResponses += other.nResponses
+	uu.nErrors += other.nErrors
+	uu.timeSum += other.timeSum
+	for rc, n := range other.rcodes {
+		uu.rcodes[rc] += n
+	}
+
+	for i, n := range other.latency {
+		if i < len(uu.latency) {
+			uu.latency[i] += n
+		}
+	}
+}
+
+// avgTime returns the average duration of the responses in seconds.
+func (uu *upstreamUnit) avgTime() (secs float64) {
+	if uu.nResponses == 0 {
+		return 0
+	}
+
+	return microsecondsToSeconds(float64(uu.timeSum / uu.nResponses))
+}
+
+// rcodeServFail is the name of the SERVFAIL response code.
+const rcodeServFail = "SERVFAIL"
+
+// failureRatio returns the ratio of the failed requests to all requests, within
+// [0, 1].  The failed requests are the failed exchanges and the SERVFAIL
+// responses.
+func (uu *upstreamUnit) failureRatio() (r float64) {
+	// The SERVFAIL responses are counted both as responses and as errors.
+	servFails := min(uu.rcodes[rcodeServFail], uu.nErrors)
+	total := uu.nResponses + uu.nErrors - servFails
+	if total == 0 {
+		return 0
+	}
+
+	return float64(uu.nErrors) / float64(total)
+}
+
+// percentile returns the estimated p-th percentile of the durations of the
+// responses in seconds, where p is within (0, 1].  The estimation is the upper
+// bound of the histogram bucket containing it.
+func (uu *upstreamUnit) percentile(p float64) (secs float64) {
+	var total uint64
+	for _, n := range uu.latency {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	rank := max(uint64(math.Ceil(p*float64(total))), 1)
+
+	var cum uint64
+	for i, n := range uu.latency {
+		cum += n
+		if cum >= rank {
+			bound := latencyBounds[min(i, len(latencyBounds)-1)]
+
+			return float64(bound) / 1000
+		}
+	}
+
+	return float64(latencyBounds[len(latencyBounds)-1]) / 1000
+}
+
+// upstreamUnitDB is the structure for serializing the performance data of a
+// single upstream or a group of upstreams into the database.
+//
+// NOTE: Do not change the names or types of fields, as this structure is used
+// for GOB encoding.
+type upstreamUnitDB struct {
+	// Name is the address of the upstream or the name of the group.
+	Name string
+
+	// Latency is the histogram of the durations of the responses.
+	Latency []uint64
+
+	// RCodes is the number of responses by the name of the response code.
+	RCodes []countPair
+
+	// NResponses is the number of responses.
+	NResponses uint64
+
+	// NErrors is the number of failed requests.
+	NErrors uint64
+
+	// TimeSum is the sum of the durations of the responses in microseconds.
+	TimeSum uint64
+}
+
+// serializeUpstreams converts the upstreams' data to the slice of at most
+// [maxUpstreams] upstreams with the most number of requests.
+func serializeUpstreams(units map[string]*upstreamUnit) (uudbs []upstreamUnitDB) {
+	uudbs = make([]upstreamUnitDB, 0, len(units))
+	for name, uu := range units {
+		uudbs = append(uudbs, upstreamUnitDB{
+			Name:       name,
+			Latency:    slices.Clone(uu.latency),
+			RCodes:     convertMapToSlice(uu.rcodes, len(uu.rcodes)),
+			NResponses: uu.nResponses,
+			NErrors:    uu.nErrors,
+			TimeSum:    uu.timeSum,
+		})
+	}
+
+	slices.SortFunc(uudbs, func(a, b upstreamUnitDB) (res int) {
+		return cmp.Or(
+			cmp.Compare(b.NResponses+b.NErrors, a.NResponses+a.NErrors),
+			strings.Compare(a.Name, b.Name),
+		)
+	})
+
+	return uudbs[:min(len(uudbs), maxUpstreams)]
+}
+
+// deserializeUpstreams converts the serialized upstreams' data to the map.
+func deserializeUpstreams(uudbs []upstreamUnitDB) (units map[string]*upstreamUnit) {
+	units = make(map[string]*upstreamUnit, len(uudbs))
+	for _, uudb := range uudbs {
+		uu := newUpstreamUnit()
+		uu.merge(&upstreamUnit{
+			latency:    uudb.Latency,
+			rcodes:     convertSliceToMap(uudb.RCodes),
+			nResponses: uudb.NResponses,
+			nErrors:    uudb.NErrors,
+			timeSum:    uudb.TimeSum,
+		})
+
+		units[uudb.Name] = uu
+	}
+
+	return units
+}
+
+// mergeUpstreams returns the merged performance data of a and b.
+func mergeUpstreams(a, b []upstreamUnitDB) (merged []upstreamUnitDB) {
+	units := deserializeUpstreams(a)
+	for name, uu := range deserializeUpstreams(b) {
+		upstreamUnitFor(units, name).merge(uu)
+	}
+
+	return serializeUpstreams(units)
+}
+
+// upstreamSeriesJSON is the performance time series of a single upstream or a
+// group of upstreams.
+type upstreamSeriesJSON struct {
+	// Name is the address of the upstream or the name of the group.
+	Name string `json:"name"`
+
+	NumResponses []uint64 `json:"num_responses"`
+	NumErrors    []uint64 `json:"num_errors"`
+
+	// FailureRatio is the ratio of the failed requests to all requests.
+	FailureRatio []float64 `json:"failure_ratio"`
+
+	// RCodes are the time series of the number of responses by the name of
+	// the response code.
+	RCodes map[string][]uint64 `json:"rcodes"`
+
+	// AvgTime, P50Time, P95Time, and P99Time are the average and the
+	// percentiles of the durations of the responses in seconds.
+	AvgTime []float64 `json:"avg_time"`
+	P50Time []float64 `json:"p50_time"`
+	P95Time []float64 `json:"p95_time"`
+	P99Time []float64 `json:"p99_time"`
+}
+
+// upstreamsPerfResp is the response to the GET /control/stats/upstreams HTTP
+// API.
+type upstreamsPerfResp struct {
+	TimeUnits string `json:"time_units"`
+
+	Upstreams []*upstreamSeriesJSON `json:"upstreams"`
+	Groups    []*upstreamSeriesJSON `json:"groups"`
+}
+
+// upstreamSeries returns the performance time series of the upstreams
+// retrieved from the units by get.  Each element of timeUnits is the units of a
+// single point.
+func upstreamSeries(
+	timeUnits [][]*unitDB,
+	get func(u *unitDB) (uudbs []upstreamUnitDB),
+) (series []*upstreamSeriesJSON) {
+	points := make([]map[string]*upstreamUnit, len(timeUnits))
+	totals := map[string]*upstreamUnit{}
+	for i, units := range timeUnits {
+		points[i] = map[string]*upstreamUnit{}
+		for _, u := range units {
+			for name, uu := range deserializeUpstreams(get(u)) {
+				upstreamUnitFor(points[i], name).merge(uu)
+				upstreamUnitFor(totals, name).merge(uu)
+			}
+		}
+	}
+
+	series = []*upstreamSeriesJSON{}
+	for _, total := range serializeUpstreams(totals) {
+		s := &upstreamSeriesJSON{
+			Name:         total.Name,
+			NumResponses: make([]uint64, len(points)),
+			NumErrors:    make([]uint64, len(points)),
+			FailureRatio: make([]float64, len(points)),
+			RCodes:       map[string][]uint64{},
+			AvgTime:      make([]float64, len(points)),
+			P50Time:      make([]float64, len(points)),
+			P95Time:      make([]float64, len(points)),
+			P99Time:      make([]float64, len(points)),
+		}
+
+		for i, p := range points {
+			uu := p[total.Name]
+			if uu == nil {
+				continue
+			}
+
+			s.NumResponses[i] = uu.nResponses
+			s.NumErrors[i] = uu.nErrors
+			s.FailureRatio[i] = uu.failureRatio()
+			for rc, n := range uu.rcodes {
+				addSeriesCount(s.RCodes, rc, n, i, len(points))
+			}
+			s.AvgTime[i] = uu.avgTime()
+			s.P50Time[i] = uu.percentile(0.50)
+			s.P95Time[i] = uu.percentile(0.95)
+			s.P99Time[i] = uu.percentile(0.99)
+		}
+
+		series = append(series, s)
+	}
+
+	return series
+}
+
+// splitTimeUnits splits the hourly units into the time units the same way
+// [StatsCtx.fillCollectedStats] does.
+func splitTimeUnits(units []*unitDB, curID uint32) (timeUnits string, split [][]*unitDB) {
+	days := len(units) / hoursInDay
+	if days <= 7 {
+		split = make([][]*unitDB, 0, len(units))
+		for _, u := range units {
+			split = append(split, []*unitDB{u})
+		}
+
+		return timeUnitsHours, split
+	}
+
+	units = units[len(units)-countHours(curID, days):]
+	split = make([][]*unitDB, 0, days)
+	for i := 0; i < len(units); i += hoursInDay {
+		split = append(split, units[i:min(i+hoursInDay, len(units))])
+	}
+
+	return timeUnitsDays, split
+}
+
+// handleStatsUpstreams is the handler for the GET /control/stats/upstreams HTTP
+// API.  It returns the performance time series of each upstream and each group
+// of upstreams within the statistics interval.
+func (s *StatsCtx) handleStatsUpstreams(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	units, curID, ok := s.loadUnitsForWeb()
+	if !ok {
+		aghhttp.Error(r, w, http.StatusInternalServerError, "loading statistics")
+
+		return
+	}
+
+	timeUnits, split := splitTimeUnits(units, curID)
+	resp := &upstreamsPerfResp{
+		TimeUnits: timeUnits,
+		Upstreams: upstreamSeries(split, func(u *unitDB) (uudbs []upstreamUnitDB) {
+			return u.UpstreamsPerf
+		}),
+		Groups: upstreamSeries(split, func(u *unitDB) (uudbs []upstreamUnitDB) {
+			return u.UpstreamGroupsPerf
+		}),
+	}
+
+	log.Debug("stats: prepared upstreams data in %v", time.Since(start))
+
+	aghhttp.WriteJSONResponseOK(w, r, resp)
+}
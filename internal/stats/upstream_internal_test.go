@@ -0,0 +1,133 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamUnit_percentile(t *testing.T) {
+	uu := newUpstreamUnit()
+	for _, d := range []time.Duration{
+		time.Millisecond,
+		3 * time.Millisecond,
+		15 * time.Millisecond,
+		40 * time.Millisecond,
+		10 * time.Second,
+	} {
+		uu.addResponse(d, "NOERROR", false)
+	}
+
+	testCases := []struct {
+		name string
+		p    float64
+		want float64
+	}{{
+		name: "p20",
+		p:    0.2,
+		want: 0.001,
+	}, {
+		name: "p50",
+		p:    0.5,
+		want: 0.02,
+	}, {
+		name: "p80",
+		p:    0.8,
+		want: 0.05,
+	}, {
+		name: "p99",
+		p:    0.99,
+		want: 5,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, uu.percentile(tc.p))
+		})
+	}
+
+	assert.Zero(t, newUpstreamUnit().percentile(0.5))
+}
+
+func TestUpstreamSeries(t *testing.T) {
+	const (
+		ups1 = "1.1.1.1:53"
+		ups2 = "8.8.8.8:53"
+
+		group = "default"
+	)
+
+	u1 := newUnit(0)
+	u1.add(&Entry{
+		Domain:        "example.org",
+		Client:        "192.0.2.1",
+		Result:        RNotFiltered,
+		Upstream:      ups1,
+		UpstreamGroup: group,
+		UpstreamTime:  10 * time.Millisecond,
+		RCode:         "NOERROR",
+	})
+	u1.add(&Entry{
+		Domain:         "example.org",
+		Client:         "192.0.2.1",
+		Result:         RNotFiltered,
+		Upstream:       ups2,
+		UpstreamGroup:  group,
+		UpstreamTime:   30 * time.Millisecond,
+		UpstreamFailed: true,
+		RCode:          rcodeServFail,
+	})
+	u1.addUpstreamError("", group)
+
+	u2 := newUnit(1)
+	u2.add(&Entry{
+		Domain:        "example.org",
+		Client:        "192.0.2.1",
+		Result:        RNotFiltered,
+		Upstream:      ups1,
+		UpstreamGroup: group,
+		UpstreamTime:  20 * time.Millisecond,
+	})
+
+	timeUnits, split := splitTimeUnits([]*unitDB{u1.serialize(), u2.serialize()}, 1)
+	require.Equal(t, timeUnitsHours, timeUnits)
+	require.Len(t, split, 2)
+
+	ups := upstreamSeries(split, func(u *unitDB) (uudbs []upstreamUnitDB) {
+		return u.UpstreamsPerf
+	})
+	require.Len(t, ups, 2)
+
+	assert.Equal(t, ups1, ups[0].Name)
+	assert.Equal(t, []uint64{1, 1}, ups[0].NumResponses)
+	assert.Equal(t, []uint64{0, 0}, ups[0].NumErrors)
+	assert.Equal(t, []float64{0.01, 0.02}, ups[0].AvgTime)
+	assert.Equal(t, []float64{0.01, 0.02}, ups[0].P95Time)
+	assert.Equal(t, []float64{0, 0}, ups[0].FailureRatio)
+	assert.Equal(t, map[string][]uint64{"NOERROR": {1, 0}}, ups[0].RCodes)
+
+	assert.Equal(t, ups2, ups[1].Name)
+	assert.Equal(t, []uint64{1, 0}, ups[1].NumErrors)
+	assert.Equal(t, []float64{1, 0}, ups[1].FailureRatio)
+
+	groups := upstreamSeries(split, func(u *unitDB) (uudbs []upstreamUnitDB) {
+		return u.UpstreamGroupsPerf
+	})
+	require.Len(t, groups, 1)
+
+	assert.Equal(t, []uint64{2, 1}, groups[0].NumResponses)
+	assert.Equal(t, []uint64{2, 0}, groups[0].NumErrors)
+	assert.Equal(t, []float64{2.0 / 3.0, 0}, groups[0].FailureRatio)
+
+	// Make sure the data survives downsampling.
+	day := &unitDB{NResult: make([]uint64, resultLast)}
+	day.merge(u1.serialize())
+	day.merge(u2.serialize())
+
+	require.Len(t, day.UpstreamsPerf, 2)
+
+	assert.Equal(t, uint64(2), day.UpstreamsPerf[0].NResponses)
+	assert.Equal(t, uint64(30_000), day.UpstreamsPerf[0].TimeSum)
+}
@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// EventType is the type of a server event.
+type EventType string
+
+// Event types.
+const (
+	// EventAuthFailed is sent when a user fails to log in.  The data is
+	// [AuthFailedData].
+	EventAuthFailed EventType = "auth_failed"
+
+	// EventDiskNearlyFull is sent when the free space on the disk with the
+	// data directory falls below the threshold.  The data is
+	// [DiskNearlyFullData].
+	EventDiskNearlyFull EventType = "disk_nearly_full"
+
+	// EventFilterUpdateFailed is sent when a filter list fails to update.  The
+	// data is [FilterUpdateFailedData].
+	EventFilterUpdateFailed EventType = "filter_update_failed"
+
+	// EventRuntimeClientAdded is sent when a previously unseen runtime client
+	// appears.  The data is [RuntimeClientAddedData].
+	EventRuntimeClientAdded EventType = "runtime_client_added"
+
+	// EventUpstreamDown is sent when none of the upstream servers answers.
+	// The data is [UpstreamData].
+	EventUpstreamDown EventType = "upstream_down"
+
+	// EventUpstreamUp is sent when the upstream servers answer again after
+	// [EventUpstreamDown].  The data is [UpstreamData].
+	EventUpstreamUp EventType = "upstream_up"
+)
+
+// Validate returns an error if t isn't a known event type.
+func (t EventType) Validate() (err error) {
+	switch t {
+	case
+		EventAuthFailed,
+		EventDiskNearlyFull,
+		EventFilterUpdateFailed,
+		EventRuntimeClientAdded,
+		EventUpstreamDown,
+		EventUpstreamUp:
+		return nil
+	default:
+		return fmt.Errorf("unknown event type %q", t)
+	}
+}
+
+// AuthFailedData is the data of [EventAuthFailed].
+type AuthFailedData struct {
+	// User is the name of the user, as sent by the client.
+	User string `json:"user"`
+
+	// IP is the address of the client.
+	IP string `json:"ip"`
+}
+
+// DiskNearlyFullData is the data of [EventDiskNearlyFull].
+type DiskNearlyFullData struct {
+	// Path is the path of the directory on the disk.
+	Path string `json:"path"`
+
+	// Available is the number of bytes available.
+	Available uint64 `json:"available"`
+
+	// Total is the size of the disk in bytes.
+	Total uint64 `json:"total"`
+}
+
+// FilterUpdateFailedData is the data of [EventFilterUpdateFailed].
+type FilterUpdateFailedData struct {
+	// Name is the name of the filter list.
+	Name string `json:"name"`
+
+	// URL is the URL of the filter list.
+	URL string `json:"url"`
+
+	// Error is the reason of the failure.
+	Error string `json:"error"`
+}
+
+// RuntimeClientAddedData is the data of [EventRuntimeClientAdded].
+type RuntimeClientAddedData struct {
+	// Host is the hostname of the client.  It may be empty.
+	Host string `json:"host,omitempty"`
+
+	// Source is the source the client has been found in, for example "ARP".
+	Source string `json:"source"`
+
+	// IP is the address of the client.
+	IP netip.Addr `json:"ip"`
+}
+
+// UpstreamData is the data of [EventUpstreamDown] and [EventUpstreamUp].
+type UpstreamData struct {
+	// Error is the reason of the failure.  It's empty for [EventUpstreamUp].
+	Error string `json:"error,omitempty"`
+}
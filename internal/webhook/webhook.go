@@ -0,0 +1,315 @@
+// Package webhook implements sending the server events as JSON to the HTTP
+// endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardHome/internal/aghhttp"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/httphdr"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Headers of the webhook requests.
+const (
+	// HdrEvent is the header with the type of the event.
+	HdrEvent = "X-AdGuard-Home-Event"
+
+	// HdrSignature is the header with the HMAC-SHA256 of the request body
+	// signed with the secret of the endpoint, in the "sha256=<hex>" format.
+	HdrSignature = "X-AdGuard-Home-Signature"
+)
+
+// signaturePrefix is the prefix of the value of [HdrSignature].
+const signaturePrefix = "sha256="
+
+// queueSize is the number of events waiting to be sent.  New events are
+// dropped when the queue is full.
+const queueSize = 256
+
+// Endpoint is an HTTP endpoint the events are sent to.
+type Endpoint struct {
+	// URL is the URL to POST the events to.  It must not be nil.
+	URL *url.URL
+
+	// Secret is the key to sign the request bodies with.  If empty, the
+	// requests aren't signed.
+	Secret []byte
+
+	// Events are the types of the events sent to the endpoint.  If empty, all
+	// the events are sent.
+	Events []EventType
+}
+
+// wants returns true if e subscribes to the events of typ.
+func (e *Endpoint) wants(typ EventType) (ok bool) {
+	return len(e.Events) == 0 || slices.Contains(e.Events, typ)
+}
+
+// Config is the configuration of a [Notifier].
+type Config struct {
+	// HTTPClient is used to send the events.  It must not be nil.
+	HTTPClient *http.Client
+
+	// Endpoints are the endpoints to send the events to.  It must not be
+	// empty.
+	Endpoints []*Endpoint
+
+	// RetryDelay is the delay before the first retry.  The delay is doubled
+	// before each next one.  It must be positive if Retries isn't zero.
+	RetryDelay time.Duration
+
+	// Retries is the maximum number of retries of a failed delivery.
+	Retries uint
+}
+
+// Event is a single server event.
+type Event struct {
+	// Time is the time the event has happened.
+	Time time.Time `json:"time"`
+
+	// Data is the event-specific data, see the *Data types.
+	Data any `json:"data,omitempty"`
+
+	// ID is the unique identifier of the event, which remains the same across
+	// the retries.
+	ID string `json:"id"`
+
+	// Type is the type of the event.
+	Type EventType `json:"type"`
+}
+
+// Notifier sends the server events to the endpoints.  A nil *Notifier is a
+// valid notifier that drops all the events.
+type Notifier struct {
+	conf *Config
+
+	queue chan *Event
+
+	// done is closed when the notifier is closed.
+	done chan struct{}
+
+	// stopped is closed when the sending goroutine has exited.
+	stopped chan struct{}
+}
+
+// NewNotifier returns a new properly initialized *Notifier.  conf must not be
+// nil.
+func NewNotifier(conf *Config) (n *Notifier, err error) {
+	if len(conf.Endpoints) == 0 {
+		return nil, errors.Error("endpoints: empty value")
+	} else if conf.Retries > 0 && conf.RetryDelay <= 0 {
+		return nil, fmt.Errorf("retry delay: must be positive, got %s", conf.RetryDelay)
+	}
+
+	for i, e := range conf.Endpoints {
+		err = validateEndpoint(e)
+		if err != nil {
+			return nil, fmt.Errorf("endpoints: at index %d: %w", i, err)
+		}
+	}
+
+	return &Notifier{
+		conf:    conf,
+		queue:   make(chan *Event, queueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// validateEndpoint returns an error if e is invalid.
+func validateEndpoint(e *Endpoint) (err error) {
+	if e.URL == nil {
+		return errors.Error("url: no value")
+	} else if e.URL.Scheme != "http" && e.URL.Scheme != "https" {
+		return fmt.Errorf("url: scheme must be http or https, got %q", e.URL.Scheme)
+	}
+
+	for i, typ := range e.Events {
+		err = typ.Validate()
+		if err != nil {
+			return fmt.Errorf("events: at index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Start starts sending the events in a separate goroutine.
+func (n *Notifier) Start() {
+	if n == nil {
+		return
+	}
+
+	go n.loop()
+}
+
+// Close stops sending the events.  The events not sent yet are dropped.  It
+// must only be called once after Start.
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+
+	close(n.done)
+	<-n.stopped
+
+	if dropped := len(n.queue); dropped > 0 {
+		log.Info("webhook: dropped %d unsent events on close", dropped)
+	}
+}
+
+// Notify queues the event of typ with data, which must be encodable as JSON.
+// It doesn't block, so it's safe to call while holding locks.
+func (n *Notifier) Notify(typ EventType, data any) {
+	if n == nil {
+		return
+	}
+
+	e := &Event{
+		Time: time.Now(),
+		Data: data,
+		ID:   newEventID(),
+		Type: typ,
+	}
+
+	select {
+	case n.queue <- e:
+		// Go on.
+	default:
+		log.Error("webhook: queue is full, dropping %s event", typ)
+	}
+}
+
+// newEventID returns a new random event identifier.
+func newEventID() (id string) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		// crypto/rand.Read is documented to never fail on the supported
+		// platforms.
+		panic(fmt.Errorf("webhook: generating event id: %w", err))
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// loop sends the queued events until n is closed.
+func (n *Notifier) loop() {
+	defer log.OnPanic("webhook: notifier")
+	defer close(n.stopped)
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case e := <-n.queue:
+			n.send(e)
+		}
+	}
+}
+
+// send sends e to all the endpoints subscribed to it.
+func (n *Notifier) send(e *Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Error("webhook: encoding %s event: %s", e.Type, err)
+
+		return
+	}
+
+	for _, ep := range n.conf.Endpoints {
+		if !ep.wants(e.Type) {
+			continue
+		}
+
+		err = n.deliver(ep, e.Type, body)
+		if err != nil {
+			log.Error("webhook: sending %s event to %s: %s", e.Type, ep.URL.Redacted(), err)
+		}
+	}
+}
+
+// deliver sends body to ep, retrying the failed attempts.  It stops retrying
+// once n is closed.
+func (n *Notifier) deliver(ep *Endpoint, typ EventType, body []byte) (err error) {
+	delay := n.conf.RetryDelay
+	for attempt := uint(0); ; attempt++ {
+		var retry bool
+		retry, err = n.post(ep, typ, body)
+		if err == nil || !retry || attempt >= n.conf.Retries {
+			return err
+		}
+
+		log.Debug("webhook: attempt %d: %s; retrying in %s", attempt+1, err, delay)
+
+		select {
+		case <-n.done:
+			return fmt.Errorf("closed while retrying: %w", err)
+		case <-time.After(delay):
+			delay *= 2
+		}
+	}
+}
+
+// post makes a single attempt to send body to ep.  retry is true if the
+// attempt may succeed if repeated.
+func (n *Notifier) post(ep *Endpoint, typ EventType, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		ep.URL.String(),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+
+	h := req.Header
+	h.Set(httphdr.ContentType, aghhttp.HdrValApplicationJSON)
+	h.Set(httphdr.UserAgent, aghhttp.UserAgent())
+	h.Set(HdrEvent, string(typ))
+	if len(ep.Secret) > 0 {
+		h.Set(HdrSignature, Sign(ep.Secret, body))
+	}
+
+	resp, err := n.conf.HTTPClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	code := resp.StatusCode
+	if code >= http.StatusOK && code < http.StatusMultipleChoices {
+		return false, nil
+	}
+
+	retry = code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+
+	return retry, fmt.Errorf("unexpected status code %d", code)
+}
+
+// Sign returns the value of [HdrSignature] for body signed with secret.
+func Sign(secret, body []byte) (sig string) {
+	mac := hmac.New(sha256.New, secret)
+
+	// hash.Hash.Write never returns an error.
+	_, _ = mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTimeout is the common timeout for tests.
+const testTimeout = 1 * time.Second
+
+// testSecret is the common secret for tests.
+const testSecret = "secret"
+
+// newTestEndpoint returns an endpoint, which responds with the codes from codes
+// in order and then with 200 OK, sends the bodies of the requests to bodies,
+// and counts them in reqNum.
+func newTestEndpoint(
+	t *testing.T,
+	bodies chan<- []byte,
+	reqNum *atomic.Int32,
+	codes ...int,
+) (e *Endpoint) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pt := testutil.PanicT{}
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(pt, err)
+
+		assert.Equal(pt, Sign([]byte(testSecret), body), r.Header.Get(HdrSignature))
+
+		n := int(reqNum.Add(1)) - 1
+		if n < len(codes) {
+			w.WriteHeader(codes[n])
+
+			return
+		}
+
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	return &Endpoint{
+		URL:    u,
+		Secret: []byte(testSecret),
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	testCases := []struct {
+		name      string
+		codes     []int
+		wantReqs  int32
+		wantEvent bool
+	}{{
+		name:      "success",
+		codes:     nil,
+		wantReqs:  1,
+		wantEvent: true,
+	}, {
+		name:      "retried",
+		codes:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+		wantReqs:  3,
+		wantEvent: true,
+	}, {
+		name:      "not_retried",
+		codes:     []int{http.StatusBadRequest},
+		wantReqs:  1,
+		wantEvent: false,
+	}, {
+		name: "retries_exceeded",
+		codes: []int{
+			http.StatusInternalServerError,
+			http.StatusInternalServerError,
+			http.StatusInternalServerError,
+			http.StatusInternalServerError,
+		},
+		wantReqs:  4,
+		wantEvent: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bodies := make(chan []byte, 2)
+			reqNum := &atomic.Int32{}
+
+			n, err := NewNotifier(&Config{
+				HTTPClient: http.DefaultClient,
+				Endpoints:  []*Endpoint{newTestEndpoint(t, bodies, reqNum, tc.codes...)},
+				RetryDelay: time.Millisecond,
+				Retries:    3,
+			})
+			require.NoError(t, err)
+
+			n.Start()
+			testutil.CleanupAndRequireSuccess(t, func() (err error) {
+				n.Close()
+
+				return nil
+			})
+
+			n.Notify(EventAuthFailed, &AuthFailedData{User: "admin"})
+			// The events are sent in order, so the second one is always the
+			// last to be received.
+			n.Notify(EventUpstreamUp, &UpstreamData{})
+
+			var got []EventType
+			for typ := EventType(""); typ != EventUpstreamUp; {
+				var body []byte
+				body, _ = testutil.RequireReceive(t, bodies, testTimeout)
+
+				e := &Event{}
+				err = json.Unmarshal(body, e)
+				require.NoError(t, err)
+
+				typ = e.Type
+				got = append(got, typ)
+			}
+
+			want := []EventType{EventUpstreamUp}
+			if tc.wantEvent {
+				want = []EventType{EventAuthFailed, EventUpstreamUp}
+			}
+
+			assert.Equal(t, want, got)
+			assert.Equal(t, tc.wantReqs+1, reqNum.Load())
+		})
+	}
+}
+
+func TestEndpoint_Wants(t *testing.T) {
+	e := &Endpoint{
+		Events: []EventType{EventAuthFailed},
+	}
+
+	assert.True(t, e.wants(EventAuthFailed))
+	assert.False(t, e.wants(EventUpstreamDown))
+
+	e.Events = nil
+	assert.True(t, e.wants(EventUpstreamDown))
+}
+
+func TestNewNotifier(t *testing.T) {
+	u := &url.URL{Scheme: "https", Host: "hooks.example"}
+
+	testCases := []struct {
+		conf       *Config
+		name       string
+		wantErrMsg string
+	}{{
+		conf: &Config{
+			Endpoints: []*Endpoint{{URL: u}},
+		},
+		name:       "valid",
+		wantErrMsg: "",
+	}, {
+		conf:       &Config{},
+		name:       "no_endpoints",
+		wantErrMsg: "endpoints: empty value",
+	}, {
+		conf: &Config{
+			Endpoints: []*Endpoint{{URL: u}},
+			Retries:   1,
+		},
+		name:       "no_retry_delay",
+		wantErrMsg: "retry delay: must be positive, got 0s",
+	}, {
+		conf: &Config{
+			Endpoints: []*Endpoint{{URL: &url.URL{Scheme: "ftp", Host: "hooks.example"}}},
+		},
+		name:       "bad_scheme",
+		wantErrMsg: `endpoints: at index 0: url: scheme must be http or https, got "ftp"`,
+	}, {
+		conf: &Config{
+			Endpoints: []*Endpoint{{
+				URL:    u,
+				Events: []EventType{"unknown"},
+			}},
+		},
+		name:       "bad_event",
+		wantErrMsg: `endpoints: at index 0: events: at index 0: unknown event type "unknown"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewNotifier(tc.conf)
+			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
+		})
+	}
+}
+
+func TestNotifier_nil(t *testing.T) {
+	var n *Notifier
+
+	assert.NotPanics(t, func() {
+		n.Start()
+		n.Notify(EventAuthFailed, nil)
+		n.Close()
+	})
+}